@@ -0,0 +1,7 @@
+package main
+
+import "github.com/ntdkhiem/cloud-distributed-compression-platform/internal/cli"
+
+func main() {
+	cli.Main()
+}
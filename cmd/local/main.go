@@ -0,0 +1,75 @@
+// Command local runs the manager together with a compressing and a
+// decompressing worker in one process, passing jobs over an in-memory queue
+// instead of Pub/Sub. Object storage is still configured from the environment.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/manager"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/worker"
+)
+
+const (
+	compressTopicID   = "compress"
+	decompressTopicID = "decompress"
+)
+
+func main() {
+	common.SetupLogging()
+	if err := compression.RegisterFromEnv(context.Background()); err != nil {
+		slog.Error("Cannot register codecs", "error", err)
+		return
+	}
+
+	bucket := os.Getenv("GCS_BUCKET")
+	addr := os.Getenv("LISTEN_ADDR")
+	if addr == "" {
+		addr = ":8081"
+	}
+	shutdownTimeout := common.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	ctx := context.Background()
+
+	storageBackend, closeStorage, err := common.NewStorageBackend(ctx)
+	if err != nil {
+		slog.Error("Cannot connect to object storage", "error", err)
+		return
+	}
+	defer closeStorage()
+
+	queue := common.NewMemoryQueue()
+	app := manager.NewApplication(ctx, storageBackend, queue, bucket, compressTopicID, decompressTopicID)
+	// one worker takes the jobs of both topics, the memory queue delivers
+	// every topic to the subscription of the same name
+	w := worker.NewApplication(ctx, storageBackend, queue, bucket, map[string]string{
+		common.OperationCompress:   compressTopicID,
+		common.OperationDecompress: decompressTopicID,
+	})
+
+	signalCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := w.Listen(signalCtx, shutdownTimeout); err != nil {
+			slog.Error("Worker stopped with an error", "error", err)
+		}
+	}()
+
+	if err := app.Serve(signalCtx, addr); err != nil {
+		slog.Error("Server stopped with an error", "error", err)
+		stop()
+	}
+	wg.Wait()
+	slog.Info("Stopped")
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/ntdkhiem/cloud-distributed-compression-platform/internal/manager"
+
+func main() {
+	manager.Main()
+}
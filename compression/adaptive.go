@@ -0,0 +1,294 @@
+package compression
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrCorruptStream is returned when an adaptive Huffman stream can't be
+// decoded, because it was cut short or isn't one.
+var ErrCorruptStream = errors.New("corrupt adaptive huffman stream")
+
+// AdaptiveHuffmanCodec is a one-pass Huffman coding (FGK): the encoder and
+// the decoder both start from an empty tree and update it after every byte,
+// so no frequency table has to be built upfront or stored in the output.
+//
+// A byte seen for the first time is written as the code of the NYT ("not yet
+// transmitted") leaf followed by its 9 bit value; the value 256 marks the end
+// of the stream so that the padding of the last byte is never decoded.
+type AdaptiveHuffmanCodec struct{}
+
+func init() {
+	Register(AdaptiveHuffmanCodec{})
+}
+
+func (AdaptiveHuffmanCodec) Name() string { return "adaptive" }
+
+func (AdaptiveHuffmanCodec) Compress(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	bw := newBitWriter(w)
+	t := newAdaptiveTree()
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		if err := t.encode(bw, int(b)); err != nil {
+			return fmt.Errorf("failed to adaptive huffman encode: %w", err)
+		}
+		t.update(int(b))
+	}
+	if err := t.encode(bw, adaptiveEOS); err != nil {
+		return fmt.Errorf("failed to adaptive huffman encode: %w", err)
+	}
+	return bw.Flush()
+}
+
+func (AdaptiveHuffmanCodec) Decompress(r io.Reader, w io.Writer) error {
+	br := newBitReader(r)
+	out := bufio.NewWriter(w)
+	t := newAdaptiveTree()
+	for {
+		sym, err := t.decode(br)
+		if err != nil {
+			return err
+		}
+		if sym == adaptiveEOS {
+			break
+		}
+		if err := out.WriteByte(byte(sym)); err != nil {
+			return fmt.Errorf("failed to write decoded body: %w", err)
+		}
+		t.update(sym)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write decoded body: %w", err)
+	}
+	return nil
+}
+
+const (
+	// adaptiveEOS is the symbol ending the stream, one past the last byte.
+	adaptiveEOS        = 256
+	adaptiveSymbolBits = 9
+	// every byte can become a leaf, plus the NYT leaf and their parents
+	adaptiveMaxNodes = 2*256 + 1
+	adaptiveRoot     = adaptiveMaxNodes - 1
+	// adaptiveInternal is the symbol of nodes that aren't leaves
+	adaptiveInternal = -1
+	adaptiveNYT      = -2
+)
+
+type adaptiveNode struct {
+	weight uint64
+	parent int
+	left   int
+	right  int
+	symbol int
+}
+
+// adaptiveTree is a Huffman tree whose nodes are numbered so that weights
+// never decrease with the number (the sibling property), the root having the
+// highest. A node's number is its index in nodes.
+type adaptiveTree struct {
+	nodes  [adaptiveMaxNodes]adaptiveNode
+	leaves [256]int
+	nyt    int
+}
+
+func newAdaptiveTree() *adaptiveTree {
+	t := &adaptiveTree{nyt: adaptiveRoot}
+	t.nodes[adaptiveRoot] = adaptiveNode{parent: -1, left: -1, right: -1, symbol: adaptiveNYT}
+	for i := range t.leaves {
+		t.leaves[i] = -1
+	}
+	return t
+}
+
+// encode writes the code of sym as the tree currently stands.
+func (t *adaptiveTree) encode(bw *bitWriter, sym int) error {
+	n := t.nyt
+	if sym != adaptiveEOS && t.leaves[sym] != -1 {
+		n = t.leaves[sym]
+	}
+	if err := t.writePath(bw, n); err != nil {
+		return err
+	}
+	if n == t.nyt {
+		return bw.WriteBits(uint32(sym), adaptiveSymbolBits)
+	}
+	return nil
+}
+
+// writePath writes the bits leading from the root to node n, 0 for left.
+func (t *adaptiveTree) writePath(bw *bitWriter, n int) error {
+	var path [adaptiveMaxNodes]byte
+	depth := 0
+	for n != adaptiveRoot {
+		p := t.nodes[n].parent
+		if t.nodes[p].right == n {
+			path[depth] = 1
+		} else {
+			path[depth] = 0
+		}
+		depth++
+		n = p
+	}
+	for i := depth - 1; i >= 0; i-- {
+		if err := bw.WriteBits(uint32(path[i]), 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode reads the next symbol, adaptiveEOS included.
+func (t *adaptiveTree) decode(br *bitReader) (int, error) {
+	n := adaptiveRoot
+	for t.nodes[n].symbol == adaptiveInternal {
+		bit, err := br.ReadBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			n = t.nodes[n].left
+		} else {
+			n = t.nodes[n].right
+		}
+	}
+	if n != t.nyt {
+		return t.nodes[n].symbol, nil
+	}
+	sym, err := br.ReadBits(adaptiveSymbolBits)
+	if err != nil {
+		return 0, err
+	}
+	if sym != adaptiveEOS && (sym > adaptiveEOS || t.leaves[sym] != -1) {
+		return 0, fmt.Errorf("%w: unexpected symbol %d after NYT", ErrCorruptStream, sym)
+	}
+	return int(sym), nil
+}
+
+// update counts one more sym, adding a leaf for it if it is new, and restores
+// the sibling property by swapping every node on its way to the root with
+// the highest numbered node of the same weight.
+func (t *adaptiveTree) update(sym int) {
+	q := t.leaves[sym]
+	if q == -1 {
+		// the NYT leaf splits into a new NYT on the left and sym on the right
+		old := t.nyt
+		leaf, nyt := old-1, old-2
+		t.nodes[leaf] = adaptiveNode{parent: old, left: -1, right: -1, symbol: sym}
+		t.nodes[nyt] = adaptiveNode{parent: old, left: -1, right: -1, symbol: adaptiveNYT}
+		t.nodes[old].symbol = adaptiveInternal
+		t.nodes[old].left = nyt
+		t.nodes[old].right = leaf
+		t.leaves[sym] = leaf
+		t.nyt = nyt
+		q = leaf
+	}
+	for q != -1 {
+		leader := q
+		for leader+1 <= adaptiveRoot && t.nodes[leader+1].weight == t.nodes[q].weight {
+			leader++
+		}
+		if leader != q && leader != t.nodes[q].parent {
+			t.swap(q, leader)
+			q = leader
+		}
+		t.nodes[q].weight++
+		q = t.nodes[q].parent
+	}
+}
+
+// swap exchanges the subtrees numbered a and b, which have the same weight.
+func (t *adaptiveTree) swap(a, b int) {
+	na, nb := &t.nodes[a], &t.nodes[b]
+	na.left, nb.left = nb.left, na.left
+	na.right, nb.right = nb.right, na.right
+	na.symbol, nb.symbol = nb.symbol, na.symbol
+	for _, n := range []int{a, b} {
+		node := t.nodes[n]
+		switch node.symbol {
+		case adaptiveInternal:
+			t.nodes[node.left].parent = n
+			t.nodes[node.right].parent = n
+		case adaptiveNYT:
+			t.nyt = n
+		default:
+			t.leaves[node.symbol] = n
+		}
+	}
+}
+
+// bitWriter packs bits most significant first, padding the last byte with 0s.
+type bitWriter struct {
+	w     *bufio.Writer
+	curr  byte
+	count uint
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteBits writes the n low bits of v, most significant first.
+func (bw *bitWriter) WriteBits(v uint32, n uint) error {
+	for i := n; i > 0; i-- {
+		bw.curr = bw.curr<<1 | byte(v>>(i-1)&1)
+		bw.count++
+		if bw.count == 8 {
+			if err := bw.w.WriteByte(bw.curr); err != nil {
+				return err
+			}
+			bw.curr, bw.count = 0, 0
+		}
+	}
+	return nil
+}
+
+// Flush writes the last, padded byte and everything buffered.
+func (bw *bitWriter) Flush() error {
+	if bw.count > 0 {
+		if err := bw.w.WriteByte(bw.curr << (8 - bw.count)); err != nil {
+			return err
+		}
+		bw.curr, bw.count = 0, 0
+	}
+	return bw.w.Flush()
+}
+
+type bitReader struct {
+	r     *bufio.Reader
+	curr  byte
+	count uint
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	return &bitReader{r: bufio.NewReader(r)}
+}
+
+// ReadBits reads n bits, most significant first.
+func (br *bitReader) ReadBits(n uint) (uint32, error) {
+	var v uint32
+	for range n {
+		if br.count == 0 {
+			b, err := br.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					return 0, fmt.Errorf("%w: %v", ErrCorruptStream, io.ErrUnexpectedEOF)
+				}
+				return 0, err
+			}
+			br.curr, br.count = b, 8
+		}
+		br.count--
+		v = v<<1 | uint32(br.curr>>br.count&1)
+	}
+	return v, nil
+}
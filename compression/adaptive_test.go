@@ -0,0 +1,64 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestAdaptiveHuffman_RoundTrip(t *testing.T) {
+	random := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	testCases := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "empty", input: nil},
+		{name: "single byte", input: []byte("a")},
+		{name: "one symbol", input: bytes.Repeat([]byte("z"), 1000)},
+		{name: "text", input: []byte(strings.Repeat("the quick brown fox 🦊 jumps over the lazy dog\n", 200))},
+		{name: "nul bytes", input: []byte("\x00a\x00\x00b\x00")},
+		{name: "all bytes", input: random},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var compressed, decompressed bytes.Buffer
+			if err := (AdaptiveHuffmanCodec{}).Compress(bytes.NewReader(tc.input), &compressed); err != nil {
+				t.Fatalf("compress failed: %v", err)
+			}
+			if err := (AdaptiveHuffmanCodec{}).Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("decompress failed: %v", err)
+			}
+			if !bytes.Equal(decompressed.Bytes(), tc.input) {
+				t.Errorf("round trip mismatch: got %d bytes, want %d bytes", decompressed.Len(), len(tc.input))
+			}
+		})
+	}
+}
+
+func TestAdaptiveHuffman_Compresses(t *testing.T) {
+	text := strings.Repeat("aaaaaaabbbc", 1000)
+	var compressed bytes.Buffer
+	if err := (AdaptiveHuffmanCodec{}).Compress(strings.NewReader(text), &compressed); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if compressed.Len() >= len(text)/2 {
+		t.Errorf("expected output well under %d bytes, got %d", len(text)/2, compressed.Len())
+	}
+}
+
+func TestAdaptiveHuffman_Truncated(t *testing.T) {
+	var compressed bytes.Buffer
+	if err := (AdaptiveHuffmanCodec{}).Compress(strings.NewReader("truncated stream"), &compressed); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	truncated := compressed.Bytes()[:compressed.Len()/2]
+	err := (AdaptiveHuffmanCodec{}).Decompress(bytes.NewReader(truncated), &bytes.Buffer{})
+	if !errors.Is(err, ErrCorruptStream) {
+		t.Errorf("expected ErrCorruptStream, got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package compression
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// An archive container holds several files in one payload. Its metadata
+// indexes the members, and the payload is the data of the regular files back
+// to back in index order, so any codec can compress it like a single file.
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ArchiveMember is one entry of an archive container. Regular files have
+// their data at Offset in the uncompressed payload, directories take no room.
+type ArchiveMember struct {
+	Name    string `json:"name"`
+	Dir     bool   `json:"dir,omitempty"`
+	Mode    int64  `json:"mode,omitempty"`
+	ModTime int64  `json:"mtime,omitempty"`
+	Offset  int64  `json:"offset"`
+	Size    int64  `json:"size"`
+}
+
+// archiveMemberName cleans a tar entry name, refusing names that would land
+// outside of the directory the archive is extracted into.
+func archiveMemberName(name string) (string, bool) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// IndexTar lists the directories and regular files of a tarball with their
+// offsets in the payload TarContents produces for it. Links and special files
+// are skipped.
+func IndexTar(r io.Reader) ([]ArchiveMember, error) {
+	tr := tar.NewReader(r)
+	members := []ArchiveMember{}
+	var offset int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return members, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		info := hdr.FileInfo()
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+		name, ok := archiveMemberName(hdr.Name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unsafe member name %q", ErrInvalidArchive, hdr.Name)
+		}
+
+		member := ArchiveMember{Name: name, Mode: hdr.Mode, ModTime: hdr.ModTime.Unix(), Offset: offset}
+		if info.IsDir() {
+			member.Dir = true
+		} else {
+			member.Size = hdr.Size
+			offset += hdr.Size
+		}
+		members = append(members, member)
+	}
+}
+
+// TarContents reads the data of the regular files of a tarball back to back,
+// in the order IndexTar lists them.
+func TarContents(r io.Reader) io.Reader {
+	return &tarContents{tr: tar.NewReader(r)}
+}
+
+type tarContents struct {
+	tr      *tar.Reader
+	regular bool
+}
+
+func (t *tarContents) Read(p []byte) (int, error) {
+	for {
+		if t.regular {
+			n, err := t.tr.Read(p)
+			if err != io.EOF || n > 0 {
+				if err == io.EOF {
+					err = nil
+				}
+				return n, err
+			}
+		}
+		hdr, err := t.tr.Next()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		t.regular = hdr.FileInfo().Mode().IsRegular()
+	}
+}
+
+// WriteArchive writes tarball as an archive container indexed by members,
+// which IndexTar has to have produced from the same tarball.
+func WriteArchive(w io.Writer, codec Codec, tarball io.Reader, members []ArchiveMember, meta ContainerMetadata) error {
+	meta.Archive = true
+	meta.Members = members
+	return WriteContainer(w, codec, TarContents(tarball), meta)
+}
+
+// ArchiveWriter turns the decoded payload of an archive container back into a
+// tarball of its members, restoring the directory structure it was made from.
+// Close has to be called to write the members that come after the last data.
+type ArchiveWriter struct {
+	tw        *tar.Writer
+	members   []ArchiveMember
+	next      int
+	offset    int64
+	remaining int64
+}
+
+func NewArchiveWriter(w io.Writer, members []ArchiveMember) *ArchiveWriter {
+	return &ArchiveWriter{tw: tar.NewWriter(w), members: members}
+}
+
+// advance writes the headers of the members up to the next one expecting data.
+func (a *ArchiveWriter) advance() error {
+	for a.remaining == 0 && a.next < len(a.members) {
+		m := a.members[a.next]
+		name, ok := archiveMemberName(m.Name)
+		if !ok {
+			return fmt.Errorf("%w: unsafe member name %q", ErrInvalidArchive, m.Name)
+		}
+		if m.Offset != a.offset {
+			return fmt.Errorf("%w: %s starts at %d, expected %d", ErrInvalidArchive, name, m.Offset, a.offset)
+		}
+
+		hdr := &tar.Header{Name: name, Mode: m.Mode, ModTime: time.Unix(m.ModTime, 0), Size: m.Size, Typeflag: tar.TypeReg}
+		if m.Dir {
+			hdr.Name += "/"
+			hdr.Size = 0
+			hdr.Typeflag = tar.TypeDir
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o644
+			if m.Dir {
+				hdr.Mode = 0o755
+			}
+		}
+		if err := a.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		a.remaining = hdr.Size
+		a.next++
+	}
+	return nil
+}
+
+func (a *ArchiveWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if err := a.advance(); err != nil {
+			return written, err
+		}
+		if a.remaining == 0 {
+			return written, fmt.Errorf("%w: more data than its members hold", ErrInvalidArchive)
+		}
+		n, err := a.tw.Write(p[:min(int64(len(p)), a.remaining)])
+		written += n
+		a.offset += int64(n)
+		a.remaining -= int64(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close writes the remaining members and the end of the tarball. It fails if
+// the payload was shorter than the index says.
+func (a *ArchiveWriter) Close() error {
+	if err := a.advance(); err != nil {
+		return err
+	}
+	if a.remaining > 0 {
+		return fmt.Errorf("%w: %d bytes of data missing", ErrInvalidArchive, a.remaining)
+	}
+	return a.tw.Close()
+}
@@ -0,0 +1,152 @@
+package compression
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type tarEntry struct {
+	name string
+	dir  bool
+	body string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o600, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.dir {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0o700
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		io.WriteString(tw, e.body)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func readTar(t *testing.T, data []byte) []tarEntry {
+	t.Helper()
+	var entries []tarEntry
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("failed to read tar: %v", err)
+		}
+		body, _ := io.ReadAll(tr)
+		entries = append(entries, tarEntry{name: hdr.Name, dir: hdr.Typeflag == tar.TypeDir, body: string(body)})
+	}
+}
+
+// roundTripArchive packs tarball into an archive container and restores it.
+func roundTripArchive(t *testing.T, codec string, tarball []byte) (*ContainerHeader, []byte) {
+	t.Helper()
+	c, _ := Lookup(codec)
+	members, err := IndexTar(bytes.NewReader(tarball))
+	if err != nil {
+		t.Fatalf("index failed: %v", err)
+	}
+	var container bytes.Buffer
+	if err := WriteArchive(&container, c, bytes.NewReader(tarball), members, ContainerMetadata{Name: "files.tar"}); err != nil {
+		t.Fatalf("write archive failed: %v", err)
+	}
+
+	r := bytes.NewReader(container.Bytes())
+	header, err := ReadContainerHeader(r)
+	if err != nil {
+		t.Fatalf("read header failed: %v", err)
+	}
+	var restored bytes.Buffer
+	aw := NewArchiveWriter(&restored, header.Metadata.Members)
+	if err := ReadContainerPayload(r, header, aw, nil); err != nil {
+		t.Fatalf("read payload failed: %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatalf("close archive writer failed: %v", err)
+	}
+	return header, restored.Bytes()
+}
+
+func TestArchive_RoundTrip(t *testing.T) {
+	entries := []tarEntry{
+		{name: "docs/", dir: true},
+		{name: "docs/a.txt", body: "first file\n"},
+		{name: "docs/empty.txt"},
+		{name: "docs/nested/", dir: true},
+		{name: "docs/nested/b.txt", body: "second file, a bit longer than the first\n"},
+		{name: "top.txt", body: "at the root"},
+	}
+	for _, codec := range []string{"huffman", "zstd"} {
+		t.Run(codec, func(t *testing.T) {
+			header, restored := roundTripArchive(t, codec, buildTar(t, entries))
+			if !header.Metadata.Archive || len(header.Metadata.Members) != len(entries) {
+				t.Fatalf("unexpected metadata: %+v", header.Metadata)
+			}
+			if m := header.Metadata.Members[4]; m.Name != "docs/nested/b.txt" || m.Offset != 11 || m.Size != 41 {
+				t.Errorf("unexpected member: %+v", m)
+			}
+
+			got := readTar(t, restored)
+			if len(got) != len(entries) {
+				t.Fatalf("expected %d entries, got %d", len(entries), len(got))
+			}
+			for i := range entries {
+				if got[i] != entries[i] {
+					t.Errorf("entry %d: got %+v, want %+v", i, got[i], entries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestArchive_LargeIndex(t *testing.T) {
+	// enough members for the index to outgrow the version 2 header
+	var entries []tarEntry
+	for i := range 2000 {
+		entries = append(entries, tarEntry{name: fmt.Sprintf("dir/file-%04d.txt", i), body: fmt.Sprintf("%d\n", i)})
+	}
+	header, restored := roundTripArchive(t, "zstd", buildTar(t, entries))
+	if header.Version != 3 {
+		t.Errorf("expected a version 3 container, got %d", header.Version)
+	}
+	if got := readTar(t, restored); len(got) != len(entries) || got[1999] != entries[1999] {
+		t.Errorf("unexpected restored tarball with %d entries", len(got))
+	}
+}
+
+func TestIndexTar_UnsafeName(t *testing.T) {
+	for _, name := range []string{"../escape.txt", "/etc/passwd", "a/../../b"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := IndexTar(bytes.NewReader(buildTar(t, []tarEntry{{name: name, body: "x"}})))
+			if !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("expected ErrInvalidArchive, got %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveWriter_MissingData(t *testing.T) {
+	var out bytes.Buffer
+	aw := NewArchiveWriter(&out, []ArchiveMember{{Name: "a.txt", Size: 10}})
+	aw.Write([]byte("short"))
+	if err := aw.Close(); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("expected ErrInvalidArchive, got %v", err)
+	}
+	if _, err := NewArchiveWriter(&out, nil).Write([]byte("extra")); !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("expected ErrInvalidArchive, got %v", err)
+	}
+}
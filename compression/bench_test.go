@@ -0,0 +1,72 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var benchSizes = []struct {
+	name string
+	size int
+}{
+	{name: "1KB", size: 1 << 10},
+	{name: "64KB", size: 64 << 10},
+	{name: "1MB", size: 1 << 20},
+}
+
+// benchCodec reports the compression of every corpus by codec, as throughput
+// of the input, allocations and the compressed to original size ratio.
+func benchCodec(b *testing.B, codec Codec) {
+	for _, kind := range Corpora {
+		for _, size := range benchSizes {
+			input, err := Corpus(kind, size.size)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/%s/compress", kind, size.name), func(b *testing.B) {
+				var compressed bytes.Buffer
+				b.SetBytes(int64(len(input)))
+				b.ReportAllocs()
+				for b.Loop() {
+					compressed.Reset()
+					if err := codec.Compress(bytes.NewReader(input), &compressed); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(compressed.Len())/float64(len(input)), "ratio")
+			})
+
+			var compressed bytes.Buffer
+			if err := codec.Compress(bytes.NewReader(input), &compressed); err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/%s/decompress", kind, size.name), func(b *testing.B) {
+				b.SetBytes(int64(len(input)))
+				b.ReportAllocs()
+				for b.Loop() {
+					if err := codec.Decompress(bytes.NewReader(compressed.Bytes()), io.Discard); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCodecs(b *testing.B) {
+	for _, name := range Codecs() {
+		codec, _ := Lookup(name)
+		b.Run(name, func(b *testing.B) { benchCodec(b, codec) })
+	}
+}
+
+// BenchmarkHuffmanChunks compares how many chunks to encode Huffman bodies in.
+func BenchmarkHuffmanChunks(b *testing.B) {
+	for _, chunks := range []int{1, 2, 3, 4, 8, 16} {
+		b.Run(fmt.Sprintf("chunks=%d", chunks), func(b *testing.B) {
+			benchCodec(b, HuffmanCodec{Chunks: chunks})
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package compression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrUnknownCodec     = errors.New("unknown codec")
+	ErrUnsupportedLevel = errors.New("unsupported compression level")
+)
+
+// Codec is a compression algorithm that workers and the CLI can select by
+// name without knowing anything about its implementation.
+type Codec interface {
+	Name() string
+	Compress(r io.Reader, w io.Writer) error
+	Decompress(r io.Reader, w io.Writer) error
+}
+
+// LevelCodec is implemented by codecs whose compression level can be chosen,
+// higher levels trading speed for a smaller output.
+type LevelCodec interface {
+	Codec
+	// WithLevel returns a copy of the codec compressing at level.
+	WithLevel(level int) (Codec, error)
+}
+
+// WithLevel returns c set to compress at level. Level 0 keeps the codec's
+// default and is accepted by every codec.
+func WithLevel(c Codec, level int) (Codec, error) {
+	if level == 0 {
+		return c, nil
+	}
+	lc, ok := c.(LevelCodec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no levels", ErrUnsupportedLevel, c.Name())
+	}
+	return lc.WithLevel(level)
+}
+
+// ContextCodec is implemented by codecs that run outside of the process or in
+// a sandbox, which can be stopped once the work they are doing for isn't
+// wanted anymore.
+type ContextCodec interface {
+	Codec
+	// WithContext returns a copy of the codec that stops running when ctx
+	// is done.
+	WithContext(ctx context.Context) Codec
+}
+
+// WithContext returns c set to stop running when ctx is done. Codecs that
+// can't be stopped are returned as they are.
+func WithContext(ctx context.Context, c Codec) Codec {
+	if cc, ok := c.(ContextCodec); ok {
+		return cc.WithContext(ctx)
+	}
+	return c
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+// Register makes a codec available by its name. It panics if a codec with the
+// same name is already registered.
+func Register(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	if _, dup := codecs[c.Name()]; dup {
+		panic("compression: Register called twice for codec " + c.Name())
+	}
+	codecs[c.Name()] = c
+}
+
+// Lookup returns the registered codec with the given name.
+func Lookup(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// Codecs returns the sorted names of all registered codecs.
+func Codecs() []string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HuffmanCodec is the chunked Huffman coding used by Compress/Decompress.
+type HuffmanCodec struct {
+	// Chunks is how many chunks the body is encoded in at once, 0 sizes
+	// them by DefaultHuffmanChunkSizes. Decoding reads the chunk count from
+	// the data.
+	Chunks int
+}
+
+func init() {
+	Register(HuffmanCodec{})
+}
+
+func (HuffmanCodec) Name() string { return "huffman" }
+
+func (c HuffmanCodec) Compress(r io.Reader, w io.Writer) error {
+	buf, err := compressChunks(r, c.Chunks)
+	if err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// Decompress reads the output of either Huffman encoder, see DecodeHuffman.
+func (HuffmanCodec) Decompress(r io.Reader, w io.Writer) error {
+	return DecodeHuffman(r, w, HuffmanLayoutChunked)
+}
@@ -0,0 +1,124 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	codec, err := Lookup("huffman")
+	if err != nil {
+		t.Fatalf("expected huffman codec to be registered: %v", err)
+	}
+	if codec.Name() != "huffman" {
+		t.Errorf("expected codec name 'huffman', got %q", codec.Name())
+	}
+
+	if _, err := Lookup("nope"); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("expected ErrUnknownCodec, got %v", err)
+	}
+
+	if !slices.Contains(Codecs(), "huffman") {
+		t.Errorf("expected Codecs() to list huffman, got %v", Codecs())
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	text := strings.Repeat("the quick brown fox 🦊 jumps over the lazy dog\n", 100)
+	for _, name := range Codecs() {
+		t.Run(name, func(t *testing.T) {
+			codec, _ := Lookup(name)
+
+			var compressed, decompressed bytes.Buffer
+			if err := codec.Compress(strings.NewReader(text), &compressed); err != nil {
+				t.Fatalf("compress failed: %v", err)
+			}
+			if err := codec.Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("decompress failed: %v", err)
+			}
+			if decompressed.String() != text {
+				t.Errorf("round trip mismatch: got %d bytes, want %d bytes", decompressed.Len(), len(text))
+			}
+		})
+	}
+}
+
+func TestWithLevel(t *testing.T) {
+	testCases := []struct {
+		codec   string
+		level   int
+		wantErr bool
+	}{
+		{codec: "zstd", level: 0},
+		{codec: "zstd", level: 1},
+		{codec: "zstd", level: 19},
+		{codec: "zstd", level: 23, wantErr: true},
+		{codec: "gzip", level: 9},
+		{codec: "gzip", level: 10, wantErr: true},
+		{codec: "gzip", level: -1, wantErr: true},
+		{codec: "huffman", level: 0},
+		{codec: "huffman", level: 3, wantErr: true},
+	}
+
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s level %d", tc.codec, tc.level), func(t *testing.T) {
+			codec, _ := Lookup(tc.codec)
+			leveled, err := WithLevel(codec, tc.level)
+			if tc.wantErr {
+				if !errors.Is(err, ErrUnsupportedLevel) {
+					t.Errorf("expected ErrUnsupportedLevel, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WithLevel failed: %v", err)
+			}
+
+			var compressed, decompressed bytes.Buffer
+			if err := leveled.Compress(strings.NewReader(text), &compressed); err != nil {
+				t.Fatalf("compress failed: %v", err)
+			}
+			if err := codec.Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("decompress failed: %v", err)
+			}
+			if decompressed.String() != text {
+				t.Errorf("round trip mismatch: got %d bytes, want %d bytes", decompressed.Len(), len(text))
+			}
+		})
+	}
+}
+
+func TestHuffmanCodec_Chunks(t *testing.T) {
+	text := strings.Repeat("chunked huffman\n", 100)
+	for _, chunks := range []int{1, 7, 200} {
+		var compressed, decompressed bytes.Buffer
+		if err := (HuffmanCodec{Chunks: chunks}).Compress(strings.NewReader(text), &compressed); err != nil {
+			t.Fatalf("compress in %d chunks failed: %v", chunks, err)
+		}
+		if err := (HuffmanCodec{}).Decompress(&compressed, &decompressed); err != nil {
+			t.Fatalf("decompress of %d chunks failed: %v", chunks, err)
+		}
+		if decompressed.String() != text {
+			t.Errorf("round trip of %d chunks mismatch", chunks)
+		}
+	}
+}
+
+func TestIsCorrupt(t *testing.T) {
+	for _, name := range []string{"gzip", "zstd"} {
+		codec, _ := Lookup(name)
+		err := codec.Decompress(strings.NewReader("definitely not compressed data"), io.Discard)
+		if err == nil || !IsCorrupt(err) {
+			t.Errorf("Expected %s to report corrupt input, got %v", name, err)
+		}
+	}
+	if IsCorrupt(io.ErrUnexpectedEOF) || IsCorrupt(errors.New("connection reset")) {
+		t.Error("Expected read failures not to count as corrupt input")
+	}
+}
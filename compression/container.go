@@ -0,0 +1,312 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// A .ranran container wraps the output of any codec:
+//
+//	magic     [4]byte  "RANR"
+//	version   uint8    format version, currently 4
+//	algorithm uint8    ID of the codec that produced the payload, 0 when
+//	                   the metadata names it instead (version >= 2)
+//	metaLen   uint16   length of the metadata (version 2, little endian)
+//	          uint32   length of the metadata (version >= 3, little endian)
+//	metadata  []byte   JSON encoded ContainerMetadata (version >= 2)
+//	payload   ...      codec output
+//	size      uint64   size of the uncompressed data (little endian)
+//	checksum  uint32   CRC32 (IEEE) of the uncompressed data (little endian)
+//
+// Like gzip, the size and checksum live in a trailer so that a container can
+// be written in one pass without knowing the input upfront.
+//
+// Version 3 only widens metaLen for the index of large archives. Containers
+// whose metadata fits are still written as version 2 so that older readers
+// can open them. Version 4 containers are joined from parts compressed on
+// their own, see JoinContainer, which older readers would take for corrupt.
+const ContainerVersion uint8 = 4
+
+// minContainerVersion is the oldest version ReadContainerHeader understands.
+const minContainerVersion uint8 = 1
+
+var ContainerMagic = []byte("RANR")
+
+const (
+	containerHeaderLen  = 6
+	containerTrailerLen = 12
+)
+
+var (
+	ErrBadMagic           = errors.New("not a ranran container")
+	ErrUnsupportedVersion = errors.New("unsupported container version")
+	ErrTruncatedContainer = errors.New("truncated container")
+	ErrChecksumMismatch   = errors.New("checksum mismatch")
+)
+
+// namedAlgorithmID stands for codecs without an ID of their own, such as
+// plugins, which ContainerMetadata.Algorithm names instead.
+const namedAlgorithmID uint8 = 0
+
+// algorithmIDs are stored in the container header, never reuse a value.
+var algorithmIDs = map[string]uint8{
+	"huffman":  1,
+	"zstd":     2,
+	"gzip":     3,
+	"adaptive": 4,
+	"store":    5,
+}
+
+func algorithmName(id uint8) (string, bool) {
+	for name, v := range algorithmIDs {
+		if v == id {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// ContainerMetadata describes the original file so that decompression can
+// restore it, even when the container was downloaded and uploaded again.
+type ContainerMetadata struct {
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	// Archive containers hold the files listed in Members, see WriteArchive.
+	Archive bool            `json:"archive,omitempty"`
+	Members []ArchiveMember `json:"members,omitempty"`
+	// Parts split the payload into the output of separate codec runs, see
+	// JoinContainer.
+	Parts []ContainerPart `json:"parts,omitempty"`
+	// Dictionary is the ID of the dictionary the payload was compressed
+	// with, which the codec needs to decompress it, see WithDictionary.
+	Dictionary string `json:"dictionary,omitempty"`
+	// Algorithm names the codec of the payload when it has no algorithm
+	// ID, see ContainerHeader.Algorithm.
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// ContainerHeader is the parsed header of a container.
+type ContainerHeader struct {
+	Version   uint8
+	Algorithm string
+	Metadata  ContainerMetadata
+}
+
+// digestWriter counts and checksums everything written through it.
+type digestWriter struct {
+	size uint64
+	crc  hash.Hash32
+}
+
+func newDigestWriter() *digestWriter {
+	return &digestWriter{crc: crc32.NewIEEE()}
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	d.size += uint64(len(p))
+	return d.crc.Write(p)
+}
+
+// WriteContainer encodes r with codec and writes the complete container to w.
+func WriteContainer(w io.Writer, codec Codec, r io.Reader, meta ContainerMetadata) error {
+	if err := writeContainerHeader(w, codec.Name(), meta); err != nil {
+		return err
+	}
+
+	digest := newDigestWriter()
+	if err := codec.Compress(io.TeeReader(r, digest), w); err != nil {
+		return err
+	}
+
+	return writeContainerTrailer(w, digest.size, digest.crc.Sum32())
+}
+
+// writeContainerHeader writes everything up to the payload of algorithm, in
+// the oldest version that can hold meta.
+func writeContainerHeader(w io.Writer, algorithm string, meta ContainerMetadata) error {
+	id, ok := algorithmIDs[algorithm]
+	if !ok {
+		id, meta.Algorithm = namedAlgorithmID, algorithm
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal container metadata: %w", err)
+	}
+	if uint64(len(metaBytes)) > math.MaxUint32 {
+		return fmt.Errorf("container metadata is too large: %d bytes", len(metaBytes))
+	}
+
+	var header []byte
+	switch {
+	case len(meta.Parts) > 0:
+		header = append(append([]byte{}, ContainerMagic...), 4, id)
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(metaBytes)))
+	case len(metaBytes) <= 0xffff:
+		header = append(append([]byte{}, ContainerMagic...), 2, id)
+		header = binary.LittleEndian.AppendUint16(header, uint16(len(metaBytes)))
+	default:
+		header = append(append([]byte{}, ContainerMagic...), 3, id)
+		header = binary.LittleEndian.AppendUint32(header, uint32(len(metaBytes)))
+	}
+	header = append(header, metaBytes...)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write container header: %w", err)
+	}
+	return nil
+}
+
+func writeContainerTrailer(w io.Writer, size uint64, checksum uint32) error {
+	trailer := make([]byte, containerTrailerLen)
+	binary.LittleEndian.PutUint64(trailer[0:8], size)
+	binary.LittleEndian.PutUint32(trailer[8:12], checksum)
+	if _, err := w.Write(trailer); err != nil {
+		return fmt.Errorf("failed to write container trailer: %w", err)
+	}
+	return nil
+}
+
+// ReadContainerHeader parses and validates the fixed header at the start of r.
+func ReadContainerHeader(r io.Reader) (*ContainerHeader, error) {
+	header := make([]byte, containerHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrTruncatedContainer
+		}
+		return nil, err
+	}
+	if !bytes.Equal(header[0:4], ContainerMagic) {
+		return nil, ErrBadMagic
+	}
+	version := header[4]
+	if version < minContainerVersion || version > ContainerVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+	algorithm, ok := algorithmName(header[5])
+	if !ok && (header[5] != namedAlgorithmID || version < 2) {
+		return nil, fmt.Errorf("%w: algorithm ID %d", ErrUnknownCodec, header[5])
+	}
+	result := &ContainerHeader{Version: version, Algorithm: algorithm}
+
+	if version >= 2 {
+		var n int
+		if version >= 3 {
+			metaLen := make([]byte, 4)
+			if _, err := io.ReadFull(r, metaLen); err != nil {
+				return nil, ErrTruncatedContainer
+			}
+			n = int(binary.LittleEndian.Uint32(metaLen))
+		} else {
+			metaLen := make([]byte, 2)
+			if _, err := io.ReadFull(r, metaLen); err != nil {
+				return nil, ErrTruncatedContainer
+			}
+			n = int(binary.LittleEndian.Uint16(metaLen))
+		}
+		// don't trust the length with a huge allocation upfront
+		metaBytes, err := io.ReadAll(io.LimitReader(r, int64(n)))
+		if err != nil {
+			return nil, err
+		}
+		if len(metaBytes) != n {
+			return nil, ErrTruncatedContainer
+		}
+		if err := json.Unmarshal(metaBytes, &result.Metadata); err != nil {
+			return nil, fmt.Errorf("invalid container metadata: %w", err)
+		}
+	}
+	if header[5] == namedAlgorithmID {
+		if result.Metadata.Algorithm == "" {
+			return nil, fmt.Errorf("%w: container names no algorithm", ErrUnknownCodec)
+		}
+		result.Algorithm = result.Metadata.Algorithm
+	}
+	return result, nil
+}
+
+// ReadContainer decodes the container in r into w, resolving the codec named
+// in the header with lookup (Lookup when nil). The data written to w is only
+// trustworthy once ReadContainer returns nil, as the checksum is verified last.
+func ReadContainer(r io.Reader, w io.Writer, lookup func(name string) (Codec, error)) (*ContainerHeader, error) {
+	header, err := ReadContainerHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := ReadContainerPayload(r, header, w, lookup); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// ReadContainerPayload decodes what follows a header already read with
+// ReadContainerHeader, for callers that need the metadata before writing.
+func ReadContainerPayload(r io.Reader, header *ContainerHeader, w io.Writer, lookup func(name string) (Codec, error)) error {
+	if lookup == nil {
+		lookup = Lookup
+	}
+	codec, err := lookup(header.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	payload := &holdbackReader{r: r, n: containerTrailerLen}
+	digest := newDigestWriter()
+	if len(header.Metadata.Parts) > 0 {
+		if err := readContainerParts(payload, header.Metadata.Parts, codec, io.MultiWriter(w, digest)); err != nil {
+			return err
+		}
+	} else if err := codec.Decompress(payload, io.MultiWriter(w, digest)); err != nil {
+		return err
+	}
+	// codecs may stop before the end of the payload, the trailer comes after it
+	if _, err := io.Copy(io.Discard, payload); err != nil {
+		return err
+	}
+
+	trailer := payload.held
+	if len(trailer) != containerTrailerLen {
+		return ErrTruncatedContainer
+	}
+	size := binary.LittleEndian.Uint64(trailer[0:8])
+	checksum := binary.LittleEndian.Uint32(trailer[8:12])
+	if size != digest.size || checksum != digest.crc.Sum32() {
+		return fmt.Errorf("%w: expected %d bytes (crc %08x), got %d bytes (crc %08x)",
+			ErrChecksumMismatch, size, checksum, digest.size, digest.crc.Sum32())
+	}
+	return nil
+}
+
+// holdbackReader passes through everything from r except the last n bytes,
+// which are kept in held once r is exhausted.
+type holdbackReader struct {
+	r       io.Reader
+	n       int
+	held    []byte
+	scratch []byte
+	err     error
+}
+
+func (h *holdbackReader) Read(p []byte) (int, error) {
+	for len(h.held) <= h.n && h.err == nil {
+		if h.scratch == nil {
+			h.scratch = make([]byte, 32*1024)
+		}
+		m, err := h.r.Read(h.scratch)
+		h.held = append(h.held, h.scratch[:m]...)
+		h.err = err
+	}
+
+	release := len(h.held) - h.n
+	if release <= 0 {
+		return 0, h.err
+	}
+	k := copy(p, h.held[:release])
+	h.held = h.held[k:]
+	return k, nil
+}
@@ -0,0 +1,119 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func writeTestContainer(t *testing.T, codecName, text string) []byte {
+	t.Helper()
+	codec, err := Lookup(codecName)
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	var buf bytes.Buffer
+	meta := ContainerMetadata{Name: "notes.txt", ContentType: "text/plain"}
+	if err := WriteContainer(&buf, codec, strings.NewReader(text), meta); err != nil {
+		t.Fatalf("write container failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestContainer_RoundTrip(t *testing.T) {
+	text := strings.Repeat("containers carry their own checksum\n", 50)
+	for _, name := range []string{"huffman", "zstd", "gzip", "store"} {
+		t.Run(name, func(t *testing.T) {
+			data := writeTestContainer(t, name, text)
+			if !bytes.HasPrefix(data, ContainerMagic) {
+				t.Fatalf("expected container to start with magic bytes")
+			}
+
+			var out bytes.Buffer
+			header, err := ReadContainer(bytes.NewReader(data), &out, nil)
+			if err != nil {
+				t.Fatalf("read container failed: %v", err)
+			}
+			// metadata this small keeps the version 2 header
+			if header.Algorithm != name || header.Version != 2 {
+				t.Errorf("unexpected header: %+v", header)
+			}
+			if header.Metadata.Name != "notes.txt" || header.Metadata.ContentType != "text/plain" {
+				t.Errorf("unexpected metadata: %+v", header.Metadata)
+			}
+			if out.String() != text {
+				t.Errorf("round trip mismatch: got %d bytes, want %d bytes", out.Len(), len(text))
+			}
+		})
+	}
+}
+
+func TestContainer_Version1(t *testing.T) {
+	// version 1 containers have no metadata section
+	var v1 bytes.Buffer
+	v1.Write(ContainerMagic)
+	v1.Write([]byte{1, algorithmIDs["gzip"]})
+	if err := (GzipCodec{}).Compress(strings.NewReader("old"), &v1); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	v1.Write([]byte{3, 0, 0, 0, 0, 0, 0, 0})
+	v1.Write([]byte{0xe5, 0xd4, 0x5d, 0x3f}) // crc32("old")
+
+	var out bytes.Buffer
+	header, err := ReadContainer(&v1, &out, nil)
+	if err != nil {
+		t.Fatalf("read container failed: %v", err)
+	}
+	if header.Version != 1 || out.String() != "old" {
+		t.Errorf("unexpected result: %+v %q", header, out.String())
+	}
+}
+
+func TestContainer_Invalid(t *testing.T) {
+	valid := writeTestContainer(t, "zstd", "some text worth checking")
+
+	testCases := []struct {
+		name    string
+		data    func() []byte
+		wantErr error
+	}{
+		{
+			name:    "bad magic",
+			data:    func() []byte { return append([]byte("NOPE"), valid[4:]...) },
+			wantErr: ErrBadMagic,
+		},
+		{
+			name: "unsupported version",
+			data: func() []byte {
+				d := bytes.Clone(valid)
+				d[4] = ContainerVersion + 1
+				return d
+			},
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "truncated header",
+			data:    func() []byte { return valid[:3] },
+			wantErr: ErrTruncatedContainer,
+		},
+		{
+			name: "checksum mismatch",
+			data: func() []byte {
+				d := bytes.Clone(valid)
+				d[len(d)-1] ^= 0xff
+				return d
+			},
+			wantErr: ErrChecksumMismatch,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadContainer(bytes.NewReader(tc.data()), &bytes.Buffer{}, nil)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+)
+
+// Corpora are the kinds of input that benchmarks run the codecs over.
+var Corpora = []string{"text", "binary", "repetitive"}
+
+var corpusWords = []string{
+	"the", "quick", "brown", "fox", "jumps", "over", "lazy", "dog", "compression",
+	"distributed", "worker", "manager", "storage", "queue", "huffman", "tree",
+	"symbol", "frequency", "chunk", "stream", "container", "checksum", "job",
+}
+
+// Corpus generates size bytes of the given kind. The same arguments always
+// give the same bytes so that benchmark runs can be compared.
+func Corpus(kind string, size int) ([]byte, error) {
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	buf.Grow(size + 32)
+	switch kind {
+	case "text":
+		// words of skewed frequencies, like natural language
+		for buf.Len() < size {
+			word := corpusWords[int(float64(len(corpusWords))*rng.Float64()*rng.Float64())]
+			buf.WriteString(word)
+			if rng.Intn(12) == 0 {
+				buf.WriteByte('\n')
+			} else {
+				buf.WriteByte(' ')
+			}
+		}
+	case "binary":
+		buf.Write(make([]byte, size))
+		rng.Read(buf.Bytes())
+	case "repetitive":
+		for buf.Len() < size {
+			buf.WriteString("the same line over and over again\n")
+		}
+	default:
+		return nil, fmt.Errorf("unknown corpus %q", kind)
+	}
+	return buf.Bytes()[:size], nil
+}
@@ -0,0 +1,52 @@
+package compression
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// corruptErrors are what the codecs and the formats they build on fail with
+// on input they can't decode, however often they are given it.
+var corruptErrors = []error{
+	ErrBadMagic,
+	ErrUnsupportedVersion,
+	ErrTruncatedContainer,
+	ErrChecksumMismatch,
+	ErrInvalidArchive,
+	ErrCorruptStream,
+	ErrCorruptHuffman,
+	gzip.ErrHeader,
+	gzip.ErrChecksum,
+	zstd.ErrReservedBlockType,
+	zstd.ErrCompressedSizeTooBig,
+	zstd.ErrBlockTooSmall,
+	zstd.ErrUnexpectedBlockSize,
+	zstd.ErrMagicMismatch,
+	zstd.ErrWindowSizeExceeded,
+	zstd.ErrWindowSizeTooSmall,
+	zstd.ErrUnknownDictionary,
+	zstd.ErrFrameSizeExceeded,
+	zstd.ErrFrameSizeMismatch,
+	zstd.ErrCRCMismatch,
+}
+
+// IsCorrupt reports whether err means the input of a codec is corrupt, as
+// opposed to failing to be read or written. Input that ends early counts
+// when its format reports it, as ErrTruncatedContainer and the ErrTruncated
+// of Huffman streams do; a bare io.ErrUnexpectedEOF isn't counted, the
+// stream may just have been cut off by its reader.
+func IsCorrupt(err error) bool {
+	var flateErr flate.CorruptInputError
+	if errors.As(err, &flateErr) {
+		return true
+	}
+	for _, target := range corruptErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
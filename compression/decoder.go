@@ -0,0 +1,350 @@
+package compression
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Both Huffman encoders write the same code table, but follow it with a body
+// of their own layout, see HuffmanLayoutChunked and HuffmanLayoutStream. The
+// table records which in an entry of 0 bits, which no symbol can have,
+// holding the version of the layout in place of the symbol. Decoders from
+// before the layout was recorded put that entry on the root of the tree,
+// where decoding never looks, so they still read the streams of their own
+// encoder.
+var huffmanLayoutVersions = map[string]uint32{
+	HuffmanLayoutChunked: 1,
+	HuffmanLayoutStream:  2,
+}
+
+func huffmanLayout(version uint32) (string, bool) {
+	for layout, v := range huffmanLayoutVersions {
+		if v == version {
+			return layout, true
+		}
+	}
+	return "", false
+}
+
+// HuffmanLayoutEntry returns the code table entry recording layout.
+func HuffmanLayoutEntry(layout string) []byte {
+	entry := make([]byte, 9)
+	binary.LittleEndian.PutUint32(entry[0:4], huffmanLayoutVersions[layout])
+	return entry
+}
+
+// huffmanLookahead is how much of a body is read ahead to tell its layout,
+// when it doesn't record it.
+const huffmanLookahead = 64 * 1024
+
+// codeTable is the header of a Huffman stream: the tree of its codes and,
+// unless the stream is older than that, the layout of the body after it.
+type codeTable struct {
+	root   *node
+	leaves []*lookupItem
+	layout string
+}
+
+// readCodeTable reads the code table at the start of r.
+func readCodeTable(r io.Reader) (*codeTable, error) {
+	headerLenBin := make([]byte, 2)
+	if _, err := io.ReadFull(r, headerLenBin); err != nil {
+		return nil, fmt.Errorf("Error extracting header length: %w", truncated(err))
+	}
+	headerLen := binary.LittleEndian.Uint16(headerLenBin)
+	if headerLen%9 != 0 {
+		return nil, fmt.Errorf("%w: header of %d bytes", ErrBadHeader, headerLen)
+	}
+	headerBin := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, headerBin); err != nil {
+		return nil, fmt.Errorf("Error extracting header: %w", truncated(err))
+	}
+
+	table := &codeTable{root: &node{}}
+	// character code + Huffman assigned code + bits -> 4 + 4 + 1 = 9 bytes
+	for i := 0; i < len(headerBin); i += 9 {
+		section := headerBin[i : i+9]
+		char := binary.LittleEndian.Uint32(section[0:4])
+		code := binary.LittleEndian.Uint32(section[4:8])
+		bits := section[8]
+		if bits == 0 {
+			layout, ok := huffmanLayout(char)
+			if !ok || table.layout != "" {
+				return nil, fmt.Errorf("%w: layout version %d", ErrBadHeader, char)
+			}
+			table.layout = layout
+			continue
+		}
+		if !validHuffmanSymbol(char) {
+			return nil, fmt.Errorf("%w: symbol %d", ErrBadHeader, char)
+		}
+		leaf, err := table.root.addNode(char, code, bits)
+		if err != nil {
+			return nil, err
+		}
+		table.leaves = append(table.leaves, leaf)
+	}
+	// a header codes at least one symbol
+	if len(table.leaves) == 0 {
+		return nil, fmt.Errorf("%w: no symbols", ErrBadHeader)
+	}
+	return table, nil
+}
+
+// ErrUnknownLayout is returned when the layout of a body that doesn't record
+// it can't be told from the body, its start reading as either, and the
+// caller doesn't know it either.
+var ErrUnknownLayout = errors.New("layout of the huffman body can't be told")
+
+// DecodeHuffman decodes the Huffman stream in r into w, whichever encoder it
+// came from. The layout of bodies whose code table doesn't record it is told
+// from the body, see detectHuffmanLayout; legacy is the one taken when the
+// start of the body reads as either, that of the encoder the caller read
+// before layouts were recorded. Input it can't decode fails with
+// ErrTruncated, ErrBadHeader or ErrInvalidCode.
+func DecodeHuffman(r io.Reader, w io.Writer, legacy string) error {
+	br := bufio.NewReaderSize(r, huffmanLookahead)
+	if _, err := br.Peek(1); err == io.EOF {
+		// empty input is coded as nothing at all
+		return nil
+	}
+	table, err := readCodeTable(br)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	if _, _, err := table.decode(br, runeSink{out}, legacy); err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("Failed to write decoded body: %w", err)
+	}
+	return nil
+}
+
+// decode walks the body in br down the code tree into sink, taking it for
+// the layout t records, or else for the layout detectHuffmanLayout tells, or
+// else for legacy. It returns the layout and, for the chunked one, how many
+// chunks the body had.
+func (t *codeTable) decode(br *bufio.Reader, sink symbolSink, legacy string) (string, int, error) {
+	layout := t.layout
+	if layout == "" {
+		var ok bool
+		if layout, ok = detectHuffmanLayout(br, t.root); !ok {
+			if legacy == "" {
+				return "", 0, ErrUnknownLayout
+			}
+			layout = legacy
+		}
+	}
+	d := &codeReader{root: t.root, at: t.root, sink: sink}
+	var err error
+	if layout == HuffmanLayoutChunked {
+		err = d.readChunks(br)
+	} else {
+		err = d.readStream(br)
+	}
+	return layout, d.chunks, err
+}
+
+// detectHuffmanLayout tells the layout of the body in br from as much of it
+// as br holds: chunked if it reads as whole chunks, up to its end or to a
+// chunk going on past what br holds, the stream layout otherwise. It can't
+// tell when the first chunk would go on past it already.
+func detectHuffmanLayout(br *bufio.Reader, root *node) (string, bool) {
+	body, err := br.Peek(br.Size())
+	atEOF := err != nil
+
+	chunks, pos := 0, 0
+	chunked := false
+	for {
+		if pos == len(body) || (!atEOF && len(body)-pos < 5) {
+			chunked = chunks > 0
+			break
+		}
+		if len(body)-pos < 5 || body[pos] > 7 {
+			break
+		}
+		n := int(binary.LittleEndian.Uint32(body[pos+1 : pos+5]))
+		if n == 0 {
+			// every symbol takes a bit at least, so encoders never write
+			// empty chunks, while streams often start with a few 0 bytes
+			break
+		}
+		if n > len(body)-pos-5 {
+			if atEOF {
+				break
+			}
+			if chunks == 0 {
+				return "", false
+			}
+			chunked = true
+			break
+		}
+		d := &codeReader{root: root, at: root, sink: make(symbolCounts)}
+		for i, b := range body[pos+5 : pos+5+n] {
+			var pad byte
+			if i == n-1 {
+				pad = body[pos]
+			}
+			if err = d.feed(b, pad); err != nil {
+				break
+			}
+		}
+		if err != nil || d.at != root {
+			break
+		}
+		chunks++
+		pos += 5 + n
+	}
+	// any body decodes as a stream with a complete tree, while chunks have to
+	// line up, so only those tell
+	if chunked {
+		return HuffmanLayoutChunked, true
+	}
+	return HuffmanLayoutStream, true
+}
+
+// symbolSink receives the symbols a codeReader decodes.
+type symbolSink interface {
+	symbol(char uint32) error
+}
+
+// runeSink writes the symbols out, as UTF-8 or as the bytes they stand for.
+type runeSink struct {
+	w *bufio.Writer
+}
+
+func (s runeSink) symbol(char uint32) error {
+	var err error
+	if char >= rawByteSymbol {
+		err = s.w.WriteByte(byte(char - rawByteSymbol))
+	} else {
+		_, err = s.w.WriteRune(rune(char))
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write decoded body: %w", err)
+	}
+	return nil
+}
+
+// symbolCounts counts the symbols instead, by symbol.
+type symbolCounts map[uint32]uint64
+
+func (c symbolCounts) symbol(char uint32) error {
+	c[char]++
+	return nil
+}
+
+// codeReader walks the bits of a body down the code tree, passing the symbol
+// of every leaf it reaches on to its sink.
+type codeReader struct {
+	root *node
+	at   *node
+	sink symbolSink
+	// chunks is how many chunks readChunks read.
+	chunks int
+}
+
+// feed decodes the bits of b from the highest down, leaving out the lowest
+// pad bits.
+func (d *codeReader) feed(b byte, pad byte) error {
+	for i := 7; i >= int(pad); i-- {
+		d.at = d.at.child((b >> uint(i)) & 1)
+		if d.at == nil {
+			return fmt.Errorf("%w: no symbol has the code", ErrInvalidCode)
+		}
+		if d.at.value != nil && d.at.value.leaf {
+			if err := d.sink.symbol(d.at.value.char); err != nil {
+				return err
+			}
+			d.at = d.root
+		}
+	}
+	return nil
+}
+
+// readStream decodes the stream layout: the padding of the last byte, then
+// the body. Only the last byte is padded, so every byte is decoded once the
+// next one is known.
+func (d *codeReader) readStream(r *bufio.Reader) error {
+	paddedZeros, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("Error extracting padded 0s: %w", truncated(err))
+	}
+	if paddedZeros > 7 {
+		return fmt.Errorf("%w: padding of %d bits", ErrBadHeader, paddedZeros)
+	}
+	if _, err := r.Peek(1); err != nil {
+		return fmt.Errorf("Error decoding body: %w", truncated(err))
+	}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("Error decoding body: %w", err)
+		}
+		var pad byte
+		if _, err := r.Peek(1); err == io.EOF {
+			pad = paddedZeros
+		} else if err != nil {
+			return fmt.Errorf("Error decoding body: %w", err)
+		}
+		if err := d.feed(b, pad); err != nil {
+			return err
+		}
+	}
+	if d.at != d.root {
+		return fmt.Errorf("%w: body ends inside a code", ErrTruncated)
+	}
+	return nil
+}
+
+// readChunks decodes the chunked layout: chunks of the padding of their last
+// byte, their length and their body, up to the end.
+func (d *codeReader) readChunks(r *bufio.Reader) error {
+	chunkHeader := make([]byte, 5)
+	for ; ; d.chunks++ {
+		if _, err := io.ReadFull(r, chunkHeader); err != nil {
+			if err == io.EOF && d.chunks > 0 {
+				return nil
+			}
+			return fmt.Errorf("Error extracting chunk: %w", truncated(err))
+		}
+		paddedZeros := chunkHeader[0]
+		if paddedZeros > 7 {
+			return fmt.Errorf("%w: padding of %d bits", ErrBadHeader, paddedZeros)
+		}
+		bodyLen := binary.LittleEndian.Uint32(chunkHeader[1:5])
+		for i := uint32(0); i < bodyLen; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return fmt.Errorf("Error decoding chunk: %w", truncated(err))
+			}
+			var pad byte
+			if i+1 == bodyLen {
+				pad = paddedZeros
+			}
+			if err := d.feed(b, pad); err != nil {
+				return err
+			}
+		}
+		if d.at != d.root {
+			return fmt.Errorf("%w: chunk ends inside a code", ErrTruncated)
+		}
+	}
+}
+
+// truncated turns the end of a stream that should have gone on into
+// ErrTruncated, and leaves other read errors as they are.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return err
+}
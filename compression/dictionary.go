@@ -0,0 +1,151 @@
+package compression
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A dictionary primes the codec with content typical of the files it is
+// trained on, so that even files too small to repeat themselves find matches.
+// Containers name the dictionary they need in their metadata; the dictionary
+// itself is kept elsewhere and shared by every container using it.
+
+// DictionaryCodec is implemented by codecs that can compress with a
+// dictionary from TrainDictionary.
+type DictionaryCodec interface {
+	Codec
+	// WithDictionary returns a copy of the codec using dict on both ends.
+	WithDictionary(dict []byte) (Codec, error)
+}
+
+// ErrNoDictionarySupport is returned for codecs without dictionaries.
+var ErrNoDictionarySupport = errors.New("codec does not support dictionaries")
+
+// ErrTooFewSamples is returned when the samples have too little in common to
+// train a dictionary on.
+var ErrTooFewSamples = errors.New("too few samples to train a dictionary")
+
+// WithDictionary returns c set to compress with dict, which may be nil for
+// none.
+func WithDictionary(c Codec, dict []byte) (Codec, error) {
+	if dict == nil {
+		return c, nil
+	}
+	dc, ok := c.(DictionaryCodec)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoDictionarySupport, c.Name())
+	}
+	return dc.WithDictionary(dict)
+}
+
+const (
+	// DictionarySize is what zstd --train aims for by default.
+	DictionarySize = 112640
+	// MinDictionarySamples is how many samples training takes at least.
+	MinDictionarySamples = 5
+
+	dictSegmentSize = 64
+	dictKmerSize    = 8
+	dictHashBits    = 22
+)
+
+// TrainDictionary builds a zstd dictionary of up to size bytes from samples
+// of the files it is meant for. The content is picked like zstd's COVER
+// trainer does, from the segments sharing the most k-mers with other
+// samples; id is the dictionary ID zstd frames refer to it by.
+func TrainDictionary(id uint32, samples [][]byte, size int) ([]byte, error) {
+	if len(samples) < MinDictionarySamples {
+		return nil, fmt.Errorf("%w: got %d, need %d", ErrTooFewSamples, len(samples), MinDictionarySamples)
+	}
+	history := selectDictionaryContent(samples, size)
+	if len(history) < dictKmerSize {
+		return nil, fmt.Errorf("%w: they share no content", ErrTooFewSamples)
+	}
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       id,
+		Contents: samples,
+		History:  history,
+		Offsets:  [3]int{1, 4, 8},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dictionary: %w", err)
+	}
+	return dict, nil
+}
+
+func kmerHash(b []byte) uint32 {
+	return uint32((binary.LittleEndian.Uint64(b) * 0x9e3779b97f4a7c15) >> (64 - dictHashBits))
+}
+
+// selectDictionaryContent picks up to size bytes of segments of the samples,
+// preferring those whose k-mers occur in the most samples and skipping those
+// mostly covered by segments picked already.
+func selectDictionaryContent(samples [][]byte, size int) []byte {
+	// in how many samples each k-mer occurs, hashed into a fixed table so
+	// that memory doesn't grow with the samples
+	counts := make([]uint16, 1<<dictHashBits)
+	lastSample := make([]int32, 1<<dictHashBits)
+	for i, sample := range samples {
+		for j := 0; j+dictKmerSize <= len(sample); j++ {
+			h := kmerHash(sample[j:])
+			if lastSample[h] != int32(i+1) {
+				lastSample[h] = int32(i + 1)
+				if counts[h] < math.MaxUint16 {
+					counts[h]++
+				}
+			}
+		}
+	}
+	// k-mers of a single sample are no use to the others
+	score := func(data []byte) int {
+		total := 0
+		for j := 0; j+dictKmerSize <= len(data); j++ {
+			total += max(int(counts[kmerHash(data[j:])])-1, 0)
+		}
+		return total
+	}
+
+	type segment struct {
+		data  []byte
+		score int
+	}
+	var segments []segment
+	for _, sample := range samples {
+		for j := 0; j < len(sample); j += dictSegmentSize {
+			data := sample[j:min(j+dictSegmentSize, len(sample))]
+			if s := score(data); s > 0 {
+				segments = append(segments, segment{data: data, score: s})
+			}
+		}
+	}
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].score > segments[j].score })
+
+	var picked [][]byte
+	total := 0
+	for _, seg := range segments {
+		if total+len(seg.data) > size {
+			continue
+		}
+		if score(seg.data) < seg.score/2 {
+			continue
+		}
+		picked = append(picked, seg.data)
+		total += len(seg.data)
+		for j := 0; j+dictKmerSize <= len(seg.data); j++ {
+			counts[kmerHash(seg.data[j:])] = 0
+		}
+	}
+
+	// zstd looks for matches at the end of the history first, so the best
+	// segments go last
+	history := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		history = append(history, picked[i]...)
+	}
+	return history
+}
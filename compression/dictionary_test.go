@@ -0,0 +1,94 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// dictionarySamples returns small JSON documents alike in everything but
+// their values, the kind of files dictionaries are for.
+func dictionarySamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = fmt.Appendf(nil, `{"event":"page_view","user_id":%d,"session":"s-%07d",`+
+			`"path":"/products/%d","referrer":"https://www.example.com/search?q=item-%d",`+
+			`"user_agent":"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko)",`+
+			`"country":"CA","duration_ms":%d}`, i*7919, i*31, i%97, i%13, i*17%1000)
+	}
+	return samples
+}
+
+func compressedSize(t *testing.T, codec Codec, data []byte) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := codec.Compress(bytes.NewReader(data), &buf); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	return buf.Len()
+}
+
+func TestTrainDictionary(t *testing.T) {
+	samples := dictionarySamples(200)
+	dict, err := TrainDictionary(40000, samples, DictionarySize)
+	if err != nil {
+		t.Fatalf("training failed: %v", err)
+	}
+	plain, _ := Lookup("zstd")
+	codec, err := WithDictionary(plain, dict)
+	if err != nil {
+		t.Fatalf("WithDictionary failed: %v", err)
+	}
+
+	// files unlike the samples' but of the same kind
+	file := dictionarySamples(300)[250]
+	with, without := compressedSize(t, codec, file), compressedSize(t, plain, file)
+	if with*2 > without {
+		t.Errorf("expected the dictionary to at least halve the output, got %d bytes instead of %d", with, without)
+	}
+
+	var buf, out bytes.Buffer
+	meta := ContainerMetadata{Name: "event.json", Dictionary: "d1"}
+	if err := WriteContainer(&buf, codec, bytes.NewReader(file), meta); err != nil {
+		t.Fatalf("write container failed: %v", err)
+	}
+	header, err := ReadContainer(bytes.NewReader(buf.Bytes()), &out, func(name string) (Codec, error) {
+		return WithDictionary(plain, dict)
+	})
+	if err != nil {
+		t.Fatalf("read container failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), file) || header.Metadata.Dictionary != "d1" {
+		t.Errorf("unexpected round trip: %+v, %q", header, out.String())
+	}
+
+	// without the dictionary the payload can't be decoded
+	if _, err := ReadContainer(bytes.NewReader(buf.Bytes()), &bytes.Buffer{}, nil); err == nil {
+		t.Errorf("expected decoding without the dictionary to fail")
+	}
+}
+
+func TestTrainDictionary_TooFewSamples(t *testing.T) {
+	if _, err := TrainDictionary(40000, dictionarySamples(2), DictionarySize); !errors.Is(err, ErrTooFewSamples) {
+		t.Errorf("expected ErrTooFewSamples, got %v", err)
+	}
+	unrelated := make([][]byte, 10)
+	for i := range unrelated {
+		unrelated[i] = []byte(strings.Repeat(string(rune('a'+i)), 3))
+	}
+	if _, err := TrainDictionary(40000, unrelated, DictionarySize); !errors.Is(err, ErrTooFewSamples) {
+		t.Errorf("expected ErrTooFewSamples for samples sharing nothing, got %v", err)
+	}
+}
+
+func TestWithDictionary_Unsupported(t *testing.T) {
+	codec, _ := Lookup("gzip")
+	if _, err := WithDictionary(codec, []byte("dict")); !errors.Is(err, ErrNoDictionarySupport) {
+		t.Errorf("expected ErrNoDictionarySupport, got %v", err)
+	}
+	if c, err := WithDictionary(codec, nil); err != nil || c != codec {
+		t.Errorf("expected no dictionary to keep the codec, got %v, %v", c, err)
+	}
+}
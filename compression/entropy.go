@@ -0,0 +1,39 @@
+package compression
+
+import "math"
+
+// Entropy returns the Shannon entropy of p in bits per byte, from 0 for a
+// single repeated byte to 8 for data no byte-oriented codec can shrink.
+func Entropy(p []byte) float64 {
+	if len(p) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range p {
+		counts[b]++
+	}
+	var bits float64
+	for _, n := range counts {
+		if n == 0 {
+			continue
+		}
+		freq := float64(n) / float64(len(p))
+		bits -= freq * math.Log2(freq)
+	}
+	return bits
+}
+
+const (
+	// IncompressibleSampleSize is how much of an input Incompressible needs
+	// to look at.
+	IncompressibleSampleSize = 64 << 10
+	// incompressibleEntropy is the entropy in bits per byte from which data
+	// is taken for random: every codec would only make it larger.
+	incompressibleEntropy = 7.9
+)
+
+// Incompressible reports whether sample, the start of an input, is as random
+// as compressed or encrypted data, which is better stored as it is.
+func Incompressible(sample []byte) bool {
+	return Entropy(sample) >= incompressibleEntropy
+}
@@ -0,0 +1,29 @@
+package compression
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestEntropy(t *testing.T) {
+	random := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(random)
+	testCases := []struct {
+		name     string
+		data     []byte
+		min, max float64
+	}{
+		{name: "empty", data: nil, min: 0, max: 0},
+		{name: "repeated", data: bytes.Repeat([]byte("a"), 100), min: 0, max: 0},
+		{name: "two symbols", data: bytes.Repeat([]byte("ab"), 100), min: 1, max: 1},
+		{name: "random", data: random, min: 7.99, max: 8},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Entropy(tc.data); got < tc.min || got > tc.max {
+				t.Errorf("expected entropy in [%v, %v], got %v", tc.min, tc.max, got)
+			}
+		})
+	}
+}
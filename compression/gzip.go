@@ -0,0 +1,56 @@
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// GzipCodec produces standard .gz streams that any tool can read, not just
+// this platform's decoder.
+type GzipCodec struct {
+	// Level is a gzip level from 1 to 9, 0 uses gzip.DefaultCompression.
+	Level int
+}
+
+func init() {
+	Register(GzipCodec{})
+}
+
+func (GzipCodec) Name() string { return "gzip" }
+
+func (c GzipCodec) WithLevel(level int) (Codec, error) {
+	if level < gzip.BestSpeed || level > gzip.BestCompression {
+		return nil, fmt.Errorf("%w: gzip takes %d to %d, got %d", ErrUnsupportedLevel, gzip.BestSpeed, gzip.BestCompression, level)
+	}
+	c.Level = level
+	return c, nil
+}
+
+func (c GzipCodec) Compress(r io.Reader, w io.Writer) error {
+	level := gzip.DefaultCompression
+	if c.Level != 0 {
+		level = c.Level
+	}
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip writer: %w", err)
+	}
+	if _, err := io.Copy(gw, r); err != nil {
+		gw.Close()
+		return fmt.Errorf("failed to gzip encode: %w", err)
+	}
+	return gw.Close()
+}
+
+func (GzipCodec) Decompress(r io.Reader, w io.Writer) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+	if _, err := io.Copy(w, gr); err != nil {
+		return fmt.Errorf("failed to gzip decode: %w", err)
+	}
+	return nil
+}
@@ -3,23 +3,99 @@ package compression
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"container/heap"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"strconv"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
-const CHUNKS_COUNT int = 3
+// The errors decoding a Huffman stream fails with, each a kind of
+// ErrCorruptHuffman.
+var (
+	// ErrTruncated is a stream that ends before its header or body does.
+	ErrTruncated = fmt.Errorf("%w: truncated", ErrCorruptHuffman)
+	// ErrBadHeader is a code table or padding no encoder writes.
+	ErrBadHeader = fmt.Errorf("%w: bad header", ErrCorruptHuffman)
+	// ErrInvalidCode is a body with a code the table doesn't have.
+	ErrInvalidCode = fmt.Errorf("%w: invalid code", ErrCorruptHuffman)
+)
+
+// rawByteSymbol + b is the symbol of a byte b of the input that isn't part
+// of valid UTF-8. The Huffman coders take runes for symbols, which would
+// turn every such byte into utf8.RuneError; symbols past the last rune keep
+// them apart, so any input round-trips.
+const rawByteSymbol = utf8.MaxRune + 1
+
+// ReadHuffmanSymbol reads the next symbol of br: a rune, or a byte that isn't
+// valid UTF-8, see rawByteSymbol.
+func ReadHuffmanSymbol(br *bufio.Reader) (uint32, error) {
+	r, size, err := br.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r == utf8.RuneError && size == 1 {
+		br.UnreadRune()
+		b, _ := br.ReadByte()
+		return rawByteSymbol + uint32(b), nil
+	}
+	return uint32(r), nil
+}
+
+// huffmanSymbolIn returns the symbol at the start of s, like
+// ReadHuffmanSymbol, and its length in bytes.
+func huffmanSymbolIn(s string) (uint32, int) {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && size == 1 {
+		return rawByteSymbol + uint32(s[0]), 1
+	}
+	return uint32(r), size
+}
+
+// validHuffmanSymbol reports whether an encoder may have written char.
+func validHuffmanSymbol(char uint32) bool {
+	return char < rawByteSymbol+256
+}
+
+// HuffmanChunkSizes bound the size of the chunks HuffmanCodec encodes the
+// body of an input in at once.
+type HuffmanChunkSizes struct {
+	Min, Max int64
+}
+
+// DefaultHuffmanChunkSizes are the chunk sizes unless configured otherwise,
+// see RegisterFromEnv.
+var DefaultHuffmanChunkSizes = HuffmanChunkSizes{Min: 32 << 20, Max: 128 << 20}
+
+// chunks is how many chunks an input of size bytes is encoded in with cpus
+// CPUs: a chunk per CPU, each of Min to Max bytes, so that small inputs are
+// encoded in one and large ones keep every CPU busy.
+func (s HuffmanChunkSizes) chunks(size int64, cpus int) int {
+	if size <= 0 || cpus <= 0 {
+		return 1
+	}
+	chunk := max(min(size/int64(cpus), s.Max), s.Min, 1)
+	return int((size + chunk - 1) / chunk)
+}
 
 type lookupItem struct {
+	// char is the symbol of a leaf, and of an inner node the smallest symbol
+	// below it, which orders nodes of the same frequency
 	char uint32
 	freq int
-	code string
-	bits int
+	// code holds the bits of the Huffman code of a leaf in its low bits, the
+	// first one highest
+	code uint64
+	bits uint8
+	// leaf is set for symbols, every symbol value including 0 is valid
+	leaf bool
 }
 
 type prefixTable map[uint32]*lookupItem
@@ -30,50 +106,61 @@ type node struct {
 	right *node
 }
 
-func (hn *node) addNode(char uint32, code uint32, bits uint8) {
-	if bits == 0 {
-		hn.value = &lookupItem{
-			char: char,
-		}
-		return
+// addNode adds the leaf of char at the end of its code of bits bits, the
+// first one highest, and returns it. It fails with ErrBadHeader on a code the
+// header can't have or that conflicts with one added before, which only a
+// corrupt header holds.
+func (hn *node) addNode(char uint32, code uint32, bits uint8) (*lookupItem, error) {
+	if bits == 0 || bits > maxCodeBits || uint64(code) >= 1<<bits {
+		return nil, fmt.Errorf("%w: code %d of %d bits", ErrBadHeader, code, bits)
 	}
-
-	direction := code >> (bits - 1)
-	if direction&1 == 0 {
-		if hn.left == nil {
-			hn.left = &node{}
+	t := hn
+	for i := int(bits) - 1; i >= 0; i-- {
+		if t.value != nil {
+			return nil, fmt.Errorf("%w: code %d of %d bits extends another", ErrBadHeader, code, bits)
 		}
-		hn.left.addNode(char, code, bits-1)
-	} else {
-		if hn.right == nil {
-			hn.right = &node{}
+		next := &t.left
+		if (code>>i)&1 == 1 {
+			next = &t.right
 		}
-		hn.right.addNode(char, code, bits-1)
+		if *next == nil {
+			*next = &node{}
+		}
+		t = *next
+	}
+	if t.value != nil || t.left != nil || t.right != nil {
+		return nil, fmt.Errorf("%w: code %d of %d bits is taken", ErrBadHeader, code, bits)
 	}
+	t.value = &lookupItem{
+		char: char,
+		code: uint64(code),
+		bits: bits,
+		leaf: true,
+	}
+	return t.value, nil
 }
 
-func (hn *node) walker() func(int) (uint32, bool) {
-	t := hn
-	return func(direction int) (uint32, bool) {
-		if direction == 0 {
-			t = t.left
-		} else {
-			t = t.right
-		}
-
-		if t.value != nil {
-			return t.value.char, true
-		}
-		return 0, false
+// child follows one bit down the tree, nil for a code no symbol has.
+func (hn *node) child(direction byte) *node {
+	if direction == 0 {
+		return hn.left
 	}
+	return hn.right
 }
 
 type priorityQueue []*node
 
 func (pq priorityQueue) Len() int { return len(pq) }
 
+// Less puts the rarest node first, frequencies being stored negated, and of
+// nodes as frequent the one with the smallest symbol below it, so the same
+// input builds the same tree whatever order its frequency table is read in.
 func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].value.freq > pq[j].value.freq
+	a, b := pq[i].value, pq[j].value
+	if a.freq != b.freq {
+		return a.freq > b.freq
+	}
+	return a.char < b.char
 }
 
 func (pq priorityQueue) Swap(i, j int) {
@@ -94,22 +181,129 @@ func (pq *priorityQueue) Pop() any {
 	return item
 }
 
-func buildHuffmanTree(root *node, code string, bits int) {
-	if root == nil {
-		return
-	}
+// maxCodeBits is the longest Huffman code the header has room for, and so
+// the deepest a tree can be.
+const maxCodeBits = 32
+
+// treeStep is a node still to visit when walking a tree, with the code
+// leading to it.
+type treeStep struct {
+	node *node
+	code uint64
+	bits uint
+}
+
+// buildHuffmanTree assigns the codes of the leaves below root, which is no
+// deeper than maxCodeBits. It walks the tree with a stack of its own rather
+// than recursing, since a pathological input makes for a tree as deep as it
+// has symbols until limitDepth rebuilds it.
+func buildHuffmanTree(root *node) {
+	stack := []treeStep{{node: root}}
+	for len(stack) > 0 {
+		step := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if step.node == nil {
+			continue
+		}
 
-	item := root.value
+		item := step.node.value
 
-	// if node is a leaf, assign code and bits
-	if item.char != 0 {
-		item.code = code
-		item.bits = bits
-		return
+		// if node is a leaf, assign code and bits
+		if item.leaf {
+			item.code, item.bits = step.code, uint8(step.bits)
+			if item.bits == 0 {
+				// a lone symbol still needs a bit to be written in the body
+				item.bits = 1
+			}
+			continue
+		}
+
+		// right first, so the left is visited first
+		stack = append(stack,
+			treeStep{node: step.node.right, code: step.code<<1 | 1, bits: step.bits + 1},
+			treeStep{node: step.node.left, code: step.code << 1, bits: step.bits + 1},
+		)
 	}
+}
 
-	buildHuffmanTree(root.left, code+"0", bits+1)
-	buildHuffmanTree(root.right, code+"1", bits+1)
+// limitDepth returns a tree of the leaves below root no deeper than
+// maxCodeBits, root itself when it is. Otherwise the code lengths are limited
+// the way JPEG limits its own (ITU T.81, K.3): a pair of the deepest leaves
+// moves up a level, one taking the place of their parent, the other going
+// below a shallower leaf along with it, until none is too deep. The most
+// frequent symbols get the shortest codes and the leaves are placed by
+// canonical codes, so the same input still builds the same tree.
+func limitDepth(root *node) *node {
+	var leaves []*lookupItem
+	var counts []int
+	stack := []treeStep{{node: root}}
+	for len(stack) > 0 {
+		step := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if step.node == nil {
+			continue
+		}
+		if step.node.value.leaf {
+			leaves = append(leaves, step.node.value)
+			for uint(len(counts)) <= step.bits {
+				counts = append(counts, 0)
+			}
+			counts[step.bits]++
+			continue
+		}
+		stack = append(stack,
+			treeStep{node: step.node.right, bits: step.bits + 1},
+			treeStep{node: step.node.left, bits: step.bits + 1},
+		)
+	}
+	if len(counts) <= maxCodeBits+1 {
+		return root
+	}
+
+	// a level deeper than maxCodeBits holds an even number of leaves, and
+	// with fewer than 2^maxCodeBits symbols there is always a leaf at least
+	// two levels up
+	for i := len(counts) - 1; i > maxCodeBits; i-- {
+		for counts[i] > 0 {
+			j := i - 2
+			for counts[j] == 0 {
+				j--
+			}
+			counts[i] -= 2
+			counts[i-1]++
+			counts[j+1] += 2
+			counts[j]--
+		}
+	}
+
+	// frequencies are stored negated, so the most frequent come first
+	slices.SortFunc(leaves, func(a, b *lookupItem) int {
+		return cmp.Or(cmp.Compare(a.freq, b.freq), cmp.Compare(a.char, b.char))
+	})
+	limited := &node{value: &lookupItem{}}
+	var code uint64
+	bits := 1
+	for _, item := range leaves {
+		for counts[bits] == 0 {
+			bits++
+			code <<= 1
+		}
+		counts[bits]--
+		t := limited
+		for i := bits - 1; i >= 0; i-- {
+			next := &t.left
+			if code>>i&1 == 1 {
+				next = &t.right
+			}
+			if *next == nil {
+				*next = &node{value: &lookupItem{}}
+			}
+			t = *next
+		}
+		t.value = item
+		code++
+	}
+	return limited
 }
 
 func convertToBin(value uint32) []byte {
@@ -118,104 +312,112 @@ func convertToBin(value uint32) []byte {
 	return result
 }
 
+// buildHeader writes the entry recording the chunked layout, then one for
+// every leaf below root, left to right. Like buildHuffmanTree it walks the
+// tree with a stack of its own.
 func buildHeader(root *node) (*bytes.Buffer, error) {
 	var header bytes.Buffer
-	err := buildHeaderRecursive(root, &header)
-	if err != nil {
-		return nil, err
-	}
-	return &header, err
-}
-
-func convertCodeToBin(value string) ([]byte, error) {
-	result := make([]byte, 4)
-	v, err := strconv.ParseUint(value, 2, 32)
-	if err != nil {
-		return nil, err
-	}
-	smallV := uint32(v)
-	binary.LittleEndian.PutUint32(result, smallV)
-	return result, nil
-}
-
-func buildHeaderRecursive(root *node, header *bytes.Buffer) error {
-	if root == nil {
-		return nil
-	}
+	header.Write(HuffmanLayoutEntry(HuffmanLayoutChunked))
+	stack := []*node{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == nil {
+			continue
+		}
 
-	item := root.value
+		item := n.value
 
-	if item.char != 0 {
+		// only leaves are written, so an entry never needs a flag of its own
+		if !item.leaf {
+			stack = append(stack, n.right, n.left)
+			continue
+		}
 		// first four bytes: character code
 		if _, err := header.Write(convertToBin(item.char)); err != nil {
-			return fmt.Errorf("Failed to write character to header: %w", err)
+			return nil, fmt.Errorf("Failed to write character to header: %w", err)
 		}
 		// next four bytes: Huffman assigned code
-		huffmanCode, err := convertCodeToBin(item.code)
-		if err != nil {
-			return fmt.Errorf("Failed to encode Huffman code: %w", err)
-		}
-		if _, err := header.Write(huffmanCode); err != nil {
-			return fmt.Errorf("Failed to write Huffman code to header: %w", err)
+		if _, err := header.Write(convertToBin(uint32(item.code))); err != nil {
+			return nil, fmt.Errorf("Failed to write Huffman code to header: %w", err)
 		}
 		// last byte: bits
-		if err = header.WriteByte(byte(item.bits)); err != nil {
-			return fmt.Errorf("Failed to write bits to header: %w", err)
+		if err := header.WriteByte(item.bits); err != nil {
+			return nil, fmt.Errorf("Failed to write bits to header: %w", err)
 		}
 	}
+	return &header, nil
+}
 
-	if err := buildHeaderRecursive(root.left, header); err != nil {
-		return err
+// splitChunks splits the lines of body, size bytes in all, into chunksCount
+// chunks of about the same size. A line isn't split, so long lines can make
+// for fewer chunks.
+func splitChunks(body []string, size int, chunksCount int) [][]string {
+	var chunks [][]string
+	target := max((size+chunksCount-1)/chunksCount, 1)
+	start, filled := 0, 0
+	for i, line := range body {
+		filled += len(line)
+		if filled >= target {
+			chunks = append(chunks, body[start:i+1])
+			start, filled = i+1, 0
+		}
 	}
-	if err := buildHeaderRecursive(root.right, header); err != nil {
-		return err
+	if filled > 0 {
+		chunks = append(chunks, body[start:])
 	}
+	return chunks
+}
+
+// codeWriter packs Huffman codes into bytes, first bit highest. Unlike the
+// bitWriter of AdaptiveHuffmanCodec it shifts a code into acc whole and writes
+// out every full byte, which leaves fewer than 8 bits in acc between codes, so
+// codes of up to maxCodeBits always fit.
+type codeWriter struct {
+	w     io.ByteWriter
+	acc   uint64
+	nbits uint8
+}
 
+func (cw *codeWriter) writeCode(code uint64, bits uint8) error {
+	cw.acc = cw.acc<<bits | code
+	cw.nbits += bits
+	for cw.nbits >= 8 {
+		cw.nbits -= 8
+		if err := cw.w.WriteByte(byte(cw.acc >> cw.nbits)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func splitChunks(body []string, chunks_count int) [][]string {
-	var chunks [][]string
-	chunkSize := (len(body) + chunks_count - 1) / chunks_count
-	for i := 0; i < len(body); i += chunkSize {
-		// fmt.Printf("i: %d, chunkSize: %d\n", i, chunkSize)
-		end := i + chunkSize
-		chunks = append(chunks, body[i:min(end, len(body))])
+// flush writes the bits left, padded with 0s on the right, and returns how
+// many 0s.
+func (cw *codeWriter) flush() (uint8, error) {
+	if cw.nbits == 0 {
+		return 0, nil
 	}
-	return chunks
+	paddedZeros := 8 - cw.nbits
+	if err := cw.w.WriteByte(byte(cw.acc << paddedZeros)); err != nil {
+		return 0, err
+	}
+	cw.acc, cw.nbits = 0, 0
+	return paddedZeros, nil
 }
 
 func buildBody(pt prefixTable, bodyContent []string) (*bytes.Buffer, uint8) {
 	var bodyOutput bytes.Buffer
-	var currentByte byte
-	var bitCount int
-
+	// writing to a bytes.Buffer doesn't fail
+	cw := codeWriter{w: &bodyOutput}
 	for _, c := range bodyContent {
-		for _, r := range c {
-			item := pt[uint32(r)]
-			for _, bit := range item.code {
-				currentByte <<= 1 // shift left to make space for next bit
-				if bit == '1' {
-					currentByte |= 1
-				}
-				bitCount++
-				if bitCount == 8 {
-					bodyOutput.WriteByte(currentByte)
-					currentByte = 0
-					bitCount = 0
-				}
-			}
+		for len(c) > 0 {
+			char, size := huffmanSymbolIn(c)
+			item := pt[char]
+			cw.writeCode(item.code, item.bits)
+			c = c[size:]
 		}
 	}
-
-	// flush the remaining bits (pad with 0s on the right)
-	var paddedZeros uint8 = 0
-
-	if bitCount > 0 {
-		paddedZeros = uint8(8 - bitCount)
-		currentByte <<= paddedZeros // shift remaining bits to fill the byte
-		bodyOutput.WriteByte(currentByte)
-	}
+	paddedZeros, _ := cw.flush()
 	return &bodyOutput, paddedZeros
 }
 
@@ -226,12 +428,22 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 	}
 	defer file.Close()
 
+	return compressReader(file)
+}
+
+func compressReader(file io.Reader) (*bytes.Buffer, error) {
+	return compressChunks(file, 0)
+}
+
+// compressChunks encodes the body of file in chunksCount chunks at once, or
+// in as many as DefaultHuffmanChunkSizes makes of it when that is 0.
+func compressChunks(file io.Reader, chunksCount int) (*bytes.Buffer, error) {
 	var compressData bytes.Buffer
 	store := make(map[uint32]int)
 	body := []string{}
 	originalSize := 0
 
-	fmt.Println("Building frequency table")
+	slog.Debug("Building frequency table")
 	scanner := bufio.NewReader(file)
 	for {
 		line, err := scanner.ReadString(byte('\n'))
@@ -240,14 +452,16 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 		}
 		originalSize += len(line)
 		body = append(body, line)
-		for _, c := range line {
-			store[uint32(c)] += 1
+		for rest := line; len(rest) > 0; {
+			char, size := huffmanSymbolIn(rest)
+			store[char] += 1
+			rest = rest[size:]
 		}
 		if err == io.EOF {
 			break
 		}
 	}
-	fmt.Printf("Original File size: %d bytes\n", originalSize)
+	slog.Debug("Read original", "bytes", originalSize)
 	if originalSize == 0 {
 		return &compressData, nil
 	}
@@ -255,12 +469,13 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 	pq := make(priorityQueue, len(store))
 	pt := make(prefixTable)
 
-	fmt.Println("Building Huffman Priority Queue")
+	slog.Debug("Building Huffman priority queue")
 	i := 0
 	for k, v := range store {
 		val := &lookupItem{
 			char: k,
 			freq: -v,
+			leaf: true,
 		}
 		pt[k] = val
 		pq[i] = &node{
@@ -275,6 +490,7 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 		n2 := heap.Pop(&pq).(*node)
 		newnode := node{}
 		newnode.value = &lookupItem{
+			char: min(n1.value.char, n2.value.char),
 			freq: n1.value.freq + n2.value.freq,
 		}
 		if n1.value.freq > n2.value.freq {
@@ -286,10 +502,11 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 		}
 		heap.Push(&pq, &newnode)
 	}
-	fmt.Println("Building Huffman prefix Tree")
-	buildHuffmanTree(pq[0], "", 0)
+	slog.Debug("Building Huffman prefix tree")
+	pq[0] = limitDepth(pq[0])
+	buildHuffmanTree(pq[0])
 
-	fmt.Println("Building Header")
+	slog.Debug("Building header")
 	header, err := buildHeader(pq[0])
 	if err != nil {
 		return nil, fmt.Errorf("Error building header: %w", err)
@@ -300,37 +517,39 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 	headerBin := make([]byte, 2)
 	binary.LittleEndian.PutUint16(headerBin, uint16(header.Len()))
 	compressData.Write(headerBin)
-	fmt.Println("Write 2 bytes of header length to compressData")
 	n, err := header.WriteTo(&compressData)
 	if err != nil {
 		return nil, fmt.Errorf("Error writing header: %w", err)
 	}
-	fmt.Printf("Write %d bytes of header to compressData\n", n)
+	slog.Debug("Wrote header", "bytes", n)
 
 	// splitting body into chunks for parallel compressing
-	chunks := splitChunks(body, CHUNKS_COUNT)
-	fmt.Printf("len of chunks: %d\n", len(chunks))
+	if chunksCount <= 0 {
+		chunksCount = DefaultHuffmanChunkSizes.chunks(int64(originalSize), runtime.GOMAXPROCS(0))
+	}
+	chunks := splitChunks(body, originalSize, chunksCount)
+	slog.Debug("Building body", "chunks", len(chunks))
 
-	fmt.Println("Building Body")
-	compressedChunks := make([]*bytes.Buffer, CHUNKS_COUNT)
-	paddedZeros := make([]uint8, CHUNKS_COUNT)
+	// small inputs can produce fewer chunks than chunksCount
+	compressedChunks := make([]*bytes.Buffer, len(chunks))
+	paddedZeros := make([]uint8, len(chunks))
 
 	var wg sync.WaitGroup
 
-	for i := range CHUNKS_COUNT {
+	for i := range chunks {
 		wg.Add(1)
 		go func(idx int) {
 			defer wg.Done()
 			encodedBody, currPaddedZeros := buildBody(pt, chunks[idx])
 			compressedChunks[idx] = encodedBody
 			paddedZeros[idx] = currPaddedZeros
-			fmt.Printf("Body size: %d bytes\tPadded 0s: %d\n", encodedBody.Len(), currPaddedZeros)
+			slog.Debug("Encoded chunk", "bytes", encodedBody.Len(), "padding", currPaddedZeros)
 		}(i)
 	}
 
 	wg.Wait()
 
-	for i := range CHUNKS_COUNT {
+	for i := range chunks {
 		z := paddedZeros[i]
 		c := compressedChunks[i]
 
@@ -340,158 +559,38 @@ func Compress(filePath string) (*bytes.Buffer, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Error writing body padded 0s: %w", err)
 		}
-		fmt.Println("Write 1 byte of padded 0s to compressData")
 		bodyBin := make([]byte, 4)
 		binary.LittleEndian.PutUint32(bodyBin, uint32(c.Len()))
 		compressData.Write(bodyBin)
-		fmt.Println("Write 4 bytes of body length to compressData")
 		n, err = c.WriteTo(&compressData)
 		if err != nil {
 			return nil, fmt.Errorf("Error writing body: %w", err)
 		}
-		fmt.Printf("Write %d bytes of body to compressData\n", n)
+		slog.Debug("Wrote chunk", "bytes", n)
 	}
 
-	fmt.Printf("Total: %d bytes\n", compressData.Len())
+	slog.Debug("Compressed", "bytes", compressData.Len())
 	return &compressData, nil
 }
 
-func decompressChunk(paddedZeros int, chunk []byte, table *node) *strings.Builder {
-	var result strings.Builder
-
-	walk := table.walker()
-	for i, c := range chunk {
-		var endByte int
-		if i+1 == len(chunk) {
-			// padded zeros situation
-			endByte = paddedZeros
-		} else {
-			endByte = 0
-		}
-
-		for i := 7; i >= endByte; i-- {
-			bit := (c >> uint(i)) & 1
-			v, ok := walk(int(bit))
-			if ok {
-				result.WriteRune(rune(v))
-				walk = table.walker()
-			}
-		}
-	}
-	return &result
-}
-
 func Decompress(filePath string) (*strings.Builder, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("Error reading file: %v", err)
 	}
 
-	buf := bytes.NewBuffer(data)
-	var decompText strings.Builder
-
-	fmt.Println("Decoding...")
-
-	if buf.Len() == 0 {
-		return &decompText, nil
-	}
-
-	// fmt.Println("Extracting header length")
-	headerLenBin := make([]byte, 2)
-	_, err = buf.Read(headerLenBin)
-	if err != nil {
-		return nil, fmt.Errorf("Error extracing header: %w", err)
-	}
-	headerLen := binary.LittleEndian.Uint16(headerLenBin)
-	fmt.Printf("Extracted header length: %d\n", headerLen)
-
-	// fmt.Println("Splitting text to header and body sections")
-	headerBin := make([]byte, headerLen)
-	_, err = buf.Read(headerBin)
-	if err != nil {
-		return nil, fmt.Errorf("Error splitting header and body: %w", err)
-	}
-	// fmt.Println("Building HuffmanTree with extracted header")
-	ht := node{}
-	// character code + Huffman assigned code + bits -> 4 + 4 + 1 = 9 bytes
-	for i := 0; i < len(headerBin); i += 9 {
-		section := headerBin[i : i+9]
-		char := binary.LittleEndian.Uint32(section[0:4])
-		code := binary.LittleEndian.Uint32(section[4:8])
-		bits := section[8]
-		ht.addNode(char, code, bits)
-	}
-
-	var chunks [][]byte
-	var paddedZeros []int
-	for {
-
-		// extracting padded zeros section
-		paddedZero, err := buf.ReadByte()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, fmt.Errorf("Error extracting padded 0s: %w", err)
-		}
-		fmt.Printf("Extracted number of padded 0s: %d\n", paddedZero)
-		paddedZeros = append(paddedZeros, int(paddedZero))
-		// extracting body length section
-		bodyBin := make([]byte, 4)
-		_, err = buf.Read(bodyBin)
-		if err != nil {
-			return nil, fmt.Errorf("Error extracting body length: %w", err)
-		}
-		bodyLen := binary.LittleEndian.Uint32(bodyBin)
-
-		bodyContent := make([]byte, bodyLen)
-		_, err = buf.Read(bodyContent)
-		if err != nil {
-			return nil, fmt.Errorf("Error extracting body content: %w", err)
-		}
-		chunks = append(chunks, bodyContent)
-		// for i := range bodyLen {
-		// 	b, err := buf.ReadByte()
-		// 	if err != nil {
-		// 		return nil, fmt.Errorf("Error decoding body: %w", err)
-		// 	}
-		//
-		// 	var endByte int
-		// 	if i+1 == bodyLen {
-		// 		// padded zeros situation
-		// 		endByte = int(paddedZeros)
-		// 	} else {
-		// 		endByte = 0
-		// 	}
-		//
-		// 	for i := 7; i >= endByte; i-- {
-		// 		bit := (b >> uint(i)) & 1
-		// 		v, ok := walk(int(bit))
-		// 		if ok {
-		// 			decompText.WriteRune(rune(v))
-		// 			walk = ht.walker()
-		// 		}
-		// 	}
-		// }
-	}
+	return decompressBytes(data)
+}
 
-	var wg sync.WaitGroup
-	decompressTextLst := make([]*strings.Builder, len(paddedZeros))
-	for i, chunk := range chunks {
-		wg.Add(1)
-		go func(idx int) {
-			defer wg.Done()
-			d := decompressChunk(int(paddedZeros[i]), chunk, &ht)
-			decompressTextLst[idx] = d
-		}(i)
-	}
-	wg.Wait()
+// decompressBytes decodes data with DecodeHuffman, taking it for the chunked
+// layout compressChunks writes if neither it nor its body says.
+func decompressBytes(data []byte) (*strings.Builder, error) {
+	var decompText strings.Builder
 
-	// merge all back into one
-	for _, s := range decompressTextLst {
-		decompText.WriteString(s.String())
+	slog.Debug("Decoding")
+	if err := DecodeHuffman(bytes.NewReader(data), &decompText, HuffmanLayoutChunked); err != nil {
+		return nil, err
 	}
-
-	fmt.Printf("Text size: %d bytes\n", decompText.Len())
+	slog.Debug("Decoded", "bytes", decompText.Len())
 	return &decompText, nil
 }
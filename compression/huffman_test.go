@@ -1,7 +1,11 @@
 package compression
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -83,6 +87,34 @@ func TestCompressDecompress_Empty(t *testing.T) {
 	roundTripCheck(t, text)
 }
 
+func TestCompressDecompress_NulBytes(t *testing.T) {
+	text := "\x00a\x00\x00b\x00"
+	roundTripCheck(t, text)
+}
+
+func TestCompressDecompress_InvalidUTF8(t *testing.T) {
+	// bytes that aren't UTF-8 next to a real U+FFFD and a split é
+	text := "\x00\xff\xfea\x80\x00\xc3 \uFFFD \xc3\xa9"
+	roundTripCheck(t, text)
+
+	var compressed, decompressed bytes.Buffer
+	if err := (HuffmanCodec{}).Compress(strings.NewReader(text), &compressed); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	tables, err := InspectHuffman(bytes.NewReader(compressed.Bytes()), "")
+	if err != nil || !slices.ContainsFunc(tables[0].Symbols, func(s HuffmanSymbol) bool { return s.Char == `\xff` }) {
+		t.Errorf("expected the byte 0xff among the symbols, got %+v, %v", tables, err)
+	}
+	if err := (HuffmanCodec{}).Decompress(&compressed, &decompressed); err != nil || decompressed.String() != text {
+		t.Errorf("expected %q, got %q, %v", text, decompressed.String(), err)
+	}
+}
+
+func TestCompressDecompress_OneSymbol(t *testing.T) {
+	text := strings.Repeat("\x00", 10)
+	roundTripCheck(t, text)
+}
+
 func TestCompressDecompress_Repetitive(t *testing.T) {
 	text := strings.Repeat("ab", 1000)
 	roundTripCheck(t, text)
@@ -93,6 +125,42 @@ func TestCompressDecompress_Large(t *testing.T) {
 	roundTripCheck(t, text)
 }
 
+func TestCompressDecompress_TooDeep(t *testing.T) {
+	// Fibonacci frequencies make the deepest tree, a level more for every
+	// symbol, here two past the longest code the header has room for
+	const symbols = maxCodeBits + 3
+	var text strings.Builder
+	a, b := 1, 1
+	for i := range symbols {
+		text.WriteString(strings.Repeat(string('A'+rune(i)), a))
+		a, b = b, a+b
+	}
+
+	var compressed, decompressed bytes.Buffer
+	if err := (HuffmanCodec{}).Compress(strings.NewReader(text.String()), &compressed); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	tables, err := InspectHuffman(bytes.NewReader(compressed.Bytes()), "")
+	if err != nil {
+		t.Fatalf("inspect failed: %v", err)
+	}
+	longest := 0
+	for _, table := range tables {
+		for _, symbol := range table.Symbols {
+			longest = max(longest, symbol.Bits)
+		}
+	}
+	if longest != maxCodeBits {
+		t.Errorf("expected the codes to be limited to %d bits, got %d", maxCodeBits, longest)
+	}
+	if err := (HuffmanCodec{}).Decompress(&compressed, &decompressed); err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if decompressed.String() != text.String() {
+		t.Errorf("expected the original back, got %d bytes of %d", decompressed.Len(), text.Len())
+	}
+}
+
 func TestCompressDecompress_Larger(t *testing.T) {
 	text := strings.Repeat("abcdefg1234567", 75000) // ~1 MB
 	roundTripCheck(t, text)
@@ -198,3 +266,193 @@ func roundTripCheck(t *testing.T, input string) {
 		t.Errorf("expected '%s', got '%s'", input, output.String())
 	}
 }
+
+func TestCompressDeterministic(t *testing.T) {
+	// every symbol as frequent as several others, so the tree is all ties
+	content := strings.Repeat("abcdefgh\n", 20) + "wxyz"
+
+	var first []byte
+	for i := 0; i < 20; i++ {
+		result, err := compressReader(strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("compress failed: %v", err)
+		}
+		if first == nil {
+			first = result.Bytes()
+		} else if !bytes.Equal(result.Bytes(), first) {
+			t.Fatalf("expected the same output on run %d", i+1)
+		}
+	}
+}
+
+func TestHuffmanChunkSizes(t *testing.T) {
+	sizes := HuffmanChunkSizes{Min: 32 << 20, Max: 128 << 20}
+	testCases := []struct {
+		name string
+		size int64
+		cpus int
+		want int
+	}{
+		{name: "empty", size: 0, cpus: 8, want: 1},
+		{name: "small", size: 10 << 20, cpus: 8, want: 1},
+		{name: "chunks of the minimum", size: 100 << 20, cpus: 8, want: 4},
+		{name: "one per CPU", size: 1 << 30, cpus: 8, want: 8},
+		{name: "chunks of the maximum", size: 10 << 30, cpus: 8, want: 80},
+		{name: "one CPU", size: 1 << 30, cpus: 1, want: 8},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sizes.chunks(tc.size, tc.cpus); got != tc.want {
+				t.Errorf("chunks(%d, %d) = %d, want %d", tc.size, tc.cpus, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	body := []string{"aaaa\n", "bb\n", "cccccc\n", "d\n", "eeeee\n", ""}
+	chunks := splitChunks(body, 23, 3)
+	var sizes []int
+	for _, chunk := range chunks {
+		n := 0
+		for _, line := range chunk {
+			n += len(line)
+		}
+		sizes = append(sizes, n)
+	}
+	if len(chunks) != 3 || sizes[0] != 8 || sizes[1] != 9 || sizes[2] != 6 {
+		t.Errorf("expected chunks of 8, 9 and 6 bytes, got %v", sizes)
+	}
+}
+
+// handmadeTable returns the header of a stream coding the symbol of each entry
+// with the code of bits bits that follows it, e.g. {'a', 0b10, 2}.
+func handmadeTable(entries ...[3]uint32) []byte {
+	header := binary.LittleEndian.AppendUint16(nil, uint16(9*len(entries)))
+	for _, entry := range entries {
+		header = binary.LittleEndian.AppendUint32(header, entry[0])
+		header = binary.LittleEndian.AppendUint32(header, entry[1])
+		header = append(header, byte(entry[2]))
+	}
+	return header
+}
+
+// The entries recording the layouts in a code table.
+var (
+	chunkedLayout = [3]uint32{huffmanLayoutVersions[HuffmanLayoutChunked], 0, 0}
+	streamLayout  = [3]uint32{huffmanLayoutVersions[HuffmanLayoutStream], 0, 0}
+)
+
+// codeChunk returns a chunk of body whose last byte is padded with pad 0s.
+func codeChunk(pad byte, body ...byte) []byte {
+	return append(binary.LittleEndian.AppendUint32([]byte{pad}, uint32(len(body))), body...)
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	valid, err := compressChunks(strings.NewReader("hello huffman\n"), 2)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	data := valid.Bytes()
+	// a and b, no symbol has the code 11
+	table := handmadeTable(chunkedLayout, [3]uint32{'a', 0b0, 1}, [3]uint32{'b', 0b10, 2})
+
+	testCases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "no header length", data: data[:1], want: ErrTruncated},
+		{name: "truncated header", data: data[:6], want: ErrTruncated},
+		{name: "no body", data: table, want: ErrTruncated},
+		{name: "truncated chunk", data: data[:len(data)-1], want: ErrTruncated},
+		{name: "ends inside a code", data: slices.Concat(table, codeChunk(7, 0b1000_0000)), want: ErrTruncated},
+		{name: "empty header", data: slices.Concat(handmadeTable(), codeChunk(0, 0)), want: ErrBadHeader},
+		{name: "partial entry", data: slices.Concat([]byte{10, 0}, make([]byte, 10)), want: ErrBadHeader},
+		{name: "code too long", data: handmadeTable([3]uint32{'a', 0, 40}), want: ErrBadHeader},
+		{name: "code wider than its bits", data: handmadeTable([3]uint32{'a', 0b100, 2}), want: ErrBadHeader},
+		{name: "code taken twice", data: handmadeTable([3]uint32{'a', 0b1, 1}, [3]uint32{'b', 0b1, 1}), want: ErrBadHeader},
+		{name: "code extends another", data: handmadeTable([3]uint32{'a', 0b1, 1}, [3]uint32{'b', 0b10, 2}), want: ErrBadHeader},
+		{name: "unknown layout", data: handmadeTable([3]uint32{7, 0, 0}, [3]uint32{'a', 0b0, 1}), want: ErrBadHeader},
+		{name: "two layouts", data: handmadeTable(chunkedLayout, streamLayout, [3]uint32{'a', 0b0, 1}), want: ErrBadHeader},
+		{name: "padding of a byte", data: slices.Concat(table, codeChunk(8, 0)), want: ErrBadHeader},
+		{name: "invalid code", data: slices.Concat(table, codeChunk(6, 0b1100_0000)), want: ErrInvalidCode},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decompressBytes(tc.data)
+			if !errors.Is(err, tc.want) || !IsCorrupt(err) {
+				t.Errorf("Expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+
+	decoded, err := decompressBytes(slices.Concat(table, codeChunk(4, 0b0100_0000)))
+	if err != nil || decoded.String() != "aba" {
+		t.Errorf("Expected the handmade stream to decode to %q, got %q, %v", "aba", decoded, err)
+	}
+}
+
+func TestDecodeHuffmanLayouts(t *testing.T) {
+	// a is 0, b is 10, no symbol has 11
+	a, b := [3]uint32{'a', 0b0, 1}, [3]uint32{'b', 0b10, 2}
+	// "abba" is 010100, padded with 2 0s
+	body := []byte{0b0101_0000}
+	long := slices.Concat([]byte{0b0101_0000}, make([]byte, huffmanLookahead))
+	// a worker stream of 47 a, b and 32 a, which starts like an empty chunk
+	// followed by one of a byte
+	aOrB := handmadeTable([3]uint32{'a', 0b0, 1}, [3]uint32{'b', 0b1, 1})
+	emptyChunk := slices.Concat(aOrB, []byte{0, 0, 0, 0, 0, 0, 0b0000_0001, 0, 0, 0, 0})
+	testCases := []struct {
+		name   string
+		data   []byte
+		legacy string
+		want   string
+		err    error
+	}{
+		{name: "chunked", data: slices.Concat(handmadeTable(chunkedLayout, a, b), codeChunk(2, body...)), legacy: HuffmanLayoutStream, want: "abba"},
+		{name: "stream", data: slices.Concat(handmadeTable(streamLayout, a, b), []byte{2}, body), legacy: HuffmanLayoutChunked, want: "abba"},
+		{name: "unrecorded chunked", data: slices.Concat(handmadeTable(a, b), codeChunk(2, body...), codeChunk(0, 0)), legacy: HuffmanLayoutStream, want: "abbaaaaaaaaa"},
+		{name: "unrecorded stream", data: slices.Concat(handmadeTable(a, b), []byte{2}, body), legacy: HuffmanLayoutChunked, want: "abba"},
+		{name: "unrecorded stream like chunks", data: emptyChunk, legacy: HuffmanLayoutChunked, want: strings.Repeat("a", 47) + "b" + strings.Repeat("a", 32)},
+		{name: "unrecorded chunked told", data: slices.Concat(handmadeTable(a, b), codeChunk(2, body...), codeChunk(0, 0)), want: "abbaaaaaaaaa"},
+		{name: "unrecorded stream told", data: slices.Concat(handmadeTable(a, b), []byte{2}, body), want: "abba"},
+		{name: "unrecorded stream like chunks told", data: emptyChunk, want: strings.Repeat("a", 47) + "b" + strings.Repeat("a", 32)},
+		{name: "unrecorded and too long to tell", data: slices.Concat(handmadeTable(a, b), codeChunk(0, long...)), legacy: HuffmanLayoutChunked, want: "abbaaa" + strings.Repeat("a", 8*huffmanLookahead)},
+		{name: "unrecorded and too long to tell without a layout", data: slices.Concat(handmadeTable(a, b), codeChunk(0, long...)), err: ErrUnknownLayout},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var decoded strings.Builder
+			err := DecodeHuffman(bytes.NewReader(tc.data), &decoded, tc.legacy)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Errorf("Expected %v, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to decode: %v", err)
+			}
+			if decoded.String() != tc.want {
+				t.Errorf("Expected %d bytes starting %q, got %d starting %q", len(tc.want), tc.want[:4], decoded.Len(), decoded.String()[:min(4, decoded.Len())])
+			}
+		})
+	}
+}
+
+func FuzzDecompressBytes(f *testing.F) {
+	for _, seed := range []string{"", "a", "hello huffman\n", "\x00\x00b\n\x00", strings.Repeat("abcdefgh\n", 20)} {
+		compressed, err := compressChunks(strings.NewReader(seed), 2)
+		if err != nil {
+			f.Fatalf("compress failed: %v", err)
+		}
+		f.Add(compressed.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := decompressBytes(data)
+		if err != nil && !errors.Is(err, ErrTruncated) && !errors.Is(err, ErrBadHeader) && !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("Expected a corrupt stream to fail with a typed error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,214 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrNotHuffman is returned by InspectHuffman for containers of other
+	// codecs, which have no code table.
+	ErrNotHuffman = errors.New("not huffman coded")
+	// ErrCorruptHuffman is returned when the code table of a Huffman stream
+	// doesn't decode its body.
+	ErrCorruptHuffman = errors.New("corrupt huffman stream")
+)
+
+// Layouts of a Huffman body after the code table. The chunked one is written
+// by HuffmanCodec, each chunk with its own padding and length, the stream one
+// by the workers, a single padding byte followed by the body.
+const (
+	HuffmanLayoutChunked = "chunked"
+	HuffmanLayoutStream  = "stream"
+)
+
+// HuffmanSymbol is one entry of a code table: how often Symbol was coded, and
+// its code of Bits bits, written out as 0s and 1s. Symbols past
+// utf8.MaxRune stand for bytes that aren't valid UTF-8, their Char is the
+// byte escaped, e.g. \xff.
+type HuffmanSymbol struct {
+	Symbol    rune   `json:"symbol"`
+	Char      string `json:"char"`
+	Frequency uint64 `json:"frequency"`
+	Code      string `json:"code"`
+	Bits      int    `json:"bits"`
+}
+
+// HuffmanTable is the code table of a Huffman stream with the frequencies of
+// its symbols, counted from the body since the header doesn't store them.
+type HuffmanTable struct {
+	// Part is the 1-based part of a joined container the table codes, 0 for
+	// a container of one stream.
+	Part   int    `json:"part,omitempty"`
+	Layout string `json:"layout"`
+	Chunks int    `json:"chunks,omitempty"`
+	// Symbols are ordered by frequency, the most frequent first.
+	Symbols []HuffmanSymbol `json:"symbols"`
+	// TotalSymbols is how many symbols the body codes in TotalBits bits.
+	TotalSymbols uint64 `json:"total_symbols"`
+	TotalBits    uint64 `json:"total_bits"`
+	// AverageBits is what a symbol took on average, Entropy the least any
+	// code could average for these frequencies. A wide gap between them is
+	// a code that fits the data badly.
+	AverageBits float64 `json:"average_bits"`
+	Entropy     float64 `json:"entropy"`
+}
+
+// InspectHuffman reads the code tables of the Huffman coded data in r, a
+// container or a bare stream like Compress writes, one table per part of a
+// joined container. legacy is the layout of bodies that neither record it nor
+// tell it, as for DecodeHuffman. The body is walked rather than decoded, so the checksum
+// in the trailer isn't verified.
+func InspectHuffman(r io.Reader, legacy string) ([]*HuffmanTable, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(ContainerMagic))
+	if !bytes.Equal(magic, ContainerMagic) {
+		table, err := inspectHuffmanStream(br, legacy)
+		if err != nil {
+			return nil, err
+		}
+		return []*HuffmanTable{table}, nil
+	}
+
+	header, err := ReadContainerHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if header.Algorithm != "huffman" {
+		return nil, fmt.Errorf("%w: %s container", ErrNotHuffman, header.Algorithm)
+	}
+	payload := &holdbackReader{r: br, n: containerTrailerLen}
+	if len(header.Metadata.Parts) == 0 {
+		table, err := inspectHuffmanStream(payload, legacy)
+		if err != nil {
+			return nil, err
+		}
+		return []*HuffmanTable{table}, nil
+	}
+
+	var tables []*HuffmanTable
+	for i, part := range header.Metadata.Parts {
+		table, err := inspectHuffmanStream(io.LimitReader(payload, part.Length), legacy)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i+1, err)
+		}
+		table.Part = i + 1
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+// inspectHuffmanStream reads the code table at the start of r and counts its
+// symbols in the body that follows, taken for its layout like DecodeHuffman
+// does.
+func inspectHuffmanStream(r io.Reader, legacy string) (*HuffmanTable, error) {
+	br := bufio.NewReaderSize(r, huffmanLookahead)
+	if _, err := br.Peek(1); err == io.EOF {
+		// empty input is coded as nothing at all
+		return &HuffmanTable{Layout: HuffmanLayoutStream, Symbols: []HuffmanSymbol{}}, nil
+	}
+	codeTable, err := readCodeTable(br)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(symbolCounts)
+	layout, chunks, err := codeTable.decode(br, counts, legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &HuffmanTable{Layout: layout, Chunks: chunks, Symbols: []HuffmanSymbol{}}
+	for _, leaf := range codeTable.leaves {
+		symbol := HuffmanSymbol{
+			Symbol:    rune(leaf.char),
+			Char:      symbolChar(leaf.char),
+			Frequency: counts[leaf.char],
+			Code:      fmt.Sprintf("%0*b", leaf.bits, leaf.code),
+			Bits:      int(leaf.bits),
+		}
+		table.Symbols = append(table.Symbols, symbol)
+		table.TotalSymbols += symbol.Frequency
+		table.TotalBits += symbol.Frequency * uint64(symbol.Bits)
+	}
+	slices.SortFunc(table.Symbols, func(a, b HuffmanSymbol) int {
+		return cmp.Or(cmp.Compare(b.Frequency, a.Frequency), cmp.Compare(a.Bits, b.Bits), cmp.Compare(a.Symbol, b.Symbol))
+	})
+	if table.TotalSymbols > 0 {
+		total := float64(table.TotalSymbols)
+		table.AverageBits = float64(table.TotalBits) / total
+		for _, symbol := range table.Symbols {
+			if symbol.Frequency == 0 {
+				continue
+			}
+			freq := float64(symbol.Frequency) / total
+			table.Entropy -= freq * math.Log2(freq)
+		}
+	}
+	return table, nil
+}
+
+// symbolChar returns the text of the symbol char.
+func symbolChar(char uint32) string {
+	if char >= rawByteSymbol {
+		return fmt.Sprintf(`\x%02x`, char-rawByteSymbol)
+	}
+	return string(rune(char))
+}
+
+// WriteDOT writes the code tree of t as a Graphviz digraph named name. Inner
+// nodes are labelled with how many symbols went through them, and leaves
+// with their symbol as well.
+func (t *HuffmanTable) WriteDOT(w io.Writer, name string) error {
+	symbols := slices.Clone(t.Symbols)
+	slices.SortFunc(symbols, func(a, b HuffmanSymbol) int { return strings.Compare(a.Code, b.Code) })
+
+	weights := make(map[string]uint64)
+	for _, symbol := range symbols {
+		for i := 0; i <= len(symbol.Code); i++ {
+			weights[symbol.Code[:i]] += symbol.Frequency
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(name))
+	b.WriteString("\tnode [shape=circle];\n")
+	fmt.Fprintf(&b, "\tn [label=\"%d\"];\n", weights[""])
+	seen := map[string]bool{"": true}
+	for _, symbol := range symbols {
+		for i := 1; i <= len(symbol.Code); i++ {
+			code := symbol.Code[:i]
+			if seen[code] {
+				continue
+			}
+			seen[code] = true
+			if i == len(symbol.Code) {
+				label := strconv.QuoteRune(symbol.Symbol)
+				if symbol.Symbol > utf8.MaxRune {
+					label = symbol.Char
+				}
+				label = dotEscape(label)
+				fmt.Fprintf(&b, "\tn%s [shape=box, label=\"%s\\n%d\"];\n", code, label, symbol.Frequency)
+			} else {
+				fmt.Fprintf(&b, "\tn%s [label=\"%d\"];\n", code, weights[code])
+			}
+			fmt.Fprintf(&b, "\tn%s -> n%s [label=\"%c\"];\n", code[:i-1], code, code[i-1])
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotEscape escapes s for a quoted Graphviz label.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
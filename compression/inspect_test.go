@@ -0,0 +1,137 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInspectHuffman(t *testing.T) {
+	text := "abracadabra"
+	want := map[rune]uint64{'a': 5, 'b': 2, 'r': 2, 'c': 1, 'd': 1}
+
+	chunked, err := compressChunks(strings.NewReader(text), 1)
+	if err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	// the worker layout is the one chunk without its length, recorded as such
+	// in place of the chunked layout leading the table
+	data := chunked.Bytes()
+	headerLen := 2 + int(data[0]) + int(data[1])<<8
+	stream := slices.Concat(data[:2], HuffmanLayoutEntry(HuffmanLayoutStream), data[11:headerLen+1], data[headerLen+5:])
+	// and both as written before layouts were recorded
+	unrecorded := binary.LittleEndian.AppendUint16(nil, uint16(headerLen-11))
+	unrecordedChunked := slices.Concat(unrecorded, data[11:])
+	unrecordedStream := slices.Concat(unrecorded, data[11:headerLen+1], data[headerLen+5:])
+
+	var container bytes.Buffer
+	if err := WriteContainer(&container, HuffmanCodec{}, strings.NewReader(text), ContainerMetadata{}); err != nil {
+		t.Fatalf("write container failed: %v", err)
+	}
+
+	testCases := []struct {
+		name   string
+		data   []byte
+		legacy string
+		layout string
+	}{
+		{name: "chunked", data: chunked.Bytes(), legacy: HuffmanLayoutStream, layout: HuffmanLayoutChunked},
+		{name: "stream", data: stream, legacy: HuffmanLayoutChunked, layout: HuffmanLayoutStream},
+		{name: "container", data: container.Bytes(), layout: HuffmanLayoutChunked},
+		{name: "unrecorded chunked", data: unrecordedChunked, legacy: HuffmanLayoutStream, layout: HuffmanLayoutChunked},
+		{name: "unrecorded stream", data: unrecordedStream, legacy: HuffmanLayoutChunked, layout: HuffmanLayoutStream},
+		{name: "unrecorded chunked told", data: unrecordedChunked, layout: HuffmanLayoutChunked},
+		{name: "unrecorded stream told", data: unrecordedStream, layout: HuffmanLayoutStream},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tables, err := InspectHuffman(bytes.NewReader(tc.data), tc.legacy)
+			if err != nil {
+				t.Fatalf("inspect failed: %v", err)
+			}
+			if len(tables) != 1 {
+				t.Fatalf("expected one table, got %d", len(tables))
+			}
+			table := tables[0]
+			if table.Layout != tc.layout || table.TotalSymbols != uint64(len(text)) || len(table.Symbols) != len(want) {
+				t.Fatalf("unexpected table: %+v", table)
+			}
+			if table.Symbols[0].Char != "a" {
+				t.Errorf("expected the most frequent symbol first, got %+v", table.Symbols[0])
+			}
+			for _, symbol := range table.Symbols {
+				if symbol.Frequency != want[symbol.Symbol] || len(symbol.Code) != symbol.Bits {
+					t.Errorf("unexpected symbol: %+v", symbol)
+				}
+			}
+			if table.AverageBits < table.Entropy || table.Entropy < 2 {
+				t.Errorf("unexpected averages: %f bits against an entropy of %f", table.AverageBits, table.Entropy)
+			}
+		})
+	}
+
+	t.Run("parts", func(t *testing.T) {
+		data := joinTestParts(t, HuffmanCodec{}, []string{text, "zzz"})
+		tables, err := InspectHuffman(bytes.NewReader(data), "")
+		if err != nil {
+			t.Fatalf("inspect failed: %v", err)
+		}
+		if len(tables) != 2 || tables[1].Part != 2 || tables[1].TotalSymbols != 3 || tables[1].Symbols[0].Char != "z" {
+			t.Errorf("unexpected tables: %+v", tables)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		tables, err := InspectHuffman(bytes.NewReader(nil), "")
+		if err != nil || len(tables) != 1 || len(tables[0].Symbols) != 0 {
+			t.Errorf("expected an empty table, got %+v, %v", tables, err)
+		}
+	})
+
+	t.Run("not huffman", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteContainer(&buf, StoreCodec{}, strings.NewReader(text), ContainerMetadata{}); err != nil {
+			t.Fatalf("write container failed: %v", err)
+		}
+		if _, err := InspectHuffman(&buf, ""); !errors.Is(err, ErrNotHuffman) {
+			t.Errorf("expected ErrNotHuffman, got %v", err)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		if _, err := InspectHuffman(bytes.NewReader(chunked.Bytes()[:len(chunked.Bytes())-1]), ""); !errors.Is(err, ErrCorruptHuffman) {
+			t.Errorf("expected ErrCorruptHuffman for a cut body, got %v", err)
+		}
+		if _, err := InspectHuffman(bytes.NewReader([]byte{9, 0, 1}), ""); !errors.Is(err, ErrCorruptHuffman) {
+			t.Errorf("expected ErrCorruptHuffman for a cut table, got %v", err)
+		}
+	})
+}
+
+func TestHuffmanTableWriteDOT(t *testing.T) {
+	table := &HuffmanTable{Symbols: []HuffmanSymbol{
+		{Symbol: 'a', Frequency: 3, Code: "0", Bits: 1},
+		{Symbol: '"', Frequency: 2, Code: "10", Bits: 2},
+		{Symbol: '\n', Frequency: 1, Code: "11", Bits: 2},
+	}}
+	var buf bytes.Buffer
+	if err := table.WriteDOT(&buf, "huffman"); err != nil {
+		t.Fatalf("WriteDOT failed: %v", err)
+	}
+	for _, line := range []string{
+		`digraph "huffman" {`,
+		`n [label="6"];`,
+		`n1 [label="3"];`,
+		`n -> n0 [label="0"];`,
+		`n10 [shape=box, label="'\"'\n2"];`,
+		`n11 [shape=box, label="'\\n'\n1"];`,
+		`n1 -> n11 [label="1"];`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("expected %q in:\n%s", line, buf.String())
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package compression
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A large file can be compressed in parts by separate workers, each part a
+// byte range of the file encoded on its own. JoinContainer puts the parts
+// back together as one version 4 container, whose payload is the codec
+// output of every part back to back, indexed by the metadata.
+
+// ContainerPart is one part of a joined container: Size bytes of the
+// original with the given CRC32 (IEEE), encoded into Length bytes.
+type ContainerPart struct {
+	Size   int64  `json:"size"`
+	Length int64  `json:"length"`
+	CRC    uint32 `json:"crc"`
+}
+
+// JoinContainer writes a container of parts encoded by the codec named
+// algorithm, reading the codec output of part i from open. The trailer
+// covers the whole original, as if it had been encoded at once.
+func JoinContainer(w io.Writer, algorithm string, parts []ContainerPart, meta ContainerMetadata, open func(i int) (io.ReadCloser, error)) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("a joined container needs at least one part")
+	}
+	meta.Parts = parts
+	if err := writeContainerHeader(w, algorithm, meta); err != nil {
+		return err
+	}
+
+	var size uint64
+	var checksum uint32
+	for i, part := range parts {
+		rc, err := open(i)
+		if err != nil {
+			return fmt.Errorf("failed to open part %d: %w", i, err)
+		}
+		n, err := io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy part %d: %w", i, err)
+		}
+		if n != part.Length {
+			return fmt.Errorf("part %d is %d bytes long, expected %d", i, n, part.Length)
+		}
+		checksum = combineCRC(checksum, part.CRC, part.Size)
+		size += uint64(part.Size)
+	}
+	return writeContainerTrailer(w, size, checksum)
+}
+
+// AppendContainer writes the joined container read from r with one more
+// part, whose codec output is read from segment, for originals that grow
+// over time like logs. The parts already there are copied as they are, only
+// the header and the trailer are written anew.
+func AppendContainer(w io.Writer, r io.Reader, part ContainerPart, segment io.Reader) error {
+	header, err := ReadContainerHeader(r)
+	if err != nil {
+		return err
+	}
+	if len(header.Metadata.Parts) == 0 {
+		return fmt.Errorf("only joined containers can be appended to")
+	}
+	var length int64
+	for _, p := range header.Metadata.Parts {
+		length += p.Length
+	}
+	meta := header.Metadata
+	meta.Parts = append(meta.Parts[:len(meta.Parts):len(meta.Parts)], part)
+	if err := writeContainerHeader(w, header.Algorithm, meta); err != nil {
+		return err
+	}
+
+	payload := &holdbackReader{r: r, n: containerTrailerLen}
+	n, err := io.Copy(w, payload)
+	if err != nil {
+		return fmt.Errorf("failed to copy container payload: %w", err)
+	}
+	trailer := payload.held
+	if n != length || len(trailer) != containerTrailerLen {
+		return ErrTruncatedContainer
+	}
+	if n, err = io.Copy(w, segment); err != nil {
+		return fmt.Errorf("failed to copy appended part: %w", err)
+	}
+	if n != part.Length {
+		return fmt.Errorf("appended part is %d bytes long, expected %d", n, part.Length)
+	}
+	size := binary.LittleEndian.Uint64(trailer[0:8])
+	checksum := binary.LittleEndian.Uint32(trailer[8:12])
+	return writeContainerTrailer(w, size+uint64(part.Size), combineCRC(checksum, part.CRC, part.Size))
+}
+
+// readContainerParts decodes every part of payload into w, checking each on
+// its own so that a corrupt part is reported as such.
+func readContainerParts(payload io.Reader, parts []ContainerPart, codec Codec, w io.Writer) error {
+	for i, part := range parts {
+		r := io.LimitReader(payload, part.Length)
+		digest := newDigestWriter()
+		if err := codec.Decompress(r, io.MultiWriter(w, digest)); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		if digest.size != uint64(part.Size) || digest.crc.Sum32() != part.CRC {
+			return fmt.Errorf("%w: part %d: expected %d bytes (crc %08x), got %d bytes (crc %08x)",
+				ErrChecksumMismatch, i, part.Size, part.CRC, digest.size, digest.crc.Sum32())
+		}
+	}
+	return nil
+}
+
+// combineCRC returns the CRC32 (IEEE) of a+b from those of a and b, the
+// latter len2 bytes long, without reading either. This is crc32_combine of
+// zlib: appending len2 zero bits to a is a linear map over GF(2), applied by
+// squaring its matrix once per bit of len2.
+func combineCRC(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1 ^ crc2
+	}
+	even := make([]uint32, 32)
+	odd := make([]uint32, 32)
+
+	// the operator for one zero bit
+	odd[0] = crc32.IEEE
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(even, odd) // two zero bits
+	gf2MatrixSquare(odd, even) // four zero bits
+
+	// the first square gives one zero byte
+	for {
+		gf2MatrixSquare(even, odd)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(even, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(odd, even)
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(odd, crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat []uint32) {
+	for n := range 32 {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
@@ -0,0 +1,135 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCombineCRC(t *testing.T) {
+	a := []byte(strings.Repeat("first half ", 1000))
+	for _, b := range [][]byte{nil, []byte("x"), []byte(strings.Repeat("second half ", 777))} {
+		want := crc32.ChecksumIEEE(append(append([]byte{}, a...), b...))
+		if got := combineCRC(crc32.ChecksumIEEE(a), crc32.ChecksumIEEE(b), int64(len(b))); got != want {
+			t.Errorf("combineCRC with %d bytes = %08x, want %08x", len(b), got, want)
+		}
+	}
+}
+
+// joinTestParts encodes each of texts on its own and joins them.
+func joinTestParts(t *testing.T, codec Codec, texts []string) []byte {
+	t.Helper()
+	var payloads [][]byte
+	var parts []ContainerPart
+	for _, text := range texts {
+		var buf bytes.Buffer
+		if err := codec.Compress(strings.NewReader(text), &buf); err != nil {
+			t.Fatalf("compress failed: %v", err)
+		}
+		payloads = append(payloads, buf.Bytes())
+		parts = append(parts, ContainerPart{Size: int64(len(text)), Length: int64(buf.Len()), CRC: crc32.ChecksumIEEE([]byte(text))})
+	}
+	var out bytes.Buffer
+	err := JoinContainer(&out, codec.Name(), parts, ContainerMetadata{Name: "big.log"}, func(i int) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(payloads[i])), nil
+	})
+	if err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestJoinContainer(t *testing.T) {
+	texts := []string{
+		strings.Repeat("parts are compressed by separate workers\n", 40),
+		strings.Repeat("0123456789", 97),
+		"tail",
+	}
+	for _, name := range []string{"huffman", "zstd", "adaptive"} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := Lookup(name)
+			if err != nil {
+				t.Fatalf("lookup failed: %v", err)
+			}
+			data := joinTestParts(t, codec, texts)
+
+			var out bytes.Buffer
+			header, err := ReadContainer(bytes.NewReader(data), &out, nil)
+			if err != nil {
+				t.Fatalf("read container failed: %v", err)
+			}
+			if header.Version != 4 || header.Algorithm != name || len(header.Metadata.Parts) != len(texts) {
+				t.Errorf("unexpected header: %+v", header)
+			}
+			if out.String() != strings.Join(texts, "") {
+				t.Errorf("round trip mismatch: got %d bytes", out.Len())
+			}
+		})
+	}
+}
+
+func TestAppendContainer(t *testing.T) {
+	codec, _ := Lookup("zstd")
+	texts := []string{strings.Repeat("first line\n", 50), "second line\n"}
+	data := joinTestParts(t, codec, texts[:1])
+
+	var segment bytes.Buffer
+	if err := codec.Compress(strings.NewReader(texts[1]), &segment); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	part := ContainerPart{Size: int64(len(texts[1])), Length: int64(segment.Len()), CRC: crc32.ChecksumIEEE([]byte(texts[1]))}
+	var appended bytes.Buffer
+	if err := AppendContainer(&appended, bytes.NewReader(data), part, bytes.NewReader(segment.Bytes())); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	header, err := ReadContainer(bytes.NewReader(appended.Bytes()), &out, nil)
+	if err != nil {
+		t.Fatalf("read container failed: %v", err)
+	}
+	if header.Metadata.Name != "big.log" || len(header.Metadata.Parts) != 2 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+	if out.String() != strings.Join(texts, "") {
+		t.Errorf("round trip mismatch: got %d bytes", out.Len())
+	}
+
+	// only joined containers have parts to append to
+	var plain bytes.Buffer
+	WriteContainer(&plain, codec, strings.NewReader("whole"), ContainerMetadata{})
+	if err := AppendContainer(io.Discard, bytes.NewReader(plain.Bytes()), part, bytes.NewReader(segment.Bytes())); err == nil {
+		t.Error("expected a container without parts to be rejected")
+	}
+	if err := AppendContainer(io.Discard, bytes.NewReader(data[:len(data)-1]), part, bytes.NewReader(segment.Bytes())); err == nil {
+		t.Error("expected a truncated container to be rejected")
+	}
+}
+
+func TestJoinContainer_CorruptPart(t *testing.T) {
+	codec, _ := Lookup("zstd")
+	data := joinTestParts(t, codec, []string{"first part", "second part"})
+
+	// a part that doesn't match its checksum is reported on its own
+	header, err := ReadContainerHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read header failed: %v", err)
+	}
+	parts := header.Metadata.Parts
+	parts[0].CRC, parts[1].CRC = parts[1].CRC, parts[0].CRC
+	var tampered bytes.Buffer
+	err = JoinContainer(&tampered, "zstd", parts, ContainerMetadata{}, func(i int) (io.ReadCloser, error) {
+		var buf bytes.Buffer
+		codec.Compress(strings.NewReader([]string{"first part", "second part"}[i]), &buf)
+		return io.NopCloser(&buf), nil
+	})
+	if err != nil {
+		t.Fatalf("join failed: %v", err)
+	}
+	if _, err := ReadContainer(&tampered, io.Discard, nil); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
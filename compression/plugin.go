@@ -0,0 +1,204 @@
+package compression
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PluginCodec runs an external program as a codec, so that compressors can be
+// added to a deployment without rebuilding it. The program is run as
+// `<path> compress` or `<path> decompress`, with `--level N` appended when a
+// level is set. It reads its input from stdin, writes its output to stdout
+// and exits with a non-zero status on failure, the reason on stderr.
+type PluginCodec struct {
+	name string
+	// Path is the program implementing the codec.
+	Path string
+	// Level is passed on to the program, 0 leaves the choice to it.
+	Level int
+	// Timeout is how long one compression or decompression may take, 0 for
+	// DefaultPluginTimeout. The program and everything it started are
+	// killed after it, or as soon as the context of WithContext is done.
+	Timeout time.Duration
+	ctx     context.Context
+}
+
+// DefaultPluginTimeout is the Timeout of plugin codecs unless configured
+// otherwise.
+var DefaultPluginTimeout = 10 * time.Minute
+
+// ErrPluginTimeout reports a plugin codec that ran out of time.
+var ErrPluginTimeout = errors.New("codec plugin timed out")
+
+// NewPluginCodec returns the codec name implemented by the program at path,
+// run for up to timeout.
+func NewPluginCodec(name, path string, timeout time.Duration) PluginCodec {
+	return PluginCodec{name: name, Path: path, Timeout: timeout}
+}
+
+func (c PluginCodec) Name() string { return c.name }
+
+// WithLevel accepts any level, the program itself rejects those it doesn't
+// support when it is run.
+func (c PluginCodec) WithLevel(level int) (Codec, error) {
+	c.Level = level
+	return c, nil
+}
+
+// WithContext kills the program once ctx is done.
+func (c PluginCodec) WithContext(ctx context.Context) Codec {
+	c.ctx = ctx
+	return c
+}
+
+func (c PluginCodec) Compress(r io.Reader, w io.Writer) error {
+	return c.run("compress", r, w)
+}
+
+func (c PluginCodec) Decompress(r io.Reader, w io.Writer) error {
+	return c.run("decompress", r, w)
+}
+
+const (
+	// maxPluginStderr is how much of what a program writes to stderr ends up
+	// in the error when it fails.
+	maxPluginStderr = 4 << 10
+	// pluginWaitDelay is how long the output of a killed program is waited
+	// for before giving up on it.
+	pluginWaitDelay = 5 * time.Second
+)
+
+func (c PluginCodec) run(operation string, r io.Reader, w io.Writer) error {
+	args := []string{operation}
+	if c.Level != 0 {
+		args = append(args, "--level", strconv.Itoa(c.Level))
+	}
+	parent := c.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeout := cmp.Or(c.Timeout, DefaultPluginTimeout)
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	stderr := &limitedBuffer{max: maxPluginStderr}
+	cmd := exec.CommandContext(ctx, c.Path, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, w, stderr
+	killProcessGroup(cmd)
+	// in case whatever it left running still holds stdout open
+	cmd.WaitDelay = pluginWaitDelay
+	if err := cmd.Run(); err != nil {
+		if parent.Err() != nil {
+			return fmt.Errorf("%s plugin stopped before it could %s: %w", c.name, operation, parent.Err())
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %s took longer than %s to %s", ErrPluginTimeout, c.name, timeout, operation)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s plugin failed to %s: %w: %s", c.name, operation, err, msg)
+		}
+		return fmt.Errorf("%s plugin failed to %s: %w", c.name, operation, err)
+	}
+	return nil
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// RegisterPlugins registers the plugin codecs of spec, a comma-separated list
+// of name=path, e.g. "brotli=/opt/codecs/brotli,lz4=lz4-codec", each run for
+// up to timeout. Paths without a slash are looked up in PATH.
+func RegisterPlugins(spec string, timeout time.Duration) error {
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(entry, "=")
+		if name, path = strings.TrimSpace(name), strings.TrimSpace(path); !ok || name == "" || path == "" {
+			return fmt.Errorf("invalid codec plugin %q, expected name=path", entry)
+		}
+		if _, err := Lookup(name); err == nil {
+			return fmt.Errorf("codec plugin %s: a codec with that name is already registered", name)
+		}
+		program, err := exec.LookPath(path)
+		if err != nil {
+			return fmt.Errorf("codec plugin %s: %w", name, err)
+		}
+		Register(NewPluginCodec(name, program, timeout))
+	}
+	return nil
+}
+
+// RegisterFromEnv registers the codecs a deployment adds to the built-in
+// ones: the programs of CODEC_PLUGINS, see RegisterPlugins, each run for up
+// to PLUGIN_TIMEOUT, and the modules of WASM_CODECS, see RegisterWasmCodecs,
+// each run limited to WASM_MEMORY_LIMIT bytes of memory and WASM_TIMEOUT.
+// HUFFMAN_MIN_CHUNK_SIZE and HUFFMAN_MAX_CHUNK_SIZE set
+// DefaultHuffmanChunkSizes.
+func RegisterFromEnv(ctx context.Context) error {
+	sizes := DefaultHuffmanChunkSizes
+	if value := os.Getenv("HUFFMAN_MIN_CHUNK_SIZE"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid HUFFMAN_MIN_CHUNK_SIZE %q", value)
+		}
+		sizes.Min = n
+	}
+	if value := os.Getenv("HUFFMAN_MAX_CHUNK_SIZE"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid HUFFMAN_MAX_CHUNK_SIZE %q", value)
+		}
+		sizes.Max = n
+	}
+	if sizes.Min > sizes.Max {
+		return fmt.Errorf("HUFFMAN_MIN_CHUNK_SIZE %d is above HUFFMAN_MAX_CHUNK_SIZE %d", sizes.Min, sizes.Max)
+	}
+	DefaultHuffmanChunkSizes = sizes
+
+	timeout := DefaultPluginTimeout
+	if value := os.Getenv("PLUGIN_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid PLUGIN_TIMEOUT %q", value)
+		}
+		timeout = d
+	}
+	if err := RegisterPlugins(os.Getenv("CODEC_PLUGINS"), timeout); err != nil {
+		return err
+	}
+	limits := DefaultWasmLimits
+	if value := os.Getenv("WASM_MEMORY_LIMIT"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid WASM_MEMORY_LIMIT %q", value)
+		}
+		limits.MaxMemory = n
+	}
+	if value := os.Getenv("WASM_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid WASM_TIMEOUT %q", value)
+		}
+		limits.Timeout = d
+	}
+	return RegisterWasmCodecs(ctx, os.Getenv("WASM_CODECS"), limits)
+}
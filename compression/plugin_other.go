@@ -0,0 +1,9 @@
+//go:build !unix
+
+package compression
+
+import "os/exec"
+
+// killProcessGroup leaves cmd to be killed on its own when its context is
+// done, process groups are a Unix thing.
+func killProcessGroup(cmd *exec.Cmd) {}
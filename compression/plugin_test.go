@@ -0,0 +1,165 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upperPlugin uppercases what it compresses and lowercases what it
+// decompresses, and only takes level 1.
+const upperPlugin = `#!/bin/sh
+if [ -n "$2" ] && [ "$3" != 1 ]; then
+	echo "unsupported level $3" >&2
+	exit 2
+fi
+case "$1" in
+compress) tr a-z A-Z ;;
+decompress) tr A-Z a-z ;;
+*) echo "unknown operation $1" >&2; exit 2 ;;
+esac
+`
+
+// hangingPlugin never finishes, and neither does the program it starts.
+const hangingPlugin = `#!/bin/sh
+sleep 60 &
+wait
+`
+
+func writePlugin(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPluginCodec(t *testing.T) {
+	codec := NewPluginCodec("upper", writePlugin(t, upperPlugin), time.Minute)
+
+	var compressed, decompressed bytes.Buffer
+	if err := codec.Compress(strings.NewReader("hello plugin"), &compressed); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if compressed.String() != "HELLO PLUGIN" {
+		t.Errorf("expected the output of the program, got %q", compressed.String())
+	}
+	if err := codec.Decompress(&compressed, &decompressed); err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if decompressed.String() != "hello plugin" {
+		t.Errorf("expected round trip, got %q", decompressed.String())
+	}
+
+	leveled, err := WithLevel(codec, 1)
+	if err != nil {
+		t.Fatalf("expected plugins to take any level: %v", err)
+	}
+	if err := leveled.Compress(strings.NewReader("a"), io.Discard); err != nil {
+		t.Errorf("expected level 1 to be passed on: %v", err)
+	}
+	leveled, _ = WithLevel(codec, 5)
+	if err := leveled.Compress(strings.NewReader("a"), io.Discard); err == nil || !strings.Contains(err.Error(), "unsupported level 5") {
+		t.Errorf("expected the reason of the program in the error, got %v", err)
+	}
+}
+
+func TestPluginCodecContainer(t *testing.T) {
+	codec := NewPluginCodec("upper", writePlugin(t, upperPlugin), time.Minute)
+	lookup := func(name string) (Codec, error) {
+		if name != codec.Name() {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownCodec, name)
+		}
+		return codec, nil
+	}
+
+	var container bytes.Buffer
+	if err := WriteContainer(&container, codec, strings.NewReader("hello plugin"), ContainerMetadata{Name: "notes.txt"}); err != nil {
+		t.Fatalf("WriteContainer failed: %v", err)
+	}
+	var out bytes.Buffer
+	header, err := ReadContainer(bytes.NewReader(container.Bytes()), &out, lookup)
+	if err != nil {
+		t.Fatalf("ReadContainer failed: %v", err)
+	}
+	if header.Algorithm != "upper" || header.Metadata.Name != "notes.txt" || out.String() != "hello plugin" {
+		t.Errorf("unexpected round trip: %+v, %q", header, out.String())
+	}
+
+	// without a name, a container of a codec without an ID can't be read
+	unnamed := bytes.Replace(container.Bytes(), []byte(`,"algorithm":"upper"`), []byte(`,"algorithm":""     `), 1)
+	if _, err := ReadContainerHeader(bytes.NewReader(unnamed)); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("expected ErrUnknownCodec, got %v", err)
+	}
+}
+
+func TestPluginCodecTimeout(t *testing.T) {
+	codec := NewPluginCodec("hanging", writePlugin(t, hangingPlugin), 100*time.Millisecond)
+	start := time.Now()
+	err := codec.Compress(strings.NewReader("a"), io.Discard)
+	if !errors.Is(err, ErrPluginTimeout) {
+		t.Errorf("expected the run to time out, got %v", err)
+	}
+	// the sleep it started holds stdout open until it is killed too
+	if elapsed := time.Since(start); elapsed > pluginWaitDelay {
+		t.Errorf("expected the program and its children to be killed, took %s", elapsed)
+	}
+}
+
+func TestPluginCodecCanceled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	codec := WithContext(ctx, NewPluginCodec("hanging", writePlugin(t, hangingPlugin), time.Minute))
+	start := time.Now()
+	err := codec.Compress(strings.NewReader("a"), io.Discard)
+	if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrPluginTimeout) {
+		t.Errorf("expected the run to stop with its context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > pluginWaitDelay {
+		t.Errorf("expected the program and its children to be killed, took %s", elapsed)
+	}
+}
+
+func TestRegisterPlugins(t *testing.T) {
+	path := writePlugin(t, upperPlugin)
+	name := "upper"
+	// the registry is global, other tests go through every codec in it
+	t.Cleanup(func() {
+		codecsMu.Lock()
+		defer codecsMu.Unlock()
+		delete(codecs, name)
+	})
+
+	if err := RegisterPlugins(" "+name+" = "+path+" ,", time.Minute); err != nil {
+		t.Fatalf("RegisterPlugins failed: %v", err)
+	}
+	codec, err := Lookup(name)
+	if err != nil {
+		t.Fatalf("expected the plugin to be registered: %v", err)
+	}
+	if plugin, ok := codec.(PluginCodec); !ok || plugin.Path != path {
+		t.Errorf("unexpected codec %#v", codec)
+	}
+
+	for _, spec := range []string{
+		"huffman=" + path,
+		name + "-missing=" + filepath.Join(t.TempDir(), "missing"),
+		"no-path",
+		"=" + path,
+	} {
+		if err := RegisterPlugins(spec, time.Minute); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+	if _, err := Lookup(name + "-missing"); !errors.Is(err, ErrUnknownCodec) {
+		t.Errorf("expected nothing to be registered for a missing program, got %v", err)
+	}
+}
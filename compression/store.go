@@ -0,0 +1,31 @@
+package compression
+
+import (
+	"fmt"
+	"io"
+)
+
+// StoreCodec copies its input unchanged. It is for data that is already
+// compressed, such as JPEG images or zip files, which other codecs would only
+// make larger; the container still checks its integrity.
+type StoreCodec struct{}
+
+func init() {
+	Register(StoreCodec{})
+}
+
+func (StoreCodec) Name() string { return "store" }
+
+func (StoreCodec) Compress(r io.Reader, w io.Writer) error {
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to store data: %w", err)
+	}
+	return nil
+}
+
+func (StoreCodec) Decompress(r io.Reader, w io.Writer) error {
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("failed to restore data: %w", err)
+	}
+	return nil
+}
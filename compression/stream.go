@@ -0,0 +1,125 @@
+package compression
+
+import "io"
+
+// Writer compresses everything written to it into a .ranran container on the
+// underlying writer, like gzip.Writer. The container is only complete once
+// Close returns nil.
+type Writer struct {
+	// Metadata goes in the container header. It may be set until the first
+	// Write.
+	Metadata ContainerMetadata
+
+	w       io.Writer
+	codec   Codec
+	pw      *io.PipeWriter
+	done    chan error
+	err     error
+	started bool
+	closed  bool
+}
+
+// NewWriter returns a Writer compressing with the Huffman codec.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterCodec(w, HuffmanCodec{})
+}
+
+// NewWriterCodec returns a Writer compressing with codec, e.g. one from
+// Lookup or WithLevel.
+func NewWriterCodec(w io.Writer, codec Codec) *Writer {
+	return &Writer{w: w, codec: codec}
+}
+
+// start runs the codec over what is written to the pipe. Codecs read their
+// input themselves, so they get a goroutine of their own.
+func (z *Writer) start() {
+	pr, pw := io.Pipe()
+	z.pw, z.done, z.started = pw, make(chan error, 1), true
+	go func() {
+		err := WriteContainer(z.w, z.codec, pr, z.Metadata)
+		// stop Write from blocking on a codec that gave up early
+		pr.CloseWithError(err)
+		z.done <- err
+	}()
+}
+
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if !z.started {
+		z.start()
+	}
+	n, err := z.pw.Write(p)
+	if err != nil {
+		// the codec's own error says more than the closed pipe
+		z.err = <-z.done
+		if z.err == nil {
+			z.err = err
+		}
+		return n, z.err
+	}
+	return n, nil
+}
+
+// Close finishes the container, writing its trailer. It does not close the
+// underlying writer.
+func (z *Writer) Close() error {
+	if z.closed || z.err != nil {
+		return z.err
+	}
+	z.closed = true
+	if !z.started {
+		z.start()
+	}
+	z.pw.Close()
+	z.err = <-z.done
+	return z.err
+}
+
+// Reader decompresses a .ranran container from the underlying reader, like
+// gzip.Reader. The checksum is verified at the end of the data, so the data
+// read is only trustworthy once Read returns io.EOF.
+type Reader struct {
+	// Header is the header of the container, read by NewReader.
+	Header ContainerHeader
+	// Lookup resolves the codec named in the header, Lookup when nil. It may
+	// be set until the first Read, e.g. to decompress with a dictionary.
+	Lookup func(name string) (Codec, error)
+
+	r       io.Reader
+	pr      *io.PipeReader
+	started bool
+}
+
+// NewReader reads the container header from r. It fails with ErrBadMagic if
+// r doesn't hold a container.
+func NewReader(r io.Reader) (*Reader, error) {
+	header, err := ReadContainerHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{Header: *header, r: r}, nil
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	if !z.started {
+		pr, pw := io.Pipe()
+		z.pr, z.started = pr, true
+		go func() {
+			pw.CloseWithError(ReadContainerPayload(z.r, &z.Header, pw, z.Lookup))
+		}()
+	}
+	return z.pr.Read(p)
+}
+
+// Close stops decompressing. It does not close the underlying reader.
+func (z *Reader) Close() error {
+	if z.started {
+		z.pr.Close()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestStream_RoundTrip(t *testing.T) {
+	text := strings.Repeat("streaming through the codec, ", 200)
+	for _, name := range []string{"huffman", "zstd", "gzip", "adaptive"} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := Lookup(name)
+			if err != nil {
+				t.Fatalf("lookup failed: %v", err)
+			}
+			var buf bytes.Buffer
+			zw := NewWriterCodec(&buf, codec)
+			zw.Metadata = ContainerMetadata{Name: "notes.txt"}
+			// several writes, as a server would pass on a request body
+			for _, part := range []string{text[:100], text[100:1000], text[1000:]} {
+				if _, err := io.WriteString(zw, part); err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("close failed: %v", err)
+			}
+
+			zr, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader failed: %v", err)
+			}
+			defer zr.Close()
+			if zr.Header.Algorithm != name || zr.Header.Metadata.Name != "notes.txt" {
+				t.Errorf("unexpected header %+v", zr.Header)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("read failed: %v", err)
+			}
+			if string(got) != text {
+				t.Errorf("round trip mismatch: got %d bytes, want %d", len(got), len(text))
+			}
+		})
+	}
+}
+
+func TestStream_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	zr, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if got, err := io.ReadAll(zr); err != nil || len(got) != 0 {
+		t.Errorf("expected nothing, got %q, %v", got, err)
+	}
+}
+
+func TestStream_Invalid(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("plain text")); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected ErrBadMagic, got %v", err)
+	}
+
+	data := writeTestContainer(t, "zstd", "checksummed text")
+	data[len(data)-1] ^= 0xff
+	zr, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	if _, err := io.ReadAll(zr); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch at the end, got %v", err)
+	}
+}
+
+func TestStream_WriteAfterClose(t *testing.T) {
+	zw := NewWriter(io.Discard)
+	zw.Close()
+	if _, err := zw.Write([]byte("late")); err == nil {
+		t.Error("expected writing after Close to fail")
+	}
+}
@@ -0,0 +1,48 @@
+// Command wasmcodec is the WASM codec of the tests, built for wasip1. It
+// uppercases what it compresses and lowercases what it decompresses. Level 1
+// is the only valid level, level 2 never finishes and level 3 runs out of
+// memory.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+var sink []byte
+
+func main() {
+	if len(os.Args) > 3 && os.Args[2] == "--level" {
+		switch os.Args[3] {
+		case "1":
+		case "2":
+			for {
+			}
+		case "3":
+			for {
+				sink = append(sink, make([]byte, 16<<20)...)
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "unsupported level", os.Args[3])
+			os.Exit(2)
+		}
+	}
+	transform := bytes.ToUpper
+	switch os.Args[1] {
+	case "compress":
+	case "decompress":
+		transform = bytes.ToLower
+	default:
+		fmt.Fprintln(os.Stderr, "unknown operation", os.Args[1])
+		os.Exit(2)
+	}
+	in, err := io.ReadAll(bufio.NewReader(os.Stdin))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(transform(in))
+}
@@ -0,0 +1,175 @@
+package compression
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// CorruptionError locates the damage VerifyContainer found in a container.
+type CorruptionError struct {
+	// Offset is where in the container the damage was found, in bytes. A
+	// codec may only notice some way past the damaged byte.
+	Offset int64
+	// Part is the index of the damaged part of a joined container, or -1.
+	Part int
+	Err  error
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Part >= 0 {
+		return fmt.Sprintf("part %d at byte %d: %v", e.Part, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("at byte %d: %v", e.Offset, e.Err)
+}
+
+func (e *CorruptionError) Unwrap() error { return e.Err }
+
+// ContainerReport describes a container checked by VerifyContainer.
+type ContainerReport struct {
+	Header ContainerHeader
+	// PayloadOffset and PayloadLen locate the codec output in the container.
+	PayloadOffset int64
+	PayloadLen    int64
+	// Size and CRC are the size and checksum of the original recorded in
+	// the trailer.
+	Size uint64
+	CRC  uint32
+	// Decoded is set when the payload was decoded and matched the trailer.
+	Decoded bool
+}
+
+// offsetReader counts the bytes read through it.
+type offsetReader struct {
+	r io.Reader
+	n int64
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	o.n += int64(n)
+	return n, err
+}
+
+// VerifyContainer checks the container in r without writing its data
+// anywhere: that the header parses, its codec is known, the archive index
+// and parts add up, and the trailer is there. Joined containers have their
+// checksum verified from those of their parts. With decode the payload is
+// decoded as well, verifying the checksum of any container, with the codec
+// resolved by lookup (Lookup when nil). A container compressed with a
+// dictionary is only decoded with a lookup applying it, see WithDictionary.
+//
+// Damage is reported as a *CorruptionError, along with what was learned of
+// the container until then.
+func VerifyContainer(r io.Reader, decode bool, lookup func(name string) (Codec, error)) (*ContainerReport, error) {
+	in := &offsetReader{r: r}
+	header, err := ReadContainerHeader(in)
+	if err != nil {
+		return nil, &CorruptionError{Offset: in.n, Part: -1, Err: err}
+	}
+	report := &ContainerReport{Header: *header, PayloadOffset: in.n}
+	if lookup == nil {
+		// Lookup can't apply a dictionary
+		decode = decode && header.Metadata.Dictionary == ""
+		lookup = Lookup
+	}
+	codec, err := lookup(header.Algorithm)
+	if err != nil {
+		return report, err
+	}
+	if err := verifyArchiveIndex(header.Metadata.Members); header.Metadata.Archive && err != nil {
+		return report, &CorruptionError{Offset: int64(containerHeaderLen), Part: -1, Err: err}
+	}
+
+	payload := &offsetReader{r: &holdbackReader{r: in, n: containerTrailerLen}}
+	digest := newDigestWriter()
+	corrupt := func(part int, err error) error {
+		return &CorruptionError{Offset: report.PayloadOffset + payload.n, Part: part, Err: err}
+	}
+	if decode && len(header.Metadata.Parts) > 0 {
+		for i, part := range header.Metadata.Parts {
+			start := payload.n
+			partReader := io.LimitReader(payload, part.Length)
+			partDigest := newDigestWriter()
+			if err := codec.Decompress(partReader, io.MultiWriter(digest, partDigest)); err != nil {
+				return report, corrupt(i, err)
+			}
+			if _, err := io.Copy(io.Discard, partReader); err != nil {
+				return report, corrupt(i, err)
+			}
+			if partDigest.size != uint64(part.Size) || partDigest.crc.Sum32() != part.CRC {
+				return report, &CorruptionError{Offset: report.PayloadOffset + start, Part: i, Err: fmt.Errorf("%w: expected %d bytes (crc %08x), got %d bytes (crc %08x)",
+					ErrChecksumMismatch, part.Size, part.CRC, partDigest.size, partDigest.crc.Sum32())}
+			}
+		}
+	} else if decode {
+		if err := codec.Decompress(payload, digest); err != nil {
+			return report, corrupt(-1, err)
+		}
+	}
+	if _, err := io.Copy(io.Discard, payload); err != nil {
+		return report, corrupt(-1, err)
+	}
+	report.PayloadLen = payload.n
+
+	trailer := payload.r.(*holdbackReader).held
+	if len(trailer) != containerTrailerLen {
+		return report, &CorruptionError{Offset: in.n, Part: -1, Err: ErrTruncatedContainer}
+	}
+	report.Size = binary.LittleEndian.Uint64(trailer[0:8])
+	report.CRC = binary.LittleEndian.Uint32(trailer[8:12])
+	trailerAt := report.PayloadOffset + report.PayloadLen
+	mismatch := func(format string, args ...any) error {
+		return &CorruptionError{Offset: trailerAt, Part: -1, Err: fmt.Errorf("%w: "+format, append([]any{ErrChecksumMismatch}, args...)...)}
+	}
+
+	if parts := header.Metadata.Parts; len(parts) > 0 {
+		var length int64
+		var size uint64
+		var crc uint32
+		for _, part := range parts {
+			length += part.Length
+			crc = combineCRC(crc, part.CRC, part.Size)
+			size += uint64(part.Size)
+		}
+		if length != report.PayloadLen {
+			return report, &CorruptionError{Offset: report.PayloadOffset, Part: -1, Err: fmt.Errorf("%w: parts hold %d bytes, the payload is %d", ErrTruncatedContainer, length, report.PayloadLen)}
+		}
+		if size != report.Size || crc != report.CRC {
+			return report, mismatch("parts add up to %d bytes (crc %08x), the trailer has %d bytes (crc %08x)", size, crc, report.Size, report.CRC)
+		}
+	}
+	if header.Metadata.Archive {
+		var size uint64
+		if n := len(header.Metadata.Members); n > 0 {
+			last := header.Metadata.Members[n-1]
+			size = uint64(last.Offset + last.Size)
+		}
+		if size != report.Size {
+			return report, mismatch("the archive index holds %d bytes, the trailer has %d", size, report.Size)
+		}
+	}
+	if decode {
+		if digest.size != report.Size || digest.crc.Sum32() != report.CRC {
+			return report, mismatch("expected %d bytes (crc %08x), got %d bytes (crc %08x)", report.Size, report.CRC, digest.size, digest.crc.Sum32())
+		}
+		report.Decoded = true
+	}
+	return report, nil
+}
+
+// verifyArchiveIndex checks that the members of an archive are safe to
+// extract and their data follows each other, as ArchiveWriter expects.
+func verifyArchiveIndex(members []ArchiveMember) error {
+	var offset int64
+	for _, m := range members {
+		if _, ok := archiveMemberName(m.Name); !ok {
+			return fmt.Errorf("%w: unsafe member name %q", ErrInvalidArchive, m.Name)
+		}
+		if m.Offset != offset || m.Size < 0 || (m.Dir && m.Size != 0) {
+			return fmt.Errorf("%w: %s at %d (%d bytes), expected it at %d", ErrInvalidArchive, m.Name, m.Offset, m.Size, offset)
+		}
+		offset += m.Size
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyContainer(t *testing.T) {
+	text := strings.Repeat("verified without writing anything\n", 50)
+	data := writeTestContainer(t, "zstd", text)
+
+	report, err := VerifyContainer(bytes.NewReader(data), true, nil)
+	if err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+	if !report.Decoded || report.Size != uint64(len(text)) || report.Header.Algorithm != "zstd" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.PayloadOffset+report.PayloadLen+containerTrailerLen != int64(len(data)) {
+		t.Errorf("payload at %d, %d bytes, doesn't span a %d byte container", report.PayloadOffset, report.PayloadLen, len(data))
+	}
+
+	// without decoding only the structure is checked
+	report, err = VerifyContainer(bytes.NewReader(data), false, nil)
+	if err != nil || report.Decoded {
+		t.Errorf("expected the structure to check out without decoding, got %+v, %v", report, err)
+	}
+}
+
+func TestVerifyContainer_Corrupt(t *testing.T) {
+	text := strings.Repeat("damage is located, not decoded into garbage\n", 50)
+	data := writeTestContainer(t, "huffman", text)
+
+	testCases := []struct {
+		name    string
+		data    []byte
+		decode  bool
+		wantErr error
+	}{
+		{"bad magic", []byte("plain text"), false, ErrBadMagic},
+		{"truncated header", data[:20], false, ErrTruncatedContainer},
+		// without the trailer the end of the payload is taken for it
+		{"truncated", data[:len(data)-4], true, nil},
+		{"checksum", append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^0xff), true, ErrChecksumMismatch},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := VerifyContainer(bytes.NewReader(tc.data), tc.decode, nil)
+			var corrupt *CorruptionError
+			if !errors.As(err, &corrupt) || (tc.wantErr != nil && !errors.Is(err, tc.wantErr)) {
+				t.Fatalf("expected a CorruptionError of %v, got %v", tc.wantErr, err)
+			}
+			if corrupt.Offset < 0 || corrupt.Offset > int64(len(tc.data)) {
+				t.Errorf("offset %d is outside of the container", corrupt.Offset)
+			}
+		})
+	}
+}
+
+func TestVerifyContainer_Parts(t *testing.T) {
+	codec, _ := Lookup("zstd")
+	texts := []string{strings.Repeat("first part ", 30), strings.Repeat("second part ", 30)}
+	data := joinTestParts(t, codec, texts)
+
+	// the checksums of the parts make up that of the trailer
+	if _, err := VerifyContainer(bytes.NewReader(data), false, nil); err != nil {
+		t.Fatalf("verify failed: %v", err)
+	}
+
+	header, err := ReadContainerHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read header failed: %v", err)
+	}
+	// damage the codec output of the second part
+	data[len(data)-containerTrailerLen-int(header.Metadata.Parts[1].Length)/2] ^= 0xff
+	_, err = VerifyContainer(bytes.NewReader(data), true, nil)
+	var corrupt *CorruptionError
+	if !errors.As(err, &corrupt) || corrupt.Part != 1 {
+		t.Errorf("expected the second part to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package compression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// ErrWasmLimit reports a WASM codec that ran out of time or memory.
+var ErrWasmLimit = errors.New("wasm codec exceeded its limits")
+
+// wasmPageSize is the size of a page of WebAssembly memory.
+const wasmPageSize = 64 << 10
+
+// WasmLimits bound every run of a WASM codec.
+type WasmLimits struct {
+	// MaxMemory is how large the memory of the module may grow, in bytes.
+	MaxMemory int64
+	// Timeout is how long one compression or decompression may take.
+	Timeout time.Duration
+}
+
+// DefaultWasmLimits are the limits of WASM codecs unless configured otherwise.
+var DefaultWasmLimits = WasmLimits{MaxMemory: 256 << 20, Timeout: 10 * time.Minute}
+
+// WasmCodec runs an untrusted codec compiled to WebAssembly (WASI preview 1)
+// in a sandbox. It is called like a PluginCodec, with the same arguments, its
+// input on stdin and its output on stdout, but it sees no files, network or
+// environment, and gets a fake clock. Every run starts from a fresh instance
+// of the module, within the memory and time of its limits.
+type WasmCodec struct {
+	name    string
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	limits  WasmLimits
+	// Level is passed on to the module, 0 leaves the choice to it.
+	Level int
+	ctx   context.Context
+}
+
+// NewWasmCodec compiles the WebAssembly module wasm into the codec name.
+func NewWasmCodec(ctx context.Context, name string, wasm []byte, limits WasmLimits) (WasmCodec, error) {
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return WasmCodec{}, fmt.Errorf("failed to set up WASI for %s: %w", name, err)
+	}
+	module, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return WasmCodec{}, fmt.Errorf("failed to compile %s: %w", name, err)
+	}
+	// WASI modules export their memory, which tells how much they need to start
+	memories := module.ExportedMemories()
+	if len(memories) == 0 {
+		runtime.Close(ctx)
+		return WasmCodec{}, fmt.Errorf("%s doesn't export its memory", name)
+	}
+	for _, memory := range memories {
+		if need := int64(memory.Min()) * wasmPageSize; need > limits.MaxMemory {
+			runtime.Close(ctx)
+			return WasmCodec{}, fmt.Errorf("%w: %s needs %d bytes of memory to start", ErrWasmLimit, name, need)
+		}
+	}
+	return WasmCodec{name: name, runtime: runtime, module: module, limits: limits}, nil
+}
+
+func (c WasmCodec) Name() string { return c.name }
+
+// WithLevel accepts any level, the module itself rejects those it doesn't
+// support when it is run.
+func (c WasmCodec) WithLevel(level int) (Codec, error) {
+	c.Level = level
+	return c, nil
+}
+
+// WithContext closes the instance of the module once ctx is done.
+func (c WasmCodec) WithContext(ctx context.Context) Codec {
+	c.ctx = ctx
+	return c
+}
+
+func (c WasmCodec) Compress(r io.Reader, w io.Writer) error {
+	return c.run("compress", r, w)
+}
+
+func (c WasmCodec) Decompress(r io.Reader, w io.Writer) error {
+	return c.run("decompress", r, w)
+}
+
+func (c WasmCodec) run(operation string, r io.Reader, w io.Writer) error {
+	parent := c.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, c.limits.Timeout)
+	defer cancel()
+	memory := &wasmMemory{max: uint64(c.limits.MaxMemory)}
+	ctx = experimental.WithMemoryAllocator(ctx, memory)
+
+	args := []string{c.name, operation}
+	if c.Level != 0 {
+		args = append(args, "--level", strconv.Itoa(c.Level))
+	}
+	stderr := &limitedBuffer{max: maxPluginStderr}
+	// without a name, the module can be instantiated by several runs at once
+	config := wazero.NewModuleConfig().WithName("").WithArgs(args...).
+		WithStdin(r).WithStdout(w).WithStderr(stderr)
+	module, err := c.runtime.InstantiateModule(ctx, c.module, config)
+	if module != nil {
+		module.Close(ctx)
+	}
+	if err == nil {
+		return nil
+	}
+	switch {
+	case parent.Err() != nil:
+		return fmt.Errorf("%s wasm codec stopped before it could %s: %w", c.name, operation, parent.Err())
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %s took longer than %s to %s", ErrWasmLimit, c.name, c.limits.Timeout, operation)
+	case memory.exceeded:
+		// whether the module traps or exits when its memory can't grow is
+		// up to it, the reason is the same
+		return fmt.Errorf("%w: %s needs more than %d bytes of memory to %s", ErrWasmLimit, c.name, c.limits.MaxMemory, operation)
+	}
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("%s wasm codec failed to %s: %w: %s", c.name, operation, err, msg)
+	}
+	return fmt.Errorf("%s wasm codec failed to %s: %w", c.name, operation, err)
+}
+
+// wasmMemory backs the memory of one run of a WASM codec and refuses to grow
+// it beyond max bytes, noting that it did. It allocates one memory only,
+// which is all a module can have.
+type wasmMemory struct {
+	buf      []byte
+	max      uint64
+	exceeded bool
+}
+
+func (m *wasmMemory) Allocate(capacity, _ uint64) experimental.LinearMemory {
+	m.buf = make([]byte, 0, min(capacity, m.max))
+	return m
+}
+
+func (m *wasmMemory) Reallocate(size uint64) []byte {
+	if size > m.max {
+		m.exceeded = true
+		return nil
+	}
+	if size > uint64(cap(m.buf)) {
+		buf := make([]byte, size, min(max(size, 2*uint64(cap(m.buf))), m.max))
+		copy(buf, m.buf)
+		m.buf = buf
+	}
+	m.buf = m.buf[:size]
+	return m.buf
+}
+
+func (m *wasmMemory) Free() {
+	m.buf = nil
+}
+
+// RegisterWasmCodecs registers the WASM codecs of spec, a comma-separated list
+// of name=path to a .wasm module, each run within limits.
+func RegisterWasmCodecs(ctx context.Context, spec string, limits WasmLimits) error {
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(entry, "=")
+		if name, path = strings.TrimSpace(name), strings.TrimSpace(path); !ok || name == "" || path == "" {
+			return fmt.Errorf("invalid wasm codec %q, expected name=path", entry)
+		}
+		if _, err := Lookup(name); err == nil {
+			return fmt.Errorf("wasm codec %s: a codec with that name is already registered", name)
+		}
+		wasm, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("wasm codec %s: %w", name, err)
+		}
+		codec, err := NewWasmCodec(ctx, name, wasm, limits)
+		if err != nil {
+			return err
+		}
+		Register(codec)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildWasmCodec compiles testdata/wasmcodec for wasip1.
+func buildWasmCodec(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building a wasm module takes a while")
+	}
+	path := filepath.Join(t.TempDir(), "wasmcodec.wasm")
+	cmd := exec.Command("go", "build", "-o", path, "./testdata/wasmcodec")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build the wasm codec: %v\n%s", err, out)
+	}
+	return path
+}
+
+func TestWasmCodec(t *testing.T) {
+	wasm, err := os.ReadFile(buildWasmCodec(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec, err := NewWasmCodec(context.Background(), "upper", wasm, WasmLimits{MaxMemory: 128 << 20, Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("NewWasmCodec failed: %v", err)
+	}
+
+	var compressed, decompressed bytes.Buffer
+	if err := codec.Compress(strings.NewReader("hello wasm"), &compressed); err != nil {
+		t.Fatalf("compress failed: %v", err)
+	}
+	if compressed.String() != "HELLO WASM" {
+		t.Errorf("expected the output of the module, got %q", compressed.String())
+	}
+	if err := codec.Decompress(&compressed, &decompressed); err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if decompressed.String() != "hello wasm" {
+		t.Errorf("expected round trip, got %q", decompressed.String())
+	}
+
+	testCases := []struct {
+		name      string
+		level     int
+		wantLimit bool
+		wantMsg   string
+	}{
+		{name: "level", level: 1},
+		{name: "invalid level", level: 9, wantMsg: "unsupported level 9"},
+		{name: "timeout", level: 2, wantLimit: true},
+		{name: "out of memory", level: 3, wantLimit: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			leveled, _ := WithLevel(codec, tc.level)
+			err := leveled.Compress(strings.NewReader("a"), io.Discard)
+			if errors.Is(err, ErrWasmLimit) != tc.wantLimit {
+				t.Errorf("expected ErrWasmLimit %v, got %v", tc.wantLimit, err)
+			}
+			if tc.wantMsg != "" && (err == nil || !strings.Contains(err.Error(), tc.wantMsg)) {
+				t.Errorf("expected %q in the error, got %v", tc.wantMsg, err)
+			}
+			if !tc.wantLimit && tc.wantMsg == "" && err != nil {
+				t.Errorf("expected success, got %v", err)
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		// level 2 spins until it is stopped
+		leveled, _ := WithLevel(codec, 2)
+		start := time.Now()
+		err := WithContext(ctx, leveled).Compress(strings.NewReader("a"), io.Discard)
+		if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrWasmLimit) {
+			t.Errorf("expected the run to stop with its context, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected the module to be closed before its own timeout, took %s", elapsed)
+		}
+	})
+}
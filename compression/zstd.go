@@ -0,0 +1,73 @@
+package compression
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdCodec trades the simplicity of Huffman for a much better ratio on real
+// world files.
+type ZstdCodec struct {
+	// Level is a zstd level from 1 to 22, 0 uses the encoder's default.
+	Level int
+	// Dict is a dictionary from TrainDictionary, needed on both ends.
+	Dict []byte
+}
+
+func init() {
+	Register(ZstdCodec{})
+}
+
+func (ZstdCodec) Name() string { return "zstd" }
+
+// WithLevel accepts the levels of the zstd command line tool, which the
+// encoder maps onto its four speed presets.
+func (c ZstdCodec) WithLevel(level int) (Codec, error) {
+	if level < 1 || level > 22 {
+		return nil, fmt.Errorf("%w: zstd takes 1 to 22, got %d", ErrUnsupportedLevel, level)
+	}
+	c.Level = level
+	return c, nil
+}
+
+func (c ZstdCodec) WithDictionary(dict []byte) (Codec, error) {
+	c.Dict = dict
+	return c, nil
+}
+
+func (c ZstdCodec) Compress(r io.Reader, w io.Writer) error {
+	var opts []zstd.EOption
+	if c.Level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+	}
+	if c.Dict != nil {
+		opts = append(opts, zstd.WithEncoderDict(c.Dict))
+	}
+	enc, err := zstd.NewWriter(w, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	if _, err := io.Copy(enc, r); err != nil {
+		enc.Close()
+		return fmt.Errorf("failed to zstd encode: %w", err)
+	}
+	return enc.Close()
+}
+
+func (c ZstdCodec) Decompress(r io.Reader, w io.Writer) error {
+	var opts []zstd.DOption
+	if c.Dict != nil {
+		opts = append(opts, zstd.WithDecoderDicts(c.Dict))
+	}
+	dec, err := zstd.NewReader(r, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer dec.Close()
+	if _, err := io.Copy(w, dec); err != nil {
+		return fmt.Errorf("failed to zstd decode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+)
+
+// benchInput is one input the codecs are run over.
+type benchInput struct {
+	name string
+	data []byte
+}
+
+// benchResult is the outcome of running one codec over one input.
+type benchResult struct {
+	compressed int
+	compress   time.Duration
+	decompress time.Duration
+	// allocs is the number of allocations of one round trip
+	allocs uint64
+}
+
+func benchCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	var algorithms, corpora, sizes, chunks string
+	var runs int
+	fs := newFlagSet("bench", "[file...]", stderr, &opts)
+	fs.StringVar(&algorithms, "algorithm", strings.Join(compression.Codecs(), ","), "comma-separated codecs to run")
+	fs.StringVar(&corpora, "corpus", strings.Join(compression.Corpora, ","), "comma-separated generated inputs, used when no file is given")
+	fs.StringVar(&sizes, "size", "64KB,1MB,16MB", "comma-separated sizes of the generated inputs")
+	fs.StringVar(&chunks, "chunks", "", "comma-separated chunk counts to run huffman with, instead of its default")
+	fs.IntVar(&runs, "runs", 3, "how often each codec runs over each input, the fastest run is reported")
+	files, err := parseArgs(fs, args, -1)
+	if err != nil {
+		return err
+	}
+	if runs < 1 {
+		return fmt.Errorf("-runs must be at least 1, got %d", runs)
+	}
+
+	codecs, err := benchCodecs(algorithms, chunks)
+	if err != nil {
+		return err
+	}
+	inputs, err := benchInputs(files, corpora, sizes)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "CODEC\tINPUT\tSIZE\tRATIO\tCOMPRESS MB/s\tDECOMPRESS MB/s\tALLOCS\t")
+	for _, input := range inputs {
+		for _, c := range codecs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			result, err := runBench(c.codec, input.data, runs)
+			if err != nil {
+				return fmt.Errorf("%s on %s: %w", c.name, input.name, err)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.3f\t%.1f\t%.1f\t%d\t\n",
+				c.name, input.name, formatSize(len(input.data)),
+				float64(result.compressed)/float64(max(len(input.data), 1)),
+				throughput(len(input.data), result.compress),
+				throughput(len(input.data), result.decompress),
+				result.allocs)
+		}
+	}
+	return tw.Flush()
+}
+
+type namedCodec struct {
+	name  string
+	codec compression.Codec
+}
+
+// benchCodecs looks up the codecs to run, Huffman once per chunk count.
+func benchCodecs(algorithms, chunks string) ([]namedCodec, error) {
+	var codecs []namedCodec
+	for _, name := range splitList(algorithms) {
+		codec, err := compression.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := codec.(compression.HuffmanCodec); !ok || chunks == "" {
+			codecs = append(codecs, namedCodec{name: name, codec: codec})
+			continue
+		}
+		for _, s := range splitList(chunks) {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid chunk count %q", s)
+			}
+			codecs = append(codecs, namedCodec{
+				name:  fmt.Sprintf("%s/%d", name, n),
+				codec: compression.HuffmanCodec{Chunks: n},
+			})
+		}
+	}
+	return codecs, nil
+}
+
+// benchInputs reads files, or generates every corpus in every size if there
+// are none.
+func benchInputs(files []string, corpora, sizes string) ([]benchInput, error) {
+	var inputs []benchInput
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, benchInput{name: filepath.Base(file), data: data})
+	}
+	if len(inputs) > 0 {
+		return inputs, nil
+	}
+	for _, kind := range splitList(corpora) {
+		for _, s := range splitList(sizes) {
+			size, err := parseSize(s)
+			if err != nil {
+				return nil, err
+			}
+			data, err := compression.Corpus(kind, size)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, benchInput{name: kind, data: data})
+		}
+	}
+	return inputs, nil
+}
+
+// runBench round trips data through codec runs times and keeps the fastest
+// times, which are the least disturbed by anything else on the machine.
+func runBench(codec compression.Codec, data []byte, runs int) (benchResult, error) {
+	var result benchResult
+	var compressed bytes.Buffer
+	for i := range runs {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		compressed.Reset()
+		start := time.Now()
+		if err := codec.Compress(bytes.NewReader(data), &compressed); err != nil {
+			return result, err
+		}
+		compress := time.Since(start)
+
+		start = time.Now()
+		if err := codec.Decompress(bytes.NewReader(compressed.Bytes()), io.Discard); err != nil {
+			return result, err
+		}
+		decompress := time.Since(start)
+
+		runtime.ReadMemStats(&after)
+		if i == 0 || compress < result.compress {
+			result.compress = compress
+		}
+		if i == 0 || decompress < result.decompress {
+			result.decompress = decompress
+		}
+		if allocs := after.Mallocs - before.Mallocs; i == 0 || allocs < result.allocs {
+			result.allocs = allocs
+		}
+	}
+	result.compressed = compressed.Len()
+	return result, nil
+}
+
+func throughput(size int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(size) / (1 << 20) / d.Seconds()
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size like 64KB or 16MB, in powers of 1024.
+func parseSize(s string) (int, error) {
+	upper := strings.ToUpper(s)
+	for _, unit := range sizeUnits {
+		if n, ok := strings.CutSuffix(upper, unit.suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return v * unit.size, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return v, nil
+}
+
+func formatSize(size int) string {
+	for _, unit := range sizeUnits {
+		if size >= unit.size && size%unit.size == 0 {
+			return strconv.Itoa(size/unit.size) + unit.suffix
+		}
+	}
+	return strconv.Itoa(size) + "B"
+}
+
+// splitList splits a comma-separated flag, dropping empty entries.
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
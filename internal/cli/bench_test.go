@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	code, stdout, stderr := run(t, "bench", "--size", "1KB", "--corpus", "text", "--runs", "1", "--algorithm", "zstd,huffman", "--chunks", "1,2")
+	if code != 0 {
+		t.Fatalf("bench exited with %d: %s", code, stderr)
+	}
+	for _, want := range []string{"zstd", "huffman/1", "huffman/2", "1KB"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in the results, got:\n%s", want, stdout)
+		}
+	}
+
+	// files replace the generated corpora
+	input := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(input, []byte(strings.Repeat("bench me\n", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, stderr = run(t, "bench", input, "--runs", "1", "--algorithm", "gzip")
+	if code != 0 {
+		t.Fatalf("bench exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "input.txt") || strings.Contains(stdout, "repetitive") {
+		t.Errorf("expected only input.txt in the results, got:\n%s", stdout)
+	}
+
+	if code, _, _ := run(t, "bench", "--algorithm", "nope"); code != 1 {
+		t.Errorf("expected exit code 1 for an unknown codec, got %d", code)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	testCases := map[string]int{
+		"512":  512,
+		"64KB": 64 << 10,
+		"16mb": 16 << 20,
+		"1GB":  1 << 30,
+	}
+	for s, want := range testCases {
+		got, err := parseSize(s)
+		if err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
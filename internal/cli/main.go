@@ -0,0 +1,622 @@
+// Package cli is cdc, the command line client of the platform. It submits
+// files to the manager and fetches their results, or with --local runs the
+// codecs on this machine without the cloud.
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/pkg/client"
+)
+
+const defaultServer = "http://localhost:8081"
+
+const usage = `Usage: cdc <command> [flags] <args>
+
+Commands:
+  compress [file]     compress a file, or stdin
+  decompress [file]   decompress a .ranran or .gz file, or stdin
+  status <job>        show the status of a job
+  download <job>      save the result of a finished job
+  cancel <job>        stop a job that hasn't finished
+  verify [file]       check a .ranran file for damage, without the cloud
+  bench [file...]     measure the codecs on this machine
+
+A file of "-" is stdin, and "-o -" writes the result to stdout. With
+--local, results of stdin go to stdout unless -o is given.
+
+Run "cdc <command> -h" for the flags of a command.
+`
+
+// errUsage is returned for bad arguments, after the usage has been printed.
+var errUsage = errors.New("invalid usage")
+
+// command runs one subcommand with the arguments that follow its name.
+type command func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+
+var commands = map[string]command{
+	"compress":   compressCommand,
+	"decompress": decompressCommand,
+	"status":     statusCommand,
+	"download":   downloadCommand,
+	"cancel":     cancelCommand,
+	"verify":     verifyCommand,
+	"bench":      benchCommand,
+}
+
+func Main() {
+	if err := compression.RegisterFromEnv(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "cdc: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := Run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// Run executes the command line args and returns the exit code.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "cdc: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	if err := cmd(ctx, args[1:], stdin, stdout, stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "cdc %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// options are the flags shared by the commands.
+type options struct {
+	server string
+	apiKey string
+	token  string
+	local  bool
+	output string
+}
+
+func newFlagSet(name, argsUsage string, stderr io.Writer, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: cdc %s [flags] %s\n\nFlags:\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	server := os.Getenv("CDC_SERVER")
+	if server == "" {
+		server = defaultServer
+	}
+	fs.StringVar(&opts.server, "server", server, "manager URL (env CDC_SERVER)")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("CDC_API_KEY"), "API key sent as X-API-Key (env CDC_API_KEY)")
+	fs.StringVar(&opts.token, "token", os.Getenv("CDC_TOKEN"), "bearer token of the manager's OIDC provider (env CDC_TOKEN)")
+	fs.StringVar(&opts.output, "o", "", `output file, "-" for stdout`)
+	return fs
+}
+
+// parseArgs parses args with fs, allowing flags after the positional
+// arguments, and checks that exactly want of those were given. A negative
+// want accepts any number.
+func parseArgs(fs *flag.FlagSet, args []string, want int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if want >= 0 && len(positional) != want {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+func compressCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	var algorithm string
+	var level int
+	var priority, notBefore, profile string
+	fs := newFlagSet("compress", "[file]", stderr, &opts)
+	fs.BoolVar(&opts.local, "local", false, "compress on this machine instead of submitting a job")
+	fs.StringVar(&algorithm, "algorithm", common.AlgorithmHuffman, "codec to use: "+strings.Join(compression.Codecs(), ", ")+", or auto to let the manager choose")
+	fs.IntVar(&level, "level", 0, "compression level, 0 for the codec default")
+	fs.StringVar(&profile, "profile", "", "profile of the manager picking the algorithm and level, e.g. fast, balanced or max")
+	fs.StringVar(&priority, "priority", "", "job priority: high, normal or low")
+	fs.StringVar(&notBefore, "not-before", "", "RFC 3339 time, or a delay like 2h, before which the job doesn't start")
+	file, err := parseInput(fs, args)
+	if err != nil {
+		return err
+	}
+	start, err := parseNotBefore(notBefore, time.Now())
+	if err != nil {
+		return err
+	}
+	if profile != "" {
+		if opts.local {
+			return errors.New("profiles are defined by the manager, --profile can't be used with --local")
+		}
+		// the profile picks the algorithm, unless one was given explicitly
+		explicit := false
+		fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "algorithm" })
+		if !explicit {
+			algorithm = ""
+		}
+	}
+
+	in, name, err := openInput(file, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if opts.local {
+		output := opts.output
+		if output == "" {
+			output = stdoutPath
+			if file != stdinPath {
+				output = file + common.AlgorithmExtension(algorithm)
+			}
+		}
+		if file == stdinPath {
+			// leave it to whoever decompresses it to name the result
+			name = ""
+		}
+		if err := compressLocal(in, name, output, stdout, algorithm, level); err != nil {
+			return err
+		}
+		printOutput(stdout, output)
+		return nil
+	}
+
+	jobID, err := newClient(opts).Compress(ctx, name, in, &client.CompressOptions{
+		Algorithm: algorithm,
+		Level:     level,
+		Profile:   profile,
+		Priority:  priority,
+		NotBefore: start,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, jobID)
+	return nil
+}
+
+func decompressCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	fs := newFlagSet("decompress", "[file]", stderr, &opts)
+	fs.BoolVar(&opts.local, "local", false, "decompress on this machine instead of submitting a job")
+	file, err := parseInput(fs, args)
+	if err != nil {
+		return err
+	}
+
+	in, name, err := openInput(file, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// the format of stdin can only be told from its first bytes
+	r := bufio.NewReader(in)
+	if file == stdinPath {
+		name, err = sniffName(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.local {
+		output, err := decompressLocal(r, file, name, opts.output, stdout)
+		if err != nil {
+			return err
+		}
+		printOutput(stdout, output)
+		return nil
+	}
+
+	jobID, err := newClient(opts).Decompress(ctx, name, r)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, jobID)
+	return nil
+}
+
+func statusCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	fs := newFlagSet("status", "<job>", stderr, &opts)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	job, err := newClient(opts).Job(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	printJob(stdout, job)
+	return nil
+}
+
+func printJob(stdout io.Writer, job *client.Job) {
+	fmt.Fprintf(stdout, "Job:       %s\n", job.ID)
+	fmt.Fprintf(stdout, "Operation: %s\n", job.Operation)
+	fmt.Fprintf(stdout, "Status:    %s\n", job.Status)
+	fmt.Fprintf(stdout, "File:      %s\n", job.FileName)
+	if job.Algorithm != "" {
+		fmt.Fprintf(stdout, "Algorithm: %s\n", job.Algorithm)
+	}
+	if !job.NotBefore.IsZero() {
+		fmt.Fprintf(stdout, "Starts:    %s\n", job.NotBefore.Local().Format("2006-01-02 15:04:05"))
+	}
+	if job.Error != "" {
+		fmt.Fprintf(stdout, "Error:     %s\n", job.Error)
+	}
+	fmt.Fprintf(stdout, "Updated:   %s\n", job.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+func downloadCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	fs := newFlagSet("download", "<job>", stderr, &opts)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	result, err := newClient(opts).Result(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+
+	output := opts.output
+	if output == "" {
+		output = positional[0]
+		// the name is chosen by the server, never write outside the working directory
+		if name, ok := baseName(result.Name); ok {
+			output = name
+		}
+	}
+	if err := writeOutput(output, stdout, func(w io.Writer) error {
+		_, err := io.Copy(w, result.Body)
+		return err
+	}); err != nil {
+		return err
+	}
+	printOutput(stdout, output)
+	return nil
+}
+
+func cancelCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	fs := newFlagSet("cancel", "<job>", stderr, &opts)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	job, err := newClient(opts).Cancel(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	printJob(stdout, job)
+	return nil
+}
+
+func verifyCommand(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	var opts options
+	var decode bool
+	var huffman string
+	fs := newFlagSet("verify", "[file]", stderr, &opts)
+	fs.BoolVar(&decode, "decode", false, "decode the data as well, to verify its checksum")
+	fs.StringVar(&huffman, "huffman", "", "print the code table of Huffman coded data instead, as json or dot")
+	file, err := parseInput(fs, args)
+	if err != nil {
+		return err
+	}
+	if huffman != "" && huffman != "json" && huffman != "dot" {
+		return fmt.Errorf("--huffman must be json or dot, not %q", huffman)
+	}
+
+	in, name, err := openInput(file, stdin)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if huffman != "" {
+		return printHuffman(stdout, in, name, huffman)
+	}
+	report, err := compression.VerifyContainer(bufio.NewReader(in), decode, nil)
+	if report != nil {
+		printReport(stdout, report)
+	}
+	if err == nil {
+		printChecksum(stdout, report, decode)
+	}
+	var corrupt *compression.CorruptionError
+	if errors.As(err, &corrupt) {
+		return fmt.Errorf("%s is damaged %w", file, err)
+	}
+	return err
+}
+
+// printHuffman prints the code tables of the Huffman coded data in r as JSON,
+// or as one Graphviz digraph per table. Files may come from the workers as
+// well as from --local, so the layout of those that don't record it is only
+// told from their body.
+func printHuffman(stdout io.Writer, r io.Reader, name, format string) error {
+	tables, err := compression.InspectHuffman(r, "")
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]any{"tables": tables})
+	}
+	for _, table := range tables {
+		graph := name
+		if table.Part > 0 {
+			graph = fmt.Sprintf("%s part %d", name, table.Part)
+		}
+		if err := table.WriteDOT(stdout, graph); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printReport(stdout io.Writer, report *compression.ContainerReport) {
+	header := report.Header
+	fmt.Fprintf(stdout, "Version:   %d\n", header.Version)
+	fmt.Fprintf(stdout, "Algorithm: %s\n", header.Algorithm)
+	if header.Metadata.Name != "" {
+		fmt.Fprintf(stdout, "Name:      %s\n", header.Metadata.Name)
+	}
+	if header.Metadata.Dictionary != "" {
+		fmt.Fprintf(stdout, "Dict:      %s\n", header.Metadata.Dictionary)
+	}
+	if header.Metadata.Archive {
+		fmt.Fprintf(stdout, "Members:   %d\n", len(header.Metadata.Members))
+	}
+	if len(header.Metadata.Parts) > 0 {
+		fmt.Fprintf(stdout, "Parts:     %d\n", len(header.Metadata.Parts))
+	}
+	if report.Size > 0 || report.PayloadLen > 0 {
+		fmt.Fprintf(stdout, "Payload:   %d bytes at %d\n", report.PayloadLen, report.PayloadOffset)
+		fmt.Fprintf(stdout, "Original:  %d bytes (crc %08x)\n", report.Size, report.CRC)
+	}
+}
+
+// printChecksum tells how far the checksum of a sound container was
+// verified.
+func printChecksum(stdout io.Writer, report *compression.ContainerReport, decode bool) {
+	header := report.Header
+	switch {
+	case report.Decoded:
+		fmt.Fprintln(stdout, "Checksum:  ok")
+	case len(header.Metadata.Parts) > 0:
+		fmt.Fprintln(stdout, "Checksum:  ok, from the parts")
+	case decode && header.Metadata.Dictionary != "":
+		fmt.Fprintln(stdout, "Checksum:  not verified, the dictionary is only known to the platform")
+	case !decode:
+		fmt.Fprintln(stdout, "Checksum:  not verified, run with --decode")
+	}
+}
+
+// parseNotBefore reads the --not-before flag, an RFC 3339 time or a delay
+// from now.
+func parseNotBefore(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if delay, err := time.ParseDuration(value); err == nil {
+		return now.Add(delay), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --not-before %q: expected an RFC 3339 time or a delay like 2h", value)
+	}
+	return t, nil
+}
+
+func newClient(opts options) *client.Client {
+	return client.New(opts.server, client.WithAPIKey(opts.apiKey), client.WithBearerToken(opts.token))
+}
+
+// stdinPath and stdoutPath stand for stdin and stdout in place of a file.
+const (
+	stdinPath  = "-"
+	stdoutPath = "-"
+)
+
+// parseInput parses args with fs, returning the one file given or stdinPath
+// when there is none.
+func parseInput(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseArgs(fs, args, -1)
+	if err != nil {
+		return "", err
+	}
+	switch len(positional) {
+	case 0:
+		return stdinPath, nil
+	case 1:
+		return positional[0], nil
+	}
+	fs.Usage()
+	return "", errUsage
+}
+
+// openInput opens file, or stdin for stdinPath, and returns the name the
+// data goes by.
+func openInput(file string, stdin io.Reader) (io.ReadCloser, string, error) {
+	if file == stdinPath {
+		return io.NopCloser(stdin), "stdin", nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, filepath.Base(file), nil
+}
+
+// sniffName names compressed data read from stdin by its format, which is
+// how the platform tells the formats apart.
+func sniffName(r *bufio.Reader) (string, error) {
+	magic, _ := r.Peek(len(compression.ContainerMagic))
+	switch {
+	case bytes.Equal(magic, compression.ContainerMagic):
+		return "stdin" + common.ContainerExtension, nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return "stdin.gz", nil
+	}
+	return "", fmt.Errorf("stdin is neither a %s container nor gzip", common.ContainerExtension)
+}
+
+// printOutput tells where a result went, unless it went to stdout.
+func printOutput(stdout io.Writer, output string) {
+	if output != stdoutPath {
+		fmt.Fprintln(stdout, output)
+	}
+}
+
+// compressLocal compresses in into output like a worker would, so the
+// result can be decompressed by the platform as well.
+func compressLocal(in io.Reader, name, output string, stdout io.Writer, algorithm string, level int) error {
+	codec, err := compression.Lookup(algorithm)
+	if err != nil {
+		return err
+	}
+	if codec, err = compression.WithLevel(codec, level); err != nil {
+		return err
+	}
+
+	return writeOutput(output, stdout, func(w io.Writer) error {
+		if !common.UsesContainer(algorithm) {
+			return codec.Compress(in, w)
+		}
+		zw := compression.NewWriterCodec(w, codec)
+		zw.Metadata.Name = name
+		if _, err := io.Copy(zw, in); err != nil {
+			return err
+		}
+		return zw.Close()
+	})
+}
+
+// decompressLocal decompresses in, read from input and named name, and
+// returns where the result went. Results of stdin go to stdout, others
+// default to the name stored in the container.
+func decompressLocal(in io.Reader, input, name, output string, stdout io.Writer) (string, error) {
+	algorithm, ok := common.AlgorithmFromFileName(name)
+	if !ok {
+		return "", fmt.Errorf("%s is neither a %s nor a .gz file", input, common.ContainerExtension)
+	}
+	if output == "" && input == stdinPath {
+		output = stdoutPath
+	}
+
+	if algorithm != "" {
+		codec, err := compression.Lookup(algorithm)
+		if err != nil {
+			return "", err
+		}
+		if output == "" {
+			output = strings.TrimSuffix(input, filepath.Ext(input))
+		}
+		return output, writeOutput(output, stdout, func(w io.Writer) error {
+			return codec.Decompress(in, w)
+		})
+	}
+
+	zr, err := compression.NewReader(in)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	if zr.Header.Metadata.Archive {
+		return "", errors.New("archives can only be decompressed by the platform")
+	}
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input))
+		// the container may come from anyone, only take the base of its name
+		if name, ok := baseName(zr.Header.Metadata.Name); ok {
+			output = filepath.Join(filepath.Dir(input), name)
+		}
+	}
+	return output, writeOutput(output, stdout, func(w io.Writer) error {
+		_, err := io.Copy(w, zr)
+		return err
+	})
+}
+
+// baseName strips any directories from a name chosen by someone else, and
+// reports whether a usable file name is left.
+func baseName(name string) (string, bool) {
+	name = filepath.Base(filepath.FromSlash(strings.ReplaceAll(name, "\\", "/")))
+	return name, name != "." && name != ".." && name != string(filepath.Separator)
+}
+
+// writeOutput is writeFile, but writes to stdout for stdoutPath.
+func writeOutput(path string, stdout io.Writer, write func(w io.Writer) error) error {
+	if path == stdoutPath {
+		return write(stdout)
+	}
+	return writeFile(path, write)
+}
+
+// writeFile creates path with the output of write, removing it again if
+// write fails so that no partial result is left behind.
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
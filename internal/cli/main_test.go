@@ -0,0 +1,326 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func run(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	return runInput(t, "", args...)
+}
+
+// runInput runs args with stdin as the standard input.
+func runInput(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+	testCases := []struct {
+		algorithm  string
+		level      string
+		compressed string
+	}{
+		{algorithm: "huffman", level: "0", compressed: "input.txt.ranran"},
+		{algorithm: "zstd", level: "3", compressed: "input.txt.ranran"},
+		{algorithm: "gzip", level: "9", compressed: "input.txt.gz"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "input.txt")
+			if err := os.WriteFile(input, []byte(text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// flags may follow the file
+			code, stdout, stderr := run(t, "compress", input, "--local", "--algorithm", tc.algorithm, "--level", tc.level)
+			if code != 0 {
+				t.Fatalf("compress exited with %d: %s", code, stderr)
+			}
+			compressed := filepath.Join(dir, tc.compressed)
+			if strings.TrimSpace(stdout) != compressed {
+				t.Errorf("expected compress to print %q, got %q", compressed, stdout)
+			}
+
+			os.Remove(input)
+			code, stdout, stderr = run(t, "decompress", "--local", compressed)
+			if code != 0 {
+				t.Fatalf("decompress exited with %d: %s", code, stderr)
+			}
+			if strings.TrimSpace(stdout) != input {
+				t.Errorf("expected decompress to print %q, got %q", input, stdout)
+			}
+			got, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != text {
+				t.Errorf("round trip mismatch: got %d bytes, want %d bytes", len(got), len(text))
+			}
+
+			// results are never overwritten
+			if code, _, _ := run(t, "decompress", "--local", compressed); code != 1 {
+				t.Errorf("expected decompressing onto an existing file to fail, got exit code %d", code)
+			}
+		})
+	}
+}
+
+func TestLocalPipe(t *testing.T) {
+	text := strings.Repeat("piped through cdc\n", 100)
+	for _, algorithm := range []string{"huffman", "zstd", "gzip"} {
+		t.Run(algorithm, func(t *testing.T) {
+			code, compressed, stderr := runInput(t, text, "compress", "--local", "--algorithm", algorithm)
+			if code != 0 {
+				t.Fatalf("compress exited with %d: %s", code, stderr)
+			}
+			code, stdout, stderr := runInput(t, compressed, "decompress", "--local", "-")
+			if code != 0 {
+				t.Fatalf("decompress exited with %d: %s", code, stderr)
+			}
+			if stdout != text {
+				t.Errorf("round trip mismatch: got %d bytes, want %d bytes", len(stdout), len(text))
+			}
+		})
+	}
+
+	t.Run("file to stdout", func(t *testing.T) {
+		input := filepath.Join(t.TempDir(), "input.txt")
+		if err := os.WriteFile(input, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		code, compressed, stderr := run(t, "compress", "--local", "-o", "-", input)
+		if code != 0 {
+			t.Fatalf("compress exited with %d: %s", code, stderr)
+		}
+		if !strings.HasPrefix(compressed, "RANR") {
+			t.Errorf("expected a container on stdout, got %q", compressed[:min(len(compressed), 16)])
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if code, _, stderr := runInput(t, "plain text", "decompress", "--local"); code != 1 || !strings.Contains(stderr, "neither") {
+			t.Errorf("expected stdin of an unknown format to fail, got exit code %d and %q", code, stderr)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte(strings.Repeat("verify me\n", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := run(t, "compress", "--local", "--algorithm", "zstd", input); code != 0 {
+		t.Fatalf("compress exited with %d: %s", code, stderr)
+	}
+	compressed := input + ".ranran"
+
+	code, stdout, stderr := run(t, "verify", "--decode", compressed)
+	if code != 0 {
+		t.Fatalf("verify exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Checksum:  ok") || !strings.Contains(stdout, "Original:  1000 bytes") {
+		t.Errorf("expected the checksum to be verified, got %q", stdout)
+	}
+
+	data, err := os.ReadFile(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	code, _, stderr = runInput(t, string(data), "verify", "--decode")
+	if code != 1 || !strings.Contains(stderr, "damaged at byte") {
+		t.Errorf("expected the damage to be located, got exit code %d and %q", code, stderr)
+	}
+}
+
+func TestVerifyHuffman(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("abracadabra"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := run(t, "compress", "--local", input); code != 0 {
+		t.Fatalf("compress exited with %d: %s", code, stderr)
+	}
+	compressed := input + ".ranran"
+
+	code, stdout, stderr := run(t, "verify", "--huffman", "json", compressed)
+	if code != 0 || !strings.Contains(stdout, `"char": "a",`) || !strings.Contains(stdout, `"frequency": 5,`) {
+		t.Errorf("expected the code table as JSON, got exit code %d and %q %q", code, stdout, stderr)
+	}
+	code, stdout, stderr = run(t, "verify", "--huffman", "dot", compressed)
+	if code != 0 || !strings.HasPrefix(stdout, `digraph "input.txt.ranran" {`) {
+		t.Errorf("expected the code tree as DOT, got exit code %d and %q %q", code, stdout, stderr)
+	}
+	if code, _, _ := run(t, "verify", "--huffman", "svg", compressed); code != 1 {
+		t.Errorf("expected an unknown format to fail, got exit code %d", code)
+	}
+}
+
+func TestParseNotBefore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "", want: time.Time{}},
+		{value: "2h", want: now.Add(2 * time.Hour)},
+		{value: "2025-06-02T03:00:00Z", want: time.Date(2025, 6, 2, 3, 0, 0, 0, time.UTC)},
+		{value: "tonight", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseNotBefore(tc.value, now)
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("parseNotBefore(%q): unexpected error %v", tc.value, err)
+		}
+		if !got.Equal(tc.want) {
+			t.Errorf("parseNotBefore(%q) = %v, expected %v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "no command", args: nil, wantCode: 2},
+		{name: "help", args: []string{"help"}, wantCode: 0},
+		{name: "unknown command", args: []string{"shrink", "file"}, wantCode: 2},
+		{name: "too many files", args: []string{"compress", "--local", "a", "b"}, wantCode: 2},
+		{name: "too many jobs", args: []string{"status", "a", "b"}, wantCode: 2},
+		{name: "unknown flag", args: []string{"download", "--nope", "a"}, wantCode: 2},
+		{name: "command help", args: []string{"status", "-h"}, wantCode: 0},
+		{name: "unknown extension", args: []string{"decompress", "--local", "file.txt"}, wantCode: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, _, _ := run(t, tc.args...); code != tc.wantCode {
+				t.Errorf("expected exit code %d, got %d", tc.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestRemoteCommands(t *testing.T) {
+	const apiKey = "secret"
+	var submitted struct {
+		path, algorithm, profile, fileName, content string
+	}
+	mux := http.NewServeMux()
+	submit := func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			common.WriteError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		submitted.path = r.URL.Path
+		submitted.algorithm = r.FormValue("algorithm")
+		submitted.profile = r.FormValue("profile")
+		submitted.fileName = header.Filename
+		submitted.content = string(content)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"job_id": "job-1"})
+	}
+	mux.HandleFunc("POST /v1/compress", submit)
+	mux.HandleFunc("POST /v1/decompress", submit)
+	mux.HandleFunc("GET /v1/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "job-1" {
+			common.WriteError(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(common.Job{ID: "job-1", Operation: common.OperationCompress, Status: common.JobDone, FileName: "input.txt"})
+	})
+	mux.HandleFunc("GET /v1/jobs/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../input.txt.ranran"`)
+		io.WriteString(w, "compressed")
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != apiKey {
+			common.WriteError(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("CDC_SERVER", server.URL)
+	t.Setenv("CDC_API_KEY", apiKey)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := run(t, "compress", "--algorithm", "zstd", input)
+	if code != 0 {
+		t.Fatalf("compress exited with %d: %s", code, stderr)
+	}
+	if strings.TrimSpace(stdout) != "job-1" {
+		t.Errorf("expected the job ID, got %q", stdout)
+	}
+	if submitted.path != "/v1/compress" || submitted.algorithm != "zstd" || submitted.fileName != "input.txt" || submitted.content != "hello" {
+		t.Errorf("unexpected submission: %+v", submitted)
+	}
+
+	// the profile picks the algorithm
+	code, _, stderr = run(t, "compress", "--profile", "fast", input)
+	if code != 0 {
+		t.Fatalf("compress exited with %d: %s", code, stderr)
+	}
+	if submitted.profile != "fast" || submitted.algorithm != "" {
+		t.Errorf("expected only the profile to be submitted, got %+v", submitted)
+	}
+
+	code, stdout, stderr = run(t, "status", "job-1")
+	if code != 0 {
+		t.Fatalf("status exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "DONE") {
+		t.Errorf("expected the status in the output, got %q", stdout)
+	}
+
+	code, _, stderr = run(t, "status", "job-2")
+	if code != 1 || !strings.Contains(stderr, "Job not found") {
+		t.Errorf("expected the server error, got exit code %d and %q", code, stderr)
+	}
+
+	code, _, stderr = run(t, "status", "--api-key", "wrong", "job-1")
+	if code != 1 || !strings.Contains(stderr, "401") {
+		t.Errorf("expected the --api-key flag to override the environment, got exit code %d and %q", code, stderr)
+	}
+
+	// the suggested name must not escape the working directory
+	t.Chdir(dir)
+	code, stdout, stderr = run(t, "download", "job-1")
+	if code != 0 {
+		t.Fatalf("download exited with %d: %s", code, stderr)
+	}
+	if strings.TrimSpace(stdout) != "input.txt.ranran" {
+		t.Errorf("expected the result to be saved as input.txt.ranran, got %q", stdout)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "input.txt.ranran")); string(got) != "compressed" {
+		t.Errorf("unexpected result content %q", got)
+	}
+}
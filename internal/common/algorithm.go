@@ -0,0 +1,43 @@
+package common
+
+import "strings"
+
+const (
+	AlgorithmHuffman  = "huffman"
+	AlgorithmZstd     = "zstd"
+	AlgorithmGzip     = "gzip"
+	AlgorithmAdaptive = "adaptive"
+	AlgorithmStore    = "store"
+	// AlgorithmAuto lets the manager pick one of the others for each file
+	// from its content.
+	AlgorithmAuto = "auto"
+)
+
+const ContainerExtension = ".ranran"
+
+// UsesContainer reports whether the algorithm's output is wrapped in a .ranran
+// container. gzip output is kept as a standard .gz so any tool can read it.
+func UsesContainer(algorithm string) bool {
+	return algorithm != AlgorithmGzip
+}
+
+// AlgorithmExtension returns the file extension of the algorithm's output.
+func AlgorithmExtension(algorithm string) string {
+	if UsesContainer(algorithm) {
+		return ContainerExtension
+	}
+	return ".gz"
+}
+
+// AlgorithmFromFileName detects how a compressed file has to be decoded.
+// Containers name their algorithm in the header, so .ranran files report an
+// empty algorithm.
+func AlgorithmFromFileName(fileName string) (string, bool) {
+	switch {
+	case strings.HasSuffix(fileName, ContainerExtension):
+		return "", true
+	case strings.HasSuffix(fileName, ".gz"):
+		return AlgorithmGzip, true
+	}
+	return "", false
+}
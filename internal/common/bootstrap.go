@@ -0,0 +1,193 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Resources are the topics, subscriptions and bucket a manager or worker
+// needs to exist before it can run.
+type Resources struct {
+	Bucket        string
+	Topics        []string
+	Subscriptions []SubscriptionResource
+}
+
+// SubscriptionResource is a pull subscription of Topic. With DeadLetterTopic
+// set, Pub/Sub forwards its messages there after MaxDeliveryAttempts.
+type SubscriptionResource struct {
+	ID, Topic           string
+	DeadLetterTopic     string
+	MaxDeliveryAttempts int
+}
+
+// Bootstrap creates the resources that don't exist yet, leaving existing
+// ones as they are, so a fresh project fails on missing permissions rather
+// than on the first message. Only Pub/Sub and GCS are bootstrapped; other
+// backends are left to be set up by hand. A new bucket is created in
+// GCS_BUCKET_LOCATION (default US) and aborts uploads left incomplete for a
+// day; with BUCKET_OBJECT_TTL set it also deletes objects that much older,
+// rounded up to days, as a backstop to the janitor.
+func Bootstrap(ctx context.Context, res Resources) error {
+	project := os.Getenv("GCP_PROJECT_ID")
+	if backend := os.Getenv("QUEUE_BACKEND"); backend == "" || backend == "pubsub" {
+		client, err := pubsub.NewClient(ctx, project)
+		if err != nil {
+			return fmt.Errorf("cannot create Pub/Sub client: %w", err)
+		}
+		defer client.Close()
+		admin := pubsubAdmin{
+			project: client.Project(),
+			createTopic: func(ctx context.Context, topic *pubsubpb.Topic) error {
+				_, err := client.TopicAdminClient.CreateTopic(ctx, topic)
+				return err
+			},
+			createSubscription: func(ctx context.Context, sub *pubsubpb.Subscription) error {
+				_, err := client.SubscriptionAdminClient.CreateSubscription(ctx, sub)
+				return err
+			},
+		}
+		if err := admin.bootstrap(ctx, res); err != nil {
+			return err
+		}
+	} else {
+		slog.Info("Not bootstrapping topics and subscriptions of this queue backend", "backend", backend)
+	}
+
+	if res.Bucket == "" {
+		return nil
+	}
+	if backend := os.Getenv("STORAGE_BACKEND"); backend != "" && backend != "gcs" {
+		slog.Info("Not bootstrapping the bucket of this storage backend", "backend", backend)
+		return nil
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot create GCS client: %w", err)
+	}
+	defer client.Close()
+	attrs := bucketAttrs(os.Getenv("GCS_BUCKET_LOCATION"), GetEnvDuration("BUCKET_OBJECT_TTL", 0))
+	return bootstrapBucket(ctx, res.Bucket, attrs, func(ctx context.Context, attrs *storage.BucketAttrs) error {
+		return client.Bucket(res.Bucket).Create(ctx, project, attrs)
+	})
+}
+
+// pubsubAdmin creates topics and subscriptions of project.
+type pubsubAdmin struct {
+	project            string
+	createTopic        func(context.Context, *pubsubpb.Topic) error
+	createSubscription func(context.Context, *pubsubpb.Subscription) error
+}
+
+// bootstrap creates the topics first, so that subscriptions and their dead
+// letter policies have topics to refer to.
+func (a pubsubAdmin) bootstrap(ctx context.Context, res Resources) error {
+	topics := map[string]bool{}
+	for _, topic := range res.Topics {
+		topics[topic] = true
+	}
+	for _, sub := range res.Subscriptions {
+		topics[sub.Topic] = true
+		if sub.DeadLetterTopic != "" {
+			topics[sub.DeadLetterTopic] = true
+		}
+	}
+	delete(topics, "")
+	for topic := range topics {
+		err := a.createTopic(ctx, &pubsubpb.Topic{Name: a.topicName(topic)})
+		if err := created("topic", topic, err); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range res.Subscriptions {
+		if sub.ID == "" || sub.Topic == "" {
+			continue
+		}
+		spec := &pubsubpb.Subscription{
+			Name:  fmt.Sprintf("projects/%s/subscriptions/%s", a.project, sub.ID),
+			Topic: a.topicName(sub.Topic),
+		}
+		if sub.DeadLetterTopic != "" {
+			spec.DeadLetterPolicy = &pubsubpb.DeadLetterPolicy{
+				DeadLetterTopic: a.topicName(sub.DeadLetterTopic),
+				// Pub/Sub takes between 5 and 100 attempts
+				MaxDeliveryAttempts: int32(min(max(sub.MaxDeliveryAttempts, 5), 100)),
+			}
+		}
+		err := a.createSubscription(ctx, spec)
+		if err := created("subscription", sub.ID, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a pubsubAdmin) topicName(topic string) string {
+	return fmt.Sprintf("projects/%s/topics/%s", a.project, topic)
+}
+
+// created logs what happened to a resource, treating one that already exists
+// as created.
+func created(kind, name string, err error) error {
+	switch {
+	case err == nil:
+		slog.Info("Created "+kind, kind, name)
+	case status.Code(err) == codes.AlreadyExists:
+		slog.Debug("The "+kind+" already exists", kind, name)
+	default:
+		return fmt.Errorf("cannot create %s %s: %w", kind, name, err)
+	}
+	return nil
+}
+
+// bucketAttrs is how a bucket is created, see Bootstrap.
+func bucketAttrs(location string, ttl time.Duration) *storage.BucketAttrs {
+	if location == "" {
+		location = "US"
+	}
+	attrs := &storage.BucketAttrs{
+		Location:                 location,
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+		Lifecycle: storage.Lifecycle{Rules: []storage.LifecycleRule{{
+			Action:    storage.LifecycleAction{Type: storage.AbortIncompleteMPUAction},
+			Condition: storage.LifecycleCondition{AgeInDays: 1},
+		}}},
+	}
+	if ttl > 0 {
+		days := int64((ttl + 24*time.Hour - 1) / (24 * time.Hour))
+		attrs.Lifecycle.Rules = append(attrs.Lifecycle.Rules, storage.LifecycleRule{
+			Action:    storage.LifecycleAction{Type: storage.DeleteAction},
+			Condition: storage.LifecycleCondition{AgeInDays: days},
+		})
+	}
+	return attrs
+}
+
+// bootstrapBucket creates bucket unless it exists, in which case its
+// settings are left alone.
+func bootstrapBucket(ctx context.Context, bucket string, attrs *storage.BucketAttrs, create func(context.Context, *storage.BucketAttrs) error) error {
+	err := create(ctx, attrs)
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict {
+		slog.Debug("The bucket already exists", "bucket", bucket)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot create bucket %s: %w", bucket, err)
+	}
+	slog.Info("Created bucket", "bucket", bucket, "location", attrs.Location)
+	return nil
+}
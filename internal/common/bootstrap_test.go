@@ -0,0 +1,105 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBootstrapPubSub(t *testing.T) {
+	existing := map[string]bool{"projects/p/topics/compress": true}
+	topics := map[string]bool{}
+	subs := map[string]*pubsubpb.Subscription{}
+	admin := pubsubAdmin{
+		project: "p",
+		createTopic: func(ctx context.Context, topic *pubsubpb.Topic) error {
+			if existing[topic.Name] || topics[topic.Name] {
+				return status.Error(codes.AlreadyExists, "topic exists")
+			}
+			topics[topic.Name] = true
+			return nil
+		},
+		createSubscription: func(ctx context.Context, sub *pubsubpb.Subscription) error {
+			if !existing[sub.Topic] && !topics[sub.Topic] {
+				t.Errorf("Subscription %s created before its topic", sub.Name)
+			}
+			subs[sub.Name] = sub
+			return nil
+		},
+	}
+
+	err := admin.bootstrap(context.Background(), Resources{
+		Topics: []string{"compress", "status", ""},
+		Subscriptions: []SubscriptionResource{
+			{ID: "compress-sub", Topic: "compress", DeadLetterTopic: "dead-letter", MaxDeliveryAttempts: 200},
+			{ID: "decompress-sub", Topic: "decompress"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Bootstrap failed: %v", err)
+	}
+	for _, topic := range []string{"status", "dead-letter", "decompress"} {
+		if !topics["projects/p/topics/"+topic] {
+			t.Errorf("Expected topic %s to be created", topic)
+		}
+	}
+	if len(topics) != 3 {
+		t.Errorf("Expected only the missing topics to be created, got %v", topics)
+	}
+
+	sub := subs["projects/p/subscriptions/compress-sub"]
+	if sub == nil || sub.DeadLetterPolicy == nil {
+		t.Fatalf("Expected compress-sub with a dead letter policy, got %v", sub)
+	}
+	if sub.DeadLetterPolicy.DeadLetterTopic != "projects/p/topics/dead-letter" || sub.DeadLetterPolicy.MaxDeliveryAttempts != 100 {
+		t.Errorf("Unexpected dead letter policy: %v", sub.DeadLetterPolicy)
+	}
+	if sub := subs["projects/p/subscriptions/decompress-sub"]; sub == nil || sub.DeadLetterPolicy != nil {
+		t.Errorf("Expected decompress-sub without a dead letter policy, got %v", sub)
+	}
+
+	admin.createTopic = func(ctx context.Context, topic *pubsubpb.Topic) error {
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+	if err := admin.bootstrap(context.Background(), Resources{Topics: []string{"compress"}}); status.Code(errors.Unwrap(err)) != codes.PermissionDenied {
+		t.Errorf("Expected the permission error, got %v", err)
+	}
+}
+
+func TestBootstrapBucket(t *testing.T) {
+	attrs := bucketAttrs("", 36*time.Hour)
+	if attrs.Location != "US" || len(attrs.Lifecycle.Rules) != 2 || attrs.Lifecycle.Rules[1].Condition.AgeInDays != 2 {
+		t.Errorf("Unexpected bucket attributes: %+v", attrs)
+	}
+	if attrs := bucketAttrs("EU", 0); attrs.Location != "EU" || len(attrs.Lifecycle.Rules) != 1 {
+		t.Errorf("Expected no delete rule without a TTL, got %+v", attrs.Lifecycle)
+	}
+
+	testCases := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "created"},
+		{name: "exists", err: &googleapi.Error{Code: http.StatusConflict}},
+		{name: "denied", err: &googleapi.Error{Code: http.StatusForbidden}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := bootstrapBucket(context.Background(), "b", attrs, func(context.Context, *storage.BucketAttrs) error {
+				return tc.err
+			})
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Expected error %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+)
+
+// ErrCircuitOpen is returned instead of calling a dependency that has been
+// failing, until it has had time to recover.
+var ErrCircuitOpen = NewError(ErrUnavailable, "circuit open")
+
+// CircuitBreaker stops calls to a dependency once too many of them fail. It
+// opens when at least MinCalls calls were made in the current Window and
+// FailureRatio of them failed. After Cooldown one call is let through to
+// probe the dependency, closing the breaker if it succeeds and opening it
+// for another Cooldown if it doesn't.
+type CircuitBreaker struct {
+	Name         string
+	FailureRatio float64
+	MinCalls     int
+	Window       time.Duration
+	Cooldown     time.Duration
+	// IsFailure tells failures of the dependency from errors it answers
+	// with, like missing objects.
+	IsFailure func(error) bool
+
+	mu              sync.Mutex
+	windowStart     time.Time
+	calls, failures int
+	openUntil       time.Time
+	probing         bool
+}
+
+// NewCircuitBreaker reads the limits of a breaker from BREAKER_FAILURE_PERCENT
+// (0 turns breakers off), BREAKER_MIN_CALLS, BREAKER_WINDOW and
+// BREAKER_COOLDOWN.
+func NewCircuitBreaker(name string, isFailure func(error) bool) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:         name,
+		FailureRatio: float64(GetEnvInt("BREAKER_FAILURE_PERCENT", 50)) / 100,
+		MinCalls:     GetEnvInt("BREAKER_MIN_CALLS", 20),
+		Window:       GetEnvDuration("BREAKER_WINDOW", time.Minute),
+		Cooldown:     GetEnvDuration("BREAKER_COOLDOWN", 30*time.Second),
+		IsFailure:    isFailure,
+	}
+}
+
+// Allow returns ErrCircuitOpen if a call must not be made now. A call that
+// is allowed has to be followed by Record.
+func (b *CircuitBreaker) Allow() error {
+	if b.FailureRatio <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return fmt.Errorf("%s: %w", b.Name, ErrCircuitOpen)
+	}
+	// a probe that never reports back is given up on after another cooldown
+	b.openUntil, b.probing = now.Add(b.Cooldown), true
+	return nil
+}
+
+// Record counts the outcome of a call.
+func (b *CircuitBreaker) Record(err error) {
+	if b.FailureRatio <= 0 {
+		return
+	}
+	failed := err != nil && b.IsFailure(err)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if !b.openUntil.IsZero() {
+		if !b.probing {
+			// a call made before the breaker opened
+			return
+		}
+		b.probing = false
+		if failed {
+			b.openUntil = now.Add(b.Cooldown)
+			slog.Warn("Circuit stays open", "dependency", b.Name, "error", err)
+			return
+		}
+		b.openUntil, b.windowStart, b.calls, b.failures = time.Time{}, now, 0, 0
+		slog.Info("Circuit closed", "dependency", b.Name)
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.Window {
+		b.windowStart, b.calls, b.failures = now, 0, 0
+	}
+	b.calls++
+	if failed {
+		b.failures++
+	}
+	if b.calls >= b.MinCalls && float64(b.failures) >= b.FailureRatio*float64(b.calls) {
+		b.openUntil = now.Add(b.Cooldown)
+		slog.Warn("Circuit opened", "dependency", b.Name, "calls", b.calls, "failures", b.failures, "error", err)
+	}
+}
+
+// Do makes call unless the breaker is open, and counts its outcome.
+func (b *CircuitBreaker) Do(call func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := call()
+	b.Record(err)
+	return err
+}
+
+// Open reports whether calls are being refused.
+func (b *CircuitBreaker) Open() bool {
+	return b.RetryAfter() > 0
+}
+
+// RetryAfter is how long calls are refused for still.
+func (b *CircuitBreaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return 0
+	}
+	return max(time.Until(b.openUntil), 0)
+}
+
+// circuitBreaking is a dependency guarded by a breaker.
+type circuitBreaking interface {
+	CircuitBreaker() *CircuitBreaker
+}
+
+// OpenCircuit returns the breaker of the first of deps that is refusing
+// calls, or nil if none is. Dependencies without a breaker are skipped.
+func OpenCircuit(deps ...any) *CircuitBreaker {
+	for _, dep := range deps {
+		if c, ok := dep.(circuitBreaking); ok && c.CircuitBreaker().Open() {
+			return c.CircuitBreaker()
+		}
+	}
+	return nil
+}
+
+// BreakerStorage guards a StorageBackend with a breaker counting the
+// failures IsRetryable recognizes, after any retries.
+type BreakerStorage struct {
+	StorageBackend
+	Breaker *CircuitBreaker
+}
+
+// NewBreakerStorage wraps backend in a breaker named "storage".
+func NewBreakerStorage(backend StorageBackend) *BreakerStorage {
+	return &BreakerStorage{StorageBackend: backend, Breaker: NewCircuitBreaker("storage", IsRetryable)}
+}
+
+func (s *BreakerStorage) CircuitBreaker() *CircuitBreaker { return s.Breaker }
+
+func (s *BreakerStorage) NewObjectReader(ctx context.Context, bucket, object string) (ObjectReaderInterface, error) {
+	var r ObjectReaderInterface
+	err := s.Breaker.Do(func() error {
+		var err error
+		r, err = s.StorageBackend.NewObjectReader(ctx, bucket, object)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &breakerReader{ObjectReaderInterface: r, b: s.Breaker}, nil
+}
+
+func (s *BreakerStorage) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (ObjectReaderInterface, error) {
+	var r ObjectReaderInterface
+	err := s.Breaker.Do(func() error {
+		var err error
+		r, err = s.StorageBackend.NewRangeReader(ctx, bucket, object, offset, length)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &breakerReader{ObjectReaderInterface: r, b: s.Breaker}, nil
+}
+
+func (s *BreakerStorage) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := s.Breaker.Do(func() error {
+		var err error
+		info, err = s.StorageBackend.StatObject(ctx, bucket, object)
+		return err
+	})
+	return info, err
+}
+
+func (s *BreakerStorage) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := s.Breaker.Do(func() error {
+		var err error
+		objects, err = s.StorageBackend.ListObjects(ctx, bucket, prefix)
+		return err
+	})
+	return objects, err
+}
+
+func (s *BreakerStorage) DeleteObject(ctx context.Context, bucket, object string) error {
+	return s.Breaker.Do(func() error {
+		return s.StorageBackend.DeleteObject(ctx, bucket, object)
+	})
+}
+
+func (s *BreakerStorage) NewObjectWriter(ctx context.Context, bucket, object string, opts ...ObjectWriterOption) ObjectWriterInterface {
+	if err := s.Breaker.Allow(); err != nil {
+		return &breakerWriter{err: err}
+	}
+	return &breakerWriter{w: s.StorageBackend.NewObjectWriter(ctx, bucket, object, opts...), b: s.Breaker}
+}
+
+// breakerReader counts reads that fail once the object is open as failed
+// calls too.
+type breakerReader struct {
+	ObjectReaderInterface
+	b *CircuitBreaker
+}
+
+func (r *breakerReader) Read(p []byte) (int, error) {
+	n, err := r.ObjectReaderInterface.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		r.b.Record(err)
+	}
+	return n, err
+}
+
+// breakerWriter counts a write as a call when it is closed, or refuses it
+// altogether when err is set.
+type breakerWriter struct {
+	w   ObjectWriterInterface
+	b   *CircuitBreaker
+	err error
+}
+
+func (w *breakerWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.w.Write(p)
+}
+
+func (w *breakerWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	err := w.w.Close()
+	w.b.Record(err)
+	return err
+}
+
+// BreakerQueue guards publishing to a QueueInterface with a breaker named
+// "queue". Receiving isn't guarded, it only waits for messages.
+type BreakerQueue struct {
+	QueueInterface
+	Breaker *CircuitBreaker
+}
+
+// NewBreakerQueue wraps queue in a breaker counting every publish that fails
+// other than by being canceled.
+func NewBreakerQueue(queue QueueInterface) *BreakerQueue {
+	return &BreakerQueue{QueueInterface: queue, Breaker: NewCircuitBreaker("queue", func(err error) bool {
+		return !errors.Is(err, context.Canceled)
+	})}
+}
+
+func (q *BreakerQueue) CircuitBreaker() *CircuitBreaker { return q.Breaker }
+
+func (q *BreakerQueue) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
+	var id string
+	err := q.Breaker.Do(func() error {
+		var err error
+		id, err = q.QueueInterface.PublishMessage(ctx, topicID, msg)
+		return err
+	})
+	return id, err
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testBreaker() *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:         "storage",
+		FailureRatio: 0.5,
+		MinCalls:     4,
+		Window:       time.Minute,
+		Cooldown:     20 * time.Millisecond,
+		IsFailure:    IsRetryable,
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := testBreaker()
+	// missing objects are answers, not failures
+	for range 4 {
+		b.Record(ErrObjectNotExist)
+	}
+	if b.Open() {
+		t.Fatal("Expected answers not to open the breaker")
+	}
+	b.Record(nil)
+	for range 2 {
+		b.Record(errUnavailable)
+	}
+	if b.Open() {
+		t.Fatal("Expected 2 failures of 7 calls not to open the breaker")
+	}
+	for range 5 {
+		b.Record(errUnavailable)
+	}
+	if !b.Open() {
+		t.Fatal("Expected 7 failures of 12 calls to open the breaker")
+	}
+	called := false
+	if err := b.Do(func() error { called = true; return nil }); !errors.Is(err, ErrCircuitOpen) || called {
+		t.Fatalf("Expected the call to be refused, got %v", err)
+	}
+	if Classify(ErrCircuitOpen) != ErrUnavailable || IsPermanent(ErrCircuitOpen) {
+		t.Error("Expected an open circuit to be unavailable for a while")
+	}
+
+	// a failed probe keeps it open, a successful one closes it
+	time.Sleep(b.Cooldown)
+	if err := b.Do(func() error { return errUnavailable }); !errors.Is(err, errUnavailable) || !b.Open() {
+		t.Fatalf("Expected the probe to be made and fail, got %v", err)
+	}
+	time.Sleep(b.Cooldown)
+	if err := b.Do(func() error { return nil }); err != nil || b.Open() {
+		t.Fatalf("Expected the probe to close the breaker, got %v", err)
+	}
+}
+
+func TestBreakerStorage(t *testing.T) {
+	backend := &flakyStorage{objects: map[string][]byte{"a": []byte("data")}, fail: 4}
+	s := &BreakerStorage{StorageBackend: backend, Breaker: testBreaker()}
+	if OpenCircuit(s) != nil {
+		t.Fatal("Expected no open circuit")
+	}
+	ctx := context.Background()
+	for range 4 {
+		s.StatObject(ctx, "bucket", "a")
+	}
+	if OpenCircuit(backend, s) != s.Breaker {
+		t.Fatal("Expected the storage circuit to be open")
+	}
+	w := s.NewObjectWriter(ctx, "bucket", "b")
+	if _, err := w.Write([]byte("data")); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the write to be refused, got %v", err)
+	}
+	if _, err := s.NewObjectReader(ctx, "bucket", "a"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the read to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ErrObjectChecksum is returned by the readers of ChecksumStorage when the
+// bytes read don't have the checksum storage keeps for the object.
+var ErrObjectChecksum = errors.New("object checksum mismatch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumStorage verifies whole objects read from a StorageBackend against
+// the CRC32C storage keeps for them, see ObjectInfo. The client libraries
+// only do so for reads they made in one go, not for those RetryingStorage
+// resumed. A read that doesn't match fails at the end instead of returning
+// io.EOF, so the corrupted bytes are never taken for the object. Ranges and
+// objects without a CRC32C, like those in S3, are read unchecked.
+type ChecksumStorage struct {
+	StorageBackend
+}
+
+// NewChecksumStorage wraps backend to verify what is read from it.
+func NewChecksumStorage(backend StorageBackend) *ChecksumStorage {
+	return &ChecksumStorage{StorageBackend: backend}
+}
+
+func (s *ChecksumStorage) NewObjectReader(ctx context.Context, bucket, object string) (ObjectReaderInterface, error) {
+	info, err := s.StorageBackend.StatObject(ctx, bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.StorageBackend.NewObjectReader(ctx, bucket, object)
+	if err != nil || !info.HasCRC32C {
+		return r, err
+	}
+	return &checksumReader{r: r, object: object, version: info.Version, want: info.CRC32C, crc: crc32.New(castagnoli)}, nil
+}
+
+func (s *ChecksumStorage) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (ObjectReaderInterface, error) {
+	if offset == 0 && length < 0 {
+		return s.NewObjectReader(ctx, bucket, object)
+	}
+	return s.StorageBackend.NewRangeReader(ctx, bucket, object, offset, length)
+}
+
+// checksumReader hashes what it reads and compares the sum at the end.
+type checksumReader struct {
+	r       ObjectReaderInterface
+	object  string
+	version string
+	want    uint32
+	crc     hash.Hash32
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.crc.Write(p[:n])
+	if err == io.EOF && r.crc.Sum32() != r.want {
+		return n, fmt.Errorf("%w: %s (version %s) read with crc32c %08x, storage has %08x",
+			ErrObjectChecksum, r.object, r.version, r.crc.Sum32(), r.want)
+	}
+	return n, err
+}
+
+func (r *checksumReader) Close() error {
+	return r.r.Close()
+}
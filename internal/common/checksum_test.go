@@ -0,0 +1,88 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+)
+
+// checksummedStorage reports the CRC32C of sums rather than of the objects,
+// as a read corrupted on the way would look.
+type checksummedStorage struct {
+	*flakyStorage
+	sums map[string]string
+}
+
+func (s *checksummedStorage) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	info, err := s.flakyStorage.StatObject(ctx, bucket, object)
+	if sum, ok := s.sums[object]; ok {
+		info.CRC32C, info.HasCRC32C = crc32.Checksum([]byte(sum), castagnoli), true
+	}
+	return info, err
+}
+
+func TestChecksumStorage(t *testing.T) {
+	content := strings.Repeat("checksummed ", 1000)
+	backend := &checksummedStorage{
+		flakyStorage: &flakyStorage{objects: map[string][]byte{
+			"intact":    []byte(content),
+			"corrupted": []byte(content),
+			"unchecked": []byte(content),
+		}},
+		sums: map[string]string{"intact": content, "corrupted": content + "!"},
+	}
+	s := NewChecksumStorage(NewRetryingStorage(backend, RetryPolicy{MaxAttempts: 3}))
+
+	testCases := []struct {
+		name    string
+		object  string
+		open    func(object string) (ObjectReaderInterface, error)
+		wantErr error
+	}{
+		{name: "intact", object: "intact"},
+		{name: "corrupted", object: "corrupted", wantErr: ErrObjectChecksum},
+		{name: "without checksum", object: "unchecked"},
+		{name: "whole range", object: "corrupted", wantErr: ErrObjectChecksum, open: func(object string) (ObjectReaderInterface, error) {
+			return s.NewRangeReader(context.Background(), "b", object, 0, -1)
+		}},
+		{name: "part of it", object: "corrupted", open: func(object string) (ObjectReaderInterface, error) {
+			return s.NewRangeReader(context.Background(), "b", object, 10, 100)
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			open := tc.open
+			if open == nil {
+				open = func(object string) (ObjectReaderInterface, error) {
+					return s.NewObjectReader(context.Background(), "b", object)
+				}
+			}
+			r, err := open(tc.object)
+			if err != nil {
+				t.Fatalf("Failed to open %s: %v", tc.object, err)
+			}
+			defer r.Close()
+			if _, err := io.ReadAll(r); !errors.Is(err, tc.wantErr) {
+				t.Errorf("Expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("resumed read", func(t *testing.T) {
+		backend.breakAfter = 100
+		r, err := s.NewObjectReader(context.Background(), "b", "intact")
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer r.Close()
+		if data, err := io.ReadAll(r); err != nil || string(data) != content {
+			t.Errorf("Expected the resumed read to verify, got %d bytes, %v", len(data), err)
+		}
+		if last := backend.opened[len(backend.opened)-1]; last != 100 {
+			t.Errorf("Expected the read to be resumed at 100, got %d", last)
+		}
+	})
+}
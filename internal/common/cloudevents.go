@@ -0,0 +1,168 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+)
+
+// The types of the CloudEvents workers publish when a job finishes.
+const (
+	CloudEventJobCompleted = "com.github.ntdkhiem.cdc.job.completed"
+	CloudEventJobFailed    = "com.github.ntdkhiem.cdc.job.failed"
+)
+
+// CloudEvent is a CloudEvents 1.0 event about a job, as kept on the job
+// record until it is published, see Job.PendingEvents.
+type CloudEvent struct {
+	SpecVersion     string       `json:"specversion"`
+	ID              string       `json:"id"`
+	Source          string       `json:"source"`
+	Type            string       `json:"type"`
+	Subject         string       `json:"subject"`
+	Time            time.Time    `json:"time"`
+	DataContentType string       `json:"datacontenttype"`
+	Data            JobEventData `json:"data"`
+}
+
+// JobEventData is the data of the CloudEvent of a finished job: what it did
+// and, for billing, how much. Duration is the time from submission to the
+// end of the job, in seconds.
+type JobEventData struct {
+	JobID       string    `json:"job_id"`
+	Status      JobStatus `json:"status"`
+	Operation   string    `json:"operation"`
+	Owner       string    `json:"owner,omitempty"`
+	FileName    string    `json:"file_name,omitempty"`
+	Algorithm   string    `json:"algorithm,omitempty"`
+	Stored      bool      `json:"stored,omitempty"`
+	ResultPath  string    `json:"result_path,omitempty"`
+	InputSize   int64     `json:"input_size,omitempty"`
+	OutputSize  int64     `json:"output_size,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	Duration    float64   `json:"duration_seconds"`
+	Error       string    `json:"error,omitempty"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// NewJobCloudEvent returns the event of job finishing at now, if it has
+// finished as DONE or FAILED. The ID is derived from the job and how often
+// it was requeued, so consumers can drop the copies a retried publish sends.
+func NewJobCloudEvent(job *Job, now time.Time) (CloudEvent, bool) {
+	var eventType string
+	switch job.Status {
+	case JobDone:
+		eventType = CloudEventJobCompleted
+	case JobFailed:
+		eventType = CloudEventJobFailed
+	default:
+		return CloudEvent{}, false
+	}
+	data := JobEventData{
+		JobID:       job.ID,
+		Status:      job.Status,
+		Operation:   job.Operation,
+		Owner:       job.Owner,
+		FileName:    job.FileName,
+		Algorithm:   job.Algorithm,
+		Stored:      job.Stored,
+		ResultPath:  job.ResultPath,
+		InputSize:   job.InputSize,
+		OutputSize:  job.OutputSize,
+		Attempts:    job.Attempts,
+		Error:       job.Error,
+		SubmittedAt: job.CreatedAt,
+	}
+	if !job.CreatedAt.IsZero() {
+		data.Duration = now.Sub(job.CreatedAt).Seconds()
+	}
+	return CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              fmt.Sprintf("%s.%s.%d", job.ID, strings.ToLower(string(job.Status)), job.Requeued),
+		Source:          "//cdc/worker/" + eventSource,
+		Type:            eventType,
+		Subject:         job.ID,
+		Time:            now.UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}, true
+}
+
+// PubSubMessage encodes the event in the binary content mode of the
+// CloudEvents Pub/Sub binding: the data is the message, the other attributes
+// are message attributes prefixed with ce-.
+func (e *CloudEvent) PubSubMessage() (*pubsub.Message, error) {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+	return &pubsub.Message{
+		Data: data,
+		Attributes: map[string]string{
+			"ce-specversion": e.SpecVersion,
+			"ce-id":          e.ID,
+			"ce-source":      e.Source,
+			"ce-type":        e.Type,
+			"ce-subject":     e.Subject,
+			"ce-time":        e.Time.Format(time.RFC3339Nano),
+			"content-type":   e.DataContentType,
+			"job_id":         e.Data.JobID,
+		},
+	}, nil
+}
+
+// QueueJobEvent adds the CloudEvent of job finishing at now to its pending
+// events, unless it is pending already. It is called from the update that
+// finishes the job, so the event is saved along with the new status.
+func QueueJobEvent(job *Job, now time.Time) {
+	event, ok := NewJobCloudEvent(job, now)
+	if !ok {
+		return
+	}
+	for _, pending := range job.PendingEvents {
+		if pending.ID == event.ID {
+			return
+		}
+	}
+	job.PendingEvents = append(job.PendingEvents, event)
+}
+
+// PublishJobEvents publishes the pending events of job on topicID and
+// removes those published from its record in store. It must not decide
+// whether the job succeeded, so failures are only logged; the events stay
+// pending until the janitor of the workers publishes them.
+func PublishJobEvents(ctx context.Context, client PubSubClientInterface, store JobStoreInterface, topicID string, job *Job) {
+	if len(job.PendingEvents) == 0 {
+		return
+	}
+	published := make(map[string]bool)
+	for _, event := range job.PendingEvents {
+		msg, err := event.PubSubMessage()
+		if err == nil {
+			_, err = client.PublishMessage(ctx, topicID, msg)
+		}
+		if err != nil {
+			slog.Warn("Failed to publish job event", "job", job.ID, "event", event.ID, "error", err)
+			continue
+		}
+		published[event.ID] = true
+	}
+	if len(published) == 0 {
+		return
+	}
+	if _, err := store.UpdateJob(ctx, job.ID, func(j *Job) error {
+		j.PendingEvents = slices.DeleteFunc(j.PendingEvents, func(event CloudEvent) bool {
+			return published[event.ID]
+		})
+		return nil
+	}); err != nil {
+		// published again later, which consumers tell by the event ID
+		slog.Warn("Failed to remove published job events", "job", job.ID, "error", err)
+	}
+}
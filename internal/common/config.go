@@ -0,0 +1,65 @@
+package common
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// GetEnvDuration parses a duration (e.g. "15m") from the environment, falling
+// back to the given default when the variable is unset or malformed.
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid duration in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return d
+}
+
+// GetEnvInt parses an integer from the environment, falling back to the given
+// default when the variable is unset or malformed.
+func GetEnvInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		slog.Warn("Invalid integer in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return n
+}
+
+// SetupLogging logs JSON to stdout, at debug level when DEVELOPMENT_MODE is
+// set. Records logged with a context carry its request ID.
+func SetupLogging() {
+	programLevel := new(slog.LevelVar) // Info by default
+	isDev, err := strconv.ParseBool(os.Getenv("DEVELOPMENT_MODE"))
+	if err == nil && isDev {
+		programLevel.Set(slog.LevelDebug)
+	}
+	logger := slog.New(requestIDHandler{slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: programLevel})})
+	slog.SetDefault(logger)
+}
+
+// GetEnvBool parses a boolean from the environment, falling back to the given
+// default when the variable is unset or malformed.
+func GetEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		slog.Warn("Invalid boolean in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return b
+}
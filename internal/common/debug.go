@@ -0,0 +1,45 @@
+package common
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// RegisterDebugHandlers serves the pprof profiles under /debug/pprof/ and the
+// runtime stats of expvar under /debug/vars on mux, so a slow job or growing
+// heap can be looked into in production. Profiles reveal a lot about the
+// process, so nothing is registered without a token, and requests have to
+// send it as "Authorization: Bearer <token>".
+func RegisterDebugHandlers(mux *http.ServeMux, token string) {
+	if token == "" {
+		return
+	}
+	guard := func(h http.Handler) http.Handler {
+		return RequireBearerToken(token, "debug", h)
+	}
+	// Index also serves the named profiles, like /debug/pprof/heap
+	mux.Handle("GET /debug/pprof/", guard(http.HandlerFunc(pprof.Index)))
+	mux.Handle("GET /debug/pprof/cmdline", guard(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("GET /debug/pprof/profile", guard(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("GET /debug/pprof/symbol", guard(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("POST /debug/pprof/symbol", guard(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("GET /debug/pprof/trace", guard(http.HandlerFunc(pprof.Trace)))
+	mux.Handle("GET /debug/vars", guard(expvar.Handler()))
+}
+
+// RequireBearerToken only lets requests through to h that send token as
+// "Authorization: Bearer <token>", rejecting others with 401. name says
+// which token is missing in the error.
+func RequireBearerToken(token, name string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			WriteError(w, "Missing or invalid "+name+" token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
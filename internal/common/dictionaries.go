@@ -0,0 +1,116 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DictionaryInfo describes a compression dictionary trained for the files of
+// one tenant, optionally of one content type. Containers compressed with it
+// name it by ID, so it is kept until removed by hand.
+type DictionaryInfo struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner,omitempty"`
+	// ContentType is the kind of file the dictionary was trained on.
+	ContentType string `json:"content_type,omitempty"`
+	// Samples is how many files it was trained on.
+	Samples   int       `json:"samples"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func dictionaryRecordPath(id string) string {
+	return fmt.Sprintf("dictionaries/%s.json", id)
+}
+
+func dictionaryDataPath(id string) string {
+	return fmt.Sprintf("dictionaries/%s.zdict", id)
+}
+
+func writeObject(ctx context.Context, client StorageBackend, bucket, path string, data []byte, opts ...ObjectWriterOption) error {
+	wc := client.NewObjectWriter(ctx, bucket, path, opts...)
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	return wc.Close()
+}
+
+// SaveDictionary stores a new dictionary and then its record, so that a
+// listed dictionary can always be loaded. Dictionaries never change once
+// written.
+func SaveDictionary(ctx context.Context, client StorageBackend, bucket string, info *DictionaryInfo, dict []byte) error {
+	if err := writeObject(ctx, client, bucket, dictionaryDataPath(info.ID), dict, WithIfNotExists()); err != nil {
+		return fmt.Errorf("failed to write dictionary: %w", err)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dictionary record: %w", err)
+	}
+	if err := writeObject(ctx, client, bucket, dictionaryRecordPath(info.ID), data,
+		WithIfNotExists(), WithContentType("application/json")); err != nil {
+		return fmt.Errorf("failed to write dictionary record: %w", err)
+	}
+	return nil
+}
+
+// GetDictionaryInfo returns the record of a dictionary, or an error wrapping
+// ErrObjectNotExist if there is none.
+func GetDictionaryInfo(ctx context.Context, client StorageBackend, bucket, id string) (*DictionaryInfo, error) {
+	rc, err := client.NewObjectReader(ctx, bucket, dictionaryRecordPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary record: %w", err)
+	}
+	defer rc.Close()
+
+	var info DictionaryInfo
+	if err := json.NewDecoder(rc).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode dictionary record: %w", err)
+	}
+	return &info, nil
+}
+
+// LoadDictionary returns the content of a dictionary, or an error wrapping
+// ErrObjectNotExist if there is none.
+func LoadDictionary(ctx context.Context, client StorageBackend, bucket, id string) ([]byte, error) {
+	rc, err := client.NewObjectReader(ctx, bucket, dictionaryDataPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary: %w", err)
+	}
+	defer rc.Close()
+
+	dict, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary: %w", err)
+	}
+	return dict, nil
+}
+
+// ListDictionaries returns the records of every dictionary.
+func ListDictionaries(ctx context.Context, client StorageBackend, bucket string) ([]*DictionaryInfo, error) {
+	objects, err := client.ListObjects(ctx, bucket, "dictionaries/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dictionaries: %w", err)
+	}
+	dictionaries := make([]*DictionaryInfo, 0, len(objects))
+	for _, object := range objects {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(object.Name, "dictionaries/"), ".json")
+		if !ok {
+			continue
+		}
+		info, err := GetDictionaryInfo(ctx, client, bucket, id)
+		if err != nil {
+			if errors.Is(err, ErrObjectNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		dictionaries = append(dictionaries, info)
+	}
+	return dictionaries, nil
+}
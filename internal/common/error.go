@@ -2,10 +2,86 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 )
 
+// The classes errors fall into, which decide how a request is answered and
+// whether a message is worth retrying. Errors are put in a class by wrapping
+// it, or with NewError, and looked up with Classify.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrTooLarge     = errors.New("too large")
+	ErrCorruptInput = errors.New("corrupt input")
+	// ErrPermanent fails the same way however often it is retried.
+	ErrPermanent = errors.New("permanent failure")
+	// ErrTransient may go away on its own, it is what unclassified errors are.
+	ErrTransient = errors.New("transient failure")
+	// ErrUnavailable is transient too, but known to last a while.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// classError is a sentinel error of its own that belongs to a class.
+type classError struct {
+	text  string
+	class error
+}
+
+func (e *classError) Error() string { return e.text }
+func (e *classError) Unwrap() error { return e.class }
+
+// NewError returns an error with text that errors.Is matches to class.
+func NewError(class error, text string) error {
+	return &classError{text: text, class: class}
+}
+
+// Classify returns the class of err, also recognizing missing objects and
+// request bodies over their limit. It returns nil for nil.
+func Classify(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrObjectNotExist):
+		return ErrNotFound
+	case errors.Is(err, ErrTooLarge), errors.As(err, &maxBytesErr):
+		return ErrTooLarge
+	case errors.Is(err, ErrCorruptInput):
+		return ErrCorruptInput
+	case errors.Is(err, ErrPermanent):
+		return ErrPermanent
+	case errors.Is(err, ErrUnavailable):
+		return ErrUnavailable
+	}
+	return ErrTransient
+}
+
+// IsPermanent reports whether retrying err is pointless.
+func IsPermanent(err error) bool {
+	class := Classify(err)
+	return class != nil && class != ErrTransient && class != ErrUnavailable
+}
+
+// StatusCode is the HTTP status of a request that failed with err.
+func StatusCode(err error) int {
+	switch Classify(err) {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrCorruptInput:
+		return http.StatusUnprocessableEntity
+	case ErrPermanent:
+		return http.StatusBadRequest
+	case ErrTransient:
+		return http.StatusInternalServerError
+	case ErrUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
 type errorResponse struct {
 	Error string `json:"error"`
 }
@@ -0,0 +1,116 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// JobEventType names a step in the life of a job.
+type JobEventType string
+
+const (
+	EventSubmitted JobEventType = "submitted"
+	// EventPublished is recorded once the job's message is on the topic,
+	// which for scheduled jobs or an unreachable queue is later than
+	// EventSubmitted.
+	EventPublished JobEventType = "published"
+	EventDequeued  JobEventType = "dequeued"
+	EventStarted   JobEventType = "started"
+	// EventChunkDone marks every JobEventChunkSize bytes of output written.
+	EventChunkDone JobEventType = "chunk_done"
+	// EventCheckpoint marks a chunk of a checkpointed job recorded, from
+	// which a later delivery resumes.
+	EventCheckpoint JobEventType = "checkpoint"
+	EventUploaded   JobEventType = "uploaded"
+	EventAcked      JobEventType = "acked"
+	EventFailed     JobEventType = "failed"
+	EventCanceled   JobEventType = "canceled"
+	// EventRequeued is recorded when an operator enqueues a failed job again.
+	EventRequeued JobEventType = "requeued"
+)
+
+// JobEventChunkSize is how much output a worker writes between two
+// EventChunkDone events.
+const JobEventChunkSize = 64 << 20
+
+// JobEvent is one entry of a job's audit trail.
+type JobEvent struct {
+	JobID string       `json:"job_id"`
+	Type  JobEventType `json:"type"`
+	Time  time.Time    `json:"time"`
+	// Source is the manager or worker instance that recorded the event.
+	Source string `json:"source,omitempty"`
+	// Chunk counts the chunks written so far, for EventChunkDone.
+	Chunk  int    `json:"chunk,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// eventSource names this instance in the events it records: its host name,
+// which is the pod name on Kubernetes.
+var eventSource, _ = os.Hostname()
+
+// JobEventsPrefix is where the events of a job are kept, so they can be
+// removed along with its files.
+func JobEventsPrefix(jobID string) string {
+	return fmt.Sprintf("events/%s/", jobID)
+}
+
+// RecordJobEvent appends event to the audit trail of its job. Every event is
+// an object of its own, so the manager and workers never contend for one.
+func RecordJobEvent(ctx context.Context, client StorageBackend, bucket string, event JobEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.Source == "" {
+		event.Source = eventSource
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job event: %w", err)
+	}
+	object := fmt.Sprintf("%s%020d-%s.json", JobEventsPrefix(event.JobID), event.Time.UnixNano(), event.Type)
+	wc := client.NewObjectWriter(ctx, bucket, object, WithContentType("application/json"), WithIfNotExists())
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write job event: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close job event writer: %w", err)
+	}
+	return nil
+}
+
+// ListJobEvents returns the audit trail of a job, oldest first.
+func ListJobEvents(ctx context.Context, client StorageBackend, bucket, jobID string) ([]JobEvent, error) {
+	objects, err := client.ListObjects(ctx, bucket, JobEventsPrefix(jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job events: %w", err)
+	}
+	events := make([]JobEvent, 0, len(objects))
+	for _, object := range objects {
+		rc, err := client.NewObjectReader(ctx, bucket, object.Name)
+		if err != nil {
+			// deleted since it was listed
+			if errors.Is(err, ErrObjectNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read job event: %w", err)
+		}
+		var event JobEvent
+		err = json.NewDecoder(rc).Decode(&event)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode job event: %w", err)
+		}
+		events = append(events, event)
+	}
+	// clocks of different instances may disagree, but not by much
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports whether a dependency of the service can be reached.
+type Check func(ctx context.Context) error
+
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthzHandler answers liveness probes: the process is up and serving.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(healthResponse{Status: "ok"})
+}
+
+// ReadyzHandler answers readiness probes by running every check concurrently,
+// each bounded by timeout. It responds 503 if any of them fails.
+func ReadyzHandler(timeout time.Duration, checks map[string]Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		response := healthResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+		for name, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result := "ok"
+				if err := check(ctx); err != nil {
+					slog.Warn("Readiness check failed", "check", name, "error", err)
+					result = err.Error()
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				response.Checks[name] = result
+				if result != "ok" {
+					response.Status = "unavailable"
+				}
+			}()
+		}
+		wg.Wait()
+
+		w.Header().Set("Content-Type", "application/json")
+		if response.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
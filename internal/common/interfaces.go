@@ -2,26 +2,168 @@ package common
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"time"
 
 	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
-type GCSObjectReaderInterface interface {
+type ObjectReaderInterface interface {
 	io.ReadCloser
 }
-type GCSObjectWriterInterface interface {
+type ObjectWriterInterface interface {
 	io.WriteCloser
 }
 
-type GCSClientInterface interface {
-	NewObjectWriter(ctx context.Context, bucket, object string) GCSObjectWriterInterface
-	NewObjectReader(ctx context.Context, bucket, object string) (GCSObjectReaderInterface, error)
+// ErrObjectExists is returned when closing a writer opened WithIfNotExists
+// and the object was already there.
+var ErrObjectExists = errors.New("object already exists")
+
+// ErrObjectNotExist is returned by every StorageBackend for missing objects.
+var ErrObjectNotExist = storage.ErrObjectNotExist
+
+// ErrVersionMismatch is returned when closing a writer opened
+// WithIfVersionMatch and the object was changed in the meantime.
+var ErrVersionMismatch = errors.New("object version changed")
+
+// ObjectWriterOptions are the optional attributes of an object being written.
+type ObjectWriterOptions struct {
+	ContentType string
+	Metadata    map[string]string
+	IfNotExists bool
+	// IfVersionMatch is the ObjectInfo.Version the object must still have.
+	IfVersionMatch string
+	KMSKeyName     string
+	// Size and MaxSize limit what a signed upload accepts, see WithSize.
+	Size    int64
+	MaxSize int64
+}
+
+type ObjectWriterOption func(*ObjectWriterOptions)
+
+func WithContentType(contentType string) ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.ContentType = contentType
+	}
+}
+
+func WithMetadata(metadata map[string]string) ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.Metadata = metadata
+	}
+}
+
+// WithIfNotExists only creates the object if it doesn't exist yet, so that
+// duplicate work never overwrites a finished result.
+func WithIfNotExists() ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.IfNotExists = true
+	}
+}
+
+// WithIfVersionMatch only replaces the object if it is still at version, as
+// reported by StatObject, so concurrent read-modify-writes don't lose updates.
+func WithIfVersionMatch(version string) ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.IfVersionMatch = version
+	}
+}
+
+// WithKMSKey encrypts the object with the given Cloud KMS key instead of the
+// bucket's default. Reading it back needs no key, only access to the KMS key.
+func WithKMSKey(name string) ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.KMSKeyName = name
+	}
+}
+
+// WithSize makes a signed upload accept exactly size bytes, and WithMaxSize
+// any size up to max. S3 can only enforce an exact size.
+func WithSize(size int64) ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.Size = size
+	}
+}
+
+func WithMaxSize(max int64) ObjectWriterOption {
+	return func(o *ObjectWriterOptions) {
+		o.MaxSize = max
+	}
+}
+
+// NewObjectWriterOptions collects the given options, for implementations of
+// StorageBackend.
+func NewObjectWriterOptions(opts ...ObjectWriterOption) ObjectWriterOptions {
+	var o ObjectWriterOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// SignedURLOptions describe a signed URL to download an object.
+type SignedURLOptions struct {
+	Expires time.Time
+	// ContentDisposition overrides the header the object is served with.
+	ContentDisposition string
+}
+
+// SignedUpload is how a client without credentials uploads an object: a
+// request with Method and Headers to URL.
+type SignedUpload struct {
+	URL     string            `json:"upload_url"`
+	Method  string            `json:"upload_method"`
+	Headers map[string]string `json:"upload_headers"`
+}
+
+// StorageBackend is the object storage the services keep files in. Besides
+// GCS it is implemented for S3, selected by NewStorageBackend.
+type StorageBackend interface {
+	NewObjectWriter(ctx context.Context, bucket, object string, opts ...ObjectWriterOption) ObjectWriterInterface
+	NewObjectReader(ctx context.Context, bucket, object string) (ObjectReaderInterface, error)
+	// NewRangeReader reads length bytes of the object from offset, or up to
+	// its end when length is negative.
+	NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (ObjectReaderInterface, error)
+	StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error)
+	SignURL(bucket, object string, opts SignedURLOptions) (string, error)
+	// SignUploadURL lets a client upload the object itself. Of the options
+	// only the KMS key and the sizes are applied.
+	SignUploadURL(bucket, object string, expires time.Time, opts ...ObjectWriterOption) (SignedUpload, error)
+	// CheckBucket verifies that the bucket can be reached, for readiness probes.
+	CheckBucket(ctx context.Context, bucket string) error
+	ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	// DeleteObject succeeds when the object is already gone.
+	DeleteObject(ctx context.Context, bucket, object string) error
+}
+
+// ObjectInfo is the part of an object's attributes the services care about.
+type ObjectInfo struct {
+	Name    string
+	Updated time.Time
+	Size    int64
+	// Version changes whenever the object is written, see WithIfVersionMatch.
+	Version  string
+	Metadata map[string]string
+	// CRC32C is the Castagnoli CRC-32 of the object when HasCRC32C is set,
+	// as GCS keeps for every object, see ChecksumStorage.
+	CRC32C    uint32
+	HasCRC32C bool
 }
 
 type PubSubClientInterface interface {
 	PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error)
+	// CheckTopic and CheckSubscription verify that they exist and can be
+	// reached, for readiness probes.
+	CheckTopic(ctx context.Context, topicID string) error
+	CheckSubscription(ctx context.Context, subID string) error
 }
 
 // MessageInterface abstracts the Pub/Sub message for testing.
@@ -29,22 +171,175 @@ type MessageInterface interface {
 	Ack()
 	Nack()
 	GetData() []byte
+	// DeliveryAttempt is 0 unless the subscription has a dead letter policy.
+	DeliveryAttempt() int
+	// Attributes are the attributes the message was published with.
+	Attributes() map[string]string
 }
 
 type RealGCSClient struct {
 	Client *storage.Client
 }
 
-func (c *RealGCSClient) NewObjectWriter(ctx context.Context, bucket, object string) GCSObjectWriterInterface {
-	return c.Client.Bucket(bucket).Object(object).NewWriter(ctx)
+func (c *RealGCSClient) NewObjectWriter(ctx context.Context, bucket, object string, opts ...ObjectWriterOption) ObjectWriterInterface {
+	o := NewObjectWriterOptions(opts...)
+	handle := c.Client.Bucket(bucket).Object(object)
+	if o.IfNotExists {
+		handle = handle.If(storage.Conditions{DoesNotExist: true})
+	}
+	if o.IfVersionMatch != "" {
+		generation, err := strconv.ParseInt(o.IfVersionMatch, 10, 64)
+		if err != nil {
+			return &failedWriter{fmt.Errorf("invalid object version %q: %w", o.IfVersionMatch, err)}
+		}
+		handle = handle.If(storage.Conditions{GenerationMatch: generation})
+	}
+	w := handle.NewWriter(ctx)
+	w.ContentType = o.ContentType
+	w.Metadata = o.Metadata
+	w.KMSKeyName = o.KMSKeyName
+	if o.IfNotExists {
+		return &conditionalWriter{w, ErrObjectExists}
+	}
+	if o.IfVersionMatch != "" {
+		return &conditionalWriter{w, ErrVersionMismatch}
+	}
+	return w
 }
 
-func (c *RealGCSClient) NewObjectReader(ctx context.Context, bucket, object string) (GCSObjectReaderInterface, error) {
+// conditionalWriter reports a failed precondition as err.
+type conditionalWriter struct {
+	*storage.Writer
+	err error
+}
+
+func (w *conditionalWriter) Close() error {
+	err := w.Writer.Close()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+		return w.err
+	}
+	return err
+}
+
+// failedWriter fails every call with err.
+type failedWriter struct {
+	err error
+}
+
+func (w *failedWriter) Write(p []byte) (int, error) { return 0, w.err }
+func (w *failedWriter) Close() error                { return w.err }
+
+func (c *RealGCSClient) NewObjectReader(ctx context.Context, bucket, object string) (ObjectReaderInterface, error) {
 	return c.Client.Bucket(bucket).Object(object).NewReader(ctx)
 }
 
+func (c *RealGCSClient) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (ObjectReaderInterface, error) {
+	return c.Client.Bucket(bucket).Object(object).NewRangeReader(ctx, offset, length)
+}
+
+func (c *RealGCSClient) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	attrs, err := c.Client.Bucket(bucket).Object(object).Attrs(ctx)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return gcsObjectInfo(attrs), nil
+}
+
+func gcsObjectInfo(attrs *storage.ObjectAttrs) ObjectInfo {
+	return ObjectInfo{
+		Name:     attrs.Name,
+		Updated:  attrs.Updated,
+		Size:     attrs.Size,
+		Version:  strconv.FormatInt(attrs.Generation, 10),
+		Metadata: attrs.Metadata,
+		CRC32C:   attrs.CRC32C,
+		// gzip encoded objects are served decompressed, which the CRC32C
+		// of the stored bytes doesn't check
+		HasCRC32C: attrs.ContentEncoding != "gzip",
+	}
+}
+
+func (c *RealGCSClient) SignURL(bucket, object string, opts SignedURLOptions) (string, error) {
+	signOpts := &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  http.MethodGet,
+		Expires: opts.Expires,
+	}
+	if opts.ContentDisposition != "" {
+		signOpts.QueryParameters = map[string][]string{
+			"response-content-disposition": {opts.ContentDisposition},
+		}
+	}
+	return c.Client.Bucket(bucket).SignedURL(object, signOpts)
+}
+
+// SignUploadURL signs a resumable upload: the client POSTs to the URL with
+// the headers, then sends the file to the session it gets back.
+func (c *RealGCSClient) SignUploadURL(bucket, object string, expires time.Time, opts ...ObjectWriterOption) (SignedUpload, error) {
+	o := NewObjectWriterOptions(opts...)
+	upload := SignedUpload{
+		Method:  http.MethodPost,
+		Headers: map[string]string{"x-goog-resumable": "start"},
+	}
+	// signed into the URL, so the upload can't go without it
+	if o.KMSKeyName != "" {
+		upload.Headers["x-goog-encryption-kms-key-name"] = o.KMSKeyName
+	}
+	if o.Size > 0 {
+		upload.Headers["x-goog-content-length-range"] = fmt.Sprintf("%d,%d", o.Size, o.Size)
+	} else if o.MaxSize > 0 {
+		upload.Headers["x-goog-content-length-range"] = fmt.Sprintf("0,%d", o.MaxSize)
+	}
+	headers := make([]string, 0, len(upload.Headers))
+	for name, value := range upload.Headers {
+		headers = append(headers, name+":"+value)
+	}
+	var err error
+	upload.URL, err = c.Client.Bucket(bucket).SignedURL(object, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  upload.Method,
+		Expires: expires,
+		Headers: headers,
+	})
+	return upload, err
+}
+
+func (c *RealGCSClient) CheckBucket(ctx context.Context, bucket string) error {
+	_, err := c.Client.Bucket(bucket).Attrs(ctx)
+	return err
+}
+
+func (c *RealGCSClient) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	it := c.Client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, gcsObjectInfo(attrs))
+	}
+}
+
+func (c *RealGCSClient) DeleteObject(ctx context.Context, bucket, object string) error {
+	err := c.Client.Bucket(bucket).Object(object).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
 type RealPubSubClient struct {
 	Client *pubsub.Client
+	// MaxExtension is how long the lease of a received message is extended
+	// for while it is handled, AckExtensionPeriod how much at a time. Zero
+	// leaves either to the client library.
+	MaxExtension       time.Duration
+	AckExtensionPeriod time.Duration
 }
 
 func (c *RealPubSubClient) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
@@ -53,6 +348,20 @@ func (c *RealPubSubClient) PublishMessage(ctx context.Context, topicID string, m
 	return result.Get(ctx)
 }
 
+func (c *RealPubSubClient) CheckTopic(ctx context.Context, topicID string) error {
+	_, err := c.Client.TopicAdminClient.GetTopic(ctx, &pubsubpb.GetTopicRequest{
+		Topic: fmt.Sprintf("projects/%s/topics/%s", c.Client.Project(), topicID),
+	})
+	return err
+}
+
+func (c *RealPubSubClient) CheckSubscription(ctx context.Context, subID string) error {
+	_, err := c.Client.SubscriptionAdminClient.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{
+		Subscription: fmt.Sprintf("projects/%s/subscriptions/%s", c.Client.Project(), subID),
+	})
+	return err
+}
+
 // realMessage wraps the concrete pubsub.Message.
 type RealMessage struct {
 	Msg *pubsub.Message
@@ -70,15 +379,65 @@ func (r *RealMessage) GetData() []byte {
 	return r.Msg.Data
 }
 
-// Must follow this schema to be accepted by Pub/Sub
+func (r *RealMessage) Attributes() map[string]string {
+	return r.Msg.Attributes
+}
+
+func (r *RealMessage) DeliveryAttempt() int {
+	if r.Msg.DeliveryAttempt == nil {
+		return 0
+	}
+	return *r.Msg.DeliveryAttempt
+}
+
+// CompressedMsgSchema is the message of the compress topic, sent as the
+// CompressJob of proto/jobs/v1, see MarshalMessage.
 type CompressedMsgSchema struct {
 	UID              string `json:"UID"`
 	OriginalFilePath string `json:"OriginalFilePath"`
-	FreqTablePath    string `json:"FreqTablePath"`
+	Algorithm        string `json:"Algorithm,omitempty"`
+	Level            int    `json:"Level,omitempty"`
+	Archive          bool   `json:"Archive,omitempty"`
+	FileName         string `json:"FileName,omitempty"`
+	ContentType      string `json:"ContentType,omitempty"`
+	KMSKeyName       string `json:"KMSKeyName,omitempty"`
+	Verify           bool   `json:"Verify,omitempty"`
+	// Dictionary is the ID of the dictionary to compress with, see
+	// DictionaryInfo.
+	Dictionary string `json:"Dictionary,omitempty"`
+	// Split jobs have a message per part, numbered from 1, to compress the
+	// Length bytes of the original at Offset. The message without a Part
+	// joins the compressed parts once all of them are there.
+	Parts  int   `json:"Parts,omitempty"`
+	Part   int   `json:"Part,omitempty"`
+	Offset int64 `json:"Offset,omitempty"`
+	Length int64 `json:"Length,omitempty"`
+	// SourceBucket is the bucket OriginalFilePath is in for in-place jobs,
+	// when it isn't the platform's. ResultPath is where their result goes,
+	// in ResultBucket when set, instead of next to the original.
+	SourceBucket string `json:"SourceBucket,omitempty"`
+	ResultBucket string `json:"ResultBucket,omitempty"`
+	ResultPath   string `json:"ResultPath,omitempty"`
+	// Append jobs have a message per segment, numbered from 1, whose
+	// OriginalFilePath is the segment. Segments are appended in order.
+	Segment int `json:"Segment,omitempty"`
+}
+
+// ProgressMsgSchema is published on the status topic while a worker
+// processes a job, see JobProgress.
+type ProgressMsgSchema struct {
+	UID       string  `json:"UID"`
+	Operation string  `json:"Operation"`
+	Bytes     int64   `json:"Bytes"`
+	Total     int64   `json:"Total,omitempty"`
+	Percent   float64 `json:"Percent,omitempty"`
 }
 
-// Must follow this schema to be accepted by Pub/Sub
+// DecompressedMsgSchema is the message of the decompress topic, sent as the
+// DecompressJob of proto/jobs/v1.
 type DecompressedMsgSchema struct {
 	UID                string `json:"UID"`
 	CompressedFilePath string `json:"CompressedFilePath"`
+	Algorithm          string `json:"Algorithm,omitempty"`
+	KMSKeyName         string `json:"KMSKeyName,omitempty"`
 }
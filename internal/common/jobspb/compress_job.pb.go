@@ -0,0 +1,289 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: proto/jobs/v1/compress_job.proto
+
+package jobspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CompressJob struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Version          uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Uid              string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	OriginalFilePath string                 `protobuf:"bytes,3,opt,name=original_file_path,json=originalFilePath,proto3" json:"original_file_path,omitempty"`
+	Algorithm        string                 `protobuf:"bytes,4,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	Level            int32                  `protobuf:"varint,5,opt,name=level,proto3" json:"level,omitempty"`
+	Archive          bool                   `protobuf:"varint,6,opt,name=archive,proto3" json:"archive,omitempty"`
+	FileName         string                 `protobuf:"bytes,7,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	ContentType      string                 `protobuf:"bytes,8,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	KmsKeyName       string                 `protobuf:"bytes,9,opt,name=kms_key_name,json=kmsKeyName,proto3" json:"kms_key_name,omitempty"`
+	Verify           bool                   `protobuf:"varint,10,opt,name=verify,proto3" json:"verify,omitempty"`
+	Dictionary       string                 `protobuf:"bytes,11,opt,name=dictionary,proto3" json:"dictionary,omitempty"`
+	Parts            int32                  `protobuf:"varint,12,opt,name=parts,proto3" json:"parts,omitempty"`
+	Part             int32                  `protobuf:"varint,13,opt,name=part,proto3" json:"part,omitempty"`
+	Offset           int64                  `protobuf:"varint,14,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length           int64                  `protobuf:"varint,15,opt,name=length,proto3" json:"length,omitempty"`
+	SourceBucket     string                 `protobuf:"bytes,16,opt,name=source_bucket,json=sourceBucket,proto3" json:"source_bucket,omitempty"`
+	ResultBucket     string                 `protobuf:"bytes,17,opt,name=result_bucket,json=resultBucket,proto3" json:"result_bucket,omitempty"`
+	ResultPath       string                 `protobuf:"bytes,18,opt,name=result_path,json=resultPath,proto3" json:"result_path,omitempty"`
+	Segment          int32                  `protobuf:"varint,19,opt,name=segment,proto3" json:"segment,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *CompressJob) Reset() {
+	*x = CompressJob{}
+	mi := &file_proto_jobs_v1_compress_job_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompressJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompressJob) ProtoMessage() {}
+
+func (x *CompressJob) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_jobs_v1_compress_job_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompressJob.ProtoReflect.Descriptor instead.
+func (*CompressJob) Descriptor() ([]byte, []int) {
+	return file_proto_jobs_v1_compress_job_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CompressJob) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *CompressJob) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *CompressJob) GetOriginalFilePath() string {
+	if x != nil {
+		return x.OriginalFilePath
+	}
+	return ""
+}
+
+func (x *CompressJob) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+func (x *CompressJob) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *CompressJob) GetArchive() bool {
+	if x != nil {
+		return x.Archive
+	}
+	return false
+}
+
+func (x *CompressJob) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *CompressJob) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *CompressJob) GetKmsKeyName() string {
+	if x != nil {
+		return x.KmsKeyName
+	}
+	return ""
+}
+
+func (x *CompressJob) GetVerify() bool {
+	if x != nil {
+		return x.Verify
+	}
+	return false
+}
+
+func (x *CompressJob) GetDictionary() string {
+	if x != nil {
+		return x.Dictionary
+	}
+	return ""
+}
+
+func (x *CompressJob) GetParts() int32 {
+	if x != nil {
+		return x.Parts
+	}
+	return 0
+}
+
+func (x *CompressJob) GetPart() int32 {
+	if x != nil {
+		return x.Part
+	}
+	return 0
+}
+
+func (x *CompressJob) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *CompressJob) GetLength() int64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *CompressJob) GetSourceBucket() string {
+	if x != nil {
+		return x.SourceBucket
+	}
+	return ""
+}
+
+func (x *CompressJob) GetResultBucket() string {
+	if x != nil {
+		return x.ResultBucket
+	}
+	return ""
+}
+
+func (x *CompressJob) GetResultPath() string {
+	if x != nil {
+		return x.ResultPath
+	}
+	return ""
+}
+
+func (x *CompressJob) GetSegment() int32 {
+	if x != nil {
+		return x.Segment
+	}
+	return 0
+}
+
+var File_proto_jobs_v1_compress_job_proto protoreflect.FileDescriptor
+
+const file_proto_jobs_v1_compress_job_proto_rawDesc = "" +
+	"\n" +
+	" proto/jobs/v1/compress_job.proto\x12\vcdc.jobs.v1\"\xae\x04\n" +
+	"\vCompressJob\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\x12,\n" +
+	"\x12original_file_path\x18\x03 \x01(\tR\x10originalFilePath\x12\x1c\n" +
+	"\talgorithm\x18\x04 \x01(\tR\talgorithm\x12\x14\n" +
+	"\x05level\x18\x05 \x01(\x05R\x05level\x12\x18\n" +
+	"\aarchive\x18\x06 \x01(\bR\aarchive\x12\x1b\n" +
+	"\tfile_name\x18\a \x01(\tR\bfileName\x12!\n" +
+	"\fcontent_type\x18\b \x01(\tR\vcontentType\x12 \n" +
+	"\fkms_key_name\x18\t \x01(\tR\n" +
+	"kmsKeyName\x12\x16\n" +
+	"\x06verify\x18\n" +
+	" \x01(\bR\x06verify\x12\x1e\n" +
+	"\n" +
+	"dictionary\x18\v \x01(\tR\n" +
+	"dictionary\x12\x14\n" +
+	"\x05parts\x18\f \x01(\x05R\x05parts\x12\x12\n" +
+	"\x04part\x18\r \x01(\x05R\x04part\x12\x16\n" +
+	"\x06offset\x18\x0e \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x0f \x01(\x03R\x06length\x12#\n" +
+	"\rsource_bucket\x18\x10 \x01(\tR\fsourceBucket\x12#\n" +
+	"\rresult_bucket\x18\x11 \x01(\tR\fresultBucket\x12\x1f\n" +
+	"\vresult_path\x18\x12 \x01(\tR\n" +
+	"resultPath\x12\x18\n" +
+	"\asegment\x18\x13 \x01(\x05R\asegmentBSZQgithub.com/ntdkhiem/cloud-distributed-compression-platform/internal/common/jobspbb\x06proto3"
+
+var (
+	file_proto_jobs_v1_compress_job_proto_rawDescOnce sync.Once
+	file_proto_jobs_v1_compress_job_proto_rawDescData []byte
+)
+
+func file_proto_jobs_v1_compress_job_proto_rawDescGZIP() []byte {
+	file_proto_jobs_v1_compress_job_proto_rawDescOnce.Do(func() {
+		file_proto_jobs_v1_compress_job_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_jobs_v1_compress_job_proto_rawDesc), len(file_proto_jobs_v1_compress_job_proto_rawDesc)))
+	})
+	return file_proto_jobs_v1_compress_job_proto_rawDescData
+}
+
+var file_proto_jobs_v1_compress_job_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_jobs_v1_compress_job_proto_goTypes = []any{
+	(*CompressJob)(nil), // 0: cdc.jobs.v1.CompressJob
+}
+var file_proto_jobs_v1_compress_job_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_jobs_v1_compress_job_proto_init() }
+func file_proto_jobs_v1_compress_job_proto_init() {
+	if File_proto_jobs_v1_compress_job_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_jobs_v1_compress_job_proto_rawDesc), len(file_proto_jobs_v1_compress_job_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_jobs_v1_compress_job_proto_goTypes,
+		DependencyIndexes: file_proto_jobs_v1_compress_job_proto_depIdxs,
+		MessageInfos:      file_proto_jobs_v1_compress_job_proto_msgTypes,
+	}.Build()
+	File_proto_jobs_v1_compress_job_proto = out.File
+	file_proto_jobs_v1_compress_job_proto_goTypes = nil
+	file_proto_jobs_v1_compress_job_proto_depIdxs = nil
+}
@@ -0,0 +1,159 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: proto/jobs/v1/decompress_job.proto
+
+package jobspb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DecompressJob struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Version            uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Uid                string                 `protobuf:"bytes,2,opt,name=uid,proto3" json:"uid,omitempty"`
+	CompressedFilePath string                 `protobuf:"bytes,3,opt,name=compressed_file_path,json=compressedFilePath,proto3" json:"compressed_file_path,omitempty"`
+	Algorithm          string                 `protobuf:"bytes,4,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	KmsKeyName         string                 `protobuf:"bytes,5,opt,name=kms_key_name,json=kmsKeyName,proto3" json:"kms_key_name,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *DecompressJob) Reset() {
+	*x = DecompressJob{}
+	mi := &file_proto_jobs_v1_decompress_job_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DecompressJob) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecompressJob) ProtoMessage() {}
+
+func (x *DecompressJob) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_jobs_v1_decompress_job_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecompressJob.ProtoReflect.Descriptor instead.
+func (*DecompressJob) Descriptor() ([]byte, []int) {
+	return file_proto_jobs_v1_decompress_job_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DecompressJob) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *DecompressJob) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *DecompressJob) GetCompressedFilePath() string {
+	if x != nil {
+		return x.CompressedFilePath
+	}
+	return ""
+}
+
+func (x *DecompressJob) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+func (x *DecompressJob) GetKmsKeyName() string {
+	if x != nil {
+		return x.KmsKeyName
+	}
+	return ""
+}
+
+var File_proto_jobs_v1_decompress_job_proto protoreflect.FileDescriptor
+
+const file_proto_jobs_v1_decompress_job_proto_rawDesc = "" +
+	"\n" +
+	"\"proto/jobs/v1/decompress_job.proto\x12\vcdc.jobs.v1\"\xad\x01\n" +
+	"\rDecompressJob\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x10\n" +
+	"\x03uid\x18\x02 \x01(\tR\x03uid\x120\n" +
+	"\x14compressed_file_path\x18\x03 \x01(\tR\x12compressedFilePath\x12\x1c\n" +
+	"\talgorithm\x18\x04 \x01(\tR\talgorithm\x12 \n" +
+	"\fkms_key_name\x18\x05 \x01(\tR\n" +
+	"kmsKeyNameBSZQgithub.com/ntdkhiem/cloud-distributed-compression-platform/internal/common/jobspbb\x06proto3"
+
+var (
+	file_proto_jobs_v1_decompress_job_proto_rawDescOnce sync.Once
+	file_proto_jobs_v1_decompress_job_proto_rawDescData []byte
+)
+
+func file_proto_jobs_v1_decompress_job_proto_rawDescGZIP() []byte {
+	file_proto_jobs_v1_decompress_job_proto_rawDescOnce.Do(func() {
+		file_proto_jobs_v1_decompress_job_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_jobs_v1_decompress_job_proto_rawDesc), len(file_proto_jobs_v1_decompress_job_proto_rawDesc)))
+	})
+	return file_proto_jobs_v1_decompress_job_proto_rawDescData
+}
+
+var file_proto_jobs_v1_decompress_job_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_jobs_v1_decompress_job_proto_goTypes = []any{
+	(*DecompressJob)(nil), // 0: cdc.jobs.v1.DecompressJob
+}
+var file_proto_jobs_v1_decompress_job_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_proto_jobs_v1_decompress_job_proto_init() }
+func file_proto_jobs_v1_decompress_job_proto_init() {
+	if File_proto_jobs_v1_decompress_job_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_jobs_v1_decompress_job_proto_rawDesc), len(file_proto_jobs_v1_decompress_job_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_jobs_v1_decompress_job_proto_goTypes,
+		DependencyIndexes: file_proto_jobs_v1_decompress_job_proto_depIdxs,
+		MessageInfos:      file_proto_jobs_v1_decompress_job_proto_msgTypes,
+	}.Build()
+	File_proto_jobs_v1_decompress_job_proto = out.File
+	file_proto_jobs_v1_decompress_job_proto_goTypes = nil
+	file_proto_jobs_v1_decompress_job_proto_depIdxs = nil
+}
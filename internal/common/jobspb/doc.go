@@ -0,0 +1,5 @@
+// Package jobspb holds the job messages workers receive, generated from
+// proto/jobs/v1. Each file is the Pub/Sub schema of one topic.
+package jobspb
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=module=github.com/ntdkhiem/cloud-distributed-compression-platform proto/jobs/v1/compress_job.proto proto/jobs/v1/decompress_job.proto
@@ -0,0 +1,287 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	// JobAwaitingUpload jobs wait for the client to upload the file to GCS
+	// itself before they are submitted.
+	JobAwaitingUpload JobStatus = "AWAITING_UPLOAD"
+	// JobScheduled jobs are enqueued once their NotBefore has passed.
+	JobScheduled  JobStatus = "SCHEDULED"
+	JobPending    JobStatus = "PENDING"
+	JobProcessing JobStatus = "PROCESSING"
+	JobDone       JobStatus = "DONE"
+	JobFailed     JobStatus = "FAILED"
+	// JobExpired jobs had their files removed after the retention period.
+	JobExpired JobStatus = "EXPIRED"
+	// JobCanceled jobs were stopped by the client before they finished.
+	JobCanceled JobStatus = "CANCELED"
+	// JobOpen append jobs take segments until they are closed.
+	JobOpen JobStatus = "OPEN"
+)
+
+const (
+	OperationCompress   = "compress"
+	OperationDecompress = "decompress"
+)
+
+var ErrJobNotFound = NewError(ErrNotFound, "job not found")
+
+// Finished reports whether the job has reached a status it never leaves.
+func (s JobStatus) Finished() bool {
+	switch s {
+	case JobDone, JobFailed, JobExpired, JobCanceled:
+		return true
+	}
+	return false
+}
+
+// JobProgress counts the input a worker has processed of a job.
+type JobProgress struct {
+	Bytes int64 `json:"bytes"`
+	// Total is the size of the input, 0 when it isn't known.
+	Total int64 `json:"total,omitempty"`
+	// Percent is Bytes of Total, rounded down to a tenth.
+	Percent   float64   `json:"percent,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NewJobProgress reports bytes processed of total.
+func NewJobProgress(bytes, total int64) JobProgress {
+	progress := JobProgress{Bytes: bytes, Total: total, UpdatedAt: time.Now().UTC()}
+	if total > 0 {
+		progress.Percent = float64(min(bytes, total)*1000/total) / 10
+	}
+	return progress
+}
+
+// Job is the persisted record of a compression/decompression request.
+type Job struct {
+	ID          string    `json:"id"`
+	Operation   string    `json:"operation"`
+	Status      JobStatus `json:"status"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type,omitempty"`
+	Algorithm   string    `json:"algorithm,omitempty"`
+	Level       int       `json:"level,omitempty"`
+	BatchID     string    `json:"batch_id,omitempty"`
+	Archive     bool      `json:"archive,omitempty"`
+	// AlgorithmReason says why the manager picked Algorithm for a job
+	// submitted with the auto algorithm.
+	AlgorithmReason string `json:"algorithm_reason,omitempty"`
+	// Stored is set when the worker found the original incompressible and
+	// stored it as it is rather than with Algorithm.
+	Stored bool `json:"stored,omitempty"`
+	// Inline is set when the manager compressed the file itself, as it was
+	// small enough, instead of enqueueing it for a worker.
+	Inline bool `json:"inline,omitempty"`
+	// RequestID is the ID of the request that created the job, passed on to
+	// the workers with its messages.
+	RequestID string `json:"request_id,omitempty"`
+	// Dir is the directory of the objects of the job in the bucket, under
+	// the prefix of its tenant. Jobs without one are stored under their ID.
+	Dir string `json:"dir,omitempty"`
+	// SourceBucket and SourcePath locate the original of an in-place job,
+	// an object of its owner that the workers read instead of an upload.
+	SourceBucket string `json:"source_bucket,omitempty"`
+	SourcePath   string `json:"source_path,omitempty"`
+	// ResultBucket is the bucket of ResultPath when it isn't the platform's,
+	// for in-place jobs that write their result back next to the original.
+	ResultBucket string `json:"result_bucket,omitempty"`
+	// Progress is how far the worker got with a PROCESSING job when it last
+	// reported.
+	Progress *JobProgress `json:"progress,omitempty"`
+	// Parts is how many parts a large original is split into, each
+	// compressed by its own worker, see PartRange.
+	Parts    int `json:"parts,omitempty"`
+	Requeued int `json:"requeued,omitempty"`
+	// Priority decides the topic the job is published to, see PriorityTopic.
+	Priority string `json:"priority,omitempty"`
+	// NotBefore is when a scheduled job may start at the earliest.
+	NotBefore time.Time `json:"not_before,omitzero"`
+	// Attempts counts how often a worker has started on the job, since
+	// Pub/Sub only counts deliveries with a dead letter policy.
+	Attempts  int    `json:"attempts,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	InputSize int64  `json:"input_size,omitempty"`
+	// OutputSize is the size of the result of a DONE job.
+	OutputSize int64 `json:"output_size,omitempty"`
+	// SHA256 is the digest a directly uploaded file is checked against.
+	SHA256     string `json:"sha256,omitempty"`
+	KMSKeyName string `json:"kms_key_name,omitempty"`
+	Verify     bool   `json:"verify,omitempty"`
+	Dictionary string `json:"dictionary,omitempty"`
+	// Append jobs compress segments the client adds one at a time into the
+	// same result, e.g. for log archiving. Segments counts those submitted,
+	// Appended those in ResultPath so far. Closed jobs take no more segments
+	// and are DONE once all of them are appended.
+	Append   bool `json:"append,omitempty"`
+	Segments int  `json:"segments,omitempty"`
+	Appended int  `json:"appended,omitempty"`
+	Closed   bool `json:"closed,omitempty"`
+	// Profile is the profile the job was submitted with, which picked its
+	// algorithm, level and part size.
+	Profile           string    `json:"profile,omitempty"`
+	ResultPath        string    `json:"result_path,omitempty"`
+	ResultContentType string    `json:"result_content_type,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	// PendingEvents are the CloudEvents of the job's status changes that
+	// haven't been published yet. Workers add them in the same update as
+	// the change, and the manager to the record of a job done inline, so
+	// an event is never lost to a crash in between; they are removed once
+	// published.
+	PendingEvents []CloudEvent `json:"pending_events,omitempty"`
+}
+
+// ObjectDir returns the directory of the objects of the job: its input,
+// result and the files in between.
+func (j *Job) ObjectDir() string {
+	if j.Dir == "" {
+		return j.ID
+	}
+	return j.Dir
+}
+
+// ResultIn returns the bucket of the result of the job, bucket unless it was
+// written elsewhere.
+func (j *Job) ResultIn(bucket string) string {
+	if j.ResultBucket == "" {
+		return bucket
+	}
+	return j.ResultBucket
+}
+
+type JobStoreInterface interface {
+	CreateJob(ctx context.Context, job *Job) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+	// UpdateJob loads the job, applies update to it and saves it back, unless
+	// update returns an error. If the job changed in the meantime, update is
+	// applied again to the new record.
+	UpdateJob(ctx context.Context, id string, update func(job *Job) error) (*Job, error)
+	ListJobs(ctx context.Context) ([]*Job, error)
+}
+
+// GCSJobStore keeps one JSON record per job in the bucket so that both the
+// manager and the workers can see the same state without another database.
+type GCSJobStore struct {
+	Client StorageBackend
+	Bucket string
+}
+
+func jobRecordPath(id string) string {
+	return fmt.Sprintf("jobs/%s.json", id)
+}
+
+func (s *GCSJobStore) CreateJob(ctx context.Context, job *Job) error {
+	now := time.Now().UTC()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	job.UpdatedAt = now
+	if job.Status == "" {
+		job.Status = JobPending
+	}
+	return s.save(ctx, job)
+}
+
+func (s *GCSJobStore) GetJob(ctx context.Context, id string) (*Job, error) {
+	rc, err := s.Client.NewObjectReader(ctx, s.Bucket, jobRecordPath(id))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotExist) {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to read job record: %w", err)
+	}
+	defer rc.Close()
+
+	var job Job
+	if err := json.NewDecoder(rc).Decode(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode job record: %w", err)
+	}
+	return &job, nil
+}
+
+// maxUpdateAttempts bounds how often UpdateJob retries a contended job.
+const maxUpdateAttempts = 10
+
+func (s *GCSJobStore) UpdateJob(ctx context.Context, id string, update func(job *Job) error) (*Job, error) {
+	var err error
+	for range maxUpdateAttempts {
+		var info ObjectInfo
+		info, err = s.Client.StatObject(ctx, s.Bucket, jobRecordPath(id))
+		if err != nil {
+			if errors.Is(err, ErrObjectNotExist) {
+				return nil, ErrJobNotFound
+			}
+			return nil, fmt.Errorf("failed to stat job record: %w", err)
+		}
+		job, err := s.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(job); err != nil {
+			return nil, err
+		}
+		job.UpdatedAt = time.Now().UTC()
+		err = s.save(ctx, job, WithIfVersionMatch(info.Version))
+		if err == nil {
+			return job, nil
+		}
+		if !errors.Is(err, ErrVersionMismatch) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (s *GCSJobStore) ListJobs(ctx context.Context) ([]*Job, error) {
+	objects, err := s.Client.ListObjects(ctx, s.Bucket, "jobs/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job records: %w", err)
+	}
+	jobs := make([]*Job, 0, len(objects))
+	for _, object := range objects {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(object.Name, "jobs/"), ".json")
+		if !ok {
+			continue
+		}
+		job, err := s.GetJob(ctx, id)
+		if err != nil {
+			// deleted since it was listed
+			if errors.Is(err, ErrJobNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *GCSJobStore) save(ctx context.Context, job *Job, opts ...ObjectWriterOption) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job record: %w", err)
+	}
+	wc := s.Client.NewObjectWriter(ctx, s.Bucket, jobRecordPath(job.ID), opts...)
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write job record: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close job record writer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/segmentio/kafka-go"
+)
+
+// deliveryAttemptHeader counts how often a message has been handed to a
+// worker, since Kafka itself does not.
+const deliveryAttemptHeader = "delivery_attempt"
+
+// KafkaQueue is a QueueInterface backed by Kafka. Each subscription is a
+// consumer group reading the topic Subscriptions maps it to, or the topic of
+// the same name.
+type KafkaQueue struct {
+	Brokers       []string
+	Subscriptions map[string]string
+	Writer        *kafka.Writer
+}
+
+func NewKafkaQueue(brokers []string, subscriptions map[string]string) *KafkaQueue {
+	return &KafkaQueue{
+		Brokers:       brokers,
+		Subscriptions: subscriptions,
+		Writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Balancer:     &kafka.LeastBytes{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}
+}
+
+func (q *KafkaQueue) topicFor(subID string) string {
+	if topic, ok := q.Subscriptions[subID]; ok {
+		return topic
+	}
+	return subID
+}
+
+// PublishMessage returns an empty ID, Kafka assigns offsets per partition
+// only once the message is written.
+func (q *KafkaQueue) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
+	return "", q.publish(ctx, topicID, msg.Data, msg.Attributes, nil)
+}
+
+func (q *KafkaQueue) publish(ctx context.Context, topicID string, data []byte, attributes map[string]string, headers []kafka.Header) error {
+	for key, value := range attributes {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return q.Writer.WriteMessages(ctx, kafka.Message{Topic: topicID, Value: data, Headers: headers})
+}
+
+func (q *KafkaQueue) CheckTopic(ctx context.Context, topicID string) error {
+	var dialer kafka.Dialer
+	var errs []error
+	for _, broker := range q.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		_, err = conn.ReadPartitions(topicID)
+		return err
+	}
+	return fmt.Errorf("no Kafka broker reachable: %w", errors.Join(errs...))
+}
+
+func (q *KafkaQueue) CheckSubscription(ctx context.Context, subID string) error {
+	return q.CheckTopic(ctx, q.topicFor(subID))
+}
+
+// Receive handles one message at a time, committing its offset once it is
+// acked or nacked. A message the handler does neither with is dropped.
+func (q *KafkaQueue) Receive(ctx context.Context, subID string, handler func(context.Context, MessageInterface)) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: q.Brokers,
+		GroupID: subID,
+		Topic:   q.topicFor(subID),
+	})
+	defer reader.Close()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		m := &kafkaMessage{queue: q, reader: reader, msg: msg}
+		handler(ctx, m)
+		if err := m.requeueErr(); err != nil {
+			// committing a later offset would lose the message, restart from
+			// the last commit instead
+			return fmt.Errorf("cannot requeue message at offset %d: %w", msg.Offset, err)
+		}
+	}
+}
+
+func (q *KafkaQueue) Close() error {
+	return q.Writer.Close()
+}
+
+// kafkaMessage is a message fetched by a consumer group.
+type kafkaMessage struct {
+	queue  *KafkaQueue
+	reader *kafka.Reader
+	msg    kafka.Message
+
+	mu  sync.Mutex
+	err error
+}
+
+func (m *kafkaMessage) requeueErr() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// commit runs after the receive context may be gone, on shutdown.
+func (m *kafkaMessage) commit() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.reader.CommitMessages(ctx, m.msg); err != nil {
+		slog.Error("Failed to commit Kafka offset", "topic", m.msg.Topic, "partition", m.msg.Partition, "offset", m.msg.Offset, "error", err)
+	}
+}
+
+func (m *kafkaMessage) Ack() {
+	m.commit()
+}
+
+// Nack puts the message back at the end of its topic, since a consumer group
+// cannot skip over it and come back later.
+func (m *kafkaMessage) Nack() {
+	headers := []kafka.Header{{Key: deliveryAttemptHeader, Value: []byte(strconv.Itoa(m.DeliveryAttempt() + 1))}}
+	for _, h := range m.msg.Headers {
+		if h.Key != deliveryAttemptHeader {
+			headers = append(headers, h)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.queue.publish(ctx, m.msg.Topic, m.msg.Value, nil, headers); err != nil {
+		m.mu.Lock()
+		m.err = err
+		m.mu.Unlock()
+		return
+	}
+	m.commit()
+}
+
+func (m *kafkaMessage) GetData() []byte {
+	return m.msg.Value
+}
+
+// Attributes are the headers of the message, but for the delivery attempt.
+func (m *kafkaMessage) Attributes() map[string]string {
+	attributes := make(map[string]string)
+	for _, h := range m.msg.Headers {
+		if h.Key != deliveryAttemptHeader {
+			attributes[h.Key] = string(h.Value)
+		}
+	}
+	return attributes
+}
+
+func (m *kafkaMessage) DeliveryAttempt() int {
+	for _, h := range m.msg.Headers {
+		if h.Key == deliveryAttemptHeader {
+			if n, err := strconv.Atoi(string(h.Value)); err == nil {
+				return n
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,48 @@
+package common
+
+import "time"
+
+// Manifest describes the result of a job for programmatic consumers. It is
+// stored as JSON next to the result, see ManifestPath, and served by the
+// manager's GET /jobs/{id}/manifest.
+type Manifest struct {
+	JobID     string `json:"job_id"`
+	Operation string `json:"operation"`
+	// FileName is the name of the original, ContentType its media type.
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type,omitempty"`
+	Algorithm   string `json:"algorithm,omitempty"`
+	Level       int    `json:"level,omitempty"`
+	// Stored is set when the original was found incompressible and stored
+	// as it is rather than with Algorithm.
+	Stored bool `json:"stored,omitempty"`
+	// Result is the path of the result in its bucket, OutputSize its size
+	// and SHA256 its hex digest. InputSize is the size of what the job read.
+	Result     string `json:"result"`
+	InputSize  int64  `json:"input_size"`
+	OutputSize int64  `json:"output_size"`
+	SHA256     string `json:"sha256"`
+	// Chunks lists the parts of a result joined from separately compressed
+	// parts, in order.
+	Chunks []ManifestChunk `json:"chunks,omitempty"`
+	// StartedAt and FinishedAt are when the result started and finished
+	// being written.
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// ManifestChunk is one part of a joined result: Size bytes of the original
+// from Offset on, with their CRC-32, compressed into CompressedSize bytes.
+type ManifestChunk struct {
+	Index          int    `json:"index"`
+	Offset         int64  `json:"offset"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+	CRC32          uint32 `json:"crc32"`
+}
+
+// ManifestPath is where the manifest of the result at resultPath is stored,
+// in the bucket of the result.
+func ManifestPath(resultPath string) string {
+	return resultPath + ".manifest.json"
+}
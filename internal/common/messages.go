@@ -0,0 +1,139 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common/jobspb"
+)
+
+// MessageVersion is the newest version of the job messages this build
+// writes and reads. It changes when a message changes meaning in a way older
+// workers would get wrong, not when a field is merely added. Messages are
+// written with the oldest version that has what they use, see
+// compressVersion.
+const MessageVersion = 3
+
+// compressVersion returns the version a compress message has to be written
+// with: in-place jobs, version 2, read from and write to other places than
+// earlier workers would, and the segments of append jobs, version 3, would
+// be taken for whole originals.
+func compressVersion(m CompressedMsgSchema) uint32 {
+	if m.Segment > 0 {
+		return 3
+	}
+	if m.SourceBucket != "" || m.ResultBucket != "" || m.ResultPath != "" {
+		return 2
+	}
+	return 1
+}
+
+// ErrUnsupportedMessageVersion is returned for a message newer than
+// MessageVersion. It is left to be retried, by a newer worker that is rolled
+// out by then.
+var ErrUnsupportedMessageVersion = NewError(ErrTransient, "unsupported message version")
+
+// MarshalMessage encodes a CompressedMsgSchema or DecompressedMsgSchema in
+// the protobuf wire format of its topic's schema, see proto/jobs/v1.
+func MarshalMessage(message any) ([]byte, error) {
+	switch m := message.(type) {
+	case CompressedMsgSchema:
+		return proto.Marshal(&jobspb.CompressJob{
+			Version:          compressVersion(m),
+			Uid:              m.UID,
+			OriginalFilePath: m.OriginalFilePath,
+			Algorithm:        m.Algorithm,
+			Level:            int32(m.Level),
+			Archive:          m.Archive,
+			FileName:         m.FileName,
+			ContentType:      m.ContentType,
+			KmsKeyName:       m.KMSKeyName,
+			Verify:           m.Verify,
+			Dictionary:       m.Dictionary,
+			Parts:            int32(m.Parts),
+			Part:             int32(m.Part),
+			Offset:           m.Offset,
+			Length:           m.Length,
+			SourceBucket:     m.SourceBucket,
+			ResultBucket:     m.ResultBucket,
+			ResultPath:       m.ResultPath,
+			Segment:          int32(m.Segment),
+		})
+	case DecompressedMsgSchema:
+		return proto.Marshal(&jobspb.DecompressJob{
+			Version:            1,
+			Uid:                m.UID,
+			CompressedFilePath: m.CompressedFilePath,
+			Algorithm:          m.Algorithm,
+			KmsKeyName:         m.KMSKeyName,
+		})
+	}
+	return nil, fmt.Errorf("no message schema for %T", message)
+}
+
+// isJSON tells the JSON messages of earlier releases from protobuf ones,
+// which never start with a brace.
+func isJSON(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+func checkVersion(version uint32) error {
+	if version > MessageVersion {
+		return fmt.Errorf("%w: %d, this worker reads up to %d", ErrUnsupportedMessageVersion, version, MessageVersion)
+	}
+	return nil
+}
+
+// UnmarshalMessage decodes a message of the compress or decompress topic into
+// a *CompressedMsgSchema or *DecompressedMsgSchema, from protobuf or from the
+// JSON of earlier releases. A message of an unsupported version is still
+// decoded, for its job ID.
+func UnmarshalMessage(data []byte, message any) error {
+	if isJSON(data) {
+		return json.Unmarshal(data, message)
+	}
+	switch m := message.(type) {
+	case *CompressedMsgSchema:
+		var pb jobspb.CompressJob
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return err
+		}
+		*m = CompressedMsgSchema{
+			UID:              pb.Uid,
+			OriginalFilePath: pb.OriginalFilePath,
+			Algorithm:        pb.Algorithm,
+			Level:            int(pb.Level),
+			Archive:          pb.Archive,
+			FileName:         pb.FileName,
+			ContentType:      pb.ContentType,
+			KMSKeyName:       pb.KmsKeyName,
+			Verify:           pb.Verify,
+			Dictionary:       pb.Dictionary,
+			Parts:            int(pb.Parts),
+			Part:             int(pb.Part),
+			Offset:           pb.Offset,
+			Length:           pb.Length,
+			SourceBucket:     pb.SourceBucket,
+			ResultBucket:     pb.ResultBucket,
+			ResultPath:       pb.ResultPath,
+			Segment:          int(pb.Segment),
+		}
+		return checkVersion(pb.Version)
+	case *DecompressedMsgSchema:
+		var pb jobspb.DecompressJob
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return err
+		}
+		*m = DecompressedMsgSchema{
+			UID:                pb.Uid,
+			CompressedFilePath: pb.CompressedFilePath,
+			Algorithm:          pb.Algorithm,
+			KMSKeyName:         pb.KmsKeyName,
+		}
+		return checkVersion(pb.Version)
+	}
+	return fmt.Errorf("no message schema for %T", message)
+}
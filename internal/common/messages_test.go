@@ -0,0 +1,93 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common/jobspb"
+)
+
+func TestMessages(t *testing.T) {
+	compress := CompressedMsgSchema{
+		UID:              "job",
+		OriginalFilePath: "job/original_a.txt",
+		Algorithm:        AlgorithmZstd,
+		Level:            3,
+		FileName:         "a.txt",
+		Dictionary:       "dict",
+		Parts:            4,
+		Part:             2,
+		Offset:           1 << 33,
+		Length:           1 << 20,
+	}
+	decompress := DecompressedMsgSchema{UID: "job", CompressedFilePath: "job/compressed.ranran", KMSKeyName: "key"}
+
+	data, err := MarshalMessage(compress)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var gotCompress CompressedMsgSchema
+	if err := UnmarshalMessage(data, &gotCompress); err != nil || gotCompress != compress {
+		t.Errorf("Expected %+v back, got %+v, %v", compress, gotCompress, err)
+	}
+	data, _ = MarshalMessage(decompress)
+	var gotDecompress DecompressedMsgSchema
+	if err := UnmarshalMessage(data, &gotDecompress); err != nil || gotDecompress != decompress {
+		t.Errorf("Expected %+v back, got %+v, %v", decompress, gotDecompress, err)
+	}
+
+	t.Run("json", func(t *testing.T) {
+		data, _ := json.Marshal(compress)
+		var got CompressedMsgSchema
+		if err := UnmarshalMessage(data, &got); err != nil || got != compress {
+			t.Errorf("Expected the JSON of earlier releases to be read, got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("in-place", func(t *testing.T) {
+		var pb jobspb.CompressJob
+		data, _ := MarshalMessage(compress)
+		proto.Unmarshal(data, &pb)
+		if pb.Version != 1 {
+			t.Errorf("Expected other messages to keep version 1, got %d", pb.Version)
+		}
+
+		inPlace := compress
+		inPlace.SourceBucket, inPlace.ResultBucket, inPlace.ResultPath = "user", "user", "logs/a.txt.zst"
+		data, _ = MarshalMessage(inPlace)
+		proto.Unmarshal(data, &pb)
+		var got CompressedMsgSchema
+		if err := UnmarshalMessage(data, &got); err != nil || got != inPlace || pb.Version != 2 {
+			t.Errorf("Expected %+v back in version 2, got %+v in version %d, %v", inPlace, got, pb.Version, err)
+		}
+	})
+
+	t.Run("segment", func(t *testing.T) {
+		segment := CompressedMsgSchema{UID: "job", OriginalFilePath: "job/segment_a.log", Algorithm: AlgorithmZstd, Segment: 3}
+		data, _ := MarshalMessage(segment)
+		var pb jobspb.CompressJob
+		proto.Unmarshal(data, &pb)
+		var got CompressedMsgSchema
+		if err := UnmarshalMessage(data, &got); err != nil || got != segment || pb.Version != 3 {
+			t.Errorf("Expected %+v back in version 3, got %+v in version %d, %v", segment, got, pb.Version, err)
+		}
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		data, _ := proto.Marshal(&jobspb.DecompressJob{Version: MessageVersion + 1, Uid: "job"})
+		var got DecompressedMsgSchema
+		if err := UnmarshalMessage(data, &got); !errors.Is(err, ErrUnsupportedMessageVersion) || IsPermanent(err) || got.UID != "job" {
+			t.Errorf("Expected a retryable version error, got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("garbage", func(t *testing.T) {
+		var got CompressedMsgSchema
+		if err := UnmarshalMessage([]byte("not a message"), &got); err == nil {
+			t.Error("Expected garbage to fail")
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+// oidcAlgorithms are the signature algorithms accepted in bearer tokens.
+var oidcAlgorithms = []jose.SignatureAlgorithm{jose.RS256, jose.RS384, jose.RS512, jose.PS256, jose.ES256, jose.ES384, jose.ES512, jose.EdDSA}
+
+// oidcKeysRefresh is how often the keys of the provider are fetched again at
+// most, when a token is signed with a key they don't have.
+const oidcKeysRefresh = time.Minute
+
+// ErrInvalidToken rejects a bearer token that doesn't check out, as opposed to
+// a provider that can't be reached.
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// OIDCVerifier validates bearer JWTs issued by an OIDC provider, with the
+// keys it publishes at the jwks_uri of its discovery document.
+type OIDCVerifier struct {
+	issuer   string
+	audience string
+	client   *http.Client
+
+	mu      sync.Mutex
+	keys    *jose.JSONWebKeySet
+	fetched time.Time
+}
+
+// NewOIDCVerifier accepts tokens of issuer with audience among theirs.
+func NewOIDCVerifier(issuer, audience string) *OIDCVerifier {
+	return &OIDCVerifier{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		audience: audience,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// OIDCClaims are what a valid token says about whom it was issued to.
+type OIDCClaims struct {
+	Subject string `json:"sub"`
+	// Email is set for service accounts and users that shared it.
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// Verify checks the signature, issuer, audience and expiry of token and
+// returns its claims.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (OIDCClaims, error) {
+	tok, err := jwt.ParseSigned(token, oidcAlgorithms)
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	key, err := v.key(ctx, tok.Headers[0].KeyID)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	var claims jwt.Claims
+	var identity OIDCClaims
+	if err := tok.Claims(key, &claims, &identity); err != nil {
+		return OIDCClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	expected := jwt.Expected{Issuer: v.issuer, AnyAudience: jwt.Audience{v.audience}, Time: time.Now()}
+	if err := claims.ValidateWithLeeway(expected, time.Minute); err != nil {
+		return OIDCClaims{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Expiry == nil || claims.Subject == "" {
+		return OIDCClaims{}, fmt.Errorf("%w: no expiry or subject", ErrInvalidToken)
+	}
+	return identity, nil
+}
+
+// key returns the key of the provider with ID kid, fetching its keys when
+// they were never fetched or don't have it.
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.keys == nil || (len(v.keys.Key(kid)) == 0 && time.Since(v.fetched) > oidcKeysRefresh) {
+		keys, err := v.fetchKeys(ctx)
+		if err != nil {
+			if v.keys == nil {
+				return nil, err
+			}
+			// keep using the keys we have, the provider may be back later
+		} else {
+			v.keys, v.fetched = keys, time.Now()
+		}
+	}
+	matching := v.keys.Key(kid)
+	if len(matching) == 0 {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	return &matching[0], nil
+}
+
+// fetchKeys reads the discovery document of the provider, then the keys it
+// points to.
+func (v *OIDCVerifier) fetchKeys(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.getJSON(ctx, v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != v.issuer || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s names issuer %q and keys %q", v.issuer, discovery.Issuer, discovery.JWKSURI)
+	}
+	var keys jose.JSONWebKeySet
+	if err := v.getJSON(ctx, discovery.JWKSURI, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+)
+
+// NewParallelReader reads the object described by info in parts of partSize
+// bytes, with up to parallelism range reads at a time, and returns them in
+// order. At most parallelism parts are held in memory, those being read
+// included, so a slow consumer stops the reads rather than buffering the
+// object. Ranges aren't checked by ChecksumStorage, so the whole is verified
+// against the CRC32C in info instead.
+func NewParallelReader(ctx context.Context, backend StorageBackend, bucket string, info ObjectInfo, partSize int64, parallelism int) ObjectReaderInterface {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &parallelReader{
+		cancel: cancel,
+		parts:  make(chan chan partResult, parallelism),
+		slots:  make(chan struct{}, parallelism),
+	}
+	go r.dispatch(ctx, backend, bucket, info, partSize)
+	if !info.HasCRC32C {
+		return r
+	}
+	return &checksumReader{r: r, object: info.Name, version: info.Version, want: info.CRC32C, crc: crc32.New(castagnoli)}
+}
+
+// partResult is one part of the object, or why it couldn't be read.
+type partResult struct {
+	data []byte
+	err  error
+}
+
+type parallelReader struct {
+	cancel context.CancelFunc
+	// parts are the parts being read, in order, each delivered once read
+	parts chan chan partResult
+	// slots limits the parts read or held at once
+	slots chan struct{}
+	// cur is what is left of the part being consumed
+	cur    []byte
+	inSlot bool
+	err    error
+}
+
+// dispatch starts reading the parts in order as slots free up.
+func (r *parallelReader) dispatch(ctx context.Context, backend StorageBackend, bucket string, info ObjectInfo, partSize int64) {
+	defer close(r.parts)
+	for offset := int64(0); offset < info.Size; offset += partSize {
+		select {
+		case r.slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		result := make(chan partResult, 1)
+		r.parts <- result
+		go func(offset, length int64) {
+			data, err := readRange(ctx, backend, bucket, info.Name, offset, length)
+			result <- partResult{data: data, err: err}
+		}(offset, min(partSize, info.Size-offset))
+	}
+}
+
+// readRange reads length bytes of object from offset, failing when there
+// are fewer.
+func readRange(ctx context.Context, backend StorageBackend, bucket, object string, offset, length int64) ([]byte, error) {
+	rc, err := backend.NewRangeReader(ctx, bucket, object, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rc, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *parallelReader) Read(p []byte) (int, error) {
+	for len(r.cur) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.inSlot {
+			<-r.slots
+			r.inSlot = false
+		}
+		result, ok := <-r.parts
+		if !ok {
+			r.err = io.EOF
+			continue
+		}
+		part := <-result
+		r.cur, r.err, r.inSlot = part.data, part.err, true
+	}
+	n := copy(p, r.cur)
+	r.cur = r.cur[n:]
+	return n, nil
+}
+
+// Close stops the reads still going on.
+func (r *parallelReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeStorage serves range reads of one object from memory, counting them.
+type rangeStorage struct {
+	StorageBackend
+	data []byte
+	// failAt fails the read of the range at that offset
+	failAt int64
+
+	mu     sync.Mutex
+	opened int
+}
+
+func (s *rangeStorage) NewRangeReader(_ context.Context, _, _ string, offset, length int64) (ObjectReaderInterface, error) {
+	s.mu.Lock()
+	s.opened++
+	s.mu.Unlock()
+	if offset == s.failAt {
+		return nil, errUnavailable
+	}
+	return io.NopCloser(bytes.NewReader(s.data[offset : offset+length])), nil
+}
+
+func (s *rangeStorage) openedRanges() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opened
+}
+
+func TestParallelReader(t *testing.T) {
+	var content bytes.Buffer
+	for i := 0; content.Len() < 10000; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	data := content.Bytes()
+	info := ObjectInfo{Name: "big", Size: int64(len(data)), CRC32C: crc32.Checksum(data, castagnoli), HasCRC32C: true}
+
+	testCases := []struct {
+		name    string
+		info    ObjectInfo
+		failAt  int64
+		wantErr error
+	}{
+		{name: "verified", info: info},
+		{name: "without checksum", info: ObjectInfo{Name: "big", Size: info.Size}},
+		{name: "corrupted", info: ObjectInfo{Name: "big", Size: info.Size, CRC32C: info.CRC32C + 1, HasCRC32C: true}, wantErr: ErrObjectChecksum},
+		{name: "failed range", info: info, failAt: 700, wantErr: errUnavailable},
+		{name: "empty", info: ObjectInfo{Name: "empty", HasCRC32C: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := &rangeStorage{data: data, failAt: -1}
+			if tc.failAt > 0 {
+				backend.failAt = tc.failAt
+			}
+			r := NewParallelReader(context.Background(), backend, "b", tc.info, 100, 4)
+			defer r.Close()
+			got, err := io.ReadAll(r)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Expected %v, got %v", tc.wantErr, err)
+			}
+			if err == nil && !bytes.Equal(got, data[:tc.info.Size]) {
+				t.Errorf("Expected the object in order, got %d bytes", len(got))
+			}
+		})
+	}
+
+	t.Run("bounded", func(t *testing.T) {
+		backend := &rangeStorage{data: data, failAt: -1}
+		r := NewParallelReader(context.Background(), backend, "b", info, 100, 3)
+		defer r.Close()
+		if _, err := r.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if opened := backend.openedRanges(); opened > 3 {
+			t.Errorf("Expected at most 3 parts read ahead of the reader, got %d", opened)
+		}
+		if _, err := io.ReadAll(r); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if opened, want := backend.openedRanges(), (len(data)+99)/100; opened != want {
+			t.Errorf("Expected %d ranges, got %d", want, opened)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+package common
+
+// PartRange returns the byte range of part, numbered from 1, when size bytes
+// are split into parts of the same length. The last part may be shorter.
+func PartRange(size int64, parts, part int) (offset, length int64) {
+	partSize := (size + int64(parts) - 1) / int64(parts)
+	offset = min(int64(part-1)*partSize, size)
+	return offset, min(partSize, size-offset)
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Job priorities. Jobs submitted without one are normal.
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities lists the priorities from the highest.
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ValidPriority reports whether priority can be given to a job.
+func ValidPriority(priority string) bool {
+	switch priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// PriorityTopic names the topic, or subscription, that jobs of priority use
+// in place of id. Normal jobs keep id itself so that deployments without
+// priority topics work as before; the others add "-high" or "-low".
+func PriorityTopic(id, priority string) string {
+	if priority == "" || priority == PriorityNormal {
+		return id
+	}
+	return id + "-" + priority
+}
+
+// ParsePriorityWeights reads weights like "high=4,normal=2,low=1". A priority
+// left out, or weighted 0, is not received at all.
+func ParsePriorityWeights(value string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		priority, weight, ok := strings.Cut(pair, "=")
+		if !ok || priority == "" || !ValidPriority(priority) {
+			return nil, fmt.Errorf("invalid priority weight %q", pair)
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid priority weight %q", pair)
+		}
+		if n > 0 {
+			weights[priority] = n
+		}
+	}
+	return weights, nil
+}
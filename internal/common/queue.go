@@ -0,0 +1,190 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+)
+
+// QueueInterface is a message queue workers can also receive from.
+type QueueInterface interface {
+	PubSubClientInterface
+	// Receive calls handler with the messages of the subscription until ctx
+	// is done.
+	Receive(ctx context.Context, subID string, handler func(context.Context, MessageInterface)) error
+}
+
+// NewQueue connects to the message queue named by QUEUE_BACKEND, "pubsub" (the
+// default) or "kafka". Kafka brokers come from the comma-separated
+// KAFKA_BROKERS, and KAFKA_SUBSCRIPTIONS maps consumer groups to the topics
+// they read as "group=topic,...". Pub/Sub leases are extended for up to
+// ACK_MAX_EXTENSION, by ACK_EXTENSION_PERIOD at a time. Publishing stops for
+// a while once too many publishes fail, see NewBreakerQueue. The returned
+// function releases the connection.
+func NewQueue(ctx context.Context) (QueueInterface, func() error, error) {
+	switch backend := os.Getenv("QUEUE_BACKEND"); backend {
+	case "", "pubsub":
+		client, err := pubsub.NewClient(ctx, os.Getenv("GCP_PROJECT_ID"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot create Pub/Sub client: %w", err)
+		}
+		return NewBreakerQueue(&RealPubSubClient{
+			Client: client,
+			// leases outlast the longest a worker spends on a job, so that
+			// long jobs aren't redelivered to another worker halfway through
+			MaxExtension:       GetEnvDuration("ACK_MAX_EXTENSION", GetEnvDuration("PROCESSING_TIMEOUT", 2*time.Hour)+10*time.Minute),
+			AckExtensionPeriod: GetEnvDuration("ACK_EXTENSION_PERIOD", 0),
+		}), client.Close, nil
+	case "kafka":
+		brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
+		if brokers[0] == "" {
+			return nil, nil, fmt.Errorf("KAFKA_BROKERS is not set")
+		}
+		subscriptions := make(map[string]string)
+		for _, pair := range strings.Split(os.Getenv("KAFKA_SUBSCRIPTIONS"), ",") {
+			if group, topic, ok := strings.Cut(pair, "="); ok {
+				subscriptions[group] = topic
+			}
+		}
+		queue := NewKafkaQueue(brokers, subscriptions)
+		return NewBreakerQueue(queue), queue.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown queue backend %q", backend)
+	}
+}
+
+func (c *RealPubSubClient) Receive(ctx context.Context, subID string, handler func(context.Context, MessageInterface)) error {
+	sub := c.Client.Subscriber(subID)
+	if c.MaxExtension != 0 {
+		sub.ReceiveSettings.MaxExtension = c.MaxExtension
+	}
+	if c.AckExtensionPeriod != 0 {
+		sub.ReceiveSettings.MaxDurationPerAckExtension = c.AckExtensionPeriod
+	}
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		handler(ctx, &RealMessage{Msg: msg})
+	})
+}
+
+// MemoryQueue is a QueueInterface held in process, for running the manager
+// and workers together without Pub/Sub. Every topic has one subscription of
+// the same name. Nacked messages are delivered again after RedeliveryDelay,
+// and nothing survives a restart.
+type MemoryQueue struct {
+	RedeliveryDelay time.Duration
+
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	nextID int
+}
+
+type memoryTopic struct {
+	pending []*memoryMessage
+	// ready is signalled whenever a message is added
+	ready chan struct{}
+}
+
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{RedeliveryDelay: time.Second, topics: make(map[string]*memoryTopic)}
+}
+
+func (q *MemoryQueue) topic(id string) *memoryTopic {
+	t, ok := q.topics[id]
+	if !ok {
+		t = &memoryTopic{ready: make(chan struct{}, 1)}
+		q.topics[id] = t
+	}
+	return t
+}
+
+func (q *MemoryQueue) push(topicID string, msg *memoryMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t := q.topic(topicID)
+	t.pending = append(t.pending, msg)
+	select {
+	case t.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *MemoryQueue) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
+	q.mu.Lock()
+	q.nextID++
+	id := strconv.Itoa(q.nextID)
+	q.mu.Unlock()
+
+	q.push(topicID, &memoryMessage{queue: q, topicID: topicID, data: msg.Data, attributes: msg.Attributes})
+	return id, nil
+}
+
+func (q *MemoryQueue) CheckTopic(ctx context.Context, topicID string) error {
+	return nil
+}
+
+func (q *MemoryQueue) CheckSubscription(ctx context.Context, subID string) error {
+	return nil
+}
+
+// Receive handles one message at a time. A message the handler neither acks
+// nor nacks is dropped.
+func (q *MemoryQueue) Receive(ctx context.Context, subID string, handler func(context.Context, MessageInterface)) error {
+	q.mu.Lock()
+	t := q.topic(subID)
+	q.mu.Unlock()
+
+	for {
+		q.mu.Lock()
+		var msg *memoryMessage
+		if len(t.pending) > 0 {
+			msg, t.pending = t.pending[0], t.pending[1:]
+		}
+		q.mu.Unlock()
+
+		if msg == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-t.ready:
+			}
+			continue
+		}
+		msg.attempt++
+		handler(ctx, msg)
+	}
+}
+
+// memoryMessage is one delivery of a message published to a MemoryQueue.
+type memoryMessage struct {
+	queue      *MemoryQueue
+	topicID    string
+	data       []byte
+	attributes map[string]string
+	attempt    int
+}
+
+func (m *memoryMessage) Ack() {}
+
+func (m *memoryMessage) Nack() {
+	time.AfterFunc(m.queue.RedeliveryDelay, func() {
+		m.queue.push(m.topicID, m)
+	})
+}
+
+func (m *memoryMessage) GetData() []byte {
+	return m.data
+}
+
+func (m *memoryMessage) Attributes() map[string]string {
+	return m.attributes
+}
+
+func (m *memoryMessage) DeliveryAttempt() int {
+	return m.attempt
+}
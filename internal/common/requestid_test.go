@@ -0,0 +1,27 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(requestIDHandler{slog.NewJSONHandler(&buf, nil)}).With("service", "test")
+
+	logger.InfoContext(WithRequestID(context.Background(), "trace-1"), "with a request")
+	logger.Info("without one")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %q", buf.String())
+	}
+	if !strings.Contains(lines[0], `"request_id":"trace-1"`) || !strings.Contains(lines[0], `"service":"test"`) {
+		t.Errorf("expected the request ID on the record, got %s", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("expected no request ID without one in the context, got %s", lines[1])
+	}
+}
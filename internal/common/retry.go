@@ -0,0 +1,297 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// RetryPolicy decides how often and how patiently failed storage calls are
+// retried.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try, 1 turns retries off.
+	MaxAttempts int
+	// The delay before the nth retry is picked at random up to
+	// InitialBackoff * 2^(n-1), capped at MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// WriteBuffer is how much of an object written is kept to write it
+	// again, objects larger than that are only tried once.
+	WriteBuffer int
+}
+
+// RetryPolicyFromEnv reads the policy from STORAGE_RETRY_MAX_ATTEMPTS,
+// STORAGE_RETRY_INITIAL_BACKOFF, STORAGE_RETRY_MAX_BACKOFF and
+// STORAGE_RETRY_WRITE_BUFFER.
+func RetryPolicyFromEnv() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    GetEnvInt("STORAGE_RETRY_MAX_ATTEMPTS", 4),
+		InitialBackoff: GetEnvDuration("STORAGE_RETRY_INITIAL_BACKOFF", 100*time.Millisecond),
+		MaxBackoff:     GetEnvDuration("STORAGE_RETRY_MAX_BACKOFF", 5*time.Second),
+		WriteBuffer:    GetEnvInt("STORAGE_RETRY_WRITE_BUFFER", 8<<20),
+	}
+}
+
+// IsRetryable reports whether a storage call that failed with err may
+// succeed when made again: server errors, throttling, timeouts and dropped
+// connections. Failures like missing objects or failed preconditions are
+// answers, not accidents, and aren't retried.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code)
+	}
+	// S3 errors carry their HTTP response
+	var httpErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &httpErr) {
+		return retryableStatus(httpErr.HTTPStatusCode())
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff returns the delay before retry number n, counting from 1.
+func (p RetryPolicy) backoff(n int) time.Duration {
+	limit := p.MaxBackoff
+	if shift := n - 1; shift < 32 && p.InitialBackoff<<shift > 0 && p.InitialBackoff<<shift < limit {
+		limit = p.InitialBackoff << shift
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit + 1)
+}
+
+// Do calls op until it succeeds, fails for good, the attempts run out or ctx
+// is done, waiting between attempts. It returns the last error of op.
+func (p RetryPolicy) Do(ctx context.Context, name string, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if attempt >= p.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := p.backoff(attempt)
+		slog.Warn("Retrying storage call", "call", name, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// RetryingStorage retries the calls of a StorageBackend that fail
+// transiently, see IsRetryable. Reads that break off are resumed where they
+// stopped, writes are tried again with what was written so far as long as
+// it fits in the policy's WriteBuffer. A write retried after an ambiguous
+// failure may find its own earlier attempt and fail its precondition.
+type RetryingStorage struct {
+	StorageBackend
+	Policy RetryPolicy
+}
+
+// NewRetryingStorage wraps backend to retry by policy.
+func NewRetryingStorage(backend StorageBackend, policy RetryPolicy) *RetryingStorage {
+	return &RetryingStorage{StorageBackend: backend, Policy: policy}
+}
+
+func (s *RetryingStorage) NewObjectReader(ctx context.Context, bucket, object string) (ObjectReaderInterface, error) {
+	return s.NewRangeReader(ctx, bucket, object, 0, -1)
+}
+
+func (s *RetryingStorage) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (ObjectReaderInterface, error) {
+	r := &retryReader{s: s, ctx: ctx, bucket: bucket, object: object, offset: offset, length: length}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *RetryingStorage) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := s.Policy.Do(ctx, "stat "+object, func() error {
+		var err error
+		info, err = s.StorageBackend.StatObject(ctx, bucket, object)
+		return err
+	})
+	return info, err
+}
+
+func (s *RetryingStorage) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := s.Policy.Do(ctx, "list "+prefix, func() error {
+		var err error
+		objects, err = s.StorageBackend.ListObjects(ctx, bucket, prefix)
+		return err
+	})
+	return objects, err
+}
+
+func (s *RetryingStorage) DeleteObject(ctx context.Context, bucket, object string) error {
+	return s.Policy.Do(ctx, "delete "+object, func() error {
+		return s.StorageBackend.DeleteObject(ctx, bucket, object)
+	})
+}
+
+// retryReader reads a range of an object, opening it again after the bytes
+// already read when reading fails transiently.
+type retryReader struct {
+	s              *RetryingStorage
+	ctx            context.Context
+	bucket, object string
+	// offset is where the next byte comes from, length how many are left
+	// or -1 for all of them
+	offset, length int64
+	r              ObjectReaderInterface
+	// err is set once the reader couldn't be resumed
+	err error
+}
+
+func (r *retryReader) open() error {
+	return r.s.Policy.Do(r.ctx, "read "+r.object, func() error {
+		var err error
+		r.r, err = r.s.StorageBackend.NewRangeReader(r.ctx, r.bucket, r.object, r.offset, r.length)
+		return err
+	})
+}
+
+func (r *retryReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for attempt := 1; ; attempt++ {
+		n, err := r.r.Read(p)
+		r.offset += int64(n)
+		if r.length >= 0 {
+			r.length -= int64(n)
+		}
+		if err == nil || err == io.EOF || !IsRetryable(err) || attempt >= r.s.Policy.MaxAttempts {
+			return n, err
+		}
+		// resume after what was read with a new reader, which open retries
+		// on its own
+		r.r.Close()
+		slog.Warn("Resuming interrupted read", "object", r.object, "offset", r.offset, "error", err)
+		select {
+		case <-r.ctx.Done():
+			r.err = err
+			return n, err
+		case <-time.After(r.s.Policy.backoff(attempt)):
+		}
+		if err := r.open(); err != nil {
+			r.err = fmt.Errorf("failed to resume read: %w", err)
+			return n, r.err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *retryReader) Close() error {
+	if r.err != nil {
+		return nil
+	}
+	return r.r.Close()
+}
+
+func (s *RetryingStorage) NewObjectWriter(ctx context.Context, bucket, object string, opts ...ObjectWriterOption) ObjectWriterInterface {
+	w := &retryWriter{s: s, ctx: ctx, bucket: bucket, object: object, opts: opts}
+	w.open()
+	return w
+}
+
+// retryWriter keeps what is written to it up to the policy's WriteBuffer, so
+// that a failed upload can be made again from the start.
+type retryWriter struct {
+	s              *RetryingStorage
+	ctx            context.Context
+	bucket, object string
+	opts           []ObjectWriterOption
+	w              ObjectWriterInterface
+	// cancel abandons the upload of w
+	cancel context.CancelFunc
+	buf    []byte
+	// overflow is set once more was written than fits in buf
+	overflow bool
+}
+
+func (w *retryWriter) open() {
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.w, w.cancel = w.s.StorageBackend.NewObjectWriter(ctx, w.bucket, w.object, w.opts...), cancel
+}
+
+// retry abandons the current upload after it failed with err and makes it
+// again from the buffer, closing it if close is set.
+func (w *retryWriter) retry(err error, close bool) error {
+	if w.overflow {
+		return err
+	}
+	failed := true
+	return w.s.Policy.Do(w.ctx, "write "+w.object, func() error {
+		// the failure at hand is the first attempt
+		if failed {
+			failed = false
+			return err
+		}
+		w.cancel()
+		w.open()
+		if _, err := w.w.Write(w.buf); err != nil {
+			return err
+		}
+		if close {
+			return w.w.Close()
+		}
+		return nil
+	})
+}
+
+func (w *retryWriter) Write(p []byte) (int, error) {
+	if !w.overflow {
+		if len(w.buf)+len(p) <= w.s.Policy.WriteBuffer {
+			w.buf = append(w.buf, p...)
+		} else {
+			w.overflow, w.buf = true, nil
+		}
+	}
+	n, err := w.w.Write(p)
+	if err != nil {
+		// the buffer holds p too, so a successful retry wrote all of it
+		if err = w.retry(err, false); err == nil {
+			n = len(p)
+		}
+	}
+	return n, err
+}
+
+func (w *retryWriter) Close() error {
+	err := w.w.Close()
+	if err != nil {
+		err = w.retry(err, true)
+	}
+	w.cancel()
+	return err
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+var errUnavailable = &googleapi.Error{Code: 503, Message: "backend unavailable"}
+
+// flakyStorage keeps objects in memory, failing the number of calls in fail
+// with a transient error first.
+type flakyStorage struct {
+	StorageBackend
+	objects map[string][]byte
+	fail    int
+	// breakAfter makes readers fail once after that many bytes
+	breakAfter int
+	opened     []int64
+}
+
+func (s *flakyStorage) flake() error {
+	if s.fail > 0 {
+		s.fail--
+		return errUnavailable
+	}
+	return nil
+}
+
+func (s *flakyStorage) NewRangeReader(_ context.Context, _, object string, offset, length int64) (ObjectReaderInterface, error) {
+	if err := s.flake(); err != nil {
+		return nil, err
+	}
+	data, ok := s.objects[object]
+	if !ok {
+		return nil, ErrObjectNotExist
+	}
+	data = data[offset:]
+	if length >= 0 {
+		data = data[:length]
+	}
+	s.opened = append(s.opened, offset)
+	r := &flakyReader{r: bytes.NewReader(data), left: -1}
+	if s.breakAfter > 0 {
+		r.left, s.breakAfter = s.breakAfter, 0
+	}
+	return r, nil
+}
+
+func (s *flakyStorage) StatObject(_ context.Context, _, object string) (ObjectInfo, error) {
+	if err := s.flake(); err != nil {
+		return ObjectInfo{}, err
+	}
+	data, ok := s.objects[object]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotExist
+	}
+	return ObjectInfo{Name: object, Size: int64(len(data))}, nil
+}
+
+func (s *flakyStorage) NewObjectWriter(_ context.Context, _, object string, _ ...ObjectWriterOption) ObjectWriterInterface {
+	return &flakyWriter{s: s, object: object}
+}
+
+type flakyReader struct {
+	r    io.Reader
+	left int
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if r.left > 0 && len(p) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.r.Read(p)
+	if r.left > 0 {
+		r.left -= n
+	}
+	return n, err
+}
+
+func (r *flakyReader) Close() error { return nil }
+
+type flakyWriter struct {
+	s      *flakyStorage
+	object string
+	buf    bytes.Buffer
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *flakyWriter) Close() error {
+	if err := w.s.flake(); err != nil {
+		return err
+	}
+	w.s.objects[w.object] = w.buf.Bytes()
+	return nil
+}
+
+var testPolicy = RetryPolicy{MaxAttempts: 3, WriteBuffer: 1 << 10}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want bool
+	}{
+		{errUnavailable, true},
+		{fmt.Errorf("failed to read: %w", &googleapi.Error{Code: 429}), true},
+		{&googleapi.Error{Code: 403}, false},
+		{io.ErrUnexpectedEOF, true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{ErrObjectNotExist, false},
+		{ErrVersionMismatch, false},
+		{errors.New("bad request"), false},
+	}
+	for _, tc := range testCases {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryingStorage(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	t.Run("read", func(t *testing.T) {
+		backend := &flakyStorage{objects: map[string][]byte{"a": data}, fail: 2, breakAfter: 300}
+		r, err := NewRetryingStorage(backend, testPolicy).NewObjectReader(ctx, "bucket", "a")
+		if err != nil {
+			t.Fatalf("Expected the reader to open on the third attempt, got %v", err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("Expected the whole object, got %d bytes, %v", len(got), err)
+		}
+		if len(backend.opened) != 2 || backend.opened[1] != 300 {
+			t.Errorf("Expected the read to resume at 300, opened at %v", backend.opened)
+		}
+	})
+
+	t.Run("out of attempts", func(t *testing.T) {
+		backend := &flakyStorage{objects: map[string][]byte{"a": data}, fail: 3}
+		if _, err := NewRetryingStorage(backend, testPolicy).StatObject(ctx, "bucket", "a"); !errors.Is(err, errUnavailable) {
+			t.Errorf("Expected the last failure, got %v", err)
+		}
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		backend := &flakyStorage{objects: map[string][]byte{}, fail: 0}
+		if _, err := NewRetryingStorage(backend, testPolicy).StatObject(ctx, "bucket", "a"); !errors.Is(err, ErrObjectNotExist) {
+			t.Errorf("Expected a missing object, got %v", err)
+		}
+	})
+
+	t.Run("write", func(t *testing.T) {
+		backend := &flakyStorage{objects: map[string][]byte{}, fail: 1}
+		w := NewRetryingStorage(backend, testPolicy).NewObjectWriter(ctx, "bucket", "b")
+		w.Write(data[:500])
+		w.Write(data[500:])
+		if err := w.Close(); err != nil || !bytes.Equal(backend.objects["b"], data) {
+			t.Fatalf("Expected the write to be made again, got %d bytes, %v", len(backend.objects["b"]), err)
+		}
+	})
+
+	t.Run("write too large", func(t *testing.T) {
+		backend := &flakyStorage{objects: map[string][]byte{}, fail: 1}
+		w := NewRetryingStorage(backend, testPolicy).NewObjectWriter(ctx, "bucket", "b")
+		w.Write(data)
+		w.Write(data)
+		if err := w.Close(); !errors.Is(err, errUnavailable) {
+			t.Errorf("Expected a write beyond the buffer to fail, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// RealS3Client stores objects in AWS S3 or anything speaking its API. KMS
+// keys are applied as SSE-KMS, so they have to be AWS key IDs or ARNs.
+type RealS3Client struct {
+	Client *s3.Client
+}
+
+func (c *RealS3Client) NewObjectWriter(ctx context.Context, bucket, object string, opts ...ObjectWriterOption) ObjectWriterInterface {
+	o := NewObjectWriterOptions(opts...)
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(object),
+		Metadata: o.Metadata,
+	}
+	if o.ContentType != "" {
+		input.ContentType = aws.String(o.ContentType)
+	}
+	if o.KMSKeyName != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(o.KMSKeyName)
+	}
+	w := &s3Writer{done: make(chan error, 1)}
+	if o.IfNotExists {
+		input.IfNoneMatch = aws.String("*")
+		w.preconditionErr = ErrObjectExists
+	}
+	if o.IfVersionMatch != "" {
+		input.IfMatch = aws.String(o.IfVersionMatch)
+		w.preconditionErr = ErrVersionMismatch
+	}
+
+	// the uploader reads the body as it is written, in parts for large objects
+	pr, pw := io.Pipe()
+	input.Body = pr
+	w.pw = pw
+	go func() {
+		_, err := manager.NewUploader(c.Client).Upload(ctx, input)
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+// s3Writer commits the object when closed, like a GCS writer.
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+	// preconditionErr is returned when the write's condition didn't hold
+	preconditionErr error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	w.pw.Close()
+	err := <-w.done
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "PreconditionFailed" && w.preconditionErr != nil {
+		return w.preconditionErr
+	}
+	return err
+}
+
+func (c *RealS3Client) NewObjectReader(ctx context.Context, bucket, object string) (ObjectReaderInterface, error) {
+	out, err := c.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (c *RealS3Client) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (ObjectReaderInterface, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	out, err := c.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+		Range:  aws.String(byteRange),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// StatObject reports the ETag as the version, which S3 can match writes on.
+func (c *RealS3Client) StatObject(ctx context.Context, bucket, object string) (ObjectInfo, error) {
+	out, err := c.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return ObjectInfo{}, ErrObjectNotExist
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Name:     object,
+		Updated:  aws.ToTime(out.LastModified),
+		Size:     aws.ToInt64(out.ContentLength),
+		Version:  aws.ToString(out.ETag),
+		Metadata: out.Metadata,
+	}, nil
+}
+
+func (c *RealS3Client) SignURL(bucket, object string, opts SignedURLOptions) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+	}
+	if opts.ContentDisposition != "" {
+		input.ResponseContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	req, err := s3.NewPresignClient(c.Client).PresignGetObject(context.Background(), input, s3.WithPresignExpires(time.Until(opts.Expires)))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// SignUploadURL signs a single PUT of the whole object.
+func (c *RealS3Client) SignUploadURL(bucket, object string, expires time.Time, opts ...ObjectWriterOption) (SignedUpload, error) {
+	o := NewObjectWriterOptions(opts...)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+	}
+	if o.KMSKeyName != "" {
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		input.SSEKMSKeyId = aws.String(o.KMSKeyName)
+	}
+	// a presigned PUT has no range, only the exact length can be signed
+	if o.Size > 0 {
+		input.ContentLength = aws.Int64(o.Size)
+	}
+	req, err := s3.NewPresignClient(c.Client).PresignPutObject(context.Background(), input, s3.WithPresignExpires(time.Until(expires)))
+	if err != nil {
+		return SignedUpload{}, err
+	}
+	upload := SignedUpload{URL: req.URL, Method: req.Method, Headers: map[string]string{}}
+	for name, values := range req.SignedHeader {
+		// the HTTP client sets the host itself
+		if http.CanonicalHeaderKey(name) != "Host" && len(values) > 0 {
+			upload.Headers[name] = values[0]
+		}
+	}
+	return upload, nil
+}
+
+func (c *RealS3Client) CheckBucket(ctx context.Context, bucket string) error {
+	_, err := c.Client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	return err
+}
+
+func (c *RealS3Client) ListObjects(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(c.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Name:    aws.ToString(object.Key),
+				Updated: aws.ToTime(object.LastModified),
+				Size:    aws.ToInt64(object.Size),
+				Version: aws.ToString(object.ETag),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// DeleteObject relies on S3 treating deletes of missing objects as success.
+func (c *RealS3Client) DeleteObject(ctx context.Context, bucket, object string) error {
+	_, err := c.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object),
+	})
+	return err
+}
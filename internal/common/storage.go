@@ -0,0 +1,43 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// NewStorageBackend connects to the object storage named by STORAGE_BACKEND,
+// "gcs" (the default) or "s3". S3_ENDPOINT points the S3 client at another
+// service speaking its API. Transient failures are retried as
+// RetryPolicyFromEnv says, and calls stop for a while once too many fail,
+// see NewBreakerStorage. The returned function releases the connection.
+func NewStorageBackend(ctx context.Context) (StorageBackend, func() error, error) {
+	policy := RetryPolicyFromEnv()
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "gcs":
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot create GCS client: %w", err)
+		}
+		return NewBreakerStorage(NewRetryingStorage(&RealGCSClient{Client: client}, policy)), client.Close, nil
+	case "s3":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot load AWS config: %w", err)
+		}
+		client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+			if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+				o.BaseEndpoint = aws.String(endpoint)
+				o.UsePathStyle = true
+			}
+		})
+		return NewBreakerStorage(NewRetryingStorage(&RealS3Client{Client: client}, policy)), func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// storedBytes is the running total of bytes the jobs of an owner keep in the
+// bucket. The manager adds to it as jobs are submitted, the janitor takes
+// their share off once it expires them.
+type storedBytes struct {
+	Bytes int64 `json:"bytes"`
+}
+
+func storedBytesPath(owner string) string {
+	return fmt.Sprintf("usage/%s/stored.json", owner)
+}
+
+// StoredBytes returns how many bytes the unexpired jobs of owner take up.
+func StoredBytes(ctx context.Context, client StorageBackend, bucket, owner string) (int64, error) {
+	rc, err := client.NewObjectReader(ctx, bucket, storedBytesPath(owner))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read stored bytes: %w", err)
+	}
+	defer rc.Close()
+
+	var stored storedBytes
+	if err := json.NewDecoder(rc).Decode(&stored); err != nil {
+		return 0, fmt.Errorf("failed to decode stored bytes: %w", err)
+	}
+	return stored.Bytes, nil
+}
+
+// AddStoredBytes adds delta to the bytes stored for owner, never going below
+// zero. Concurrent updates are retried like in UpdateJob.
+func AddStoredBytes(ctx context.Context, client StorageBackend, bucket, owner string, delta int64) error {
+	if owner == "" || delta == 0 {
+		return nil
+	}
+	var err error
+	for range maxUpdateAttempts {
+		condition := WithIfNotExists()
+		info, statErr := client.StatObject(ctx, bucket, storedBytesPath(owner))
+		if statErr == nil {
+			condition = WithIfVersionMatch(info.Version)
+		} else if !errors.Is(statErr, ErrObjectNotExist) {
+			return fmt.Errorf("failed to stat stored bytes: %w", statErr)
+		}
+		current, readErr := StoredBytes(ctx, client, bucket, owner)
+		if readErr != nil {
+			return readErr
+		}
+
+		data, marshalErr := json.Marshal(storedBytes{Bytes: max(current+delta, 0)})
+		if marshalErr != nil {
+			return fmt.Errorf("failed to marshal stored bytes: %w", marshalErr)
+		}
+		wc := client.NewObjectWriter(ctx, bucket, storedBytesPath(owner), condition)
+		if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("failed to write stored bytes: %w", err)
+		}
+		if err = wc.Close(); err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrVersionMismatch) && !errors.Is(err, ErrObjectExists) {
+			return fmt.Errorf("failed to close stored bytes writer: %w", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X <package>.version=<sha>".
+var version string
+
+// Version identifies the build of the running binary: the version set at
+// build time, else the VCS revision Go recorded, else "unknown".
+func Version() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// WorkerInfo is what a worker reports about itself in the registry, refreshed
+// with every heartbeat.
+type WorkerInfo struct {
+	ID   string `json:"id"`
+	Host string `json:"host"`
+	// Mode is what the worker does: janitor, or the operations it handles
+	// joined by commas, like "compress,decompress".
+	Mode string `json:"mode"`
+	// Capacity is how many jobs the worker runs at once.
+	Capacity  int       `json:"capacity"`
+	Version   string    `json:"version"`
+	StartedAt time.Time `json:"started_at"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+func workerRecordPath(id string) string {
+	return fmt.Sprintf("workers/%s.json", id)
+}
+
+// SaveWorker writes the registry record of a worker. Only the worker itself
+// writes its record, so no precondition is needed.
+func SaveWorker(ctx context.Context, client StorageBackend, bucket string, worker *WorkerInfo) error {
+	data, err := json.Marshal(worker)
+	if err != nil {
+		return fmt.Errorf("failed to marshal worker record: %w", err)
+	}
+	wc := client.NewObjectWriter(ctx, bucket, workerRecordPath(worker.ID), WithContentType("application/json"))
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write worker record: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close worker record writer: %w", err)
+	}
+	return nil
+}
+
+// RemoveWorker deletes the registry record of a worker.
+func RemoveWorker(ctx context.Context, client StorageBackend, bucket, id string) error {
+	return client.DeleteObject(ctx, bucket, workerRecordPath(id))
+}
+
+// ListWorkers returns every worker in the registry, including those that
+// stopped without removing their record.
+func ListWorkers(ctx context.Context, client StorageBackend, bucket string) ([]*WorkerInfo, error) {
+	objects, err := client.ListObjects(ctx, bucket, "workers/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worker records: %w", err)
+	}
+	workers := make([]*WorkerInfo, 0, len(objects))
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Name, ".json") {
+			continue
+		}
+		rc, err := client.NewObjectReader(ctx, bucket, object.Name)
+		if err != nil {
+			// removed since it was listed
+			if errors.Is(err, ErrObjectNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read worker record: %w", err)
+		}
+		var worker WorkerInfo
+		err = json.NewDecoder(rc).Decode(&worker)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode worker record: %w", err)
+		}
+		workers = append(workers, &worker)
+	}
+	return workers, nil
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// quietPaths are polled by probes and scrapers, their requests are only
+// logged at debug level.
+var quietPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// accessLogEntry collects what handlers know about a request for its access
+// log record.
+type accessLogEntry struct {
+	jobID string
+}
+
+type accessLogKey struct{}
+
+// logJobID names the job a request created or acted on in its access log
+// record.
+func logJobID(r *http.Request, jobID string) {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessLogEntry); ok {
+		entry.jobID = jobID
+	}
+}
+
+// accessLogWriter records the status and size of a response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush progress streams.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingBody counts the bytes of a request body that were read.
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// withAccessLog logs every request once it was handled, with the job it was
+// about when there is one. The record carries the request ID of withRequestID.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &accessLogEntry{}
+		lw := &accessLogWriter{ResponseWriter: w}
+		body := &countingBody{ReadCloser: r.Body}
+		r = r.WithContext(context.WithValue(r.Context(), accessLogKey{}, entry))
+		r.Body = body
+		next.ServeHTTP(lw, r)
+
+		if lw.status == 0 {
+			lw.status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if quietPaths[r.URL.Path] {
+			level = slog.LevelDebug
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", lw.status),
+			slog.Duration("duration", time.Since(start)),
+			slog.Int64("bytes", lw.bytes),
+			slog.Int64("request_bytes", body.n),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if entry.jobID != "" {
+			attrs = append(attrs, slog.String("job_id", entry.jobID))
+		}
+		slog.LogAttrs(r.Context(), level, "HTTP request", attrs...)
+	})
+}
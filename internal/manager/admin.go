@@ -0,0 +1,255 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// maxRequeueJobs bounds how many jobs one requeue request may select.
+const maxRequeueJobs = 1000
+
+// errJobNotFailed aborts the requeue of a job that isn't FAILED, and
+// errNoInput that of an orphaned upload that never got a job.
+var (
+	errJobNotFailed = errors.New("job has not failed")
+	errNoInput      = errors.New("job has no input")
+)
+
+// registerAdminHandlers serves the endpoints for operators under /admin/ on
+// mux. Like the debug endpoints they need a token of their own, and nothing
+// is registered without one.
+func (app *Application) registerAdminHandlers(mux *http.ServeMux) {
+	if app.AdminToken == "" {
+		return
+	}
+	admin := newRouter(mux).with(func(h http.Handler) http.Handler {
+		return common.RequireBearerToken(app.AdminToken, "admin", h)
+	})
+	admin.handle("GET /admin/jobs/failed", app.failedJobsHandler)
+	admin.handle("POST /admin/jobs/requeue", app.requeueJobsHandler)
+	admin.handle("GET /admin/jobs/{id}/events", app.jobEventsHandler)
+	admin.handle("GET /admin/workers", app.workersHandler)
+}
+
+// jobEventsHandler returns a job along with its audit trail, to find out
+// where a stuck job got to.
+func (app *Application) jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupAnyJob(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	events, err := common.ListJobEvents(ctx, app.Storage, app.Bucket, job.ID)
+	if err != nil {
+		slog.Error("Failed to list job events", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"job": job, "events": events})
+}
+
+// jobMessage rebuilds the Pub/Sub message of a job from its record, along
+// with the topic it goes to.
+func (app *Application) jobMessage(job *common.Job) (string, any) {
+	if job.Operation == common.OperationDecompress {
+		return app.topicFor(app.DecompressTopicID, job.Priority), common.DecompressedMsgSchema{
+			UID:                job.ID,
+			CompressedFilePath: inputObjectPath(job),
+			Algorithm:          job.Algorithm,
+			KMSKeyName:         job.KMSKeyName,
+		}
+	}
+	return app.topicFor(app.CompressTopicID, job.Priority), common.CompressedMsgSchema{
+		UID:              job.ID,
+		OriginalFilePath: inputObjectPath(job),
+		Algorithm:        job.Algorithm,
+		Level:            job.Level,
+		Archive:          job.Archive,
+		FileName:         job.FileName,
+		ContentType:      job.ContentType,
+		KMSKeyName:       job.KMSKeyName,
+		Verify:           job.Verify,
+		Dictionary:       job.Dictionary,
+		// the message of a split job joins its parts, or enqueues them again
+		Parts: job.Parts,
+	}
+}
+
+// failedJob is a FAILED job with the message that requeuing it publishes.
+// Its Error says why it failed.
+type failedJob struct {
+	Job     *common.Job `json:"job"`
+	TopicID string      `json:"topic_id"`
+	Message any         `json:"message"`
+}
+
+// failedJobsHandler lists the FAILED jobs, most recently failed first. These
+// are the jobs whose messages went to the dead letter topic, or were dropped
+// without one.
+func (app *Application) failedJobsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	jobs, err := app.JobStore.ListJobs(ctx)
+	if err != nil {
+		slog.Error("Failed to list jobs", "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	failed := []failedJob{}
+	for _, job := range jobs {
+		if job.Status != common.JobFailed {
+			continue
+		}
+		topicID, message := app.jobMessage(job)
+		failed = append(failed, failedJob{Job: job, TopicID: topicID, Message: message})
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Job.UpdatedAt.After(failed[j].Job.UpdatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"jobs": failed})
+}
+
+// requeueRequest selects the jobs to requeue.
+type requeueRequest struct {
+	JobIDs []string `json:"job_ids"`
+}
+
+// requeueJobsHandler enqueues the selected FAILED jobs again as if they were
+// just submitted, with their attempts reset. Every job is requeued on its
+// own, the response lists which were and why the others weren't.
+func (app *Application) requeueJobsHandler(w http.ResponseWriter, r *http.Request) {
+	var req requeueRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.JobIDs) == 0 || len(req.JobIDs) > maxRequeueJobs {
+		common.WriteError(w, "Select between 1 and 1000 jobs", http.StatusBadRequest)
+		return
+	}
+
+	requeued := []string{}
+	rejected := map[string]string{}
+	for _, jobID := range req.JobIDs {
+		if errMsg := app.requeueJob(r.Context(), jobID); errMsg != "" {
+			rejected[jobID] = errMsg
+			continue
+		}
+		requeued = append(requeued, jobID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"requeued": requeued, "rejected": rejected})
+}
+
+// requeueJob moves a FAILED job back to PENDING and publishes its message
+// again. A non-empty message explains why it wasn't requeued.
+func (app *Application) requeueJob(ctx context.Context, jobID string) string {
+	if _, err := uuid.Parse(jobID); err != nil {
+		return "Invalid job ID"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+	defer cancel()
+
+	var reason string
+	job, err := app.JobStore.UpdateJob(ctx, jobID, func(j *common.Job) error {
+		if j.Status != common.JobFailed {
+			return errJobNotFailed
+		}
+		// the segments of append jobs are gone once compressed
+		if j.Operation == "" || j.Append {
+			return errNoInput
+		}
+		reason = j.Error
+		j.Status = common.JobPending
+		j.Error = ""
+		// workers give up on jobs that used up their attempts
+		j.Attempts = 0
+		j.Requeued = 0
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, common.ErrJobNotFound) {
+			return "Job not found"
+		}
+		if errors.Is(err, errJobNotFailed) {
+			return "Job has not failed"
+		}
+		if errors.Is(err, errNoInput) {
+			return "Job has no input to process"
+		}
+		slog.Error("Failed to requeue job", "job", jobID, "error", err)
+		return "Internal server error"
+	}
+
+	topicID, message := app.jobMessage(job)
+	if err := app.publish(topicID, job, message); err != nil {
+		// the message never made it to the outbox, so let it be requeued again
+		if _, err := app.JobStore.UpdateJob(ctx, jobID, func(j *common.Job) error {
+			j.Status = common.JobFailed
+			j.Error = reason
+			return nil
+		}); err != nil {
+			slog.Error("Failed to reset requeued job", "job", jobID, "error", err)
+		}
+		return "Internal server error"
+	}
+	app.recordEvent(ctx, jobID, common.EventRequeued, "failed with: "+reason)
+	slog.Info("Requeued failed job", "job", jobID)
+	return ""
+}
+
+// workerStatus is a worker of the registry and whether it is still sending
+// heartbeats.
+type workerStatus struct {
+	*common.WorkerInfo
+	Alive bool `json:"alive"`
+}
+
+// workersHandler lists the workers of the fleet by mode, along with the
+// capacity and version each reported and when it was last seen.
+func (app *Application) workersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	workers, err := common.ListWorkers(ctx, app.Storage, app.Bucket)
+	if err != nil {
+		slog.Error("Failed to list workers", "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		if workers[i].Mode != workers[j].Mode {
+			return workers[i].Mode < workers[j].Mode
+		}
+		return workers[i].ID < workers[j].ID
+	})
+	cutoff := time.Now().Add(-app.WorkerStaleAfter)
+	statuses := make([]workerStatus, 0, len(workers))
+	for _, worker := range workers {
+		statuses = append(statuses, workerStatus{WorkerInfo: worker, Alive: worker.LastSeen.After(cutoff)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"workers": statuses})
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestJobEventsEndpoint(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.AdminToken = "secret"
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.compressHandler).ServeHTTP(rr, createTestMultipartRequest(t, "file", "test.txt", "hello events"))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	jobID := getJobIDFromResponse(t, rr.Body)
+
+	testCases := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "missing token", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", authorization: "Bearer nope", expectedStatus: http.StatusUnauthorized},
+		{name: "valid token", authorization: "Bearer secret", expectedStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/jobs/"+jobID+"/events", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Job    common.Job        `json:"job"`
+				Events []common.JobEvent `json:"events"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Job.ID != jobID {
+				t.Errorf("Expected job %s, got %s", jobID, response.Job.ID)
+			}
+			if len(response.Events) != 2 || response.Events[0].Type != common.EventSubmitted || response.Events[1].Type != common.EventPublished {
+				t.Errorf("Expected the job to be submitted and published, got %+v", response.Events)
+			}
+		})
+	}
+}
+
+func TestRequeueFailedJobs(t *testing.T) {
+	app, _, mockPubSub := setupTestApp(t)
+	app.AdminToken = "secret"
+	ctx := context.Background()
+
+	failedID, pendingID := uuid.New().String(), uuid.New().String()
+	for _, job := range []*common.Job{
+		{ID: failedID, Operation: common.OperationDecompress, FileName: "test.txt.ranran", Status: common.JobFailed, Error: "corrupt input", Attempts: 5},
+		{ID: pendingID, Operation: common.OperationCompress, FileName: "test.txt", Status: common.JobPending},
+	} {
+		if err := app.JobStore.CreateJob(ctx, job); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+	adminRequest := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := adminRequest(http.MethodGet, "/admin/jobs/failed", "")
+	var listed struct {
+		Jobs []struct {
+			Job     common.Job                   `json:"job"`
+			TopicID string                       `json:"topic_id"`
+			Message common.DecompressedMsgSchema `json:"message"`
+		} `json:"jobs"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&listed); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Failed to list failed jobs: %v, %d", err, rr.Code)
+	}
+	if len(listed.Jobs) != 1 || listed.Jobs[0].Job.Error != "corrupt input" || listed.Jobs[0].TopicID != testDecompressTopic ||
+		listed.Jobs[0].Message.CompressedFilePath != failedID+"/test.txt.ranran" {
+		t.Fatalf("Expected the failed job with its reason and message, got %+v", listed.Jobs)
+	}
+
+	rr = adminRequest(http.MethodPost, "/admin/jobs/requeue", `{"job_ids": ["`+failedID+`", "`+pendingID+`"]}`)
+	var response struct {
+		Requeued []string          `json:"requeued"`
+		Rejected map[string]string `json:"rejected"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Failed to requeue jobs: %v, %d", err, rr.Code)
+	}
+	if len(response.Requeued) != 1 || response.Requeued[0] != failedID || response.Rejected[pendingID] == "" {
+		t.Errorf("Expected only the failed job to be requeued, got %+v", response)
+	}
+	if messages := mockPubSub.GetMessages(testDecompressTopic); len(messages) != 1 {
+		t.Errorf("Expected 1 message to be published, got %d", len(messages))
+	}
+	job, err := app.JobStore.GetJob(ctx, failedID)
+	if err != nil || job.Status != common.JobPending || job.Error != "" || job.Attempts != 0 {
+		t.Errorf("Expected the requeued job to be PENDING with its attempts reset, got %+v, %v", job, err)
+	}
+}
+
+func TestWorkersEndpoint(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.AdminToken = "secret"
+	app.WorkerStaleAfter = time.Minute
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	for _, worker := range []*common.WorkerInfo{
+		{ID: "worker-b", Mode: common.OperationDecompress, Capacity: 4, Version: "abc", LastSeen: now},
+		{ID: "worker-a", Mode: common.OperationCompress, Capacity: 8, Version: "abc", LastSeen: now.Add(-time.Hour)},
+	} {
+		if err := common.SaveWorker(ctx, app.Storage, app.Bucket, worker); err != nil {
+			t.Fatalf("Failed to save worker: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/workers", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rr, req)
+	var response struct {
+		Workers []struct {
+			common.WorkerInfo
+			Alive bool `json:"alive"`
+		} `json:"workers"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Failed to list workers: %v, %d", err, rr.Code)
+	}
+	if len(response.Workers) != 2 {
+		t.Fatalf("Expected 2 workers, got %+v", response.Workers)
+	}
+	// compress workers come first
+	if a := response.Workers[0]; a.ID != "worker-a" || a.Capacity != 8 || a.Alive {
+		t.Errorf("Expected worker-a to be gone, got %+v", a)
+	}
+	if b := response.Workers[1]; b.ID != "worker-b" || b.Version != "abc" || !b.Alive {
+		t.Errorf("Expected worker-b to be alive, got %+v", b)
+	}
+}
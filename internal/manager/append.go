@@ -0,0 +1,277 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// An append job keeps its result open-ended, e.g. for archiving logs as they
+// are written: the client adds segments one request at a time and the
+// workers append each to the same container, which can be downloaded in
+// between. The job is OPEN until it is closed and the last segment is in.
+
+var (
+	// errNotAppendJob rejects segments for jobs created otherwise.
+	errNotAppendJob = errors.New("job is not an append job")
+	// errJobClosed rejects segments for jobs that take no more.
+	errJobClosed = errors.New("job takes no more segments")
+	// errNoSegments keeps jobs without a segment from being closed.
+	errNoSegments = errors.New("job has no segments")
+)
+
+// segmentObjectPath is where a segment is stored until a worker compressed
+// it. It is named before the segment gets its number, so that a failed
+// upload doesn't leave a gap.
+func segmentObjectPath(dir string) string {
+	return fmt.Sprintf("%s/segment_%s", dir, uuid.New().String())
+}
+
+// createAppendJobHandler creates an OPEN append job from the options of
+// POST /uploads. Its algorithm has to write containers, which segments are
+// appended to, and the options that check a whole file don't apply.
+func (app *Application) createAppendJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req createUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.FileName == "" {
+		common.WriteError(w, "file_name is required", http.StatusBadRequest)
+		return
+	}
+	if req.Operation != "" && req.Operation != common.OperationCompress {
+		common.WriteError(w, "Unsupported operation: "+req.Operation, http.StatusBadRequest)
+		return
+	}
+	if req.Verify || req.SHA256 != "" || req.NotBefore != "" || req.Size != 0 {
+		common.WriteError(w, "verify, sha256, not_before and size don't apply to append jobs", http.StatusBadRequest)
+		return
+	}
+
+	owner := requestOwner(r)
+	contentType := contentTypeFor(req.FileName, req.ContentType)
+	profile := app.requestProfile(req.Profile, req.Algorithm, req.Level, req.Format, req.FileName, contentType)
+	algorithm, level, errMsg := app.applyProfile(profile, req.Algorithm, req.Level)
+	if errMsg == "" {
+		algorithm, errMsg = compressionAlgorithm(algorithm, req.Format)
+	}
+	if errMsg == "" {
+		errMsg = compressionLevel(algorithm, level)
+	}
+	if errMsg == "" && (algorithm == common.AlgorithmAuto || !common.UsesContainer(algorithm)) {
+		errMsg = "Append jobs need an algorithm that writes containers"
+	}
+	if errMsg == "" {
+		errMsg = app.checkCodecOwner(algorithm, owner)
+	}
+	if errMsg == "" {
+		errMsg = app.checkDictionary(r.Context(), req.Dictionary, algorithm, owner)
+	}
+	if errMsg == "" {
+		errMsg = validateKMSKey(req.KMSKey)
+	}
+	if errMsg == "" && !common.ValidPriority(req.Priority) {
+		errMsg = "Unsupported priority: " + req.Priority
+	}
+	if errMsg == "" {
+		errMsg = app.checkGroup(r.Context(), req.GroupID, owner)
+	}
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	job := &common.Job{
+		ID:          uuid.New().String(),
+		Operation:   common.OperationCompress,
+		Status:      common.JobOpen,
+		FileName:    req.FileName,
+		ContentType: contentType,
+		Algorithm:   algorithm,
+		Level:       level,
+		Profile:     profile,
+		Owner:       owner,
+		KMSKeyName:  req.KMSKey,
+		Dictionary:  req.Dictionary,
+		Priority:    req.Priority,
+		BatchID:     req.GroupID,
+		RequestID:   common.RequestID(r.Context()),
+		Append:      true,
+	}
+	job.Dir = app.jobDir(owner, job.ID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+	if err := app.JobStore.CreateJob(ctx, job); err != nil {
+		slog.Error("Failed to create job record", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.addToGroup(ctx, job.Owner, job.BatchID, job.ID); err != nil {
+		slog.Error("Failed to add job to group", "job", job.ID, "group", job.BatchID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Debug("Created append job", "job", job.ID, "file", job.FileName)
+
+	logJobID(r, job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": job.ID, "status": string(job.Status)})
+}
+
+// appendSegmentHandler stores the body of the request as the next segment of
+// an open append job and enqueues it. Segments are numbered in the order
+// their uploads finish.
+func (app *Application) appendSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(common.OperationCompress).MaxSize)
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if !job.Append {
+		common.WriteError(w, "Job is not an append job", http.StatusBadRequest)
+		return
+	}
+	if job.Status != common.JobOpen || job.Closed {
+		common.WriteError(w, "Job takes no more segments", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.uploadLimits(common.OperationCompress).Timeout)
+	defer cancel()
+
+	object := segmentObjectPath(job.ObjectDir())
+	written, err := app.uploadVerified(ctx, object, r.Body, "",
+		common.WithContentType(job.ContentType), common.WithKMSKey(job.KMSKeyName))
+	if err != nil {
+		slog.Error("Failed to upload segment to storage", "job", job.ID, "error", err)
+		writeSubmitError(w, err)
+		return
+	}
+	if written == 0 {
+		app.removeSegment(ctx, job.ID, object)
+		common.WriteError(w, "Segment is empty", http.StatusBadRequest)
+		return
+	}
+	if err := app.enforceQuota(ctx, job.ID, job.Owner, object, written); err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+
+	job, err = app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+		if j.Status != common.JobOpen || j.Closed {
+			return errJobClosed
+		}
+		j.Segments++
+		j.InputSize += written
+		return nil
+	})
+	if err != nil {
+		app.removeSegment(ctx, r.PathValue("id"), object)
+		if errors.Is(err, errJobClosed) {
+			common.WriteError(w, "Job takes no more segments", http.StatusConflict)
+			return
+		}
+		slog.Error("Failed to number segment", "job", r.PathValue("id"), "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	message := common.CompressedMsgSchema{
+		UID:              job.ID,
+		OriginalFilePath: object,
+		Algorithm:        job.Algorithm,
+		Level:            job.Level,
+		FileName:         job.FileName,
+		ContentType:      job.ContentType,
+		KMSKeyName:       job.KMSKeyName,
+		Dictionary:       job.Dictionary,
+		Segment:          job.Segments,
+	}
+	if err := app.publishPart(app.topicFor(app.CompressTopicID, job.Priority), job, job.Segments, message); err != nil {
+		// the segments after it would wait for this one forever
+		reason := fmt.Sprintf("Failed to enqueue segment %d", job.Segments)
+		if _, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+			if j.Status.Finished() {
+				return errJobFinished
+			}
+			j.Status, j.Error = common.JobFailed, reason
+			return nil
+		}); err != nil && !errors.Is(err, errJobFinished) {
+			slog.Error("Failed to fail append job", "job", job.ID, "error", err)
+		}
+		writeSubmitError(w, err)
+		return
+	}
+	app.recordUsage(ctx, job.Owner, written)
+	slog.Debug("Enqueued segment", "job", job.ID, "segment", job.Segments, "size", written)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{"job_id": job.ID, "segment": job.Segments})
+}
+
+func (app *Application) removeSegment(ctx context.Context, jobID, object string) {
+	if err := app.Storage.DeleteObject(ctx, app.Bucket, object); err != nil {
+		slog.Warn("Failed to remove rejected segment", "job", jobID, "object", object, "error", err)
+	}
+}
+
+// closeJobHandler stops an append job from taking segments. It is DONE right
+// away when every segment is appended, otherwise the worker that appends the
+// last one finishes it.
+func (app *Application) closeJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	job, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+		if !j.Append {
+			return errNotAppendJob
+		}
+		if j.Status != common.JobOpen || j.Closed {
+			return errJobClosed
+		}
+		if j.Segments == 0 {
+			return errNoSegments
+		}
+		j.Closed = true
+		if j.Appended == j.Segments {
+			j.Status = common.JobDone
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errNotAppendJob):
+		common.WriteError(w, "Job is not an append job", http.StatusBadRequest)
+		return
+	case errors.Is(err, errJobClosed):
+		common.WriteError(w, "Job is already closed", http.StatusConflict)
+		return
+	case errors.Is(err, errNoSegments):
+		common.WriteError(w, "Job has no segments, cancel it instead", http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("Failed to close job", "job", r.PathValue("id"), "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Closed append job", "job", job.ID, "segments", job.Segments)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
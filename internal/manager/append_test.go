@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestCreateAppendJob(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     map[string]any
+		wantCode int
+	}{
+		{name: "zstd", body: map[string]any{"file_name": "app.log", "algorithm": "zstd"}, wantCode: http.StatusCreated},
+		{name: "default algorithm", body: map[string]any{"file_name": "app.log"}, wantCode: http.StatusCreated},
+		{name: "no file name", body: map[string]any{"algorithm": "zstd"}, wantCode: http.StatusBadRequest},
+		{name: "gz output", body: map[string]any{"file_name": "app.log", "format": "gz"}, wantCode: http.StatusBadRequest},
+		{name: "auto", body: map[string]any{"file_name": "app.log", "algorithm": "auto"}, wantCode: http.StatusBadRequest},
+		{name: "verify", body: map[string]any{"file_name": "app.log", "verify": true}, wantCode: http.StatusBadRequest},
+		{name: "decompress", body: map[string]any{"file_name": "app.log", "operation": "decompress"}, wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			body, _ := json.Marshal(tc.body)
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/compress/append", bytes.NewReader(body)))
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if rr.Code != http.StatusCreated {
+				return
+			}
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if !job.Append || job.Status != common.JobOpen || job.FileName != "app.log" {
+				t.Errorf("Expected an open append job, got %+v", job)
+			}
+		})
+	}
+}
+
+func TestAppendSegments(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+	handler := app.Handler()
+	body, _ := json.Marshal(map[string]any{"file_name": "app.log", "algorithm": "zstd"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/compress/append", bytes.NewReader(body)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	jobID := getJobIDFromResponse(t, rr.Body)
+
+	appendSegment := func(content string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/jobs/"+jobID+"/segments", strings.NewReader(content)))
+		return rr
+	}
+	for i, content := range []string{"first lines\n", "more lines\n"} {
+		if rr := appendSegment(content); rr.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d for segment %d, got %d: %s", http.StatusAccepted, i+1, rr.Code, rr.Body)
+		}
+	}
+	if rr := appendSegment(""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an empty segment to be rejected, got %d", rr.Code)
+	}
+
+	messages := mockPubSub.GetMessages(testCompressTopic)
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	for i, message := range messages {
+		var msg common.CompressedMsgSchema
+		if err := common.UnmarshalMessage(message.Data, &msg); err != nil {
+			t.Fatalf("Failed to unmarshal message: %v", err)
+		}
+		if msg.Segment != i+1 || msg.Algorithm != common.AlgorithmZstd || msg.FileName != "app.log" {
+			t.Errorf("Unexpected message of segment %d: %+v", i+1, msg)
+		}
+		if content, _ := mockGCS.GetObjectContent(msg.OriginalFilePath); content == "" {
+			t.Errorf("Expected segment %d to be stored at %s", i+1, msg.OriginalFilePath)
+		}
+	}
+
+	closeJob := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/jobs/"+jobID+"/close", nil))
+		return rr
+	}
+	if rr := closeJob(); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d for close, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	job, _ := app.JobStore.GetJob(context.Background(), jobID)
+	if !job.Closed || job.Segments != 2 || job.Status != common.JobOpen {
+		t.Errorf("Expected the job to wait for its segments, got %+v", job)
+	}
+	if rr := appendSegment("late lines\n"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected a closed job to take no more segments, got %d", rr.Code)
+	}
+	if rr := closeJob(); rr.Code != http.StatusConflict {
+		t.Errorf("Expected a closed job not to be closed again, got %d", rr.Code)
+	}
+}
+
+func TestCloseAppendJob(t *testing.T) {
+	testCases := []struct {
+		name       string
+		job        common.Job
+		wantCode   int
+		wantStatus common.JobStatus
+	}{
+		{name: "all appended", job: common.Job{Status: common.JobOpen, Append: true, Segments: 2, Appended: 2}, wantCode: http.StatusOK, wantStatus: common.JobDone},
+		{name: "no segments", job: common.Job{Status: common.JobOpen, Append: true}, wantCode: http.StatusConflict, wantStatus: common.JobOpen},
+		{name: "not an append job", job: common.Job{Status: common.JobPending}, wantCode: http.StatusBadRequest, wantStatus: common.JobPending},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			job := tc.job
+			job.ID = "7d5c3c39-2c1a-4a3b-9d7e-3f0e8d2f9a61"
+			app.JobStore.CreateJob(context.Background(), &job)
+
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/v1/jobs/"+job.ID+"/close", nil))
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if record, _ := app.JobStore.GetJob(context.Background(), job.ID); record.Status != tc.wantStatus {
+				t.Errorf("Expected status %s, got %s", tc.wantStatus, record.Status)
+			}
+		})
+	}
+}
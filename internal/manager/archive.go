@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+const tarContentType = "application/x-tar"
+
+// archiveCompressHandler creates a single compression job for several files,
+// compressed into one archive container. The files are either one tarball,
+// whose directory structure is kept, or any number of file parts that end up
+// side by side in the archive.
+func (app *Application) archiveCompressHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(common.OperationCompress).MaxSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if common.Classify(err) == common.ErrTooLarge {
+			common.WriteError(w, "Files exceed size limit", common.StatusCode(err))
+			return
+		}
+		common.WriteError(w, "Failed to read files: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		common.WriteError(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+	if len(files) > app.MaxBatchFiles {
+		common.WriteError(w, "Too many files for one archive", http.StatusBadRequest)
+		return
+	}
+
+	params, errMsg := app.compressOptions(r)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	// the member index lives in the container header
+	if !common.UsesContainer(params.Algorithm) {
+		common.WriteError(w, "Archives require the ranran format", http.StatusBadRequest)
+		return
+	}
+
+	isTarball := len(files) == 1 && strings.HasSuffix(strings.ToLower(files[0].Filename), ".tar")
+	name := r.FormValue("name")
+	if name == "" {
+		name = "archive.tar"
+		if isTarball {
+			name = files[0].Filename
+		}
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".tar") {
+		name += ".tar"
+	}
+
+	params.FileName = name
+	params.ContentType = tarContentType
+	params.Archive = true
+	var jobID string
+	if isTarball {
+		file, err := files[0].Open()
+		if err != nil {
+			slog.Error("Failed to open uploaded tarball", "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		if jobID, err = app.submitCompress(file, params); err != nil {
+			writeSubmitError(w, err)
+			return
+		}
+	} else {
+		seen := make(map[string]bool, len(files))
+		for _, header := range files {
+			if seen[header.Filename] {
+				common.WriteError(w, "Duplicate file name: "+header.Filename, http.StatusBadRequest)
+				return
+			}
+			seen[header.Filename] = true
+		}
+		var err error
+		if jobID, err = app.submitArchive(files, params); err != nil {
+			writeSubmitError(w, err)
+			return
+		}
+	}
+
+	logJobID(r, jobID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+}
+
+// submitArchive submits files packed into a tarball as a compression job.
+// The tarball is written while it uploads, and a failure on either side
+// stops the other: a tarball that couldn't be written in full fails the
+// upload, which removes what made it to storage, so no job is submitted for
+// it. Both sides are done once it returns, before the uploaded files go.
+func (app *Application) submitArchive(files []*multipart.FileHeader, params compressParams) (string, error) {
+	pr, pw := io.Pipe()
+	var g errgroup.Group
+	g.Go(func() error {
+		err := writeTar(pw, files)
+		pw.CloseWithError(err)
+		return err
+	})
+	var jobID string
+	g.Go(func() error {
+		var err error
+		jobID, err = app.submitCompress(pr, params)
+		// the tarball gets the same error if the upload stopped reading it
+		pr.CloseWithError(err)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return "", err
+	}
+	return jobID, nil
+}
+
+// writeTar packs the uploaded files into a tarball, one entry per file.
+func writeTar(w io.Writer, files []*multipart.FileHeader) error {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	for _, header := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     header.Filename,
+			Mode:     0o644,
+			Size:     header.Size,
+			ModTime:  now,
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return err
+		}
+		file, err := header.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
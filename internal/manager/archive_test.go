@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestArchiveCompressHandler(t *testing.T) {
+	testCases := []struct {
+		name            string
+		files           []string
+		fields          map[string]string
+		expectedStatus  int
+		expectedName    string
+		expectedMembers []string
+	}{
+		{name: "several files", files: []string{"a.txt", "b.txt"}, expectedStatus: http.StatusAccepted, expectedName: "archive.tar", expectedMembers: []string{"a.txt", "b.txt"}},
+		{name: "custom name", files: []string{"a.txt"}, fields: map[string]string{"name": "notes", "algorithm": "zstd"}, expectedStatus: http.StatusAccepted, expectedName: "notes.tar", expectedMembers: []string{"a.txt"}},
+		{name: "gzip output", files: []string{"a.txt"}, fields: map[string]string{"format": "gz"}, expectedStatus: http.StatusBadRequest},
+		{name: "duplicate names", files: []string{"a.txt", "a.txt"}, expectedStatus: http.StatusBadRequest},
+		{name: "no files", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.MaxBatchFiles = 3
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.archiveCompressHandler).ServeHTTP(rr, createBatchRequest(t, tc.files, tc.fields))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusAccepted {
+				return
+			}
+			jobID := getJobIDFromResponse(t, rr.Body)
+
+			messages := mockPubSub.GetMessages(testCompressTopic)
+			if len(messages) != 1 {
+				t.Fatalf("Expected 1 message to be published, got %d", len(messages))
+			}
+			var msg common.CompressedMsgSchema
+			common.UnmarshalMessage(messages[0].Data, &msg)
+			if !msg.Archive || msg.FileName != tc.expectedName {
+				t.Errorf("Unexpected message: %+v", msg)
+			}
+
+			content, ok := mockGCS.GetObjectContent(originalObjectPath(jobID, tc.expectedName))
+			if !ok {
+				t.Fatalf("Expected the tarball to be uploaded")
+			}
+			tr := tar.NewReader(bytes.NewReader([]byte(content)))
+			for _, name := range tc.expectedMembers {
+				hdr, err := tr.Next()
+				if err != nil || hdr.Name != name {
+					t.Fatalf("Expected member %q, got %v, %v", name, hdr, err)
+				}
+				if body, _ := io.ReadAll(tr); string(body) != "content of "+name {
+					t.Errorf("Unexpected content of %s: %q", name, body)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveCompressHandler_Tarball(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	app.MaxBatchFiles = 3
+
+	req := createTestMultipartRequest(t, "file", "photos.tar", "not checked by the manager")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.archiveCompressHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	jobID := getJobIDFromResponse(t, rr.Body)
+
+	// tarballs are stored as they are
+	if content, _ := mockGCS.GetObjectContent(originalObjectPath(jobID, "photos.tar")); content != "not checked by the manager" {
+		t.Errorf("Unexpected original content %q", content)
+	}
+}
+
+func TestSubmitArchiveFailure(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+	req := createBatchRequest(t, []string{"a.txt", "b.txt"}, nil)
+	// the files go to disk, and are gone before the tarball is written
+	if err := req.ParseMultipartForm(0); err != nil {
+		t.Fatalf("Failed to parse form: %v", err)
+	}
+	req.MultipartForm.RemoveAll()
+
+	if _, err := app.submitArchive(req.MultipartForm.File["file"], compressParams{FileName: "archive.tar", Archive: true}); err == nil {
+		t.Fatal("Expected the archive to fail")
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+		t.Errorf("Expected no job to be enqueued, got %d messages", len(messages))
+	}
+	if jobs, err := app.JobStore.ListJobs(context.Background()); err != nil || len(jobs) != 0 {
+		t.Errorf("Expected no job to be created, got %v, %v", jobs, err)
+	}
+	for object := range mockGCS.files {
+		t.Errorf("Expected the partial tarball to be removed, found %s", object)
+	}
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// The backlog is taken from the job records rather than Pub/Sub, so it means
+// the same on every queue backend. Every manager reports it, autoscalers
+// should take the maximum rather than the sum.
+var (
+	queueBacklog = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "manager_queue_backlog_jobs",
+		Help: "PENDING jobs on a topic that no worker has started yet, to scale workers on.",
+	}, []string{"topic"})
+
+	queueInProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "manager_queue_in_progress_jobs",
+		Help: "PROCESSING jobs taken from a topic.",
+	}, []string{"topic"})
+
+	queueOldestPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "manager_queue_oldest_pending_age_seconds",
+		Help: "How long the oldest PENDING job of a topic has been waiting.",
+	}, []string{"topic"})
+)
+
+// jobTopics lists every topic jobs are published to.
+func (app *Application) jobTopics() []string {
+	priorities := []string{common.PriorityNormal}
+	if app.PriorityTopics {
+		priorities = common.Priorities
+	}
+	var topics []string
+	for _, topicID := range []string{app.CompressTopicID, app.DecompressTopicID} {
+		for _, priority := range priorities {
+			topics = append(topics, app.topicFor(topicID, priority))
+		}
+	}
+	return topics
+}
+
+// measureBacklog updates the queue gauges from the job records as of now.
+// Scheduled jobs aren't on a topic yet, so they don't count.
+func (app *Application) measureBacklog(ctx context.Context, now time.Time) error {
+	jobs, err := app.JobStore.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	pending := make(map[string]int)
+	processing := make(map[string]int)
+	oldest := make(map[string]time.Time)
+	for _, job := range jobs {
+		topicID, _ := app.jobMessage(job)
+		switch job.Status {
+		case common.JobPending:
+			pending[topicID]++
+			if since, ok := oldest[topicID]; !ok || job.UpdatedAt.Before(since) {
+				oldest[topicID] = job.UpdatedAt
+			}
+		case common.JobProcessing:
+			processing[topicID]++
+		}
+	}
+	// topics without jobs have to drop to zero rather than keep their last value
+	for _, topicID := range app.jobTopics() {
+		queueBacklog.WithLabelValues(topicID).Set(float64(pending[topicID]))
+		queueInProgress.WithLabelValues(topicID).Set(float64(processing[topicID]))
+		age := 0.0
+		if since, ok := oldest[topicID]; ok {
+			age = max(now.Sub(since).Seconds(), 0)
+		}
+		queueOldestPending.WithLabelValues(topicID).Set(age)
+	}
+	return nil
+}
+
+// runBacklogMonitor measures the backlog every interval until ctx is
+// cancelled.
+func (app *Application) runBacklogMonitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := app.measureBacklog(ctx, time.Now()); err != nil {
+			slog.Error("Failed to measure the queue backlog", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
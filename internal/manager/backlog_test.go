@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestMeasureBacklog(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	ctx := context.Background()
+	for _, job := range []*common.Job{
+		{Operation: common.OperationCompress, Status: common.JobPending},
+		{Operation: common.OperationCompress, Status: common.JobPending},
+		{Operation: common.OperationCompress, Status: common.JobProcessing},
+		{Operation: common.OperationCompress, Status: common.JobScheduled},
+		{Operation: common.OperationDecompress, Status: common.JobDone},
+	} {
+		job.ID = uuid.New().String()
+		if err := app.JobStore.CreateJob(ctx, job); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	if err := app.measureBacklog(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("measureBacklog failed: %v", err)
+	}
+	if got := testutil.ToFloat64(queueBacklog.WithLabelValues(testCompressTopic)); got != 2 {
+		t.Errorf("Expected a backlog of 2 compress jobs, got %v", got)
+	}
+	if got := testutil.ToFloat64(queueInProgress.WithLabelValues(testCompressTopic)); got != 1 {
+		t.Errorf("Expected 1 compress job in progress, got %v", got)
+	}
+	if got := testutil.ToFloat64(queueOldestPending.WithLabelValues(testCompressTopic)); got < 59 {
+		t.Errorf("Expected the oldest compress job to wait about a minute, got %vs", got)
+	}
+	if got := testutil.ToFloat64(queueBacklog.WithLabelValues(testDecompressTopic)); got != 0 {
+		t.Errorf("Expected no decompress backlog, got %v", got)
+	}
+}
@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// batchEntry reports what became of one file of a batch.
+type batchEntry struct {
+	FileName string `json:"file_name"`
+	JobID    string `json:"job_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// batchCompressHandler creates one compression job per file of a multipart
+// request, all sharing the algorithm, format, level and kms_key fields and a
+// batch ID. The batch is a group, or joins the one named by group_id.
+// A file that can't be submitted doesn't stop the others, its entry carries
+// the error instead of a job ID.
+func (app *Application) batchCompressHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(common.OperationCompress).MaxSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if common.Classify(err) == common.ErrTooLarge {
+			common.WriteError(w, "Files exceed size limit", common.StatusCode(err))
+			return
+		}
+		common.WriteError(w, "Failed to read files: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		common.WriteError(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+	if len(files) > app.MaxBatchFiles {
+		common.WriteError(w, fmt.Sprintf("Batch exceeds the limit of %d files", app.MaxBatchFiles), http.StatusBadRequest)
+		return
+	}
+
+	params, errMsg := app.compressOptions(r)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	// without a group_id the batch is a group of its own
+	batchID := params.BatchID
+	if batchID == "" {
+		batchID = uuid.New().String()
+		ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+		err := app.createGroup(ctx, batchID, params.Owner)
+		cancel()
+		if err != nil {
+			slog.Error("Failed to create group of batch", "batch", batchID, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		params.BatchID = batchID
+	}
+
+	entries := make([]batchEntry, 0, len(files))
+	failed, overQuota := 0, 0
+	var quotaErr *quotaExceededError
+	for _, header := range files {
+		entry := batchEntry{FileName: header.Filename}
+		file, err := header.Open()
+		if err == nil {
+			params.FileName = header.Filename
+			params.ContentType = uploadContentType(header)
+			entry.JobID, err = app.submitCompress(file, params)
+			file.Close()
+		}
+		if errors.As(err, &quotaErr) {
+			entry.Error = "Quota exceeded for " + quotaErr.period
+			failed++
+			overQuota++
+		} else if err != nil {
+			slog.Error("Failed to submit file of batch", "batch", batchID, "file", header.Filename, "error", err)
+			entry.Error = "Internal server error"
+			failed++
+		}
+		entries = append(entries, entry)
+	}
+
+	if overQuota == len(files) {
+		writeQuotaError(w, quotaErr)
+		return
+	}
+	if failed == len(files) {
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{
+		"batch_id": batchID,
+		"jobs":     entries,
+	})
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// createBatchRequest builds a multipart request with one "file" part per
+// entry of files, in order.
+func createBatchRequest(t *testing.T, files []string, fields map[string]string) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			t.Fatalf("Failed to write form field: %v", err)
+		}
+	}
+	for _, name := range files {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write([]byte("content of " + name))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/compress/batch", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestBatchCompressHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		files          []string
+		fields         map[string]string
+		expectedStatus int
+	}{
+		{name: "success", files: []string{"a.txt", "b.txt"}, fields: map[string]string{"algorithm": "zstd"}, expectedStatus: http.StatusAccepted},
+		{name: "no files", files: nil, expectedStatus: http.StatusBadRequest},
+		{name: "too many files", files: []string{"a.txt", "b.txt", "c.txt", "d.txt"}, expectedStatus: http.StatusBadRequest},
+		{name: "unsupported algorithm", files: []string{"a.txt"}, fields: map[string]string{"algorithm": "lzma"}, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.MaxBatchFiles = 3
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.batchCompressHandler).ServeHTTP(rr, createBatchRequest(t, tc.files, tc.fields))
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusAccepted {
+				if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+					t.Errorf("Expected no messages to be published, got %d", len(messages))
+				}
+				return
+			}
+
+			var response struct {
+				BatchID string       `json:"batch_id"`
+				Jobs    []batchEntry `json:"jobs"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.BatchID == "" || len(response.Jobs) != len(tc.files) {
+				t.Fatalf("Unexpected response: %+v", response)
+			}
+			for i, entry := range response.Jobs {
+				if entry.FileName != tc.files[i] || entry.JobID == "" {
+					t.Errorf("Unexpected entry %d: %+v", i, entry)
+					continue
+				}
+				job, err := app.JobStore.GetJob(context.Background(), entry.JobID)
+				if err != nil || job.BatchID != response.BatchID || job.Algorithm != common.AlgorithmZstd {
+					t.Errorf("Unexpected job record: %+v, %v", job, err)
+				}
+				if content, _ := mockGCS.GetObjectContent(originalObjectPath(entry.JobID, entry.FileName)); content != "content of "+entry.FileName {
+					t.Errorf("Unexpected original content %q", content)
+				}
+			}
+			if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != len(tc.files) {
+				t.Errorf("Expected %d messages to be published, got %d", len(tc.files), len(messages))
+			}
+		})
+	}
+}
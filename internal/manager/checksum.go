@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// errChecksumMismatch is returned when an upload doesn't match the SHA-256
+// digest the client sent along with it.
+var errChecksumMismatch = common.NewError(common.ErrCorruptInput, "checksum mismatch")
+
+// checksumMetadataKey is the object metadata holding the verified digest.
+const checksumMetadataKey = "sha256"
+
+// parseChecksum normalizes the optional hex SHA-256 digest of an upload. A
+// non-empty message explains why it is invalid.
+func parseChecksum(value string) (string, string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", ""
+	}
+	if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != sha256.Size {
+		return "", "Invalid sha256: " + value
+	}
+	return value, ""
+}
+
+// uploadVerified streams src to object and returns how many bytes it wrote.
+// With an expected digest the object is only committed if src matches it,
+// and records the digest in its metadata. When src fails halfway or doesn't
+// match, the upload is aborted and anything that made it to GCS removed, so
+// no job is ever submitted for part of a file. A mismatch returns
+// errChecksumMismatch.
+func (app *Application) uploadVerified(ctx context.Context, object string, src io.Reader, expected string, opts ...common.ObjectWriterOption) (int64, error) {
+	if expected != "" {
+		opts = append(opts, common.WithMetadata(map[string]string{checksumMetadataKey: expected}))
+	}
+	// cancelling the writer's context before Close aborts the upload
+	uploadCtx, abort := context.WithCancel(ctx)
+	defer abort()
+
+	hash := sha256.New()
+	wc := app.Storage.NewObjectWriter(uploadCtx, app.Bucket, object, opts...)
+	discard := func() {
+		abort()
+		wc.Close()
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, object); err != nil && !errors.Is(err, common.ErrObjectNotExist) {
+			slog.Warn("Failed to remove aborted upload", "object", object, "error", err)
+		}
+	}
+	written, err := io.Copy(wc, io.TeeReader(src, hash))
+	if err != nil {
+		discard()
+		return written, fmt.Errorf("failed to stream data to GCS: %w", err)
+	}
+	if expected != "" && hex.EncodeToString(hash.Sum(nil)) != expected {
+		discard()
+		return written, errChecksumMismatch
+	}
+	if err := wc.Close(); err != nil {
+		return written, fmt.Errorf("failed to close data stream to GCS: %w", err)
+	}
+	return written, nil
+}
+
+// objectChecksum returns the hex SHA-256 digest of an object in the bucket.
+func (app *Application) objectChecksum(ctx context.Context, object string) (string, error) {
+	rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, object)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeSubmitError reports why a job couldn't be submitted.
+func writeSubmitError(w http.ResponseWriter, err error) {
+	var quotaErr *quotaExceededError
+	if errors.As(err, &quotaErr) {
+		writeQuotaError(w, quotaErr)
+		return
+	}
+	var codecErr *codecNotAllowedError
+	if errors.As(err, &codecErr) {
+		common.WriteError(w, "Unsupported algorithm: "+codecErr.algorithm, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errChecksumMismatch) {
+		common.WriteError(w, "File does not match the sha256 checksum", common.StatusCode(err))
+		return
+	}
+	if common.Classify(err) == common.ErrTooLarge {
+		common.WriteError(w, "File exceeds size limit", common.StatusCode(err))
+		return
+	}
+	common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+}
@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestCompressHandlerChecksum(t *testing.T) {
+	const content = "hello checksum"
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+
+	testCases := []struct {
+		name           string
+		checksum       string
+		expectedStatus int
+	}{
+		{name: "no checksum", expectedStatus: http.StatusAccepted},
+		{name: "matching", checksum: digest, expectedStatus: http.StatusAccepted},
+		{name: "matching upper case", checksum: strings.ToUpper(digest), expectedStatus: http.StatusAccepted},
+		{name: "mismatch", checksum: strings.Repeat("0", 64), expectedStatus: http.StatusUnprocessableEntity},
+		{name: "malformed", checksum: "abc", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt", content, map[string]string{"algorithm": "zstd", "sha256": tc.checksum})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+
+			messages := mockPubSub.GetMessages(app.CompressTopicID)
+			if tc.expectedStatus != http.StatusAccepted {
+				if len(messages) != 0 {
+					t.Errorf("Expected no messages to be published, got %d", len(messages))
+				}
+				// the rejected upload must not be left in the bucket
+				for object := range mockGCS.files {
+					if strings.Contains(object, "original_") {
+						t.Errorf("Expected the upload to be removed, found %s", object)
+					}
+				}
+				return
+			}
+
+			var pubsubMsg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(messages[0].Data, &pubsubMsg); err != nil {
+				t.Fatalf("Failed to unmarshal Pub/Sub message: %v", err)
+			}
+			want := ""
+			if tc.checksum != "" {
+				want = digest
+			}
+			if got := mockGCS.attrs[pubsubMsg.OriginalFilePath].Metadata[checksumMetadataKey]; got != want {
+				t.Errorf("Expected %q in the object metadata, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestUploadVerifiedAbort(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	errSource := errors.New("client went away")
+	src := io.MultiReader(strings.NewReader("the first half"), iotest.ErrReader(errSource))
+
+	if _, err := app.uploadVerified(context.Background(), "partial", src, ""); !errors.Is(err, errSource) {
+		t.Fatalf("Expected the error of the source, got %v", err)
+	}
+	if _, ok := mockGCS.GetObjectContent("partial"); ok {
+		t.Error("Expected the partial upload to be removed")
+	}
+}
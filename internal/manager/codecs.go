@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// parseOwners reads which owners may use which codecs or buckets, e.g.
+// "experimental=owner1|owner2,other=owner3".
+func parseOwners(value string) map[string]map[string]bool {
+	allowed := make(map[string]map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		name, owners, ok := strings.Cut(entry, "=")
+		if name = strings.TrimSpace(name); !ok || name == "" {
+			continue
+		}
+		if allowed[name] == nil {
+			allowed[name] = make(map[string]bool)
+		}
+		for _, owner := range strings.Split(owners, "|") {
+			if owner = strings.TrimSpace(owner); owner != "" {
+				allowed[name][owner] = true
+			}
+		}
+	}
+	return allowed
+}
+
+// checkCodecOwner reports whether owner may use algorithm. Other
+// owners are told it isn't supported, as if the codec didn't exist. A
+// non-empty message explains why they may not.
+func (app *Application) checkCodecOwner(algorithm, owner string) string {
+	if owners, restricted := app.CodecOwners[algorithm]; restricted && !owners[owner] {
+		return "Unsupported algorithm: " + algorithm
+	}
+	return ""
+}
+
+// codecNotAllowedError rejects a file to decompress with a codec its owner
+// may not use.
+type codecNotAllowedError struct {
+	algorithm string
+}
+
+func (e *codecNotAllowedError) Error() string {
+	return "codec not allowed: " + e.algorithm
+}
+
+// checkDecompressCodec rejects decompressing the stored object of owner with
+// a codec they may not use. Containers name their codec in their header, so
+// any file can ask for a restricted one. Files that aren't containers are
+// left to the workers to fail.
+func (app *Application) checkDecompressCodec(ctx context.Context, owner, algorithm, object string) error {
+	if len(app.CodecOwners) == 0 {
+		return nil
+	}
+	if common.UsesContainer(algorithm) {
+		rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, object)
+		if err != nil {
+			return err
+		}
+		header, err := compression.ReadContainerHeader(rc)
+		rc.Close()
+		if err != nil {
+			return nil
+		}
+		algorithm = header.Algorithm
+	}
+	if errMsg := app.checkCodecOwner(algorithm, owner); errMsg != "" {
+		return &codecNotAllowedError{algorithm: algorithm}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestCodecOwners(t *testing.T) {
+	owners := parseOwners(" zstd = " + keyOwner("alice") + " | " + keyOwner("bob") + ",,broken")
+	if len(owners) != 1 || !owners["zstd"][keyOwner("alice")] || !owners["zstd"][keyOwner("bob")] {
+		t.Fatalf("Unexpected codec owners: %v", owners)
+	}
+
+	testCases := []struct {
+		name      string
+		key       string
+		algorithm string
+		wantCode  int
+	}{
+		{name: "listed owner", key: "alice", algorithm: common.AlgorithmZstd, wantCode: http.StatusAccepted},
+		{name: "other owner", key: "carol", algorithm: common.AlgorithmZstd, wantCode: http.StatusBadRequest},
+		{name: "open codec", key: "carol", algorithm: common.AlgorithmGzip, wantCode: http.StatusAccepted},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.CodecOwners = owners
+			handler := app.Handler()
+
+			req := createTestMultipartRequestWithFields(t, "file", "notes.txt", "some text", map[string]string{"algorithm": tc.algorithm})
+			req.URL.Path = "/v1/compress"
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d for /compress, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode != http.StatusAccepted && !strings.Contains(rr.Body.String(), "Unsupported algorithm") {
+				t.Errorf("Expected the codec to look unsupported, got %s", rr.Body)
+			}
+
+			body, _ := json.Marshal(map[string]any{"operation": "compress", "file_name": "notes.txt", "algorithm": tc.algorithm})
+			req = httptest.NewRequest(http.MethodPost, "/v1/uploads", bytes.NewReader(body))
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if wantCreated := tc.wantCode == http.StatusAccepted; (rr.Code == http.StatusCreated) != wantCreated {
+				t.Errorf("Expected upload created %v, got %d: %s", wantCreated, rr.Code, rr.Body)
+			}
+		})
+	}
+}
+
+func TestCodecOwnersOnDecompress(t *testing.T) {
+	codec, err := compression.Lookup(common.AlgorithmZstd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var container bytes.Buffer
+	if err := compression.WriteContainer(&container, codec, strings.NewReader("some text"), compression.ContainerMetadata{}); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		key      string
+		wantCode int
+	}{
+		{name: "listed owner", key: "alice", wantCode: http.StatusAccepted},
+		{name: "other owner", key: "carol", wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.CodecOwners = parseOwners("zstd=" + keyOwner("alice"))
+			handler := app.Handler()
+
+			// the codec is only named in the header of the container
+			req := createTestMultipartRequest(t, "file", "notes.txt.ranran", container.String())
+			req.URL.Path = "/v1/decompress"
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d for /decompress, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode != http.StatusAccepted && !strings.Contains(rr.Body.String(), "Unsupported algorithm: zstd") {
+				t.Errorf("Expected the codec to look unsupported, got %s", rr.Body)
+			}
+
+			// and for files uploaded straight to the bucket, when submitted
+			req = httptest.NewRequest(http.MethodPost, "/v1/jobs", strings.NewReader(`{"operation":"decompress","file_name":"notes.txt.ranran"}`))
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Failed to create job: %d %s", rr.Code, rr.Body)
+			}
+			var created map[string]any
+			json.NewDecoder(rr.Body).Decode(&created)
+			jobID, _ := created["job_id"].(string)
+			input := compressedObjectPath(jobID, "notes.txt.ranran")
+			wc := mockGCS.NewObjectWriter(context.Background(), testBucket, input)
+			wc.Write(container.Bytes())
+			wc.Close()
+
+			req = httptest.NewRequest(http.MethodPost, "/v1/jobs/"+jobID+"/submit", nil)
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d for submit, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode == http.StatusAccepted {
+				return
+			}
+			if _, ok := mockGCS.GetObjectContent(input); ok {
+				t.Error("Expected the rejected upload to be removed")
+			}
+			if messages := mockPubSub.GetMessages(app.DecompressTopicID); len(messages) != 0 {
+				t.Errorf("Expected no job to be enqueued, got %d", len(messages))
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+const (
+	// maxDictionaryTraining bounds the samples of a training request, which
+	// are held in memory.
+	maxDictionaryTraining = 64 << 20
+	// maxDictionarySample is how much of each sample is trained on, like
+	// zstd --train does.
+	maxDictionarySample = 128 << 10
+)
+
+// checkDictionary reports whether jobs of owner compressing with algorithm
+// may use the dictionary id, which may be empty for none. A non-empty message
+// explains why they may not.
+func (app *Application) checkDictionary(ctx context.Context, id, algorithm, owner string) string {
+	if id == "" {
+		return ""
+	}
+	if algorithm != common.AlgorithmZstd {
+		return "Dictionaries require the zstd algorithm"
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return "Unknown dictionary: " + id
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+	defer cancel()
+
+	info, err := common.GetDictionaryInfo(ctx, app.Storage, app.Bucket, id)
+	if err != nil || info.Owner != owner {
+		if err != nil && !errors.Is(err, common.ErrObjectNotExist) {
+			slog.Error("Failed to load dictionary", "dictionary", id, "error", err)
+		}
+		return "Unknown dictionary: " + id
+	}
+	return ""
+}
+
+// createDictionaryHandler trains a zstd dictionary on the `file` parts of a
+// multipart request, samples of the small files the caller is going to
+// compress with it, and stores it for their jobs to name as `dictionary`.
+// The optional content_type labels what kind of files it is for.
+func (app *Application) createDictionaryHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDictionaryTraining)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if common.Classify(err) == common.ErrTooLarge {
+			common.WriteError(w, "Samples exceed size limit", common.StatusCode(err))
+			return
+		}
+		common.WriteError(w, "Failed to read samples: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["file"]
+	if len(files) < compression.MinDictionarySamples {
+		common.WriteError(w, fmt.Sprintf("Training takes at least %d samples", compression.MinDictionarySamples), http.StatusBadRequest)
+		return
+	}
+	samples := make([][]byte, 0, len(files))
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			common.WriteError(w, "Failed to read samples: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		sample, err := io.ReadAll(io.LimitReader(file, maxDictionarySample))
+		file.Close()
+		if err != nil {
+			common.WriteError(w, "Failed to read samples: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		samples = append(samples, sample)
+	}
+
+	// zstd reserves IDs below 32768, and those from 2^31 for future use
+	dict, err := compression.TrainDictionary(rand.Uint32N(1<<31-32768)+32768, samples, compression.DictionarySize)
+	if errors.Is(err, compression.ErrTooFewSamples) {
+		common.WriteError(w, "Failed to train dictionary: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to train dictionary", "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	info := &common.DictionaryInfo{
+		ID:          uuid.New().String(),
+		Owner:       requestOwner(r),
+		ContentType: r.FormValue("content_type"),
+		Samples:     len(samples),
+		Size:        int64(len(dict)),
+		CreatedAt:   time.Now().UTC(),
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+	if err := common.SaveDictionary(ctx, app.Storage, app.Bucket, info, dict); err != nil {
+		slog.Error("Failed to save dictionary", "dictionary", info.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Trained dictionary", "dictionary", info.ID, "samples", info.Samples, "size", info.Size)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(info)
+}
+
+// listDictionariesHandler returns the dictionaries of the caller, oldest
+// first, optionally only those for the content_type in the query.
+func (app *Application) listDictionariesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	all, err := common.ListDictionaries(ctx, app.Storage, app.Bucket)
+	if err != nil {
+		slog.Error("Failed to list dictionaries", "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	owner, contentType := requestOwner(r), r.URL.Query().Get("content_type")
+	dictionaries := []*common.DictionaryInfo{}
+	for _, info := range all {
+		if info.Owner == owner && (contentType == "" || info.ContentType == contentType) {
+			dictionaries = append(dictionaries, info)
+		}
+	}
+	sort.Slice(dictionaries, func(i, j int) bool {
+		return dictionaries[i].CreatedAt.Before(dictionaries[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"dictionaries": dictionaries})
+}
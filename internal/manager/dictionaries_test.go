@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// createDictionaryRequest builds a training request with n similar samples.
+func createDictionaryRequest(t *testing.T, n int, contentType, apiKey string) *http.Request {
+	t.Helper()
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	if contentType != "" {
+		writer.WriteField("content_type", contentType)
+	}
+	for i := range n {
+		part, err := writer.CreateFormFile("file", fmt.Sprintf("event-%d.json", i))
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		fmt.Fprintf(part, `{"event":"page_view","user_id":%d,"path":"/products/%d","country":"CA"}`, i*7919, i%97)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/dictionaries", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(apiKeyHeader, apiKey)
+	return req
+}
+
+func TestDictionaries(t *testing.T) {
+	app, _, mockPubSub := setupTestApp(t)
+	handler := app.Handler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createDictionaryRequest(t, 3, "", "tenant-a"))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected too few samples to be rejected, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, createDictionaryRequest(t, 20, "application/json", "tenant-a"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected dictionary to be created, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var info common.DictionaryInfo
+	json.NewDecoder(rr.Body).Decode(&info)
+	if info.ID == "" || info.Samples != 20 || info.Size == 0 || info.ContentType != "application/json" {
+		t.Fatalf("Unexpected dictionary: %+v", info)
+	}
+	if dict, err := common.LoadDictionary(context.Background(), app.Storage, app.Bucket, info.ID); err != nil || int64(len(dict)) != info.Size {
+		t.Fatalf("Expected the dictionary to be stored, got %d bytes, %v", len(dict), err)
+	}
+
+	t.Run("list", func(t *testing.T) {
+		for key, want := range map[string]int{"tenant-a": 1, "tenant-b": 0} {
+			req := httptest.NewRequest(http.MethodGet, "/dictionaries?content_type=application/json", nil)
+			req.Header.Set(apiKeyHeader, key)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			var list struct {
+				Dictionaries []common.DictionaryInfo `json:"dictionaries"`
+			}
+			json.NewDecoder(rr.Body).Decode(&list)
+			if rr.Code != http.StatusOK || len(list.Dictionaries) != want {
+				t.Errorf("Expected %d dictionaries for %s, got %v: %+v", want, key, rr.Code, list)
+			}
+		}
+	})
+
+	testCases := []struct {
+		name   string
+		fields map[string]string
+		apiKey string
+		status int
+	}{
+		{name: "zstd", fields: map[string]string{"algorithm": "zstd", "dictionary": info.ID}, apiKey: "tenant-a", status: http.StatusAccepted},
+		{name: "other algorithm", fields: map[string]string{"algorithm": "gzip", "dictionary": info.ID}, apiKey: "tenant-a", status: http.StatusBadRequest},
+		{name: "other tenant", fields: map[string]string{"algorithm": "zstd", "dictionary": info.ID}, apiKey: "tenant-b", status: http.StatusBadRequest},
+		{name: "unknown", fields: map[string]string{"algorithm": "zstd", "dictionary": "nope"}, apiKey: "tenant-a", status: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := createTestMultipartRequestWithFields(t, "file", "event.json", `{"event":"click"}`, tc.fields)
+			req.Header.Set(apiKeyHeader, tc.apiKey)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if rr.Code != tc.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.status, rr.Body.String())
+			}
+			if tc.status != http.StatusAccepted {
+				return
+			}
+			jobID := getJobIDFromResponse(t, rr.Body)
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || job.Dictionary != info.ID {
+				t.Errorf("Expected the job to record the dictionary, got %+v, %v", job, err)
+			}
+			messages := mockPubSub.GetMessages(testCompressTopic)
+			var message common.CompressedMsgSchema
+			common.UnmarshalMessage(messages[len(messages)-1].Data, &message)
+			if message.Dictionary != info.ID {
+				t.Errorf("Expected the message to carry the dictionary, got %+v", message)
+			}
+		})
+	}
+}
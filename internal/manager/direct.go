@@ -0,0 +1,314 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// errAlreadySubmitted aborts the update of a job that left AWAITING_UPLOAD.
+var errAlreadySubmitted = errors.New("job was already submitted")
+
+// inputObjectPath is where the file uploaded for a job is stored.
+func inputObjectPath(job *common.Job) string {
+	if job.Operation == common.OperationDecompress {
+		return compressedObjectPath(job.ObjectDir(), job.FileName)
+	}
+	return originalObjectPath(job.ObjectDir(), job.FileName)
+}
+
+// createDirectJobHandler creates a job whose file the client uploads straight
+// to GCS through a signed resumable upload URL, so large files never pass
+// through the manager. The job is enqueued by submitJobHandler afterwards.
+// The URL only accepts files up to the size limit of the operation, or of the
+// size the client declared.
+func (app *Application) createDirectJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req createUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.FileName == "" {
+		common.WriteError(w, "file_name is required", http.StatusBadRequest)
+		return
+	}
+	if req.Size < 0 || req.Size > app.uploadLimits(req.Operation).MaxSize {
+		common.WriteError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	checksum, errMsg := parseChecksum(req.SHA256)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	job := &common.Job{
+		ID:         uuid.New().String(),
+		Operation:  req.Operation,
+		Status:     common.JobAwaitingUpload,
+		FileName:   req.FileName,
+		Owner:      requestOwner(r),
+		KMSKeyName: req.KMSKey,
+		SHA256:     checksum,
+		Priority:   req.Priority,
+		BatchID:    req.GroupID,
+		RequestID:  common.RequestID(r.Context()),
+	}
+	job.Dir = app.jobDir(job.Owner, job.ID)
+	if job.NotBefore, errMsg = parseNotBefore(req.NotBefore); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if errMsg := app.checkGroup(r.Context(), req.GroupID, job.Owner); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if errMsg := validateKMSKey(req.KMSKey); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if !common.ValidPriority(req.Priority) {
+		common.WriteError(w, "Unsupported priority: "+req.Priority, http.StatusBadRequest)
+		return
+	}
+	switch req.Operation {
+	case common.OperationCompress:
+		profile := app.requestProfile(req.Profile, req.Algorithm, req.Level, req.Format, req.FileName, contentTypeFor(req.FileName, req.ContentType))
+		algorithm, level, errMsg := app.applyProfile(profile, req.Algorithm, req.Level)
+		if errMsg != "" {
+			common.WriteError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		if algorithm, errMsg = compressionAlgorithm(algorithm, req.Format); errMsg != "" {
+			common.WriteError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		if errMsg := compressionLevel(algorithm, level); errMsg != "" {
+			common.WriteError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		if errMsg := app.checkCodecOwner(algorithm, job.Owner); errMsg != "" {
+			common.WriteError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		job.Algorithm = algorithm
+		job.Level = level
+		job.Profile = profile
+		if errMsg := app.checkDictionary(r.Context(), req.Dictionary, algorithm, job.Owner); errMsg != "" {
+			common.WriteError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		job.Verify = req.Verify
+		job.Dictionary = req.Dictionary
+		job.ContentType = contentTypeFor(req.FileName, req.ContentType)
+	case common.OperationDecompress:
+		algorithm, ok := common.AlgorithmFromFileName(req.FileName)
+		if !ok {
+			common.WriteError(w, "Wrong file format", http.StatusBadRequest)
+			return
+		}
+		job.Algorithm = algorithm
+	default:
+		common.WriteError(w, "Unsupported operation: "+req.Operation, http.StatusBadRequest)
+		return
+	}
+
+	// how the upload works depends on the storage backend, the client just
+	// sends the request it is given
+	expiresAt := time.Now().Add(app.SignedURLExpiry).UTC()
+	upload, err := app.Storage.SignUploadURL(app.Bucket, inputObjectPath(job), expiresAt,
+		common.WithKMSKey(job.KMSKeyName), common.WithSize(req.Size), common.WithMaxSize(app.uploadLimits(job.Operation).MaxSize))
+	if err != nil {
+		slog.Error("Failed to sign upload URL", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+	if err := app.JobStore.CreateJob(ctx, job); err != nil {
+		slog.Error("Failed to create job record", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.addToGroup(ctx, job.Owner, job.BatchID, job.ID); err != nil {
+		slog.Error("Failed to add job to group", "job", job.ID, "group", job.BatchID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Debug("Created job awaiting direct upload", "job", job.ID, "file", job.FileName)
+
+	logJobID(r, job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"job_id":         job.ID,
+		"upload_url":     upload.URL,
+		"upload_method":  upload.Method,
+		"upload_headers": upload.Headers,
+		"expires_at":     expiresAt.Format(time.RFC3339),
+	})
+}
+
+// submitJobHandler enqueues a job created by createDirectJobHandler once its
+// file has been uploaded. The upload is checked against the size limit and
+// the checksum first, since the signed URL can't enforce either everywhere.
+func (app *Application) submitJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != common.JobAwaitingUpload {
+		common.WriteError(w, "Job was already submitted", http.StatusConflict)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	inputPath := inputObjectPath(job)
+	info, err := app.Storage.StatObject(ctx, app.Bucket, inputPath)
+	if err != nil {
+		if errors.Is(err, common.ErrObjectNotExist) {
+			common.WriteError(w, "File has not been uploaded", http.StatusConflict)
+			return
+		}
+		slog.Error("Failed to check uploaded file", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if info.Size > app.uploadLimits(job.Operation).MaxSize {
+		app.removeDirectUpload(ctx, job.ID, inputPath)
+		common.WriteError(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if job.SHA256 != "" {
+		checksum, err := app.objectChecksum(ctx, inputPath)
+		if err != nil {
+			slog.Error("Failed to hash uploaded file", "job", job.ID, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if checksum != job.SHA256 {
+			app.removeDirectUpload(ctx, job.ID, inputPath)
+			writeSubmitError(w, errChecksumMismatch)
+			return
+		}
+	}
+
+	if job.Operation == common.OperationDecompress {
+		var codecErr *codecNotAllowedError
+		if err := app.checkDecompressCodec(ctx, job.Owner, job.Algorithm, inputPath); errors.As(err, &codecErr) {
+			app.removeDirectUpload(ctx, job.ID, inputPath)
+			writeSubmitError(w, err)
+			return
+		} else if err != nil {
+			slog.Error("Failed to read uploaded file", "job", job.ID, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var quotaErr *quotaExceededError
+	if err := app.checkQuota(ctx, job.Owner, info.Size); errors.As(err, &quotaErr) {
+		// the file is kept, so the job can be submitted once the quota resets
+		writeQuotaError(w, quotaErr)
+		return
+	} else if err != nil {
+		slog.Error("Failed to check quota", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var algorithm, reason, contentType string
+	if job.Operation == common.OperationCompress && job.Algorithm == common.AlgorithmAuto {
+		if algorithm, reason, contentType, err = app.autoAlgorithmOf(ctx, job, app.Bucket, inputPath); err != nil {
+			slog.Error("Failed to choose algorithm", "job", job.ID, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// only one concurrent submit gets to move the job on and enqueue it
+	submitted, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+		if j.Status != common.JobAwaitingUpload {
+			return errAlreadySubmitted
+		}
+		j.Status = initialStatus(j.NotBefore)
+		j.InputSize = info.Size
+		if algorithm != "" {
+			j.Algorithm, j.AlgorithmReason, j.ContentType = algorithm, reason, contentType
+		}
+		if j.Operation == common.OperationCompress {
+			j.Parts = app.splitParts(j)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errAlreadySubmitted) {
+			common.WriteError(w, "Job was already submitted", http.StatusConflict)
+			return
+		}
+		slog.Error("Failed to update job record", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	job = submitted
+
+	// the file never went through the manager, so there is no frequency
+	// table; the worker builds it from the original instead.
+	if job.Operation == common.OperationCompress {
+		err = app.publishCompress(job, common.CompressedMsgSchema{
+			UID:              job.ID,
+			OriginalFilePath: inputPath,
+			Algorithm:        job.Algorithm,
+			Level:            job.Level,
+			FileName:         job.FileName,
+			ContentType:      job.ContentType,
+			KMSKeyName:       job.KMSKeyName,
+			Verify:           job.Verify,
+			Dictionary:       job.Dictionary,
+		})
+	} else {
+		err = app.publish(app.topicFor(app.DecompressTopicID, job.Priority), job, common.DecompressedMsgSchema{
+			UID:                job.ID,
+			CompressedFilePath: inputPath,
+			Algorithm:          job.Algorithm,
+			KMSKeyName:         job.KMSKeyName,
+		})
+	}
+	if err != nil {
+		// let the client submit again
+		if _, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+			if j.Status != common.JobPending && j.Status != common.JobScheduled {
+				return errAlreadySubmitted
+			}
+			j.Status = common.JobAwaitingUpload
+			return nil
+		}); err != nil {
+			slog.Error("Failed to reset job record", "job", job.ID, "error", err)
+		}
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	app.recordUsage(ctx, job.Owner, info.Size)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": job.ID})
+}
+
+// removeDirectUpload deletes a file that was rejected at submit, so the client
+// can upload it again while the URL is valid.
+func (app *Application) removeDirectUpload(ctx context.Context, jobID, object string) {
+	if err := app.Storage.DeleteObject(ctx, app.Bucket, object); err != nil {
+		slog.Warn("Failed to remove rejected upload", "job", jobID, "object", object, "error", err)
+	}
+}
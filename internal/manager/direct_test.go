@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func createDirectJob(t *testing.T, app *Application, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.createDirectJobHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func submitJob(t *testing.T, app *Application, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/jobs/"+id+"/submit", nil)
+	req.SetPathValue("id", id)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.submitJobHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateDirectJobHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedObject string
+	}{
+		{name: "compress", body: `{"operation":"compress","file_name":"big.txt"}`, expectedStatus: http.StatusCreated, expectedObject: "original_big.txt"},
+		{name: "decompress", body: `{"operation":"decompress","file_name":"big.txt.ranran"}`, expectedStatus: http.StatusCreated, expectedObject: "big.txt.ranran"},
+		{name: "wrong decompress format", body: `{"operation":"decompress","file_name":"big.txt"}`, expectedStatus: http.StatusBadRequest},
+		{name: "unsupported operation", body: `{"operation":"shred","file_name":"big.txt"}`, expectedStatus: http.StatusBadRequest},
+		{name: "missing file name", body: `{"operation":"compress"}`, expectedStatus: http.StatusBadRequest},
+		{name: "declared size too large", body: `{"operation":"compress","file_name":"big.txt","size":1073741825}`, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "invalid sha256", body: `{"operation":"compress","file_name":"big.txt","sha256":"abc"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			rr := createDirectJob(t, app, tc.body)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus != http.StatusCreated {
+				return
+			}
+
+			var response map[string]any
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			jobID, _ := response["job_id"].(string)
+			uploadURL, _ := response["upload_url"].(string)
+			if !strings.Contains(uploadURL, jobID+"/"+tc.expectedObject) || !strings.Contains(uploadURL, "method=POST") {
+				t.Errorf("Unexpected upload URL %q", uploadURL)
+			}
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || job.Status != common.JobAwaitingUpload {
+				t.Errorf("Unexpected job record: %+v, %v", job, err)
+			}
+		})
+	}
+}
+
+func TestDirectUpload(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+
+	rr := createDirectJob(t, app, `{"operation":"compress","file_name":"big.txt","algorithm":"zstd"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create job: %d %s", rr.Code, rr.Body.String())
+	}
+	var response map[string]any
+	json.NewDecoder(rr.Body).Decode(&response)
+	jobID, _ := response["job_id"].(string)
+
+	if rr := submitJob(t, app, jobID); rr.Code != http.StatusConflict {
+		t.Errorf("Expected submitting before the upload to be rejected, got %d", rr.Code)
+	}
+
+	// stands in for the client uploading through the signed URL
+	wc := mockGCS.NewObjectWriter(context.Background(), testBucket, jobID+"/original_big.txt")
+	wc.Write([]byte("uploaded directly"))
+	wc.Close()
+
+	if rr := submitJob(t, app, jobID); rr.Code != http.StatusAccepted {
+		t.Fatalf("Failed to submit job: %d %s", rr.Code, rr.Body.String())
+	}
+	job, err := app.JobStore.GetJob(context.Background(), jobID)
+	if err != nil || job.Status != common.JobPending || job.InputSize != int64(len("uploaded directly")) {
+		t.Errorf("Unexpected job record: %+v, %v", job, err)
+	}
+
+	messages := mockPubSub.GetMessages(testCompressTopic)
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message to be published, got %d", len(messages))
+	}
+	var msg common.CompressedMsgSchema
+	if err := common.UnmarshalMessage(messages[0].Data, &msg); err != nil {
+		t.Fatalf("Failed to decode message: %v", err)
+	}
+	if msg.OriginalFilePath != jobID+"/original_big.txt" || msg.Algorithm != common.AlgorithmZstd {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+
+	if rr := submitJob(t, app, jobID); rr.Code != http.StatusConflict {
+		t.Errorf("Expected a second submit to be rejected, got %d", rr.Code)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 1 {
+		t.Errorf("Expected still 1 message to be published, got %d", len(messages))
+	}
+}
+
+func TestSubmitJobChecks(t *testing.T) {
+	const content = "uploaded directly"
+	sum := sha256.Sum256([]byte(content))
+	digest := hex.EncodeToString(sum[:])
+
+	testCases := []struct {
+		name           string
+		sha256         string
+		maxUploadSize  int64
+		expectedStatus int
+	}{
+		{name: "matching sha256", sha256: digest, maxUploadSize: 1 << 20, expectedStatus: http.StatusAccepted},
+		{name: "sha256 mismatch", sha256: strings.Repeat("0", 64), maxUploadSize: 1 << 20, expectedStatus: http.StatusUnprocessableEntity},
+		{name: "too large", maxUploadSize: 4, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.MaxUploadSize = tc.maxUploadSize
+
+			rr := createDirectJob(t, app, `{"operation":"compress","file_name":"big.txt","sha256":"`+tc.sha256+`"}`)
+			var response map[string]any
+			json.NewDecoder(rr.Body).Decode(&response)
+			jobID, _ := response["job_id"].(string)
+
+			wc := mockGCS.NewObjectWriter(context.Background(), testBucket, jobID+"/original_big.txt")
+			wc.Write([]byte(content))
+			wc.Close()
+
+			rr = submitJob(t, app, jobID)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			if tc.expectedStatus == http.StatusAccepted {
+				return
+			}
+
+			// the rejected file is removed and the job left to upload again
+			if _, ok := mockGCS.GetObjectContent(jobID + "/original_big.txt"); ok {
+				t.Error("Expected the rejected upload to be removed")
+			}
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || job.Status != common.JobAwaitingUpload {
+				t.Errorf("Unexpected job record: %+v, %v", job, err)
+			}
+			if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+				t.Errorf("Expected no message to be published, got %d", len(messages))
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package manager
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// recordEvent adds a step to the audit trail of a job. The trail is only
+// there for debugging, so failures are logged and otherwise ignored.
+func (app *Application) recordEvent(ctx context.Context, jobID string, eventType common.JobEventType, reason string) {
+	if err := common.RecordJobEvent(ctx, app.Storage, app.Bucket, common.JobEvent{
+		JobID:  jobID,
+		Type:   eventType,
+		Reason: reason,
+	}); err != nil {
+		slog.Warn("Failed to record job event", "job", jobID, "event", eventType, "error", err)
+	}
+}
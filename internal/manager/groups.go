@@ -0,0 +1,201 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// group gathers jobs submitted over any number of requests, such as the files
+// of a folder, so their progress can be followed as a whole. A batch is a
+// group created by its request. The jobs carry the group ID as their BatchID.
+type group struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errGroupNotFound rejects a group_id that doesn't name a group of the caller.
+var errGroupNotFound = errors.New("group not found")
+
+// groupRecordPath is where the group id of owner is recorded, under the
+// prefix of owner.
+func (app *Application) groupRecordPath(owner, id string) string {
+	return fmt.Sprintf("%sgroups/%s/group.json", app.tenantPrefix(owner), id)
+}
+
+// groupMembersPrefix holds an empty object per job of the group, so jobs can
+// join concurrently without updating a shared record.
+func (app *Application) groupMembersPrefix(owner, id string) string {
+	return fmt.Sprintf("%sgroups/%s/jobs/", app.tenantPrefix(owner), id)
+}
+
+// createGroup records a new group owned by owner under id.
+func (app *Application) createGroup(ctx context.Context, id, owner string) error {
+	data, err := json.Marshal(group{ID: id, Owner: owner, CreatedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal group: %w", err)
+	}
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, app.groupRecordPath(owner, id), common.WithIfNotExists())
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write group: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close group writer: %w", err)
+	}
+	return nil
+}
+
+// loadGroup reads the group id, which is only found for its owner.
+func (app *Application) loadGroup(ctx context.Context, owner, id string) (*group, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errGroupNotFound
+	}
+	rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, app.groupRecordPath(owner, id))
+	if err != nil {
+		if errors.Is(err, common.ErrObjectNotExist) {
+			return nil, errGroupNotFound
+		}
+		return nil, fmt.Errorf("failed to read group: %w", err)
+	}
+	defer rc.Close()
+
+	var g group
+	if err := json.NewDecoder(rc).Decode(&g); err != nil {
+		return nil, fmt.Errorf("failed to decode group: %w", err)
+	}
+	if g.Owner != owner {
+		return nil, errGroupNotFound
+	}
+	return &g, nil
+}
+
+// checkGroup reports whether jobs of owner may join the group id, which may
+// be empty for jobs outside of any group. A non-empty message explains why
+// they may not.
+func (app *Application) checkGroup(ctx context.Context, id, owner string) string {
+	if id == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+	defer cancel()
+
+	if _, err := app.loadGroup(ctx, owner, id); err != nil {
+		if !errors.Is(err, errGroupNotFound) {
+			slog.Error("Failed to load group", "group", id, "error", err)
+		}
+		return "Unknown group_id: " + id
+	}
+	return ""
+}
+
+// addToGroup adds a job of owner to its group, if it has one.
+func (app *Application) addToGroup(ctx context.Context, owner, groupID, jobID string) error {
+	if groupID == "" {
+		return nil
+	}
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, app.groupMembersPrefix(owner, groupID)+jobID)
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to add job to group: %w", err)
+	}
+	return nil
+}
+
+// createGroupHandler starts an empty group that jobs join by sending its ID
+// as group_id.
+func (app *Application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	groupID := uuid.New().String()
+	if err := app.createGroup(ctx, groupID, requestOwner(r)); err != nil {
+		slog.Error("Failed to create group", "group", groupID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"group_id": groupID})
+}
+
+// groupTask is one job of a group as reported by groupStatusHandler.
+type groupTask struct {
+	JobID     string           `json:"job_id"`
+	FileName  string           `json:"file_name"`
+	Status    common.JobStatus `json:"status"`
+	Error     string           `json:"error,omitempty"`
+	ResultURL string           `json:"result_url,omitempty"`
+}
+
+// groupStatusHandler reports the progress of every job of a group and of the
+// group as a whole, which is finished once all of its jobs are.
+func (app *Application) groupStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	owner := requestOwner(r)
+	g, err := app.loadGroup(ctx, owner, r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, errGroupNotFound) {
+			common.WriteError(w, "Group not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("Failed to load group", "group", r.PathValue("id"), "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	members, err := app.Storage.ListObjects(ctx, app.Bucket, app.groupMembersPrefix(owner, g.ID))
+	if err != nil {
+		slog.Error("Failed to list group members", "group", g.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	tasks := make([]groupTask, 0, len(members))
+	done, failed, finished := 0, 0, 0
+	for _, member := range members {
+		jobID := strings.TrimPrefix(member.Name, app.groupMembersPrefix(owner, g.ID))
+		job, err := app.JobStore.GetJob(ctx, jobID)
+		if err != nil {
+			slog.Error("Failed to get job of group", "group", g.ID, "job", jobID, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		task := groupTask{JobID: job.ID, FileName: job.FileName, Status: job.Status, Error: job.Error}
+		switch job.Status {
+		case common.JobDone:
+			task.ResultURL = apiVersion + "/jobs/" + job.ID + "/result"
+			done++
+		case common.JobFailed:
+			failed++
+		}
+		if job.Status.Finished() {
+			finished++
+		}
+		tasks = append(tasks, task)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"group_id":   g.ID,
+		"created_at": g.CreatedAt,
+		"total":      len(tasks),
+		"done":       done,
+		"failed":     failed,
+		"finished":   len(tasks) > 0 && finished == len(tasks),
+		"tasks":      tasks,
+	})
+}
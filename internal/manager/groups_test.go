@@ -0,0 +1,102 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestGroups(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	handler := app.Handler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/groups", nil))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	var created map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&created); err != nil || created["group_id"] == "" {
+		t.Fatalf("Expected a group ID, got %v, %v", created, err)
+	}
+	groupID := created["group_id"]
+
+	// files join the group over separate requests
+	var jobIDs []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		req := createTestMultipartRequestWithFields(t, "file", name, "hello "+name, map[string]string{"group_id": groupID})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+		}
+		jobIDs = append(jobIDs, getJobIDFromResponse(t, rr.Body))
+	}
+	for id, status := range map[string]common.JobStatus{jobIDs[0]: common.JobDone, jobIDs[1]: common.JobFailed} {
+		if _, err := app.JobStore.UpdateJob(context.Background(), id, func(j *common.Job) error {
+			j.Status = status
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/groups/"+groupID, nil))
+	var progress struct {
+		Total    int         `json:"total"`
+		Done     int         `json:"done"`
+		Failed   int         `json:"failed"`
+		Finished bool        `json:"finished"`
+		Tasks    []groupTask `json:"tasks"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&progress); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("Failed to get group: %v, %d", err, rr.Code)
+	}
+	if progress.Total != 3 || progress.Done != 1 || progress.Failed != 1 || progress.Finished {
+		t.Errorf("Expected 1 of 3 jobs done and 1 failed, got %+v", progress)
+	}
+	for _, task := range progress.Tasks {
+		if (task.ResultURL != "") != (task.JobID == jobIDs[0]) {
+			t.Errorf("Expected only the done job to link its result, got %+v", task)
+		}
+	}
+}
+
+func TestGroupValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		groupID string
+	}{
+		{name: "malformed", groupID: "not-a-group"},
+		{name: "unknown", groupID: "6f1c2a9e-5b1d-4a43-9b7e-1d2f3a4b5c6d"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello", map[string]string{"group_id": tc.groupID})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	// a group only takes jobs of its owner
+	app, _, _ := setupTestApp(t)
+	if err := app.createGroup(context.Background(), "6f1c2a9e-5b1d-4a43-9b7e-1d2f3a4b5c6d", keyOwner("someone else")); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello", map[string]string{"group_id": "6f1c2a9e-5b1d-4a43-9b7e-1d2f3a4b5c6d"})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
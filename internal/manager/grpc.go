@@ -0,0 +1,337 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/pkg/managerpb"
+)
+
+// grpcChunkSize is how much of a result each StreamResult message carries.
+const grpcChunkSize = 256 << 10
+
+// grpcServer serves the gRPC API with the same jobs, storage and quotas as the
+// HTTP API.
+type grpcServer struct {
+	managerpb.UnimplementedManagerServer
+	app *Application
+}
+
+// GRPCServer returns a gRPC server with the Manager service registered.
+func (app *Application) GRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, err := app.grpcAuth(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, err := app.grpcAuth(ss.Context())
+			if err != nil {
+				return err
+			}
+			return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+		}),
+	)
+	managerpb.RegisterManagerServer(srv, &grpcServer{app: app})
+	return srv
+}
+
+// grpcMetadata returns the first value of key in the metadata of a call.
+func grpcMetadata(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(key)); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcRequestID returns the request ID in the metadata of a call, or a new
+// one.
+func grpcRequestID(ctx context.Context) string {
+	if values := metadata.ValueFromIncomingContext(ctx, strings.ToLower(common.RequestIDHeader)); len(values) > 0 && common.ValidRequestID(values[0]) {
+		return values[0]
+	}
+	return common.NewRequestID()
+}
+
+// grpcAuth lets calls through like withAuth does requests: with a valid
+// bearer token in the authorization metadata when OIDC is configured, or an
+// accepted API key. It returns ctx with the owner the call is accounted to,
+// see grpcOwner.
+func (app *Application) grpcAuth(ctx context.Context) (context.Context, error) {
+	if token, ok := strings.CutPrefix(grpcMetadata(ctx, "Authorization"), "Bearer "); ok && app.oidc != nil {
+		claims, err := app.oidc.Verify(ctx, token)
+		if errors.Is(err, common.ErrInvalidToken) {
+			slog.Info("Rejected bearer token", "error", err)
+			return nil, status.Error(codes.Unauthenticated, "Invalid bearer token")
+		}
+		if err != nil {
+			slog.Error("Failed to verify bearer token", "error", err)
+			return nil, status.Error(codes.Unavailable, "Service unavailable")
+		}
+		return context.WithValue(ctx, ownerContextKey{}, subjectOwner(claims.Subject)), nil
+	}
+	key := grpcMetadata(ctx, apiKeyHeader)
+	if (len(app.APIKeys) > 0 || app.oidc != nil) && !app.APIKeys[key] {
+		return nil, status.Error(codes.Unauthenticated, "Missing or invalid "+apiKeyHeader+" or bearer token")
+	}
+	return context.WithValue(ctx, ownerContextKey{}, keyOwner(key)), nil
+}
+
+// grpcOwner is who a call let through by grpcAuth is accounted to.
+func grpcOwner(ctx context.Context) string {
+	owner, _ := ctx.Value(ownerContextKey{}).(string)
+	return owner
+}
+
+// authedStream carries the context grpcAuth returned to the handler of a
+// stream.
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcError turns err into a status with the code matching its class.
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var quotaErr *quotaExceededError
+	if errors.As(err, &quotaErr) {
+		return status.Error(codes.ResourceExhausted, quotaErr.Error())
+	}
+	switch common.Classify(err) {
+	case common.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case common.ErrTooLarge:
+		return status.Error(codes.ResourceExhausted, "File exceeds size limit")
+	case common.ErrCorruptInput, common.ErrPermanent:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case common.ErrUnavailable:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, "Internal server error")
+}
+
+// uploadStreamReader reads the file chunks of a SubmitCompression stream, failing
+// like http.MaxBytesReader once more than limit bytes were sent.
+type uploadStreamReader struct {
+	stream managerpb.Manager_SubmitCompressionServer
+	buf    []byte
+	read   int64
+	limit  int64
+}
+
+func (r *uploadStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if req.GetOptions() != nil {
+			return 0, status.Error(codes.InvalidArgument, "Options can only be sent in the first message")
+		}
+		r.buf = req.GetChunk()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if r.read += int64(n); r.read > r.limit {
+		return 0, &http.MaxBytesError{Limit: r.limit}
+	}
+	return n, nil
+}
+
+func (s *grpcServer) SubmitCompression(stream managerpb.Manager_SubmitCompressionServer) error {
+	app := s.app
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	opts := first.GetOptions()
+	if opts == nil {
+		return status.Error(codes.InvalidArgument, "The first message must hold the options")
+	}
+	if opts.GetFileName() == "" {
+		return status.Error(codes.InvalidArgument, "Missing file name")
+	}
+	algorithm, errMsg := checkCompressOptions(opts.GetAlgorithm(), "", int(opts.GetLevel()), opts.GetKmsKey())
+	if errMsg != "" {
+		return status.Error(codes.InvalidArgument, errMsg)
+	}
+	owner := grpcOwner(stream.Context())
+	if errMsg := app.checkCodecOwner(algorithm, owner); errMsg != "" {
+		return status.Error(codes.InvalidArgument, errMsg)
+	}
+	checksum, errMsg := parseChecksum(opts.GetSha256())
+	if errMsg != "" {
+		return status.Error(codes.InvalidArgument, errMsg)
+	}
+	contentType := opts.GetContentType()
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	params := compressParams{
+		FileName:    opts.GetFileName(),
+		ContentType: contentType,
+		Algorithm:   algorithm,
+		Level:       int(opts.GetLevel()),
+		Owner:       owner,
+		KMSKeyName:  opts.GetKmsKey(),
+		SHA256:      checksum,
+		Verify:      opts.GetVerify(),
+		RequestID:   grpcRequestID(stream.Context()),
+		// leaves the algorithm to the profile rules
+		DefaultAlgorithm: opts.GetAlgorithm() == "" && opts.GetLevel() == 0,
+	}
+
+	ctx, cancel := context.WithTimeout(stream.Context(), app.GCSTimeout)
+	err = app.checkQuota(ctx, params.Owner, 0)
+	cancel()
+	if err != nil {
+		var quotaErr *quotaExceededError
+		if !errors.As(err, &quotaErr) {
+			slog.Error("Failed to check quota", "owner", params.Owner, "error", err)
+		}
+		return grpcError(err)
+	}
+
+	slog.Info("Processing a gRPC request for compressing")
+	jobID, err := app.submitCompress(&uploadStreamReader{stream: stream, limit: app.uploadLimits(common.OperationCompress).MaxSize}, params)
+	if err != nil {
+		return grpcError(err)
+	}
+	return stream.SendAndClose(&managerpb.SubmitCompressionResponse{JobId: jobID})
+}
+
+// getJob loads the job with the given ID for a gRPC call.
+func (app *Application) getJob(ctx context.Context, id string) (*common.Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid job ID")
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+	defer cancel()
+
+	job, err := app.JobStore.GetJob(ctx, id)
+	if err != nil {
+		if errors.Is(err, common.ErrJobNotFound) {
+			return nil, status.Error(codes.NotFound, "Job not found")
+		}
+		slog.Error("Failed to get job record", "job", id, "error", err)
+		return nil, grpcError(err)
+	}
+	if !app.visibleTo(grpcOwner(ctx), job) {
+		return nil, status.Error(codes.NotFound, "Job not found")
+	}
+	return job, nil
+}
+
+func (s *grpcServer) GetJob(ctx context.Context, req *managerpb.GetJobRequest) (*managerpb.Job, error) {
+	job, err := s.app.getJob(ctx, req.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+	return jobToProto(job), nil
+}
+
+func (s *grpcServer) StreamResult(req *managerpb.StreamResultRequest, stream managerpb.Manager_StreamResultServer) error {
+	app := s.app
+	job, err := app.getJob(stream.Context(), req.GetJobId())
+	if err != nil {
+		return err
+	}
+	if job.Status == common.JobExpired {
+		return status.Error(codes.FailedPrecondition, "Job result has expired")
+	}
+	if job.Status != common.JobDone || job.ResultPath == "" {
+		return status.Error(codes.FailedPrecondition, "Job is not complete")
+	}
+
+	rc, err := app.Storage.NewObjectReader(stream.Context(), job.ResultIn(app.Bucket), job.ResultPath)
+	if err != nil {
+		slog.Error("Failed to open job result", "job", job.ID, "error", err)
+		return grpcError(err)
+	}
+	defer rc.Close()
+
+	if err := stream.Send(&managerpb.StreamResultResponse{Payload: &managerpb.StreamResultResponse_Info{
+		Info: &managerpb.ResultInfo{FileName: resultFileName(job), ContentType: resultContentType(job)},
+	}}); err != nil {
+		return err
+	}
+	buf := make([]byte, grpcChunkSize)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&managerpb.StreamResultResponse{Payload: &managerpb.StreamResultResponse_Chunk{Chunk: buf[:n]}}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			slog.Error("Failed to stream job result", "job", job.ID, "error", err)
+			return grpcError(err)
+		}
+	}
+}
+
+var jobStatusToProto = map[common.JobStatus]managerpb.JobStatus{
+	common.JobAwaitingUpload: managerpb.JobStatus_JOB_STATUS_AWAITING_UPLOAD,
+	common.JobPending:        managerpb.JobStatus_JOB_STATUS_PENDING,
+	// the API has no status for jobs waiting for their not_before yet, nor
+	// for append jobs taking segments
+	common.JobScheduled:  managerpb.JobStatus_JOB_STATUS_PENDING,
+	common.JobOpen:       managerpb.JobStatus_JOB_STATUS_PROCESSING,
+	common.JobProcessing: managerpb.JobStatus_JOB_STATUS_PROCESSING,
+	common.JobDone:       managerpb.JobStatus_JOB_STATUS_DONE,
+	common.JobFailed:     managerpb.JobStatus_JOB_STATUS_FAILED,
+	common.JobExpired:    managerpb.JobStatus_JOB_STATUS_EXPIRED,
+	common.JobCanceled:   managerpb.JobStatus_JOB_STATUS_CANCELED,
+}
+
+func jobToProto(job *common.Job) *managerpb.Job {
+	return &managerpb.Job{
+		Id:                job.ID,
+		Operation:         job.Operation,
+		Status:            jobStatusToProto[job.Status],
+		FileName:          job.FileName,
+		ContentType:       job.ContentType,
+		Algorithm:         job.Algorithm,
+		Level:             int32(job.Level),
+		BatchId:           job.BatchID,
+		Archive:           job.Archive,
+		InputSize:         job.InputSize,
+		Verify:            job.Verify,
+		ResultContentType: job.ResultContentType,
+		Error:             job.Error,
+		CreatedAt:         protoTime(job.CreatedAt),
+		UpdatedAt:         protoTime(job.UpdatedAt),
+	}
+}
+
+func protoTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,195 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/pkg/client"
+)
+
+// startGRPC serves the gRPC API of app in memory and returns a client for it.
+func startGRPC(t *testing.T, app *Application, apiKey string) *client.GRPCClient {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	srv := app.GRPCServer()
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	c, err := client.NewGRPC("passthrough:///bufnet", apiKey,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGRPCSubmitCompression(t *testing.T) {
+	testCases := []struct {
+		name         string
+		apiKey       string
+		content      string
+		options      *client.CompressOptions
+		expectedCode codes.Code
+	}{
+		{name: "success", apiKey: "key", content: "hello grpc", options: &client.CompressOptions{Algorithm: "zstd", Level: 3}},
+		{name: "default options", apiKey: "key", content: "hello grpc"},
+		{name: "file too large", apiKey: "key", content: strings.Repeat("a", testSmallUploadSize+1), expectedCode: codes.ResourceExhausted},
+		{name: "unknown algorithm", apiKey: "key", content: "hello", options: &client.CompressOptions{Algorithm: "nope"}, expectedCode: codes.InvalidArgument},
+		{name: "checksum mismatch", apiKey: "key", content: "hello", options: &client.CompressOptions{SHA256: strings.Repeat("0", 64)}, expectedCode: codes.InvalidArgument},
+		{name: "invalid API key", apiKey: "wrong", content: "hello", expectedCode: codes.Unauthenticated},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.APIKeys = map[string]bool{"key": true}
+			c := startGRPC(t, app, tc.apiKey)
+
+			jobID, err := c.Compress(context.Background(), "notes.txt", strings.NewReader(tc.content), tc.options)
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+			if tc.expectedCode != codes.OK {
+				if len(mockPubSub.GetMessages(app.CompressTopicID)) != 0 {
+					t.Error("Expected no job to be published")
+				}
+				return
+			}
+
+			content, ok := mockGCS.GetObjectContent(originalObjectPath(jobID, "notes.txt"))
+			if !ok || content != tc.content {
+				t.Errorf("Expected the upload to be stored, got %q", content)
+			}
+			if len(mockPubSub.GetMessages(app.CompressTopicID)) != 1 {
+				t.Error("Expected the job to be published")
+			}
+			job, err := c.Job(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != client.JobPending || job.FileName != "notes.txt" {
+				t.Errorf("Unexpected job: %+v", job)
+			}
+		})
+	}
+}
+
+func TestGRPCStreamResult(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	c := startGRPC(t, app, "")
+	ctx := context.Background()
+
+	doneJobID := uuid.NewString()
+	resultPath := doneJobID + "/notes.txt"
+	result := strings.Repeat("result ", grpcChunkSize/4)
+	mockGCS.files[resultPath] = bytes.NewBufferString(result)
+	pendingJobID := uuid.NewString()
+	for _, job := range []*common.Job{
+		{ID: doneJobID, Operation: common.OperationDecompress, Status: common.JobDone, FileName: "notes.txt.ranran", ResultPath: resultPath},
+		{ID: pendingJobID, Operation: common.OperationCompress, Status: common.JobPending, FileName: "notes.txt"},
+	} {
+		if err := app.JobStore.CreateJob(ctx, job); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name         string
+		jobID        string
+		expectedCode codes.Code
+	}{
+		{name: "done job", jobID: doneJobID},
+		{name: "pending job", jobID: pendingJobID, expectedCode: codes.FailedPrecondition},
+		{name: "unknown job", jobID: uuid.NewString(), expectedCode: codes.NotFound},
+		{name: "invalid job id", jobID: "not-a-uuid", expectedCode: codes.InvalidArgument},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			name, err := c.Download(ctx, tc.jobID, &out)
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+			if tc.expectedCode != codes.OK {
+				return
+			}
+			if name != "notes.txt" || out.String() != result {
+				t.Errorf("Expected notes.txt with %d bytes, got %q with %d bytes", len(result), name, out.Len())
+			}
+		})
+	}
+}
+
+func TestGRPCOIDCAuth(t *testing.T) {
+	provider := newTestProvider(t)
+	token := provider.token(t, provider.key, jwt.Claims{
+		Issuer:   provider.server.URL,
+		Subject:  "user-1",
+		Audience: jwt.Audience{"cdc"},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+
+	testCases := []struct {
+		name         string
+		apiKey       string
+		bearer       string
+		expectedCode codes.Code
+	}{
+		{name: "valid token", bearer: token},
+		{name: "nothing", expectedCode: codes.Unauthenticated},
+		{name: "any API key", apiKey: "key", expectedCode: codes.Unauthenticated},
+		{name: "not a token", bearer: "secret", expectedCode: codes.Unauthenticated},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// no API keys, only OIDC
+			app, _, mockPubSub := setupTestApp(t)
+			app.TenantPrefix = "tenants/{tenant}/"
+			app.oidc = common.NewOIDCVerifier(provider.server.URL, "cdc")
+			c := startGRPC(t, app, tc.apiKey)
+			ctx := context.Background()
+			if tc.bearer != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+tc.bearer)
+			}
+
+			jobID, err := c.Compress(ctx, "notes.txt", strings.NewReader("hello grpc"), nil)
+			if status.Code(err) != tc.expectedCode {
+				t.Fatalf("Expected code %v, got %v", tc.expectedCode, err)
+			}
+			if tc.expectedCode != codes.OK {
+				if len(mockPubSub.GetMessages(app.CompressTopicID)) != 0 {
+					t.Error("Expected no job to be published")
+				}
+				return
+			}
+
+			job, err := app.JobStore.GetJob(ctx, jobID)
+			if err != nil || job.Owner != subjectOwner("user-1") {
+				t.Fatalf("Expected the job to be accounted to the subject, got %+v, %v", job, err)
+			}
+			if _, err := c.Job(ctx, jobID); err != nil {
+				t.Errorf("Expected the subject to find its job, got %v", err)
+			}
+			if _, err := c.Job(context.Background(), jobID); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("Expected a call without the token to be rejected, got %v", err)
+			}
+		})
+	}
+}
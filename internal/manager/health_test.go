@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestReadyz(t *testing.T) {
+	testCases := []struct {
+		name           string
+		gcsDown        bool
+		pubsubDown     bool
+		expectedStatus int
+		failedCheck    string
+	}{
+		{name: "ready", expectedStatus: http.StatusOK},
+		{name: "gcs unreachable", gcsDown: true, expectedStatus: http.StatusServiceUnavailable, failedCheck: "storage"},
+		{name: "pubsub unreachable", pubsubDown: true, expectedStatus: http.StatusServiceUnavailable, failedCheck: "pubsub"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			mockGCS.unreachable = tc.gcsDown
+			mockPubSub.unreachable = tc.pubsubDown
+
+			rr := httptest.NewRecorder()
+			common.ReadyzHandler(time.Second, app.readinessChecks()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			var body struct {
+				Checks map[string]string `json:"checks"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			for name, result := range body.Checks {
+				if (name == tc.failedCheck) == (result == "ok") {
+					t.Errorf("Unexpected result for check %s: %q", name, result)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(common.HealthzHandler).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	testCases := []struct {
+		name           string
+		token          string
+		authorization  string
+		expectedStatus int
+	}{
+		// without a token the API handles the path, which doesn't exist
+		{name: "disabled", authorization: "Bearer secret", expectedStatus: http.StatusNotFound},
+		{name: "missing token", token: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", authorization: "Bearer nope", expectedStatus: http.StatusUnauthorized},
+		{name: "valid token", token: "secret", authorization: "Bearer secret", expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.DebugToken = tc.token
+
+			for _, path := range []string{"/debug/pprof/heap", "/debug/vars"} {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				if tc.authorization != "" {
+					req.Header.Set("Authorization", tc.authorization)
+				}
+				rr := httptest.NewRecorder()
+				app.Handler().ServeHTTP(rr, req)
+				if rr.Code != tc.expectedStatus {
+					t.Errorf("%s returned wrong status code: got %v want %v", path, rr.Code, tc.expectedStatus)
+				}
+			}
+		})
+	}
+}
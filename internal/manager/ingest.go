@@ -0,0 +1,208 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+var (
+	// errSourceNotAllowed rejects sources the manager must not read for
+	// clients: buckets that aren't IngestBuckets of theirs, and private
+	// addresses.
+	errSourceNotAllowed = errors.New("source not allowed")
+	// errSourceUnavailable reports a source that couldn't be read.
+	errSourceUnavailable = errors.New("source unavailable")
+)
+
+// ingestRequest is the body of POST /ingest: the job to create, as for
+// POST /uploads, and where to get its file.
+type ingestRequest struct {
+	createUploadRequest
+	URL string `json:"url"`
+}
+
+// ingestAllowed reports whether owner may have the platform read from
+// bucket, one of the IngestBuckets listed for them.
+func (app *Application) ingestAllowed(bucket, owner string) bool {
+	return bucket != app.Bucket && app.IngestBuckets[bucket][owner]
+}
+
+// ingestHandler creates a job from a file the manager fetches itself, from
+// an HTTP(S) URL or a gs:// or s3:// object of the storage backend, so that
+// data already in the cloud doesn't travel through the client. The file is
+// streamed into the bucket like an upload before the job is enqueued.
+func (app *Application) ingestHandler(w http.ResponseWriter, r *http.Request) {
+	var req ingestRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	source, err := url.Parse(req.URL)
+	if err != nil || source.Host == "" {
+		common.WriteError(w, "Invalid url: "+req.URL, http.StatusBadRequest)
+		return
+	}
+	if req.FileName == "" {
+		req.FileName = path.Base(source.Path)
+	}
+	if req.FileName == "." || req.FileName == "/" {
+		common.WriteError(w, "file_name is required", http.StatusBadRequest)
+		return
+	}
+
+	session, errMsg := app.newUploadSession(r, req.createUploadRequest)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	limits := app.uploadLimits(session.Operation)
+	ctx, cancel := context.WithTimeout(r.Context(), limits.Timeout)
+	defer cancel()
+	file, size, err := app.openSource(ctx, source, session.Owner)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to open ingest source", "url", source.Redacted(), "error", err)
+		writeSourceError(w, err)
+		return
+	}
+	defer file.Close()
+	if size > limits.MaxSize {
+		common.WriteError(w, "File exceeds size limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	jobID, err := app.submitUpload(&limitedReader{r: file, limit: limits.MaxSize}, session, common.RequestID(r.Context()))
+	if err != nil {
+		if errors.Is(err, errSourceUnavailable) {
+			writeSourceError(w, err)
+			return
+		}
+		writeSubmitError(w, err)
+		return
+	}
+
+	logJobID(r, jobID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+}
+
+func writeSourceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errSourceNotAllowed):
+		common.WriteError(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errSourceUnavailable):
+		common.WriteError(w, err.Error(), http.StatusBadGateway)
+	default:
+		common.WriteError(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// openSource opens the file at source for owner and returns its size, or -1
+// when it is unknown.
+func (app *Application) openSource(ctx context.Context, source *url.URL, owner string) (io.ReadCloser, int64, error) {
+	switch source.Scheme {
+	case "gs", "s3":
+		bucket, object := source.Host, strings.TrimPrefix(source.Path, "/")
+		if !app.ingestAllowed(bucket, owner) {
+			return nil, 0, fmt.Errorf("%w: bucket %s", errSourceNotAllowed, bucket)
+		}
+		info, err := app.Storage.StatObject(ctx, bucket, object)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", errSourceUnavailable, err)
+		}
+		reader, err := app.Storage.NewObjectReader(ctx, bucket, object)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", errSourceUnavailable, err)
+		}
+		return sourceReader{reader}, info.Size, nil
+	case "http", "https":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.String(), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := app.ingestClient().Do(req)
+		if err != nil {
+			if errors.Is(err, errSourceNotAllowed) {
+				return nil, 0, fmt.Errorf("%w: %s resolves to a private address", errSourceNotAllowed, source.Hostname())
+			}
+			return nil, 0, fmt.Errorf("%w: %v", errSourceUnavailable, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("%w: %s", errSourceUnavailable, resp.Status)
+		}
+		return sourceReader{resp.Body}, resp.ContentLength, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported url scheme %q", source.Scheme)
+	}
+}
+
+// ingestClient fetches HTTP sources. Unless IngestPrivateNetworks is set, it
+// refuses to connect to loopback, private and link-local addresses, so that
+// clients can't reach the metadata server or other internal services through
+// the manager, redirects included.
+func (app *Application) ingestClient() *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !app.IngestPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return errSourceNotAllowed
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// the dialer checks the address of the proxy otherwise
+	transport.Proxy = nil
+	return &http.Client{Transport: transport}
+}
+
+// sourceReader marks failures to read a source as such, so they aren't
+// mistaken for failures to store it.
+type sourceReader struct {
+	io.ReadCloser
+}
+
+func (r sourceReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %v", errSourceUnavailable, err)
+	}
+	return n, err
+}
+
+// limitedReader fails once more than limit bytes were read, like
+// http.MaxBytesReader does for request bodies.
+type limitedReader struct {
+	r     io.Reader
+	read  int64
+	limit int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.read += int64(n); r.read > r.limit {
+		return 0, &http.MaxBytesError{Limit: r.limit}
+	}
+	return n, err
+}
@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestIngestHandler(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/data/notes.txt", "/data/notes.ranran":
+			w.Write([]byte("remote bytes"))
+		case "/data/large.txt":
+			w.Write([]byte(strings.Repeat("a", testSmallUploadSize+1)))
+		case "/data/streamed.txt":
+			// no Content-Length, the limit applies while streaming
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("a", testSmallUploadSize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	testCases := []struct {
+		name           string
+		body           map[string]any
+		privateBlocked bool
+		wantCode       int
+		wantFile       string
+		wantOperation  string
+	}{
+		{name: "http", body: map[string]any{"operation": "compress", "url": source.URL + "/data/notes.txt"}, wantCode: http.StatusAccepted, wantFile: "notes.txt", wantOperation: common.OperationCompress},
+		{name: "named", body: map[string]any{"operation": "compress", "url": source.URL + "/data/notes.txt", "file_name": "renamed.txt"}, wantCode: http.StatusAccepted, wantFile: "renamed.txt", wantOperation: common.OperationCompress},
+		{name: "decompress", body: map[string]any{"operation": "decompress", "url": source.URL + "/data/notes.ranran"}, wantCode: http.StatusAccepted, wantFile: "notes.ranran", wantOperation: common.OperationDecompress},
+		{name: "allowed bucket", body: map[string]any{"operation": "compress", "url": "gs://allowed/data/notes.txt"}, wantCode: http.StatusAccepted, wantFile: "notes.txt", wantOperation: common.OperationCompress},
+		{name: "other bucket", body: map[string]any{"operation": "compress", "url": "gs://other/data/notes.txt"}, wantCode: http.StatusForbidden},
+		{name: "bucket of another owner", body: map[string]any{"operation": "compress", "url": "gs://bobs/data/notes.txt"}, wantCode: http.StatusForbidden},
+		{name: "platform bucket", body: map[string]any{"operation": "compress", "url": "gs://" + testBucket + "/data/notes.txt"}, wantCode: http.StatusForbidden},
+		{name: "private address", body: map[string]any{"operation": "compress", "url": source.URL + "/data/notes.txt"}, privateBlocked: true, wantCode: http.StatusForbidden},
+		{name: "missing", body: map[string]any{"operation": "compress", "url": source.URL + "/data/missing.txt"}, wantCode: http.StatusBadGateway},
+		{name: "missing object", body: map[string]any{"operation": "compress", "url": "gs://allowed/data/missing.txt"}, wantCode: http.StatusBadGateway},
+		{name: "too large", body: map[string]any{"operation": "compress", "url": source.URL + "/data/large.txt"}, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "too large streamed", body: map[string]any{"operation": "compress", "url": source.URL + "/data/streamed.txt"}, wantCode: http.StatusRequestEntityTooLarge},
+		{name: "unsupported scheme", body: map[string]any{"operation": "compress", "url": "file:///etc/passwd"}, wantCode: http.StatusBadRequest},
+		{name: "invalid options", body: map[string]any{"operation": "compress", "url": source.URL + "/data/notes.txt", "level": 99}, wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.IngestBuckets = parseOwners("allowed=" + anonymousOwner + ",bobs=" + keyOwner("bob") + "," + testBucket + "=" + anonymousOwner)
+			app.IngestPrivateNetworks = !tc.privateBlocked
+			wc := mockGCS.NewObjectWriter(context.Background(), "allowed", "data/notes.txt")
+			wc.Write([]byte("remote bytes"))
+			wc.Close()
+
+			body, _ := json.Marshal(tc.body)
+			req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if rr.Code != http.StatusAccepted {
+				if len(mockPubSub.GetMessages(app.CompressTopicID))+len(mockPubSub.GetMessages(app.DecompressTopicID)) != 0 {
+					t.Error("Expected no job to be enqueued")
+				}
+				return
+			}
+
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.FileName != tc.wantFile || job.Operation != tc.wantOperation {
+				t.Errorf("Unexpected job record: %+v", job)
+			}
+			if got, _ := mockGCS.GetObjectContent(inputObjectPath(job)); got != "remote bytes" {
+				t.Errorf("Expected the source to be stored as the input, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// inlineEligible reports whether a compression may be done inline at all,
+// before its size is known. Jobs that are held back, verified or need a
+// dictionary are left to the workers.
+func (app *Application) inlineEligible(params compressParams) bool {
+	return app.InlineThreshold > 0 && !params.Archive && !params.Verify && params.Dictionary == "" && params.NotBefore.IsZero()
+}
+
+// readInline reads file as long as it is at most InlineThreshold bytes. When
+// it is larger, what was read is put back in front of the rest of file and
+// returned as the reader to submit instead.
+func (app *Application) readInline(file io.Reader) ([]byte, io.Reader, error) {
+	data, err := io.ReadAll(io.LimitReader(file, app.InlineThreshold+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) > app.InlineThreshold {
+		return nil, io.MultiReader(bytes.NewReader(data), file), nil
+	}
+	return data, nil, nil
+}
+
+// compressInline compresses data in the manager and stores the result, so
+// that a small file is done by the time the request returns instead of
+// waiting for a worker. The job is created DONE, the original is never
+// stored. Failures are logged here, callers only report them.
+func (app *Application) compressInline(data []byte, params compressParams) (string, error) {
+	jobID := uuid.New().String()
+	start := time.Now()
+	if params.SHA256 != "" {
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != params.SHA256 {
+			return "", errChecksumMismatch
+		}
+	}
+	if params.Algorithm == common.AlgorithmAuto {
+		if _, err := autoAlgorithm(bytes.NewReader(data), &params); err != nil {
+			slog.Error("Failed to choose algorithm", "job", jobID, "error", err)
+			return "", err
+		}
+	}
+	slog.Debug("Compressing inline", "job", jobID, "file", params.FileName, "algorithm", params.Algorithm, "level", params.Level)
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+	size := int64(len(data))
+	if err := app.checkQuota(ctx, params.Owner, size); err != nil {
+		slog.Info("Rejected job over quota", "job", jobID, "owner", params.Owner, "error", err)
+		return "", err
+	}
+
+	codec, err := compression.Lookup(params.Algorithm)
+	if err == nil {
+		codec, err = compression.WithLevel(codec, params.Level)
+	}
+	if err != nil {
+		slog.Error("Failed to select codec", "job", jobID, "error", err)
+		return "", err
+	}
+	// stored as it is when incompressible, like the workers would
+	algorithm, level := params.Algorithm, params.Level
+	stored := common.UsesContainer(algorithm) && algorithm != common.AlgorithmStore &&
+		compression.Incompressible(data[:min(len(data), compression.IncompressibleSampleSize)])
+	if stored {
+		slog.Info("Original is incompressible, storing it as it is", "job", jobID)
+		algorithm, level = common.AlgorithmStore, 0
+		codec, err = compression.Lookup(algorithm)
+		if err != nil {
+			slog.Error("Failed to select codec", "job", jobID, "error", err)
+			return "", err
+		}
+	}
+	var out bytes.Buffer
+	if common.UsesContainer(algorithm) {
+		meta := compression.ContainerMetadata{Name: params.FileName, ContentType: params.ContentType}
+		err = compression.WriteContainer(&out, codec, bytes.NewReader(data), meta)
+	} else {
+		err = codec.Compress(bytes.NewReader(data), &out)
+	}
+	if err != nil {
+		slog.Error("Failed to compress inline", "job", jobID, "error", err)
+		return "", err
+	}
+
+	// the same path a worker would store the result at
+	dir := app.jobDir(params.Owner, jobID)
+	resultPath := fmt.Sprintf("%s/compressed%s", dir, common.AlgorithmExtension(params.Algorithm))
+	digest := sha256.Sum256(out.Bytes())
+	manifest := common.Manifest{
+		JobID:       jobID,
+		Operation:   common.OperationCompress,
+		FileName:    params.FileName,
+		ContentType: params.ContentType,
+		Algorithm:   algorithm,
+		Level:       level,
+		Stored:      stored,
+		Result:      resultPath,
+		InputSize:   size,
+		OutputSize:  int64(out.Len()),
+		SHA256:      hex.EncodeToString(digest[:]),
+		StartedAt:   start.UTC(),
+	}
+	if _, err := app.uploadVerified(ctx, resultPath, &out, "", common.WithKMSKey(params.KMSKeyName)); err != nil {
+		slog.Error("Failed to upload compressed data to storage", "job", jobID, "error", err)
+		return "", err
+	}
+	manifest.FinishedAt = time.Now().UTC()
+	manifestData, _ := json.Marshal(manifest)
+	if _, err := app.uploadVerified(ctx, common.ManifestPath(resultPath), bytes.NewReader(manifestData), "",
+		common.WithContentType("application/json"), common.WithKMSKey(params.KMSKeyName)); err != nil {
+		// the result is stored already, only the manifest is missing
+		slog.Warn("Failed to store result manifest", "job", jobID, "error", err)
+	}
+
+	job := &common.Job{
+		ID:              jobID,
+		Operation:       common.OperationCompress,
+		Status:          common.JobDone,
+		FileName:        params.FileName,
+		ContentType:     params.ContentType,
+		Algorithm:       params.Algorithm,
+		AlgorithmReason: params.AlgorithmReason,
+		Level:           params.Level,
+		BatchID:         params.BatchID,
+		Owner:           params.Owner,
+		InputSize:       size,
+		OutputSize:      manifest.OutputSize,
+		KMSKeyName:      params.KMSKeyName,
+		Priority:        params.Priority,
+		ResultPath:      resultPath,
+		Stored:          stored,
+		Inline:          true,
+		Dir:             dir,
+		RequestID:       params.RequestID,
+		CreatedAt:       start.UTC(),
+	}
+	// the event is saved with the record, and published by the janitor of
+	// the workers if publishing it below fails
+	if app.EventsTopicID != "" {
+		common.QueueJobEvent(job, time.Now())
+	}
+	if err := app.JobStore.CreateJob(ctx, job); err != nil {
+		slog.Error("Failed to create job record", "job", jobID, "error", err)
+		return "", err
+	}
+	if err := app.addToGroup(ctx, params.Owner, params.BatchID, jobID); err != nil {
+		slog.Error("Failed to add job to group", "job", jobID, "group", params.BatchID, "error", err)
+		return "", err
+	}
+	app.recordEvent(ctx, jobID, common.EventSubmitted, "")
+	app.recordEvent(ctx, jobID, common.EventUploaded, "compressed inline")
+	app.recordUsage(ctx, params.Owner, size)
+	if app.EventsTopicID != "" {
+		common.PublishJobEvents(ctx, app.PUBSUBClient, app.JobStore, app.EventsTopicID, job)
+	}
+	inlineJobDuration.Observe(time.Since(start).Seconds())
+	slog.Info("Compressed inline", "job", jobID, "request_id", params.RequestID, "bytes", size, "compressed", out.Len())
+	return jobID, nil
+}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+const testEventsTopic = "test-events-topic"
+
+func TestCompressHandlerInline(t *testing.T) {
+	small := strings.Repeat("small enough to compress right away\n", 10)
+	// large enough to tell from text
+	random := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	testCases := []struct {
+		name       string
+		content    string
+		threshold  int64
+		fields     map[string]string
+		wantInline bool
+		wantStored bool
+	}{
+		{name: "small", content: small, wantInline: true},
+		{name: "random", content: string(random), threshold: int64(len(random)), fields: map[string]string{"algorithm": "zstd"}, wantInline: true, wantStored: true},
+		{name: "gzip", content: small, fields: map[string]string{"format": "gz"}, wantInline: true},
+		{name: "at the threshold", content: strings.Repeat("a", 512), wantInline: true},
+		{name: "large", content: strings.Repeat("a", 513)},
+		{name: "verified", content: small, fields: map[string]string{"verify": "true"}},
+		{name: "scheduled", content: small, fields: map[string]string{"not_before": "2099-01-01T00:00:00Z"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.InlineThreshold = cmp.Or(tc.threshold, 512)
+			app.MaxUploadSize = max(app.MaxUploadSize, 2*app.InlineThreshold)
+			app.EventsTopicID = testEventsTopic
+			req := createTestMultipartRequestWithFields(t, "file", "notes.txt", tc.content, tc.fields)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+
+			published := len(mockPubSub.GetMessages(app.CompressTopicID)) > 0
+			if !tc.wantInline {
+				if rr.Code != http.StatusAccepted {
+					t.Fatalf("Expected the job to be enqueued, got %d: %s", rr.Code, rr.Body)
+				}
+				jobID := getJobIDFromResponse(t, rr.Body)
+				if got, _ := mockGCS.GetObjectContent(originalObjectPath(jobID, "notes.txt")); got != tc.content {
+					t.Errorf("Expected the whole original to be stored, got %d bytes", len(got))
+				}
+				return
+			}
+
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("Expected the job to be done inline, got %d: %s", rr.Code, rr.Body)
+			}
+			if published {
+				t.Error("Expected no message for a job done inline")
+			}
+			jobID := getJobIDFromResponse(t, rr.Body)
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != common.JobDone || !job.Inline || job.InputSize != int64(len(tc.content)) ||
+				job.OutputSize == 0 || job.Stored != tc.wantStored || len(job.PendingEvents) != 0 {
+				t.Errorf("Unexpected job record: %+v", job)
+			}
+			events := mockPubSub.GetMessages(testEventsTopic)
+			if len(events) != 1 || events[0].Attributes["ce-type"] != common.CloudEventJobCompleted || events[0].Attributes["ce-subject"] != jobID {
+				t.Errorf("Expected the completed event of the job, got %+v", events)
+			}
+			if _, ok := mockGCS.GetObjectContent(originalObjectPath(jobID, "notes.txt")); ok {
+				t.Error("Expected the original not to be stored")
+			}
+
+			result, ok := mockGCS.GetObjectContent(job.ResultPath)
+			if !ok {
+				t.Fatalf("Expected the result at %s", job.ResultPath)
+			}
+			var out bytes.Buffer
+			if common.UsesContainer(job.Algorithm) {
+				_, err = compression.ReadContainer(strings.NewReader(result), &out, nil)
+			} else {
+				codec, _ := compression.Lookup(job.Algorithm)
+				err = codec.Decompress(strings.NewReader(result), &out)
+			}
+			if tc.wantStored && len(result) > len(tc.content)+256 {
+				t.Errorf("Expected the stored output to be about the size of the input, got %d for %d bytes", len(result), len(tc.content))
+			}
+			if err != nil || out.String() != tc.content {
+				t.Errorf("Expected the result to decompress to the original, got %d bytes, %v", out.Len(), err)
+			}
+		})
+	}
+}
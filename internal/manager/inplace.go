@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// inPlaceRequest is the body of POST /compress/object: the options of the
+// job, as for POST /uploads, and the object to compress.
+type inPlaceRequest struct {
+	createUploadRequest
+	URL string `json:"url"`
+	// WriteBack stores the result next to the original, named after it with
+	// the extension of the algorithm, instead of in the platform's bucket.
+	WriteBack bool `json:"write_back"`
+}
+
+// inPlaceCompressHandler creates a compression job for an object already in
+// a bucket of the caller, which the workers read from directly, so nothing
+// is uploaded or copied. The platform needs access to the bucket, and the
+// bucket has to be one of the IngestBuckets of the caller.
+func (app *Application) inPlaceCompressHandler(w http.ResponseWriter, r *http.Request) {
+	var req inPlaceRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	source, err := url.Parse(req.URL)
+	if err != nil || (source.Scheme != "gs" && source.Scheme != "s3") || source.Host == "" || strings.Trim(source.Path, "/") == "" {
+		common.WriteError(w, "url has to name an object, e.g. gs://bucket/object", http.StatusBadRequest)
+		return
+	}
+	bucket, object := source.Host, strings.TrimPrefix(source.Path, "/")
+	if !app.ingestAllowed(bucket, requestOwner(r)) {
+		writeSourceError(w, fmt.Errorf("%w: bucket %s", errSourceNotAllowed, bucket))
+		return
+	}
+	if req.SHA256 != "" {
+		common.WriteError(w, "sha256 is only checked for uploads", http.StatusBadRequest)
+		return
+	}
+	req.Operation = common.OperationCompress
+	if req.FileName == "" {
+		req.FileName = path.Base(object)
+	}
+	session, errMsg := app.newUploadSession(r, req.createUploadRequest)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	// validated by newUploadSession
+	notBefore, _ := parseNotBefore(session.NotBefore)
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	info, err := app.Storage.StatObject(ctx, bucket, object)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to check in-place object", "bucket", bucket, "object", object, "error", err)
+		writeSourceError(w, fmt.Errorf("%w: %v", errSourceUnavailable, err))
+		return
+	}
+	var quotaErr *quotaExceededError
+	if err := app.checkQuota(ctx, session.Owner, info.Size); errors.As(err, &quotaErr) {
+		writeQuotaError(w, quotaErr)
+		return
+	} else if err != nil {
+		slog.Error("Failed to check quota", "owner", session.Owner, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	job := &common.Job{
+		ID:           uuid.New().String(),
+		Operation:    common.OperationCompress,
+		Status:       initialStatus(notBefore),
+		FileName:     session.FileName,
+		ContentType:  session.ContentType,
+		Algorithm:    session.Algorithm,
+		Level:        session.Level,
+		BatchID:      session.GroupID,
+		Owner:        session.Owner,
+		InputSize:    info.Size,
+		KMSKeyName:   session.KMSKeyName,
+		Verify:       session.Verify,
+		Priority:     session.Priority,
+		NotBefore:    notBefore,
+		Dictionary:   session.Dictionary,
+		Profile:      session.Profile,
+		RequestID:    common.RequestID(r.Context()),
+		SourceBucket: bucket,
+		SourcePath:   object,
+	}
+	job.Dir = app.jobDir(job.Owner, job.ID)
+	if job.Algorithm == common.AlgorithmAuto {
+		if job.Algorithm, job.AlgorithmReason, job.ContentType, err = app.autoAlgorithmOf(ctx, job, bucket, object); err != nil {
+			slog.Error("Failed to choose algorithm", "job", job.ID, "error", err)
+			writeSourceError(w, fmt.Errorf("%w: %v", errSourceUnavailable, err))
+			return
+		}
+	}
+	job.ResultPath = fmt.Sprintf("%s/compressed%s", job.Dir, common.AlgorithmExtension(job.Algorithm))
+	if req.WriteBack {
+		job.ResultBucket, job.ResultPath = bucket, object+common.AlgorithmExtension(job.Algorithm)
+	}
+
+	if err := app.JobStore.CreateJob(ctx, job); err != nil {
+		slog.Error("Failed to create job record", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := app.addToGroup(ctx, job.Owner, job.BatchID, job.ID); err != nil {
+		slog.Error("Failed to add job to group", "job", job.ID, "group", job.BatchID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// never split, the parts of split jobs are read from the platform's bucket
+	if err := app.publishCompress(job, common.CompressedMsgSchema{
+		UID:              job.ID,
+		OriginalFilePath: object,
+		Algorithm:        job.Algorithm,
+		Level:            job.Level,
+		FileName:         job.FileName,
+		ContentType:      job.ContentType,
+		KMSKeyName:       job.KMSKeyName,
+		Verify:           job.Verify,
+		Dictionary:       job.Dictionary,
+		SourceBucket:     bucket,
+		ResultBucket:     job.ResultBucket,
+		ResultPath:       job.ResultPath,
+	}); err != nil {
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	app.recordUsage(ctx, job.Owner, info.Size)
+
+	logJobID(r, job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": job.ID})
+}
@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestInPlaceCompressHandler(t *testing.T) {
+	testCases := []struct {
+		name             string
+		body             map[string]any
+		wantCode         int
+		wantResultBucket string
+		wantResultPath   string
+	}{
+		{name: "to the platform", body: map[string]any{"url": "gs://allowed/data/notes.txt", "algorithm": "zstd"}, wantCode: http.StatusAccepted, wantResultPath: "/compressed.ranran"},
+		{name: "write back", body: map[string]any{"url": "gs://allowed/data/notes.txt", "algorithm": "zstd", "write_back": true}, wantCode: http.StatusAccepted, wantResultBucket: "allowed", wantResultPath: "data/notes.txt.ranran"},
+		{name: "other bucket", body: map[string]any{"url": "gs://other/data/notes.txt"}, wantCode: http.StatusForbidden},
+		{name: "bucket of another owner", body: map[string]any{"url": "gs://bobs/data/notes.txt"}, wantCode: http.StatusForbidden},
+		{name: "platform bucket", body: map[string]any{"url": "gs://" + testBucket + "/data/notes.txt"}, wantCode: http.StatusForbidden},
+		{name: "missing object", body: map[string]any{"url": "gs://allowed/data/missing.txt"}, wantCode: http.StatusBadGateway},
+		{name: "no object", body: map[string]any{"url": "gs://allowed/"}, wantCode: http.StatusBadRequest},
+		{name: "http", body: map[string]any{"url": "https://example.com/data/notes.txt"}, wantCode: http.StatusBadRequest},
+		{name: "checksum", body: map[string]any{"url": "gs://allowed/data/notes.txt", "sha256": "00"}, wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.IngestBuckets = parseOwners("allowed=" + anonymousOwner + ",bobs=" + keyOwner("bob") + "," + testBucket + "=" + anonymousOwner)
+			wc := mockGCS.NewObjectWriter(context.Background(), "allowed", "data/notes.txt")
+			wc.Write([]byte("bytes of the owner"))
+			wc.Close()
+
+			body, _ := json.Marshal(tc.body)
+			req := httptest.NewRequest(http.MethodPost, "/compress/object", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			messages := mockPubSub.GetMessages(app.CompressTopicID)
+			if rr.Code != http.StatusAccepted {
+				if len(messages) != 0 {
+					t.Error("Expected no job to be enqueued")
+				}
+				return
+			}
+
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			wantResultPath := tc.wantResultPath
+			if tc.wantResultBucket == "" {
+				wantResultPath = job.Dir + wantResultPath
+			}
+			if job.FileName != "notes.txt" || job.SourceBucket != "allowed" || job.SourcePath != "data/notes.txt" ||
+				job.ResultBucket != tc.wantResultBucket || job.ResultPath != wantResultPath {
+				t.Errorf("Unexpected job record: %+v", job)
+			}
+			if _, ok := mockGCS.GetObjectContent(inputObjectPath(job)); ok {
+				t.Error("Expected the object not to be copied")
+			}
+
+			if len(messages) != 1 {
+				t.Fatalf("Expected 1 message, got %d", len(messages))
+			}
+			var msg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(messages[0].Data, &msg); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+			if msg.SourceBucket != "allowed" || msg.OriginalFilePath != "data/notes.txt" ||
+				msg.ResultBucket != tc.wantResultBucket || msg.ResultPath != wantResultPath {
+				t.Errorf("Unexpected message: %+v", msg)
+			}
+		})
+	}
+}
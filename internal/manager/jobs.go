@@ -0,0 +1,397 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// lookupJob resolves the {id} path value into a job record the caller may
+// see, writing the appropriate error response when it can't. The jobs of
+// other tenants aren't found, see visibleTo.
+func (app *Application) lookupJob(w http.ResponseWriter, r *http.Request) (*common.Job, bool) {
+	job, ok := app.lookupAnyJob(w, r)
+	if ok && !app.visibleTo(requestOwner(r), job) {
+		common.WriteError(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, ok
+}
+
+// lookupAnyJob is lookupJob for operators, who see the jobs of every tenant.
+func (app *Application) lookupAnyJob(w http.ResponseWriter, r *http.Request) (*common.Job, bool) {
+	jobID := r.PathValue("id")
+	if _, err := uuid.Parse(jobID); err != nil {
+		common.WriteError(w, "Invalid job ID", http.StatusBadRequest)
+		return nil, false
+	}
+	logJobID(r, jobID)
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	job, err := app.JobStore.GetJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, common.ErrJobNotFound) {
+			common.WriteError(w, "Job not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("Failed to get job record", "job", jobID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
+
+func (app *Application) jobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// maxStatusJobs bounds how many jobs one batch status query may ask for, and
+// statusLookups how many of their records are read at a time.
+const (
+	maxStatusJobs = 1000
+	statusLookups = 16
+)
+
+// jobsStatusRequest lists the jobs of a batch status query.
+type jobsStatusRequest struct {
+	JobIDs []string `json:"job_ids"`
+}
+
+// jobsStatusHandler returns the records of many jobs at once, so clients
+// tracking hundreds of jobs don't need a request for each. Jobs that can't be
+// returned are listed with the reason instead of failing the whole query.
+func (app *Application) jobsStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var req jobsStatusRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.JobIDs) == 0 || len(req.JobIDs) > maxStatusJobs {
+		common.WriteError(w, "Select between 1 and 1000 jobs", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	owner := requestOwner(r)
+	jobs := map[string]*common.Job{}
+	rejected := map[string]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, statusLookups)
+	for _, jobID := range req.JobIDs {
+		if _, err := uuid.Parse(jobID); err != nil {
+			// the lookups started already write rejected too
+			mu.Lock()
+			rejected[jobID] = "Invalid job ID"
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			job, err := app.JobStore.GetJob(ctx, jobID)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, common.ErrJobNotFound), err == nil && !app.visibleTo(owner, job):
+				rejected[jobID] = "Job not found"
+			case err != nil:
+				slog.Error("Failed to get job record", "job", jobID, "error", err)
+				rejected[jobID] = "Internal server error"
+			default:
+				jobs[jobID] = job
+			}
+		}()
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"jobs": jobs, "rejected": rejected})
+}
+
+// errJobFinished aborts the cancellation of a job that already finished.
+var errJobFinished = errors.New("job already finished")
+
+// cancelJobHandler stops a job that hasn't finished yet. Its message may still
+// be queued or being processed, workers drop it once they see the status.
+func (app *Application) cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	job, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+		if j.Status.Finished() {
+			return errJobFinished
+		}
+		j.Status = common.JobCanceled
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errJobFinished) {
+			common.WriteError(w, "Job has already finished", http.StatusConflict)
+			return
+		}
+		slog.Error("Failed to cancel job", "job", r.PathValue("id"), "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Canceled job", "job", job.ID)
+	app.recordEvent(ctx, job.ID, common.EventCanceled, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// resultFileName derives the name the client should save the job output as.
+func resultFileName(job *common.Job) string {
+	if job.Operation == common.OperationDecompress {
+		// the worker restores the original name when the container has one
+		if job.ResultPath != "" {
+			return path.Base(job.ResultPath)
+		}
+		return strings.TrimSuffix(job.FileName, filepath.Ext(job.FileName))
+	}
+	return job.FileName + common.AlgorithmExtension(job.Algorithm)
+}
+
+// resultContentType returns the recorded media type of the job output or
+// guesses it from its name.
+func resultContentType(job *common.Job) string {
+	if job.ResultContentType != "" {
+		return job.ResultContentType
+	}
+	if job.Operation == common.OperationDecompress {
+		if contentType := mime.TypeByExtension(filepath.Ext(resultFileName(job))); contentType != "" {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// resultAvailable writes the error response for a job without a result to
+// hand out. Open append jobs hand out what they have so far.
+func resultAvailable(w http.ResponseWriter, job *common.Job) bool {
+	if job.Status == common.JobExpired {
+		common.WriteError(w, "Job result has expired", http.StatusGone)
+		return false
+	}
+	if (job.Status != common.JobDone && job.Status != common.JobOpen) || job.ResultPath == "" {
+		common.WriteError(w, "Job is not complete", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// jobResultHandler streams the job output. Range requests get only the bytes
+// they ask for, read from storage with a range read, so tools can seek in
+// large results or resume a download. The ETag is the object's version, for
+// If-Range.
+func (app *Application) jobResultHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if !resultAvailable(w, job) {
+		return
+	}
+
+	info, err := app.Storage.StatObject(r.Context(), job.ResultIn(app.Bucket), job.ResultPath)
+	if err != nil {
+		slog.Error("Failed to open job result", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	content := &objectReadSeeker{
+		ctx:     r.Context(),
+		storage: app.Storage,
+		bucket:  job.ResultIn(app.Bucket),
+		object:  job.ResultPath,
+		size:    info.Size,
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", resultContentType(job))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": resultFileName(job),
+	}))
+	if info.Version != "" {
+		// S3 versions are ETags, quotes included
+		w.Header().Set("ETag", `"`+strings.Trim(info.Version, `"`)+`"`)
+	}
+	http.ServeContent(w, r, "", info.Updated, content)
+}
+
+// jobManifestHandler returns the manifest stored next to the job output,
+// see common.Manifest. Results stored before manifests were written have
+// none.
+func (app *Application) jobManifestHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if !resultAvailable(w, job) {
+		return
+	}
+
+	rc, err := app.Storage.NewObjectReader(r.Context(), job.ResultIn(app.Bucket), common.ManifestPath(job.ResultPath))
+	if errors.Is(err, common.ErrObjectNotExist) {
+		common.WriteError(w, "Job result has no manifest", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to open job manifest", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, rc); err != nil {
+		slog.Warn("Failed to send job manifest", "job", job.ID, "error", err)
+	}
+}
+
+// jobHuffmanHandler returns the code tables of a Huffman coded result with
+// how often each symbol was coded, to look into a ratio that is off. It
+// answers JSON, or with ?format=dot a Graphviz digraph of the code tree per
+// table.
+func (app *Application) jobHuffmanHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "dot" {
+		common.WriteError(w, "format must be json or dot", http.StatusBadRequest)
+		return
+	}
+	if !resultAvailable(w, job) {
+		return
+	}
+	if job.Operation == common.OperationDecompress {
+		common.WriteError(w, "Job result is not Huffman coded", http.StatusConflict)
+		return
+	}
+
+	rc, err := app.Storage.NewObjectReader(r.Context(), job.ResultIn(app.Bucket), job.ResultPath)
+	if err != nil {
+		slog.Error("Failed to open job result", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+	// results from before layouts were recorded have that of their encoder
+	legacy := compression.HuffmanLayoutStream
+	if job.Inline {
+		legacy = compression.HuffmanLayoutChunked
+	}
+	tables, err := compression.InspectHuffman(rc, legacy)
+	if errors.Is(err, compression.ErrNotHuffman) {
+		common.WriteError(w, "Job result is not Huffman coded", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to read job code table", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		w.WriteHeader(http.StatusOK)
+		for _, table := range tables {
+			name := job.ID
+			if table.Part > 0 {
+				name = fmt.Sprintf("%s part %d", job.ID, table.Part)
+			}
+			if err := table.WriteDOT(w, name); err != nil {
+				slog.Warn("Failed to send job code table", "job", job.ID, "error", err)
+				return
+			}
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"job_id": job.ID, "tables": tables})
+}
+
+// jobResultURLHandler hands out a time-limited signed GCS URL for the job
+// output so large results don't have to be proxied through the manager.
+func (app *Application) jobResultURLHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	if !resultAvailable(w, job) {
+		return
+	}
+
+	expiry := app.SignedURLExpiry
+	if value := r.URL.Query().Get("expiry"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			common.WriteError(w, "Invalid expiry", http.StatusBadRequest)
+			return
+		}
+		expiry = d
+	}
+	if expiry > app.MaxSignedURLExpiry {
+		common.WriteError(w, "Expiry exceeds maximum of "+app.MaxSignedURLExpiry.String(), http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(expiry).UTC()
+	url, err := app.Storage.SignURL(job.ResultIn(app.Bucket), job.ResultPath, common.SignedURLOptions{
+		Expires: expiresAt,
+		ContentDisposition: mime.FormatMediaType("attachment", map[string]string{
+			"filename": resultFileName(job),
+		}),
+	})
+	if err != nil {
+		slog.Error("Failed to sign result URL", "job", job.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"url":        url,
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,418 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestJobStatusHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+
+	jobID := uuid.NewString()
+	if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+		ID:        jobID,
+		Operation: common.OperationCompress,
+		FileName:  "test.txt",
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		jobID          string
+		expectedStatus int
+	}{
+		{name: "success", jobID: jobID, expectedStatus: http.StatusOK},
+		{name: "unknown job", jobID: uuid.NewString(), expectedStatus: http.StatusNotFound},
+		{name: "invalid job id", jobID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+tc.jobID, nil)
+			req.SetPathValue("id", tc.jobID)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.jobStatusHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var job common.Job
+			if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+				t.Fatalf("Failed to decode job: %v", err)
+			}
+			if job.ID != jobID || job.Status != common.JobPending {
+				t.Errorf("Unexpected job: %+v", job)
+			}
+		})
+	}
+}
+
+func TestJobsStatusHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	var jobIDs []string
+	for _, status := range []common.JobStatus{common.JobPending, common.JobProcessing, common.JobDone} {
+		jobID := uuid.NewString()
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Status: status}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+	unknownID := uuid.NewString()
+
+	body, _ := json.Marshal(map[string]any{"job_ids": append(jobIDs, unknownID, "not-a-uuid")})
+	rr := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/jobs/status", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body)
+	}
+	var resp struct {
+		Jobs     map[string]common.Job `json:"jobs"`
+		Rejected map[string]string     `json:"rejected"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Jobs) != len(jobIDs) || resp.Jobs[jobIDs[2]].Status != common.JobDone {
+		t.Errorf("Expected the records of every job, got %+v", resp.Jobs)
+	}
+	if resp.Rejected[unknownID] != "Job not found" || resp.Rejected["not-a-uuid"] != "Invalid job ID" {
+		t.Errorf("Unexpected rejected jobs: %v", resp.Rejected)
+	}
+
+	for _, body := range []string{`{"job_ids": []}`, `not json`} {
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/jobs/status", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestJobResultHandler(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	ctx := context.Background()
+
+	doneJobID := uuid.NewString()
+	resultPath := doneJobID + "/notes.txt"
+	mockGCS.files[resultPath] = bytes.NewBufferString("hello world")
+	if err := app.JobStore.CreateJob(ctx, &common.Job{
+		ID:         doneJobID,
+		Operation:  common.OperationDecompress,
+		Status:     common.JobDone,
+		FileName:   "notes.txt.ranran",
+		ResultPath: resultPath,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	pendingJobID := uuid.NewString()
+	if err := app.JobStore.CreateJob(ctx, &common.Job{ID: pendingJobID, Operation: common.OperationCompress}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	t.Run("success", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/jobs/"+doneJobID+"/result", nil)
+		req.SetPathValue("id", doneJobID)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.jobResultHandler).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if got := rr.Body.String(); got != "hello world" {
+			t.Errorf("Unexpected body: %q", got)
+		}
+		if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename=notes.txt` {
+			t.Errorf("Unexpected Content-Disposition: %q", got)
+		}
+		if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+			t.Errorf("Unexpected Content-Type: %q", got)
+		}
+	})
+
+	t.Run("ranges", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			header       map[string]string
+			expectedCode int
+			expectedBody string
+			contentRange string
+		}{
+			{name: "from offset", header: map[string]string{"Range": "bytes=6-"}, expectedCode: http.StatusPartialContent, expectedBody: "world", contentRange: "bytes 6-10/11"},
+			{name: "bounded", header: map[string]string{"Range": "bytes=2-4"}, expectedCode: http.StatusPartialContent, expectedBody: "llo", contentRange: "bytes 2-4/11"},
+			{name: "suffix", header: map[string]string{"Range": "bytes=-3"}, expectedCode: http.StatusPartialContent, expectedBody: "rld", contentRange: "bytes 8-10/11"},
+			{name: "unsatisfiable", header: map[string]string{"Range": "bytes=20-"}, expectedCode: http.StatusRequestedRangeNotSatisfiable},
+			// the result changed since the client got its first bytes
+			{name: "stale if-range", header: map[string]string{"Range": "bytes=6-", "If-Range": `"stale"`}, expectedCode: http.StatusOK, expectedBody: "hello world"},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/jobs/"+doneJobID+"/result", nil)
+				req.SetPathValue("id", doneJobID)
+				for name, value := range tc.header {
+					req.Header.Set(name, value)
+				}
+				rr := httptest.NewRecorder()
+				http.HandlerFunc(app.jobResultHandler).ServeHTTP(rr, req)
+
+				if rr.Code != tc.expectedCode {
+					t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedCode)
+				}
+				if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+					t.Errorf("Unexpected body: %q", rr.Body.String())
+				}
+				if got := rr.Header().Get("Content-Range"); tc.contentRange != "" && got != tc.contentRange {
+					t.Errorf("Unexpected Content-Range: %q", got)
+				}
+				if got := rr.Header().Get("Accept-Ranges"); tc.expectedCode != http.StatusRequestedRangeNotSatisfiable && got != "bytes" {
+					t.Errorf("Unexpected Accept-Ranges: %q", got)
+				}
+			})
+		}
+	})
+
+	t.Run("job not complete", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/jobs/"+pendingJobID+"/result", nil)
+		req.SetPathValue("id", pendingJobID)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.jobResultHandler).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("job expired", func(t *testing.T) {
+		expiredJobID := uuid.NewString()
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+			ID: expiredJobID, Operation: common.OperationCompress, Status: common.JobExpired,
+		}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/jobs/"+expiredJobID+"/result", nil)
+		req.SetPathValue("id", expiredJobID)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(app.jobResultHandler).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusGone {
+			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGone)
+		}
+	})
+}
+
+func TestJobResultURLHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.SignedURLExpiry = 15 * time.Minute
+	app.MaxSignedURLExpiry = time.Hour
+
+	jobID := uuid.NewString()
+	if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+		ID:         jobID,
+		Operation:  common.OperationCompress,
+		Status:     common.JobDone,
+		FileName:   "notes.txt",
+		ResultPath: jobID + "/compressed.ranran",
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{name: "default expiry", query: "", expectedStatus: http.StatusOK},
+		{name: "custom expiry", query: "?expiry=30m", expectedStatus: http.StatusOK},
+		{name: "expiry too long", query: "?expiry=2h", expectedStatus: http.StatusBadRequest},
+		{name: "invalid expiry", query: "?expiry=soon", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+jobID+"/url"+tc.query, nil)
+			req.SetPathValue("id", jobID)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.jobResultURLHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp map[string]string
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if !strings.Contains(resp["url"], jobID+"/compressed.ranran") {
+				t.Errorf("Signed URL does not reference the result: %q", resp["url"])
+			}
+			if _, err := time.Parse(time.RFC3339, resp["expires_at"]); err != nil {
+				t.Errorf("Invalid expires_at %q: %v", resp["expires_at"], err)
+			}
+		})
+	}
+}
+
+func TestJobManifestHandler(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+
+	createJob := func(status common.JobStatus, manifest string) string {
+		jobID := uuid.NewString()
+		resultPath := jobID + "/compressed.ranran"
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Status: status, ResultPath: resultPath}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		if manifest != "" {
+			mockGCS.files[common.ManifestPath(resultPath)] = bytes.NewBufferString(manifest)
+		}
+		return jobID
+	}
+
+	testCases := []struct {
+		name           string
+		jobID          string
+		expectedStatus int
+	}{
+		{name: "done job", jobID: createJob(common.JobDone, `{"job_id":"x"}`), expectedStatus: http.StatusOK},
+		{name: "no manifest", jobID: createJob(common.JobDone, ""), expectedStatus: http.StatusNotFound},
+		{name: "pending job", jobID: createJob(common.JobPending, ""), expectedStatus: http.StatusConflict},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+tc.jobID+"/manifest", nil)
+			req.SetPathValue("id", tc.jobID)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.jobManifestHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus == http.StatusOK && (rr.Body.String() != `{"job_id":"x"}` || rr.Header().Get("Content-Type") != "application/json") {
+				t.Errorf("Unexpected manifest response: %q", rr.Body)
+			}
+		})
+	}
+}
+
+func TestJobHuffmanHandler(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+
+	createJob := func(operation, algorithm string) string {
+		jobID := uuid.NewString()
+		resultPath := jobID + "/compressed.ranran"
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: operation, Status: common.JobDone, ResultPath: resultPath}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		codec, err := compression.Lookup(algorithm)
+		if err != nil {
+			t.Fatalf("Failed to look up %s: %v", algorithm, err)
+		}
+		var buf bytes.Buffer
+		if err := compression.WriteContainer(&buf, codec, strings.NewReader("abracadabra"), compression.ContainerMetadata{}); err != nil {
+			t.Fatalf("Failed to write result: %v", err)
+		}
+		mockGCS.files[resultPath] = &buf
+		return jobID
+	}
+	huffmanJob := createJob(common.OperationCompress, common.AlgorithmHuffman)
+
+	testCases := []struct {
+		name           string
+		jobID          string
+		query          string
+		expectedStatus int
+		expectedType   string
+		expectedBody   string
+	}{
+		{name: "json", jobID: huffmanJob, expectedStatus: http.StatusOK, expectedType: "application/json", expectedBody: `"char":"a","frequency":5`},
+		{name: "dot", jobID: huffmanJob, query: "?format=dot", expectedStatus: http.StatusOK, expectedType: "text/vnd.graphviz", expectedBody: `[shape=box, label="'a'\n5"]`},
+		{name: "unknown format", jobID: huffmanJob, query: "?format=svg", expectedStatus: http.StatusBadRequest},
+		{name: "zstd result", jobID: createJob(common.OperationCompress, common.AlgorithmZstd), expectedStatus: http.StatusConflict},
+		{name: "decompressed result", jobID: createJob(common.OperationDecompress, common.AlgorithmHuffman), expectedStatus: http.StatusConflict},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+tc.jobID+"/huffman"+tc.query, nil)
+			req.SetPathValue("id", tc.jobID)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.jobHuffmanHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			if rr.Header().Get("Content-Type") != tc.expectedType || !strings.Contains(rr.Body.String(), tc.expectedBody) {
+				t.Errorf("Unexpected %s response: %s", rr.Header().Get("Content-Type"), rr.Body)
+			}
+		})
+	}
+}
+
+func TestCancelJobHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+
+	createJob := func(status common.JobStatus) string {
+		jobID := uuid.NewString()
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Status: status}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		return jobID
+	}
+
+	testCases := []struct {
+		name           string
+		jobID          string
+		expectedStatus int
+		expectedState  common.JobStatus
+	}{
+		{name: "pending job", jobID: createJob(common.JobPending), expectedStatus: http.StatusOK, expectedState: common.JobCanceled},
+		{name: "processing job", jobID: createJob(common.JobProcessing), expectedStatus: http.StatusOK, expectedState: common.JobCanceled},
+		{name: "awaiting upload", jobID: createJob(common.JobAwaitingUpload), expectedStatus: http.StatusOK, expectedState: common.JobCanceled},
+		{name: "done job", jobID: createJob(common.JobDone), expectedStatus: http.StatusConflict, expectedState: common.JobDone},
+		{name: "already canceled", jobID: createJob(common.JobCanceled), expectedStatus: http.StatusConflict, expectedState: common.JobCanceled},
+		{name: "unknown job", jobID: uuid.NewString(), expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/jobs/"+tc.jobID+"/cancel", nil)
+			req.SetPathValue("id", tc.jobID)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.cancelJobHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedState == "" {
+				return
+			}
+			job, err := app.JobStore.GetJob(context.Background(), tc.jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != tc.expectedState {
+				t.Errorf("Expected job to be %s, got %s", tc.expectedState, job.Status)
+			}
+		})
+	}
+}
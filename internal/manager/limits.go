@@ -0,0 +1,39 @@
+package manager
+
+import (
+	"strings"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// UploadLimits bound the files sent for one operation: how large they may be
+// and how long storing one may take. Zero fields fall back to MaxUploadSize
+// and GCSTimeout.
+type UploadLimits struct {
+	MaxSize int64
+	Timeout time.Duration
+}
+
+// uploadLimitsFromEnv reads the limits of operation from <OPERATION>_MAX_UPLOAD_SIZE
+// and <OPERATION>_UPLOAD_TIMEOUT, e.g. DECOMPRESS_MAX_UPLOAD_SIZE.
+func uploadLimitsFromEnv(operation string) UploadLimits {
+	prefix := strings.ToUpper(operation) + "_"
+	return UploadLimits{
+		MaxSize: int64(common.GetEnvInt(prefix+"MAX_UPLOAD_SIZE", 0)),
+		Timeout: common.GetEnvDuration(prefix+"UPLOAD_TIMEOUT", 0),
+	}
+}
+
+// uploadLimits returns the limits of the files sent for operation, those of
+// OperationLimits over the defaults.
+func (app *Application) uploadLimits(operation string) UploadLimits {
+	limits := app.OperationLimits[operation]
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = app.MaxUploadSize
+	}
+	if limits.Timeout <= 0 {
+		limits.Timeout = app.GCSTimeout
+	}
+	return limits
+}
@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestUploadLimits(t *testing.T) {
+	content := strings.Repeat("a", 600)
+	testCases := []struct {
+		name     string
+		limits   map[string]UploadLimits
+		handler  func(app *Application) http.HandlerFunc
+		fileName string
+		wantCode int
+	}{
+		{name: "compress default", handler: func(app *Application) http.HandlerFunc { return app.compressHandler }, fileName: "notes.txt", wantCode: http.StatusAccepted},
+		{name: "decompress default", handler: func(app *Application) http.HandlerFunc { return app.decompressHandler }, fileName: "notes.ranran", wantCode: http.StatusAccepted},
+		{
+			name:     "compress lowered",
+			limits:   map[string]UploadLimits{common.OperationCompress: {MaxSize: 512}},
+			handler:  func(app *Application) http.HandlerFunc { return app.compressHandler },
+			fileName: "notes.txt",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "decompress unaffected",
+			limits:   map[string]UploadLimits{common.OperationCompress: {MaxSize: 512}},
+			handler:  func(app *Application) http.HandlerFunc { return app.decompressHandler },
+			fileName: "notes.ranran",
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:     "decompress lowered",
+			limits:   map[string]UploadLimits{common.OperationDecompress: {MaxSize: 512}},
+			handler:  func(app *Application) http.HandlerFunc { return app.decompressHandler },
+			fileName: "notes.ranran",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.OperationLimits = tc.limits
+			req := createTestMultipartRequest(t, "file", tc.fileName, content)
+			rr := httptest.NewRecorder()
+			tc.handler(app).ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Errorf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+		})
+	}
+
+	t.Run("from the environment", func(t *testing.T) {
+		t.Setenv("DECOMPRESS_MAX_UPLOAD_SIZE", "2048")
+		t.Setenv("DECOMPRESS_UPLOAD_TIMEOUT", "10m")
+		app, _, _ := setupTestApp(t)
+		app.OperationLimits = map[string]UploadLimits{common.OperationDecompress: uploadLimitsFromEnv(common.OperationDecompress)}
+
+		if got := app.uploadLimits(common.OperationDecompress); got != (UploadLimits{MaxSize: 2048, Timeout: 10 * time.Minute}) {
+			t.Errorf("Unexpected decompress limits %+v", got)
+		}
+		if got := app.uploadLimits(common.OperationCompress); got != (UploadLimits{MaxSize: app.MaxUploadSize, Timeout: app.GCSTimeout}) {
+			t.Errorf("Expected the defaults for compress, got %+v", got)
+		}
+	})
+}
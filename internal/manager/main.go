@@ -1,53 +1,115 @@
-package main
+package manager
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
-	"cloud.google.com/go/pubsub/v2"
-	"cloud.google.com/go/storage"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
 	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
 )
 
 type Application struct {
-	GCSClient         common.GCSClientInterface
+	Storage           common.StorageBackend
 	PUBSUBClient      common.PubSubClientInterface
+	JobStore          common.JobStoreInterface
 	CTX               *context.Context
 	Bucket            string
 	CompressTopicID   string
 	DecompressTopicID string
 	MaxUploadSize     int64
+	MaxBatchFiles     int
 	GCSTimeout        time.Duration
+	// OperationLimits override MaxUploadSize and GCSTimeout for the files
+	// sent to compress or decompress, keyed by operation.
+	OperationLimits map[string]UploadLimits
+	// DailyQuota and MonthlyQuota limit what each API key can submit.
+	DailyQuota   Quota
+	MonthlyQuota Quota
+	// APIKeys are the keys accepted in X-API-Key. When empty, any key is
+	// accepted and requests without one are anonymous.
+	APIKeys map[string]bool
+	// PriorityTopics publishes high and low priority jobs to their own
+	// topics, see common.PriorityTopic. Otherwise every job shares one topic.
+	PriorityTopics bool
+	// Originals larger than SplitThreshold are split into parts of about
+	// SplitPartSize that workers compress in parallel. Zero disables it.
+	SplitThreshold int64
+	SplitPartSize  int64
+	// Originals of up to InlineThreshold bytes sent to /compress are
+	// compressed by the manager right away, see compressInline. Zero
+	// disables it.
+	InlineThreshold int64
+	// EventsTopicID receives the CloudEvents of jobs done inline, like those
+	// the workers publish for theirs. None are published when empty.
+	EventsTopicID string
+	// DebugToken enables the pprof and expvar endpoints under /debug/ for
+	// requests that send it as a bearer token. They are off when empty.
+	DebugToken string
+	// AdminToken enables the operator endpoints under /admin/ for requests
+	// that send it as a bearer token. They are off when empty.
+	AdminToken string
+	// WorkerStaleAfter is how long a worker may miss heartbeats before
+	// /admin/workers reports it as gone.
+	WorkerStaleAfter time.Duration
+	// SignedURLExpiry is the default lifetime of result URLs, which clients
+	// may shorten or extend up to MaxSignedURLExpiry.
+	SignedURLExpiry    time.Duration
+	MaxSignedURLExpiry time.Duration
+	// ProgressPollInterval is how often /jobs/{id}/progress checks the job
+	// for news.
+	ProgressPollInterval time.Duration
+	// MaxWaitTimeout caps how long /jobs/{id}/wait holds a request.
+	MaxWaitTimeout time.Duration
+	// TenantPrefix isolates the jobs of every owner when set: their objects
+	// are stored under it, with {tenant} replaced by the owner, and other
+	// owners can't look them up. E.g. "tenants/{tenant}/".
+	TenantPrefix string
+	// IngestBuckets are the buckets POST /ingest and POST /compress/object
+	// may read gs:// and s3:// sources from, with the owners that may read
+	// each, none by default. HTTP sources have to be on public addresses
+	// unless IngestPrivateNetworks is set.
+	IngestBuckets         map[string]map[string]bool
+	IngestPrivateNetworks bool
+	// CodecOwners restricts codecs to the owners listed for them, e.g. WASM
+	// codecs still being tried out. Codecs that aren't listed are open to all.
+	CodecOwners map[string]map[string]bool
+	// Profiles are the profiles jobs can be submitted with instead of an
+	// algorithm and level, see Profile. ProfileRules pick one for jobs
+	// without either.
+	Profiles     map[string]Profile
+	ProfileRules ProfileRules
+
+	// oidc validates bearer tokens, when OIDC_ISSUER is set.
+	oidc *common.OIDCVerifier
 }
 
 func (app *Application) compressHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		common.WriteError(w, "Only POST method allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(common.OperationCompress).MaxSize)
 
-	// set request body size limit (1GB for now)
-	// TODO: increase the limit through any means (the whole point of the program)
-	r.Body = http.MaxBytesReader(w, r.Body, app.MaxUploadSize)
-
-	file, header, err := r.FormFile("file")
+	file, err := streamFormFile(r)
 	if err != nil {
 		slog.Error("Failed to get file from form", "error", err)
-		// This error is triggered when MaxBytesReader limit is exceeded
-		if strings.Contains(err.Error(), "request body too large") {
-			common.WriteError(w, "File exceeds size limit", http.StatusRequestEntityTooLarge)
+		if common.Classify(err) == common.ErrTooLarge {
+			common.WriteError(w, "File exceeds size limit", common.StatusCode(err))
 			return
 		}
 		common.WriteError(w, "Failed to read file: "+err.Error(), http.StatusBadRequest)
@@ -55,122 +117,469 @@ func (app *Application) compressHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	slog.Info("Processing a request for compressing")
-
-	jobID := uuid.New().String()
-	slog.Debug("Creating new job", "job", jobID, "file", header.Filename)
-
-	// create a pipe to simultaneously building char. req. table while streaming content to GCS
-	pr, pw := io.Pipe()
-
-	freqTable := make(map[rune]uint64)
-	teeReader := io.TeeReader(file, pw)
+	params, errMsg := app.compressOptions(r)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if params.SHA256, errMsg = parseChecksum(r.FormValue("sha256")); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	params.FileName = file.FileName()
+	params.ContentType = contentTypeFor(file.FileName(), file.Header.Get("Content-Type"))
+	app.serveCompress(w, r, file, params)
+}
 
-	go func() {
-		defer pw.Close()
-		bufReader := bufio.NewReader(teeReader)
-		for {
-			// ReadRune() reads a single UTF-8 encoded Unicode character (a rune).
-			char, _, err := bufReader.ReadRune()
+// serveCompress compresses file right away when it is small enough, or
+// submits it as a new job, and answers the request with the job ID.
+func (app *Application) serveCompress(w http.ResponseWriter, r *http.Request, file io.Reader, params compressParams) {
+	app.applyProfileRules(&params)
+	var upload io.Reader = file
+	if app.inlineEligible(params) {
+		data, rest, err := app.readInline(file)
+		if err != nil {
+			slog.Error("Failed to read file", "error", err)
+			writeSubmitError(w, err)
+			return
+		}
+		if data != nil {
+			jobID, err := app.compressInline(data, params)
 			if err != nil {
-				// If we've reached the end of the file, we're done.
-				if err == io.EOF {
-					break
-				}
-				// Otherwise, it's a real error.
-				slog.Error("Failed to read file to build freq. table", "job", jobID, "error", err)
-				pw.CloseWithError(err)
+				writeSubmitError(w, err)
 				return
 			}
-			// Increment the count for the character.
-			freqTable[char]++
+			// the job is done already
+			logJobID(r, jobID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"job_id": jobID, "status": string(common.JobDone)})
+			return
 		}
-	}()
-
-	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
-	defer cancel()
+		upload = rest
+	}
 
-	originalFilePath := fmt.Sprintf("%s/original_%s", jobID, header.Filename)
-	wc := app.GCSClient.NewObjectWriter(ctx, app.Bucket, originalFilePath)
-	if _, err := io.Copy(wc, pr); err != nil {
-		slog.Error("Failed to stream data to GCS", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+	jobID, err := app.submitCompress(upload, params)
+	if err != nil {
+		writeSubmitError(w, err)
 		return
 	}
-	if err := wc.Close(); err != nil {
-		slog.Error("Failed to close data stream to GCS", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
-		return
+
+	// Send 202 Accepted Code
+	logJobID(r, jobID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+}
+
+// compressOptions reads the algorithm, format, level, profile, kms_key,
+// verify, priority, not_before, group_id and dictionary fields of a compression form
+// into the parameters of its jobs, leaving the file to the caller. A non-empty message
+// explains why they are invalid.
+func (app *Application) compressOptions(r *http.Request) (compressParams, string) {
+	var level int
+	if value := r.FormValue("level"); value != "" {
+		var err error
+		if level, err = strconv.Atoi(value); err != nil {
+			return compressParams{}, "Invalid level: " + value
+		}
+	}
+	kmsKey := r.FormValue("kms_key")
+	profile := r.FormValue("profile")
+	algorithm, level, errMsg := app.applyProfile(profile, r.FormValue("algorithm"), level)
+	if errMsg != "" {
+		return compressParams{}, errMsg
+	}
+	algorithm, errMsg = checkCompressOptions(algorithm, r.FormValue("format"), level, kmsKey)
+	if errMsg != "" {
+		return compressParams{}, errMsg
+	}
+	if errMsg := app.checkCodecOwner(algorithm, requestOwner(r)); errMsg != "" {
+		return compressParams{}, errMsg
+	}
+	var verify bool
+	if value := r.FormValue("verify"); value != "" {
+		var err error
+		if verify, err = strconv.ParseBool(value); err != nil {
+			return compressParams{}, "Invalid verify: " + value
+		}
+	}
+	priority := r.FormValue("priority")
+	if !common.ValidPriority(priority) {
+		return compressParams{}, "Unsupported priority: " + priority
+	}
+	notBefore, errMsg := parseNotBefore(r.FormValue("not_before"))
+	if errMsg != "" {
+		return compressParams{}, errMsg
+	}
+	groupID := r.FormValue("group_id")
+	if errMsg := app.checkGroup(r.Context(), groupID, requestOwner(r)); errMsg != "" {
+		return compressParams{}, errMsg
+	}
+	dictionary := r.FormValue("dictionary")
+	if errMsg := app.checkDictionary(r.Context(), dictionary, algorithm, requestOwner(r)); errMsg != "" {
+		return compressParams{}, errMsg
+	}
+	params := compressParams{
+		Algorithm:  algorithm,
+		Level:      level,
+		BatchID:    groupID,
+		Owner:      requestOwner(r),
+		RequestID:  common.RequestID(r.Context()),
+		KMSKeyName: kmsKey,
+		Verify:     verify,
+		Priority:   priority,
+		NotBefore:  notBefore,
+		Dictionary: dictionary,
+		Profile:    profile,
+	}
+	// the profile rules pick the algorithm once the file is known
+	params.DefaultAlgorithm = profile == "" && r.FormValue("algorithm") == "" && r.FormValue("level") == "" && r.FormValue("format") == ""
+	return params, ""
+}
+
+// checkCompressOptions validates the options of a compression, whichever API
+// it came through, and resolves the algorithm to use. A non-empty message
+// explains why they are invalid.
+func checkCompressOptions(algorithm, format string, level int, kmsKey string) (string, string) {
+	algorithm, errMsg := compressionAlgorithm(algorithm, format)
+	if errMsg != "" {
+		return "", errMsg
+	}
+	if errMsg := compressionLevel(algorithm, level); errMsg != "" {
+		return "", errMsg
+	}
+	if errMsg := validateKMSKey(kmsKey); errMsg != "" {
+		return "", errMsg
+	}
+	return algorithm, ""
+}
+
+// kmsKeyPattern matches the resource name of a Cloud KMS key, or the ARN of
+// an AWS KMS key when storing in S3.
+var kmsKeyPattern = regexp.MustCompile(`^(projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+|arn:aws[a-z-]*:kms:[^:]+:[0-9]{12}:(key|alias)/\S+)$`)
+
+// validateKMSKey checks the optional Cloud KMS key a job's files are encrypted
+// with. A non-empty message explains why it is invalid.
+func validateKMSKey(name string) string {
+	if name != "" && !kmsKeyPattern.MatchString(name) {
+		return "Invalid kms_key: " + name
+	}
+	return ""
+}
+
+// compressionAlgorithm resolves the requested algorithm and output format to
+// the codec to use. A non-empty message explains why the request is invalid.
+func compressionAlgorithm(algorithm, format string) (string, string) {
+	switch format {
+	case "", "ranran":
+	case "gz":
+		// standard .gz output is only produced by the gzip codec
+		if algorithm != "" && algorithm != common.AlgorithmGzip {
+			return "", "Output format gz requires the gzip algorithm"
+		}
+		algorithm = common.AlgorithmGzip
+	default:
+		return "", "Unsupported output format: " + format
+	}
+	if algorithm == "" {
+		algorithm = common.AlgorithmHuffman
 	}
-	slog.Debug(fmt.Sprintf("Uploaded %s to GCS", header.Filename), "job", jobID)
+	if algorithm == common.AlgorithmAuto {
+		return algorithm, ""
+	}
+	if _, err := compression.Lookup(algorithm); err != nil {
+		return "", "Unsupported algorithm: " + algorithm
+	}
+	return algorithm, ""
+}
 
-	freqTableBytes, err := json.Marshal(freqTable)
+// compressionLevel checks that the codec of algorithm supports level, 0
+// meaning its default. A non-empty message explains why it doesn't.
+func compressionLevel(algorithm string, level int) string {
+	if algorithm == common.AlgorithmAuto {
+		if level != 0 {
+			return "Levels require an explicit algorithm"
+		}
+		return ""
+	}
+	codec, err := compression.Lookup(algorithm)
 	if err != nil {
-		slog.Error("Failed to marshal frequency table", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return "Unsupported algorithm: " + algorithm
 	}
+	if _, err := compression.WithLevel(codec, level); err != nil {
+		return fmt.Sprintf("Unsupported level %d for %s", level, algorithm)
+	}
+	return ""
+}
 
-	freqTablePath := fmt.Sprintf("%s/frequency_table.json", jobID)
-	wc = app.GCSClient.NewObjectWriter(ctx, app.Bucket, freqTablePath)
-	if _, err := io.Copy(wc, bytes.NewReader(freqTableBytes)); err != nil {
-		slog.Error("Failed to stream frequency table to GCS", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
-		return
+// originalObjectPath is where the file to compress is stored for a job, in
+// its directory dir, see jobDir.
+func originalObjectPath(dir, fileName string) string {
+	return fmt.Sprintf("%s/original_%s", dir, fileName)
+}
+
+// compressedObjectPath is where the file to decompress is stored for a job,
+// in its directory dir.
+func compressedObjectPath(dir, fileName string) string {
+	return fmt.Sprintf("%s/%s", dir, fileName)
+}
+
+// compressParams describes the compression job to create for a file.
+type compressParams struct {
+	FileName    string
+	ContentType string
+	Algorithm   string
+	Level       int
+	// AlgorithmReason says why the auto algorithm became Algorithm.
+	AlgorithmReason string
+	// BatchID is the group the job joins, see group.
+	BatchID string
+	// Archive files are tarballs to compress into an archive container.
+	Archive bool
+	// Owner is who the job is accounted to.
+	Owner string
+	// RequestID is the ID of the request submitting the job.
+	RequestID string
+	// KMSKeyName encrypts the files of the job instead of the bucket's key.
+	KMSKeyName string
+	// SHA256 is the hex digest the file has to match, if the client sent one.
+	SHA256 string
+	// Verify makes the worker check that its output decompresses to the file.
+	Verify bool
+	// Priority picks the topic the job is published to.
+	Priority string
+	// NotBefore holds the job back until then.
+	NotBefore time.Time
+	// Dictionary is the ID of the dictionary to compress with.
+	Dictionary string
+	// Profile is the profile that picked Algorithm and Level, if any.
+	Profile string
+	// DefaultAlgorithm is set while Algorithm is the default one because
+	// the client left it to the deployment, see applyProfileRules.
+	DefaultAlgorithm bool
+}
+
+// submitCompress stores file as the original of a new compression job and
+// enqueues it. Failures are logged here, callers only report them.
+func (app *Application) submitCompress(file io.Reader, params compressParams) (string, error) {
+	jobID := uuid.New().String()
+	app.applyProfileRules(&params)
+	if params.Algorithm == common.AlgorithmAuto {
+		var err error
+		if file, err = autoAlgorithm(file, &params); err != nil {
+			slog.Error("Failed to choose algorithm", "job", jobID, "error", err)
+			return "", err
+		}
+		slog.Debug("Chose algorithm", "job", jobID, "algorithm", params.Algorithm, "reason", params.AlgorithmReason)
 	}
-	if err := wc.Close(); err != nil {
-		slog.Error("Failed to close frequency table data stream to GCS", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
-		return
+	fileName, contentType, algorithm, level := params.FileName, params.ContentType, params.Algorithm, params.Level
+	slog.Debug("Creating new job", "job", jobID, "request_id", params.RequestID, "file", fileName, "algorithm", algorithm, "level", level)
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.uploadLimits(common.OperationCompress).Timeout)
+	defer cancel()
+
+	dir := app.jobDir(params.Owner, jobID)
+	originalFilePath := originalObjectPath(dir, fileName)
+	uploadStart := time.Now()
+	written, err := app.uploadVerified(ctx, originalFilePath, file, params.SHA256,
+		common.WithContentType(contentType), common.WithKMSKey(params.KMSKeyName))
+	if err != nil {
+		slog.Error("Failed to upload file to storage", "job", jobID, "error", err)
+		return "", err
+	}
+	storageUploadDuration.WithLabelValues(common.OperationCompress).Observe(time.Since(uploadStart).Seconds())
+	uploadBytes.WithLabelValues(common.OperationCompress).Observe(float64(written))
+	slog.Debug(fmt.Sprintf("Uploaded %s to storage", fileName), "job", jobID)
+	if err := app.enforceQuota(ctx, jobID, params.Owner, originalFilePath, written); err != nil {
+		return "", err
+	}
+
+	job := &common.Job{
+		ID:              jobID,
+		Operation:       common.OperationCompress,
+		Status:          initialStatus(params.NotBefore),
+		FileName:        fileName,
+		ContentType:     contentType,
+		Algorithm:       algorithm,
+		AlgorithmReason: params.AlgorithmReason,
+		Level:           level,
+		BatchID:         params.BatchID,
+		Archive:         params.Archive,
+		Owner:           params.Owner,
+		InputSize:       written,
+		KMSKeyName:      params.KMSKeyName,
+		Verify:          params.Verify,
+		Priority:        params.Priority,
+		NotBefore:       params.NotBefore,
+		Dictionary:      params.Dictionary,
+		Profile:         params.Profile,
+		Dir:             dir,
+		RequestID:       params.RequestID,
+	}
+	job.Parts = app.splitParts(job)
+	if err := app.JobStore.CreateJob(ctx, job); err != nil {
+		slog.Error("Failed to create job record", "job", jobID, "error", err)
+		return "", err
+	}
+	if err := app.addToGroup(ctx, params.Owner, params.BatchID, jobID); err != nil {
+		slog.Error("Failed to add job to group", "job", jobID, "group", params.BatchID, "error", err)
+		return "", err
 	}
-	slog.Debug("Uploaded frequency table to GCS", "job", jobID)
 
-	// initialize new publisher everytime to avoid sending messages in batch.
-	// TODO: make this more tolerable to message delivery failures.
 	message := common.CompressedMsgSchema{
 		UID:              jobID,
 		OriginalFilePath: originalFilePath,
-		FreqTablePath:    freqTablePath,
+		Algorithm:        algorithm,
+		Level:            level,
+		Archive:          params.Archive,
+		FileName:         fileName,
+		ContentType:      contentType,
+		KMSKeyName:       params.KMSKeyName,
+		Verify:           params.Verify,
+		Dictionary:       params.Dictionary,
 	}
-	messageBytes, err := json.Marshal(message)
-	if err != nil {
-		slog.Error("Failed to marshal MQ message", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
-		return
+	if err := app.publishCompress(job, message); err != nil {
+		return "", err
 	}
+	app.recordUsage(ctx, params.Owner, written)
+	return jobID, nil
+}
 
-	returnedMessageID, err := app.PUBSUBClient.PublishMessage(*app.CTX, app.CompressTopicID, &pubsub.Message{
-		Data: messageBytes,
-	})
+// topicFor returns the topic jobs of priority are published to instead of
+// topicID.
+func (app *Application) topicFor(topicID, priority string) string {
+	if !app.PriorityTopics {
+		return topicID
+	}
+	return common.PriorityTopic(topicID, priority)
+}
+
+// resources are the bucket and the topics the manager publishes jobs to,
+// see common.Bootstrap.
+func (app *Application) resources() common.Resources {
+	res := common.Resources{Bucket: app.Bucket}
+	for _, topicID := range []string{app.CompressTopicID, app.DecompressTopicID} {
+		if !app.PriorityTopics {
+			res.Topics = append(res.Topics, topicID)
+			continue
+		}
+		for _, priority := range common.Priorities {
+			res.Topics = append(res.Topics, common.PriorityTopic(topicID, priority))
+		}
+	}
+	return res
+}
+
+// publish sends a message of job to the given topic through the outbox. The
+// message is persisted first, so that when Pub/Sub can't be reached the
+// reconciler delivers it later. Only failing to persist it is an error. A job
+// that must not start before its NotBefore is only persisted, the outbox
+// reconciler delivers it once it is due.
+func (app *Application) publish(topicID string, job *common.Job, message any) error {
+	return app.publishPart(topicID, job, 0, message)
+}
+
+// publishPart is publish for one part of a split job, numbered from 1.
+func (app *Application) publishPart(topicID string, job *common.Job, part int, message any) error {
+	messageBytes, err := common.MarshalMessage(message)
 	if err != nil {
-		slog.Error("Failed to send MQ message", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
-		return
+		slog.Error("Failed to marshal MQ message", "job", job.ID, "error", err)
+		return err
 	}
-	slog.Debug("Sent message to Pub/Sub ", "job", jobID, "server_generated_message_id", returnedMessageID)
 
-	// Send 202 Accepted Code
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	entry := &outboxEntry{JobID: job.ID, Part: part, TopicID: topicID, Data: messageBytes, RequestID: job.RequestID, CreatedAt: time.Now().UTC()}
+	if job.NotBefore.After(entry.CreatedAt) {
+		entry.NotBefore = job.NotBefore
+	}
+	if err := app.saveOutboxEntry(ctx, entry); err != nil {
+		slog.Error("Failed to persist MQ message", "job", job.ID, "error", err)
+		return err
+	}
+	if part <= 1 {
+		app.recordEvent(ctx, job.ID, common.EventSubmitted, "")
+	}
+	if !entry.NotBefore.IsZero() {
+		slog.Info("Scheduled job", "job", job.ID, "not_before", job.NotBefore)
+		return nil
+	}
+	if err := app.deliver(ctx, entry); err != nil {
+		slog.Warn("Failed to send MQ message, leaving it to the outbox reconciler", "job", job.ID, "error", err)
+	}
+	return nil
 }
 
-func (app *Application) decompressHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		common.WriteError(w, "Only POST method allowed", http.StatusMethodNotAllowed)
-		return
+// uploadContentType returns the media type the client sent for the file,
+// falling back to a guess from its extension when it is missing or generic.
+func uploadContentType(header *multipart.FileHeader) string {
+	return contentTypeFor(header.Filename, header.Header.Get("Content-Type"))
+}
+
+// maxFormFieldSize limits each of the plain fields sent before a file.
+const maxFormFieldSize = 64 << 10
+
+// streamFormFile reads the multipart body of r up to its "file" part, which is
+// returned unread so that the upload streams from the connection to storage
+// without being buffered. The fields before the file end up in r.Form; fields
+// after it are never read, so clients have to send the file last.
+func streamFormFile(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	form := make(url.Values)
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FileName() != "" {
+			if part.FormName() == "file" {
+				// like ParseForm, the body takes precedence over the query
+				for key, values := range r.URL.Query() {
+					form[key] = append(form[key], values...)
+				}
+				r.Form = form
+				return part, nil
+			}
+			part.Close()
+			continue
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > maxFormFieldSize {
+			return nil, fmt.Errorf("field %s is longer than %d bytes", part.FormName(), maxFormFieldSize)
+		}
+		form.Add(part.FormName(), string(value))
+	}
+}
+
+func contentTypeFor(fileName, declared string) string {
+	if declared != "" && declared != "application/octet-stream" {
+		return declared
 	}
+	if contentType := mime.TypeByExtension(filepath.Ext(fileName)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
 
-	// set request body size limit (1GB for now)
-	// TODO: increase the limit through any means (the whole point of the program)
-	r.Body = http.MaxBytesReader(w, r.Body, app.MaxUploadSize)
+func (app *Application) decompressHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(common.OperationDecompress).MaxSize)
 
-	file, header, err := r.FormFile("file")
+	file, err := streamFormFile(r)
 	if err != nil {
 		slog.Error("Failed to get file from form", "error", err)
-		// This error is triggered when MaxBytesReader limit is exceeded
-		if strings.Contains(err.Error(), "request body too large") {
-			common.WriteError(w, "File exceeds size limit", http.StatusRequestEntityTooLarge)
+		if common.Classify(err) == common.ErrTooLarge {
+			common.WriteError(w, "File exceeds size limit", common.StatusCode(err))
 			return
 		}
 		common.WriteError(w, "Failed to read file: "+err.Error(), http.StatusBadRequest)
@@ -178,111 +587,380 @@ func (app *Application) decompressHandler(w http.ResponseWriter, r *http.Request
 	}
 	defer file.Close()
 
-	if !strings.HasSuffix(header.Filename, ".ranran") {
+	algorithm, ok := common.AlgorithmFromFileName(file.FileName())
+	if !ok {
 		common.WriteError(w, "Wrong file format", http.StatusBadRequest)
 		return
 	}
 
-	slog.Info("Processing a request for decompressing")
-
-	jobID := uuid.New().String()
-	slog.Debug("Creating new job", "job", jobID, "file", header.Filename)
-
-	ctx, cancel := context.WithTimeout(*app.CTX, time.Second*50)
-	defer cancel()
-
-	compressedFilePath := fmt.Sprintf("%s/%s", jobID, header.Filename)
-	wc := app.GCSClient.NewObjectWriter(ctx, app.Bucket, compressedFilePath)
-	if _, err := io.Copy(wc, file); err != nil {
-		slog.Error("Failed to stream compressed data to GCS", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+	kmsKey := r.FormValue("kms_key")
+	if errMsg := validateKMSKey(kmsKey); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
 		return
 	}
-	if err := wc.Close(); err != nil {
-		slog.Error("Failed to close data stream to GCS", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+	checksum, errMsg := parseChecksum(r.FormValue("sha256"))
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
 		return
 	}
-	slog.Debug(fmt.Sprintf("Uploaded %s to GCS", header.Filename), "job", jobID)
-
-	// initialize new publisher everytime to avoid sending messages in batch.
-	// TODO: make this more tolerable to message delivery failures.
-	message := common.DecompressedMsgSchema{
-		UID:                jobID,
-		CompressedFilePath: compressedFilePath,
+	priority := r.FormValue("priority")
+	if !common.ValidPriority(priority) {
+		common.WriteError(w, "Unsupported priority: "+priority, http.StatusBadRequest)
+		return
 	}
-	messageBytes, err := json.Marshal(message)
-	if err != nil {
-		slog.Error("Failed to marshal MQ message", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+	notBefore, errMsg := parseNotBefore(r.FormValue("not_before"))
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	groupID := r.FormValue("group_id")
+	if errMsg := app.checkGroup(r.Context(), groupID, requestOwner(r)); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
 		return
 	}
-	returnedMessageID, err := app.PUBSUBClient.PublishMessage(*app.CTX, app.DecompressTopicID, &pubsub.Message{
-		Data: messageBytes,
+
+	jobID, err := app.submitDecompress(file, decompressParams{
+		FileName:   file.FileName(),
+		Algorithm:  algorithm,
+		Owner:      requestOwner(r),
+		KMSKeyName: kmsKey,
+		SHA256:     checksum,
+		Priority:   priority,
+		NotBefore:  notBefore,
+		GroupID:    groupID,
+		RequestID:  common.RequestID(r.Context()),
 	})
 	if err != nil {
-		slog.Error("Failed to send MQ message", "job", jobID, "error", err)
-		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		writeSubmitError(w, err)
 		return
 	}
-	slog.Debug("Sent message to Pub/Sub ", "job", jobID, "server_generated_message_id", returnedMessageID)
 
 	// Send 202 Accepted Code
+	logJobID(r, jobID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"job_id": jobID})
 }
 
-func main() {
-	// initialize logging system
-	var programLevel = new(slog.LevelVar) // Info by default
-	developmentMode := os.Getenv("DEVELOPMENT_MODE")
-	isDev, err := strconv.ParseBool(developmentMode)
-	if err == nil && isDev {
-		programLevel.Set(slog.LevelDebug)
+// decompressParams describes the decompression job to create for a file.
+type decompressParams struct {
+	FileName   string
+	Algorithm  string
+	Owner      string
+	KMSKeyName string
+	SHA256     string
+	Priority   string
+	NotBefore  time.Time
+	GroupID    string
+	RequestID  string
+}
+
+// submitDecompress stores file as the input of a new decompression job and
+// enqueues it. Failures are logged here, callers only report them.
+func (app *Application) submitDecompress(file io.Reader, params decompressParams) (string, error) {
+	jobID := uuid.New().String()
+	fileName, algorithm := params.FileName, params.Algorithm
+	slog.Debug("Creating new job", "job", jobID, "request_id", params.RequestID, "file", fileName)
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.uploadLimits(common.OperationDecompress).Timeout)
+	defer cancel()
+
+	dir := app.jobDir(params.Owner, jobID)
+	compressedFilePath := compressedObjectPath(dir, fileName)
+	uploadStart := time.Now()
+	written, err := app.uploadVerified(ctx, compressedFilePath, file, params.SHA256, common.WithKMSKey(params.KMSKeyName))
+	if err != nil {
+		slog.Error("Failed to upload compressed file to storage", "job", jobID, "error", err)
+		return "", err
+	}
+	storageUploadDuration.WithLabelValues(common.OperationDecompress).Observe(time.Since(uploadStart).Seconds())
+	uploadBytes.WithLabelValues(common.OperationDecompress).Observe(float64(written))
+	slog.Debug(fmt.Sprintf("Uploaded %s to storage", fileName), "job", jobID)
+	if err := app.enforceQuota(ctx, jobID, params.Owner, compressedFilePath, written); err != nil {
+		return "", err
+	}
+	var codecErr *codecNotAllowedError
+	if err := app.checkDecompressCodec(ctx, params.Owner, algorithm, compressedFilePath); errors.As(err, &codecErr) {
+		slog.Info("Rejected file of a restricted codec", "job", jobID, "owner", params.Owner, "algorithm", codecErr.algorithm)
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, compressedFilePath); err != nil {
+			slog.Warn("Failed to remove rejected upload", "job", jobID, "object", compressedFilePath, "error", err)
+		}
+		return "", err
+	} else if err != nil {
+		slog.Error("Failed to read uploaded file", "job", jobID, "error", err)
+		return "", err
+	}
+
+	job := &common.Job{
+		ID:         jobID,
+		Operation:  common.OperationDecompress,
+		Status:     initialStatus(params.NotBefore),
+		FileName:   fileName,
+		Algorithm:  algorithm,
+		Owner:      params.Owner,
+		InputSize:  written,
+		KMSKeyName: params.KMSKeyName,
+		Priority:   params.Priority,
+		NotBefore:  params.NotBefore,
+		BatchID:    params.GroupID,
+		Dir:        dir,
+		RequestID:  params.RequestID,
+	}
+	if err := app.JobStore.CreateJob(ctx, job); err != nil {
+		slog.Error("Failed to create job record", "job", jobID, "error", err)
+		return "", err
+	}
+	if err := app.addToGroup(ctx, params.Owner, params.GroupID, jobID); err != nil {
+		slog.Error("Failed to add job to group", "job", jobID, "group", params.GroupID, "error", err)
+		return "", err
+	}
+
+	message := common.DecompressedMsgSchema{
+		UID:                jobID,
+		CompressedFilePath: compressedFilePath,
+		Algorithm:          algorithm,
+		KMSKeyName:         params.KMSKeyName,
+	}
+	if err := app.publish(app.topicFor(app.DecompressTopicID, params.Priority), job, message); err != nil {
+		return "", err
+	}
+	app.recordUsage(ctx, params.Owner, written)
+	return jobID, nil
+}
+
+// readinessChecks are the dependencies the manager can't accept jobs without.
+func (app *Application) readinessChecks() map[string]common.Check {
+	return map[string]common.Check{
+		"storage": func(ctx context.Context) error {
+			return app.Storage.CheckBucket(ctx, app.Bucket)
+		},
+		"pubsub": func(ctx context.Context) error {
+			for _, topicID := range []string{app.CompressTopicID, app.DecompressTopicID} {
+				priorities := []string{common.PriorityNormal}
+				if app.PriorityTopics {
+					priorities = common.Priorities
+				}
+				for _, priority := range priorities {
+					if err := app.PUBSUBClient.CheckTopic(ctx, common.PriorityTopic(topicID, priority)); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// NewApplication builds the manager on top of storage and queue, reading its
+// limits from the environment.
+func NewApplication(ctx context.Context, storage common.StorageBackend, queue common.PubSubClientInterface, bucket, compressTopicID, decompressTopicID string) *Application {
+	app := &Application{
+		Storage:            storage,
+		PUBSUBClient:       queue,
+		JobStore:           &common.GCSJobStore{Client: storage, Bucket: bucket},
+		CTX:                &ctx,
+		Bucket:             bucket,
+		CompressTopicID:    compressTopicID,
+		DecompressTopicID:  decompressTopicID,
+		MaxUploadSize:      int64(common.GetEnvInt("MAX_UPLOAD_SIZE", 1<<30)), // 1GB
+		MaxBatchFiles:      common.GetEnvInt("MAX_BATCH_FILES", 100),
+		GCSTimeout:         common.GetEnvDuration("GCS_TIMEOUT", 50*time.Second),
+		SignedURLExpiry:    common.GetEnvDuration("SIGNED_URL_EXPIRY", 15*time.Minute),
+		MaxSignedURLExpiry: common.GetEnvDuration("SIGNED_URL_MAX_EXPIRY", 7*24*time.Hour),
+		DailyQuota: Quota{
+			Jobs:  int64(common.GetEnvInt("QUOTA_DAILY_JOBS", 0)),
+			Bytes: int64(common.GetEnvInt("QUOTA_DAILY_BYTES", 0)),
+		},
+		MonthlyQuota: Quota{
+			Jobs:  int64(common.GetEnvInt("QUOTA_MONTHLY_JOBS", 0)),
+			Bytes: int64(common.GetEnvInt("QUOTA_MONTHLY_BYTES", 0)),
+		},
+		APIKeys:    parseAPIKeys(os.Getenv("API_KEYS")),
+		DebugToken: os.Getenv("DEBUG_TOKEN"),
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+		// three heartbeats at the workers' default interval
+		WorkerStaleAfter: common.GetEnvDuration("WORKER_STALE_AFTER", 90*time.Second),
+		// the topics have to exist before this is enabled
+		PriorityTopics: common.GetEnvBool("PRIORITY_TOPICS", false),
+		SplitThreshold: int64(common.GetEnvInt("SPLIT_THRESHOLD", 0)),
+		SplitPartSize:  int64(common.GetEnvInt("SPLIT_PART_SIZE", 128<<20)),
+		// e.g. 5 MiB, they are kept in memory while compressed
+		InlineThreshold: int64(common.GetEnvInt("INLINE_THRESHOLD", 0)),
+		EventsTopicID:   os.Getenv("PUBSUB_EVENTS_TOPIC_ID"),
+		// progress streams lag behind the workers by this much at most
+		ProgressPollInterval: common.GetEnvDuration("PROGRESS_POLL_INTERVAL", 2*time.Second),
+		// well within HTTP_WRITE_TIMEOUT
+		MaxWaitTimeout: common.GetEnvDuration("MAX_WAIT_TIMEOUT", 5*time.Minute),
+		TenantPrefix:   os.Getenv("TENANT_PREFIX"),
+		// e.g. for sources in a test network
+		IngestPrivateNetworks: common.GetEnvBool("INGEST_PRIVATE_NETWORKS", false),
+		IngestBuckets:         parseOwners(os.Getenv("INGEST_BUCKETS")),
+		CodecOwners:           parseOwners(os.Getenv("CODEC_OWNERS")),
+		Profiles:              defaultProfiles,
+	}
+	app.OperationLimits = map[string]UploadLimits{
+		common.OperationCompress:   uploadLimitsFromEnv(common.OperationCompress),
+		common.OperationDecompress: uploadLimitsFromEnv(common.OperationDecompress),
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		audience := os.Getenv("OIDC_AUDIENCE")
+		if audience == "" {
+			slog.Warn("OIDC_AUDIENCE is not set, no bearer token will be accepted")
+		}
+		app.oidc = common.NewOIDCVerifier(issuer, audience)
+	}
+	return app
+}
+
+// Handler routes the manager's API. Only the API requires an API key, not the
+// metrics and probes, and only the API is turned away while a circuit is
+// open. The debug and admin endpoints have tokens of their own. A handler
+// that panics gets a 500, see withRecovery.
+func (app *Application) Handler() http.Handler {
+	mux := http.NewServeMux()
+	app.registerAPI(newRouter(mux).under(apiVersion))
+	// the paths from before versioning keep working, answered by the
+	// current version
+	app.registerAPI(newRouter(mux).with(deprecated(apiVersion)))
+
+	root := http.NewServeMux()
+	root.Handle("/", chain(mux, app.withAuth, app.withCircuit))
+	root.Handle("GET /metrics", promhttp.Handler())
+	root.HandleFunc("GET /healthz", common.HealthzHandler)
+	root.Handle("GET /readyz", common.ReadyzHandler(5*time.Second, app.readinessChecks()))
+	common.RegisterDebugHandlers(root, app.DebugToken)
+	app.registerAdminHandlers(root)
+	return chain(root, withRequestID, withAccessLog, withRecovery)
+}
+
+// registerAPI registers the routes of the API on api.
+func (app *Application) registerAPI(api *router) {
+	quota := api.with(app.withQuota)
+	quota.handle("POST /compress", app.compressHandler)
+	quota.handle("POST /compress/batch", app.batchCompressHandler)
+	quota.handle("POST /compress/archive", app.archiveCompressHandler)
+	quota.handle("PUT /compress/raw", app.rawCompressHandler)
+	quota.handle("POST /ingest", app.ingestHandler)
+	quota.handle("POST /compress/object", app.inPlaceCompressHandler)
+	quota.handle("POST /compress/append", app.createAppendJobHandler)
+	quota.handle("POST /jobs/{id}/segments", app.appendSegmentHandler)
+	quota.handle("POST /decompress", app.decompressHandler)
+	quota.handle("POST /jobs", app.createDirectJobHandler)
+	quota.handle("POST /uploads", app.createUploadHandler)
+	api.handle("POST /jobs/{id}/submit", app.submitJobHandler)
+	api.handle("POST /jobs/status", app.jobsStatusHandler)
+	api.handle("GET /jobs/{id}", app.jobStatusHandler)
+	api.handle("GET /jobs/{id}/result", app.jobResultHandler)
+	api.handle("GET /jobs/{id}/url", app.jobResultURLHandler)
+	api.handle("GET /jobs/{id}/manifest", app.jobManifestHandler)
+	api.handle("GET /jobs/{id}/huffman", app.jobHuffmanHandler)
+	api.handle("GET /jobs/{id}/progress", app.jobProgressHandler)
+	api.handle("GET /jobs/{id}/wait", app.jobWaitHandler)
+	api.handle("POST /jobs/{id}/cancel", app.cancelJobHandler)
+	api.handle("POST /jobs/{id}/close", app.closeJobHandler)
+	api.handle("GET /uploads/{id}", app.uploadStatusHandler)
+	api.handle("PATCH /uploads/{id}", app.uploadChunkHandler)
+	api.handle("POST /uploads/{id}/complete", app.completeUploadHandler)
+	api.handle("GET /usage", app.usageHandler)
+	api.handle("POST /groups", app.createGroupHandler)
+	api.handle("GET /groups/{id}", app.groupStatusHandler)
+	api.handle("POST /dictionaries", app.createDictionaryHandler)
+	api.handle("GET /dictionaries", app.listDictionariesHandler)
+	api.handle("GET /profiles", app.profilesHandler)
+}
+
+// Serve runs the API, the outbox reconciler and the backlog monitor until ctx
+// is done, then drains the requests in progress. The gRPC API is served on
+// GRPC_ADDR as well, if set.
+func (app *Application) Serve(ctx context.Context, addr string) error {
+	// uploads can be up to MaxUploadSize, so reading a request may take a while
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           app.Handler(),
+		ReadHeaderTimeout: common.GetEnvDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		ReadTimeout:       common.GetEnvDuration("HTTP_READ_TIMEOUT", 15*time.Minute),
+		WriteTimeout:      common.GetEnvDuration("HTTP_WRITE_TIMEOUT", 15*time.Minute),
+		IdleTimeout:       common.GetEnvDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: programLevel}))
-	slog.SetDefault(logger)
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", srv.Addr, err)
+	}
+
+	shutdownTimeout := common.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	// the gRPC API is only served when it has an address of its own
+	if grpcAddr := os.Getenv("GRPC_ADDR"); grpcAddr != "" {
+		grpcLn, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("cannot listen on %s: %w", grpcAddr, err)
+		}
+		stopped := runGRPCServer(ctx, app.GRPCServer(), grpcLn, shutdownTimeout)
+		defer func() { <-stopped }()
+		slog.Info("Serving gRPC on " + grpcAddr + "...")
+	}
+
+	go app.runOutboxReconciler(ctx,
+		common.GetEnvDuration("OUTBOX_INTERVAL", 30*time.Second),
+		common.GetEnvDuration("OUTBOX_GRACE_PERIOD", time.Minute))
+	go app.runBacklogMonitor(ctx, common.GetEnvDuration("BACKLOG_INTERVAL", 30*time.Second))
+	slog.Info("Listening on " + addr + "...")
+	return runServer(ctx, srv, ln, shutdownTimeout)
+}
 
-	// initialize GCP services
-	projectID := os.Getenv("GCP_PROJECT_ID")
+// Main runs the manager against GCP.
+func Main() {
+	common.SetupLogging()
+	if err := compression.RegisterFromEnv(context.Background()); err != nil {
+		slog.Error("Cannot register codecs", "error", err)
+		return
+	}
+
+	// initialize cloud services
 	compressTopicID := os.Getenv("PUBSUB_COMPRESS_TOPIC_ID")
 	decompressTopicID := os.Getenv("PUBSUB_DECOMPRESS_TOPIC_ID")
 	bucket := os.Getenv("GCS_BUCKET")
 	ctx := context.Background()
 
-	GCSClient, err := storage.NewClient(ctx)
+	storageBackend, closeStorage, err := common.NewStorageBackend(ctx)
 	if err != nil {
-		slog.Error("Cannot create new client for GCS", "error", err)
+		slog.Error("Cannot connect to object storage", "error", err)
 		return
 	}
-	defer GCSClient.Close()
-	slog.Debug("Initialized a GCS client.")
+	defer closeStorage()
+	slog.Debug("Initialized an object storage client.")
 
-	PUBSUBClient, err := pubsub.NewClient(ctx, projectID)
+	queue, closeQueue, err := common.NewQueue(ctx)
 	if err != nil {
-		slog.Error("Cannot create new client for Pub/Sub", "error", err)
+		slog.Error("Cannot connect to the message queue", "error", err)
 		return
 	}
-	defer PUBSUBClient.Close()
-	slog.Debug("Initialized a Pub/Sub client.")
+	defer closeQueue()
+	slog.Debug("Initialized a message queue client.")
 
-	realGCS := &common.RealGCSClient{Client: GCSClient}
-	realPubSub := &common.RealPubSubClient{Client: PUBSUBClient}
-
-	app := Application{
-		GCSClient:         realGCS,
-		PUBSUBClient:      realPubSub,
-		CTX:               &ctx,
-		Bucket:            bucket,
-		CompressTopicID:   compressTopicID,
-		DecompressTopicID: decompressTopicID,
-		MaxUploadSize:     1 << 30, // 1GB
-		GCSTimeout:        50 * time.Second,
+	app := NewApplication(ctx, storageBackend, queue, bucket, compressTopicID, decompressTopicID)
+	if app.Profiles, err = parseProfiles(os.Getenv("COMPRESSION_PROFILES")); err != nil {
+		slog.Error("Cannot configure profiles", "error", err)
+		return
+	}
+	if app.ProfileRules, err = parseProfileRules(os.Getenv("PROFILE_RULES"), app.Profiles); err != nil {
+		slog.Error("Cannot configure profiles", "error", err)
+		return
+	}
+	if common.GetEnvBool("BOOTSTRAP", false) {
+		if err := common.Bootstrap(ctx, app.resources()); err != nil {
+			slog.Error("Cannot bootstrap cloud resources", "error", err)
+			return
+		}
 	}
 
-	http.HandleFunc("/compress", app.compressHandler)
-	http.HandleFunc("/decompress", app.decompressHandler)
-	slog.Info("Listening on localhost:8081...")
-	http.ListenAndServe(":8081", nil)
+	signalCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// the storage and queue clients are closed by the deferred calls above,
+	// after every request has been drained.
+	if err := app.Serve(signalCtx, ":8081"); err != nil {
+		slog.Error("Server stopped with an error", "error", err)
+		return
+	}
+	slog.Info("Server stopped")
 }
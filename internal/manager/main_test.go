@@ -1,15 +1,17 @@
-package main
+package manager
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
-	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -23,10 +25,15 @@ import (
 
 // --- Mocks ---
 
-// mockGCSClient satisfies the GCSClientInterface
+// mockGCSClient satisfies the StorageBackend
 type mockGCSClient struct {
 	mu    sync.Mutex
 	files map[string]*bytes.Buffer // Stores uploaded files in memory
+	attrs map[string]common.ObjectWriterOptions
+	// versions counts how often each object was written
+	versions map[string]int64
+	// unreachable fails the readiness check
+	unreachable bool
 }
 
 // mockGCSWriter satisfies io.WriteCloser
@@ -34,6 +41,7 @@ type mockGCSWriter struct {
 	objectPath string
 	buffer     *bytes.Buffer
 	client     *mockGCSClient
+	opts       common.ObjectWriterOptions
 }
 
 // Write adds data to the in-memory buffer
@@ -41,28 +49,120 @@ func (w *mockGCSWriter) Write(p []byte) (n int, err error) {
 	return w.buffer.Write(p)
 }
 
-// Close "commits" the buffer to the mock client's file map
+// Close "commits" the buffer to the mock client's file map, checking the
+// preconditions like GCS does
 func (w *mockGCSWriter) Close() error {
 	w.client.mu.Lock()
 	defer w.client.mu.Unlock()
+	if _, ok := w.client.files[w.objectPath]; ok && w.opts.IfNotExists {
+		return common.ErrObjectExists
+	}
+	if w.opts.IfVersionMatch != "" && w.opts.IfVersionMatch != strconv.FormatInt(w.client.versions[w.objectPath], 10) {
+		return common.ErrVersionMismatch
+	}
+	if w.client.attrs == nil {
+		w.client.attrs = make(map[string]common.ObjectWriterOptions)
+		w.client.versions = make(map[string]int64)
+	}
 	w.client.files[w.objectPath] = w.buffer
+	w.client.attrs[w.objectPath] = w.opts
+	w.client.versions[w.objectPath]++
 	return nil
 }
 
 // NewObjectWriter creates an in-memory writer
-func (c *mockGCSClient) NewObjectWriter(ctx context.Context, bucket, object string) common.GCSObjectWriterInterface {
+func (c *mockGCSClient) NewObjectWriter(ctx context.Context, bucket, object string, opts ...common.ObjectWriterOption) common.ObjectWriterInterface {
 	// Note: We don't need to check the bucket for this mock
 	return &mockGCSWriter{
 		objectPath: object,
 		buffer:     new(bytes.Buffer),
 		client:     c,
+		opts:       common.NewObjectWriterOptions(opts...),
 	}
 }
 
-// NewObjectWriter creates an in-memory writer
-func (c *mockGCSClient) NewObjectReader(ctx context.Context, bucket, object string) (common.GCSObjectReaderInterface, error) {
+func (c *mockGCSClient) StatObject(ctx context.Context, bucket, object string) (common.ObjectInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[object]
+	if !ok {
+		return common.ObjectInfo{}, common.ErrObjectNotExist
+	}
+	return common.ObjectInfo{
+		Name:     object,
+		Size:     int64(data.Len()),
+		Version:  strconv.FormatInt(c.versions[object], 10),
+		Metadata: c.attrs[object].Metadata,
+	}, nil
+}
+
+// NewObjectReader serves previously written objects from memory
+func (c *mockGCSClient) NewObjectReader(ctx context.Context, bucket, object string) (common.ObjectReaderInterface, error) {
 	// Note: We don't need to check the bucket for this mock
-	return nil, nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[object]
+	if !ok {
+		return nil, common.ErrObjectNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data.Bytes())), nil
+}
+
+// NewRangeReader serves a range of a previously written object
+func (c *mockGCSClient) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (common.ObjectReaderInterface, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[object]
+	if !ok {
+		return nil, common.ErrObjectNotExist
+	}
+	if length < 0 {
+		length = int64(data.Len())
+	}
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(data.Bytes()), offset, length)), nil
+}
+
+// SignURL returns a fake URL that encodes the requested object
+func (c *mockGCSClient) SignURL(bucket, object string, opts common.SignedURLOptions) (string, error) {
+	return fmt.Sprintf("https://signed.example/%s/%s?method=GET&expires=%d", bucket, object, opts.Expires.Unix()), nil
+}
+
+// SignUploadURL returns a fake resumable upload like GCS does
+func (c *mockGCSClient) SignUploadURL(bucket, object string, expires time.Time, opts ...common.ObjectWriterOption) (common.SignedUpload, error) {
+	return common.SignedUpload{
+		URL:     fmt.Sprintf("https://signed.example/%s/%s?method=POST&expires=%d", bucket, object, expires.Unix()),
+		Method:  "POST",
+		Headers: map[string]string{"x-goog-resumable": "start"},
+	}, nil
+}
+
+// CheckBucket fails when unreachable is set
+func (c *mockGCSClient) CheckBucket(ctx context.Context, bucket string) error {
+	if c.unreachable {
+		return errors.New("mock gcs unreachable")
+	}
+	return nil
+}
+
+// ListObjects lists the in-memory objects under prefix in name order
+func (c *mockGCSClient) ListObjects(ctx context.Context, bucket, prefix string) ([]common.ObjectInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var objects []common.ObjectInfo
+	for name := range c.files {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, common.ObjectInfo{Name: name})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (c *mockGCSClient) DeleteObject(ctx context.Context, bucket, object string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.files, object)
+	return nil
 }
 
 // Helper to get file content from the mock
@@ -80,12 +180,19 @@ func (c *mockGCSClient) GetObjectContent(object string) (string, bool) {
 type mockPubSubClient struct {
 	mu       sync.Mutex
 	messages map[string][]*pubsub.Message // Stores published messages in memory
+	// unreachable fails the readiness checks
+	unreachable bool
+	// failPublish makes PublishMessage return an error
+	failPublish bool
 }
 
 // PublishMessage adds the message to the in-memory map and returns a mock ID
 func (c *mockPubSubClient) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if c.failPublish {
+		return "", errors.New("mock pubsub publish error")
+	}
 	if c.messages == nil {
 		c.messages = make(map[string][]*pubsub.Message)
 	}
@@ -93,6 +200,19 @@ func (c *mockPubSubClient) PublishMessage(ctx context.Context, topicID string, m
 	return "mock-message-id-" + uuid.NewString(), nil
 }
 
+// CheckTopic fails when unreachable is set
+func (c *mockPubSubClient) CheckTopic(ctx context.Context, topicID string) error {
+	if c.unreachable {
+		return errors.New("mock pubsub unreachable")
+	}
+	return nil
+}
+
+// CheckSubscription fails when unreachable is set
+func (c *mockPubSubClient) CheckSubscription(ctx context.Context, subID string) error {
+	return c.CheckTopic(ctx, subID)
+}
+
 // Helper to get messages from the mock
 func (c *mockPubSubClient) GetMessages(topicID string) []*pubsub.Message {
 	c.mu.Lock()
@@ -124,8 +244,9 @@ func setupTestApp(t *testing.T) (*Application, *mockGCSClient, *mockPubSubClient
 	}
 
 	app := &Application{
-		GCSClient:         mockGCS,
+		Storage:           mockGCS,
 		PUBSUBClient:      mockPubSub,
+		JobStore:          &common.GCSJobStore{Client: mockGCS, Bucket: testBucket},
 		CTX:               &ctx,
 		Bucket:            testBucket,
 		CompressTopicID:   testCompressTopic,
@@ -140,9 +261,20 @@ func setupTestApp(t *testing.T) (*Application, *mockGCSClient, *mockPubSubClient
 // createTestMultipartRequest is a helper to build a file upload request.
 func createTestMultipartRequest(t *testing.T, fieldName, fileName, fileContent string) *http.Request {
 	t.Helper()
+	return createTestMultipartRequestWithFields(t, fieldName, fileName, fileContent, nil)
+}
+
+// createTestMultipartRequestWithFields also sets plain form fields before the file part.
+func createTestMultipartRequestWithFields(t *testing.T, fieldName, fileName, fileContent string, fields map[string]string) *http.Request {
+	t.Helper()
 
 	body := new(bytes.Buffer)
 	writer := multipart.NewWriter(body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			t.Fatalf("Failed to write form field: %v", err)
+		}
+	}
 	part, err := writer.CreateFormFile(fieldName, fileName)
 	if err != nil {
 		t.Fatalf("Failed to create form file: %v", err)
@@ -181,19 +313,17 @@ func TestCompressHandler(t *testing.T) {
 	app, mockGCS, mockPubSub := setupTestApp(t)
 
 	testCases := []struct {
-		name             string
-		fileContent      string
-		fileName         string
-		expectedStatus   int
-		expectedFreqJSON string
-		expectedErr      string
+		name           string
+		fileContent    string
+		fileName       string
+		expectedStatus int
+		expectedErr    string
 	}{
 		{
-			name:             "success",
-			fileContent:      "hello world 👋",
-			fileName:         "test.txt",
-			expectedStatus:   http.StatusAccepted,
-			expectedFreqJSON: `{"32":2,"100":1,"101":1,"104":1,"108":3,"111":2,"114":1,"119":1,"128075":1}`,
+			name:           "success",
+			fileContent:    "hello world 👋",
+			fileName:       "test.txt",
+			expectedStatus: http.StatusAccepted,
 		},
 		{
 			name:           "file size limit",
@@ -254,23 +384,9 @@ func TestCompressHandler(t *testing.T) {
 				t.Errorf("GCS file content mismatch: got %q want %q", content, tc.fileContent)
 			}
 
-			// Check: character frequency table & table streaming
-			freqTablePath := fmt.Sprintf("%s/frequency_table.json", jobID)
-			freqContent, ok := mockGCS.GetObjectContent(freqTablePath)
-			if !ok {
-				t.Errorf("GCS file %q was not created", freqTablePath)
-			}
-
-			// Unmarshal both to maps for a robust comparison
-			var gotMap, wantMap map[string]uint64
-			if err := json.Unmarshal([]byte(freqContent), &gotMap); err != nil {
-				t.Fatalf("Failed to unmarshal actual freq table: %v", err)
-			}
-			if err := json.Unmarshal([]byte(tc.expectedFreqJSON), &wantMap); err != nil {
-				t.Fatalf("Failed to unmarshal expected freq table: %v", err)
-			}
-			if !reflect.DeepEqual(gotMap, wantMap) {
-				t.Errorf("GCS freq table mismatch:\ngot  %v\nwant %v", gotMap, wantMap)
+			// Check: the worker builds the frequency table, so only the original is stored
+			if _, ok := mockGCS.GetObjectContent(jobID + "/frequency_table.json"); ok {
+				t.Error("Expected no frequency table to be stored")
 			}
 
 			// Check: messages pubs
@@ -279,7 +395,7 @@ func TestCompressHandler(t *testing.T) {
 				t.Fatalf("Expected 1 Pub/Sub message, got %d", len(messages))
 			}
 			var pubsubMsg common.CompressedMsgSchema
-			if err := json.Unmarshal(messages[0].Data, &pubsubMsg); err != nil {
+			if err := common.UnmarshalMessage(messages[0].Data, &pubsubMsg); err != nil {
 				t.Fatalf("Failed to unmarshal Pub/Sub message: %v", err)
 			}
 
@@ -289,8 +405,14 @@ func TestCompressHandler(t *testing.T) {
 			if pubsubMsg.OriginalFilePath != originalFilePath {
 				t.Errorf("Pub/Sub OriginalFilePath mismatch: got %q want %q", pubsubMsg.OriginalFilePath, originalFilePath)
 			}
-			if pubsubMsg.FreqTablePath != freqTablePath {
-				t.Errorf("Pub/Sub FreqTablePath mismatch: got %q want %q", pubsubMsg.FreqTablePath, freqTablePath)
+
+			// Check: job record
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Expected job record to exist: %v", err)
+			}
+			if job.Status != common.JobPending || job.Operation != common.OperationCompress {
+				t.Errorf("Unexpected job record: %+v", job)
 			}
 		})
 
@@ -300,8 +422,7 @@ func TestCompressHandler(t *testing.T) {
 	t.Run("wrong http method", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/compress", nil)
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(app.compressHandler)
-		handler.ServeHTTP(rr, req)
+		app.Handler().ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusMethodNotAllowed {
 			t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
@@ -309,7 +430,156 @@ func TestCompressHandler(t *testing.T) {
 	})
 }
 
+func TestCompressHandlerAlgorithm(t *testing.T) {
+	app, _, mockPubSub := setupTestApp(t)
+
+	testCases := []struct {
+		name              string
+		algorithm         string
+		format            string
+		level             string
+		expectedStatus    int
+		expectedAlgorithm string
+		expectedLevel     int
+	}{
+		{name: "default", algorithm: "", expectedStatus: http.StatusAccepted, expectedAlgorithm: common.AlgorithmHuffman},
+		{name: "zstd", algorithm: "zstd", expectedStatus: http.StatusAccepted, expectedAlgorithm: common.AlgorithmZstd},
+		{name: "unsupported", algorithm: "lzma", expectedStatus: http.StatusBadRequest},
+		{name: "gz format", format: "gz", expectedStatus: http.StatusAccepted, expectedAlgorithm: common.AlgorithmGzip},
+		{name: "gz format with other algorithm", algorithm: "zstd", format: "gz", expectedStatus: http.StatusBadRequest},
+		{name: "unsupported format", format: "rar", expectedStatus: http.StatusBadRequest},
+		{name: "zstd level", algorithm: "zstd", level: "19", expectedStatus: http.StatusAccepted, expectedAlgorithm: common.AlgorithmZstd, expectedLevel: 19},
+		{name: "level out of range", algorithm: "gzip", level: "12", expectedStatus: http.StatusBadRequest},
+		{name: "huffman has no levels", level: "3", expectedStatus: http.StatusBadRequest},
+		{name: "invalid level", algorithm: "zstd", level: "max", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockPubSub.messages = make(map[string][]*pubsub.Message)
+
+			fields := map[string]string{}
+			if tc.algorithm != "" {
+				fields["algorithm"] = tc.algorithm
+			}
+			if tc.format != "" {
+				fields["format"] = tc.format
+			}
+			if tc.level != "" {
+				fields["level"] = tc.level
+			}
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello", fields)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusAccepted {
+				return
+			}
+
+			messages := mockPubSub.GetMessages(app.CompressTopicID)
+			if len(messages) != 1 {
+				t.Fatalf("Expected 1 Pub/Sub message, got %d", len(messages))
+			}
+			var pubsubMsg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(messages[0].Data, &pubsubMsg); err != nil {
+				t.Fatalf("Failed to unmarshal Pub/Sub message: %v", err)
+			}
+			if pubsubMsg.Algorithm != tc.expectedAlgorithm {
+				t.Errorf("Pub/Sub Algorithm mismatch: got %q want %q", pubsubMsg.Algorithm, tc.expectedAlgorithm)
+			}
+			if pubsubMsg.Level != tc.expectedLevel {
+				t.Errorf("Pub/Sub Level mismatch: got %d want %d", pubsubMsg.Level, tc.expectedLevel)
+			}
+		})
+	}
+}
+
+func TestCompressHandlerKMSKey(t *testing.T) {
+	const kmsKey = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	testCases := []struct {
+		name           string
+		kmsKey         string
+		expectedStatus int
+	}{
+		{name: "bucket default", expectedStatus: http.StatusAccepted},
+		{name: "kms key", kmsKey: kmsKey, expectedStatus: http.StatusAccepted},
+		{name: "aws kms key", kmsKey: "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab", expectedStatus: http.StatusAccepted},
+		{name: "malformed kms key", kmsKey: "my-key", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello", map[string]string{"kms_key": tc.kmsKey})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusAccepted {
+				return
+			}
+
+			var pubsubMsg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(mockPubSub.GetMessages(app.CompressTopicID)[0].Data, &pubsubMsg); err != nil {
+				t.Fatalf("Failed to unmarshal Pub/Sub message: %v", err)
+			}
+			if pubsubMsg.KMSKeyName != tc.kmsKey {
+				t.Errorf("Pub/Sub KMSKeyName mismatch: got %q want %q", pubsubMsg.KMSKeyName, tc.kmsKey)
+			}
+			if key := mockGCS.attrs[pubsubMsg.OriginalFilePath].KMSKeyName; key != tc.kmsKey {
+				t.Errorf("Expected %s to be encrypted with %q, got %q", pubsubMsg.OriginalFilePath, tc.kmsKey, key)
+			}
+			job, err := app.JobStore.GetJob(context.Background(), pubsubMsg.UID)
+			if err != nil || job.KMSKeyName != tc.kmsKey {
+				t.Errorf("Unexpected job record: %+v, %v", job, err)
+			}
+		})
+	}
+}
+
 // TestDecompressHandler covers all requested test points for /decompress
+func TestCompressHandlerStreamsForm(t *testing.T) {
+	testCases := []struct {
+		name           string
+		fields         map[string]string
+		expectedStatus int
+	}{
+		{name: "fields before the file", fields: map[string]string{"algorithm": "zstd", "level": "3"}, expectedStatus: http.StatusAccepted},
+		{name: "field too long", fields: map[string]string{"kms_key": strings.Repeat("k", maxFormFieldSize+1)}, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, mockPubSub := setupTestApp(t)
+			app.MaxUploadSize = 1 << 20
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello world", tc.fields)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			// nothing was parsed into memory or temporary files
+			if req.MultipartForm != nil && len(req.MultipartForm.File) > 0 {
+				t.Error("Expected the form to be streamed, not parsed")
+			}
+			if tc.expectedStatus != http.StatusAccepted {
+				return
+			}
+			var msg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(mockPubSub.GetMessages(app.CompressTopicID)[0].Data, &msg); err != nil {
+				t.Fatalf("Failed to decode message: %v", err)
+			}
+			if msg.Algorithm != "zstd" || msg.Level != 3 {
+				t.Errorf("Expected the fields to apply, got algorithm %q level %d", msg.Algorithm, msg.Level)
+			}
+		})
+	}
+}
+
 func TestDecompressHandler(t *testing.T) {
 	app, mockGCS, mockPubSub := setupTestApp(t)
 
@@ -326,6 +596,13 @@ func TestDecompressHandler(t *testing.T) {
 			fileName:       "archive.ranran",
 			expectedStatus: http.StatusAccepted,
 		},
+		{
+			name:           "bare zstd file",
+			fileContent:    "compressed_data_bytes",
+			fileName:       "archive.zst",
+			expectedStatus: http.StatusBadRequest,
+			expectedErr:    "Wrong file format",
+		},
 		{
 			name:           "file extension (wrong extension)",
 			fileContent:    "some_data",
@@ -384,7 +661,7 @@ func TestDecompressHandler(t *testing.T) {
 				t.Fatalf("Expected 1 Pub/Sub message, got %d", len(messages))
 			}
 			var pubsubMsg common.DecompressedMsgSchema
-			if err := json.Unmarshal(messages[0].Data, &pubsubMsg); err != nil {
+			if err := common.UnmarshalMessage(messages[0].Data, &pubsubMsg); err != nil {
 				t.Fatalf("Failed to unmarshal Pub/Sub message: %v", err)
 			}
 
@@ -397,3 +674,49 @@ func TestDecompressHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressHandlerPriority(t *testing.T) {
+	testCases := []struct {
+		name           string
+		priority       string
+		enabled        bool
+		expectedTopic  string
+		expectedStatus int
+	}{
+		{name: "default", enabled: true, expectedTopic: "compress-topic", expectedStatus: http.StatusAccepted},
+		{name: "high", priority: "high", enabled: true, expectedTopic: "compress-topic-high", expectedStatus: http.StatusAccepted},
+		{name: "low", priority: "low", enabled: true, expectedTopic: "compress-topic-low", expectedStatus: http.StatusAccepted},
+		{name: "topics disabled", priority: "high", expectedTopic: "compress-topic", expectedStatus: http.StatusAccepted},
+		{name: "unknown", priority: "urgent", enabled: true, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, mockPubSub := setupTestApp(t)
+			app.CompressTopicID = "compress-topic"
+			app.PriorityTopics = tc.enabled
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello", map[string]string{"priority": tc.priority})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusAccepted {
+				return
+			}
+
+			messages := mockPubSub.GetMessages(tc.expectedTopic)
+			if len(messages) != 1 {
+				t.Fatalf("Expected 1 message on %s, got %d", tc.expectedTopic, len(messages))
+			}
+			var pubsubMsg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(messages[0].Data, &pubsubMsg); err != nil {
+				t.Fatalf("Failed to unmarshal Pub/Sub message: %v", err)
+			}
+			job, err := app.JobStore.GetJob(context.Background(), pubsubMsg.UID)
+			if err != nil || job.Priority != tc.priority {
+				t.Errorf("Unexpected job record: %+v, %v", job, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manager_http_requests_total",
+		Help: "HTTP requests handled, by endpoint, method and status code.",
+	}, []string{"endpoint", "method", "code"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "manager_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, uploads included.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"endpoint", "method", "code"})
+
+	uploadBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "manager_upload_bytes",
+		Help:    "Size of the files uploaded for a job.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 11), // 1KB to 1GB
+	}, []string{"operation"})
+
+	storageUploadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "manager_storage_upload_duration_seconds",
+		Help:    "Time taken to stream an upload to storage.",
+		Buckets: []float64{.05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"operation"})
+
+	publishFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manager_pubsub_publish_failures_total",
+		Help: "Job messages that could not be published.",
+	}, []string{"topic"})
+
+	inlineJobDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "manager_inline_job_duration_seconds",
+		Help:    "Time taken to compress small files in the manager, storing the result included.",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+
+	panicsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "manager_http_panics_total",
+		Help: "Panics recovered from in HTTP handlers, each answered with a 500.",
+	})
+
+	outboxRedelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manager_outbox_redelivered_total",
+		Help: "Job messages published by the outbox reconciler after the first attempt failed.",
+	}, []string{"topic"})
+)
+
+// instrument records the request count and latency of h under endpoint.
+func instrument(endpoint string, h http.HandlerFunc) http.Handler {
+	labels := prometheus.Labels{"endpoint": endpoint}
+	return promhttp.InstrumentHandlerDuration(requestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(requestsTotal.MustCurryWith(labels), h))
+}
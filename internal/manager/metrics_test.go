@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	handler := instrument("/compress", app.compressHandler)
+
+	accepted := requestsTotal.WithLabelValues("/compress", "post", "202")
+	badRequest := requestsTotal.WithLabelValues("/compress", "post", "400")
+	acceptedBefore, badRequestBefore := testutil.ToFloat64(accepted), testutil.ToFloat64(badRequest)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createTestMultipartRequest(t, "file", "test.txt", "hello metrics"))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, createTestMultipartRequest(t, "not-file", "test.txt", "hello metrics"))
+
+	if got := testutil.ToFloat64(accepted) - acceptedBefore; got != 1 {
+		t.Errorf("Expected 1 accepted request to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(badRequest) - badRequestBefore; got != 1 {
+		t.Errorf("Expected 1 bad request to be counted, got %v", got)
+	}
+
+	// the registry is exposed in the text format
+	rr = httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{
+		"manager_http_requests_total",
+		`manager_upload_bytes_count{operation="compress"}`,
+		`manager_storage_upload_duration_seconds_count{operation="compress"}`,
+	} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("Expected /metrics to expose %s", name)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// testProvider serves the discovery document and keys of an OIDC provider
+// and signs tokens with its key.
+type testProvider struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	p := &testProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": p.server.URL, "jwks_uri": p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.ES256), Use: "sig"}}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) token(t *testing.T, key *ecdsa.PrivateKey, claims jwt.Claims) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: key, KeyID: "test"}}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	token, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestOIDCAuth(t *testing.T) {
+	provider := newTestProvider(t)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := time.Now()
+	valid := jwt.Claims{
+		Issuer:   provider.server.URL,
+		Subject:  "user-1",
+		Audience: jwt.Audience{"cdc"},
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+	withClaims := func(update func(c *jwt.Claims)) jwt.Claims {
+		c := valid
+		update(&c)
+		return c
+	}
+
+	testCases := []struct {
+		name     string
+		token    string
+		key      string
+		wantCode int
+	}{
+		{name: "valid token", token: provider.token(t, provider.key, valid), wantCode: http.StatusAccepted},
+		{name: "API key", key: "secret", wantCode: http.StatusAccepted},
+		{name: "nothing", wantCode: http.StatusUnauthorized},
+		{name: "other audience", token: provider.token(t, provider.key, withClaims(func(c *jwt.Claims) { c.Audience = jwt.Audience{"other"} })), wantCode: http.StatusUnauthorized},
+		{name: "other issuer", token: provider.token(t, provider.key, withClaims(func(c *jwt.Claims) { c.Issuer = "https://evil.example.com" })), wantCode: http.StatusUnauthorized},
+		{name: "expired", token: provider.token(t, provider.key, withClaims(func(c *jwt.Claims) { c.Expiry = jwt.NewNumericDate(now.Add(-time.Hour)) })), wantCode: http.StatusUnauthorized},
+		{name: "no expiry", token: provider.token(t, provider.key, withClaims(func(c *jwt.Claims) { c.Expiry = nil })), wantCode: http.StatusUnauthorized},
+		{name: "other signer", token: provider.token(t, otherKey, valid), wantCode: http.StatusUnauthorized},
+		{name: "not a token", token: "secret", wantCode: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.APIKeys = parseAPIKeys("secret")
+			app.oidc = common.NewOIDCVerifier(provider.server.URL, "cdc")
+
+			req := createTestMultipartRequest(t, "file", "notes.txt", "authenticated")
+			req.URL.Path = "/compress"
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			if tc.key != "" {
+				req.Header.Set(apiKeyHeader, tc.key)
+			}
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if rr.Code != http.StatusAccepted {
+				return
+			}
+
+			wantOwner := keyOwner(tc.key)
+			if tc.token != "" {
+				wantOwner = subjectOwner("user-1")
+			}
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil || job.Owner != wantOwner {
+				t.Errorf("Expected the job to be accounted to %s, got %+v, %v", wantOwner, job, err)
+			}
+		})
+	}
+
+	t.Run("provider down", func(t *testing.T) {
+		app, _, _ := setupTestApp(t)
+		app.oidc = common.NewOIDCVerifier("http://127.0.0.1:1", "cdc")
+		req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+		req.Header.Set("Authorization", "Bearer "+provider.token(t, provider.key, valid))
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", rr.Code)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// outboxEntry is a job message waiting to be published. It is persisted
+// before the first attempt and deleted once Pub/Sub has accepted it, so a
+// message the manager failed to publish is never lost with the job. The
+// messages of scheduled jobs wait here until their NotBefore. Split jobs have
+// an entry per part.
+type outboxEntry struct {
+	JobID   string `json:"job_id"`
+	Part    int    `json:"part,omitempty"`
+	TopicID string `json:"topic_id"`
+	Data    []byte `json:"data"`
+	// RequestID is passed on as an attribute of the message.
+	RequestID string    `json:"request_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	NotBefore time.Time `json:"not_before,omitzero"`
+}
+
+// due reports whether the entry may be published at now.
+func (e *outboxEntry) due(now time.Time) bool {
+	return !e.NotBefore.After(now)
+}
+
+// errJobNotScheduled drops the message of a scheduled job that was canceled
+// or expired before it was due.
+var errJobNotScheduled = errors.New("job is no longer scheduled")
+
+func outboxEntryPath(jobID string, part int) string {
+	if part > 0 {
+		return fmt.Sprintf("outbox/%s.part%d.json", jobID, part)
+	}
+	return fmt.Sprintf("outbox/%s.json", jobID)
+}
+
+func (app *Application) saveOutboxEntry(ctx context.Context, entry *outboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox entry: %w", err)
+	}
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, outboxEntryPath(entry.JobID, entry.Part))
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write outbox entry: %w", err)
+	}
+	return wc.Close()
+}
+
+// deliver publishes the entry and removes it from the outbox. If the removal
+// fails the message is published again later, which workers already expect.
+func (app *Application) deliver(ctx context.Context, entry *outboxEntry) error {
+	if !entry.NotBefore.IsZero() {
+		// the job is PENDING already if publishing failed on an earlier try
+		_, err := app.JobStore.UpdateJob(ctx, entry.JobID, func(j *common.Job) error {
+			if j.Status.Finished() {
+				return errJobNotScheduled
+			}
+			if j.Status == common.JobScheduled {
+				j.Status = common.JobPending
+			}
+			return nil
+		})
+		if errors.Is(err, errJobNotScheduled) || errors.Is(err, common.ErrJobNotFound) {
+			slog.Info("Dropped the message of a scheduled job that finished", "job", entry.JobID)
+			return app.Storage.DeleteObject(ctx, app.Bucket, outboxEntryPath(entry.JobID, entry.Part))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to release scheduled job: %w", err)
+		}
+	}
+
+	msg := &pubsub.Message{Data: entry.Data}
+	if entry.RequestID != "" {
+		msg.Attributes = map[string]string{common.RequestIDAttribute: entry.RequestID}
+	}
+	returnedMessageID, err := app.PUBSUBClient.PublishMessage(ctx, entry.TopicID, msg)
+	if err != nil {
+		publishFailures.WithLabelValues(entry.TopicID).Inc()
+		return err
+	}
+	slog.Debug("Sent message to Pub/Sub ", "job", entry.JobID, "server_generated_message_id", returnedMessageID)
+	reason := ""
+	if entry.Part > 0 {
+		reason = fmt.Sprintf("part %d", entry.Part)
+	}
+	app.recordEvent(ctx, entry.JobID, common.EventPublished, reason)
+
+	if err := app.Storage.DeleteObject(ctx, app.Bucket, outboxEntryPath(entry.JobID, entry.Part)); err != nil {
+		slog.Warn("Failed to remove published message from the outbox", "job", entry.JobID, "error", err)
+	}
+	return nil
+}
+
+// reconcileOutbox publishes the entries last written before cutoff, leaving
+// younger ones to the request that is still publishing them, and those of
+// scheduled jobs that are due. It returns how many were delivered.
+func (app *Application) reconcileOutbox(ctx context.Context, cutoff time.Time) (int, error) {
+	objects, err := app.Storage.ListObjects(ctx, app.Bucket, "outbox/")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list outbox: %w", err)
+	}
+
+	now := time.Now()
+	delivered := 0
+	for _, object := range objects {
+		rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, object.Name)
+		if err != nil {
+			slog.Error("Failed to read outbox entry", "object", object.Name, "error", err)
+			continue
+		}
+		var entry outboxEntry
+		err = json.NewDecoder(rc).Decode(&entry)
+		rc.Close()
+		if err != nil {
+			slog.Error("Failed to decode outbox entry", "object", object.Name, "error", err)
+			continue
+		}
+		scheduled := !entry.NotBefore.IsZero()
+		if !entry.due(now) || (!scheduled && object.Updated.After(cutoff)) {
+			continue
+		}
+
+		if err := app.deliver(ctx, &entry); err != nil {
+			slog.Error("Failed to redeliver MQ message", "job", entry.JobID, "error", err)
+			continue
+		}
+		if scheduled {
+			slog.Info("Enqueued scheduled job", "job", entry.JobID, "not_before", entry.NotBefore)
+		} else {
+			outboxRedelivered.WithLabelValues(entry.TopicID).Inc()
+			slog.Info("Redelivered MQ message from the outbox", "job", entry.JobID)
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// runOutboxReconciler retries the outbox every interval until ctx is
+// cancelled. Entries have to be older than grace to be picked up.
+func (app *Application) runOutboxReconciler(ctx context.Context, interval, grace time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := app.reconcileOutbox(ctx, time.Now().Add(-grace)); err != nil {
+			slog.Error("Outbox reconciliation failed", "error", err)
+		}
+	}
+}
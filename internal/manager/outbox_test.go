@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestOutbox(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+
+	// Pub/Sub is down, the job is still accepted
+	mockPubSub.failPublish = true
+	req := createTestMultipartRequest(t, "file", "test.txt", "hello outbox")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	jobID := getJobIDFromResponse(t, rr.Body)
+	if _, ok := mockGCS.GetObjectContent(outboxEntryPath(jobID, 0)); !ok {
+		t.Fatal("Expected the message to be kept in the outbox")
+	}
+
+	// still down, the entry stays for the next round
+	if n, err := app.reconcileOutbox(context.Background(), time.Now()); err != nil || n != 0 {
+		t.Errorf("Expected nothing to be delivered, got %d, %v", n, err)
+	}
+	if _, ok := mockGCS.GetObjectContent(outboxEntryPath(jobID, 0)); !ok {
+		t.Fatal("Expected the message to stay in the outbox")
+	}
+
+	mockPubSub.failPublish = false
+	if n, err := app.reconcileOutbox(context.Background(), time.Now()); err != nil || n != 1 {
+		t.Errorf("Expected 1 message to be delivered, got %d, %v", n, err)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 1 {
+		t.Errorf("Expected 1 message to be published, got %d", len(messages))
+	}
+	if _, ok := mockGCS.GetObjectContent(outboxEntryPath(jobID, 0)); ok {
+		t.Error("Expected the delivered message to leave the outbox")
+	}
+}
+
+func TestOutbox_DeliveredImmediately(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+
+	req := createTestMultipartRequest(t, "file", "test.txt", "hello outbox")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+	jobID := getJobIDFromResponse(t, rr.Body)
+
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 1 {
+		t.Errorf("Expected 1 message to be published, got %d", len(messages))
+	}
+	if _, ok := mockGCS.GetObjectContent(outboxEntryPath(jobID, 0)); ok {
+		t.Error("Expected the outbox to be empty")
+	}
+}
+
+// makeDue moves the not_before of a job's outbox entry into the past.
+func makeDue(t *testing.T, app *Application, jobID string) {
+	t.Helper()
+	rc, err := app.Storage.NewObjectReader(context.Background(), app.Bucket, outboxEntryPath(jobID, 0))
+	if err != nil {
+		t.Fatalf("Expected the message to wait in the outbox: %v", err)
+	}
+	var entry outboxEntry
+	err = json.NewDecoder(rc).Decode(&entry)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode outbox entry: %v", err)
+	}
+	entry.NotBefore = time.Now().Add(-time.Second)
+	if err := app.saveOutboxEntry(context.Background(), &entry); err != nil {
+		t.Fatalf("Failed to save outbox entry: %v", err)
+	}
+}
+
+func TestOutbox_Scheduled(t *testing.T) {
+	app, _, mockPubSub := setupTestApp(t)
+
+	notBefore := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello later", map[string]string{"not_before": notBefore.Format(time.RFC3339)})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+	jobID := getJobIDFromResponse(t, rr.Body)
+	job, err := app.JobStore.GetJob(context.Background(), jobID)
+	if err != nil || job.Status != common.JobScheduled || !job.NotBefore.Equal(notBefore) {
+		t.Fatalf("Expected a SCHEDULED job starting at %v, got %+v, %v", notBefore, job, err)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+		t.Fatalf("Expected nothing to be published before not_before, got %d", len(messages))
+	}
+
+	// not due yet, however old the entry is
+	if n, err := app.reconcileOutbox(context.Background(), time.Now().Add(time.Minute)); err != nil || n != 0 {
+		t.Errorf("Expected nothing to be delivered, got %d, %v", n, err)
+	}
+
+	makeDue(t, app, jobID)
+	// due entries don't wait for the grace period
+	if n, err := app.reconcileOutbox(context.Background(), time.Now().Add(-time.Hour)); err != nil || n != 1 {
+		t.Errorf("Expected 1 message to be delivered, got %d, %v", n, err)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 1 {
+		t.Errorf("Expected 1 message to be published, got %d", len(messages))
+	}
+	job, err = app.JobStore.GetJob(context.Background(), jobID)
+	if err != nil || job.Status != common.JobPending {
+		t.Errorf("Expected the job to be PENDING once enqueued, got %+v, %v", job, err)
+	}
+}
+
+func TestOutbox_ScheduledCanceled(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+
+	req := createTestMultipartRequestWithFields(t, "file", "test.txt", "hello later", map[string]string{"not_before": time.Now().Add(time.Hour).Format(time.RFC3339)})
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+	jobID := getJobIDFromResponse(t, rr.Body)
+	if _, err := app.JobStore.UpdateJob(context.Background(), jobID, func(j *common.Job) error {
+		j.Status = common.JobCanceled
+		return nil
+	}); err != nil {
+		t.Fatalf("Failed to cancel job: %v", err)
+	}
+
+	makeDue(t, app, jobID)
+	if _, err := app.reconcileOutbox(context.Background(), time.Now()); err != nil {
+		t.Fatalf("reconcileOutbox failed: %v", err)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+		t.Errorf("Expected the canceled job not to be published, got %d", len(messages))
+	}
+	if _, ok := mockGCS.GetObjectContent(outboxEntryPath(jobID, 0)); ok {
+		t.Error("Expected the message of the canceled job to leave the outbox")
+	}
+}
+
+func TestNotBeforeValidation(t *testing.T) {
+	testCases := []struct {
+		name           string
+		notBefore      string
+		expectedStatus common.JobStatus
+		expectedCode   int
+	}{
+		{name: "past", notBefore: "2020-01-02T15:04:05Z", expectedStatus: common.JobPending, expectedCode: http.StatusAccepted},
+		{name: "future", notBefore: time.Now().Add(time.Hour).Format(time.RFC3339), expectedStatus: common.JobScheduled, expectedCode: http.StatusAccepted},
+		{name: "malformed", notBefore: "tomorrow", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			req := createTestMultipartRequestWithFields(t, "file", "test.txt.ranran", "ignored", map[string]string{"not_before": tc.notBefore})
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.decompressHandler).ServeHTTP(rr, req)
+			if rr.Code != tc.expectedCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedCode)
+			}
+			if tc.expectedCode != http.StatusAccepted {
+				return
+			}
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil || job.Status != tc.expectedStatus {
+				t.Errorf("Expected a %s job, got %+v, %v", tc.expectedStatus, job, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// Profile is a named trade of speed for ratio, so that clients can pick one
+// without knowing the codecs.
+type Profile struct {
+	Algorithm string `json:"algorithm"`
+	Level     int    `json:"level,omitempty"`
+	// PartSize replaces SplitPartSize for the jobs of the profile, 0 keeps
+	// it. Smaller parts spread a large original over more workers, larger
+	// ones compress better.
+	PartSize int64 `json:"part_size,omitempty"`
+}
+
+// defaultProfiles are the profiles of every deployment, unless it redefines
+// them.
+var defaultProfiles = map[string]Profile{
+	"fast":     {Algorithm: common.AlgorithmZstd, Level: 1, PartSize: 64 << 20},
+	"balanced": {Algorithm: common.AlgorithmZstd, Level: 3},
+	"max":      {Algorithm: common.AlgorithmZstd, Level: 19, PartSize: 512 << 20},
+}
+
+// parseProfiles reads the profiles a deployment adds to or redefines of the
+// default ones, a comma-separated list of name=algorithm[:level[:part_size]],
+// e.g. "archive=zstd:22:1073741824,text=huffman".
+func parseProfiles(value string) (map[string]Profile, error) {
+	profiles := maps.Clone(defaultProfiles)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		fields := strings.Split(spec, ":")
+		if name = strings.TrimSpace(name); !ok || name == "" || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid profile %q, expected name=algorithm[:level[:part_size]]", entry)
+		}
+		profile := Profile{Algorithm: strings.TrimSpace(fields[0])}
+		var err error
+		if len(fields) > 1 {
+			if profile.Level, err = strconv.Atoi(strings.TrimSpace(fields[1])); err != nil {
+				return nil, fmt.Errorf("invalid level of profile %s: %w", name, err)
+			}
+		}
+		if len(fields) > 2 {
+			if profile.PartSize, err = strconv.ParseInt(strings.TrimSpace(fields[2]), 10, 64); err != nil || profile.PartSize < 0 {
+				return nil, fmt.Errorf("invalid part size of profile %s: %q", name, fields[2])
+			}
+		}
+		algorithm, errMsg := compressionAlgorithm(profile.Algorithm, "")
+		if errMsg == "" {
+			errMsg = compressionLevel(algorithm, profile.Level)
+		}
+		if errMsg != "" {
+			return nil, fmt.Errorf("profile %s: %s", name, errMsg)
+		}
+		profile.Algorithm = algorithm
+		profiles[name] = profile
+	}
+	return profiles, nil
+}
+
+// applyProfile resolves the profile name of a compression into its algorithm
+// and level, which the request has to leave to the profile. Without a
+// profile algorithm and level are returned as they are. A non-empty message
+// explains why they can't be combined.
+func (app *Application) applyProfile(name, algorithm string, level int) (string, int, string) {
+	if name == "" {
+		return algorithm, level, ""
+	}
+	profile, ok := app.Profiles[name]
+	if !ok {
+		return "", 0, "Unsupported profile: " + name
+	}
+	if algorithm != "" || level != 0 {
+		return "", 0, "A profile can't be combined with an algorithm or level"
+	}
+	return profile.Algorithm, profile.Level, ""
+}
+
+// profilesHandler lists the profiles jobs can be submitted with.
+func (app *Application) profilesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"profiles": app.Profiles})
+}
+
+// ProfileRules pick the profile of compressions that leave the algorithm to
+// the deployment, by the extension of their file or its content type.
+type ProfileRules struct {
+	// Extensions maps extensions like ".log" to a profile.
+	Extensions map[string]string
+	// ContentTypes maps content types like "image/jpeg", or all of a kind
+	// like "image/*", to a profile.
+	ContentTypes map[string]string
+}
+
+// parseProfileRules reads a comma-separated list of extension=profile and
+// content_type=profile, e.g. ".log=max,text/csv=balanced,image/*=store",
+// whose profiles have to be among profiles.
+func parseProfileRules(value string, profiles map[string]Profile) (ProfileRules, error) {
+	rules := ProfileRules{Extensions: make(map[string]string), ContentTypes: make(map[string]string)}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		key, profile, ok := strings.Cut(entry, "=")
+		key, profile = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(profile)
+		if !ok || key == "" || profile == "" {
+			return ProfileRules{}, fmt.Errorf("invalid profile rule %q, expected extension=profile or content_type=profile", entry)
+		}
+		if _, ok := profiles[profile]; !ok {
+			return ProfileRules{}, fmt.Errorf("profile rule %s: unknown profile %s", key, profile)
+		}
+		switch {
+		case strings.HasPrefix(key, "."):
+			rules.Extensions[key] = profile
+		case strings.Contains(key, "/"):
+			rules.ContentTypes[key] = profile
+		default:
+			return ProfileRules{}, fmt.Errorf("invalid profile rule %q, expected an extension starting with a dot or a content type", entry)
+		}
+	}
+	return rules, nil
+}
+
+// match returns the profile for a file called fileName of contentType, and
+// why, or nothing when no rule matches. Extensions go before content types,
+// which go before all of their kind.
+func (rules ProfileRules) match(fileName, contentType string) (string, string) {
+	if ext := strings.ToLower(filepath.Ext(fileName)); ext != "" {
+		if profile, ok := rules.Extensions[ext]; ok {
+			return profile, "profile " + profile + " for " + ext + " files"
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", ""
+	}
+	if profile, ok := rules.ContentTypes[mediaType]; ok {
+		return profile, "profile " + profile + " for " + mediaType
+	}
+	kind, _, _ := strings.Cut(mediaType, "/")
+	if profile, ok := rules.ContentTypes[kind+"/*"]; ok {
+		return profile, "profile " + profile + " for " + kind + "/*"
+	}
+	return "", ""
+}
+
+// requestProfile is the profile a compression asked for or, when it left
+// the algorithm, level and format to the deployment, the one the rules pick
+// for its file.
+func (app *Application) requestProfile(profile, algorithm string, level int, format, fileName, contentType string) string {
+	if profile != "" || algorithm != "" || level != 0 || format != "" {
+		return profile
+	}
+	profile, _ = app.ProfileRules.match(fileName, contentType)
+	return profile
+}
+
+// applyProfileRules replaces the default algorithm of params by the profile
+// the rules pick for its file, once the file is known.
+func (app *Application) applyProfileRules(params *compressParams) {
+	if !params.DefaultAlgorithm {
+		return
+	}
+	params.DefaultAlgorithm = false
+	name, reason := app.ProfileRules.match(params.FileName, params.ContentType)
+	if name == "" {
+		return
+	}
+	profile := app.Profiles[name]
+	params.Algorithm, params.Level, params.Profile, params.AlgorithmReason = profile.Algorithm, profile.Level, name, reason
+}
@@ -0,0 +1,239 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestParseProfiles(t *testing.T) {
+	profiles, err := parseProfiles(" fast = gzip:9 , text=huffman, big=zstd:5:1048576")
+	if err != nil {
+		t.Fatalf("Failed to parse profiles: %v", err)
+	}
+	want := map[string]Profile{
+		"fast":     {Algorithm: common.AlgorithmGzip, Level: 9},
+		"balanced": defaultProfiles["balanced"],
+		"max":      defaultProfiles["max"],
+		"text":     {Algorithm: common.AlgorithmHuffman},
+		"big":      {Algorithm: common.AlgorithmZstd, Level: 5, PartSize: 1 << 20},
+	}
+	if len(profiles) != len(want) {
+		t.Errorf("Expected %d profiles, got %v", len(want), profiles)
+	}
+	for name, profile := range want {
+		if profiles[name] != profile {
+			t.Errorf("Expected profile %s to be %+v, got %+v", name, profile, profiles[name])
+		}
+	}
+	if defaultProfiles["fast"].Algorithm != common.AlgorithmZstd {
+		t.Error("Expected the default profiles to be left alone")
+	}
+
+	for _, value := range []string{"fast", "=zstd", "x=nope", "x=zstd:99", "x=zstd:fast", "x=zstd:1:big", "x=zstd:1:-1", "x=zstd:1:2:3"} {
+		if _, err := parseProfiles(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestCompressWithProfile(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fields    map[string]string
+		wantCode  int
+		wantError string
+	}{
+		{name: "profile", fields: map[string]string{"profile": "max"}, wantCode: http.StatusAccepted},
+		{name: "unknown profile", fields: map[string]string{"profile": "fastest"}, wantCode: http.StatusBadRequest, wantError: "Unsupported profile"},
+		{name: "with algorithm", fields: map[string]string{"profile": "max", "algorithm": "zstd"}, wantCode: http.StatusBadRequest, wantError: "can't be combined"},
+		{name: "with level", fields: map[string]string{"profile": "max", "level": "3"}, wantCode: http.StatusBadRequest, wantError: "can't be combined"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, mockPubSub := setupTestApp(t)
+			app.Profiles = defaultProfiles
+			handler := app.Handler()
+
+			req := createTestMultipartRequestWithFields(t, "file", "notes.txt", "some text", tc.fields)
+			req.URL.Path = "/v1/compress"
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d for /compress, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode != http.StatusAccepted {
+				if !strings.Contains(rr.Body.String(), tc.wantError) {
+					t.Errorf("Expected %q in the error, got %s", tc.wantError, rr.Body)
+				}
+				return
+			}
+
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Algorithm != common.AlgorithmZstd || job.Level != 19 || job.Profile != "max" {
+				t.Errorf("Expected the job to be compressed by the max profile, got %+v", job)
+			}
+			messages := mockPubSub.GetMessages(testCompressTopic)
+			if len(messages) != 1 {
+				t.Fatalf("Expected 1 message, got %d", len(messages))
+			}
+			var msg common.CompressedMsgSchema
+			if err := common.UnmarshalMessage(messages[0].Data, &msg); err != nil {
+				t.Fatalf("Failed to unmarshal message: %v", err)
+			}
+			if msg.Algorithm != common.AlgorithmZstd || msg.Level != 19 {
+				t.Errorf("Expected the message to carry the profile's algorithm and level, got %+v", msg)
+			}
+		})
+	}
+
+	t.Run("upload session", func(t *testing.T) {
+		app, _, _ := setupTestApp(t)
+		app.Profiles = defaultProfiles
+		body, _ := json.Marshal(map[string]any{"operation": "compress", "file_name": "notes.txt", "profile": "fast"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/uploads", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+		var session uploadSession
+		if err := json.NewDecoder(rr.Body).Decode(&session); err != nil {
+			t.Fatalf("Failed to decode session: %v", err)
+		}
+		if session.Algorithm != common.AlgorithmZstd || session.Level != 1 || session.Profile != "fast" {
+			t.Errorf("Expected the session to use the fast profile, got %+v", session)
+		}
+	})
+}
+
+func TestProfilePartSize(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.SplitThreshold, app.SplitPartSize = 100, 1000
+	app.Profiles = map[string]Profile{"small": {Algorithm: common.AlgorithmZstd, PartSize: 100}}
+
+	job := &common.Job{Algorithm: common.AlgorithmZstd, InputSize: 250}
+	if parts := app.splitParts(job); parts != 0 {
+		t.Errorf("Expected the deployment's part size to keep the job whole, got %d parts", parts)
+	}
+	job.Profile = "small"
+	if parts := app.splitParts(job); parts != 3 {
+		t.Errorf("Expected the profile to split the job into 3 parts, got %d", parts)
+	}
+}
+
+func TestProfilesHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.Profiles = defaultProfiles
+	rr := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/profiles", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	var resp struct {
+		Profiles map[string]Profile `json:"profiles"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Profiles) != len(defaultProfiles) || resp.Profiles["max"] != defaultProfiles["max"] {
+		t.Errorf("Unexpected profiles: %v", resp.Profiles)
+	}
+}
+
+func TestParseProfileRules(t *testing.T) {
+	profiles := map[string]Profile{"max": defaultProfiles["max"], "store": {Algorithm: common.AlgorithmStore}}
+	rules, err := parseProfileRules(" .LOG = max , text/csv=max, image/*=store", profiles)
+	if err != nil {
+		t.Fatalf("Failed to parse profile rules: %v", err)
+	}
+	testCases := []struct {
+		fileName, contentType, want string
+	}{
+		{"app.log", "", "max"},
+		{"APP.LOG", "text/plain", "max"},
+		{"data.txt", "text/csv; charset=utf-8", "max"},
+		{"photo.jpg", "image/jpeg", "store"},
+		{"photo.log", "image/jpeg", "max"},
+		{"notes.txt", "text/plain", ""},
+		{"blob", "", ""},
+	}
+	for _, tc := range testCases {
+		if got, _ := rules.match(tc.fileName, tc.contentType); got != tc.want {
+			t.Errorf("Expected %s (%s) to get profile %q, got %q", tc.fileName, tc.contentType, tc.want, got)
+		}
+	}
+
+	for _, value := range []string{".log", ".log=", "log=max", ".log=fastest", "=max"} {
+		if _, err := parseProfileRules(value, profiles); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestCompressWithProfileRules(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fields      map[string]string
+		wantProfile string
+		wantLevel   int
+	}{
+		{name: "matching file", wantProfile: "max", wantLevel: 19},
+		{name: "explicit algorithm", fields: map[string]string{"algorithm": "zstd"}},
+		{name: "explicit profile", fields: map[string]string{"profile": "fast"}, wantProfile: "fast", wantLevel: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.Profiles = defaultProfiles
+			app.ProfileRules = ProfileRules{Extensions: map[string]string{".log": "max"}}
+
+			req := createTestMultipartRequestWithFields(t, "file", "app.log", "some logs", tc.fields)
+			req.URL.Path = "/v1/compress"
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("Expected status %d for /compress, got %d: %s", http.StatusAccepted, rr.Code, rr.Body)
+			}
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Profile != tc.wantProfile || job.Level != tc.wantLevel {
+				t.Errorf("Expected profile %q at level %d, got %+v", tc.wantProfile, tc.wantLevel, job)
+			}
+			if tc.name == "matching file" && !strings.Contains(job.AlgorithmReason, ".log") {
+				t.Errorf("Expected the reason to name the rule, got %q", job.AlgorithmReason)
+			}
+		})
+	}
+
+	t.Run("upload session", func(t *testing.T) {
+		app, _, _ := setupTestApp(t)
+		app.Profiles = defaultProfiles
+		app.ProfileRules = ProfileRules{ContentTypes: map[string]string{"text/*": "fast"}}
+		body, _ := json.Marshal(map[string]any{"operation": "compress", "file_name": "notes.txt"})
+		req := httptest.NewRequest(http.MethodPost, "/v1/uploads", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+		var session uploadSession
+		if err := json.NewDecoder(rr.Body).Decode(&session); err != nil {
+			t.Fatalf("Failed to decode session: %v", err)
+		}
+		if session.Profile != "fast" || session.Level != 1 {
+			t.Errorf("Expected the session to use the fast profile, got %+v", session)
+		}
+	})
+}
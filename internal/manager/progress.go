@@ -0,0 +1,113 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// jobProgressEvent is the data of the events of jobProgressHandler.
+type jobProgressEvent struct {
+	Status   common.JobStatus    `json:"status"`
+	Progress *common.JobProgress `json:"progress,omitempty"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// jobProgressHandler streams the progress of a job as server-sent events: a
+// "progress" event whenever its status or the progress workers report
+// changes, then a "done" event with the finished job before the stream ends.
+func (app *Application) jobProgressHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher := http.NewResponseController(w)
+
+	var last []byte
+	app.watchJob(r.Context(), job, func(job *common.Job) bool {
+		if job.Status.Finished() {
+			data, _ := json.Marshal(job)
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			flusher.Flush()
+			return false
+		}
+		data, _ := json.Marshal(jobProgressEvent{Status: job.Status, Progress: job.Progress, Error: job.Error})
+		if string(data) != string(last) {
+			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+			flusher.Flush()
+			last = data
+		}
+		return true
+	})
+}
+
+// jobWaitHandler answers with the job once it has finished, or once the
+// timeout query parameter (default 30s, at most MaxWaitTimeout) has passed,
+// so that scripts can wait for a job in a loop of plain requests. The status
+// of the job tells which it was.
+func (app *Application) jobWaitHandler(w http.ResponseWriter, r *http.Request) {
+	timeout := 30 * time.Second
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil || timeout < 0 {
+			common.WriteError(w, "Invalid timeout: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+	if app.MaxWaitTimeout > 0 {
+		timeout = min(timeout, app.MaxWaitTimeout)
+	}
+	job, ok := app.lookupJob(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	app.watchJob(ctx, job, func(latest *common.Job) bool {
+		job = latest
+		return !job.Status.Finished()
+	})
+	if r.Context().Err() != nil {
+		// the client is gone
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// watchJob calls fn with job, then with its record every
+// ProgressPollInterval until fn returns false or ctx is done. Polls that fail
+// are skipped, the next one may succeed.
+func (app *Application) watchJob(ctx context.Context, job *common.Job, fn func(job *common.Job) bool) {
+	interval := app.ProgressPollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for fn(job) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		pollCtx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+		next, err := app.JobStore.GetJob(pollCtx, job.ID)
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to poll job", "job", job.ID, "error", err)
+			continue
+		}
+		job = next
+	}
+}
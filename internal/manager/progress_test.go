@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestJobProgressHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.ProgressPollInterval = 5 * time.Millisecond
+	jobID := uuid.New().String()
+	progress := common.NewJobProgress(250, 1000)
+	if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+		ID:        jobID,
+		Operation: common.OperationCompress,
+		Status:    common.JobProcessing,
+		Progress:  &progress,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/jobs/"+jobID+"/progress", nil)
+	req.SetPathValue("id", jobID)
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		http.HandlerFunc(app.jobProgressHandler).ServeHTTP(rr, req)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	app.JobStore.UpdateJob(context.Background(), jobID, func(j *common.Job) error {
+		j.Status = common.JobDone
+		return nil
+	})
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stream to end once the job is done")
+	}
+
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %q", contentType)
+	}
+	body := rr.Body.String()
+	events := strings.Split(strings.TrimSpace(body), "\n\n")
+	if len(events) != 2 {
+		t.Fatalf("Expected a progress and a done event, got %q", body)
+	}
+	if !strings.HasPrefix(events[0], "event: progress\n") || !strings.Contains(events[0], `"percent":25`) {
+		t.Errorf("Unexpected progress event: %q", events[0])
+	}
+	if !strings.HasPrefix(events[1], "event: done\n") || !strings.Contains(events[1], `"status":"DONE"`) {
+		t.Errorf("Unexpected done event: %q", events[1])
+	}
+}
+
+func TestJobWaitHandler(t *testing.T) {
+	testCases := []struct {
+		name       string
+		query      string
+		finish     bool
+		wantCode   int
+		wantStatus common.JobStatus
+	}{
+		{name: "finished", query: "?timeout=5s", finish: true, wantCode: http.StatusOK, wantStatus: common.JobDone},
+		{name: "timed out", query: "?timeout=30ms", wantCode: http.StatusOK, wantStatus: common.JobProcessing},
+		{name: "capped", query: "?timeout=1h", wantCode: http.StatusOK, wantStatus: common.JobProcessing},
+		{name: "invalid timeout", query: "?timeout=soon", wantCode: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.ProgressPollInterval = 5 * time.Millisecond
+			app.MaxWaitTimeout = 50 * time.Millisecond
+			jobID := uuid.New().String()
+			if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+				ID:        jobID,
+				Operation: common.OperationCompress,
+				Status:    common.JobProcessing,
+			}); err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
+			if tc.finish {
+				app.MaxWaitTimeout = 5 * time.Second
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					app.JobStore.UpdateJob(context.Background(), jobID, func(j *common.Job) error {
+						j.Status = common.JobDone
+						return nil
+					})
+				}()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+jobID+"/wait"+tc.query, nil)
+			req.SetPathValue("id", jobID)
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			http.HandlerFunc(app.jobWaitHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected the request to return soon, took %v", elapsed)
+			}
+			if !strings.Contains(rr.Body.String(), `"status":"`+string(tc.wantStatus)+`"`) {
+				t.Errorf("Expected a %s job, got %s", tc.wantStatus, rr.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// objectReadSeeker reads an object of known size from wherever it was last
+// seeked to, with a range read opened on the first Read after a Seek. This
+// lets http.ServeContent answer Range requests without downloading the
+// object whole.
+type objectReadSeeker struct {
+	ctx     context.Context
+	storage common.StorageBackend
+	bucket  string
+	object  string
+	size    int64
+	offset  int64
+	rc      io.ReadCloser
+}
+
+func (o *objectReadSeeker) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.rc == nil {
+		rc, err := o.storage.NewRangeReader(o.ctx, o.bucket, o.object, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.rc = rc
+	}
+	n, err := o.rc.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *objectReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+func (o *objectReadSeeker) Close() error {
+	if o.rc == nil {
+		return nil
+	}
+	err := o.rc.Close()
+	o.rc = nil
+	return err
+}
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"net/http"
+	"path/filepath"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// fileNameHeader names the file sent to /compress/raw, unless the file_name
+// query parameter does.
+const fileNameHeader = "X-File-Name"
+
+// rawCompressHandler compresses the body of the request as it is, without
+// multipart encoding, e.g. from `curl -T big.log .../compress/raw?file_name=big.log`.
+// The options of /compress are taken from the query instead of form fields.
+func (app *Application) rawCompressHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(common.OperationCompress).MaxSize)
+	// the body is the file, never a form
+	r.Form = r.URL.Query()
+
+	fileName := r.FormValue("file_name")
+	if fileName == "" {
+		fileName = r.Header.Get(fileNameHeader)
+	}
+	// like multipart file names, only the last element counts
+	fileName = filepath.Base(fileName)
+	if fileName == "." || fileName == string(filepath.Separator) {
+		common.WriteError(w, "file_name or "+fileNameHeader+" is required", http.StatusBadRequest)
+		return
+	}
+
+	params, errMsg := app.compressOptions(r)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	if params.SHA256, errMsg = parseChecksum(r.FormValue("sha256")); errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	params.FileName = fileName
+	params.ContentType = contentTypeFor(fileName, r.Header.Get("Content-Type"))
+	app.serveCompress(w, r, r.Body, params)
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestRawCompressHandler(t *testing.T) {
+	testCases := []struct {
+		name          string
+		target        string
+		header        string
+		content       string
+		wantCode      int
+		wantFile      string
+		wantAlgorithm string
+	}{
+		{name: "name in the query", target: "/compress/raw?file_name=notes.txt", content: "raw bytes", wantCode: http.StatusAccepted, wantFile: "notes.txt", wantAlgorithm: common.AlgorithmHuffman},
+		{name: "name in a header", target: "/compress/raw", header: "notes.txt", content: "raw bytes", wantCode: http.StatusAccepted, wantFile: "notes.txt", wantAlgorithm: common.AlgorithmHuffman},
+		{name: "path in the name", target: "/compress/raw?file_name=../../etc/notes.txt", content: "raw bytes", wantCode: http.StatusAccepted, wantFile: "notes.txt", wantAlgorithm: common.AlgorithmHuffman},
+		{name: "options", target: "/compress/raw?file_name=notes.txt&algorithm=zstd&level=3", content: "raw bytes", wantCode: http.StatusAccepted, wantFile: "notes.txt", wantAlgorithm: common.AlgorithmZstd},
+		{name: "no name", target: "/compress/raw", content: "raw bytes", wantCode: http.StatusBadRequest},
+		{name: "invalid option", target: "/compress/raw?file_name=notes.txt&level=x", content: "raw bytes", wantCode: http.StatusBadRequest},
+		{name: "too large", target: "/compress/raw?file_name=notes.txt", content: strings.Repeat("a", testSmallUploadSize+1), wantCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			req := httptest.NewRequest(http.MethodPut, tc.target, strings.NewReader(tc.content))
+			req.Header.Set("Content-Type", "application/octet-stream")
+			if tc.header != "" {
+				req.Header.Set(fileNameHeader, tc.header)
+			}
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if rr.Code != http.StatusAccepted {
+				return
+			}
+
+			jobID := getJobIDFromResponse(t, rr.Body)
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.FileName != tc.wantFile || job.Algorithm != tc.wantAlgorithm {
+				t.Errorf("Unexpected job record: %+v", job)
+			}
+			if got, _ := mockGCS.GetObjectContent(originalObjectPath(jobID, tc.wantFile)); got != tc.content {
+				t.Errorf("Expected the body to be stored as it is, got %q", got)
+			}
+			if len(mockPubSub.GetMessages(app.CompressTopicID)) != 1 {
+				t.Error("Expected the job to be enqueued")
+			}
+		})
+	}
+}
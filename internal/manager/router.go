@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"net/http"
+	"strings"
+)
+
+// apiVersion prefixes the paths of the current version of the API. Breaking
+// changes go to the next version, while clients on this one keep it.
+const apiVersion = "/v1"
+
+// middleware wraps a handler, e.g. to turn requests away before they get to
+// it.
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in middlewares, the first one outermost, so that requests go
+// through them in order.
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// router registers routes on a ServeMux, with patterns like
+// "GET /jobs/{id}", each under the prefix and behind the middlewares of its
+// group and instrumented under its path.
+type router struct {
+	mux         *http.ServeMux
+	prefix      string
+	middlewares []middleware
+}
+
+func newRouter(mux *http.ServeMux) *router {
+	return &router{mux: mux}
+}
+
+// with returns a group of routes that go through middlewares as well, after
+// those of r.
+func (r *router) with(middlewares ...middleware) *router {
+	return &router{mux: r.mux, prefix: r.prefix, middlewares: append(r.middlewares[:len(r.middlewares):len(r.middlewares)], middlewares...)}
+}
+
+// under returns a group of routes whose paths start with prefix, e.g. "/v1".
+func (r *router) under(prefix string) *router {
+	return &router{mux: r.mux, prefix: r.prefix + prefix, middlewares: r.middlewares}
+}
+
+// handle registers h for pattern, "METHOD /path" with path parameters in
+// braces, which h gets from r.PathValue.
+func (r *router) handle(pattern string, h http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	path = r.prefix + path
+	r.mux.Handle(method+" "+path, instrument(path, chain(h, r.middlewares...).ServeHTTP))
+}
+
+// deprecated marks the responses to paths without a version as such, and
+// points to the same path under version, which clients should move to.
+func deprecated(version string) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+version+r.URL.Path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
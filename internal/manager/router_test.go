@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	var calls []string
+	trace := func(name string) middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	mux := http.NewServeMux()
+	api := newRouter(mux).with(trace("outer"))
+	api.with(trace("inner")).handle("GET /things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "handler "+r.PathValue("id"))
+	})
+	api.handle("POST /things", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "create")
+	})
+
+	testCases := []struct {
+		method, path string
+		wantCode     int
+		wantCalls    string
+	}{
+		{http.MethodGet, "/things/42", http.StatusOK, "outer inner handler 42"},
+		{http.MethodPost, "/things", http.StatusOK, "outer create"},
+		{http.MethodDelete, "/things/42", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/other", http.StatusNotFound, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			calls = nil
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if rr.Code != tc.wantCode {
+				t.Errorf("Expected status %d, got %d", tc.wantCode, rr.Code)
+			}
+			if got := strings.Join(calls, " "); got != tc.wantCalls {
+				t.Errorf("Expected calls %q, got %q", tc.wantCalls, got)
+			}
+		})
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	handler := app.Handler()
+
+	testCases := []struct {
+		method, path   string
+		wantCode       int
+		wantSuccessor  string
+		wantDeprecated bool
+	}{
+		{method: http.MethodGet, path: "/v1/usage", wantCode: http.StatusOK},
+		{method: http.MethodGet, path: "/usage", wantCode: http.StatusOK, wantDeprecated: true, wantSuccessor: `</v1/usage>; rel="successor-version"`},
+		{method: http.MethodGet, path: "/v1/compress", wantCode: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/v2/usage", wantCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+			if rr.Code != tc.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tc.wantCode, rr.Code, rr.Body)
+			}
+			if deprecated := rr.Header().Get("Deprecation") == "true"; deprecated != tc.wantDeprecated {
+				t.Errorf("Expected deprecated %v, got %v", tc.wantDeprecated, deprecated)
+			}
+			if link := rr.Header().Get("Link"); link != tc.wantSuccessor {
+				t.Errorf("Expected Link %q, got %q", tc.wantSuccessor, link)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// parseNotBefore reads the optional not_before of a submission, the RFC 3339
+// time the job must not start before. A non-empty message explains why it is
+// invalid.
+func parseNotBefore(value string) (time.Time, string) {
+	if value == "" {
+		return time.Time{}, ""
+	}
+	notBefore, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, "Invalid not_before: " + value
+	}
+	return notBefore.UTC(), ""
+}
+
+// initialStatus is the status a job that must not start before notBefore is
+// enqueued with. Jobs due already are PENDING right away.
+func initialStatus(notBefore time.Time) common.JobStatus {
+	if notBefore.After(time.Now()) {
+		return common.JobScheduled
+	}
+	return common.JobPending
+}
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// runServer serves on ln until ctx is done, then stops accepting connections
+// and gives in-progress requests up to shutdownTimeout to finish.
+func runServer(ctx context.Context, srv *http.Server, ln net.Listener, shutdownTimeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining in-progress requests", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// whatever is still running gets cut off
+		srv.Close()
+		return fmt.Errorf("failed to drain requests: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// runGRPCServer serves srv on ln until ctx is done, then drains its calls
+// like runServer. The returned channel is closed once srv has stopped.
+func runGRPCServer(ctx context.Context, srv *grpc.Server, ln net.Listener, shutdownTimeout time.Duration) <-chan struct{} {
+	stopped := make(chan struct{})
+	go func() {
+		if err := srv.Serve(ln); err != nil {
+			slog.Error("gRPC server stopped with an error", "error", err)
+		}
+	}()
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		drained := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-time.After(shutdownTimeout):
+			// whatever is still running gets cut off
+			srv.Stop()
+		}
+	}()
+	return stopped
+}
+
+// withCircuit answers 503 right away while the storage or the queue has its
+// circuit open, rather than have requests wait on a dependency that is down.
+func (app *Application) withCircuit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b := common.OpenCircuit(app.Storage, app.PUBSUBClient); b != nil {
+			w.Header().Set("Retry-After", strconv.Itoa(int(b.RetryAfter().Seconds())+1))
+			common.WriteError(w, b.Name+" is unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withRequestID passes on the X-Request-ID of a request, or a new one when it
+// has none, in its context and its response.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(common.RequestIDHeader)
+		if !common.ValidRequestID(id) {
+			id = common.NewRequestID()
+		}
+		w.Header().Set(common.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(common.WithRequestID(r.Context(), id)))
+	})
+}
+
+// recoveryWriter records whether the response was started.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController flush progress streams.
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withRecovery answers 500 when a handler panics, instead of letting the
+// panic take down the connection with no response, and logs the stack. A
+// response already started is cut off where it got to. http.ErrAbortHandler
+// is passed on, since it aborts the response on purpose.
+func withRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			panicsTotal.Inc()
+			slog.ErrorContext(r.Context(), "Recovered from panic in handler", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			if !rw.wroteHeader {
+				common.WriteError(rw, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
@@ -0,0 +1,233 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestRunServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	srv := &http.Server{Handler: mux}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- runServer(ctx, srv, ln, time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{string(body), err}
+	}()
+
+	// shut down while the request is in progress
+	<-started
+	cancel()
+
+	if res := <-responses; res.err != nil || res.body != "done" {
+		t.Errorf("Expected the in-progress request to finish, got %q, %v", res.body, res.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if _, err := http.Get("http://" + ln.Addr().String() + "/slow"); err == nil {
+		t.Error("Expected new connections to be refused after shutdown")
+	}
+}
+
+func TestWithCircuit(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	breaker := &common.CircuitBreaker{Name: "storage", FailureRatio: 1, MinCalls: 1, Window: time.Minute, Cooldown: time.Minute, IsFailure: func(error) bool { return true }}
+	app.Storage = &common.BreakerStorage{StorageBackend: mockGCS, Breaker: breaker}
+	handler := app.Handler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+	if rr := get("/jobs/" + uuid.New().String()); rr.Code != http.StatusNotFound {
+		t.Fatalf("Expected requests to go through, got %v", rr.Code)
+	}
+	breaker.Record(errors.New("storage is down"))
+	rr := get("/jobs/" + uuid.New().String())
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After while the circuit is open, got %v %v", rr.Code, rr.Header())
+	}
+	if rr := get("/healthz"); rr.Code != http.StatusOK {
+		t.Errorf("Expected probes to be answered, got %v", rr.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header string
+		wantID string
+	}{
+		{name: "from the client", header: "trace-1234", wantID: "trace-1234"},
+		{name: "generated"},
+		{name: "invalid", header: "has spaces\tand tabs"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, mockPubSub := setupTestApp(t)
+			req := createTestMultipartRequest(t, "file", "notes.txt", "correlated")
+			req.URL.Path = "/compress"
+			if tc.header != "" {
+				req.Header.Set(common.RequestIDHeader, tc.header)
+			}
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("Expected the job to be accepted, got %d: %s", rr.Code, rr.Body)
+			}
+
+			id := rr.Header().Get(common.RequestIDHeader)
+			if !common.ValidRequestID(id) || (tc.wantID != "" && id != tc.wantID) {
+				t.Fatalf("Unexpected request ID %q", id)
+			}
+			job, err := app.JobStore.GetJob(context.Background(), getJobIDFromResponse(t, rr.Body))
+			if err != nil || job.RequestID != id {
+				t.Errorf("Expected the job to carry request ID %q, got %+v, %v", id, job, err)
+			}
+			messages := mockPubSub.GetMessages(app.CompressTopicID)
+			if len(messages) != 1 || messages[0].Attributes[common.RequestIDAttribute] != id {
+				t.Errorf("Expected the message to carry request ID %q, got %+v", id, messages)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	app, _, _ := setupTestApp(t)
+	req := createTestMultipartRequest(t, "file", "notes.txt", "logged")
+	req.URL.Path = "/compress"
+	rr := httptest.NewRecorder()
+	app.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected the job to be accepted, got %d: %s", rr.Code, rr.Body)
+	}
+	size := rr.Body.Len()
+	jobID := getJobIDFromResponse(t, rr.Body)
+	app.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/jobs/"+uuid.NewString(), nil))
+	app.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	var records []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		var record map[string]any
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", line, err)
+		}
+		if record["msg"] == "HTTP request" {
+			records = append(records, record)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected one record per request but the probe, got %v", records)
+	}
+	submit, lookup := records[0], records[1]
+	if submit["method"] != "POST" || submit["path"] != "/compress" || submit["status"] != float64(http.StatusAccepted) ||
+		submit["job_id"] != jobID || submit["bytes"] != float64(size) || submit["remote_addr"] == "" {
+		t.Errorf("Unexpected record of the submission: %v", submit)
+	}
+	if lookup["status"] != float64(http.StatusNotFound) || lookup["job_id"] == nil {
+		t.Errorf("Unexpected record of the lookup: %v", lookup)
+	}
+}
+
+// panickingJobStore panics on every lookup of a job.
+type panickingJobStore struct {
+	common.JobStoreInterface
+}
+
+func (s *panickingJobStore) GetJob(ctx context.Context, id string) (*common.Job, error) {
+	panic("job store blew up")
+}
+
+func TestWithRecovery(t *testing.T) {
+	t.Run("handler", func(t *testing.T) {
+		app, _, _ := setupTestApp(t)
+		app.JobStore = &panickingJobStore{JobStoreInterface: app.JobStore}
+		before := testutil.ToFloat64(panicsTotal)
+
+		rr := httptest.NewRecorder()
+		app.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/jobs/"+uuid.NewString(), nil))
+		if rr.Code != http.StatusInternalServerError || rr.Header().Get(common.RequestIDHeader) == "" {
+			t.Fatalf("Expected 500 with a request ID, got %d %v", rr.Code, rr.Header())
+		}
+		var body map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["error"] == "" {
+			t.Errorf("Expected a JSON error, got %v, %v", body, err)
+		}
+		if got := testutil.ToFloat64(panicsTotal); got != before+1 {
+			t.Errorf("Expected the panic to be counted, got %v after %v", got, before)
+		}
+	})
+
+	t.Run("response started", func(t *testing.T) {
+		handler := withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, "partial")
+			panic("halfway")
+		}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK || rr.Body.String() != "partial" {
+			t.Errorf("Expected the started response to be left as it is, got %d %q", rr.Code, rr.Body)
+		}
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		handler := withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("Expected http.ErrAbortHandler to be passed on, got %v", v)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+const (
+	// sniffSize is how much of a file the auto algorithm looks at.
+	sniffSize = 64 << 10
+	// incompressibleEntropy is the entropy in bits per byte above which
+	// codecs can't do much with a file anymore.
+	incompressibleEntropy = 7.5
+)
+
+// compressedTypes are formats that are compressed already, so that
+// compressing them again only costs time.
+var compressedTypes = map[string]bool{
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/gif":                    true,
+	"image/webp":                   true,
+	"image/avif":                   true,
+	"video/mp4":                    true,
+	"video/webm":                   true,
+	"audio/mpeg":                   true,
+	"audio/aac":                    true,
+	"audio/ogg":                    true,
+	"font/woff2":                   true,
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+}
+
+// chooseAlgorithm picks the codec for a file of contentType starting with
+// sample, and says why. Compressed formats and data as random as theirs are
+// stored as they are, everything else goes to zstd.
+func chooseAlgorithm(sample []byte, contentType string) (string, string) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	if compressedTypes[mediaType] {
+		return common.AlgorithmStore, mediaType + " is compressed already"
+	}
+	entropy := compression.Entropy(sample)
+	if entropy >= incompressibleEntropy {
+		return common.AlgorithmStore, fmt.Sprintf("%s has an entropy of %.2f bits per byte", mediaType, entropy)
+	}
+	return common.AlgorithmZstd, fmt.Sprintf("%s has an entropy of %.2f bits per byte", mediaType, entropy)
+}
+
+// sniffContentType tells the content type of a file from its first bytes,
+// unless its name or the client did already.
+func sniffContentType(contentType string, sample []byte) string {
+	if contentType != "application/octet-stream" {
+		return contentType
+	}
+	return http.DetectContentType(sample)
+}
+
+// autoAlgorithm resolves the auto algorithm of params from the start of file,
+// returning the reader to upload file from instead.
+func autoAlgorithm(file io.Reader, params *compressParams) (io.Reader, error) {
+	if params.Archive {
+		// tarballs are never compressed already
+		params.Algorithm, params.AlgorithmReason = common.AlgorithmZstd, "archives go to zstd"
+		return file, nil
+	}
+	br := bufio.NewReaderSize(file, sniffSize)
+	sample, err := br.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to sniff file: %w", err)
+	}
+	params.ContentType = sniffContentType(params.ContentType, sample)
+	params.Algorithm, params.AlgorithmReason = chooseAlgorithm(sample, params.ContentType)
+	return br, nil
+}
+
+// autoAlgorithmOf resolves the auto algorithm of a job whose file is in
+// storage already, as for direct uploads and in-place jobs, returning the
+// algorithm, why it was chosen and the content type of the file.
+func (app *Application) autoAlgorithmOf(ctx context.Context, job *common.Job, bucket, object string) (string, string, string, error) {
+	rc, err := app.Storage.NewRangeReader(ctx, bucket, object, 0, sniffSize)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to sniff file: %w", err)
+	}
+	defer rc.Close()
+	sample, err := io.ReadAll(rc)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to sniff file: %w", err)
+	}
+	contentType := sniffContentType(job.ContentType, sample)
+	algorithm, reason := chooseAlgorithm(sample, contentType)
+	return algorithm, reason, contentType, nil
+}
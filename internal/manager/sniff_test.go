@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func randomContent(n int) string {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return string(data)
+}
+
+func TestAutoAlgorithm(t *testing.T) {
+	testCases := []struct {
+		name        string
+		fileName    string
+		content     string
+		fields      map[string]string
+		status      int
+		algorithm   string
+		contentType string
+	}{
+		{name: "text", fileName: "notes.txt", content: strings.Repeat("plain text compresses well\n", 100), algorithm: common.AlgorithmZstd, contentType: "text/plain; charset=utf-8"},
+		{name: "jpeg", fileName: "photo.jpg", content: "\xff\xd8\xff\xe0 not much of a photo", algorithm: common.AlgorithmStore, contentType: "image/jpeg"},
+		{name: "sniffed zip", fileName: "bundle", content: "PK\x03\x04" + randomContent(100), algorithm: common.AlgorithmStore, contentType: "application/zip"},
+		{name: "random", fileName: "blob", content: randomContent(sniffSize * 2), algorithm: common.AlgorithmStore, contentType: "application/octet-stream"},
+		{name: "level", fileName: "notes.txt", content: "text", fields: map[string]string{"level": "3"}, status: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS, mockPubSub := setupTestApp(t)
+			app.MaxUploadSize = 1 << 20
+			fields := map[string]string{"algorithm": common.AlgorithmAuto}
+			for key, value := range tc.fields {
+				fields[key] = value
+			}
+			req := createTestMultipartRequestWithFields(t, "file", tc.fileName, tc.content, fields)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if tc.status == 0 {
+				tc.status = http.StatusAccepted
+			}
+			if rr.Code != tc.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, tc.status, rr.Body.String())
+			}
+			if tc.status != http.StatusAccepted {
+				return
+			}
+
+			jobID := getJobIDFromResponse(t, rr.Body)
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || job.Algorithm != tc.algorithm || job.AlgorithmReason == "" || job.ContentType != tc.contentType {
+				t.Fatalf("Unexpected job: %+v, %v", job, err)
+			}
+			// the sniffed bytes are uploaded too
+			if original, _ := mockGCS.GetObjectContent(originalObjectPath(jobID, tc.fileName)); original != tc.content {
+				t.Errorf("Expected the whole file to be uploaded, got %d of %d bytes", len(original), len(tc.content))
+			}
+			var message common.CompressedMsgSchema
+			common.UnmarshalMessage(mockPubSub.GetMessages(testCompressTopic)[0].Data, &message)
+			if message.Algorithm != tc.algorithm {
+				t.Errorf("Expected the message to carry %s, got %+v", tc.algorithm, message)
+			}
+		})
+	}
+
+	t.Run("direct", func(t *testing.T) {
+		app, mockGCS, _ := setupTestApp(t)
+		rr := createDirectJob(t, app, `{"operation":"compress","file_name":"blob","algorithm":"auto"}`)
+		var response map[string]any
+		json.NewDecoder(rr.Body).Decode(&response)
+		jobID, _ := response["job_id"].(string)
+
+		wc := mockGCS.NewObjectWriter(context.Background(), testBucket, jobID+"/original_blob")
+		wc.Write([]byte(strings.Repeat("{\"key\": \"value\"}\n", 50)))
+		wc.Close()
+		if rr := submitJob(t, app, jobID); rr.Code != http.StatusAccepted {
+			t.Fatalf("Failed to submit job: %d %s", rr.Code, rr.Body.String())
+		}
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil || job.Algorithm != common.AlgorithmZstd || job.AlgorithmReason == "" {
+			t.Errorf("Unexpected job: %+v, %v", job, err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package manager
+
+import (
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// splitParts returns how many parts the original of job is compressed in, or
+// zero to compress it at once. Only containers can be joined from parts,
+// and archives and verified jobs are always compressed at once. The profile
+// of the job may pick the size of the parts.
+func (app *Application) splitParts(job *common.Job) int {
+	partSize := app.SplitPartSize
+	if profile := app.Profiles[job.Profile]; profile.PartSize > 0 {
+		partSize = profile.PartSize
+	}
+	if app.SplitThreshold <= 0 || partSize <= 0 || job.InputSize <= app.SplitThreshold {
+		return 0
+	}
+	if !common.UsesContainer(job.Algorithm) || job.Archive || job.Verify {
+		return 0
+	}
+	parts := (job.InputSize + partSize - 1) / partSize
+	if parts < 2 {
+		return 0
+	}
+	return int(parts)
+}
+
+// publishCompress enqueues a compression job, or a message per part of a
+// split one. The worker that compresses the last part has them joined.
+func (app *Application) publishCompress(job *common.Job, message common.CompressedMsgSchema) error {
+	topicID := app.topicFor(app.CompressTopicID, job.Priority)
+	if job.Parts == 0 {
+		return app.publish(topicID, job, message)
+	}
+	message.Parts = job.Parts
+	for part := 1; part <= job.Parts; part++ {
+		message.Part = part
+		message.Offset, message.Length = common.PartRange(job.InputSize, job.Parts, part)
+		if err := app.publishPart(topicID, job, part, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestSplitLargeFiles(t *testing.T) {
+	content := strings.Repeat("0123456789", 25)
+	testCases := []struct {
+		name      string
+		fields    map[string]string
+		threshold int64
+		parts     int
+	}{
+		{name: "split", fields: map[string]string{"algorithm": "zstd"}, threshold: 100, parts: 3},
+		{name: "below threshold", fields: map[string]string{"algorithm": "zstd"}, threshold: 1000},
+		{name: "disabled", fields: map[string]string{"algorithm": "zstd"}},
+		{name: "gzip", fields: map[string]string{"algorithm": "gzip"}, threshold: 100},
+		{name: "verified", fields: map[string]string{"algorithm": "zstd", "verify": "true"}, threshold: 100},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, mockPubSub := setupTestApp(t)
+			app.SplitThreshold = tc.threshold
+			app.SplitPartSize = 100
+
+			req := createTestMultipartRequestWithFields(t, "file", "big.log", content, tc.fields)
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(app.compressHandler).ServeHTTP(rr, req)
+			if rr.Code != http.StatusAccepted {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+			}
+			jobID := getJobIDFromResponse(t, rr.Body)
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || job.Parts != tc.parts {
+				t.Fatalf("Expected a job in %d parts, got %+v, %v", tc.parts, job, err)
+			}
+
+			messages := mockPubSub.GetMessages(testCompressTopic)
+			if tc.parts == 0 {
+				if len(messages) != 1 {
+					t.Fatalf("Expected one message, got %d", len(messages))
+				}
+				return
+			}
+			if len(messages) != tc.parts {
+				t.Fatalf("Expected a message per part, got %d", len(messages))
+			}
+			var next int64
+			for i, message := range messages {
+				var part common.CompressedMsgSchema
+				common.UnmarshalMessage(message.Data, &part)
+				if part.UID != jobID || part.Parts != tc.parts || part.Part != i+1 || part.Offset != next {
+					t.Errorf("Unexpected part message: %+v", part)
+				}
+				next += part.Length
+			}
+			if next != int64(len(content)) {
+				t.Errorf("Expected the parts to cover %d bytes, got %d", len(content), next)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"strings"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// tenantPlaceholder is replaced by the owner in TenantPrefix.
+const tenantPlaceholder = "{tenant}"
+
+// tenantPrefix is where the objects of the jobs of owner are stored, empty
+// unless TenantPrefix is set.
+func (app *Application) tenantPrefix(owner string) string {
+	return strings.ReplaceAll(app.TenantPrefix, tenantPlaceholder, owner)
+}
+
+// jobDir is the directory of the objects of a new job of owner: the job ID,
+// under the prefix of owner.
+func (app *Application) jobDir(owner, jobID string) string {
+	return app.tenantPrefix(owner) + jobID
+}
+
+// visibleTo reports whether owner may see job. With TenantPrefix set, owners
+// only see their own jobs, stored under their own prefix; jobs stored before
+// it was set are hidden from everyone but operators.
+func (app *Application) visibleTo(owner string, job *common.Job) bool {
+	if app.TenantPrefix == "" {
+		return true
+	}
+	return job.Owner == owner && strings.HasPrefix(job.ObjectDir(), app.tenantPrefix(owner))
+}
@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	app.TenantPrefix = "tenants/{tenant}/"
+	handler := app.Handler()
+
+	req := createTestMultipartRequest(t, "file", "notes.txt", "tenant data")
+	req.URL.Path = "/compress"
+	req.Header.Set(apiKeyHeader, "alice")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected the job to be accepted, got %d: %s", rr.Code, rr.Body)
+	}
+	jobID := getJobIDFromResponse(t, rr.Body)
+
+	dir := "tenants/" + keyOwner("alice") + "/" + jobID
+	if _, ok := mockGCS.GetObjectContent(originalObjectPath(dir, "notes.txt")); !ok {
+		t.Errorf("Expected the original under %s", dir)
+	}
+	job, err := app.JobStore.GetJob(context.Background(), jobID)
+	if err != nil || job.ObjectDir() != dir {
+		t.Fatalf("Expected the job to record its directory, got %+v, %v", job, err)
+	}
+
+	testCases := []struct {
+		name     string
+		key      string
+		wantCode int
+	}{
+		{name: "owner", key: "alice", wantCode: http.StatusOK},
+		{name: "other tenant", key: "bob", wantCode: http.StatusNotFound},
+		{name: "anonymous", wantCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/jobs/"+jobID, nil)
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.wantCode {
+				t.Errorf("Expected status %d, got %d", tc.wantCode, rr.Code)
+			}
+
+			req = httptest.NewRequest(http.MethodPost, "/jobs/status", strings.NewReader(`{"job_ids": ["`+jobID+`"]}`))
+			req.Header.Set(apiKeyHeader, tc.key)
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if found := strings.Contains(rr.Body.String(), `"rejected":{}`); found != (tc.wantCode == http.StatusOK) {
+				t.Errorf("Unexpected batch status: %s", rr.Body)
+			}
+		})
+	}
+
+	t.Run("stored before the prefix", func(t *testing.T) {
+		job := &common.Job{ID: "d0c0ffee-0000-4000-8000-000000000000", Owner: keyOwner("alice")}
+		if app.visibleTo(keyOwner("alice"), job) {
+			t.Error("Expected a job outside of the prefix to be hidden")
+		}
+	})
+}
+
+func TestTenantIsolationOfGroupsAndUploads(t *testing.T) {
+	app, mockGCS, _ := setupTestApp(t)
+	app.TenantPrefix = "tenants/{tenant}/"
+	handler := app.Handler()
+	serve := func(method, target, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(apiKeyHeader, key)
+		req.Header.Set("Upload-Offset", "0")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	prefix := "tenants/" + keyOwner("alice") + "/"
+
+	rr := serve(http.MethodPost, "/groups", "alice", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected the group to be created, got %d: %s", rr.Code, rr.Body)
+	}
+	var group map[string]string
+	json.NewDecoder(rr.Body).Decode(&group)
+	groupID := group["group_id"]
+	if _, ok := mockGCS.GetObjectContent(prefix + "groups/" + groupID + "/group.json"); !ok {
+		t.Errorf("Expected the group under %s", prefix)
+	}
+
+	rr = serve(http.MethodPost, "/uploads", "alice", `{"operation":"compress","file_name":"big.txt"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected the upload to be created, got %d: %s", rr.Code, rr.Body)
+	}
+	var session uploadSession
+	json.NewDecoder(rr.Body).Decode(&session)
+	if _, ok := mockGCS.GetObjectContent(prefix + "uploads/" + session.ID + "/session.json"); !ok {
+		t.Errorf("Expected the upload session under %s", prefix)
+	}
+
+	testCases := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{name: "group status", method: http.MethodGet, target: "/groups/" + groupID},
+		{name: "join group", method: http.MethodPost, target: "/uploads", body: `{"operation":"compress","file_name":"a.txt","group_id":"` + groupID + `"}`},
+		{name: "upload status", method: http.MethodGet, target: "/uploads/" + session.ID},
+		{name: "upload chunk", method: http.MethodPatch, target: "/uploads/" + session.ID, body: "stolen"},
+		{name: "complete upload", method: http.MethodPost, target: "/uploads/" + session.ID + "/complete"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"bob", ""} {
+				if rr := serve(tc.method, tc.target, key, tc.body); rr.Code != http.StatusNotFound && rr.Code != http.StatusBadRequest {
+					t.Errorf("Expected %q to be turned away, got %d: %s", key, rr.Code, rr.Body)
+				}
+			}
+		})
+	}
+
+	if rr := serve(http.MethodGet, "/groups/"+groupID, "alice", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the owner to see the group, got %d: %s", rr.Code, rr.Body)
+	}
+	rr = serve(http.MethodGet, "/uploads/"+session.ID, "alice", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Upload-Offset") != "0" {
+		t.Errorf("Expected the owner to see the untouched upload, got %d: %s", rr.Code, rr.Body)
+	}
+}
@@ -0,0 +1,520 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// uploadSession is a resumable upload in progress. Every chunk is kept as its
+// own object, named after its offset, until the upload is completed and the
+// chunks are streamed into the job as one file. Sessions are only saved if
+// nobody else saved them since they were loaded.
+type uploadSession struct {
+	ID          string   `json:"id"`
+	Operation   string   `json:"operation"`
+	FileName    string   `json:"file_name"`
+	ContentType string   `json:"content_type,omitempty"`
+	Algorithm   string   `json:"algorithm,omitempty"`
+	Level       int      `json:"level,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	KMSKeyName  string   `json:"kms_key_name,omitempty"`
+	SHA256      string   `json:"sha256,omitempty"`
+	Verify      bool     `json:"verify,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	NotBefore   string   `json:"not_before,omitempty"`
+	GroupID     string   `json:"group_id,omitempty"`
+	Dictionary  string   `json:"dictionary,omitempty"`
+	Profile     string   `json:"profile,omitempty"`
+	Offset      int64    `json:"offset"`
+	Chunks      []string `json:"chunks"`
+	JobID       string   `json:"job_id,omitempty"`
+	// Completing is set while the job of the upload is being submitted.
+	Completing bool      `json:"completing,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// version is the object version the session was loaded at
+	version string
+}
+
+type createUploadRequest struct {
+	Operation   string `json:"operation"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Algorithm   string `json:"algorithm"`
+	Level       int    `json:"level"`
+	Format      string `json:"format"`
+	KMSKey      string `json:"kms_key"`
+	SHA256      string `json:"sha256"`
+	Verify      bool   `json:"verify"`
+	Priority    string `json:"priority"`
+	// NotBefore is an RFC 3339 time the job must not start before.
+	NotBefore string `json:"not_before"`
+	// GroupID is the group the job joins.
+	GroupID string `json:"group_id"`
+	// Dictionary is the ID of the dictionary to compress with.
+	Dictionary string `json:"dictionary"`
+	// Profile picks the algorithm and level instead, see Profile.
+	Profile string `json:"profile"`
+	// Size is the exact size of a direct upload, if the client knows it.
+	Size int64 `json:"size"`
+}
+
+// uploadSessionPath is where the upload id of owner is recorded, under the
+// prefix of owner.
+func (app *Application) uploadSessionPath(owner, id string) string {
+	return fmt.Sprintf("%suploads/%s/session.json", app.tenantPrefix(owner), id)
+}
+
+func (app *Application) uploadChunkPrefix(owner, id string) string {
+	return fmt.Sprintf("%suploads/%s/chunk-", app.tenantPrefix(owner), id)
+}
+
+// uploadChunkPath names the chunk at offset. Every attempt at a chunk gets its
+// own object, so neither a retry nor a concurrent request overwrites another.
+func (app *Application) uploadChunkPath(owner, id string, offset int64) string {
+	return fmt.Sprintf("%s%020d-%s", app.uploadChunkPrefix(owner, id), offset, uuid.NewString())
+}
+
+// saveUploadSession creates the session, or updates it if it is still at the
+// version it was loaded at. Otherwise it returns common.ErrVersionMismatch.
+func (app *Application) saveUploadSession(ctx context.Context, session *uploadSession) error {
+	session.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload session: %w", err)
+	}
+	condition := common.WithIfNotExists()
+	if session.version != "" {
+		condition = common.WithIfVersionMatch(session.version)
+	}
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, app.uploadSessionPath(session.Owner, session.ID), condition)
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write upload session: %w", err)
+	}
+	if err := wc.Close(); errors.Is(err, common.ErrObjectExists) {
+		return common.ErrVersionMismatch
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadUploadSession reads the upload id, which is only found for its owner.
+func (app *Application) loadUploadSession(ctx context.Context, owner, id string) (*uploadSession, error) {
+	// the version is read first, a later write makes saving fail either way
+	info, err := app.Storage.StatObject(ctx, app.Bucket, app.uploadSessionPath(owner, id))
+	if err != nil {
+		return nil, err
+	}
+	rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, app.uploadSessionPath(owner, id))
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var session uploadSession
+	if err := json.NewDecoder(rc).Decode(&session); err != nil {
+		return nil, fmt.Errorf("failed to decode upload session: %w", err)
+	}
+	if session.Owner != owner {
+		return nil, common.ErrObjectNotExist
+	}
+	session.version = info.Version
+	return &session, nil
+}
+
+// deleteUploadChunks removes every chunk of the upload, including those of
+// attempts that never made it into the session.
+func (app *Application) deleteUploadChunks(ctx context.Context, owner, id string) error {
+	objects, err := app.Storage.ListObjects(ctx, app.Bucket, app.uploadChunkPrefix(owner, id))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, object.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConcurrentUpdate tells the client another request changed the upload.
+func writeConcurrentUpdate(w http.ResponseWriter) {
+	common.WriteError(w, "Upload was changed by another request, check its status and retry", http.StatusConflict)
+}
+
+// lookupUploadSession resolves the {id} path value into an upload session of
+// the caller, writing the appropriate error response when it can't.
+func (app *Application) lookupUploadSession(w http.ResponseWriter, r *http.Request) (*uploadSession, bool) {
+	id := r.PathValue("id")
+	if _, err := uuid.Parse(id); err != nil {
+		common.WriteError(w, "Invalid upload ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	session, err := app.loadUploadSession(ctx, requestOwner(r), id)
+	if err != nil {
+		if errors.Is(err, common.ErrObjectNotExist) {
+			common.WriteError(w, "Upload not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("Failed to read upload session", "upload", id, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return session, true
+}
+
+func writeUploadSession(w http.ResponseWriter, session *uploadSession, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(session)
+}
+
+// createUploadHandler starts a resumable upload for a compression or
+// decompression job, validating the job parameters upfront.
+func (app *Application) createUploadHandler(w http.ResponseWriter, r *http.Request) {
+	var req createUploadRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		common.WriteError(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.FileName == "" {
+		common.WriteError(w, "file_name is required", http.StatusBadRequest)
+		return
+	}
+
+	session, errMsg := app.newUploadSession(r, req)
+	if errMsg != "" {
+		common.WriteError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+	if err := app.saveUploadSession(ctx, session); err != nil {
+		slog.Error("Failed to create upload session", "upload", session.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.Debug("Created upload session", "upload", session.ID, "file", session.FileName)
+
+	w.Header().Set("Location", apiVersion+"/uploads/"+session.ID)
+	writeUploadSession(w, session, http.StatusCreated)
+}
+
+// newUploadSession validates the job parameters of req and returns the
+// session of an upload for it. A non-empty message explains why they are
+// invalid.
+func (app *Application) newUploadSession(r *http.Request, req createUploadRequest) (*uploadSession, string) {
+	session := &uploadSession{
+		ID:         uuid.New().String(),
+		Operation:  req.Operation,
+		FileName:   req.FileName,
+		Owner:      requestOwner(r),
+		KMSKeyName: req.KMSKey,
+		Priority:   req.Priority,
+		NotBefore:  req.NotBefore,
+		GroupID:    req.GroupID,
+		Chunks:     []string{},
+		CreatedAt:  time.Now().UTC(),
+	}
+	if errMsg := validateKMSKey(req.KMSKey); errMsg != "" {
+		return nil, errMsg
+	}
+	if !common.ValidPriority(req.Priority) {
+		return nil, "Unsupported priority: " + req.Priority
+	}
+	if _, errMsg := parseNotBefore(req.NotBefore); errMsg != "" {
+		return nil, errMsg
+	}
+	if errMsg := app.checkGroup(r.Context(), req.GroupID, session.Owner); errMsg != "" {
+		return nil, errMsg
+	}
+	var errMsg string
+	if session.SHA256, errMsg = parseChecksum(req.SHA256); errMsg != "" {
+		return nil, errMsg
+	}
+	switch req.Operation {
+	case common.OperationCompress:
+		profile := app.requestProfile(req.Profile, req.Algorithm, req.Level, req.Format, req.FileName, contentTypeFor(req.FileName, req.ContentType))
+		algorithm, level, errMsg := app.applyProfile(profile, req.Algorithm, req.Level)
+		if errMsg != "" {
+			return nil, errMsg
+		}
+		if algorithm, errMsg = compressionAlgorithm(algorithm, req.Format); errMsg != "" {
+			return nil, errMsg
+		}
+		if errMsg := compressionLevel(algorithm, level); errMsg != "" {
+			return nil, errMsg
+		}
+		if errMsg := app.checkCodecOwner(algorithm, session.Owner); errMsg != "" {
+			return nil, errMsg
+		}
+		session.Algorithm = algorithm
+		session.Level = level
+		session.Profile = profile
+		if errMsg := app.checkDictionary(r.Context(), req.Dictionary, algorithm, session.Owner); errMsg != "" {
+			return nil, errMsg
+		}
+		session.Verify = req.Verify
+		session.Dictionary = req.Dictionary
+		session.ContentType = contentTypeFor(req.FileName, req.ContentType)
+	case common.OperationDecompress:
+		algorithm, ok := common.AlgorithmFromFileName(req.FileName)
+		if !ok {
+			return nil, "Wrong file format"
+		}
+		session.Algorithm = algorithm
+	default:
+		return nil, "Unsupported operation: " + req.Operation
+	}
+
+	return session, ""
+}
+
+// uploadStatusHandler tells a client where to resume an interrupted upload.
+func (app *Application) uploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.lookupUploadSession(w, r)
+	if !ok {
+		return
+	}
+	writeUploadSession(w, session, http.StatusOK)
+}
+
+// uploadChunkHandler appends the request body at the offset given in the
+// Upload-Offset header, which has to match what was received so far.
+func (app *Application) uploadChunkHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.lookupUploadSession(w, r)
+	if !ok {
+		return
+	}
+	if session.JobID != "" || session.Completing {
+		common.WriteError(w, "Upload is already complete", http.StatusConflict)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		common.WriteError(w, "Invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+	if offset != session.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		common.WriteError(w, fmt.Sprintf("Upload-Offset %d does not match the current offset %d", offset, session.Offset), http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, app.uploadLimits(session.Operation).MaxSize-session.Offset)
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.uploadLimits(session.Operation).Timeout)
+	defer cancel()
+
+	chunkPath := app.uploadChunkPath(session.Owner, session.ID, offset)
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, chunkPath, common.WithKMSKey(session.KMSKeyName), common.WithIfNotExists())
+	written, err := io.Copy(wc, r.Body)
+	if err != nil {
+		if common.Classify(err) == common.ErrTooLarge {
+			common.WriteError(w, "File exceeds size limit", common.StatusCode(err))
+			return
+		}
+		slog.Error("Failed to stream chunk to GCS", "upload", session.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := wc.Close(); err != nil {
+		slog.Error("Failed to close chunk stream to GCS", "upload", session.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if written == 0 {
+		writeUploadSession(w, session, http.StatusOK)
+		return
+	}
+
+	session.Chunks = append(session.Chunks, chunkPath)
+	session.Offset += written
+	if err := app.saveUploadSession(ctx, session); err != nil {
+		// the chunk never became part of the upload
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, chunkPath); err != nil {
+			slog.Warn("Failed to delete unused upload chunk", "upload", session.ID, "chunk", chunkPath, "error", err)
+		}
+		if errors.Is(err, common.ErrVersionMismatch) {
+			writeConcurrentUpdate(w)
+			return
+		}
+		slog.Error("Failed to update upload session", "upload", session.ID, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeUploadSession(w, session, http.StatusOK)
+}
+
+// submitUpload submits file as the job session was created for.
+func (app *Application) submitUpload(file io.Reader, session *uploadSession, requestID string) (string, error) {
+	// validated when the session was created
+	notBefore, _ := parseNotBefore(session.NotBefore)
+	if session.Operation == common.OperationCompress {
+		return app.submitCompress(file, compressParams{
+			FileName:    session.FileName,
+			ContentType: session.ContentType,
+			Algorithm:   session.Algorithm,
+			Level:       session.Level,
+			Owner:       session.Owner,
+			KMSKeyName:  session.KMSKeyName,
+			SHA256:      session.SHA256,
+			Verify:      session.Verify,
+			Priority:    session.Priority,
+			NotBefore:   notBefore,
+			BatchID:     session.GroupID,
+			Dictionary:  session.Dictionary,
+			Profile:     session.Profile,
+			RequestID:   requestID,
+		})
+	}
+	return app.submitDecompress(file, decompressParams{
+		FileName:   session.FileName,
+		Algorithm:  session.Algorithm,
+		Owner:      session.Owner,
+		KMSKeyName: session.KMSKeyName,
+		SHA256:     session.SHA256,
+		Priority:   session.Priority,
+		NotBefore:  notBefore,
+		GroupID:    session.GroupID,
+		RequestID:  requestID,
+	})
+}
+
+// completeUploadHandler streams the received chunks into a new job, the same
+// way a single request upload would, and removes them once it is submitted.
+// Completing twice returns the same job.
+func (app *Application) completeUploadHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.lookupUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	if session.JobID == "" {
+		if session.Completing {
+			common.WriteError(w, "Upload is already being completed", http.StatusConflict)
+			return
+		}
+		if session.Offset == 0 {
+			common.WriteError(w, "Upload is empty", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+		defer cancel()
+
+		// claim the upload so a concurrent request can't submit it as well
+		session.Completing = true
+		if err := app.saveUploadSession(ctx, session); err != nil {
+			if errors.Is(err, common.ErrVersionMismatch) {
+				writeConcurrentUpdate(w)
+				return
+			}
+			slog.Error("Failed to update upload session", "upload", session.ID, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		chunks := &chunkReader{ctx: ctx, app: app, chunks: session.Chunks}
+		defer chunks.Close()
+
+		jobID, err := app.submitUpload(chunks, session, common.RequestID(r.Context()))
+		// only this request may change the session while it is claimed
+		if err != nil {
+			app.releaseUploadSession(ctx, session.Owner, session.ID, "")
+			writeSubmitError(w, err)
+			return
+		}
+		app.releaseUploadSession(ctx, session.Owner, session.ID, jobID)
+		session.JobID = jobID
+
+		if err := app.deleteUploadChunks(ctx, session.Owner, session.ID); err != nil {
+			// the janitor removes them with the rest of the upload eventually
+			slog.Warn("Failed to delete chunks of completed upload", "upload", session.ID, "error", err)
+		}
+	}
+
+	logJobID(r, session.JobID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": session.JobID})
+}
+
+// releaseUploadSession ends the claim of completeUploadHandler, recording the
+// job it submitted, if any. Failing to do so is only logged since the job is
+// already enqueued, or the client has already been told it failed.
+func (app *Application) releaseUploadSession(ctx context.Context, owner, id, jobID string) {
+	session, err := app.loadUploadSession(ctx, owner, id)
+	if err == nil {
+		session.Completing = false
+		session.JobID = jobID
+		err = app.saveUploadSession(ctx, session)
+	}
+	if err != nil {
+		slog.Warn("Failed to release completed upload", "upload", id, "job", jobID, "error", err)
+	}
+}
+
+// chunkReader reads the chunks of an upload one after another, opening each
+// object only once the previous one is exhausted.
+type chunkReader struct {
+	ctx     context.Context
+	app     *Application
+	chunks  []string
+	current io.ReadCloser
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.current == nil {
+			if len(c.chunks) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := c.app.Storage.NewObjectReader(c.ctx, c.app.Bucket, c.chunks[0])
+			if err != nil {
+				return 0, fmt.Errorf("failed to open upload chunk %s: %w", c.chunks[0], err)
+			}
+			c.current = rc
+			c.chunks = c.chunks[1:]
+		}
+
+		n, err := c.current.Read(p)
+		if err == io.EOF {
+			c.current.Close()
+			c.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	return c.current.Close()
+}
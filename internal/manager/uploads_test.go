@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func createUpload(t *testing.T, app *Application, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.createUploadHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func sendChunk(t *testing.T, app *Application, id string, offset int, chunk string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPatch, "/uploads/"+id, strings.NewReader(chunk))
+	req.SetPathValue("id", id)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.uploadChunkHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func completeUpload(t *testing.T, app *Application, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/uploads/"+id+"/complete", nil)
+	req.SetPathValue("id", id)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.completeUploadHandler).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateUploadHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{name: "compress", body: `{"operation":"compress","file_name":"big.txt"}`, expectedStatus: http.StatusCreated},
+		{name: "decompress", body: `{"operation":"decompress","file_name":"big.txt.ranran"}`, expectedStatus: http.StatusCreated},
+		{name: "wrong decompress format", body: `{"operation":"decompress","file_name":"big.txt"}`, expectedStatus: http.StatusBadRequest},
+		{name: "unsupported algorithm", body: `{"operation":"compress","file_name":"big.txt","algorithm":"lzma"}`, expectedStatus: http.StatusBadRequest},
+		{name: "unsupported operation", body: `{"operation":"shred","file_name":"big.txt"}`, expectedStatus: http.StatusBadRequest},
+		{name: "missing file name", body: `{"operation":"compress"}`, expectedStatus: http.StatusBadRequest},
+		{name: "not json", body: `file=big.txt`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			rr := createUpload(t, app, tc.body)
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	app, mockGCS, mockPubSub := setupTestApp(t)
+
+	rr := createUpload(t, app, `{"operation":"compress","file_name":"big.txt","algorithm":"zstd"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create upload: %d %s", rr.Code, rr.Body.String())
+	}
+	var session uploadSession
+	if err := json.NewDecoder(rr.Body).Decode(&session); err != nil {
+		t.Fatalf("Failed to decode upload session: %v", err)
+	}
+
+	if rr := sendChunk(t, app, session.ID, 0, "hello "); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to send first chunk: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// resending from a stale offset is rejected with the offset to resume at
+	rr = sendChunk(t, app, session.ID, 0, "hello ")
+	if rr.Code != http.StatusConflict || rr.Header().Get("Upload-Offset") != "6" {
+		t.Errorf("Expected 409 with Upload-Offset 6, got %d with %q", rr.Code, rr.Header().Get("Upload-Offset"))
+	}
+
+	if rr := sendChunk(t, app, session.ID, 6, "resumable world"); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to send second chunk: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = completeUpload(t, app, session.ID)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Failed to complete upload: %d %s", rr.Code, rr.Body.String())
+	}
+	var response map[string]string
+	json.NewDecoder(rr.Body).Decode(&response)
+	jobID := response["job_id"]
+
+	content, ok := mockGCS.GetObjectContent(jobID + "/original_big.txt")
+	if !ok || content != "hello resumable world" {
+		t.Errorf("Expected the chunks to be assembled, got %q", content)
+	}
+	job, err := app.JobStore.GetJob(context.Background(), jobID)
+	if err != nil || job.Algorithm != common.AlgorithmZstd || job.Status != common.JobPending {
+		t.Errorf("Unexpected job record: %+v, %v", job, err)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 1 {
+		t.Errorf("Expected 1 message to be published, got %d", len(messages))
+	}
+	if chunks, _ := mockGCS.ListObjects(context.Background(), testBucket, app.uploadChunkPrefix(session.Owner, session.ID)); len(chunks) != 0 {
+		t.Errorf("Expected the chunks to be deleted, %d left", len(chunks))
+	}
+
+	// completing again doesn't enqueue another job
+	rr = completeUpload(t, app, session.ID)
+	json.NewDecoder(rr.Body).Decode(&response)
+	if rr.Code != http.StatusAccepted || response["job_id"] != jobID {
+		t.Errorf("Expected the same job back, got %d %v", rr.Code, response)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 1 {
+		t.Errorf("Expected still 1 message to be published, got %d", len(messages))
+	}
+	if rr := sendChunk(t, app, session.ID, 21, "more"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected chunks after completion to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestUploadSessionConflicts(t *testing.T) {
+	ctx := context.Background()
+	app, mockGCS, mockPubSub := setupTestApp(t)
+
+	rr := createUpload(t, app, `{"operation":"compress","file_name":"big.txt"}`)
+	var created uploadSession
+	json.NewDecoder(rr.Body).Decode(&created)
+	if rr := sendChunk(t, app, created.ID, 0, "hello"); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to send chunk: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// a session loaded before another request saved it can't be saved anymore
+	stale, err := app.loadUploadSession(ctx, created.Owner, created.ID)
+	if err != nil {
+		t.Fatalf("Failed to load upload session: %v", err)
+	}
+	if rr := sendChunk(t, app, created.ID, 5, " world"); rr.Code != http.StatusOK {
+		t.Fatalf("Failed to send chunk: %d %s", rr.Code, rr.Body.String())
+	}
+	stale.Offset = 0
+	if err := app.saveUploadSession(ctx, stale); !errors.Is(err, common.ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch saving a stale session, got %v", err)
+	}
+
+	// an upload claimed by a concurrent /complete is neither submitted again
+	// nor extended
+	claimed, _ := app.loadUploadSession(ctx, created.Owner, created.ID)
+	claimed.Completing = true
+	if err := app.saveUploadSession(ctx, claimed); err != nil {
+		t.Fatalf("Failed to claim upload session: %v", err)
+	}
+	if rr := completeUpload(t, app, created.ID); rr.Code != http.StatusConflict {
+		t.Errorf("Expected a concurrent complete to be rejected, got %d", rr.Code)
+	}
+	if rr := sendChunk(t, app, created.ID, 11, "!"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected chunks during completion to be rejected, got %d", rr.Code)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+		t.Errorf("Expected no message to be published, got %d", len(messages))
+	}
+	chunks, _ := mockGCS.ListObjects(ctx, testBucket, app.uploadChunkPrefix(created.Owner, created.ID))
+	if len(chunks) != 2 {
+		t.Errorf("Expected the 2 chunks to be kept, got %d", len(chunks))
+	}
+}
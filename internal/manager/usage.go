@@ -0,0 +1,292 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// apiKeyHeader identifies the client a request is accounted to. Requests
+// without one share the anonymous quota, unless API keys are configured.
+const (
+	apiKeyHeader   = "X-API-Key"
+	anonymousOwner = "anonymous"
+)
+
+// Quota limits what one owner can submit in a period, zero meaning no limit.
+type Quota struct {
+	Jobs  int64 `json:"jobs,omitempty"`
+	Bytes int64 `json:"bytes_uploaded,omitempty"`
+}
+
+// usage is what an owner submitted in a period. The counters are updated
+// without preconditions, so concurrent requests may undercount slightly.
+type usage struct {
+	Jobs  int64 `json:"jobs"`
+	Bytes int64 `json:"bytes_uploaded"`
+}
+
+// quotaExceededError rejects a job that would take its owner over quota in
+// period, which ends at resets.
+type quotaExceededError struct {
+	period string
+	resets time.Time
+}
+
+func (e *quotaExceededError) Error() string {
+	return "quota exceeded for " + e.period
+}
+
+// writeQuotaError tells the client when to come back.
+func writeQuotaError(w http.ResponseWriter, err *quotaExceededError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(err.resets).Seconds())+1))
+	common.WriteError(w, "Quota exceeded for "+err.period, http.StatusTooManyRequests)
+}
+
+// withAuth rejects requests without one of the configured API keys with 401.
+// With OIDC configured, a bearer token of the provider is accepted instead and
+// the request is accounted to its subject. Without either every request is
+// let through.
+func (app *Application) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && app.oidc != nil {
+			claims, err := app.oidc.Verify(r.Context(), token)
+			if errors.Is(err, common.ErrInvalidToken) {
+				slog.Info("Rejected bearer token", "error", err)
+				common.WriteError(w, "Invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				slog.Error("Failed to verify bearer token", "error", err)
+				common.WriteError(w, "Service unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ownerContextKey{}, subjectOwner(claims.Subject))))
+			return
+		}
+		if (len(app.APIKeys) > 0 || app.oidc != nil) && !app.APIKeys[r.Header.Get(apiKeyHeader)] {
+			common.WriteError(w, "Missing or invalid "+apiKeyHeader+" or bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseAPIKeys reads a comma-separated list of API keys.
+func parseAPIKeys(value string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// ownerContextKey holds the owner withAuth found for a request, when it
+// wasn't its API key, and the owner grpcAuth found for every call.
+type ownerContextKey struct{}
+
+// requestOwner is who a request is accounted to: a hash of its API key, so
+// that keys never end up in the bucket, or of the subject of its bearer token.
+func requestOwner(r *http.Request) string {
+	if owner, ok := r.Context().Value(ownerContextKey{}).(string); ok {
+		return owner
+	}
+	return keyOwner(r.Header.Get(apiKeyHeader))
+}
+
+// keyOwner is who requests with the API key are accounted to.
+func keyOwner(key string) string {
+	if key == "" {
+		return anonymousOwner
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// subjectOwner is who requests with a bearer token for subject are accounted
+// to. Header values can't hold a NUL, so no API key hashes the same.
+func subjectOwner(subject string) string {
+	return keyOwner("\x00oidc\x00" + subject)
+}
+
+func usagePath(owner, period string) string {
+	return fmt.Sprintf("usage/%s/%s.json", owner, period)
+}
+
+// usagePeriods names the day and month t falls in.
+func usagePeriods(t time.Time) (string, string) {
+	t = t.UTC()
+	return t.Format("2006-01-02"), t.Format("2006-01")
+}
+
+func (app *Application) loadUsage(ctx context.Context, owner, period string) (usage, error) {
+	var u usage
+	rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, usagePath(owner, period))
+	if err != nil {
+		if errors.Is(err, common.ErrObjectNotExist) {
+			return u, nil
+		}
+		return u, fmt.Errorf("failed to read usage: %w", err)
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(&u); err != nil {
+		return u, fmt.Errorf("failed to decode usage: %w", err)
+	}
+	return u, nil
+}
+
+func (app *Application) saveUsage(ctx context.Context, owner, period string, u usage) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage: %w", err)
+	}
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, usagePath(owner, period))
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write usage: %w", err)
+	}
+	return wc.Close()
+}
+
+// recordUsage accounts a submitted job of size bytes to owner, including the
+// bytes it keeps in the bucket. The job is already enqueued, so failures are
+// only logged.
+func (app *Application) recordUsage(ctx context.Context, owner string, size int64) {
+	if owner == "" {
+		return
+	}
+	if err := common.AddStoredBytes(ctx, app.Storage, app.Bucket, owner, size); err != nil {
+		slog.Warn("Failed to record stored bytes", "owner", owner, "error", err)
+	}
+	daily, monthly := usagePeriods(time.Now())
+	for _, period := range []string{daily, monthly} {
+		u, err := app.loadUsage(ctx, owner, period)
+		if err == nil {
+			u.Jobs++
+			u.Bytes += size
+			err = app.saveUsage(ctx, owner, period, u)
+		}
+		if err != nil {
+			slog.Warn("Failed to record usage", "owner", owner, "period", period, "error", err)
+		}
+	}
+}
+
+// exceeds reports whether submitting another job of size bytes goes over q.
+func (q Quota) exceeds(u usage, size int64) bool {
+	return (q.Jobs > 0 && u.Jobs >= q.Jobs) || (q.Bytes > 0 && u.Bytes+size > q.Bytes)
+}
+
+// checkQuota returns a *quotaExceededError if another job of size bytes takes
+// owner over their daily or monthly quota.
+func (app *Application) checkQuota(ctx context.Context, owner string, size int64) error {
+	now := time.Now().UTC()
+	daily, monthly := usagePeriods(now)
+	checks := []struct {
+		period string
+		quota  Quota
+		resets time.Time
+	}{
+		{daily, app.DailyQuota, time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)},
+		{monthly, app.MonthlyQuota, time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, check := range checks {
+		if check.quota == (Quota{}) {
+			continue
+		}
+		u, err := app.loadUsage(ctx, owner, check.period)
+		if err != nil {
+			return err
+		}
+		if check.quota.exceeds(u, size) {
+			return &quotaExceededError{period: check.period, resets: check.resets}
+		}
+	}
+	return nil
+}
+
+// withQuota rejects requests from owners that already used up their daily or
+// monthly quota with 429. Every job is checked again with its actual size
+// when it is submitted.
+func (app *Application) withQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+		defer cancel()
+
+		owner := requestOwner(r)
+		var quotaErr *quotaExceededError
+		if err := app.checkQuota(ctx, owner, 0); errors.As(err, &quotaErr) {
+			writeQuotaError(w, quotaErr)
+			return
+		} else if err != nil {
+			slog.Error("Failed to check quota", "owner", owner, "error", err)
+			common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// enforceQuota checks the quota of owner once the size of a job is known,
+// removing the object already uploaded for it when it is over.
+func (app *Application) enforceQuota(ctx context.Context, jobID, owner, object string, size int64) error {
+	err := app.checkQuota(ctx, owner, size)
+	if err == nil {
+		return nil
+	}
+	slog.Info("Rejected job over quota", "job", jobID, "owner", owner, "error", err)
+	if err := app.Storage.DeleteObject(ctx, app.Bucket, object); err != nil {
+		slog.Warn("Failed to remove upload over quota", "job", jobID, "object", object, "error", err)
+	}
+	return err
+}
+
+// usageHandler reports what the caller submitted today and this month
+// against their quotas, and how much of the bucket their jobs take up.
+func (app *Application) usageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), app.GCSTimeout)
+	defer cancel()
+
+	owner := requestOwner(r)
+	daily, monthly := usagePeriods(time.Now())
+	dailyUsage, err := app.loadUsage(ctx, owner, daily)
+	if err != nil {
+		slog.Error("Failed to load usage", "owner", owner, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	monthlyUsage, err := app.loadUsage(ctx, owner, monthly)
+	if err != nil {
+		slog.Error("Failed to load usage", "owner", owner, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	stored, err := common.StoredBytes(ctx, app.Storage, app.Bucket, owner)
+	if err != nil {
+		slog.Error("Failed to load stored bytes", "owner", owner, "error", err)
+		common.WriteError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"daily":         map[string]any{"period": daily, "usage": dailyUsage, "quota": app.DailyQuota},
+		"monthly":       map[string]any{"period": monthly, "usage": monthlyUsage, "quota": app.MonthlyQuota},
+		"storage_bytes": stored,
+		"owner":         owner,
+	})
+}
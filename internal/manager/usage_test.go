@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestQuota(t *testing.T) {
+	testCases := []struct {
+		name             string
+		quota            Quota
+		keys             []string
+		expectedStatuses []int
+	}{
+		{
+			name:             "no quota",
+			keys:             []string{"a", "a", "a"},
+			expectedStatuses: []int{http.StatusAccepted, http.StatusAccepted, http.StatusAccepted},
+		},
+		{
+			name:             "jobs exceeded",
+			quota:            Quota{Jobs: 1},
+			keys:             []string{"a", "a"},
+			expectedStatuses: []int{http.StatusAccepted, http.StatusTooManyRequests},
+		},
+		{
+			name:             "keys accounted separately",
+			quota:            Quota{Jobs: 1},
+			keys:             []string{"a", "b", "", "a"},
+			expectedStatuses: []int{http.StatusAccepted, http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests},
+		},
+		{
+			name:             "bytes exceeded",
+			quota:            Quota{Bytes: 1},
+			keys:             []string{"a"},
+			expectedStatuses: []int{http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.MonthlyQuota = tc.quota
+			handler := app.withQuota(http.HandlerFunc(app.compressHandler))
+
+			for i, key := range tc.keys {
+				req := createTestMultipartRequest(t, "file", "test.txt", "hello world")
+				if key != "" {
+					req.Header.Set(apiKeyHeader, key)
+				}
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				if rr.Code != tc.expectedStatuses[i] {
+					t.Fatalf("request %d returned wrong status code: got %v want %v (%s)", i, rr.Code, tc.expectedStatuses[i], rr.Body.String())
+				}
+				if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d is missing Retry-After", i)
+				}
+			}
+		})
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	app, _, _ := setupTestApp(t)
+	app.DailyQuota = Quota{Jobs: 10}
+
+	for _, key := range []string{"a", "a", "b"} {
+		req := createTestMultipartRequest(t, "file", "test.txt", "hello world")
+		req.Header.Set(apiKeyHeader, key)
+		rr := httptest.NewRecorder()
+		app.withQuota(http.HandlerFunc(app.compressHandler)).ServeHTTP(rr, req)
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("compress returned wrong status code: got %v (%s)", rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/usage", nil)
+	req.Header.Set(apiKeyHeader, "a")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(app.usageHandler).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response struct {
+		Daily struct {
+			Usage usage `json:"usage"`
+			Quota Quota `json:"quota"`
+		} `json:"daily"`
+		Monthly struct {
+			Usage usage `json:"usage"`
+		} `json:"monthly"`
+		StorageBytes int64 `json:"storage_bytes"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	want := usage{Jobs: 2, Bytes: 2 * int64(len("hello world"))}
+	if response.Daily.Usage != want || response.Monthly.Usage != want {
+		t.Errorf("Unexpected usage: %+v", response)
+	}
+	if response.Daily.Quota.Jobs != 10 {
+		t.Errorf("Unexpected daily quota: %+v", response.Daily.Quota)
+	}
+	if response.StorageBytes != want.Bytes {
+		t.Errorf("Expected %d stored bytes, got %d", want.Bytes, response.StorageBytes)
+	}
+}
+
+func TestQuotaPerJob(t *testing.T) {
+	const content = "uploaded directly"
+
+	t.Run("batch counts every file", func(t *testing.T) {
+		app, _, _ := setupTestApp(t)
+		app.MaxBatchFiles = 3
+		app.DailyQuota = Quota{Jobs: 2}
+		rr := httptest.NewRecorder()
+		app.withQuota(http.HandlerFunc(app.batchCompressHandler)).ServeHTTP(rr, createBatchRequest(t, []string{"a.txt", "b.txt", "c.txt"}, nil))
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("handler returned wrong status code: got %v want %v (%s)", rr.Code, http.StatusAccepted, rr.Body.String())
+		}
+		var response struct {
+			Jobs []batchEntry `json:"jobs"`
+		}
+		json.NewDecoder(rr.Body).Decode(&response)
+		if len(response.Jobs) != 3 || response.Jobs[1].Error != "" || !strings.HasPrefix(response.Jobs[2].Error, "Quota exceeded") {
+			t.Errorf("Expected only the third file to be over quota: %+v", response.Jobs)
+		}
+	})
+
+	t.Run("resumable upload counts the assembled size", func(t *testing.T) {
+		app, _, mockPubSub := setupTestApp(t)
+		app.DailyQuota = Quota{Bytes: 5}
+		rr := createUpload(t, app, `{"operation":"compress","file_name":"big.txt"}`)
+		var session uploadSession
+		json.NewDecoder(rr.Body).Decode(&session)
+		sendChunk(t, app, session.ID, 0, content)
+
+		if rr := completeUpload(t, app, session.ID); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the upload to be over quota, got %d", rr.Code)
+		}
+		if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+			t.Errorf("Expected no message to be published, got %d", len(messages))
+		}
+	})
+
+	t.Run("direct upload counts the uploaded size", func(t *testing.T) {
+		app, mockGCS, _ := setupTestApp(t)
+		app.DailyQuota = Quota{Bytes: 5}
+		rr := createDirectJob(t, app, `{"operation":"compress","file_name":"big.txt"}`)
+		var response map[string]any
+		json.NewDecoder(rr.Body).Decode(&response)
+		jobID, _ := response["job_id"].(string)
+		wc := mockGCS.NewObjectWriter(context.Background(), testBucket, jobID+"/original_big.txt")
+		wc.Write([]byte(content))
+		wc.Close()
+
+		if rr := submitJob(t, app, jobID); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected the upload to be over quota, got %d", rr.Code)
+		}
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil || job.Status != common.JobAwaitingUpload {
+			t.Errorf("Unexpected job record: %+v, %v", job, err)
+		}
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	testCases := []struct {
+		name           string
+		path           string
+		key            string
+		expectedStatus int
+	}{
+		{name: "valid key", path: "/usage", key: "secret", expectedStatus: http.StatusOK},
+		{name: "unknown key", path: "/usage", key: "guess", expectedStatus: http.StatusUnauthorized},
+		{name: "no key", path: "/usage", expectedStatus: http.StatusUnauthorized},
+		{name: "probes need no key", path: "/healthz", expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, _, _ := setupTestApp(t)
+			app.APIKeys = parseAPIKeys(" secret, other ")
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.key != "" {
+				req.Header.Set(apiKeyHeader, tc.key)
+			}
+			rr := httptest.NewRecorder()
+			app.Handler().ServeHTTP(rr, req)
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// An append job grows one joined container a segment at a time. Every
+// segment is compressed as a part by whichever worker gets its message, like
+// the parts of a split job, and its original removed. The parts are then
+// appended in order by whichever worker finds the next one recorded, so a
+// segment that arrives before the one it follows is appended along with it.
+
+// errSegmentAppended stops appending a segment another worker appended first.
+var errSegmentAppended = errors.New("segment is already appended")
+
+// appendResultPath is where the result of an append job is written once it
+// holds segment, a new object for every segment.
+func appendResultPath(dir string, segment int, algorithm string) string {
+	return fmt.Sprintf("%s/compressed_%05d%s", dir, segment, common.AlgorithmExtension(algorithm))
+}
+
+// appendMessageHandler handles the message of a segment of an append job,
+// see common.CompressedMsgSchema.
+func (app *Application) appendMessageHandler(msg common.MessageInterface, job common.CompressedMsgSchema) {
+	slog.Info("Received job segment", "job", job.UID, "request_id", requestID(msg), "segment", job.Segment)
+	segment := fmt.Sprintf("segment %d", job.Segment)
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventDequeued, Reason: segment})
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.ProcessingTimeout)
+	defer cancel()
+
+	record, err := app.JobStore.GetJob(ctx, job.UID)
+	if err != nil {
+		app.failJob(msg, job.UID, "Failed to read job record", err)
+		return
+	}
+	if record.Status != common.JobOpen || record.Appended >= job.Segment {
+		slog.Info("Segment is already appended or the job finished, skipping delivery", "job", job.UID, "segment", job.Segment)
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: segment + " skipped"})
+		jobsProcessed.WithLabelValues(common.OperationCompress, "skipped").Inc()
+		msg.Ack()
+		return
+	}
+
+	dir := jobDir(job.OriginalFilePath)
+	if _, err := app.Storage.StatObject(ctx, app.Bucket, partRecordPath(dir, job.Segment)); errors.Is(err, common.ErrObjectNotExist) {
+		info, err := app.Storage.StatObject(ctx, app.Bucket, job.OriginalFilePath)
+		if err != nil {
+			app.failJob(msg, job.UID, "Failed to locate segment", err)
+			return
+		}
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventStarted, Reason: segment})
+		part := job
+		part.Part, part.Offset, part.Length = job.Segment, 0, info.Size
+		if !app.compressPart(ctx, msg, part) {
+			return
+		}
+		// the part is all that is needed of the segment from now on
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, job.OriginalFilePath); err != nil {
+			slog.Warn("Failed to remove compressed segment", "job", job.UID, "segment", job.Segment, "error", err)
+		}
+	} else if err != nil {
+		app.failJob(msg, job.UID, "Failed to check for compressed segment", err)
+		return
+	} else {
+		// an earlier delivery got as far as recording the segment
+		slog.Info("Segment is already compressed", "job", job.UID, "segment", job.Segment)
+	}
+
+	if err := app.appendSegments(ctx, job); err != nil {
+		app.failJob(msg, job.UID, "Failed to append segment", err)
+		return
+	}
+	msg.Ack()
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: segment})
+	slog.Info("Completed processing job segment", "job", job.UID, "segment", job.Segment)
+}
+
+// resultHeader reads the container header of the result at object.
+func (app *Application) resultHeader(ctx context.Context, object string) (*compression.ContainerHeader, error) {
+	rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return compression.ReadContainerHeader(rc)
+}
+
+// appendSegments appends the compressed segments of the job that follow the
+// last one appended, for as long as the next one is recorded.
+func (app *Application) appendSegments(ctx context.Context, job common.CompressedMsgSchema) error {
+	dir := jobDir(job.OriginalFilePath)
+	for {
+		record, err := app.JobStore.GetJob(ctx, job.UID)
+		if err != nil {
+			return err
+		}
+		if record.Status != common.JobOpen {
+			return nil
+		}
+		records, err := app.partRecords(ctx, dir)
+		if err != nil {
+			return err
+		}
+		segment := record.Appended + 1
+		part, ok := records[segment]
+		if !ok {
+			return nil
+		}
+		if err := app.appendSegment(ctx, job, record, segment, part); err != nil && !errors.Is(err, errSegmentAppended) {
+			return err
+		}
+	}
+}
+
+// appendSegment writes the result of the job with segment appended to the
+// one recorded, and records it instead.
+func (app *Application) appendSegment(ctx context.Context, job common.CompressedMsgSchema, record *common.Job, segment int, part compression.ContainerPart) error {
+	start := time.Now()
+	dir := jobDir(job.OriginalFilePath)
+	algorithm := job.Algorithm
+	if algorithm == "" {
+		algorithm = common.AlgorithmHuffman
+	}
+	openSegment := func() (io.ReadCloser, error) {
+		return app.Storage.NewObjectReader(ctx, app.Bucket, partOutputPath(dir, segment))
+	}
+
+	resultPath := appendResultPath(dir, segment, job.Algorithm)
+	digest := sha256.New()
+	out, err := app.streamToStorage(ctx, resultPath, func(w io.Writer) error {
+		w = io.MultiWriter(w, digest)
+		if record.ResultPath == "" {
+			meta := compression.ContainerMetadata{Name: job.FileName, ContentType: job.ContentType, Dictionary: job.Dictionary}
+			return compression.JoinContainer(w, algorithm, []compression.ContainerPart{part}, meta, func(int) (io.ReadCloser, error) {
+				return openSegment()
+			})
+		}
+		previous, err := app.Storage.NewObjectReader(ctx, app.Bucket, record.ResultPath)
+		if err != nil {
+			return err
+		}
+		defer previous.Close()
+		rc, err := openSegment()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return compression.AppendContainer(w, previous, part, rc)
+	}, common.WithKMSKey(job.KMSKeyName))
+	manifest := common.Manifest{
+		JobID:       job.UID,
+		Operation:   common.OperationCompress,
+		FileName:    job.FileName,
+		ContentType: job.ContentType,
+		Algorithm:   algorithm,
+		Level:       job.Level,
+		Result:      resultPath,
+		OutputSize:  out,
+		StartedAt:   start.UTC(),
+	}
+	if errors.Is(err, common.ErrObjectExists) {
+		// an earlier delivery got as far as uploading the result
+		slog.Info("Appended segment is already in storage", "job", job.UID, "segment", segment)
+	} else if err != nil {
+		return err
+	} else {
+		manifest.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	}
+	// the manifest lists every segment, which only the new header has
+	if header, err := app.resultHeader(ctx, resultPath); err != nil {
+		slog.Warn("Failed to read appended result for its manifest", "job", job.UID, "error", err)
+	} else {
+		manifest.Chunks = manifestChunks(header.Metadata.Parts)
+		for _, chunk := range manifest.Chunks {
+			manifest.InputSize += chunk.Size
+		}
+	}
+	manifest = app.writeManifest(ctx, app.Bucket, manifest, common.WithKMSKey(job.KMSKeyName))
+
+	var done bool
+	updated, err := app.JobStore.UpdateJob(ctx, job.UID, func(j *common.Job) error {
+		if j.Status != common.JobOpen || j.Appended != segment-1 {
+			return errSegmentAppended
+		}
+		j.Appended = segment
+		j.ResultPath = resultPath
+		j.OutputSize = manifest.OutputSize
+		j.Error = ""
+		// closed jobs are done once the last of their segments is in
+		if j.Closed && j.Appended == j.Segments {
+			j.Status = common.JobDone
+			done = true
+			app.queueJobEvent(j)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	app.publishJobEvents(ctx, updated)
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventUploaded, Reason: fmt.Sprintf("segment %d", segment)})
+	observeJob(common.OperationCompress, start, part.Size, out)
+	slog.Info("Appended segment", "job", job.UID, "segment", segment, "done", done)
+
+	// the previous result and the part are of no use anymore
+	objects := []string{partOutputPath(dir, segment), partRecordPath(dir, segment)}
+	if record.ResultPath != "" {
+		objects = append(objects, record.ResultPath, common.ManifestPath(record.ResultPath))
+	}
+	for _, object := range objects {
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, object); err != nil {
+			slog.Warn("Failed to remove appended object", "job", job.UID, "object", object, "error", err)
+		}
+	}
+	return nil
+}
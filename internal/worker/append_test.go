@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestAppendJob(t *testing.T) {
+	segments := []string{
+		strings.Repeat("first batch of log lines\n", 50),
+		strings.Repeat("second batch of log lines\n", 30),
+		"third batch\n",
+	}
+
+	testCases := []struct {
+		name  string
+		order []int
+	}{
+		{name: "in order", order: []int{1, 2, 3}},
+		{name: "out of order", order: []int{3, 1, 2}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+				ID:        jobID,
+				Operation: common.OperationCompress,
+				Status:    common.JobOpen,
+				Algorithm: common.AlgorithmZstd,
+				FileName:  "app.log",
+				Append:    true,
+				Segments:  len(segments),
+				Closed:    true,
+			}); err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
+
+			for i, segment := range tc.order {
+				job := common.CompressedMsgSchema{
+					UID:              jobID,
+					OriginalFilePath: fmt.Sprintf("%s/segment_%d", jobID, segment),
+					Algorithm:        common.AlgorithmZstd,
+					FileName:         "app.log",
+					Segment:          segment,
+				}
+				mockGCS.SetObject(job.OriginalFilePath, []byte(segments[segment-1]))
+				data, _ := json.Marshal(job)
+				msg := &mockMessage{data: data}
+				app.compressMessageHandler(context.Background(), msg)
+				if !msg.ackCalled || msg.nackCalled {
+					t.Fatalf("Expected segment %d to be acked, got ack=%v nack=%v", segment, msg.ackCalled, msg.nackCalled)
+				}
+				if _, ok := mockGCS.GetObjectContent(job.OriginalFilePath); ok {
+					t.Errorf("Expected segment %d to be removed once compressed", segment)
+				}
+
+				record, _ := app.JobStore.GetJob(context.Background(), jobID)
+				if done := i == len(tc.order)-1; (record.Status == common.JobDone) != done {
+					t.Errorf("Expected the job to be DONE only after the last segment, got %s after segment %d", record.Status, segment)
+				}
+			}
+
+			record, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || record.Appended != len(segments) {
+				t.Fatalf("Expected %d segments to be appended, got %+v, %v", len(segments), record, err)
+			}
+			result, ok := mockGCS.GetObjectContent(record.ResultPath)
+			if !ok {
+				t.Fatalf("Expected result %q to exist", record.ResultPath)
+			}
+			var out bytes.Buffer
+			header, err := compression.ReadContainer(bytes.NewReader(result), &out, app.lookupCodec)
+			if err != nil {
+				t.Fatalf("Failed to read result: %v", err)
+			}
+			if out.String() != strings.Join(segments, "") || len(header.Metadata.Parts) != len(segments) || header.Metadata.Name != "app.log" {
+				t.Errorf("Unexpected result: %+v with %d bytes", header, out.Len())
+			}
+			objects, _ := mockGCS.ListObjects(context.Background(), testBucket, jobID+"/")
+			if len(objects) != 2 {
+				t.Errorf("Expected only the result and its manifest to be left, got %d objects", len(objects))
+			}
+			var manifest common.Manifest
+			data, _ := mockGCS.GetObjectContent(common.ManifestPath(record.ResultPath))
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatalf("Failed to read manifest: %v", err)
+			}
+			if len(manifest.Chunks) != len(segments) || manifest.InputSize != int64(out.Len()) || manifest.OutputSize != int64(len(result)) {
+				t.Errorf("Unexpected manifest: %+v", manifest)
+			}
+		})
+	}
+
+	t.Run("redelivered segment", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		jobID := uuid.New().String()
+		app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Status: common.JobOpen, Append: true, Segments: 2, Appended: 1})
+		job := common.CompressedMsgSchema{UID: jobID, OriginalFilePath: jobID + "/segment_1", Algorithm: common.AlgorithmZstd, Segment: 1}
+		data, _ := json.Marshal(job)
+		msg := &mockMessage{data: data}
+		app.compressMessageHandler(context.Background(), msg)
+		if !msg.ackCalled {
+			t.Fatal("Expected an appended segment to be acked")
+		}
+		if objects, _ := mockGCS.ListObjects(context.Background(), testBucket, jobID+"/"); len(objects) != 0 {
+			t.Errorf("Expected nothing to be written, got %d objects", len(objects))
+		}
+	})
+}
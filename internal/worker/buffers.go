@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// bufferSize is the size of every chunk a job is read, encoded and written
+// in. Jobs only ever hold a few of them, so a worker's memory stays flat
+// however large its inputs are.
+const bufferSize = 64 * 1024
+
+// The buffers are pooled so that jobs don't allocate new ones each time.
+var (
+	readerPool = sync.Pool{New: func() any { return bufio.NewReaderSize(nil, bufferSize) }}
+	writerPool = sync.Pool{New: func() any { return bufio.NewWriterSize(nil, bufferSize) }}
+	chunkPool  = sync.Pool{New: func() any { b := make([]byte, bufferSize); return &b }}
+)
+
+// getReader returns a pooled reader buffering r, to be given back with
+// putReader once nothing reads from it anymore.
+func getReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+func putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
+
+// getWriter returns a pooled writer buffering w, to be given back with
+// putWriter after it was flushed.
+func getWriter(w io.Writer) *bufio.Writer {
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+	return bw
+}
+
+func putWriter(bw *bufio.Writer) {
+	bw.Reset(nil)
+	writerPool.Put(bw)
+}
+
+// copyChunks is io.Copy with a pooled chunk instead of a new buffer.
+func copyChunks(dst io.Writer, src io.Reader) (int64, error) {
+	chunk := chunkPool.Get().(*[]byte)
+	defer chunkPool.Put(chunk)
+	return io.CopyBuffer(dst, src, *chunk)
+}
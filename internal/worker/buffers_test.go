@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// allocatedBytes reports how many bytes f allocates.
+func allocatedBytes(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// TestHuffmanMemoryIsBounded checks that the memory a job takes doesn't
+// grow with its input, since it is streamed through pooled chunks.
+func TestHuffmanMemoryIsBounded(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector empties the pools at random")
+	}
+	roundTrip := func(n int) func() {
+		original := strings.Repeat("bounded memory huffman pipeline\n", n)
+		freqTable, err := buildFreqTable(strings.NewReader(original))
+		if err != nil {
+			t.Fatalf("Failed to build frequency table: %v", err)
+		}
+		pq, pt, err := buildHuffmanTree(freqTable)
+		if err != nil {
+			t.Fatalf("Failed to build Huffman tree: %v", err)
+		}
+		codec := huffmanCodec{root: pq[0], pt: pt}
+		return func() {
+			pr, pw := io.Pipe()
+			go func() { pw.CloseWithError(codec.Compress(strings.NewReader(original), pw)) }()
+			if err := codec.Decompress(pr, io.Discard); err != nil {
+				t.Errorf("Failed to round trip: %v", err)
+			}
+		}
+	}
+
+	// warm up the pools
+	roundTrip(1)()
+	small := allocatedBytes(roundTrip(1 << 10))
+	large := allocatedBytes(roundTrip(1 << 16))
+	if large > 2*small+bufferSize {
+		t.Errorf("Expected memory to stay flat, %d bytes for a small input and %d for a 64 times larger one", small, large)
+	}
+}
+
+func TestCopyChunks(t *testing.T) {
+	data := bytes.Repeat([]byte("chunk"), bufferSize)
+	var dst bytes.Buffer
+	n, err := copyChunks(&dst, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to copy: %v", err)
+	}
+	if n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+		t.Errorf("Expected %d bytes copied, got %d", len(data), n)
+	}
+}
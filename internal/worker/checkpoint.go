@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// A checkpointed job is compressed by one worker a chunk of CheckpointSize
+// bytes at a time, each chunk recorded like a part of a split job once it is
+// done, and the chunks joined into one container at the end. A delivery of
+// a job whose worker was preempted resumes after the last chunk recorded.
+
+// checkpointChunks returns how many chunks the original of job, size bytes
+// long, is compressed in, or 0 to compress it at once. Only jobs whose parts
+// can be joined by joinParts qualify.
+func (app *Application) checkpointChunks(job common.CompressedMsgSchema, size int64) int {
+	if app.CheckpointSize <= 0 || size <= app.CheckpointSize {
+		return 0
+	}
+	if !common.UsesContainer(job.Algorithm) || job.Archive || job.Verify ||
+		job.SourceBucket != "" || job.ResultBucket != "" || job.ResultPath != "" {
+		return 0
+	}
+	return int((size + app.CheckpointSize - 1) / app.CheckpointSize)
+}
+
+// compressCheckpointed compresses the original of job, size bytes long, in
+// chunks, skipping those an earlier delivery recorded.
+func (app *Application) compressCheckpointed(ctx context.Context, msg common.MessageInterface, job common.CompressedMsgSchema, size int64, chunks int, stored bool) {
+	dir := jobDir(job.OriginalFilePath)
+	records, err := app.partRecords(ctx, dir)
+	if err != nil {
+		app.failJob(msg, job.UID, "Failed to list checkpoints", err)
+		return
+	}
+	// chunks of another size, with CheckpointSize changed since, don't fit
+	for part, record := range records {
+		if _, length := common.PartRange(size, chunks, part); part > chunks || record.Size != length {
+			slog.Warn("Checkpoints don't match the job, starting over", "job", job.UID)
+			if err := app.deletePrefix(ctx, dir+"/parts/"); err != nil {
+				app.failJob(msg, job.UID, "Failed to remove checkpoints", err)
+				return
+			}
+			clear(records)
+			break
+		}
+	}
+	if len(records) > 0 {
+		slog.Info("Resuming job from checkpoint", "job", job.UID, "chunks", chunks, "done", len(records))
+	}
+
+	job.Parts = chunks
+	for part := 1; part <= chunks; part++ {
+		if _, ok := records[part]; ok {
+			continue
+		}
+		// the client may cancel a long job in between
+		if app.alreadyDone(job.UID) {
+			slog.Info("Job was canceled, stopping at checkpoint", "job", job.UID, "chunk", part)
+			app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: "canceled"})
+			msg.Ack()
+			return
+		}
+		chunk := job
+		chunk.Part = part
+		chunk.Offset, chunk.Length = common.PartRange(size, chunks, part)
+		if !app.compressPart(ctx, msg, chunk) {
+			return
+		}
+		slog.Debug("Recorded checkpoint", "job", job.UID, "chunk", part, "chunks", chunks)
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventCheckpoint, Reason: fmt.Sprintf("chunk %d of %d", part, chunks)})
+		if app.ProgressInterval > 0 {
+			app.reportProgress(job.UID, common.OperationCompress, common.NewJobProgress(chunk.Offset+chunk.Length, size))
+		}
+	}
+
+	if records, err = app.partRecords(ctx, dir); err != nil {
+		app.failJob(msg, job.UID, "Failed to list checkpoints", err)
+		return
+	}
+	if len(records) != chunks {
+		app.failJob(msg, job.UID, "Failed to list checkpoints", fmt.Errorf("found %d of %d chunks", len(records), chunks))
+		return
+	}
+	app.joinParts(ctx, msg, job, records, stored)
+}
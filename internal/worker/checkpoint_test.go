@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// rangeReads records the offsets of the ranges read from the bucket.
+type rangeReads struct {
+	*mockGCSClient
+	mu      sync.Mutex
+	offsets []int64
+}
+
+func (s *rangeReads) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (common.ObjectReaderInterface, error) {
+	s.mu.Lock()
+	s.offsets = append(s.offsets, offset)
+	s.mu.Unlock()
+	return s.mockGCSClient.NewRangeReader(ctx, bucket, object, offset, length)
+}
+
+func TestCheckpointedJob(t *testing.T) {
+	original := strings.Repeat("preempted workers resume from the last chunk\n", 300)
+	size := int64(len(original))
+
+	testCases := []struct {
+		name string
+		// seed records chunks of the job as an earlier delivery would have
+		seed func(t *testing.T, app *Application, job common.CompressedMsgSchema)
+		// read are the chunks expected to be compressed by this delivery
+		read []int
+	}{
+		{
+			name: "from the start",
+			read: []int{1, 2, 3},
+		},
+		{
+			name: "resumes after recorded chunks",
+			seed: func(t *testing.T, app *Application, job common.CompressedMsgSchema) {
+				for _, part := range []int{1, 2} {
+					if !app.compressPart(context.Background(), &mockMessage{}, partMessage(job, size, part)) {
+						t.Fatalf("Failed to compress chunk %d", part)
+					}
+				}
+			},
+			read: []int{3},
+		},
+		{
+			name: "starts over with chunks of another size",
+			seed: func(t *testing.T, app *Application, job common.CompressedMsgSchema) {
+				job.Parts = 2
+				if !app.compressPart(context.Background(), &mockMessage{}, partMessage(job, size, 1)) {
+					t.Fatal("Failed to compress chunk")
+				}
+			},
+			read: []int{1, 2, 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			storage := &rangeReads{mockGCSClient: mockGCS}
+			app.Storage = storage
+			app.CheckpointSize = size/3 + 1
+			job := setupSplitJob(t, app, mockGCS, common.AlgorithmZstd, original, 0)
+			if tc.seed != nil {
+				seeded := job
+				seeded.Parts = 3
+				tc.seed(t, app, seeded)
+				storage.offsets = nil
+			}
+
+			data, _ := json.Marshal(job)
+			msg := &mockMessage{data: data}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled || msg.nackCalled {
+				t.Fatalf("Expected message to be acked, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+			}
+
+			var read []int
+			for _, offset := range storage.offsets {
+				for part := 1; part <= 3; part++ {
+					if o, _ := common.PartRange(size, 3, part); o == offset && !slices.Contains(read, part) {
+						read = append(read, part)
+					}
+				}
+			}
+			if fmt.Sprint(read) != fmt.Sprint(tc.read) {
+				t.Errorf("Expected chunks %v to be compressed, got %v", tc.read, read)
+			}
+
+			record, err := app.JobStore.GetJob(context.Background(), job.UID)
+			if err != nil || record.Status != common.JobDone {
+				t.Fatalf("Expected job to be DONE, got %+v, %v", record, err)
+			}
+			result, ok := mockGCS.GetObjectContent(record.ResultPath)
+			if !ok {
+				t.Fatalf("Expected result %q to exist", record.ResultPath)
+			}
+			var out bytes.Buffer
+			header, err := compression.ReadContainer(bytes.NewReader(result), &out, app.lookupCodec)
+			if err != nil {
+				t.Fatalf("Failed to read result: %v", err)
+			}
+			if out.String() != original || len(header.Metadata.Parts) != 3 {
+				t.Errorf("Unexpected result: %+v with %d bytes", header, out.Len())
+			}
+			if parts, _ := mockGCS.ListObjects(context.Background(), testBucket, job.UID+"/parts/"); len(parts) != 0 {
+				t.Errorf("Expected the checkpoints to be removed, got %d objects", len(parts))
+			}
+		})
+	}
+
+	t.Run("small originals are compressed at once", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		app.CheckpointSize = size
+		job := setupSplitJob(t, app, mockGCS, common.AlgorithmZstd, original, 0)
+		data, _ := json.Marshal(job)
+		app.compressMessageHandler(context.Background(), &mockMessage{data: data})
+
+		record, _ := app.JobStore.GetJob(context.Background(), job.UID)
+		result, _ := mockGCS.GetObjectContent(record.ResultPath)
+		header, err := compression.ReadContainerHeader(bytes.NewReader(result))
+		if err != nil || len(header.Metadata.Parts) != 0 {
+			t.Errorf("Expected a container without parts, got %+v, %v", header, err)
+		}
+	})
+}
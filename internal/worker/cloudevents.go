@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// queueJobEvent adds the CloudEvent of job finishing to its pending events,
+// see common.QueueJobEvent. Without EventsTopicID no events are published.
+func (app *Application) queueJobEvent(job *common.Job) {
+	if app.EventsTopicID == "" {
+		return
+	}
+	common.QueueJobEvent(job, time.Now())
+}
+
+// publishJobEvents publishes the pending events of job on EventsTopicID, see
+// common.PublishJobEvents. Those that fail are published by the janitor, see
+// relayJobEvents.
+func (app *Application) publishJobEvents(ctx context.Context, job *common.Job) {
+	if app.EventsTopicID == "" {
+		return
+	}
+	common.PublishJobEvents(ctx, app.PUBSUBClient, app.JobStore, app.EventsTopicID, job)
+}
+
+// relayJobEvents publishes the events still pending on jobs last updated
+// before cutoff, which the worker that finished them failed to publish.
+func (app *Application) relayJobEvents(ctx context.Context, cutoff time.Time) error {
+	if app.EventsTopicID == "" {
+		return nil
+	}
+	jobs, err := app.JobStore.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if len(job.PendingEvents) == 0 || job.UpdatedAt.After(cutoff) {
+			continue
+		}
+		slog.Info("Publishing pending job events", "job", job.ID, "events", len(job.PendingEvents))
+		app.publishJobEvents(ctx, job)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+const testEventsTopic = "test-events-topic"
+
+// unreachableTopic fails to publish on topicID.
+type unreachableTopic struct {
+	*mockPubSubClient
+	topicID string
+}
+
+func (c *unreachableTopic) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
+	if topicID == c.topicID {
+		return "", errors.New("mock topic unreachable")
+	}
+	return c.mockPubSubClient.PublishMessage(ctx, topicID, msg)
+}
+
+// submitCompressJob stores original and returns the message of a job
+// compressing it.
+func submitCompressJob(t *testing.T, app *Application, mockGCS *mockGCSClient, original string) (string, *mockMessage) {
+	t.Helper()
+	jobID := uuid.New().String()
+	originalFilePath := fmt.Sprintf("%s/original_events.txt", jobID)
+	mockGCS.SetObject(originalFilePath, []byte(original))
+	if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+		ID:        jobID,
+		Operation: common.OperationCompress,
+		Algorithm: common.AlgorithmZstd,
+		Owner:     "tenant",
+		InputSize: int64(len(original)),
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	data, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: originalFilePath, Algorithm: common.AlgorithmZstd})
+	return jobID, &mockMessage{data: data}
+}
+
+func TestJobCloudEvents(t *testing.T) {
+	original := "downstream systems learn about finished jobs without polling\n"
+
+	t.Run("completed", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		app.EventsTopicID = testEventsTopic
+		jobID, msg := submitCompressJob(t, app, mockGCS, original)
+		app.compressMessageHandler(context.Background(), msg)
+
+		messages := app.PUBSUBClient.(*mockPubSubClient).GetMessages(testEventsTopic)
+		if len(messages) != 1 {
+			t.Fatalf("Expected one event, got %d", len(messages))
+		}
+		attributes := messages[0].Attributes
+		if attributes["ce-specversion"] != "1.0" || attributes["ce-type"] != common.CloudEventJobCompleted ||
+			attributes["ce-subject"] != jobID || attributes["ce-id"] == "" || attributes["content-type"] != "application/json" {
+			t.Errorf("Unexpected event attributes: %v", attributes)
+		}
+		var data common.JobEventData
+		if err := json.Unmarshal(messages[0].Data, &data); err != nil {
+			t.Fatalf("Failed to decode event data: %v", err)
+		}
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if data.JobID != jobID || data.Status != common.JobDone || data.Owner != "tenant" || data.ResultPath != job.ResultPath ||
+			data.InputSize != int64(len(original)) || data.OutputSize == 0 || data.OutputSize != job.OutputSize {
+			t.Errorf("Unexpected event data: %+v", data)
+		}
+		if len(job.PendingEvents) != 0 {
+			t.Errorf("Expected no events left pending, got %+v", job.PendingEvents)
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		app.EventsTopicID = testEventsTopic
+		mockGCS.failWrite = true
+		app.MaxDeliveryAttempts = 1
+		jobID, msg := submitCompressJob(t, app, mockGCS, original)
+		app.compressMessageHandler(context.Background(), msg)
+
+		messages := app.PUBSUBClient.(*mockPubSubClient).GetMessages(testEventsTopic)
+		if len(messages) != 1 || messages[0].Attributes["ce-type"] != common.CloudEventJobFailed {
+			t.Fatalf("Expected a failed event, got %+v", messages)
+		}
+		var data common.JobEventData
+		json.Unmarshal(messages[0].Data, &data)
+		if data.JobID != jobID || data.Status != common.JobFailed || data.Error == "" {
+			t.Errorf("Unexpected event data: %+v", data)
+		}
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		app.EventsTopicID = testEventsTopic
+		mockGCS.failWrite = true
+		_, msg := submitCompressJob(t, app, mockGCS, original)
+		app.compressMessageHandler(context.Background(), msg)
+
+		if messages := app.PUBSUBClient.(*mockPubSubClient).GetMessages(testEventsTopic); len(messages) != 0 {
+			t.Errorf("Expected no events for a job to be retried, got %d", len(messages))
+		}
+	})
+
+	t.Run("relayed", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		app.EventsTopicID = testEventsTopic
+		queue := app.PUBSUBClient.(*mockPubSubClient)
+		app.PUBSUBClient = &unreachableTopic{mockPubSubClient: queue, topicID: testEventsTopic}
+		jobID, msg := submitCompressJob(t, app, mockGCS, original)
+		app.compressMessageHandler(context.Background(), msg)
+		if !msg.ackCalled {
+			t.Fatal("Expected the job to succeed without its event published")
+		}
+
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil || job.Status != common.JobDone || len(job.PendingEvents) != 1 {
+			t.Fatalf("Expected the event pending on the DONE job, got %+v, %v", job, err)
+		}
+
+		// too recent, the worker may still be publishing it
+		app.PUBSUBClient = queue
+		if err := app.relayJobEvents(context.Background(), time.Now().Add(-time.Hour)); err != nil {
+			t.Fatalf("relayJobEvents failed: %v", err)
+		}
+		if messages := queue.GetMessages(testEventsTopic); len(messages) != 0 {
+			t.Fatalf("Expected a recent event to be left alone, got %d", len(messages))
+		}
+
+		if err := app.relayJobEvents(context.Background(), time.Now()); err != nil {
+			t.Fatalf("relayJobEvents failed: %v", err)
+		}
+		messages := queue.GetMessages(testEventsTopic)
+		if len(messages) != 1 || messages[0].Attributes["ce-id"] != job.PendingEvents[0].ID {
+			t.Fatalf("Expected the pending event to be published, got %+v", messages)
+		}
+		if job, err := app.JobStore.GetJob(context.Background(), jobID); err != nil || len(job.PendingEvents) != 0 {
+			t.Errorf("Expected no events left pending, got %+v, %v", job, err)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// loadDictionary returns the content of the dictionary id. Dictionaries never
+// change, so each is only read from storage once.
+func (app *Application) loadDictionary(ctx context.Context, id string) ([]byte, error) {
+	if dict, ok := app.dictionaries.Load(id); ok {
+		return dict.([]byte), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+	defer cancel()
+	dict, err := common.LoadDictionary(ctx, app.Storage, app.Bucket, id)
+	if err != nil {
+		return nil, err
+	}
+	app.dictionaries.Store(id, dict)
+	return dict, nil
+}
+
+// dictionaryLookup resolves codecs like lookupCodec, set to the dictionary
+// id if it isn't empty and to stop running when ctx is done.
+func (app *Application) dictionaryLookup(ctx context.Context, id string) (func(string) (compression.Codec, error), error) {
+	lookup := func(name string) (compression.Codec, error) {
+		codec, err := app.lookupCodec(name)
+		if err != nil {
+			return nil, err
+		}
+		return compression.WithContext(ctx, codec), nil
+	}
+	if id == "" {
+		return lookup, nil
+	}
+	dict, err := app.loadDictionary(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dictionary %s: %w", id, err)
+	}
+	return func(name string) (compression.Codec, error) {
+		codec, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		return compression.WithDictionary(codec, dict)
+	}, nil
+}
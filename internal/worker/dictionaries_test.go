@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func eventSample(i int) []byte {
+	return fmt.Appendf(nil, `{"event":"page_view","user_id":%d,"path":"/products/%d","country":"CA"}`, i*7919, i%97)
+}
+
+// saveTestDictionary trains a dictionary on event samples and stores it.
+func saveTestDictionary(t *testing.T, app *Application) string {
+	t.Helper()
+	samples := make([][]byte, 50)
+	for i := range samples {
+		samples[i] = eventSample(i)
+	}
+	dict, err := compression.TrainDictionary(40000, samples, compression.DictionarySize)
+	if err != nil {
+		t.Fatalf("Failed to train dictionary: %v", err)
+	}
+	info := &common.DictionaryInfo{ID: uuid.New().String(), Samples: len(samples), Size: int64(len(dict))}
+	if err := common.SaveDictionary(context.Background(), app.Storage, app.Bucket, info, dict); err != nil {
+		t.Fatalf("Failed to save dictionary: %v", err)
+	}
+	return info.ID
+}
+
+func TestDictionaryCompression(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	dictionary := saveTestDictionary(t, app)
+	original := eventSample(1234)
+
+	jobID := uuid.New().String()
+	originalFilePath := fmt.Sprintf("%s/original_event.json", jobID)
+	mockGCS.SetObject(originalFilePath, original)
+	data, _ := json.Marshal(common.CompressedMsgSchema{
+		UID:              jobID,
+		OriginalFilePath: originalFilePath,
+		Algorithm:        common.AlgorithmZstd,
+		FileName:         "event.json",
+		Verify:           true,
+		Dictionary:       dictionary,
+	})
+	msg := &mockMessage{data: data}
+	app.compressMessageHandler(context.Background(), msg)
+	if !msg.ackCalled {
+		t.Fatal("Expected compression to be Ack-ed")
+	}
+	compressedPath := fmt.Sprintf("%s/compressed.ranran", jobID)
+	compressed, ok := mockGCS.GetObjectContent(compressedPath)
+	if !ok {
+		t.Fatalf("Expected compressed file %q to exist", compressedPath)
+	}
+	header, err := compression.ReadContainerHeader(bytes.NewReader(compressed))
+	if err != nil || header.Metadata.Dictionary != dictionary {
+		t.Fatalf("Expected the container to name the dictionary, got %+v, %v", header, err)
+	}
+
+	// a fresh worker has to fetch the dictionary the container names
+	decompressor, _ := setupTestApp(t)
+	decompressor.Storage = mockGCS
+	decompressor.JobStore = app.JobStore
+	decompressJobID := uuid.New().String()
+	uploadedPath := decompressJobID + "/compressed.ranran"
+	mockGCS.SetObject(uploadedPath, compressed)
+	data, _ = json.Marshal(common.DecompressedMsgSchema{UID: decompressJobID, CompressedFilePath: uploadedPath})
+	msg = &mockMessage{data: data}
+	decompressor.decompressMessageHandler(context.Background(), msg)
+	if !msg.ackCalled {
+		t.Fatal("Expected decompression to be Ack-ed")
+	}
+	if out, _ := mockGCS.GetObjectContent(decompressJobID + "/event.json"); !bytes.Equal(out, original) {
+		t.Errorf("Expected the original back, got %q", out)
+	}
+
+	t.Run("missing dictionary", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		mockGCS.SetObject(compressedPath, compressed)
+		data, _ := json.Marshal(common.DecompressedMsgSchema{UID: uuid.New().String(), CompressedFilePath: compressedPath})
+		msg := &mockMessage{data: data}
+		app.decompressMessageHandler(context.Background(), msg)
+		checkFailedMessage(t, app, msg, true)
+	})
+}
@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"log/slog"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// recordEvent adds a step to the audit trail of a job. Like setJobStatus it
+// must not decide whether the job succeeds, so failures are only logged.
+func (app *Application) recordEvent(jobID string, event common.JobEvent) {
+	if jobID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	event.JobID = jobID
+	if err := common.RecordJobEvent(ctx, app.Storage, app.Bucket, event); err != nil {
+		slog.Warn("Failed to record job event", "job", jobID, "event", event.Type, "error", err)
+	}
+}
+
+// chunkEvents records an EventChunkDone for every common.JobEventChunkSize
+// bytes written through it, so the trail shows how far a long job got.
+type chunkEvents struct {
+	app    *Application
+	jobID  string
+	w      io.Writer
+	n      int64
+	chunks int
+}
+
+func (c *chunkEvents) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	for c.n >= int64(c.chunks+1)*common.JobEventChunkSize {
+		c.chunks++
+		c.app.recordEvent(c.jobID, common.JobEvent{Type: common.EventChunkDone, Chunk: c.chunks})
+	}
+	return n, err
+}
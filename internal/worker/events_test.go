@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// eventTypes lists the audit trail of a job.
+func eventTypes(t *testing.T, app *Application, jobID string) []common.JobEventType {
+	t.Helper()
+	events, err := common.ListJobEvents(context.Background(), app.Storage, app.Bucket, jobID)
+	if err != nil {
+		t.Fatalf("Failed to list job events: %v", err)
+	}
+	var types []common.JobEventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestJobEvents(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	jobID := uuid.New().String()
+	originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+	mockGCS.SetObject(originalFilePath, []byte("hello hello hello events\n"))
+	if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+
+	data, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: originalFilePath, Algorithm: common.AlgorithmZstd})
+	app.compressMessageHandler(context.Background(), &mockMessage{data: data})
+	expected := []common.JobEventType{common.EventDequeued, common.EventStarted, common.EventUploaded, common.EventAcked}
+	if got := eventTypes(t, app, jobID); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, got)
+	}
+
+	// the message of a job that has no input fails for good eventually
+	jobID = uuid.New().String()
+	data, _ = json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: jobID + "/missing.txt", Algorithm: common.AlgorithmZstd})
+	app.MaxDeliveryAttempts = 1
+	app.compressMessageHandler(context.Background(), &mockMessage{data: data})
+	events, err := common.ListJobEvents(context.Background(), app.Storage, app.Bucket, jobID)
+	if err != nil || len(events) == 0 {
+		t.Fatalf("Expected the failure to be recorded, got %v, %v", events, err)
+	}
+	if last := events[len(events)-1]; last.Type != common.EventFailed || last.Reason == "" {
+		t.Errorf("Expected the job to end with a failure and its reason, got %+v", last)
+	}
+}
+
+func TestChunkEvents(t *testing.T) {
+	app, _ := setupTestApp(t)
+	jobID := uuid.New().String()
+	w := &chunkEvents{app: app, jobID: jobID, w: io.Discard}
+	chunk := make([]byte, common.JobEventChunkSize/2)
+	for range 5 {
+		w.Write(chunk)
+	}
+
+	events, err := common.ListJobEvents(context.Background(), app.Storage, app.Bucket, jobID)
+	if err != nil {
+		t.Fatalf("Failed to list job events: %v", err)
+	}
+	if len(events) != 2 || events[0].Chunk != 1 || events[1].Chunk != 2 {
+		t.Errorf("Expected chunks 1 and 2 to be done, got %+v", events)
+	}
+}
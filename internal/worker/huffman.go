@@ -1,24 +1,30 @@
-package main
+package worker
 
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"container/heap"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"strconv"
+	"slices"
 
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
 	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
 )
 
-const CHUNKS_COUNT = 3
-
 type lookupItem struct {
+	// char is the symbol of a leaf, and of an inner node the smallest symbol
+	// below it, which orders nodes of the same frequency
 	char rune
 	freq uint64
-	code string
-	bits int
+	// code holds the bits of the Huffman code of a leaf in its low bits, the
+	// first one highest
+	code uint64
+	bits uint8
+	// leaf is set for symbols, every rune including 0 is valid
+	leaf bool
 }
 
 type node struct {
@@ -27,42 +33,6 @@ type node struct {
 	right *node
 }
 
-func (hn *node) addNode(char rune, code uint32, bits uint8) {
-	if bits == 0 {
-		hn.value = &lookupItem{
-			char: char,
-		}
-		return
-	}
-	direction := code >> (bits - 1)
-	if direction&1 == 0 {
-		if hn.left == nil {
-			hn.left = &node{}
-		}
-		hn.left.addNode(char, code, bits-1)
-	} else {
-		if hn.right == nil {
-			hn.right = &node{}
-		}
-		hn.right.addNode(char, code, bits-1)
-	}
-}
-
-func (hn *node) walker() func(int) (rune, bool) {
-	t := hn
-	return func(direction int) (rune, bool) {
-		if direction == 0 {
-			t = t.left
-		} else {
-			t = t.right
-		}
-		if t.value != nil {
-			return t.value.char, true
-		}
-		return 0, false
-	}
-}
-
 type (
 	prefixTable   map[rune]*lookupItem
 	priorityQueue []*node
@@ -70,8 +40,15 @@ type (
 
 func (pq priorityQueue) Len() int { return len(pq) }
 
+// Less puts the rarest node first, frequencies being stored negated, and of
+// nodes as frequent the one with the smallest symbol below it, so the same
+// input builds the same tree whatever order its frequency table is read in.
 func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].value.freq > pq[j].value.freq
+	a, b := pq[i].value, pq[j].value
+	if a.freq != b.freq {
+		return a.freq > b.freq
+	}
+	return a.char < b.char
 }
 
 func (pq priorityQueue) Swap(i, j int) {
@@ -92,19 +69,126 @@ func (pq *priorityQueue) Pop() any {
 	return item
 }
 
-func buildTree(root *node, code string, bits int) {
-	if root == nil {
-		return
+// maxCodeBits is the longest Huffman code the header has room for, and so
+// the deepest a tree can be.
+const maxCodeBits = 32
+
+// treeStep is a node still to visit when walking a tree, with the code
+// leading to it.
+type treeStep struct {
+	node *node
+	code uint64
+	bits uint
+}
+
+// buildTree assigns the codes of the leaves below root, which is no deeper
+// than maxCodeBits. It walks the tree with a stack of its own rather than
+// recursing, since a pathological input makes for a tree as deep as it has
+// symbols until limitDepth rebuilds it.
+func buildTree(root *node) {
+	stack := []treeStep{{node: root}}
+	for len(stack) > 0 {
+		step := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if step.node == nil {
+			continue
+		}
+		item := step.node.value
+		// if node is a leaf, assign code and bits
+		if item.leaf {
+			item.code, item.bits = step.code, uint8(step.bits)
+			if item.bits == 0 {
+				// a lone symbol still needs a bit to be written in the body
+				item.bits = 1
+			}
+			continue
+		}
+		// right first, so the left is visited first
+		stack = append(stack,
+			treeStep{node: step.node.right, code: step.code<<1 | 1, bits: step.bits + 1},
+			treeStep{node: step.node.left, code: step.code << 1, bits: step.bits + 1},
+		)
+	}
+}
+
+// limitDepth returns a tree of the leaves below root no deeper than
+// maxCodeBits, root itself when it is. Otherwise the code lengths are limited
+// the way JPEG limits its own (ITU T.81, K.3): a pair of the deepest leaves
+// moves up a level, one taking the place of their parent, the other going
+// below a shallower leaf along with it, until none is too deep. The most
+// frequent symbols get the shortest codes and the leaves are placed by
+// canonical codes, so the same input still builds the same tree.
+func limitDepth(root *node) *node {
+	var leaves []*lookupItem
+	var counts []int
+	stack := []treeStep{{node: root}}
+	for len(stack) > 0 {
+		step := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if step.node == nil {
+			continue
+		}
+		if step.node.value.leaf {
+			leaves = append(leaves, step.node.value)
+			for uint(len(counts)) <= step.bits {
+				counts = append(counts, 0)
+			}
+			counts[step.bits]++
+			continue
+		}
+		stack = append(stack,
+			treeStep{node: step.node.right, bits: step.bits + 1},
+			treeStep{node: step.node.left, bits: step.bits + 1},
+		)
+	}
+	if len(counts) <= maxCodeBits+1 {
+		return root
+	}
+
+	// a level deeper than maxCodeBits holds an even number of leaves, and
+	// with fewer than 2^maxCodeBits symbols there is always a leaf at least
+	// two levels up
+	for i := len(counts) - 1; i > maxCodeBits; i-- {
+		for counts[i] > 0 {
+			j := i - 2
+			for counts[j] == 0 {
+				j--
+			}
+			counts[i] -= 2
+			counts[i-1]++
+			counts[j+1] += 2
+			counts[j]--
+		}
 	}
-	item := root.value
-	// if node is a leaf, assign code and bits
-	if item.char != 0 {
-		item.code = code
-		item.bits = bits
-		return
+
+	// frequencies are stored negated, so the most frequent come first
+	slices.SortFunc(leaves, func(a, b *lookupItem) int {
+		return cmp.Or(cmp.Compare(a.freq, b.freq), cmp.Compare(a.char, b.char))
+	})
+	limited := &node{value: &lookupItem{}}
+	var code uint64
+	bits := 1
+	for _, item := range leaves {
+		for counts[bits] == 0 {
+			bits++
+			code <<= 1
+		}
+		counts[bits]--
+		t := limited
+		for i := bits - 1; i >= 0; i-- {
+			next := &t.left
+			if code>>i&1 == 1 {
+				next = &t.right
+			}
+			if *next == nil {
+				*next = &node{value: &lookupItem{}}
+			}
+			t = *next
+		}
+		t.value = item
+		code++
 	}
-	buildTree(root.left, code+"0", bits+1)
-	buildTree(root.right, code+"1", bits+1)
+	return limited
 }
 
 // TODO: assuming everything works like a champ. Add error handlers like
@@ -119,6 +203,7 @@ func buildHuffmanTree(freqTable map[rune]uint64) (priorityQueue, prefixTable, er
 		val := &lookupItem{
 			char: k,
 			freq: -v,
+			leaf: true,
 		}
 		pt[k] = val
 		pq[i] = &node{
@@ -133,6 +218,7 @@ func buildHuffmanTree(freqTable map[rune]uint64) (priorityQueue, prefixTable, er
 		n2 := heap.Pop(&pq).(*node)
 		newnode := node{}
 		newnode.value = &lookupItem{
+			char: min(n1.value.char, n2.value.char),
 			freq: n1.value.freq + n2.value.freq,
 		}
 		if n1.value.freq > n2.value.freq {
@@ -144,122 +230,200 @@ func buildHuffmanTree(freqTable map[rune]uint64) (priorityQueue, prefixTable, er
 		}
 		heap.Push(&pq, &newnode)
 	}
-	buildTree(pq[0], "", 0)
+	pq[0] = limitDepth(pq[0])
+	buildTree(pq[0])
 	return pq, pt, nil
 }
 
-func buildHeader(root *node, w *bytes.Buffer) error {
-	if root == nil {
-		return nil
+// buildFreqTable counts every symbol in r, see compression.ReadHuffmanSymbol.
+func buildFreqTable(r io.Reader) (map[rune]uint64, error) {
+	freqTable := make(map[rune]uint64)
+	br := getReader(r)
+	defer putReader(br)
+	for {
+		char, err := compression.ReadHuffmanSymbol(br)
+		if err != nil {
+			if err == io.EOF {
+				return freqTable, nil
+			}
+			return nil, err
+		}
+		freqTable[rune(char)]++
 	}
-	item := root.value
-	if item.char != 0 {
+}
+
+// buildHeader writes the entry recording the stream layout, then one for
+// every leaf below root, left to right. Like buildTree it walks the tree with
+// a stack of its own.
+func buildHeader(root *node, w *bytes.Buffer) error {
+	w.Write(compression.HuffmanLayoutEntry(compression.HuffmanLayoutStream))
+	stack := []*node{root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == nil {
+			continue
+		}
+		item := n.value
+		// only leaves are written, so an entry never needs a flag of its own
+		if !item.leaf {
+			stack = append(stack, n.right, n.left)
+			continue
+		}
 		data := make([]byte, 9)
 		// first four bytes: character code
 		binary.LittleEndian.PutUint32(data[:4], uint32(item.char))
 		// next four bytes: Huffman assigned code
-		// WARNING: Huffman codes can be longer than 32 bits in some implementations, but for
-		// simplicity, I force it to be <= 32 bits.
-		v, err := strconv.ParseUint(item.code, 2, 32)
-		if err != nil {
-			return err
-		}
-		smallV := uint32(v)
-		binary.LittleEndian.PutUint32(data[4:8], smallV)
+		binary.LittleEndian.PutUint32(data[4:8], uint32(item.code))
 		// last byte: bits
-		data[8] = byte(item.bits)
+		data[8] = item.bits
 		// write to buffer
 		if _, err := w.Write(data); err != nil {
 			return fmt.Errorf("Failed to write bytes to header: %w", err)
 		}
 	}
-	if err := buildHeader(root.left, w); err != nil {
-		return err
+	return nil
+}
+
+// expectedPaddedZeros works out how many zero bits will pad the last body
+// byte from the symbol frequencies alone, so the padding byte can be written
+// before the body is streamed out.
+func expectedPaddedZeros(pt prefixTable) uint8 {
+	var totalBits uint64
+	for _, item := range pt {
+		// frequencies are stored negated for the max-heap ordering
+		totalBits += -item.freq * uint64(item.bits)
 	}
-	if err := buildHeader(root.right, w); err != nil {
-		return err
+	return uint8((8 - totalBits%8) % 8)
+}
+
+// codeWriter packs Huffman codes into bytes, first bit highest. It shifts a
+// code into acc whole and writes out every full byte, which leaves fewer than
+// 8 bits in acc between codes, so codes of up to maxCodeBits always fit.
+type codeWriter struct {
+	w     io.ByteWriter
+	acc   uint64
+	nbits uint8
+}
+
+func (cw *codeWriter) writeCode(code uint64, bits uint8) error {
+	cw.acc = cw.acc<<bits | code
+	cw.nbits += bits
+	for cw.nbits >= 8 {
+		cw.nbits -= 8
+		if err := cw.w.WriteByte(byte(cw.acc >> cw.nbits)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func buildBody(pt prefixTable, bodyData *bufio.Reader) (*bytes.Buffer, uint8, error) {
-	var output bytes.Buffer
-	var curr byte
-	var bitCount int
-
-	c := 0
+// flush writes the bits left, padded with 0s on the right, and returns how
+// many 0s.
+func (cw *codeWriter) flush() (uint8, error) {
+	if cw.nbits == 0 {
+		return 0, nil
+	}
+	paddedZeros := 8 - cw.nbits
+	if err := cw.w.WriteByte(byte(cw.acc << paddedZeros)); err != nil {
+		return 0, err
+	}
+	cw.acc, cw.nbits = 0, 0
+	return paddedZeros, nil
+}
 
+func buildBody(pt prefixTable, bodyData *bufio.Reader, w io.ByteWriter) (uint8, error) {
+	cw := codeWriter{w: w}
 	for {
-		c += 1
-		char, _, err := bodyData.ReadRune()
+		char, err := compression.ReadHuffmanSymbol(bodyData)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, 0, err
+			return 0, err
 		}
-		item := pt[char]
-
-		for _, bit := range item.code {
-			curr <<= 1 // shift left to make space for next bit
-			if bit == '1' {
-				curr |= 1
-			}
-			bitCount++
-			if bitCount == 8 {
-				output.WriteByte(curr)
-				curr = 0
-				bitCount = 0
-			}
+		item, ok := pt[rune(char)]
+		if !ok {
+			return 0, fmt.Errorf("%w: symbol %d is missing from the frequency table", common.ErrCorruptInput, char)
+		}
+		if err := cw.writeCode(item.code, item.bits); err != nil {
+			return 0, err
 		}
 	}
 	// flush the remaining bits (pad with 0s on the right)
-	var paddedZeros uint8 = 0
-
-	if bitCount > 0 {
-		paddedZeros = uint8(8 - bitCount)
-		curr <<= paddedZeros // shift remaining bits to fill the byte
-		output.WriteByte(curr)
-	}
-	return &output, paddedZeros, nil
+	return cw.flush()
 }
 
-func compress(root *node, pt prefixTable, bodyData *bufio.Reader) (*bytes.Buffer, error) {
-	var fileBuf bytes.Buffer
+// compress streams the Huffman encoded bodyData into w. Only the header is
+// held in memory; the body is written out as it is encoded.
+func compress(root *node, pt prefixTable, bodyData *bufio.Reader, w io.Writer) error {
 	var headerBuf bytes.Buffer
+	fileBuf := getWriter(w)
+	defer putWriter(fileBuf)
 
 	//--- Write header
 	err := buildHeader(root, &headerBuf)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to build header: %v", err)
+		return fmt.Errorf("Failed to build header: %v", err)
 	}
 	headerLen := make([]byte, 2)
 	binary.LittleEndian.PutUint16(headerLen, uint16(headerBuf.Len()))
 	_, err = fileBuf.Write(headerLen)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to write length header: %v", err)
+		return fmt.Errorf("Failed to write length header: %v", err)
 	}
-	_, err = headerBuf.WriteTo(&fileBuf)
+	_, err = headerBuf.WriteTo(fileBuf)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to write header content: %v", err)
+		return fmt.Errorf("Failed to write header content: %v", err)
 	}
 
 	//--- Write body
 	// TODO: implement chunks-based Huffman compression
-	encodedBody, paddedZeros, err := buildBody(pt, bodyData)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to encode body: %v", err)
-	}
+	paddedZeros := expectedPaddedZeros(pt)
 	err = fileBuf.WriteByte(paddedZeros)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to write padded zeros: %v", err)
+		return fmt.Errorf("Failed to write padded zeros: %v", err)
 	}
-	_, err = encodedBody.WriteTo(&fileBuf)
+	actualPaddedZeros, err := buildBody(pt, bodyData, fileBuf)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to write encoded body: %w", err)
+		return fmt.Errorf("Failed to encode body: %w", err)
+	}
+	if actualPaddedZeros != paddedZeros {
+		return fmt.Errorf("%w: body does not match the frequency table: expected %d padded zeros, got %d", common.ErrCorruptInput, paddedZeros, actualPaddedZeros)
+	}
+
+	if err := fileBuf.Flush(); err != nil {
+		return fmt.Errorf("Failed to write encoded body: %w", err)
+	}
+	return nil
+}
+
+// huffmanCodec adapts the frequency-table based Huffman coding to
+// compression.Codec so it can be wrapped in a container like any other codec.
+// Decompressing doesn't need the tree since it is stored in the header.
+type huffmanCodec struct {
+	root *node
+	pt   prefixTable
+}
+
+func (huffmanCodec) Name() string { return "huffman" }
+
+func (c huffmanCodec) Compress(r io.Reader, w io.Writer) error {
+	if c.root == nil {
+		return fmt.Errorf("Huffman tree is required to compress")
 	}
+	br := getReader(r)
+	defer putReader(br)
+	return compress(c.root, c.pt, br, w)
+}
 
-	return &fileBuf, nil
+// Decompress reads the output of either Huffman encoder, taking streams that
+// neither record nor tell their layout for the worker's own, see
+// compression.DecodeHuffman.
+func (huffmanCodec) Decompress(r io.Reader, w io.Writer) error {
+	br := getReader(r)
+	defer putReader(br)
+	return compression.DecodeHuffman(br, w, compression.HuffmanLayoutStream)
 }
 
 // // TODO: assuming this will go correctly, I need to have some good test cases
@@ -278,69 +442,3 @@ func compress(root *node, pt prefixTable, bodyData *bufio.Reader) (*bytes.Buffer
 //
 // 	return &ht
 // }
-
-func decompress(buf *bytes.Buffer, wc common.GCSObjectWriterInterface) error {
-	if buf.Len() == 0 {
-		return nil
-	}
-
-	headerLenBin := make([]byte, 2)
-	_, err := buf.Read(headerLenBin)
-	if err != nil {
-		return fmt.Errorf("Error extracing header: %w", err)
-	}
-	headerLen := binary.LittleEndian.Uint16(headerLenBin)
-
-	headerBin := make([]byte, headerLen)
-	_, err = buf.Read(headerBin)
-	if err != nil {
-		return fmt.Errorf("Error splitting header and body: %w", err)
-	}
-
-	ht := node{}
-	// character code + Huffman assigned code + bits -> 4 + 4 + 1 = 9 bytes
-	for i := 0; i < len(headerBin); i += 9 {
-		section := headerBin[i : i+9]
-		char := binary.LittleEndian.Uint32(section[0:4])
-		code := binary.LittleEndian.Uint32(section[4:8])
-		bits := section[8]
-		ht.addNode(rune(char), code, bits)
-	}
-
-	paddedZeros, err := buf.ReadByte()
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("Error extracting padded 0s: %w", err)
-	}
-
-	// fmt.Println("Decoding body using built tree above")
-	walk := ht.walker()
-	for {
-		bodyBin, err := buf.ReadByte()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return fmt.Errorf("Error decoding body: %w", err)
-		}
-
-		var endByte int
-		if buf.Len() == 0 {
-			endByte = int(paddedZeros)
-		} else {
-			endByte = 0
-		}
-
-		for i := 7; i >= endByte; i-- {
-			bit := (bodyBin >> uint(i)) & 1
-			v, ok := walk(int(bit))
-			if ok {
-				// decompText.WriteRune(rune(v))
-				// TODO: optimize this horrendous thing.
-				wc.Write([]byte(string(v)))
-				walk = ht.walker()
-			}
-		}
-	}
-
-	return nil
-}
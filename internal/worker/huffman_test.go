@@ -0,0 +1,200 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+)
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		original string
+	}{
+		{name: "text", original: "hello hello hello huffman\n"},
+		{name: "nul bytes", original: "\x00a\x00\x00b\x00"},
+		{name: "only nul bytes", original: "\x00\x00\x00"},
+		{name: "one symbol", original: strings.Repeat("z", 10)},
+		{name: "invalid UTF-8", original: "\x00\xff\xfea\x80\x00\xc3 \uFFFD"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			freqTable, err := buildFreqTable(strings.NewReader(tc.original))
+			if err != nil {
+				t.Fatalf("Failed to build frequency table: %v", err)
+			}
+			pq, pt, err := buildHuffmanTree(freqTable)
+			if err != nil {
+				t.Fatalf("Failed to build Huffman tree: %v", err)
+			}
+			codec := huffmanCodec{root: pq[0], pt: pt}
+
+			var compressed, decompressed bytes.Buffer
+			if err := codec.Compress(strings.NewReader(tc.original), &compressed); err != nil {
+				t.Fatalf("Failed to compress: %v", err)
+			}
+			tables, err := compression.InspectHuffman(bytes.NewReader(compressed.Bytes()), compression.HuffmanLayoutStream)
+			if err != nil || len(tables) != 1 || tables[0].Layout != compression.HuffmanLayoutStream {
+				t.Fatalf("Expected one table of the stream layout, got %+v, %v", tables, err)
+			}
+			for _, symbol := range tables[0].Symbols {
+				if symbol.Frequency != freqTable[symbol.Symbol] {
+					t.Errorf("Expected %q %d times, got %d", symbol.Symbol, freqTable[symbol.Symbol], symbol.Frequency)
+				}
+			}
+			if err := codec.Decompress(&compressed, &decompressed); err != nil {
+				t.Fatalf("Failed to decompress: %v", err)
+			}
+			if decompressed.String() != tc.original {
+				t.Errorf("Expected %q, got %q", tc.original, decompressed.String())
+			}
+		})
+	}
+}
+
+func TestHuffmanDeterministic(t *testing.T) {
+	// every symbol as frequent as several others, so the tree is all ties
+	original := strings.Repeat("abcdefgh", 20) + "wxyz"
+
+	var first []byte
+	for i := 0; i < 20; i++ {
+		freqTable, err := buildFreqTable(strings.NewReader(original))
+		if err != nil {
+			t.Fatalf("Failed to build frequency table: %v", err)
+		}
+		pq, pt, err := buildHuffmanTree(freqTable)
+		if err != nil {
+			t.Fatalf("Failed to build Huffman tree: %v", err)
+		}
+		var compressed bytes.Buffer
+		if err := (huffmanCodec{root: pq[0], pt: pt}).Compress(strings.NewReader(original), &compressed); err != nil {
+			t.Fatalf("Failed to compress: %v", err)
+		}
+		if first == nil {
+			first = compressed.Bytes()
+		} else if !bytes.Equal(compressed.Bytes(), first) {
+			t.Fatalf("Expected the same output on build %d", i+1)
+		}
+	}
+}
+
+func TestHuffmanTreeTooDeep(t *testing.T) {
+	// Fibonacci frequencies make the deepest tree, a level more for every
+	// symbol, here two past the longest code the header has room for
+	const symbols = maxCodeBits + 3
+	var original strings.Builder
+	a, b := 1, 1
+	for i := range symbols {
+		original.WriteString(strings.Repeat(string('A'+rune(i)), a))
+		a, b = b, a+b
+	}
+	freqTable, err := buildFreqTable(strings.NewReader(original.String()))
+	if err != nil {
+		t.Fatalf("Failed to build frequency table: %v", err)
+	}
+	pq, pt, err := buildHuffmanTree(freqTable)
+	if err != nil {
+		t.Fatalf("Failed to build Huffman tree: %v", err)
+	}
+	longest := 0
+	for _, item := range pt {
+		longest = max(longest, int(item.bits))
+	}
+	if longest != maxCodeBits {
+		t.Errorf("Expected the codes to be limited to %d bits, got %d", maxCodeBits, longest)
+	}
+	if bits := pt['A'+symbols-1].bits; bits != 1 {
+		t.Errorf("Expected the most frequent symbol to take 1 bit, got %d", bits)
+	}
+	var header bytes.Buffer
+	if err := buildHeader(pq[0], &header); err != nil || header.Len() != 9*(1+len(freqTable)) {
+		t.Errorf("Expected the layout and an entry per symbol, got %d bytes, %v", header.Len(), err)
+	}
+
+	codec := huffmanCodec{root: pq[0], pt: pt}
+	var compressed, decompressed bytes.Buffer
+	if err := codec.Compress(strings.NewReader(original.String()), &compressed); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := codec.Decompress(&compressed, &decompressed); err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	if decompressed.String() != original.String() {
+		t.Errorf("Expected the original back, got %d bytes of %d", decompressed.Len(), original.Len())
+	}
+}
+
+func TestHuffmanLayouts(t *testing.T) {
+	original, err := os.ReadFile(filepath.Join("test_data", "test_data.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	var chunked bytes.Buffer
+	if err := compression.WriteContainer(&chunked, compression.HuffmanCodec{}, bytes.NewReader(original), compression.ContainerMetadata{}); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	stream, err := os.ReadFile(filepath.Join("test_data", "compressed.ranran"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	// compressed before the layout was recorded
+	legacy, err := os.ReadFile(filepath.Join("test_data", "compressed_legacy.ranran"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	worker := func(string) (compression.Codec, error) { return huffmanCodec{}, nil }
+
+	testCases := []struct {
+		name   string
+		data   []byte
+		lookup func(string) (compression.Codec, error)
+	}{
+		{name: "chunked by the worker", data: chunked.Bytes(), lookup: worker},
+		{name: "stream by the CLI", data: stream, lookup: compression.Lookup},
+		{name: "unrecorded stream by the worker", data: legacy, lookup: worker},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var decompressed bytes.Buffer
+			if _, err := compression.ReadContainer(bytes.NewReader(tc.data), &decompressed, tc.lookup); err != nil {
+				t.Fatalf("Failed to decompress: %v", err)
+			}
+			if !bytes.Equal(decompressed.Bytes(), original) {
+				t.Errorf("Expected %q, got %q", original, decompressed.Bytes())
+			}
+		})
+	}
+}
+
+func FuzzHuffmanDecompress(f *testing.F) {
+	for _, seed := range []string{"", "a", "hello hello hello huffman\n", "\x00a\x00\x00b\x00", strings.Repeat("abcdefgh", 20)} {
+		freqTable, err := buildFreqTable(strings.NewReader(seed))
+		if err != nil {
+			f.Fatalf("Failed to build frequency table: %v", err)
+		}
+		var compressed bytes.Buffer
+		if len(freqTable) > 0 {
+			pq, pt, err := buildHuffmanTree(freqTable)
+			if err != nil {
+				f.Fatalf("Failed to build Huffman tree: %v", err)
+			}
+			if err := (huffmanCodec{root: pq[0], pt: pt}).Compress(strings.NewReader(seed), &compressed); err != nil {
+				f.Fatalf("Failed to compress: %v", err)
+			}
+		}
+		f.Add(compressed.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		err := huffmanCodec{}.Decompress(bytes.NewReader(data), io.Discard)
+		if err != nil && !errors.Is(err, compression.ErrTruncated) && !errors.Is(err, compression.ErrBadHeader) && !errors.Is(err, compression.ErrInvalidCode) {
+			t.Errorf("Expected a corrupt stream to fail with a typed error, got %v", err)
+		}
+	})
+}
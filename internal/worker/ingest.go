@@ -0,0 +1,223 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// A worker run with -ingest is a streaming archive compactor rather than a
+// job processor: it receives raw records, e.g. log lines, from a topic of
+// their own, collects them into windows and writes every window to the
+// bucket as one compressed container. Records are only acked once their
+// window is in storage, so they are archived at least once.
+
+// modeIngest is the registry mode of a worker run with -ingest.
+const modeIngest = "ingest"
+
+// ingestConfig is how the records of Subscription are archived.
+type ingestConfig struct {
+	Subscription string
+	// a window is written once it is Window old or holds WindowBytes
+	Window      time.Duration
+	WindowBytes int64
+	// Prefix is where the windows go in the bucket, under the hour they
+	// started in.
+	Prefix    string
+	Algorithm string
+	Level     int
+}
+
+// ingestConfigFromEnv reads INGEST_SUBSCRIPTION, INGEST_WINDOW (default 1m),
+// INGEST_WINDOW_BYTES (default 64 MiB), INGEST_PREFIX (default "archive/"),
+// INGEST_ALGORITHM (default zstd) and INGEST_LEVEL.
+func ingestConfigFromEnv() (ingestConfig, error) {
+	config := ingestConfig{
+		Subscription: os.Getenv("INGEST_SUBSCRIPTION"),
+		Window:       common.GetEnvDuration("INGEST_WINDOW", time.Minute),
+		WindowBytes:  int64(common.GetEnvInt("INGEST_WINDOW_BYTES", 64<<20)),
+		Prefix:       os.Getenv("INGEST_PREFIX"),
+		Algorithm:    os.Getenv("INGEST_ALGORITHM"),
+		Level:        common.GetEnvInt("INGEST_LEVEL", 0),
+	}
+	if config.Subscription == "" {
+		return config, fmt.Errorf("INGEST_SUBSCRIPTION is not set")
+	}
+	if config.Window <= 0 || config.WindowBytes <= 0 {
+		return config, fmt.Errorf("INGEST_WINDOW and INGEST_WINDOW_BYTES must be positive")
+	}
+	if config.Prefix == "" {
+		config.Prefix = "archive/"
+	}
+	if !strings.HasSuffix(config.Prefix, "/") {
+		config.Prefix += "/"
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = common.AlgorithmZstd
+	}
+	if !common.UsesContainer(config.Algorithm) || config.Algorithm == common.AlgorithmAuto {
+		return config, fmt.Errorf("INGEST_ALGORITHM %s doesn't write containers", config.Algorithm)
+	}
+	return config, nil
+}
+
+// ingestWindow is the records received since the last window was written.
+type ingestWindow struct {
+	data     bytes.Buffer
+	messages []common.MessageInterface
+	started  time.Time
+}
+
+// ingestor collects the records of one subscription into windows.
+type ingestor struct {
+	app    *Application
+	config ingestConfig
+	codec  compression.Codec
+
+	mu     sync.Mutex
+	window *ingestWindow
+	// writes lets one window be written at a time, in order
+	writes sync.Mutex
+}
+
+func (app *Application) newIngestor(config ingestConfig) (*ingestor, error) {
+	codec, err := app.lookupCodec(config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if codec, err = compression.WithLevel(codec, config.Level); err != nil {
+		return nil, err
+	}
+	return &ingestor{app: app, config: config, codec: codec}, nil
+}
+
+// add adds the record of msg to the current window, writing the window out
+// once it is full. Every record ends with a newline in the window.
+func (in *ingestor) add(ctx context.Context, msg common.MessageInterface) {
+	record := msg.GetData()
+	if len(record) == 0 {
+		msg.Ack()
+		return
+	}
+
+	in.mu.Lock()
+	if in.window == nil {
+		in.window = &ingestWindow{started: time.Now().UTC()}
+	}
+	w := in.window
+	w.data.Write(record)
+	if record[len(record)-1] != '\n' {
+		w.data.WriteByte('\n')
+	}
+	w.messages = append(w.messages, msg)
+	full := int64(w.data.Len()) >= in.config.WindowBytes
+	if full {
+		in.window = nil
+	}
+	in.mu.Unlock()
+
+	if full {
+		in.write(ctx, w)
+	}
+}
+
+// flush writes the current window out if it is at least age old, or
+// whatever its age when age is 0.
+func (in *ingestor) flush(ctx context.Context, age time.Duration) {
+	in.mu.Lock()
+	w := in.window
+	if w == nil || time.Since(w.started) < age {
+		in.mu.Unlock()
+		return
+	}
+	in.window = nil
+	in.mu.Unlock()
+	in.write(ctx, w)
+}
+
+// objectPath is where a window that started at started is written,
+// under the hour it started in.
+func (in *ingestor) objectPath(started time.Time) string {
+	name := fmt.Sprintf("%s-%s", started.Format("20060102T150405Z"), uuid.NewString()[:8])
+	return fmt.Sprintf("%s%s/%s%s", in.config.Prefix, started.Format("2006/01/02/15"), name, common.AlgorithmExtension(in.config.Algorithm))
+}
+
+// write compresses a window into the bucket and acks its records, or nacks
+// them to be received again when it can't be written.
+func (in *ingestor) write(ctx context.Context, w *ingestWindow) {
+	in.writes.Lock()
+	defer in.writes.Unlock()
+
+	start := time.Now()
+	object := in.objectPath(w.started)
+	size := int64(w.data.Len())
+	meta := compression.ContainerMetadata{Name: strings.TrimSuffix(object[strings.LastIndex(object, "/")+1:], common.AlgorithmExtension(in.config.Algorithm))}
+	out, err := in.app.streamToStorage(ctx, object, func(dst io.Writer) error {
+		return compression.WriteContainer(dst, compression.WithContext(ctx, in.codec), bytes.NewReader(w.data.Bytes()), meta)
+	})
+	if err != nil {
+		slog.Error("Failed to write ingested window, nacking its records", "object", object, "records", len(w.messages), "error", err)
+		for _, msg := range w.messages {
+			msg.Nack()
+		}
+		return
+	}
+	for _, msg := range w.messages {
+		msg.Ack()
+	}
+	observeJob(modeIngest, start, size, out)
+	slog.Info("Wrote ingested window", "object", object, "records", len(w.messages), "bytes", size, "compressed", out)
+}
+
+// Ingest archives the records of the configured subscription until ctx is
+// done, writing a window every config.Window at the latest. The window
+// being collected is written on the way out.
+func (app *Application) Ingest(ctx context.Context, config ingestConfig) error {
+	in, err := app.newIngestor(config)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Ingesting records", "subscription", config.Subscription, "window", config.Window, "window_bytes", config.WindowBytes, "prefix", config.Prefix)
+	received := make(chan error, 1)
+	go func() {
+		received <- app.PUBSUBClient.Receive(ctx, config.Subscription, func(ctx context.Context, msg common.MessageInterface) {
+			msg = countAcks(msg, modeIngest)
+			defer func() {
+				if v := recover(); v != nil {
+					panicked("ingest", v)
+					msg.Nack()
+				}
+			}()
+			in.add(*app.CTX, msg)
+		})
+	}()
+
+	// windows are checked more often than they last, so none outlives
+	// config.Window by much
+	ticker := time.NewTicker(max(config.Window/10, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			in.flush(*app.CTX, config.Window)
+		case err := <-received:
+			in.flush(*app.CTX, 0)
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
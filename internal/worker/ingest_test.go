@@ -0,0 +1,146 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestIngestConfigFromEnv(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		want    ingestConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			env:  map[string]string{"INGEST_SUBSCRIPTION": "logs-sub"},
+			want: ingestConfig{Subscription: "logs-sub", Window: time.Minute, WindowBytes: 64 << 20, Prefix: "archive/", Algorithm: common.AlgorithmZstd},
+		},
+		{
+			name: "configured",
+			env:  map[string]string{"INGEST_SUBSCRIPTION": "logs-sub", "INGEST_WINDOW": "5m", "INGEST_WINDOW_BYTES": "1024", "INGEST_PREFIX": "logs", "INGEST_ALGORITHM": "adaptive", "INGEST_LEVEL": "3"},
+			want: ingestConfig{Subscription: "logs-sub", Window: 5 * time.Minute, WindowBytes: 1024, Prefix: "logs/", Algorithm: common.AlgorithmAdaptive, Level: 3},
+		},
+		{name: "no subscription", env: map[string]string{}, wantErr: true},
+		{name: "no window", env: map[string]string{"INGEST_SUBSCRIPTION": "logs-sub", "INGEST_WINDOW": "0s"}, wantErr: true},
+		{name: "gzip", env: map[string]string{"INGEST_SUBSCRIPTION": "logs-sub", "INGEST_ALGORITHM": "gzip"}, wantErr: true},
+		{name: "auto", env: map[string]string{"INGEST_SUBSCRIPTION": "logs-sub", "INGEST_ALGORITHM": "auto"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"INGEST_SUBSCRIPTION", "INGEST_WINDOW", "INGEST_WINDOW_BYTES", "INGEST_PREFIX", "INGEST_ALGORITHM", "INGEST_LEVEL"} {
+				t.Setenv(key, tc.env[key])
+			}
+			config, err := ingestConfigFromEnv()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !tc.wantErr && config != tc.want {
+				t.Errorf("Expected %+v, got %+v", tc.want, config)
+			}
+		})
+	}
+}
+
+// readWindows decodes the windows written under prefix.
+func readWindows(t *testing.T, app *Application, mockGCS *mockGCSClient, prefix string) []string {
+	t.Helper()
+	objects, err := mockGCS.ListObjects(context.Background(), testBucket, prefix)
+	if err != nil {
+		t.Fatalf("Failed to list windows: %v", err)
+	}
+	var windows []string
+	for _, object := range objects {
+		data, _ := mockGCS.GetObjectContent(object.Name)
+		var out bytes.Buffer
+		if _, err := compression.ReadContainer(bytes.NewReader(data), &out, app.lookupCodec); err != nil {
+			t.Fatalf("Failed to read window %s: %v", object.Name, err)
+		}
+		windows = append(windows, out.String())
+	}
+	return windows
+}
+
+func TestIngestor(t *testing.T) {
+	config := ingestConfig{Subscription: "logs-sub", Window: time.Minute, WindowBytes: 32, Prefix: "archive/", Algorithm: common.AlgorithmZstd}
+
+	t.Run("full window", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		in, err := app.newIngestor(config)
+		if err != nil {
+			t.Fatalf("Failed to create ingestor: %v", err)
+		}
+		var msgs []*mockMessage
+		for _, record := range []string{"first record", "second record\n", "third record"} {
+			msg := &mockMessage{data: []byte(record)}
+			msgs = append(msgs, msg)
+			in.add(context.Background(), msg)
+		}
+		// the third record fills the window
+		for i, msg := range msgs {
+			if !msg.ackCalled || msg.nackCalled {
+				t.Errorf("Expected record %d to be acked, got ack=%v nack=%v", i+1, msg.ackCalled, msg.nackCalled)
+			}
+		}
+		windows := readWindows(t, app, mockGCS, config.Prefix)
+		if len(windows) != 1 || windows[0] != "first record\nsecond record\nthird record\n" {
+			t.Errorf("Unexpected windows: %q", windows)
+		}
+	})
+
+	t.Run("aged window", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		in, _ := app.newIngestor(config)
+		msg := &mockMessage{data: []byte("lonely record")}
+		in.add(context.Background(), msg)
+		in.flush(context.Background(), config.Window)
+		if msg.ackCalled {
+			t.Fatal("Expected a young window not to be written")
+		}
+		in.flush(context.Background(), 0)
+		if !msg.ackCalled {
+			t.Fatal("Expected the record to be acked once its window is written")
+		}
+		windows := readWindows(t, app, mockGCS, config.Prefix)
+		if len(windows) != 1 || windows[0] != "lonely record\n" {
+			t.Errorf("Unexpected windows: %q", windows)
+		}
+		objects, _ := mockGCS.ListObjects(context.Background(), testBucket, config.Prefix+time.Now().UTC().Format("2006/01/02/"))
+		if len(objects) != 1 || !strings.HasSuffix(objects[0].Name, common.AlgorithmExtension(config.Algorithm)) {
+			t.Errorf("Expected the window under the hour it started in, got %v", objects)
+		}
+	})
+
+	t.Run("failed write", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		mockGCS.failWrite = true
+		in, _ := app.newIngestor(config)
+		msg := &mockMessage{data: []byte("record")}
+		in.add(context.Background(), msg)
+		in.flush(context.Background(), 0)
+		if msg.ackCalled || !msg.nackCalled {
+			t.Errorf("Expected the record to be nacked, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+		}
+	})
+
+	t.Run("empty record", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		in, _ := app.newIngestor(config)
+		msg := &mockMessage{}
+		in.add(context.Background(), msg)
+		in.flush(context.Background(), 0)
+		if !msg.ackCalled {
+			t.Error("Expected an empty record to be acked")
+		}
+		if windows := readWindows(t, app, mockGCS, config.Prefix); len(windows) != 0 {
+			t.Errorf("Expected no window, got %q", windows)
+		}
+	})
+}
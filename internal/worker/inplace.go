@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+)
+
+// jobMetadataKey names the job that wrote a result back into the bucket of
+// an in-place job's owner.
+const jobMetadataKey = "cdc-job"
+
+// checkOwnResult fails unless the object in the way of the result of job
+// jobID was written by an earlier delivery of the job. Objects of the owner
+// are never overwritten.
+func (app *Application) checkOwnResult(ctx context.Context, bucket, object, jobID string) error {
+	info, err := app.Storage.StatObject(ctx, bucket, object)
+	if err != nil {
+		return fmt.Errorf("failed to check existing result: %w", err)
+	}
+	if info.Metadata[jobMetadataKey] != jobID {
+		return fmt.Errorf("%w: %s/%s is in the way", errPoisonMessage, bucket, object)
+	}
+	return nil
+}
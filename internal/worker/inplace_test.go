@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// bucketStorage records the bucket of every object read and written, and
+// keeps the metadata of objects of the owner, which the mock doesn't.
+type bucketStorage struct {
+	common.StorageBackend
+	buckets  map[string]string
+	metadata map[string]map[string]string
+}
+
+func (s *bucketStorage) StatObject(ctx context.Context, bucket, object string) (common.ObjectInfo, error) {
+	info, err := s.StorageBackend.StatObject(ctx, bucket, object)
+	if metadata, ok := s.metadata[object]; ok {
+		info.Metadata = metadata
+	}
+	return info, err
+}
+
+func (s *bucketStorage) NewObjectReader(ctx context.Context, bucket, object string) (common.ObjectReaderInterface, error) {
+	s.buckets[object] = bucket
+	return s.StorageBackend.NewObjectReader(ctx, bucket, object)
+}
+
+func (s *bucketStorage) NewObjectWriter(ctx context.Context, bucket, object string, opts ...common.ObjectWriterOption) common.ObjectWriterInterface {
+	s.buckets[object] = bucket
+	return s.StorageBackend.NewObjectWriter(ctx, bucket, object, opts...)
+}
+
+func TestInPlaceCompression(t *testing.T) {
+	const original = "logs/app.log"
+	testCases := []struct {
+		name         string
+		resultBucket string
+		resultPath   string
+		inTheWay     map[string]string
+		wantFailed   bool
+	}{
+		{name: "write back", resultBucket: "user", resultPath: original + ".zst"},
+		{name: "to the platform", resultPath: "job/compressed.zst"},
+		{name: "object of the owner in the way", resultBucket: "user", resultPath: original + ".zst", inTheWay: map[string]string{}, wantFailed: true},
+		{name: "earlier result in the way", resultBucket: "user", resultPath: original + ".zst", inTheWay: map[string]string{jobMetadataKey: "self"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			storage := &bucketStorage{StorageBackend: mockGCS, buckets: make(map[string]string)}
+			app.Storage = storage
+			jobID := uuid.New().String()
+			mockGCS.SetObject(original, []byte("a log line\na log line\n"))
+			if tc.inTheWay != nil {
+				if tc.inTheWay[jobMetadataKey] == "self" {
+					tc.inTheWay[jobMetadataKey] = jobID
+				}
+				mockGCS.SetObject(tc.resultPath, []byte("not ours"))
+				storage.metadata = map[string]map[string]string{tc.resultPath: tc.inTheWay}
+			}
+			if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress}); err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
+
+			data, _ := common.MarshalMessage(common.CompressedMsgSchema{
+				UID:              jobID,
+				OriginalFilePath: original,
+				Algorithm:        common.AlgorithmZstd,
+				FileName:         "app.log",
+				SourceBucket:     "user",
+				ResultBucket:     tc.resultBucket,
+				ResultPath:       tc.resultPath,
+			})
+			msg := &mockMessage{data: data, deliveryAttempt: 1}
+			app.compressMessageHandler(context.Background(), msg)
+
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if tc.wantFailed {
+				checkFailedMessage(t, app, msg, true)
+				if got, _ := mockGCS.GetObjectContent(tc.resultPath); string(got) != "not ours" {
+					t.Errorf("Expected the object of the owner to be left alone, got %q", got)
+				}
+				return
+			}
+			if !msg.ackCalled || job.Status != common.JobDone {
+				t.Fatalf("Expected the job to be done, got %+v", job)
+			}
+			if job.ResultPath != tc.resultPath || job.ResultBucket != tc.resultBucket {
+				t.Errorf("Expected the result at %s in %q, got %+v", tc.resultPath, tc.resultBucket, job)
+			}
+			if storage.buckets[original] != "user" {
+				t.Errorf("Expected the original to be read from the bucket of the owner, got %q", storage.buckets[original])
+			}
+			if tc.inTheWay != nil {
+				return
+			}
+			wantBucket := tc.resultBucket
+			if wantBucket == "" {
+				wantBucket = testBucket
+			}
+			if storage.buckets[tc.resultPath] != wantBucket {
+				t.Errorf("Expected the result to be written to %s, got %q", wantBucket, storage.buckets[tc.resultPath])
+			}
+			if _, ok := mockGCS.GetObjectContent(tc.resultPath); !ok {
+				t.Error("Expected the result to be stored")
+			}
+		})
+	}
+}
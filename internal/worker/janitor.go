@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+var expiredTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_janitor_expired_total",
+	Help: "Jobs, upload sessions and stale worker records removed by the janitor.",
+}, []string{"kind"})
+
+var orphansReconciled = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_janitor_orphans_reconciled_total",
+	Help: "Stranded jobs found by the orphan reconciler, by whether they were requeued or failed.",
+}, []string{"action"})
+
+// expirable reports whether the files of job can go once it is old enough.
+// Jobs still queued or being processed are left alone however old they are.
+func expirable(job *common.Job) bool {
+	switch job.Status {
+	case common.JobDone, common.JobFailed, common.JobCanceled, common.JobAwaitingUpload:
+		return true
+	}
+	return false
+}
+
+// deletePrefix removes every object under prefix.
+func (app *Application) deletePrefix(ctx context.Context, prefix string) error {
+	objects, err := app.Storage.ListObjects(ctx, app.Bucket, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	for _, object := range objects {
+		if err := app.Storage.DeleteObject(ctx, app.Bucket, object.Name); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", object.Name, err)
+		}
+	}
+	return nil
+}
+
+// tenantPlaceholder is replaced by the owner in the TENANT_PREFIX of the
+// manager.
+const tenantPlaceholder = "{tenant}"
+
+// uploadSessionDirs returns the prefixes to list for upload sessions and a
+// pattern matching the directory of a session in the names found. The manager
+// stores sessions under uploads/, and under the prefix of their tenant once
+// tenantPrefix is set.
+func uploadSessionDirs(tenantPrefix string) ([]string, *regexp.Regexp) {
+	if tenantPrefix == "" {
+		return []string{"uploads/"}, regexp.MustCompile(`^uploads/[^/]+/`)
+	}
+	before, after, _ := strings.Cut(tenantPrefix, tenantPlaceholder)
+	dir := regexp.MustCompile(`^(?:` + regexp.QuoteMeta(before) + `[^/]*` + regexp.QuoteMeta(after) + `)?uploads/[^/]+/`)
+	if before == "" {
+		return []string{""}, dir
+	}
+	return []string{"uploads/", before}, dir
+}
+
+// sweep deletes the files of jobs last updated more than ttl before now and
+// marks them EXPIRED, keeping the record so clients can tell what happened.
+// Upload sessions untouched for as long are deleted entirely, as are the
+// registry records of workers not seen since. A job that can't be cleaned up
+// is logged and retried on the next sweep.
+func (app *Application) sweep(ctx context.Context, ttl time.Duration, now time.Time) error {
+	cutoff := now.Add(-ttl)
+
+	jobs, err := app.JobStore.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if !expirable(job) || job.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if err := app.deletePrefix(ctx, job.ObjectDir()+"/"); err != nil {
+			slog.Error("Failed to delete job files", "job", job.ID, "error", err)
+			continue
+		}
+		// the audit trail goes with the files, the record says what happened
+		if err := app.deletePrefix(ctx, common.JobEventsPrefix(job.ID)); err != nil {
+			slog.Warn("Failed to delete job events", "job", job.ID, "error", err)
+		}
+		if _, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+			j.Status = common.JobExpired
+			j.ResultPath = ""
+			return nil
+		}); err != nil {
+			slog.Error("Failed to mark job as expired", "job", job.ID, "error", err)
+			continue
+		}
+		if err := common.AddStoredBytes(ctx, app.Storage, app.Bucket, job.Owner, -job.InputSize); err != nil {
+			slog.Warn("Failed to release stored bytes of expired job", "job", job.ID, "owner", job.Owner, "error", err)
+		}
+		expiredTotal.WithLabelValues("job").Inc()
+		slog.Info("Expired job", "job", job.ID)
+	}
+
+	// workers that crashed never removed their record
+	workers, err := common.ListWorkers(ctx, app.Storage, app.Bucket)
+	if err != nil {
+		return err
+	}
+	for _, worker := range workers {
+		if worker.LastSeen.After(cutoff) {
+			continue
+		}
+		if err := common.RemoveWorker(ctx, app.Storage, app.Bucket, worker.ID); err != nil {
+			slog.Error("Failed to remove stale worker", "worker", worker.ID, "error", err)
+			continue
+		}
+		expiredTotal.WithLabelValues("worker").Inc()
+		slog.Info("Removed stale worker", "worker", worker.ID, "last_seen", worker.LastSeen)
+	}
+
+	// a session is as recent as the last chunk or save of its state
+	lastUpdated := make(map[string]time.Time)
+	listPrefixes, sessionDir := uploadSessionDirs(app.TenantPrefix)
+	for _, prefix := range listPrefixes {
+		objects, err := app.Storage.ListObjects(ctx, app.Bucket, prefix)
+		if err != nil {
+			return fmt.Errorf("failed to list upload sessions: %w", err)
+		}
+		for _, object := range objects {
+			dir := sessionDir.FindString(object.Name)
+			if dir == "" {
+				continue
+			}
+			if object.Updated.After(lastUpdated[dir]) {
+				lastUpdated[dir] = object.Updated
+			}
+		}
+	}
+	for dir, updated := range lastUpdated {
+		if updated.After(cutoff) {
+			continue
+		}
+		if err := app.deletePrefix(ctx, dir); err != nil {
+			slog.Error("Failed to delete upload session", "upload", dir, "error", err)
+			continue
+		}
+		expiredTotal.WithLabelValues("upload").Inc()
+		slog.Info("Expired upload session", "upload", dir)
+	}
+	return nil
+}
+
+// runJanitor sweeps every interval until ctx is cancelled.
+func (app *Application) runJanitor(ctx context.Context, interval, ttl time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := app.sweep(ctx, ttl, time.Now()); err != nil {
+			slog.Error("Janitor sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestSweep(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	app.TenantPrefix = "tenants/{tenant}/"
+	ttl := 24 * time.Hour
+	now := time.Now()
+	old := now.Add(-2 * ttl)
+
+	// job records are written directly, CreateJob would stamp them with now
+	putJob := func(status common.JobStatus, updatedAt time.Time) string {
+		id := uuid.NewString()
+		data, _ := json.Marshal(common.Job{ID: id, Status: status, ResultPath: id + "/compressed.ranran", UpdatedAt: updatedAt})
+		mockGCS.SetObject(fmt.Sprintf("jobs/%s.json", id), data)
+		mockGCS.SetObject(id+"/original_a.txt", []byte("a"))
+		mockGCS.SetObject(id+"/compressed.ranran", []byte("b"))
+		return id
+	}
+
+	testCases := []struct {
+		name          string
+		id            string
+		expectedState common.JobStatus
+	}{
+		{name: "old done job", id: putJob(common.JobDone, old), expectedState: common.JobExpired},
+		{name: "old failed job", id: putJob(common.JobFailed, old), expectedState: common.JobExpired},
+		{name: "never uploaded", id: putJob(common.JobAwaitingUpload, old), expectedState: common.JobExpired},
+		{name: "old canceled job", id: putJob(common.JobCanceled, old), expectedState: common.JobExpired},
+		{name: "recent done job", id: putJob(common.JobDone, now), expectedState: common.JobDone},
+		{name: "old job still processing", id: putJob(common.JobProcessing, old), expectedState: common.JobProcessing},
+	}
+
+	oldUpload, recentUpload := uuid.NewString(), uuid.NewString()
+	mockGCS.SetObject("uploads/"+oldUpload+"/session.json", []byte("{}"))
+	mockGCS.SetObject("uploads/"+oldUpload+"/chunk-00000000000000000000", []byte("a"))
+	mockGCS.SetObject("uploads/"+recentUpload+"/session.json", []byte("{}"))
+	// sessions of tenants are stored under their prefix
+	tenantUpload := "tenants/alice/uploads/" + uuid.NewString() + "/"
+	tenantJobFile := "tenants/alice/" + uuid.NewString() + "/original_a.txt"
+	mockGCS.SetObject(tenantUpload+"session.json", []byte("{}"))
+	mockGCS.SetObject(tenantJobFile, []byte("a"))
+	mockGCS.mu.Lock()
+	mockGCS.updated["uploads/"+oldUpload+"/session.json"] = old
+	mockGCS.updated["uploads/"+oldUpload+"/chunk-00000000000000000000"] = old
+	mockGCS.updated[tenantUpload+"session.json"] = old
+	mockGCS.updated[tenantJobFile] = old
+	mockGCS.mu.Unlock()
+
+	// the expired job of an owner no longer counts towards their storage
+	owned := uuid.NewString()
+	data, _ := json.Marshal(common.Job{ID: owned, Status: common.JobDone, Owner: "owner", InputSize: 5, UpdatedAt: old})
+	mockGCS.SetObject(fmt.Sprintf("jobs/%s.json", owned), data)
+	if err := common.AddStoredBytes(context.Background(), mockGCS, testBucket, "owner", 8); err != nil {
+		t.Fatalf("Failed to record stored bytes: %v", err)
+	}
+
+	if err := app.sweep(context.Background(), ttl, now); err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job, err := app.JobStore.GetJob(context.Background(), tc.id)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != tc.expectedState {
+				t.Errorf("Expected job to be %s, got %s", tc.expectedState, job.Status)
+			}
+			_, kept := mockGCS.GetObjectContent(tc.id + "/compressed.ranran")
+			if expired := tc.expectedState == common.JobExpired; kept == expired {
+				t.Errorf("Expected files to be deleted: %v, still there: %v", expired, kept)
+			}
+			if tc.expectedState == common.JobExpired && job.ResultPath != "" {
+				t.Errorf("Expected result path to be cleared, got %q", job.ResultPath)
+			}
+		})
+	}
+
+	if stored, err := common.StoredBytes(context.Background(), mockGCS, testBucket, "owner"); err != nil || stored != 3 {
+		t.Errorf("Expected 3 stored bytes left, got %d, %v", stored, err)
+	}
+	if _, ok := mockGCS.GetObjectContent("uploads/" + oldUpload + "/chunk-00000000000000000000"); ok {
+		t.Error("Expected the abandoned upload session to be deleted")
+	}
+	if _, ok := mockGCS.GetObjectContent("uploads/" + recentUpload + "/session.json"); !ok {
+		t.Error("Expected the recent upload session to be kept")
+	}
+	if _, ok := mockGCS.GetObjectContent(tenantUpload + "session.json"); ok {
+		t.Error("Expected the abandoned upload session of a tenant to be deleted")
+	}
+	if _, ok := mockGCS.GetObjectContent(tenantJobFile); !ok {
+		t.Error("Expected the files of a tenant's job to be left to its record")
+	}
+}
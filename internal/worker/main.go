@@ -1,228 +1,1143 @@
-package main
+package worker
 
 import (
-	"bufio"
 	"bytes"
+	"cmp"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/pubsub/v2"
-	"cloud.google.com/go/storage"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
 	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
 )
 
 type Application struct {
-	GCSClient  common.GCSClientInterface
-	CTX        *context.Context
-	Bucket     string
-	GCSTimeout time.Duration
+	Storage      common.StorageBackend
+	PUBSUBClient common.QueueInterface
+	JobStore     common.JobStoreInterface
+	CTX          *context.Context
+	Bucket       string
+	// GCSTimeout bounds a single call to storage, ProcessingTimeout the
+	// whole job including streaming it through the codec.
+	GCSTimeout        time.Duration
+	ProcessingTimeout time.Duration
+	// DeadLetterTopicID receives messages that will never succeed. When it is
+	// empty such messages are dropped once the failure is recorded.
+	DeadLetterTopicID   string
+	MaxDeliveryAttempts int
+	// Subscriptions maps the operations the worker handles, compress and
+	// decompress, to the subscription their jobs come from.
+	Subscriptions map[string]string
+	// StatusTopicID receives the progress of running jobs every
+	// ProgressInterval, which is also recorded on the job. Progress isn't
+	// reported when ProgressInterval is 0.
+	StatusTopicID    string
+	ProgressInterval time.Duration
+	// EventsTopicID receives a CloudEvent for every job that is DONE or
+	// FAILED, with its stats, see common.NewJobCloudEvent. No events are
+	// published when it is empty.
+	EventsTopicID string
+	// TenantPrefix is the TENANT_PREFIX of the manager, under which the
+	// janitor looks for abandoned upload sessions as well.
+	TenantPrefix string
+	// CompressTopicID and DecompressTopicID are where the janitor enqueues
+	// stranded jobs again. Compress workers enqueue the parts of split jobs
+	// on CompressTopicID too.
+	CompressTopicID   string
+	DecompressTopicID string
+	// PriorityWeights receives from a subscription per priority, see
+	// common.PriorityTopic, sharing Concurrency job slots between them by
+	// weight. When it is nil only the Subscriptions themselves are received
+	// from.
+	PriorityWeights map[string]int
+	Concurrency     int
+	// CheckpointSize compresses originals larger than it a chunk of that
+	// many bytes at a time, recording every chunk so that a redelivered job
+	// resumes where the last one stopped. 0 compresses them at once.
+	CheckpointSize int64
+	// ParallelReads is how many range reads of ParallelReadPartSize bytes
+	// an input larger than that is downloaded with at a time, see
+	// openInput. 1 reads inputs in one go.
+	ParallelReads        int
+	ParallelReadPartSize int64
+
+	// cancelWork aborts the jobs still running when Listen gives up on them
+	cancelWork context.CancelFunc
+	// dictionaries caches the compression dictionaries by ID
+	dictionaries sync.Map
 }
 
-func (app *Application) compressMessageHandler(_ context.Context, msg common.MessageInterface) {
-	var job common.CompressedMsgSchema
-	if err := json.Unmarshal(msg.GetData(), &job); err != nil {
-		slog.Error("Failed to unmarshal body from job message", "error", err)
-		msg.Nack()
-		return
+// errPoisonMessage marks a message that can never be processed, no matter how
+// often it is redelivered.
+var errPoisonMessage = common.NewError(common.ErrPermanent, "poison message")
+
+// messageError classifies a message that couldn't be decoded: one written
+// for a newer worker is retried, anything else is poison.
+func messageError(err error) error {
+	if errors.Is(err, common.ErrUnsupportedMessageVersion) {
+		return err
 	}
+	return fmt.Errorf("%w: %v", errPoisonMessage, err)
+}
+
+// errJobCanceled aborts a status update of a job the client canceled.
+var errJobCanceled = errors.New("job was canceled")
+
+// isPermanent reports whether err comes from the job's input rather than from
+// a transient failure, so retrying it is pointless. Besides the error classes
+// of common, the codecs report bad input with errors of their own.
+func isPermanent(err error) bool {
+	if common.IsPermanent(err) || compression.IsCorrupt(err) {
+		return true
+	}
+	for _, target := range []error{
+		compression.ErrUnknownCodec,
+		compression.ErrUnsupportedLevel,
+		compression.ErrNoDictionarySupport,
+		compression.ErrWasmLimit,
+		compression.ErrPluginTimeout,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// setJobStatus records the job's new state, applying update (when not nil)
+// for any extra fields. A failure to update the job store is only logged
+// since it must not decide whether the job itself succeeded. Canceled jobs
+// keep their status, and open append jobs stay open while a segment is
+// retried. Jobs that end up DONE or FAILED get their CloudEvent published.
+func (app *Application) setJobStatus(jobID string, status common.JobStatus, reason string, update func(job *common.Job)) {
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
 
-	slog.Info("Received job", "job", job.UID)
+	job, err := app.JobStore.UpdateJob(ctx, jobID, func(job *common.Job) error {
+		if job.Status == common.JobCanceled {
+			return errJobCanceled
+		}
+		if job.Status == common.JobOpen && status == common.JobPending {
+			status = common.JobOpen
+		}
+		job.Status = status
+		job.Error = reason
+		if update != nil {
+			update(job)
+		}
+		app.queueJobEvent(job)
+		return nil
+	})
+	if errors.Is(err, errJobCanceled) {
+		slog.Info("Job was canceled, not updating its status", "job", jobID, "status", status)
+	} else if err != nil {
+		slog.Warn("Failed to update job status", "job", jobID, "status", status, "error", err)
+	} else {
+		app.publishJobEvents(ctx, job)
+	}
+}
 
-	// Download character frequency table from GCS
+// attempts returns how often workers have started on the job, as recorded on
+// the job record. Every part of a split job counts its own starts, so they
+// are spread over the parts.
+func (app *Application) attempts(jobID string) int {
 	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
 	defer cancel()
 
-	freqTableReader, err := app.GCSClient.NewObjectReader(ctx, app.Bucket, job.FreqTablePath)
+	job, err := app.JobStore.GetJob(ctx, jobID)
 	if err != nil {
-		slog.Error("Failed to download character frequency table", "job", job.UID, "error", err)
+		return 0
+	}
+	return job.Attempts / max(job.Parts, 1)
+}
+
+// failJob records why the job failed. Failures that may go away on their own
+// are nacked so Pub/Sub redelivers the message; permanent ones, and messages
+// out of delivery attempts, are sent to the dead letter topic instead. A
+// dependency that is down doesn't use up the attempts, the job itself isn't
+// at fault.
+func (app *Application) failJob(msg common.MessageInterface, jobID, reason string, err error) {
+	reason = fmt.Sprintf("%s: %v", reason, err)
+	// without a dead letter policy Pub/Sub doesn't count, the job record does
+	attempt := msg.DeliveryAttempt()
+	if jobID != "" {
+		attempt = max(attempt, app.attempts(jobID))
+	}
+	unavailable := common.Classify(err) == common.ErrUnavailable
+	if !isPermanent(err) && (attempt < app.MaxDeliveryAttempts || unavailable) {
+		slog.Error("Job failed, retrying", "job", jobID, "attempt", attempt, "error", reason)
+		app.recordEvent(jobID, common.JobEvent{Type: common.EventFailed, Reason: reason + " (retrying)"})
+		if jobID != "" {
+			app.setJobStatus(jobID, common.JobPending, reason, nil)
+		}
 		msg.Nack()
 		return
 	}
-	defer freqTableReader.Close()
 
-	var freqTable map[rune]uint64
-	if err := json.NewDecoder(freqTableReader).Decode(&freqTable); err != nil {
-		slog.Error("Failed to decode character frequency table", "job", job.UID, "error", err)
+	slog.Error("Job failed permanently", "job", jobID, "attempt", attempt, "error", reason)
+	app.recordEvent(jobID, common.JobEvent{Type: common.EventFailed, Reason: reason})
+	if jobID != "" {
+		app.setJobStatus(jobID, common.JobFailed, reason, nil)
+	}
+	if err := app.deadLetter(msg, jobID, reason); err != nil {
+		// keep the message around rather than lose it
+		slog.Error("Failed to send message to dead letter topic", "job", jobID, "error", err)
 		msg.Nack()
 		return
 	}
-	slog.Debug("Downloaded character frequency table", "job", job.UID)
+	msg.Ack()
+}
 
-	huffmanTree, prefixTable, err := buildHuffmanTree(freqTable)
+// requestID is the ID of the request that created the job of msg, passed on
+// by the manager, so the logs of the job can be found with it.
+func requestID(msg common.MessageInterface) string {
+	return msg.Attributes()[common.RequestIDAttribute]
+}
+
+// deadLetter publishes the original message with the failure attached.
+func (app *Application) deadLetter(msg common.MessageInterface, jobID, reason string) error {
+	if app.DeadLetterTopicID == "" {
+		slog.Warn("No dead letter topic configured, dropping message", "job", jobID)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	_, err := app.PUBSUBClient.PublishMessage(ctx, app.DeadLetterTopicID, &pubsub.Message{
+		Data: msg.GetData(),
+		Attributes: map[string]string{
+			"job_id":                  jobID,
+			"failure_reason":          reason,
+			"delivery_attempt":        strconv.Itoa(msg.DeliveryAttempt()),
+			common.RequestIDAttribute: requestID(msg),
+		},
+	})
+	return err
+}
+
+// readinessChecks are the dependencies the worker can't process jobs without.
+func (app *Application) readinessChecks() map[string]common.Check {
+	return map[string]common.Check{
+		"storage": func(ctx context.Context) error {
+			return app.Storage.CheckBucket(ctx, app.Bucket)
+		},
+		"pubsub": func(ctx context.Context) error {
+			for _, sub := range app.subscriptions() {
+				if err := app.PUBSUBClient.CheckSubscription(ctx, sub.id); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// alreadyDone reports whether an earlier delivery of the job's message has
+// finished it, which is expected as Pub/Sub delivers at least once, or the
+// client canceled it.
+func (app *Application) alreadyDone(jobID string) bool {
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	job, err := app.JobStore.GetJob(ctx, jobID)
 	if err != nil {
-		slog.Error("Failed to HuffmanTree", "job", job.UID, "error", err)
-		msg.Nack()
-		return
+		// without a record there is nothing to go by, so do the work
+		return false
 	}
-	slog.Debug("Built Huffman Tree", "job", job.UID)
+	return job.Status == common.JobDone || job.Status == common.JobCanceled
+}
 
-	// stream file content down and compress
-	ogFileReader, err := app.GCSClient.NewObjectReader(ctx, app.Bucket, job.OriginalFilePath)
+// openInput opens the input of a job for reading it whole. With
+// ParallelReads above 1, inputs larger than ParallelReadPartSize are read in
+// parts that many at a time, which gets more out of a fast network than a
+// single stream does.
+func (app *Application) openInput(ctx context.Context, bucket, object string) (common.ObjectReaderInterface, error) {
+	if app.ParallelReads <= 1 || app.ParallelReadPartSize <= 0 {
+		return app.Storage.NewObjectReader(ctx, bucket, object)
+	}
+	info, err := app.Storage.StatObject(ctx, bucket, object)
 	if err != nil {
-		slog.Error("Failed to locate original file content", "job", job.UID, "error", err)
-		msg.Nack()
-		return
+		return nil, err
 	}
-	defer ogFileReader.Close()
+	if info.Size <= app.ParallelReadPartSize {
+		return app.Storage.NewObjectReader(ctx, bucket, object)
+	}
+	slog.Debug("Reading input in parallel", "object", object, "bytes", info.Size, "parts", (info.Size+app.ParallelReadPartSize-1)/app.ParallelReadPartSize)
+	return common.NewParallelReader(ctx, app.Storage, bucket, info, app.ParallelReadPartSize, app.ParallelReads), nil
+}
+
+// streamToStorage uploads whatever produce writes to the given object through a
+// pipe, so only small buffers are held in memory regardless of object size.
+// Returns the number of bytes uploaded, and common.ErrObjectExists if the
+// object is already there. A panic of produce fails the upload.
+func (app *Application) streamToStorage(ctx context.Context, object string, produce func(w io.Writer) error, opts ...common.ObjectWriterOption) (int64, error) {
+	return app.streamToBucket(ctx, app.Bucket, object, produce, opts...)
+}
 
-	ogFileBytes, err := io.ReadAll(ogFileReader)
+// streamToBucket is streamToStorage for an object in bucket.
+func (app *Application) streamToBucket(ctx context.Context, bucket, object string, produce func(w io.Writer) error, opts ...common.ObjectWriterOption) (int64, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		defer func() { pw.CloseWithError(err) }()
+		defer recoverPanic("stream", &err)
+		err = produce(pw)
+	}()
+
+	opts = append(opts, common.WithIfNotExists())
+	wc := app.Storage.NewObjectWriter(ctx, bucket, object, opts...)
+	n, err := copyChunks(wc, pr)
 	if err != nil {
-		slog.Error("Failed to download data to GCS", "job", job.UID, "error", err)
-		msg.Nack()
+		// unblock the producing goroutine if the upload side failed
+		pr.CloseWithError(err)
+		return n, err
+	}
+	if err := wc.Close(); err != nil {
+		if errors.Is(err, common.ErrObjectExists) {
+			return n, err
+		}
+		return n, fmt.Errorf("failed to close stream to storage: %w", err)
+	}
+	return n, nil
+}
+
+// lookupCodec resolves an algorithm name to a codec, using the worker's own
+// Huffman implementation instead of the compression package's chunked one.
+func (app *Application) lookupCodec(name string) (compression.Codec, error) {
+	if name == "" || name == common.AlgorithmHuffman {
+		return huffmanCodec{}, nil
+	}
+	return compression.Lookup(name)
+}
+
+// compressCodec picks how the original of job gets encoded. Huffman needs a
+// first pass over what open returns to count the runes. On failure reason
+// says which step failed.
+func (app *Application) compressCodec(ctx context.Context, job common.CompressedMsgSchema, open func() (common.ObjectReaderInterface, error)) (compression.Codec, string, error) {
+	var codec compression.Codec
+	if job.Algorithm == "" || job.Algorithm == common.AlgorithmHuffman {
+		// count the runes of the original before encoding it in a second pass
+		original, err := open()
+		if err != nil {
+			return nil, "Failed to locate original file content", err
+		}
+		var src io.Reader = original
+		if job.Archive {
+			src = compression.TarContents(original)
+		}
+		freqTable, err := buildFreqTable(src)
+		original.Close()
+		if err != nil {
+			return nil, "Failed to build character frequency table", err
+		}
+		slog.Debug("Built character frequency table", "job", job.UID)
+
+		huffmanTree, prefixTable, err := buildHuffmanTree(freqTable)
+		if err != nil {
+			return nil, "Failed to HuffmanTree", err
+		}
+		slog.Debug("Built Huffman Tree", "job", job.UID)
+
+		codec = huffmanCodec{root: huffmanTree[0], pt: prefixTable}
+	} else {
+		var err error
+		codec, err = compression.Lookup(job.Algorithm)
+		if err != nil {
+			return nil, "Failed to select codec", err
+		}
+	}
+	codec, err := compression.WithLevel(codec, job.Level)
+	if err != nil {
+		// redelivering won't make the level valid
+		return nil, "Failed to set compression level", fmt.Errorf("%w: %v", errPoisonMessage, err)
+	}
+	// plugins stop with the job
+	codec = compression.WithContext(ctx, codec)
+	if job.Dictionary != "" {
+		dict, err := app.loadDictionary(ctx, job.Dictionary)
+		if err != nil {
+			return nil, "Failed to load dictionary", err
+		}
+		if codec, err = compression.WithDictionary(codec, dict); err != nil {
+			return nil, "Failed to load dictionary", err
+		}
+	}
+	return codec, "", nil
+}
+
+func (app *Application) compressMessageHandler(_ context.Context, msg common.MessageInterface) {
+	msg = countAcks(msg, common.OperationCompress)
+	var job common.CompressedMsgSchema
+	if err := common.UnmarshalMessage(msg.GetData(), &job); err != nil {
+		app.failJob(msg, "", "Failed to unmarshal body from job message", messageError(err))
 		return
 	}
-	slog.Debug("Downloaded text data", "job", job.UID)
 
-	// reset the file cursor back to the beginning
-	fileReader := bufio.NewReader(bytes.NewReader(ogFileBytes))
+	if job.Segment > 0 {
+		app.appendMessageHandler(msg, job)
+		return
+	}
+	if job.Parts > 0 {
+		app.splitMessageHandler(msg, job)
+		return
+	}
 
-	compFileBuf, err := compress(huffmanTree[0], prefixTable, fileReader)
+	slog.Info("Received job", "job", job.UID, "request_id", requestID(msg))
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventDequeued})
+	if app.alreadyDone(job.UID) {
+		slog.Info("Job is already done or canceled, skipping delivery", "job", job.UID)
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: "already done or canceled"})
+		jobsProcessed.WithLabelValues(common.OperationCompress, "skipped").Inc()
+		msg.Ack()
+		return
+	}
+	start := time.Now()
+	app.setJobStatus(job.UID, common.JobProcessing, "", func(j *common.Job) {
+		j.Attempts++
+	})
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventStarted})
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.ProcessingTimeout)
+	defer cancel()
+
+	// in-place jobs read the original from their owner's bucket
+	sourceBucket := app.Bucket
+	if job.SourceBucket != "" {
+		sourceBucket = job.SourceBucket
+	}
+	openOriginal := func() (common.ObjectReaderInterface, error) {
+		return app.openInput(ctx, sourceBucket, job.OriginalFilePath)
+	}
+	// only a sample is read, not worth fetching parts ahead for
+	stored := app.incompressible(job, func() (common.ObjectReaderInterface, error) {
+		return app.Storage.NewObjectReader(ctx, sourceBucket, job.OriginalFilePath)
+	})
+	if stored {
+		slog.Info("Original is incompressible, storing it as it is", "job", job.UID)
+		job.Algorithm, job.Level, job.Dictionary = common.AlgorithmStore, 0, ""
+	}
+	if app.CheckpointSize > 0 {
+		info, err := app.Storage.StatObject(ctx, sourceBucket, job.OriginalFilePath)
+		if err != nil {
+			app.failJob(msg, job.UID, "Failed to locate original file content", err)
+			return
+		}
+		if chunks := app.checkpointChunks(job, info.Size); chunks > 0 {
+			app.compressCheckpointed(ctx, msg, job, info.Size, chunks, stored)
+			return
+		}
+	}
+	codec, reason, err := app.compressCodec(ctx, job, openOriginal)
 	if err != nil {
-		slog.Error("Failed to compress data", "job", job.UID, "error", err)
-		msg.Nack()
+		app.failJob(msg, job.UID, reason, err)
 		return
 	}
 
-	compressedFilePath := fmt.Sprintf("%s/compressed.ranran", job.UID)
-	wc := app.GCSClient.NewObjectWriter(ctx, app.Bucket, compressedFilePath)
-	if _, err := io.Copy(wc, compFileBuf); err != nil {
-		slog.Error("Failed to upload compressed data to GCS", "job", job.UID, "error", err)
-		msg.Nack()
+	// archives are read twice, first to index the members for the header
+	var members []compression.ArchiveMember
+	if job.Archive {
+		if !common.UsesContainer(job.Algorithm) {
+			app.failJob(msg, job.UID, "Failed to select codec", fmt.Errorf("%w: %s output can't hold an archive", errPoisonMessage, job.Algorithm))
+			return
+		}
+		tarball, err := openOriginal()
+		if err != nil {
+			app.failJob(msg, job.UID, "Failed to locate original file content", err)
+			return
+		}
+		members, err = compression.IndexTar(tarball)
+		tarball.Close()
+		if err != nil {
+			app.failJob(msg, job.UID, "Failed to index archive", err)
+			return
+		}
+		slog.Debug("Indexed archive", "job", job.UID, "members", len(members))
+	}
+
+	// stream file content down and compress
+	readStart := time.Now()
+	ogFileReader, err := openOriginal()
+	if err != nil {
+		app.failJob(msg, job.UID, "Failed to locate original file content", err)
 		return
 	}
-	if err := wc.Close(); err != nil {
-		slog.Error("Failed to close data compressing stream to GCS", "job", job.UID, "error", err)
-		msg.Nack()
+	defer ogFileReader.Close()
+	observeSince(storageDuration.WithLabelValues(common.OperationCompress, "read"), readStart)
+	in := &countingReader{r: app.trackProgress(ctx, job.UID, common.OperationCompress, job.OriginalFilePath, ogFileReader)}
+
+	// older messages don't carry the name, it is still part of the object path
+	meta := compression.ContainerMetadata{Name: job.FileName, ContentType: job.ContentType, Dictionary: job.Dictionary}
+	if meta.Name == "" {
+		meta.Name = strings.TrimPrefix(path.Base(job.OriginalFilePath), "original_")
+	}
+
+	compressedFilePath := fmt.Sprintf("%s/compressed%s", jobDir(job.OriginalFilePath), common.AlgorithmExtension(job.Algorithm))
+	resultBucket := app.Bucket
+	writeOpts := []common.ObjectWriterOption{common.WithKMSKey(job.KMSKeyName)}
+	if job.ResultPath != "" {
+		compressedFilePath = job.ResultPath
+	}
+	if job.ResultBucket != "" {
+		resultBucket = job.ResultBucket
+		// tells our result from an object of the owner of the same name
+		writeOpts = append(writeOpts, common.WithMetadata(map[string]string{jobMetadataKey: job.UID}))
+	}
+	writeStart := time.Now()
+	digest := sha256.New()
+	out, err := app.streamToBucket(ctx, resultBucket, compressedFilePath, func(w io.Writer) error {
+		w = io.MultiWriter(&chunkEvents{app: app, jobID: job.UID, w: w}, digest)
+		codec := codec
+		// a failed verification fails the upload, so the output is never stored
+		var verify *roundTrip
+		if job.Verify {
+			verify, codec = app.newRoundTrip(ctx, job, codec)
+			w = io.MultiWriter(w, verify)
+		}
+		var err error
+		if job.Archive {
+			err = compression.WriteArchive(w, codec, in, members, meta)
+		} else if common.UsesContainer(job.Algorithm) {
+			err = compression.WriteContainer(w, codec, in, meta)
+		} else {
+			err = codec.Compress(in, w)
+		}
+		if verify != nil {
+			if verifyErr := verify.Close(); err == nil {
+				err = verifyErr
+			}
+		}
+		return err
+	}, writeOpts...)
+	if errors.Is(err, common.ErrObjectExists) && job.ResultBucket != "" {
+		if err := app.checkOwnResult(ctx, resultBucket, compressedFilePath, job.UID); err != nil {
+			app.failJob(msg, job.UID, "Result object already exists", err)
+			return
+		}
+	}
+	manifest := common.Manifest{
+		JobID:       job.UID,
+		Operation:   common.OperationCompress,
+		FileName:    meta.Name,
+		ContentType: job.ContentType,
+		Algorithm:   cmp.Or(job.Algorithm, common.AlgorithmHuffman),
+		Level:       job.Level,
+		Stored:      stored,
+		Result:      compressedFilePath,
+		InputSize:   in.n,
+		OutputSize:  out,
+		StartedAt:   start.UTC(),
+	}
+	if errors.Is(err, common.ErrObjectExists) {
+		// an earlier delivery got as far as uploading the result
+		slog.Info("Compressed data is already in storage", "job", job.UID)
+	} else if err != nil {
+		app.failJob(msg, job.UID, "Failed to compress data to storage", err)
 		return
+	} else {
+		manifest.SHA256 = hex.EncodeToString(digest.Sum(nil))
 	}
-	slog.Debug("Uploaded compressed data to GCS", "job", job.UID)
+	observeSince(storageDuration.WithLabelValues(common.OperationCompress, "write"), writeStart)
+	slog.Debug("Uploaded compressed data to storage", "job", job.UID)
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventUploaded})
+	manifest = app.writeManifest(ctx, resultBucket, manifest, writeOpts...)
 
+	app.setJobStatus(job.UID, common.JobDone, "", func(j *common.Job) {
+		j.ResultPath = compressedFilePath
+		j.OutputSize = manifest.OutputSize
+		j.ResultBucket = job.ResultBucket
+		j.Stored = stored
+	})
 	msg.Ack()
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked})
+	observeJob(common.OperationCompress, start, in.n, out)
 	slog.Info("Completed processing job", "job", job.UID)
 }
 
+// defaultResultName is used when no usable file name is left.
+const defaultResultName = "file.txt"
+
+// jobDir is the directory of the objects of the job whose input is at
+// inputPath. Results and the files in between are stored next to the input,
+// which the manager put under the job ID or its tenant's prefix.
+func jobDir(inputPath string) string {
+	return path.Dir(inputPath)
+}
+
+// restoredFileName turns a name taken from a container into a safe object
+// name, since the container may have been crafted by anyone.
+func restoredFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." || name == "" {
+		return defaultResultName
+	}
+	return name
+}
+
 func (app *Application) decompressMessageHandler(_ context.Context, msg common.MessageInterface) {
+	msg = countAcks(msg, common.OperationDecompress)
 	var job common.DecompressedMsgSchema
-	if err := json.Unmarshal(msg.GetData(), &job); err != nil {
-		slog.Error("Failed to unmarshal body from job message", "error", err)
-		msg.Nack()
+	if err := common.UnmarshalMessage(msg.GetData(), &job); err != nil {
+		app.failJob(msg, "", "Failed to unmarshal body from job message", messageError(err))
 		return
 	}
 
-	slog.Info("Received job", "job", job.UID)
+	slog.Info("Received job", "job", job.UID, "request_id", requestID(msg))
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventDequeued})
+	if app.alreadyDone(job.UID) {
+		slog.Info("Job is already done or canceled, skipping delivery", "job", job.UID)
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: "already done or canceled"})
+		jobsProcessed.WithLabelValues(common.OperationDecompress, "skipped").Inc()
+		msg.Ack()
+		return
+	}
+	start := time.Now()
+	app.setJobStatus(job.UID, common.JobProcessing, "", func(j *common.Job) {
+		j.Attempts++
+	})
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventStarted})
 
-	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	ctx, cancel := context.WithTimeout(*app.CTX, app.ProcessingTimeout)
 	defer cancel()
 
-	compFile, err := app.GCSClient.NewObjectReader(ctx, app.Bucket, job.CompressedFilePath)
+	readStart := time.Now()
+	compObject, err := app.openInput(ctx, app.Bucket, job.CompressedFilePath)
 	if err != nil {
-		slog.Error("Failed to locate compressed file content", "job", job.UID, "error", err)
-		msg.Nack()
+		app.failJob(msg, job.UID, "Failed to locate compressed file content", err)
 		return
 	}
-	defer compFile.Close()
+	defer compObject.Close()
+	observeSince(storageDuration.WithLabelValues(common.OperationDecompress, "read"), readStart)
+	compFile := &countingReader{r: app.trackProgress(ctx, job.UID, common.OperationDecompress, job.CompressedFilePath, compObject)}
+	src := getReader(compFile)
+	defer putReader(src)
 
-	fileBytes, err := io.ReadAll(compFile)
+	// the container header says what the original file was called, so it has
+	// to be read before the output object can be opened.
+	var header *compression.ContainerHeader
+	isContainer := strings.HasSuffix(job.CompressedFilePath, common.ContainerExtension)
+	if isContainer {
+		// .ranran files from before the container format are bare Huffman streams
+		if magic, _ := src.Peek(len(compression.ContainerMagic)); !bytes.Equal(magic, compression.ContainerMagic) {
+			isContainer = false
+			job.Algorithm = common.AlgorithmHuffman
+		}
+	}
+	if isContainer {
+		header, err = compression.ReadContainerHeader(src)
+		if err != nil {
+			app.failJob(msg, job.UID, "Failed to read container header", err)
+			return
+		}
+	} else {
+		header = &compression.ContainerHeader{}
+	}
+
+	// without metadata, name the result after the upload minus its extension
+	name := header.Metadata.Name
+	if name == "" {
+		base := path.Base(job.CompressedFilePath)
+		name = strings.TrimSuffix(base, path.Ext(base))
+	}
+	dir := jobDir(job.CompressedFilePath)
+	resultFilePath := fmt.Sprintf("%s/%s", dir, restoredFileName(name))
+	if resultFilePath == job.CompressedFilePath {
+		resultFilePath = fmt.Sprintf("%s/%s", dir, defaultResultName)
+	}
+	contentType := header.Metadata.ContentType
+	writeStart := time.Now()
+	// the result is encrypted with the same key as the input
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, resultFilePath,
+		common.WithContentType(contentType), common.WithIfNotExists(), common.WithKMSKey(job.KMSKeyName))
+	digest := sha256.New()
+	out := &countingWriter{w: io.MultiWriter(&chunkEvents{app: app, jobID: job.UID, w: wc}, digest)}
+
+	// the dictionary a container was compressed with is needed to decompress it
+	lookup, err := app.dictionaryLookup(ctx, header.Metadata.Dictionary)
 	if err != nil {
-		slog.Error("Failed to download data to GCS", "job", job.UID, "error", err)
-		msg.Nack()
+		app.failJob(msg, job.UID, "Failed to load dictionary", err)
 		return
 	}
+	if isContainer && header.Metadata.Archive {
+		// restore the members as a tarball
+		archive := compression.NewArchiveWriter(out, header.Metadata.Members)
+		err = compression.ReadContainerPayload(src, header, archive, lookup)
+		if err == nil {
+			err = archive.Close()
+		}
+	} else if isContainer {
+		// the checksum in the trailer has to match before the result is committed
+		err = compression.ReadContainerPayload(src, header, out, lookup)
+	} else {
+		var codec compression.Codec
+		codec, err = app.lookupCodec(job.Algorithm)
+		if err == nil {
+			err = compression.WithContext(ctx, codec).Decompress(src, out)
+		}
+	}
+	if err != nil && compFile.err == nil && out.err == nil && !isPermanent(err) {
+		// neither reading nor writing failed, so the compressed data is bad
+		err = fmt.Errorf("%w: %v", common.ErrCorruptInput, err)
+	}
+	if err != nil {
+		app.failJob(msg, job.UID, "failed to decompress data", err)
+		return
+	}
+	manifest := common.Manifest{
+		JobID:       job.UID,
+		Operation:   common.OperationDecompress,
+		FileName:    name,
+		ContentType: contentType,
+		Algorithm:   cmp.Or(header.Algorithm, job.Algorithm),
+		Result:      resultFilePath,
+		InputSize:   compFile.n,
+		OutputSize:  out.n,
+		StartedAt:   start.UTC(),
+	}
+	if err := wc.Close(); errors.Is(err, common.ErrObjectExists) {
+		// an earlier delivery got as far as uploading the result
+		slog.Info("Decompressed data is already in storage", "job", job.UID)
+	} else if err != nil {
+		app.failJob(msg, job.UID, "Failed to close data stream to storage", err)
+		return
+	} else {
+		manifest.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	}
+	observeSince(storageDuration.WithLabelValues(common.OperationDecompress, "write"), writeStart)
+	slog.Debug("Uploaded final data to storage", "job", job.UID)
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventUploaded})
+	manifest = app.writeManifest(ctx, app.Bucket, manifest, common.WithKMSKey(job.KMSKeyName))
 
-	slog.Debug("Downloaded compressed file from GCS.", "job", job.UID)
+	app.setJobStatus(job.UID, common.JobDone, "", func(j *common.Job) {
+		j.ResultPath = resultFilePath
+		j.OutputSize = manifest.OutputSize
+		j.ResultContentType = contentType
+	})
+	msg.Ack()
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked})
+	observeJob(common.OperationDecompress, start, compFile.n, out.n)
+	slog.Info("Completed processing job", "job", job.UID)
+}
 
-	resultFilePath := fmt.Sprintf("%s/file.txt", job.UID)
-	wc := app.GCSClient.NewObjectWriter(ctx, app.Bucket, resultFilePath)
+// NewApplication builds a worker that takes its jobs from the subscriptions
+// of queue, by operation.
+func NewApplication(ctx context.Context, storage common.StorageBackend, queue common.QueueInterface, bucket string, subscriptions map[string]string) *Application {
+	// jobs run on their own context so a shutdown signal stops new messages
+	// from arriving without aborting the ones being handled.
+	workCtx, cancelWork := context.WithCancel(ctx)
+	return &Application{
+		Storage:              common.NewChecksumStorage(storage),
+		PUBSUBClient:         queue,
+		JobStore:             &common.GCSJobStore{Client: storage, Bucket: bucket},
+		CTX:                  &workCtx,
+		Bucket:               bucket,
+		GCSTimeout:           50 * time.Second,
+		ProcessingTimeout:    common.GetEnvDuration("PROCESSING_TIMEOUT", 2*time.Hour),
+		DeadLetterTopicID:    os.Getenv("PUBSUB_DEAD_LETTER_TOPIC_ID"),
+		MaxDeliveryAttempts:  common.GetEnvInt("MAX_DELIVERY_ATTEMPTS", 5),
+		Subscriptions:        subscriptions,
+		CompressTopicID:      os.Getenv("PUBSUB_COMPRESS_TOPIC_ID"),
+		DecompressTopicID:    os.Getenv("PUBSUB_DECOMPRESS_TOPIC_ID"),
+		StatusTopicID:        os.Getenv("PUBSUB_STATUS_TOPIC_ID"),
+		EventsTopicID:        os.Getenv("PUBSUB_EVENTS_TOPIC_ID"),
+		TenantPrefix:         os.Getenv("TENANT_PREFIX"),
+		ProgressInterval:     common.GetEnvDuration("PROGRESS_INTERVAL", 10*time.Second),
+		PriorityWeights:      priorityWeights(),
+		Concurrency:          common.GetEnvInt("WORKER_CONCURRENCY", runtime.NumCPU()),
+		CheckpointSize:       int64(common.GetEnvInt("CHECKPOINT_SIZE", 0)),
+		ParallelReads:        common.GetEnvInt("PARALLEL_READS", 1),
+		ParallelReadPartSize: int64(common.GetEnvInt("PARALLEL_READ_PART_SIZE", 32<<20)),
+		cancelWork:           cancelWork,
+	}
+}
 
-	err = decompress(bytes.NewBuffer(fileBytes), wc)
-	if err != nil {
-		slog.Error("failed to decompress data", "job", job.UID, "error", err)
+// defaultPriorityWeights favors high priority jobs without starving low ones.
+const defaultPriorityWeights = "high=4,normal=2,low=1"
+
+// priorityWeights reads PRIORITY_WEIGHTS when PRIORITY_TOPICS is enabled.
+func priorityWeights() map[string]int {
+	if !common.GetEnvBool("PRIORITY_TOPICS", false) {
+		return nil
+	}
+	value := os.Getenv("PRIORITY_WEIGHTS")
+	if value == "" {
+		value = defaultPriorityWeights
+	}
+	weights, err := common.ParsePriorityWeights(value)
+	if err != nil || len(weights) == 0 {
+		slog.Warn("Invalid priority weights, using default", "value", value, "default", defaultPriorityWeights, "error", err)
+		weights, _ = common.ParsePriorityWeights(defaultPriorityWeights)
+	}
+	return weights
+}
+
+// subscription is one subscription the worker receives from, for jobs of
+// operation at priority. Priority is empty without priority topics.
+type subscription struct {
+	id, operation, priority string
+}
+
+// subscriptions lists the subscriptions the worker receives from.
+func (app *Application) subscriptions() []subscription {
+	var subs []subscription
+	for _, operation := range []string{common.OperationCompress, common.OperationDecompress} {
+		subID, ok := app.Subscriptions[operation]
+		if !ok {
+			continue
+		}
+		if app.PriorityWeights == nil {
+			subs = append(subs, subscription{id: subID, operation: operation})
+			continue
+		}
+		for _, priority := range common.Priorities {
+			if app.PriorityWeights[priority] > 0 {
+				subs = append(subs, subscription{id: common.PriorityTopic(subID, priority), operation: operation, priority: priority})
+			}
+		}
+	}
+	return subs
+}
+
+// resources are the bucket, the topics the worker publishes to and, unless
+// they push, the subscriptions it receives from, see common.Bootstrap.
+func (app *Application) resources(push bool) common.Resources {
+	res := common.Resources{
+		Bucket: app.Bucket,
+		Topics: []string{app.CompressTopicID, app.DecompressTopicID, app.DeadLetterTopicID, app.StatusTopicID, app.EventsTopicID},
+	}
+	if push {
+		return res
+	}
+	topics := map[string]string{common.OperationCompress: app.CompressTopicID, common.OperationDecompress: app.DecompressTopicID}
+	for _, sub := range app.subscriptions() {
+		res.Subscriptions = append(res.Subscriptions, common.SubscriptionResource{
+			ID:              sub.id,
+			Topic:           common.PriorityTopic(topics[sub.operation], sub.priority),
+			DeadLetterTopic: app.DeadLetterTopicID,
+			// the worker forwards failed jobs with their reason itself,
+			// Pub/Sub only once a worker kept crashing on one
+			MaxDeliveryAttempts: app.MaxDeliveryAttempts + 1,
+		})
+	}
+	return res
+}
+
+// receive runs handler on the messages of every subscription until ctx is
+// done or one of them fails. With priorities the handler only runs once the
+// message got one of the job slots, which all subscriptions share.
+func (app *Application) receive(ctx context.Context, handler func(ctx context.Context, operation string, msg common.MessageInterface)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var selector *prioritySelector
+	if app.PriorityWeights != nil {
+		selector = newPrioritySelector(app.Concurrency, app.PriorityWeights)
+	}
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, sub := range app.subscriptions() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := app.PUBSUBClient.Receive(ctx, sub.id, func(ctx context.Context, msg common.MessageInterface) {
+				if selector != nil {
+					if !selector.acquire(ctx, sub.priority) {
+						msg.Nack()
+						return
+					}
+					defer selector.release()
+				}
+				handler(ctx, sub.operation, msg)
+			})
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("receiving from %s: %w", sub.id, err)
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// handleMessage runs the job of msg, an operation job, tracked in jobs. It
+// nacks msg instead once the worker is shutting down or while a dependency
+// is down. A job whose handler panics fails, see recoverJob.
+func (app *Application) handleMessage(ctx context.Context, jobs *inflight, operation string, msg common.MessageInterface) {
+	done, ok := jobs.track(msg)
+	if !ok {
+		// shutting down, leave it to another worker
 		msg.Nack()
 		return
 	}
-	if err := wc.Close(); err != nil {
-		slog.Error("Failed to close data stream to GCS", "job", job.UID, "error", err)
+	defer done()
+	if b := common.OpenCircuit(app.Storage, app.PUBSUBClient); b != nil {
+		// the job would only fail against a dependency that is down
+		slog.Debug("Circuit open, nacking message", "dependency", b.Name)
 		msg.Nack()
 		return
 	}
-	slog.Debug("Uploaded final data to GCS", "job", job.UID)
+	guarded := &settledMessage{MessageInterface: msg}
+	defer app.recoverJob(operation, guarded)
+	if operation == common.OperationDecompress {
+		app.decompressMessageHandler(ctx, guarded)
+	} else {
+		app.compressMessageHandler(ctx, guarded)
+	}
+}
 
-	msg.Ack()
-	slog.Info("Completed processing job", "job", job.UID)
+// Listen handles the jobs of every operation in Subscriptions until ctx is
+// done. It then waits up to shutdownTimeout for the jobs in flight and nacks
+// the rest.
+func (app *Application) Listen(ctx context.Context, shutdownTimeout time.Duration) error {
+	var jobs inflight
+	handler := func(ctx context.Context, operation string, msg common.MessageInterface) {
+		app.handleMessage(ctx, &jobs, operation, msg)
+	}
+
+	slog.Info("Listening for new messages...", "subscriptions", app.Subscriptions)
+	received := make(chan error, 1)
+	go func() {
+		received <- app.receive(ctx, handler)
+	}()
+
+	var err error
+	select {
+	case err = <-received:
+	case <-ctx.Done():
+		slog.Info("Shutting down, waiting for in-flight jobs", "timeout", shutdownTimeout)
+		if !jobs.drain(shutdownTimeout) {
+			n := jobs.nackAll()
+			slog.Warn("In-flight jobs did not finish in time, nacked them for redelivery", "count", n)
+			if app.cancelWork != nil {
+				app.cancelWork()
+			}
+		}
+		err = <-received
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// subscriptionsFromEnv maps the operations listed in WORKER_OPERATIONS to
+// the subscriptions in PUBSUB_COMPRESS_SUB_ID and PUBSUB_DECOMPRESS_SUB_ID.
+// A worker handling a single operation may name its subscription in
+// PUBSUB_SUB_ID instead.
+func subscriptionsFromEnv() (map[string]string, error) {
+	operations := os.Getenv("WORKER_OPERATIONS")
+	if operations == "" {
+		operations = common.OperationCompress
+	}
+	subs := map[string]string{}
+	for _, operation := range strings.Split(operations, ",") {
+		operation = strings.TrimSpace(operation)
+		switch operation {
+		case common.OperationCompress:
+			subs[operation] = os.Getenv("PUBSUB_COMPRESS_SUB_ID")
+		case common.OperationDecompress:
+			subs[operation] = os.Getenv("PUBSUB_DECOMPRESS_SUB_ID")
+		default:
+			return nil, fmt.Errorf("unknown operation %q in WORKER_OPERATIONS", operation)
+		}
+	}
+	for operation, subID := range subs {
+		if subID != "" {
+			continue
+		}
+		if len(subs) > 1 || os.Getenv("PUBSUB_SUB_ID") == "" {
+			return nil, fmt.Errorf("no subscription set for %s jobs", operation)
+		}
+		subs[operation] = os.Getenv("PUBSUB_SUB_ID")
+	}
+	return subs, nil
 }
 
-func main() {
-	methodFlag := flag.Bool("decompress", false, "flag to indicate this instance is for decompressing.")
+// Main runs a worker against GCP.
+func Main() {
+	janitorFlag := flag.Bool("janitor", false, "flag to run this instance as the janitor that expires old jobs instead.")
+	pushFlag := flag.Bool("push", false, "flag to receive jobs from Pub/Sub push subscriptions over HTTP instead of pulling them.")
+	ingestFlag := flag.Bool("ingest", false, "flag to archive the raw records of INGEST_SUBSCRIPTION in compressed windows instead of processing jobs.")
 	flag.Parse()
 
-	// initialize logging system
-	programLevel := new(slog.LevelVar) // Info by default
-	developmentMode := os.Getenv("DEVELOPMENT_MODE")
-	isDev, err := strconv.ParseBool(developmentMode)
-	if err == nil && isDev {
-		programLevel.Set(slog.LevelDebug)
+	common.SetupLogging()
+	if err := compression.RegisterFromEnv(context.Background()); err != nil {
+		slog.Error("Cannot register codecs", "error", err)
+		return
+	}
+
+	var subs map[string]string
+	var ingest ingestConfig
+	switch {
+	case *ingestFlag:
+		var err error
+		if ingest, err = ingestConfigFromEnv(); err != nil {
+			slog.Error("Cannot configure the worker", "error", err)
+			return
+		}
+	case !*janitorFlag:
+		var err error
+		if subs, err = subscriptionsFromEnv(); err != nil {
+			slog.Error("Cannot configure the worker", "error", err)
+			return
+		}
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: programLevel}))
-	slog.SetDefault(logger)
 
-	// initialize GCP services
-	projectID := os.Getenv("GCP_PROJECT_ID")
-	subID := os.Getenv("PUBSUB_SUB_ID")
+	// initialize cloud services
 	bucket := os.Getenv("GCS_BUCKET")
+	shutdownTimeout := common.GetEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
 	ctx := context.Background()
 
-	GCSClient, err := storage.NewClient(ctx)
+	storageBackend, closeStorage, err := common.NewStorageBackend(ctx)
 	if err != nil {
-		slog.Error("Cannot create new client for GCS", "error", err)
+		slog.Error("Cannot connect to object storage", "error", err)
 		return
 	}
-	defer GCSClient.Close()
-	slog.Debug("Initialized a GCS client.")
+	defer closeStorage()
+	slog.Debug("Initialized an object storage client.")
 
-	PUBSUBClient, err := pubsub.NewClient(ctx, projectID)
+	queue, closeQueue, err := common.NewQueue(ctx)
 	if err != nil {
-		slog.Error("Cannot create new client for Pub/Sub", "error", err)
+		slog.Error("Cannot connect to the message queue", "error", err)
 		return
 	}
-	defer PUBSUBClient.Close()
-	slog.Debug("Initialized a Pub/Sub client.")
+	defer closeQueue()
+	slog.Debug("Initialized a message queue client.")
 
-	realGCS := &common.RealGCSClient{Client: GCSClient}
+	app := NewApplication(ctx, storageBackend, queue, bucket, subs)
+	defer app.cancelWork()
+	if common.GetEnvBool("BOOTSTRAP", false) {
+		if err := common.Bootstrap(ctx, app.resources(*pushFlag)); err != nil {
+			slog.Error("Cannot bootstrap cloud resources", "error", err)
+			return
+		}
+	}
 
-	app := Application{
-		GCSClient:  realGCS,
-		CTX:        &ctx,
-		Bucket:     bucket,
-		GCSTimeout: 50 * time.Second,
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = ":9090"
+	}
+	// the worker has no other HTTP server, probes share the metrics listener
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", promhttp.Handler())
+	metricsMux.HandleFunc("GET /healthz", common.HealthzHandler)
+	checks := app.readinessChecks()
+	if *janitorFlag {
+		delete(checks, "pubsub")
+	}
+	if *ingestFlag {
+		checks["pubsub"] = func(ctx context.Context) error {
+			return app.PUBSUBClient.CheckSubscription(ctx, ingest.Subscription)
+		}
 	}
+	metricsMux.Handle("GET /readyz", common.ReadyzHandler(5*time.Second, checks))
+	common.RegisterDebugHandlers(metricsMux, os.Getenv("DEBUG_TOKEN"))
+	metricsSrv := &http.Server{Addr: metricsAddr, Handler: metricsMux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics listener stopped", "addr", metricsAddr, "error", err)
+		}
+	}()
+	defer metricsSrv.Close()
 
-	sub := PUBSUBClient.Subscriber(subID)
-	receiveFunc := func(ctx context.Context, msg *pubsub.Message) {
-		wrappedMsg := &common.RealMessage{Msg: msg}
-		if *methodFlag {
-			app.decompressMessageHandler(ctx, wrappedMsg)
-		} else {
-			app.compressMessageHandler(ctx, wrappedMsg)
+	receiveCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	mode := modeJanitor
+	if *ingestFlag {
+		mode = modeIngest
+	} else if !*janitorFlag {
+		var operations []string
+		for _, sub := range app.subscriptions() {
+			if !slices.Contains(operations, sub.operation) {
+				operations = append(operations, sub.operation)
+			}
 		}
+		mode = strings.Join(operations, ",")
 	}
+	worker := app.newWorkerInfo(mode)
+	heartbeats := make(chan struct{})
+	go func() {
+		defer close(heartbeats)
+		app.runHeartbeat(receiveCtx, worker, common.GetEnvDuration("HEARTBEAT_INTERVAL", 30*time.Second))
+	}()
+	// a heartbeat still being sent would register the worker again
+	defer func() {
+		stop()
+		<-heartbeats
+		app.deregister(worker)
+	}()
 
-	if *methodFlag {
-		slog.Info("Listening for a new decompressing message...")
-	} else {
-		slog.Info("Listening for a new compressing message...")
+	if *janitorFlag {
+		interval := common.GetEnvDuration("JANITOR_INTERVAL", time.Hour)
+		ttl := common.GetEnvDuration("JOB_TTL", 7*24*time.Hour)
+		slog.Info("Expiring old jobs", "interval", interval, "ttl", ttl)
+		go app.runOrphanReconciler(receiveCtx,
+			common.GetEnvDuration("ORPHAN_SCAN_INTERVAL", 10*time.Minute),
+			common.GetEnvDuration("ORPHAN_STALE_AFTER", time.Hour),
+			common.GetEnvInt("ORPHAN_MAX_REQUEUES", 3))
+		app.runJanitor(receiveCtx, interval, ttl)
+		slog.Info("Janitor stopped")
+		return
+	}
+
+	if *ingestFlag {
+		if err := app.Ingest(receiveCtx, ingest); err != nil {
+			slog.Error("Cannot ingest records", "error", err)
+			return
+		}
+		slog.Info("Ingestion stopped")
+		return
+	}
+
+	if *pushFlag {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		var verifier tokenVerifier
+		if audience := os.Getenv("PUSH_AUDIENCE"); audience != "" {
+			issuer := os.Getenv("PUSH_OIDC_ISSUER")
+			if issuer == "" {
+				issuer = "https://accounts.google.com"
+			}
+			verifier = common.NewOIDCVerifier(issuer, audience)
+		} else {
+			slog.Warn("PUSH_AUDIENCE is not set, push requests are not authenticated")
+		}
+		if err := app.ListenPush(receiveCtx, ":"+port, verifier, os.Getenv("PUSH_SERVICE_ACCOUNT"), common.GetEnvDuration("PUSH_ACK_DEADLINE", maxPushAckDeadline), shutdownTimeout); err != nil {
+			slog.Error("Cannot receive pushed jobs", "error", err)
+			return
+		}
+		slog.Info("Worker stopped")
+		return
 	}
-	err = sub.Receive(ctx, receiveFunc)
-	if err != nil && !errors.Is(err, context.Canceled) {
+
+	if err := app.Listen(receiveCtx, shutdownTimeout); err != nil {
 		slog.Error("Cannot process job", "error", err)
 		return
 	}
+	slog.Info("Worker stopped")
 }
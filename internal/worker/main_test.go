@@ -1,43 +1,78 @@
-package main
+package worker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/pubsub/v2"
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
 	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common/jobspb"
 )
 
 // --- Mocks ---
 
-// mockGCSClient satisfies the GCSClientInterface
+// mockGCSClient satisfies the StorageBackend
 type mockGCSClient struct {
 	mu    sync.Mutex
 	files map[string]*bytes.Buffer // Stores uploaded files in memory
+	attrs map[string]common.ObjectWriterOptions
+	// updated is when each object was last written, version how often
+	updated  map[string]time.Time
+	versions map[string]int64
+	// unreachable fails the readiness check
+	unreachable bool
 	// failRead tells NewGCSObjectReader to return an error
 	failRead bool
-	// failWrite tells NewGCSObjectWriter to return a writer that fails on Close
-	// failWrite bool
+	// corruptRead flips a bit of what readers return, except for job
+	// records, with StatObject still reporting the CRC32C of what is stored
+	corruptRead bool
+	// failWrite makes writers fail on Close, except for job records so the
+	// failure can still be recorded
+	failWrite bool
 }
 
 // NewObjectWriter creates an in-memory writer
-func (c *mockGCSClient) NewObjectWriter(ctx context.Context, bucket, object string) common.GCSObjectWriterInterface {
+func (c *mockGCSClient) NewObjectWriter(ctx context.Context, bucket, object string, opts ...common.ObjectWriterOption) common.ObjectWriterInterface {
+	c.mu.Lock()
+	if c.attrs == nil {
+		c.attrs = make(map[string]common.ObjectWriterOptions)
+	}
+	o := common.NewObjectWriterOptions(opts...)
+	c.attrs[object] = o
+	c.mu.Unlock()
+
 	return &mockGCSWriter{
-		objectPath: object,
-		buffer:     new(bytes.Buffer),
-		client:     c,
+		objectPath:     object,
+		buffer:         new(bytes.Buffer),
+		client:         c,
+		ifNotExists:    o.IfNotExists,
+		ifVersionMatch: o.IfVersionMatch,
+		fail:           c.failWrite && !strings.HasPrefix(object, "jobs/"),
 	}
 }
 
-func (c *mockGCSClient) NewObjectReader(ctx context.Context, bucket, object string) (common.GCSObjectReaderInterface, error) {
+func (c *mockGCSClient) NewObjectReader(ctx context.Context, bucket, object string) (common.ObjectReaderInterface, error) {
 	if c.failRead {
 		return nil, errors.New("mock gcs read error")
 	}
@@ -45,17 +80,111 @@ func (c *mockGCSClient) NewObjectReader(ctx context.Context, bucket, object stri
 	defer c.mu.Unlock()
 	data, ok := c.files[object]
 	if !ok {
-		return nil, errors.New("storage: object doesn't exist")
+		return nil, common.ErrObjectNotExist
 	}
 	// Create a new reader from a copy of the bytes
-	return &mockGCSObjectReader{bytes.NewReader(data.Bytes())}, nil
+	content := bytes.Clone(data.Bytes())
+	if c.corruptRead && len(content) > 0 && !strings.HasPrefix(object, "jobs/") {
+		content[0] ^= 1
+	}
+	return &mockGCSObjectReader{bytes.NewReader(content)}, nil
+}
+
+func (c *mockGCSClient) NewRangeReader(ctx context.Context, bucket, object string, offset, length int64) (common.ObjectReaderInterface, error) {
+	if c.failRead {
+		return nil, errors.New("mock gcs read error")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[object]
+	if !ok {
+		return nil, common.ErrObjectNotExist
+	}
+	if length < 0 {
+		length = int64(data.Len())
+	}
+	return io.NopCloser(io.NewSectionReader(bytes.NewReader(data.Bytes()), offset, length)), nil
+}
+
+func (c *mockGCSClient) StatObject(ctx context.Context, bucket, object string) (common.ObjectInfo, error) {
+	if c.failRead {
+		return common.ObjectInfo{}, errors.New("mock gcs read error")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.files[object]
+	if !ok {
+		return common.ObjectInfo{}, common.ErrObjectNotExist
+	}
+	return common.ObjectInfo{
+		Name:      object,
+		Updated:   c.updated[object],
+		Size:      int64(data.Len()),
+		Version:   strconv.FormatInt(c.versions[object], 10),
+		Metadata:  c.attrs[object].Metadata,
+		CRC32C:    crc32.Checksum(data.Bytes(), crc32.MakeTable(crc32.Castagnoli)),
+		HasCRC32C: true,
+	}, nil
+}
+
+// SignURL returns a fake URL that encodes the requested object
+func (c *mockGCSClient) SignURL(bucket, object string, opts common.SignedURLOptions) (string, error) {
+	return fmt.Sprintf("https://signed.example/%s/%s?method=GET&expires=%d", bucket, object, opts.Expires.Unix()), nil
+}
+
+// SignUploadURL returns a fake resumable upload like GCS does
+func (c *mockGCSClient) SignUploadURL(bucket, object string, expires time.Time, opts ...common.ObjectWriterOption) (common.SignedUpload, error) {
+	return common.SignedUpload{
+		URL:     fmt.Sprintf("https://signed.example/%s/%s?method=POST&expires=%d", bucket, object, expires.Unix()),
+		Method:  "POST",
+		Headers: map[string]string{"x-goog-resumable": "start"},
+	}, nil
+}
+
+// CheckBucket fails when unreachable is set
+func (c *mockGCSClient) CheckBucket(ctx context.Context, bucket string) error {
+	if c.unreachable {
+		return errors.New("mock gcs unreachable")
+	}
+	return nil
+}
+
+// ListObjects lists the in-memory objects under prefix in name order
+func (c *mockGCSClient) ListObjects(ctx context.Context, bucket, prefix string) ([]common.ObjectInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var objects []common.ObjectInfo
+	for name := range c.files {
+		if strings.HasPrefix(name, prefix) {
+			objects = append(objects, common.ObjectInfo{Name: name, Updated: c.updated[name]})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Name < objects[j].Name })
+	return objects, nil
+}
+
+func (c *mockGCSClient) DeleteObject(ctx context.Context, bucket, object string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.files, object)
+	return nil
 }
 
 // Helper to pre-populate files
 func (c *mockGCSClient) SetObject(object string, content []byte) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.files[object] = bytes.NewBuffer(content)
+	c.setLocked(object, bytes.NewBuffer(content))
+}
+
+func (c *mockGCSClient) setLocked(object string, content *bytes.Buffer) {
+	if c.updated == nil {
+		c.updated = make(map[string]time.Time)
+		c.versions = make(map[string]int64)
+	}
+	c.files[object] = content
+	c.updated[object] = time.Now()
+	c.versions[object]++
 }
 
 // Helper to get file content from the mock
@@ -71,9 +200,12 @@ func (c *mockGCSClient) GetObjectContent(object string) ([]byte, bool) {
 
 // mockGCSWriter satisfies io.WriteCloser
 type mockGCSWriter struct {
-	objectPath string
-	buffer     *bytes.Buffer
-	client     *mockGCSClient
+	objectPath     string
+	buffer         *bytes.Buffer
+	client         *mockGCSClient
+	ifNotExists    bool
+	ifVersionMatch string
+	fail           bool
 }
 
 // Write adds data to the in-memory buffer
@@ -83,9 +215,18 @@ func (w *mockGCSWriter) Write(p []byte) (n int, err error) {
 
 // Close "commits" the buffer to the mock client's file map
 func (w *mockGCSWriter) Close() error {
+	if w.fail {
+		return errors.New("mock gcs write error")
+	}
 	w.client.mu.Lock()
 	defer w.client.mu.Unlock()
-	w.client.files[w.objectPath] = w.buffer
+	if _, ok := w.client.files[w.objectPath]; ok && w.ifNotExists {
+		return common.ErrObjectExists
+	}
+	if w.ifVersionMatch != "" && w.ifVersionMatch != strconv.FormatInt(w.client.versions[w.objectPath], 10) {
+		return common.ErrVersionMismatch
+	}
+	w.client.setLocked(w.objectPath, w.buffer)
 	return nil
 }
 
@@ -97,14 +238,61 @@ func (r *mockGCSObjectReader) Close() error { return nil } // No-op
 
 // mockMessage satisfies MessageInterface
 type mockMessage struct {
-	data       []byte
-	ackCalled  bool
-	nackCalled bool
+	data            []byte
+	attributes      map[string]string
+	deliveryAttempt int
+	ackCalled       bool
+	nackCalled      bool
 }
 
-func (m *mockMessage) Ack()            { m.ackCalled = true }
-func (m *mockMessage) Nack()           { m.nackCalled = true }
-func (m *mockMessage) GetData() []byte { return m.data }
+func (m *mockMessage) Ack()                          { m.ackCalled = true }
+func (m *mockMessage) Nack()                         { m.nackCalled = true }
+func (m *mockMessage) GetData() []byte               { return m.data }
+func (m *mockMessage) DeliveryAttempt() int          { return m.deliveryAttempt }
+func (m *mockMessage) Attributes() map[string]string { return m.attributes }
+
+// mockPubSubClient satisfies the QueueInterface
+type mockPubSubClient struct {
+	mu       sync.Mutex
+	messages map[string][]*pubsub.Message
+	// unreachable fails the readiness checks
+	unreachable bool
+}
+
+func (c *mockPubSubClient) PublishMessage(ctx context.Context, topicID string, msg *pubsub.Message) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages == nil {
+		c.messages = make(map[string][]*pubsub.Message)
+	}
+	c.messages[topicID] = append(c.messages[topicID], msg)
+	return "mock-message-id-" + uuid.NewString(), nil
+}
+
+// CheckTopic fails when unreachable is set
+func (c *mockPubSubClient) CheckTopic(ctx context.Context, topicID string) error {
+	if c.unreachable {
+		return errors.New("mock pubsub unreachable")
+	}
+	return nil
+}
+
+// CheckSubscription fails when unreachable is set
+func (c *mockPubSubClient) CheckSubscription(ctx context.Context, subID string) error {
+	return c.CheckTopic(ctx, subID)
+}
+
+func (c *mockPubSubClient) Receive(ctx context.Context, subID string, handler func(context.Context, common.MessageInterface)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// Helper to get messages from the mock
+func (c *mockPubSubClient) GetMessages(topicID string) []*pubsub.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.messages[topicID]
+}
 
 // --- Dummy Huffman Functions (for testing) ---
 // These MUST be defined for the test to compile.
@@ -150,7 +338,12 @@ func (m *mockMessage) GetData() []byte { return m.data }
 
 // --- Test Setup ---
 
-const testBucket = "test-bucket"
+const (
+	testBucket          = "test-bucket"
+	testDeadLetterTopic = "dead-letter-topic"
+	testCompressTopic   = "compress-topic"
+	testKMSKey          = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+)
 
 // setupTestApp initializes a new Application with mock clients.
 func setupTestApp(t *testing.T) (*Application, *mockGCSClient) {
@@ -163,9 +356,15 @@ func setupTestApp(t *testing.T) (*Application, *mockGCSClient) {
 	}
 
 	app := &Application{
-		GCSClient: mockGCS,
-		CTX:       &ctx,
-		Bucket:    testBucket,
+		Storage:             mockGCS,
+		PUBSUBClient:        &mockPubSubClient{},
+		JobStore:            &common.GCSJobStore{Client: mockGCS, Bucket: testBucket},
+		CTX:                 &ctx,
+		Bucket:              testBucket,
+		GCSTimeout:          time.Minute,
+		ProcessingTimeout:   time.Minute,
+		DeadLetterTopicID:   testDeadLetterTopic,
+		MaxDeliveryAttempts: 5,
 	}
 
 	return app, mockGCS
@@ -187,26 +386,18 @@ func TestCompressMessageHandler(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		// 1. Setup
 		app, mockGCS = setupTestApp(t) // Reset mocks
-		freqTablePath := fmt.Sprintf("%s/frequency_table.json", jobID)
 		originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
 
 		// CompressedMsgSchema (check)
 		jobMsg := common.CompressedMsgSchema{
 			UID:              jobID, // correct job ID (check)
 			OriginalFilePath: originalFilePath,
-			FreqTablePath:    freqTablePath,
+			FileName:         "test_data.txt",
+			ContentType:      "text/plain",
 		}
 		msgBytes, _ := json.Marshal(jobMsg)
 		mockMsg := &mockMessage{data: msgBytes}
 
-		// freqTable exists (check)
-		freqTable := map[string]uint8{
-			"10": 1,
-			"97": 1,
-			"98": 2,
-		}
-		freqTableBytes, _ := json.Marshal(freqTable)
-		mockGCS.SetObject(freqTablePath, freqTableBytes)
 		// file streaming (check)
 		testContentReader, err := os.ReadFile(testDataTXTPath)
 		if err != nil {
@@ -214,6 +405,9 @@ func TestCompressMessageHandler(t *testing.T) {
 			return
 		}
 		mockGCS.SetObject(originalFilePath, bytes.NewBuffer(testContentReader).Bytes())
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
 
 		// 2. Execute
 		app.compressMessageHandler(context.Background(), mockMsg)
@@ -252,11 +446,69 @@ func TestCompressMessageHandler(t *testing.T) {
 		if mockMsg.nackCalled {
 			t.Error("Expected message to not be Nack-ed, but it was")
 		}
+
+		// job is marked done (check)
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != common.JobDone || job.ResultPath != expectedCompressedPath {
+			t.Errorf("Expected job to be DONE with result %q, got %+v", expectedCompressedPath, job)
+		}
 	})
 
+	// --- Test: Direct uploads come without a frequency table ---
+	t.Run("without frequency table", func(t *testing.T) {
+		app, mockGCS = setupTestApp(t)
+		originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+		jobMsg := common.CompressedMsgSchema{
+			UID:              jobID,
+			OriginalFilePath: originalFilePath,
+			FileName:         "test_data.txt",
+			ContentType:      "text/plain",
+		}
+		msgBytes, _ := json.Marshal(jobMsg)
+		mockMsg := &mockMessage{data: msgBytes}
+
+		testContent, err := os.ReadFile(testDataTXTPath)
+		if err != nil {
+			t.Fatalf("Failed to read test content to test compression: %v", err)
+		}
+		mockGCS.SetObject(originalFilePath, testContent)
+		expected, err := os.ReadFile(compressedRANRANPath)
+		if err != nil {
+			t.Fatalf("Failed to read compressed data for testing: %v", err)
+		}
+
+		app.compressMessageHandler(context.Background(), mockMsg)
+
+		content, ok := mockGCS.GetObjectContent(fmt.Sprintf("%s/compressed.ranran", jobID))
+		if !ok || len(content) != len(expected) {
+			t.Errorf("Expected %d bytes of compressed content, got %d", len(expected), len(content))
+		}
+		if !mockMsg.ackCalled || mockMsg.nackCalled {
+			t.Error("Expected message to be Ack-ed")
+		}
+	})
+
+	failingWriteMsg := func(t *testing.T, attempt int) (*Application, *mockGCSClient, common.MessageInterface) {
+		app, mockGCS := setupTestApp(t)
+		mockGCS.failWrite = true
+		originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+		mockGCS.SetObject(originalFilePath, []byte("abc"))
+		msgBytes, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: originalFilePath, Algorithm: common.AlgorithmZstd})
+		return app, mockGCS, &mockMessage{data: msgBytes, deliveryAttempt: attempt}
+	}
+
 	testCases := []struct {
 		name  string
 		setup func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface)
+		// deadLettered messages are acked and forwarded instead of redelivered
+		deadLettered bool
+		// jobStatus is what the job record ends up as, when it can be found
+		jobStatus common.JobStatus
+		// attempts were made on the job before this delivery
+		attempts int
 	}{
 		{
 			name: "bad Pub/Sub message",
@@ -265,34 +517,122 @@ func TestCompressMessageHandler(t *testing.T) {
 				mockMsg := &mockMessage{data: []byte("not json")}
 				return app, mockGCS, mockMsg
 			},
+			deadLettered: true,
 		},
 		{
-			name: "character frequency table does not exist",
+			name: "original file does not exist",
 			setup: func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface) {
 				app, mockGCS := setupTestApp(t)
-				jobMsg := common.CompressedMsgSchema{UID: jobID, FreqTablePath: "missing.json"}
+				jobMsg := common.CompressedMsgSchema{UID: jobID, OriginalFilePath: "missing.txt"}
 				msgBytes, _ := json.Marshal(jobMsg)
 				return app, mockGCS, &mockMessage{data: msgBytes}
 			},
+			deadLettered: true,
+			jobStatus:    common.JobFailed,
+		},
+		{
+			name: "storage write fails",
+			setup: func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface) {
+				return failingWriteMsg(t, 1)
+			},
+			jobStatus: common.JobPending,
+		},
+		{
+			name: "out of delivery attempts",
+			setup: func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface) {
+				return failingWriteMsg(t, 5)
+			},
+			deadLettered: true,
+			jobStatus:    common.JobFailed,
+		},
+		{
+			// Pub/Sub reports no attempts without a dead letter policy
+			name: "out of attempts counted on the job record",
+			setup: func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface) {
+				return failingWriteMsg(t, 0)
+			},
+			attempts:     4,
+			deadLettered: true,
+			jobStatus:    common.JobFailed,
+		},
+		{
+			name: "storage unavailable out of delivery attempts",
+			setup: func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface) {
+				app, mockGCS, msg := failingWriteMsg(t, 5)
+				mockGCS.failWrite = false
+				breaker := &common.CircuitBreaker{Name: "storage", FailureRatio: 1, MinCalls: 1, Window: time.Minute, Cooldown: time.Minute, IsFailure: func(error) bool { return true }}
+				breaker.Record(errors.New("storage is down"))
+				app.Storage = &common.BreakerStorage{StorageBackend: mockGCS, Breaker: breaker}
+				return app, mockGCS, msg
+			},
+			jobStatus: common.JobPending,
+		},
+		{
+			name: "original corrupted on the way",
+			setup: func(t *testing.T) (*Application, *mockGCSClient, common.MessageInterface) {
+				app, mockGCS := setupTestApp(t)
+				app.Storage = common.NewChecksumStorage(mockGCS)
+				mockGCS.corruptRead = true
+				originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+				mockGCS.SetObject(originalFilePath, []byte("corrupted on the way"))
+				msgBytes, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: originalFilePath})
+				return app, mockGCS, &mockMessage{data: msgBytes}
+			},
+			jobStatus: common.JobPending,
 		},
-		// TODO: buildHuffmanTree fails, compress fails, gcs write close fails
+		// TODO: buildHuffmanTree fails, gcs write close fails
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			app, _, mockMsg := tc.setup(t)
+			if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Attempts: tc.attempts}); err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
 			app.compressMessageHandler(context.Background(), mockMsg)
+			checkFailedMessage(t, app, mockMsg.(*mockMessage), tc.deadLettered)
 
-			if !mockMsg.(*mockMessage).nackCalled {
-				t.Error("Expected message to be Nack-ed, but it wasn't")
+			if tc.jobStatus == "" {
+				return
 			}
-			if mockMsg.(*mockMessage).ackCalled {
-				t.Error("Expected message to not be Ack-ed, but it was")
+			// the reason is kept on the job record either way
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != tc.jobStatus || job.Error == "" {
+				t.Errorf("Expected job to be %s with a reason, got %+v", tc.jobStatus, job)
 			}
 		})
 	}
 }
 
+// checkFailedMessage verifies a failed message was either nacked for
+// redelivery or acked and forwarded to the dead letter topic.
+func checkFailedMessage(t *testing.T, app *Application, msg *mockMessage, deadLettered bool) {
+	t.Helper()
+	dlq := app.PUBSUBClient.(*mockPubSubClient).GetMessages(testDeadLetterTopic)
+	if !deadLettered {
+		if !msg.nackCalled || msg.ackCalled {
+			t.Errorf("Expected message to be Nack-ed only, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+		}
+		if len(dlq) != 0 {
+			t.Errorf("Expected no dead letter messages, got %d", len(dlq))
+		}
+		return
+	}
+
+	if !msg.ackCalled || msg.nackCalled {
+		t.Errorf("Expected message to be Ack-ed only, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+	}
+	if len(dlq) != 1 {
+		t.Fatalf("Expected 1 dead letter message, got %d", len(dlq))
+	}
+	if !bytes.Equal(dlq[0].Data, msg.data) || dlq[0].Attributes["failure_reason"] == "" {
+		t.Errorf("Unexpected dead letter message: %+v", dlq[0])
+	}
+}
+
 func TestDecompressMessageHandler(t *testing.T) {
 	t.Helper()
 	_, thisFile, _, _ := runtime.Caller(0)
@@ -327,11 +667,15 @@ func TestDecompressMessageHandler(t *testing.T) {
 		app.decompressMessageHandler(context.Background(), mockMsg)
 
 		// 3. Verify
-		expectedFinalPath := fmt.Sprintf("%s/file.txt", jobID)
+		// the original name and content type come back from the container
+		expectedFinalPath := fmt.Sprintf("%s/test_data.txt", jobID)
 		content, ok := mockGCS.GetObjectContent(expectedFinalPath)
 		if !ok {
 			t.Errorf("Expected compressed file %q to exist, but it doesn't", expectedFinalPath)
 		}
+		if contentType := mockGCS.attrs[expectedFinalPath].ContentType; contentType != "text/plain" {
+			t.Errorf("Expected content type %q, got %q", "text/plain", contentType)
+		}
 		actualContentReader, err := os.ReadFile(testDataTXTPath)
 		if err != nil {
 			t.Errorf("Failed to read actual content to verify against decompressed data: %v", err)
@@ -359,10 +703,40 @@ func TestDecompressMessageHandler(t *testing.T) {
 		}
 	})
 
+	t.Run("bare Huffman stream from before the container format", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		legacy, err := os.ReadFile(filepath.Join(testDir, "test_data", "legacy.ranran"))
+		if err != nil {
+			t.Fatalf("Failed to read legacy test data: %v", err)
+		}
+		compressedPath := fmt.Sprintf("%s/original_test_data.txt.ranran", jobID)
+		mockGCS.SetObject(compressedPath, legacy)
+		msgBytes, _ := json.Marshal(common.DecompressedMsgSchema{UID: jobID, CompressedFilePath: compressedPath})
+		mockMsg := &mockMessage{data: msgBytes}
+
+		app.decompressMessageHandler(context.Background(), mockMsg)
+
+		if !mockMsg.ackCalled {
+			t.Fatal("Expected message to be Ack-ed, but it wasn't")
+		}
+		content, ok := mockGCS.GetObjectContent(fmt.Sprintf("%s/original_test_data.txt", jobID))
+		if !ok {
+			t.Fatal("Expected the decompressed file to exist, but it doesn't")
+		}
+		expected, err := os.ReadFile(testDataTXTPath)
+		if err != nil {
+			t.Fatalf("Failed to read test data: %v", err)
+		}
+		if !bytes.Equal(content, expected) {
+			t.Errorf("Expected %q, got %q", expected, content)
+		}
+	})
+
 	// --- Test: Failure Cases ---
 	testCases := []struct {
-		name  string
-		setup func(t *testing.T) (*Application, common.MessageInterface)
+		name         string
+		setup        func(t *testing.T) (*Application, common.MessageInterface)
+		deadLettered bool
 	}{
 		// ... (bad pubsub, file missing are the same) ...
 		{
@@ -371,6 +745,24 @@ func TestDecompressMessageHandler(t *testing.T) {
 				app, _ := setupTestApp(t)
 				return app, &mockMessage{data: []byte("not json")}
 			},
+			true,
+		},
+		{
+			"compressed file fails checksum",
+			func(t *testing.T) (*Application, common.MessageInterface) {
+				app, mockGCS := setupTestApp(t)
+				compressed, err := os.ReadFile(compressedRANRANPath)
+				if err != nil {
+					t.Fatalf("Failed to read compressed test data: %v", err)
+				}
+				corrupted := bytes.Clone(compressed)
+				corrupted[len(corrupted)-1] ^= 0xff
+				mockGCS.SetObject("corrupted.ranran", corrupted)
+				jobMsg := common.DecompressedMsgSchema{UID: jobID, CompressedFilePath: "corrupted.ranran"}
+				msgBytes, _ := json.Marshal(jobMsg)
+				return app, &mockMessage{data: msgBytes}
+			},
+			true,
 		},
 		{
 			"compressed file does not exist",
@@ -380,18 +772,363 @@ func TestDecompressMessageHandler(t *testing.T) {
 				msgBytes, _ := json.Marshal(jobMsg)
 				return app, &mockMessage{data: msgBytes}
 			},
+			true,
+		},
+		{
+			"corrupt gzip file",
+			func(t *testing.T) (*Application, common.MessageInterface) {
+				app, mockGCS := setupTestApp(t)
+				mockGCS.SetObject("corrupted.gz", []byte("not gzip at all"))
+				jobMsg := common.DecompressedMsgSchema{UID: jobID, CompressedFilePath: "corrupted.gz", Algorithm: common.AlgorithmGzip}
+				msgBytes, _ := json.Marshal(jobMsg)
+				return app, &mockMessage{data: msgBytes}
+			},
+			true,
+		},
+		{
+			"message of a newer version",
+			func(t *testing.T) (*Application, common.MessageInterface) {
+				app, _ := setupTestApp(t)
+				msgBytes, _ := proto.Marshal(&jobspb.DecompressJob{Version: common.MessageVersion + 1, Uid: jobID, CompressedFilePath: "compressed.ranran"})
+				return app, &mockMessage{data: msgBytes}
+			},
+			false,
+		},
+		{
+			"storage is unavailable",
+			func(t *testing.T) (*Application, common.MessageInterface) {
+				app, mockGCS := setupTestApp(t)
+				mockGCS.failRead = true
+				jobMsg := common.DecompressedMsgSchema{UID: jobID, CompressedFilePath: "compressed.ranran"}
+				msgBytes, _ := json.Marshal(jobMsg)
+				return app, &mockMessage{data: msgBytes}
+			},
+			false,
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			app, mockMsg := tc.setup(t)
 			app.decompressMessageHandler(context.Background(), mockMsg)
+			checkFailedMessage(t, app, mockMsg.(*mockMessage), tc.deadLettered)
+		})
+	}
+}
+
+func TestCodecMessageHandlers(t *testing.T) {
+	testCases := []struct {
+		algorithm      string
+		level          int
+		kmsKey         string
+		compressedName string
+		resultName     string
+		// tenantPrefix is where the manager stored the job
+		tenantPrefix string
+	}{
+		// without a name in the message it falls back to the original object's
+		{algorithm: common.AlgorithmZstd, compressedName: "compressed.ranran", resultName: "original.txt"},
+		// plain gzip output carries no metadata, the upload name is used instead
+		{algorithm: common.AlgorithmGzip, compressedName: "compressed.gz", resultName: "compressed"},
+		{algorithm: common.AlgorithmZstd, level: 19, compressedName: "compressed.ranran", resultName: "original.txt"},
+		{algorithm: common.AlgorithmGzip, level: 1, compressedName: "compressed.gz", resultName: "compressed"},
+		{algorithm: common.AlgorithmZstd, kmsKey: testKMSKey, compressedName: "compressed.ranran", resultName: "original.txt"},
+		{algorithm: common.AlgorithmGzip, compressedName: "compressed.gz", resultName: "compressed", tenantPrefix: "tenants/abc/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s level %d %s", tc.algorithm, tc.level, tc.tenantPrefix), func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			dir := tc.tenantPrefix + jobID
+			original := []byte("hello hello hello codec world\n")
+
+			originalFilePath := fmt.Sprintf("%s/original.txt", dir)
+			mockGCS.SetObject(originalFilePath, original)
+
+			compressMsg, _ := json.Marshal(common.CompressedMsgSchema{
+				UID:              jobID,
+				OriginalFilePath: originalFilePath,
+				Algorithm:        tc.algorithm,
+				Level:            tc.level,
+				KMSKeyName:       tc.kmsKey,
+			})
+			msg := &mockMessage{data: compressMsg}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected compress message to be Ack-ed, but it wasn't")
+			}
+
+			compressedPath := fmt.Sprintf("%s/%s", dir, tc.compressedName)
+			if _, ok := mockGCS.GetObjectContent(compressedPath); !ok {
+				t.Fatalf("Expected compressed file %q to exist, but it doesn't", compressedPath)
+			}
+
+			decompressMsg, _ := json.Marshal(common.DecompressedMsgSchema{
+				UID:                jobID,
+				CompressedFilePath: compressedPath,
+				Algorithm:          tc.algorithm,
+				KMSKeyName:         tc.kmsKey,
+			})
+			msg = &mockMessage{data: decompressMsg}
+			app.decompressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected decompress message to be Ack-ed, but it wasn't")
+			}
 
-			if !mockMsg.(*mockMessage).nackCalled {
-				t.Error("Expected message to be Nack-ed, but it wasn't")
+			resultPath := fmt.Sprintf("%s/%s", dir, tc.resultName)
+			content, _ := mockGCS.GetObjectContent(resultPath)
+			if !bytes.Equal(content, original) {
+				t.Errorf("Expected decompressed content %q, got %q", original, content)
 			}
-			if mockMsg.(*mockMessage).ackCalled {
-				t.Error("Expected message to not be Ack-ed, but it was")
+			for _, object := range []string{compressedPath, resultPath} {
+				if key := mockGCS.attrs[object].KMSKeyName; key != tc.kmsKey {
+					t.Errorf("Expected %s to be encrypted with %q, got %q", object, tc.kmsKey, key)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicateDelivery(t *testing.T) {
+	newCompressMsg := func(t *testing.T, app *Application, mockGCS *mockGCSClient, status common.JobStatus) (string, *mockMessage) {
+		jobID := uuid.New().String()
+		originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+		mockGCS.SetObject(originalFilePath, []byte("duplicate me\n"))
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Status: status}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		msgBytes, _ := json.Marshal(common.CompressedMsgSchema{
+			UID:              jobID,
+			OriginalFilePath: originalFilePath,
+			Algorithm:        common.AlgorithmGzip,
+		})
+		return jobID, &mockMessage{data: msgBytes}
+	}
+
+	t.Run("job already done", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		jobID, msg := newCompressMsg(t, app, mockGCS, common.JobDone)
+
+		app.compressMessageHandler(context.Background(), msg)
+
+		if !msg.ackCalled || msg.nackCalled {
+			t.Errorf("Expected message to be Ack-ed only, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+		}
+		if _, ok := mockGCS.GetObjectContent(fmt.Sprintf("%s/compressed.gz", jobID)); ok {
+			t.Error("Expected the duplicate delivery to not compress again")
+		}
+	})
+
+	t.Run("job canceled", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		jobID, msg := newCompressMsg(t, app, mockGCS, common.JobCanceled)
+
+		app.compressMessageHandler(context.Background(), msg)
+
+		if !msg.ackCalled || msg.nackCalled {
+			t.Errorf("Expected message to be Ack-ed only, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+		}
+		if _, ok := mockGCS.GetObjectContent(fmt.Sprintf("%s/compressed.gz", jobID)); ok {
+			t.Error("Expected the canceled job to not be compressed")
+		}
+	})
+
+	t.Run("canceled while processing", func(t *testing.T) {
+		app, _ := setupTestApp(t)
+		jobID := uuid.NewString()
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Status: common.JobCanceled}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+
+		app.setJobStatus(jobID, common.JobDone, "", nil)
+
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != common.JobCanceled {
+			t.Errorf("Expected the job to stay CANCELED, got %s", job.Status)
+		}
+	})
+
+	t.Run("result already uploaded", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		jobID, msg := newCompressMsg(t, app, mockGCS, common.JobProcessing)
+		compressedPath := fmt.Sprintf("%s/compressed.gz", jobID)
+		mockGCS.SetObject(compressedPath, []byte("earlier result"))
+
+		app.compressMessageHandler(context.Background(), msg)
+
+		if !msg.ackCalled || msg.nackCalled {
+			t.Errorf("Expected message to be Ack-ed only, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+		}
+		if content, _ := mockGCS.GetObjectContent(compressedPath); string(content) != "earlier result" {
+			t.Errorf("Expected the earlier result to be kept, got %q", content)
+		}
+		job, err := app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != common.JobDone || job.ResultPath != compressedPath {
+			t.Errorf("Expected job to be DONE with result %q, got %+v", compressedPath, job)
+		}
+	})
+}
+
+func TestArchiveMessageHandlers(t *testing.T) {
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	entries := []struct{ name, body string }{
+		{"docs/", ""},
+		{"docs/a.txt", "hello archive\n"},
+		{"docs/b.txt", "héllo again\n"},
+	}
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(e.name, "/") {
+			hdr.Typeflag = tar.TypeDir
+		}
+		tw.WriteHeader(hdr)
+		tw.Write([]byte(e.body))
+	}
+	tw.Close()
+
+	for _, algorithm := range []string{common.AlgorithmHuffman, common.AlgorithmZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			originalFilePath := fmt.Sprintf("%s/original_files.tar", jobID)
+			mockGCS.SetObject(originalFilePath, tarball.Bytes())
+
+			compressMsg, _ := json.Marshal(common.CompressedMsgSchema{
+				UID:              jobID,
+				OriginalFilePath: originalFilePath,
+				Algorithm:        algorithm,
+				Archive:          true,
+				FileName:         "files.tar",
+				ContentType:      "application/x-tar",
+			})
+			msg := &mockMessage{data: compressMsg}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected compress message to be Ack-ed, but it wasn't")
+			}
+
+			// the container only holds the file contents, not the tar headers
+			compressedPath := fmt.Sprintf("%s/compressed.ranran", jobID)
+			compressed, _ := mockGCS.GetObjectContent(compressedPath)
+			header, err := compression.ReadContainerHeader(bytes.NewReader(compressed))
+			if err != nil || !header.Metadata.Archive || len(header.Metadata.Members) != len(entries) {
+				t.Fatalf("Unexpected container header: %+v, %v", header, err)
+			}
+
+			decompressMsg, _ := json.Marshal(common.DecompressedMsgSchema{UID: jobID, CompressedFilePath: compressedPath})
+			msg = &mockMessage{data: decompressMsg}
+			app.decompressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected decompress message to be Ack-ed, but it wasn't")
+			}
+
+			restored, ok := mockGCS.GetObjectContent(fmt.Sprintf("%s/files.tar", jobID))
+			if !ok {
+				t.Fatal("Expected the restored tarball to exist")
+			}
+			tr := tar.NewReader(bytes.NewReader(restored))
+			for _, e := range entries {
+				hdr, err := tr.Next()
+				if err != nil || hdr.Name != e.name {
+					t.Fatalf("Expected member %q, got %v, %v", e.name, hdr, err)
+				}
+				if body, _ := io.ReadAll(tr); string(body) != e.body {
+					t.Errorf("Unexpected content of %s: %q", e.name, body)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionsFromEnv(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"default", map[string]string{"PUBSUB_SUB_ID": "compress-sub"}, map[string]string{"compress": "compress-sub"}, false},
+		{"single operation", map[string]string{"WORKER_OPERATIONS": "decompress", "PUBSUB_DECOMPRESS_SUB_ID": "decompress-sub"}, map[string]string{"decompress": "decompress-sub"}, false},
+		{"both operations", map[string]string{"WORKER_OPERATIONS": "compress, decompress", "PUBSUB_COMPRESS_SUB_ID": "c", "PUBSUB_DECOMPRESS_SUB_ID": "d"}, map[string]string{"compress": "c", "decompress": "d"}, false},
+		{"both operations sharing PUBSUB_SUB_ID", map[string]string{"WORKER_OPERATIONS": "compress,decompress", "PUBSUB_SUB_ID": "sub", "PUBSUB_COMPRESS_SUB_ID": "c"}, nil, true},
+		{"unknown operation", map[string]string{"WORKER_OPERATIONS": "resize", "PUBSUB_SUB_ID": "sub"}, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"WORKER_OPERATIONS", "PUBSUB_SUB_ID", "PUBSUB_COMPRESS_SUB_ID", "PUBSUB_DECOMPRESS_SUB_ID"} {
+				t.Setenv(key, tc.env[key])
+			}
+			got, err := subscriptionsFromEnv()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestResources(t *testing.T) {
+	app, _ := setupTestApp(t)
+	app.CompressTopicID, app.DecompressTopicID = "compress", "decompress"
+	app.Subscriptions = map[string]string{common.OperationDecompress: "decompress-sub"}
+	app.PriorityWeights = map[string]int{common.PriorityHigh: 1, common.PriorityNormal: 1}
+
+	res := app.resources(false)
+	if res.Bucket != testBucket || !slices.Contains(res.Topics, testDeadLetterTopic) {
+		t.Errorf("Unexpected resources: %+v", res)
+	}
+	want := []common.SubscriptionResource{
+		{ID: "decompress-sub-high", Topic: "decompress-high", DeadLetterTopic: testDeadLetterTopic, MaxDeliveryAttempts: 6},
+		{ID: "decompress-sub", Topic: "decompress", DeadLetterTopic: testDeadLetterTopic, MaxDeliveryAttempts: 6},
+	}
+	if !slices.Equal(res.Subscriptions, want) {
+		t.Errorf("Expected subscriptions %+v, got %+v", want, res.Subscriptions)
+	}
+	if res := app.resources(true); len(res.Subscriptions) != 0 {
+		t.Errorf("Expected push subscriptions to be left alone, got %+v", res.Subscriptions)
+	}
+}
+
+func TestParallelInput(t *testing.T) {
+	var original strings.Builder
+	for i := 0; original.Len() < 3000; i++ {
+		fmt.Fprintf(&original, "record %d of a large original\n", i)
+	}
+
+	for _, algorithm := range []string{common.AlgorithmHuffman, common.AlgorithmZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			storage := &rangeReads{mockGCSClient: mockGCS}
+			app.Storage = common.NewChecksumStorage(storage)
+			app.ParallelReads, app.ParallelReadPartSize = 3, 100
+			jobID := uuid.New().String()
+			app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Status: common.JobPending})
+			job := common.CompressedMsgSchema{UID: jobID, OriginalFilePath: jobID + "/original.txt", Algorithm: algorithm}
+			mockGCS.SetObject(job.OriginalFilePath, []byte(original.String()))
+
+			data, _ := json.Marshal(job)
+			msg := &mockMessage{data: data}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled || msg.nackCalled {
+				t.Fatalf("Expected message to be acked, got ack=%v nack=%v", msg.ackCalled, msg.nackCalled)
+			}
+			if !slices.Contains(storage.offsets, 2900) {
+				t.Errorf("Expected the original to be read in parts of 100 bytes, got offsets %v", storage.offsets)
+			}
+
+			result, _ := mockGCS.GetObjectContent(jobID + "/compressed.ranran")
+			var out bytes.Buffer
+			if _, err := compression.ReadContainer(bytes.NewReader(result), &out, app.lookupCodec); err != nil || out.String() != original.String() {
+				t.Errorf("Expected the result to decode to the original, got %d bytes, %v", out.Len(), err)
 			}
 		})
 	}
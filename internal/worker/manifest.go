@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// manifestChunks describes the parts of a joined result for its manifest.
+func manifestChunks(parts []compression.ContainerPart) []common.ManifestChunk {
+	var chunks []common.ManifestChunk
+	var offset int64
+	for i, part := range parts {
+		chunks = append(chunks, common.ManifestChunk{
+			Index:          i + 1,
+			Offset:         offset,
+			Size:           part.Size,
+			CompressedSize: part.Length,
+			CRC32:          part.CRC,
+		})
+		offset += part.Size
+	}
+	return chunks
+}
+
+// writeManifest stores the manifest of a result next to it in bucket and
+// returns it. A manifest without a digest gets the digest and size of the
+// stored result, for results an earlier delivery uploaded. Failing to store
+// it doesn't fail the job, whose result is in storage already, and the
+// manifest of an earlier delivery is kept.
+func (app *Application) writeManifest(ctx context.Context, bucket string, manifest common.Manifest, opts ...common.ObjectWriterOption) common.Manifest {
+	if manifest.SHA256 == "" {
+		digest, size, err := app.objectDigest(ctx, bucket, manifest.Result)
+		if err != nil {
+			slog.Warn("Failed to hash result for its manifest", "job", manifest.JobID, "error", err)
+			return manifest
+		}
+		manifest.SHA256, manifest.OutputSize = digest, size
+	}
+	manifest.FinishedAt = time.Now().UTC()
+
+	_, err := app.streamToBucket(ctx, bucket, common.ManifestPath(manifest.Result), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(manifest)
+	}, append(opts, common.WithContentType("application/json"))...)
+	if err != nil && !errors.Is(err, common.ErrObjectExists) {
+		slog.Warn("Failed to store result manifest", "job", manifest.JobID, "error", err)
+		return manifest
+	}
+	slog.Debug("Stored result manifest", "job", manifest.JobID)
+	return manifest
+}
+
+// objectDigest returns the hex SHA-256 digest and the size of an object.
+func (app *Application) objectDigest(ctx context.Context, bucket, object string) (string, int64, error) {
+	rc, err := app.Storage.NewObjectReader(ctx, bucket, object)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+	digest := sha256.New()
+	n, err := io.Copy(digest, rc)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), n, nil
+}
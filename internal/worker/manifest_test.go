@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func readManifest(t *testing.T, mockGCS *mockGCSClient, resultPath string) common.Manifest {
+	t.Helper()
+	data, ok := mockGCS.GetObjectContent(common.ManifestPath(resultPath))
+	if !ok {
+		t.Fatalf("Expected a manifest next to %s", resultPath)
+	}
+	var manifest common.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	return manifest
+}
+
+func TestResultManifest(t *testing.T) {
+	original := strings.Repeat("the quick brown fox jumps over the lazy dog\n", 100)
+
+	testCases := []struct {
+		name string
+		// stored is a result an earlier delivery uploaded
+		stored bool
+	}{
+		{name: "compressed"},
+		{name: "already stored", stored: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Status: common.JobPending})
+			job := common.CompressedMsgSchema{
+				UID:              jobID,
+				OriginalFilePath: jobID + "/original_fox.txt",
+				Algorithm:        common.AlgorithmZstd,
+				FileName:         "fox.txt",
+			}
+			mockGCS.SetObject(job.OriginalFilePath, []byte(original))
+			resultPath := jobID + "/compressed.ranran"
+			if tc.stored {
+				mockGCS.SetObject(resultPath, []byte("an earlier result"))
+			}
+
+			data, _ := json.Marshal(job)
+			msg := &mockMessage{data: data}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected the job to be acked")
+			}
+
+			result, _ := mockGCS.GetObjectContent(resultPath)
+			digest := sha256.Sum256(result)
+			manifest := readManifest(t, mockGCS, resultPath)
+			if manifest.SHA256 != hex.EncodeToString(digest[:]) || manifest.OutputSize != int64(len(result)) {
+				t.Errorf("Expected the manifest to describe the stored result, got %+v", manifest)
+			}
+			if manifest.JobID != jobID || manifest.FileName != "fox.txt" || manifest.Algorithm != common.AlgorithmZstd || manifest.InputSize != int64(len(original)) {
+				t.Errorf("Unexpected manifest: %+v", manifest)
+			}
+			if manifest.StartedAt.IsZero() || manifest.FinishedAt.Before(manifest.StartedAt) {
+				t.Errorf("Unexpected timings: %v to %v", manifest.StartedAt, manifest.FinishedAt)
+			}
+		})
+	}
+
+	t.Run("decompressed", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		jobID := uuid.New().String()
+		app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Status: common.JobPending})
+		job := common.CompressedMsgSchema{UID: jobID, OriginalFilePath: jobID + "/original_fox.txt", Algorithm: common.AlgorithmZstd, FileName: "fox.txt"}
+		mockGCS.SetObject(job.OriginalFilePath, []byte(original))
+		data, _ := json.Marshal(job)
+		app.compressMessageHandler(context.Background(), &mockMessage{data: data})
+
+		decompressID := uuid.New().String()
+		app.JobStore.CreateJob(context.Background(), &common.Job{ID: decompressID, Operation: common.OperationDecompress, Status: common.JobPending})
+		compressed, _ := mockGCS.GetObjectContent(jobID + "/compressed.ranran")
+		decompressJob := common.DecompressedMsgSchema{UID: decompressID, CompressedFilePath: decompressID + "/fox.txt.ranran"}
+		mockGCS.SetObject(decompressJob.CompressedFilePath, compressed)
+		data, _ = json.Marshal(decompressJob)
+		app.decompressMessageHandler(context.Background(), &mockMessage{data: data})
+
+		digest := sha256.Sum256([]byte(original))
+		manifest := readManifest(t, mockGCS, decompressID+"/fox.txt")
+		if manifest.Operation != common.OperationDecompress || manifest.SHA256 != hex.EncodeToString(digest[:]) || manifest.OutputSize != int64(len(original)) || manifest.InputSize != int64(len(compressed)) {
+			t.Errorf("Unexpected manifest: %+v", manifest)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+var (
+	jobsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_jobs_processed_total",
+		Help: "Jobs finished by the worker, by operation and result (done or skipped as a duplicate).",
+	}, []string{"operation", "result"})
+
+	messagesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_messages_total",
+		Help: "Pub/Sub messages acked or nacked, by operation.",
+	}, []string{"operation", "outcome"})
+
+	bytesIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_bytes_in_total",
+		Help: "Bytes read from storage as job input.",
+	}, []string{"operation"})
+
+	bytesOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_bytes_out_total",
+		Help: "Bytes written to storage as job output.",
+	}, []string{"operation"})
+
+	compressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_compression_ratio",
+		Help:    "Original size divided by compressed size of each job.",
+		Buckets: []float64{0.5, 0.9, 1, 1.1, 1.5, 2, 3, 5, 10, 20},
+	}, []string{"operation"})
+
+	processingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_processing_duration_seconds",
+		Help:    "Time taken to process a job from receiving the message to acking it.",
+		Buckets: []float64{.05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"operation"})
+
+	// the output is streamed, so writes include the time spent encoding
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_storage_duration_seconds",
+		Help:    "Time taken to open an object for reading, or to write one out.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300},
+	}, []string{"operation", "direction"})
+)
+
+func observeSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// observeJob records the metrics of a finished job that read in bytes and
+// wrote out bytes.
+func observeJob(operation string, start time.Time, in, out int64) {
+	jobsProcessed.WithLabelValues(operation, "done").Inc()
+	observeSince(processingDuration.WithLabelValues(operation), start)
+	bytesIn.WithLabelValues(operation).Add(float64(in))
+	bytesOut.WithLabelValues(operation).Add(float64(out))
+
+	original, compressed := in, out
+	if operation == common.OperationDecompress {
+		original, compressed = out, in
+	}
+	if compressed > 0 {
+		compressionRatio.WithLabelValues(operation).Observe(float64(original) / float64(compressed))
+	}
+}
+
+// countedMessage counts acks and nacks of the wrapped message.
+type countedMessage struct {
+	common.MessageInterface
+	operation string
+}
+
+func countAcks(msg common.MessageInterface, operation string) common.MessageInterface {
+	return &countedMessage{MessageInterface: msg, operation: operation}
+}
+
+func (m *countedMessage) Ack() {
+	messagesTotal.WithLabelValues(m.operation, "ack").Inc()
+	m.MessageInterface.Ack()
+}
+
+func (m *countedMessage) Nack() {
+	messagesTotal.WithLabelValues(m.operation, "nack").Inc()
+	m.MessageInterface.Nack()
+}
+
+// countingReader and countingWriter also keep the first error, so a failure
+// of the storage underneath can be told apart from bad data.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
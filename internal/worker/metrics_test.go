@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestWorkerMetrics(t *testing.T) {
+	op := common.OperationCompress
+	done := jobsProcessed.WithLabelValues(op, "done")
+	acks := messagesTotal.WithLabelValues(op, "ack")
+	nacks := messagesTotal.WithLabelValues(op, "nack")
+	in, out := bytesIn.WithLabelValues(op), bytesOut.WithLabelValues(op)
+	doneBefore, acksBefore, nacksBefore := testutil.ToFloat64(done), testutil.ToFloat64(acks), testutil.ToFloat64(nacks)
+	inBefore, outBefore := testutil.ToFloat64(in), testutil.ToFloat64(out)
+
+	app, mockGCS := setupTestApp(t)
+	jobID := uuid.New().String()
+	original := strings.Repeat("metrics ", 64)
+	originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+	mockGCS.SetObject(originalFilePath, []byte(original))
+	msgBytes, _ := json.Marshal(common.CompressedMsgSchema{
+		UID:              jobID,
+		OriginalFilePath: originalFilePath,
+		Algorithm:        common.AlgorithmGzip,
+	})
+	app.compressMessageHandler(context.Background(), &mockMessage{data: msgBytes})
+
+	if got := testutil.ToFloat64(done) - doneBefore; got != 1 {
+		t.Errorf("Expected 1 job to be counted as done, got %v", got)
+	}
+	if got := testutil.ToFloat64(acks) - acksBefore; got != 1 {
+		t.Errorf("Expected 1 ack to be counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(in) - inBefore; got != float64(len(original)) {
+		t.Errorf("Expected %d bytes in, got %v", len(original), got)
+	}
+	compressed, _ := mockGCS.GetObjectContent(fmt.Sprintf("%s/compressed.gz", jobID))
+	if got := testutil.ToFloat64(out) - outBefore; got != float64(len(compressed)) {
+		t.Errorf("Expected %d bytes out, got %v", len(compressed), got)
+	}
+
+	// a retryable failure is nacked
+	mockGCS.failRead = true
+	app.compressMessageHandler(context.Background(), &mockMessage{data: msgBytes})
+	if got := testutil.ToFloat64(nacks) - nacksBefore; got != 1 {
+		t.Errorf("Expected 1 nack to be counted, got %v", got)
+	}
+}
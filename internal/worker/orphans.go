@@ -0,0 +1,222 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// errJobChanged aborts the update of a stranded job that someone else touched
+// since it was found.
+var errJobChanged = errors.New("job changed since the scan")
+
+// topicFor returns the topic jobs of priority are enqueued on instead of
+// topicID.
+func (app *Application) topicFor(topicID, priority string) string {
+	if app.PriorityWeights == nil {
+		return topicID
+	}
+	return common.PriorityTopic(topicID, priority)
+}
+
+// jobMessage rebuilds the Pub/Sub message of a job from its record, along
+// with the topic it goes to.
+func (app *Application) jobMessage(job *common.Job) (string, any) {
+	if job.Operation == common.OperationDecompress {
+		return app.topicFor(app.DecompressTopicID, job.Priority), common.DecompressedMsgSchema{
+			UID:                job.ID,
+			CompressedFilePath: fmt.Sprintf("%s/%s", job.ObjectDir(), job.FileName),
+			Algorithm:          job.Algorithm,
+			KMSKeyName:         job.KMSKeyName,
+		}
+	}
+	msg := common.CompressedMsgSchema{
+		UID:              job.ID,
+		OriginalFilePath: fmt.Sprintf("%s/original_%s", job.ObjectDir(), job.FileName),
+		Algorithm:        job.Algorithm,
+		Level:            job.Level,
+		Archive:          job.Archive,
+		FileName:         job.FileName,
+		ContentType:      job.ContentType,
+		KMSKeyName:       job.KMSKeyName,
+		Verify:           job.Verify,
+		Dictionary:       job.Dictionary,
+		// the message of a split job joins its parts, or enqueues them again
+		Parts: job.Parts,
+	}
+	if job.SourceBucket != "" {
+		msg.OriginalFilePath, msg.SourceBucket = job.SourcePath, job.SourceBucket
+		msg.ResultBucket, msg.ResultPath = job.ResultBucket, job.ResultPath
+	}
+	return app.topicFor(app.CompressTopicID, job.Priority), msg
+}
+
+// reconcileOrphans looks for jobs stranded by a crash and untouched since
+// cutoff. Jobs stuck in PENDING or PROCESSING are enqueued again, up to
+// maxRequeues times before they are marked FAILED. Uploaded files without a
+// job record get a FAILED record, so that the janitor eventually removes them.
+// Messages still in the manager's outbox are left to its outbox reconciler.
+// A job that changed since the scan is left alone, so running this more than
+// once at a time never enqueues a job twice.
+func (app *Application) reconcileOrphans(ctx context.Context, cutoff time.Time, maxRequeues int) error {
+	objects, err := app.Storage.ListObjects(ctx, app.Bucket, "")
+	if err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	// job files live under a prefix named after the job ID
+	lastUpdated := make(map[string]time.Time)
+	inOutbox := make(map[string]bool)
+	for _, object := range objects {
+		if id, ok := strings.CutPrefix(object.Name, "outbox/"); ok {
+			// split jobs have an entry per part, named <job>.part<n>.json
+			id, _, _ = strings.Cut(strings.TrimSuffix(id, ".json"), ".")
+			inOutbox[id] = true
+			continue
+		}
+		id, _, ok := strings.Cut(object.Name, "/")
+		if !ok {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			continue
+		}
+		if last, seen := lastUpdated[id]; !seen || object.Updated.After(last) {
+			lastUpdated[id] = object.Updated
+		}
+	}
+
+	jobs, err := app.JobStore.ListJobs(ctx)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		known[job.ID] = true
+		if job.Status != common.JobPending && job.Status != common.JobProcessing {
+			continue
+		}
+		if job.UpdatedAt.After(cutoff) || lastUpdated[job.ID].After(cutoff) || inOutbox[job.ID] {
+			continue
+		}
+
+		if job.Requeued >= maxRequeues {
+			app.failOrphan(ctx, job, fmt.Sprintf("Job stalled after being enqueued %d times", job.Requeued+1))
+			continue
+		}
+		if _, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+			if changed(j, job) {
+				return errJobChanged
+			}
+			j.Status = common.JobPending
+			j.Requeued++
+			return nil
+		}); err != nil {
+			if !errors.Is(err, errJobChanged) {
+				slog.Error("Failed to update stalled job", "job", job.ID, "error", err)
+			}
+			continue
+		}
+		// the job only counts as stranded again after staleAfter, so a lost
+		// message is retried then
+		topicID, message := app.jobMessage(job)
+		if err := app.publish(ctx, topicID, job.RequestID, message); err != nil {
+			slog.Error("Failed to enqueue stalled job again", "job", job.ID, "error", err)
+			continue
+		}
+		app.recordEvent(job.ID, common.JobEvent{Type: common.EventPublished, Reason: "requeued as stalled"})
+		orphansReconciled.WithLabelValues("requeued").Inc()
+		slog.Warn("Enqueued stalled job again", "job", job.ID, "requeued", job.Requeued+1)
+	}
+
+	for id, updated := range lastUpdated {
+		if known[id] || updated.After(cutoff) {
+			continue
+		}
+		// the upload finished but the manager never got to record the job
+		if err := app.JobStore.CreateJob(ctx, &common.Job{
+			ID:     id,
+			Status: common.JobFailed,
+			Error:  "Upload was never turned into a job",
+		}); err != nil {
+			slog.Error("Failed to record orphaned upload", "job", id, "error", err)
+			continue
+		}
+		orphansReconciled.WithLabelValues("failed").Inc()
+		slog.Warn("Marked orphaned upload as failed", "job", id)
+	}
+	return nil
+}
+
+// changed reports whether the record j was updated since job was read.
+func changed(j, job *common.Job) bool {
+	return j.Status != job.Status || !j.UpdatedAt.Equal(job.UpdatedAt)
+}
+
+func (app *Application) failOrphan(ctx context.Context, job *common.Job, reason string) {
+	failed, err := app.JobStore.UpdateJob(ctx, job.ID, func(j *common.Job) error {
+		if changed(j, job) {
+			return errJobChanged
+		}
+		j.Status = common.JobFailed
+		j.Error = reason
+		app.queueJobEvent(j)
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errJobChanged) {
+			slog.Error("Failed to mark stalled job as failed", "job", job.ID, "error", err)
+		}
+		return
+	}
+	app.publishJobEvents(ctx, failed)
+	app.recordEvent(job.ID, common.JobEvent{Type: common.EventFailed, Reason: reason})
+	orphansReconciled.WithLabelValues("failed").Inc()
+	slog.Warn("Marked stalled job as failed", "job", job.ID, "reason", reason)
+}
+
+// publish sends a job message straight to its topic, with the ID of the
+// request that created the job.
+func (app *Application) publish(ctx context.Context, topicID, requestID string, message any) error {
+	data, err := common.MarshalMessage(message)
+	if err != nil {
+		return err
+	}
+	msg := &pubsub.Message{Data: data}
+	if requestID != "" {
+		msg.Attributes = map[string]string{common.RequestIDAttribute: requestID}
+	}
+	_, err = app.PUBSUBClient.PublishMessage(ctx, topicID, msg)
+	return err
+}
+
+// runOrphanReconciler scans for orphans every interval until ctx is
+// cancelled, and publishes the job events left pending. Jobs count as
+// stranded after staleAfter without any activity, which has to be longer than
+// the slowest job takes to process.
+func (app *Application) runOrphanReconciler(ctx context.Context, interval, staleAfter time.Duration, maxRequeues int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := app.reconcileOrphans(ctx, time.Now().Add(-staleAfter), maxRequeues); err != nil {
+			slog.Error("Orphan reconciliation failed", "error", err)
+		}
+		// events pending for a whole interval won't be published otherwise
+		if err := app.relayJobEvents(ctx, time.Now().Add(-interval)); err != nil {
+			slog.Error("Publishing pending job events failed", "error", err)
+		}
+	}
+}
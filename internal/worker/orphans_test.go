@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestReconcileOrphans(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	mockPubSub := app.PUBSUBClient.(*mockPubSubClient)
+	app.CompressTopicID = testCompressTopic
+	ctx := context.Background()
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	// objects last touched long ago, as after a crash
+	put := func(object string, data []byte) {
+		mockGCS.SetObject(object, data)
+		mockGCS.mu.Lock()
+		mockGCS.updated[object] = old
+		mockGCS.mu.Unlock()
+	}
+	// job records are written directly, the store would stamp them with now
+	putJob := func(job common.Job) string {
+		job.ID = uuid.NewString()
+		job.Operation = common.OperationCompress
+		job.FileName = "a.txt"
+		job.Algorithm = common.AlgorithmHuffman
+		data, _ := json.Marshal(job)
+		put(fmt.Sprintf("jobs/%s.json", job.ID), data)
+		put(job.ID+"/original_a.txt", []byte("a"))
+		return job.ID
+	}
+
+	stalled := putJob(common.Job{Status: common.JobPending, UpdatedAt: old})
+	givenUp := putJob(common.Job{Status: common.JobProcessing, UpdatedAt: old, Requeued: 3})
+	recent := putJob(common.Job{Status: common.JobPending, UpdatedAt: now})
+	inOutbox := putJob(common.Job{Status: common.JobPending, UpdatedAt: old})
+	put("outbox/"+inOutbox+".json", []byte("{}"))
+	done := putJob(common.Job{Status: common.JobDone, UpdatedAt: old})
+	orphan := uuid.NewString()
+	put(orphan+"/original_b.txt", []byte("b"))
+
+	if err := app.reconcileOrphans(ctx, now.Add(-time.Hour), 3); err != nil {
+		t.Fatalf("reconcileOrphans failed: %v", err)
+	}
+
+	testCases := []struct {
+		name           string
+		id             string
+		expectedStatus common.JobStatus
+	}{
+		{name: "stalled", id: stalled, expectedStatus: common.JobPending},
+		{name: "requeued too often", id: givenUp, expectedStatus: common.JobFailed},
+		{name: "recent", id: recent, expectedStatus: common.JobPending},
+		{name: "in outbox", id: inOutbox, expectedStatus: common.JobPending},
+		{name: "done", id: done, expectedStatus: common.JobDone},
+		{name: "upload without record", id: orphan, expectedStatus: common.JobFailed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job, err := app.JobStore.GetJob(ctx, tc.id)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != tc.expectedStatus {
+				t.Errorf("Expected job to be %s, got %s", tc.expectedStatus, job.Status)
+			}
+		})
+	}
+
+	// only the stalled job is enqueued again
+	messages := mockPubSub.GetMessages(testCompressTopic)
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message to be published, got %d", len(messages))
+	}
+	var msg common.CompressedMsgSchema
+	common.UnmarshalMessage(messages[0].Data, &msg)
+	if msg.UID != stalled || msg.OriginalFilePath != stalled+"/original_a.txt" {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+	if job, _ := app.JobStore.GetJob(ctx, stalled); job.Requeued != 1 {
+		t.Errorf("Expected the job to be requeued once, got %d", job.Requeued)
+	}
+}
+
+// racingJobStore has another janitor update a job just before every update.
+type racingJobStore struct {
+	common.JobStoreInterface
+}
+
+func (s *racingJobStore) UpdateJob(ctx context.Context, id string, update func(job *common.Job) error) (*common.Job, error) {
+	if _, err := s.JobStoreInterface.UpdateJob(ctx, id, func(j *common.Job) error {
+		j.Requeued++
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return s.JobStoreInterface.UpdateJob(ctx, id, update)
+}
+
+func TestReconcileOrphansChangedJob(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	mockPubSub := app.PUBSUBClient.(*mockPubSubClient)
+	app.CompressTopicID = testCompressTopic
+	app.JobStore = &racingJobStore{app.JobStore}
+	ctx := context.Background()
+	now := time.Now()
+
+	putJob := func(status common.JobStatus, requeued int) string {
+		job := common.Job{ID: uuid.NewString(), Operation: common.OperationCompress, FileName: "a.txt", Status: status, Requeued: requeued, UpdatedAt: now.Add(-2 * time.Hour)}
+		data, _ := json.Marshal(job)
+		mockGCS.SetObject(fmt.Sprintf("jobs/%s.json", job.ID), data)
+		return job.ID
+	}
+	stalled := putJob(common.JobPending, 0)
+	givenUp := putJob(common.JobProcessing, 3)
+
+	if err := app.reconcileOrphans(ctx, now.Add(-time.Hour), 3); err != nil {
+		t.Fatalf("reconcileOrphans failed: %v", err)
+	}
+	if messages := mockPubSub.GetMessages(testCompressTopic); len(messages) != 0 {
+		t.Errorf("Expected a job changed since the scan not to be enqueued, got %d messages", len(messages))
+	}
+	if job, _ := app.JobStore.GetJob(ctx, stalled); job.Requeued != 1 {
+		t.Errorf("Expected only the other update to count, got %d requeues", job.Requeued)
+	}
+	if job, _ := app.JobStore.GetJob(ctx, givenUp); job.Status != common.JobProcessing {
+		t.Errorf("Expected a job changed since the scan not to be failed, got %s", job.Status)
+	}
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+var panicsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "worker_panics_total",
+	Help: "Panics recovered from, by where they happened: a message handler, the producer of an upload or a verification.",
+}, []string{"where"})
+
+// errPanic is what a recovered panic of a job turns into. It isn't
+// permanent, so the job is retried like after any other failure and only
+// fails for good once out of attempts: a job that always panics ends up
+// dead-lettered instead of taking down worker after worker.
+var errPanic = errors.New("job panicked")
+
+// panicked logs the stack of a panic recovered in where and returns it as an
+// error.
+func panicked(where string, v any) error {
+	panicsTotal.WithLabelValues(where).Inc()
+	slog.Error("Recovered from panic", "where", where, "panic", v, "stack", string(debug.Stack()))
+	return fmt.Errorf("%w: %v", errPanic, v)
+}
+
+// recoverPanic turns a panic of the goroutine into an error in err. It has to
+// be deferred itself, and is meant for the goroutines a job starts, e.g. to
+// run a codec, which would crash the worker otherwise.
+func recoverPanic(where string, err *error) {
+	if v := recover(); v != nil {
+		*err = panicked(where, v)
+	}
+}
+
+// settledMessage records whether the message was acked or nacked.
+type settledMessage struct {
+	common.MessageInterface
+	settled atomic.Bool
+}
+
+func (m *settledMessage) Ack() {
+	m.settled.Store(true)
+	m.MessageInterface.Ack()
+}
+
+func (m *settledMessage) Nack() {
+	m.settled.Store(true)
+	m.MessageInterface.Nack()
+}
+
+// recoverJob fails the job of msg when its handler panicked, like any other
+// failure. A message the handler settled before it panicked is left as it is.
+// It has to be deferred itself.
+func (app *Application) recoverJob(operation string, msg *settledMessage) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	err := panicked("handler", v)
+	if msg.settled.Load() {
+		return
+	}
+	app.failJob(msg, messageJobID(operation, msg), "Job handler panicked", err)
+}
+
+// messageJobID returns the ID of the job of msg, if it can be decoded.
+func messageJobID(operation string, msg common.MessageInterface) string {
+	if operation == common.OperationDecompress {
+		var job common.DecompressedMsgSchema
+		common.UnmarshalMessage(msg.GetData(), &job)
+		return job.UID
+	}
+	var job common.CompressedMsgSchema
+	common.UnmarshalMessage(msg.GetData(), &job)
+	return job.UID
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// panickingOnce panics on the first lookup of a job.
+type panickingOnce struct {
+	common.JobStoreInterface
+	panicked atomic.Bool
+}
+
+func (s *panickingOnce) GetJob(ctx context.Context, id string) (*common.Job, error) {
+	if s.panicked.CompareAndSwap(false, true) {
+		panic("job store blew up")
+	}
+	return s.JobStoreInterface.GetJob(ctx, id)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	testCases := []struct {
+		name    string
+		attempt int
+		// deadLettered messages are acked and forwarded instead of redelivered
+		deadLettered bool
+		jobStatus    common.JobStatus
+	}{
+		{name: "retried", jobStatus: common.JobPending},
+		{name: "out of attempts", attempt: 5, deadLettered: true, jobStatus: common.JobFailed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+			mockGCS.SetObject(originalFilePath, []byte("a malformed job must not crash the worker\n"))
+			if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress}); err != nil {
+				t.Fatalf("Failed to create job: %v", err)
+			}
+			app.JobStore = &panickingOnce{JobStoreInterface: app.JobStore}
+			data, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: originalFilePath, Algorithm: common.AlgorithmZstd})
+			msg := &mockMessage{data: data, deliveryAttempt: tc.attempt}
+
+			app.handleMessage(context.Background(), &inflight{}, common.OperationCompress, msg)
+			checkFailedMessage(t, app, msg, tc.deadLettered)
+
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil {
+				t.Fatalf("Failed to get job: %v", err)
+			}
+			if job.Status != tc.jobStatus || !strings.Contains(job.Error, errPanic.Error()) {
+				t.Errorf("Expected the job to be %s for the panic, got %+v", tc.jobStatus, job)
+			}
+		})
+	}
+
+	t.Run("upload", func(t *testing.T) {
+		app, mockGCS := setupTestApp(t)
+		_, err := app.streamToStorage(context.Background(), "panicked", func(w io.Writer) error {
+			io.WriteString(w, "partial output")
+			panic("codec choked on its input")
+		})
+		if !errors.Is(err, errPanic) {
+			t.Errorf("Expected the panic of the producer to fail the upload, got %v", err)
+		}
+		if _, ok := mockGCS.GetObjectContent("panicked"); ok {
+			t.Error("Expected no object to be stored")
+		}
+	})
+}
+
+func TestRecoverPanic(t *testing.T) {
+	err := func() (err error) {
+		defer recoverPanic("test", &err)
+		panic("boom")
+	}()
+	if !errors.Is(err, errPanic) || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected the panic as an error, got %v", err)
+	}
+}
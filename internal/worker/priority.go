@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// prioritySelector shares a fixed number of job slots between the priority
+// subscriptions. While a slot is free every message gets one right away;
+// once they are taken, a slot that frees up goes to a waiting priority picked
+// by smooth weighted round robin, so a priority weighted 4 gets four slots
+// for every one of a priority weighted 1 without the latter starving.
+type prioritySelector struct {
+	mu      sync.Mutex
+	free    int
+	weights map[string]int
+	current map[string]int
+	waiting map[string][]chan struct{}
+}
+
+func newPrioritySelector(slots int, weights map[string]int) *prioritySelector {
+	return &prioritySelector{
+		free:    max(slots, 1),
+		weights: weights,
+		current: make(map[string]int),
+		waiting: make(map[string][]chan struct{}),
+	}
+}
+
+// acquire waits for a slot for a message of priority. It reports false if
+// ctx is done first, in which case there is nothing to release.
+func (s *prioritySelector) acquire(ctx context.Context, priority string) bool {
+	s.mu.Lock()
+	if s.free > 0 {
+		s.free--
+		s.mu.Unlock()
+		return true
+	}
+	granted := make(chan struct{})
+	s.waiting[priority] = append(s.waiting[priority], granted)
+	s.mu.Unlock()
+
+	select {
+	case <-granted:
+		return true
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, ch := range s.waiting[priority] {
+		if ch == granted {
+			s.waiting[priority] = append(s.waiting[priority][:i], s.waiting[priority][i+1:]...)
+			return false
+		}
+	}
+	// the slot was granted while ctx was done, pass it on
+	s.grantLocked()
+	return false
+}
+
+// release gives a slot back, to the next waiting message if there is one.
+func (s *prioritySelector) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.grantLocked()
+}
+
+func (s *prioritySelector) grantLocked() {
+	var next string
+	total := 0
+	for _, priority := range common.Priorities {
+		if len(s.waiting[priority]) == 0 {
+			continue
+		}
+		s.current[priority] += s.weights[priority]
+		total += s.weights[priority]
+		if next == "" || s.current[priority] > s.current[next] {
+			next = priority
+		}
+	}
+	if next == "" {
+		s.free++
+		return
+	}
+	s.current[next] -= total
+	granted := s.waiting[next][0]
+	s.waiting[next] = s.waiting[next][1:]
+	close(granted)
+}
@@ -0,0 +1,121 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestPrioritySelector(t *testing.T) {
+	s := newPrioritySelector(1, map[string]int{common.PriorityHigh: 2, common.PriorityLow: 1})
+	if !s.acquire(context.Background(), common.PriorityLow) {
+		t.Fatal("Expected a free slot to be acquired right away")
+	}
+
+	granted := make(chan string)
+	waiters := map[string]int{common.PriorityHigh: 4, common.PriorityLow: 2}
+	for priority, n := range waiters {
+		for range n {
+			go func() {
+				if s.acquire(context.Background(), priority) {
+					granted <- priority
+				}
+			}()
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		queued := len(s.waiting[common.PriorityHigh]) + len(s.waiting[common.PriorityLow])
+		s.mu.Unlock()
+		if queued == 6 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for the messages to queue, %d did", queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	var order []string
+	for range 6 {
+		s.release()
+		order = append(order, <-granted)
+	}
+	want := []string{"high", "low", "high", "high", "low", "high"}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("Expected slots to go to %v, got %v", want, order)
+	}
+}
+
+func TestPrioritySelectorCanceled(t *testing.T) {
+	s := newPrioritySelector(1, map[string]int{common.PriorityNormal: 1})
+	s.acquire(context.Background(), common.PriorityNormal)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if s.acquire(ctx, common.PriorityNormal) {
+		t.Fatal("Expected no slot once the context is done")
+	}
+	s.release()
+	if s.free != 1 || len(s.waiting[common.PriorityNormal]) != 0 {
+		t.Errorf("Expected the slot to be free again, got %d free and %d waiting", s.free, len(s.waiting[common.PriorityNormal]))
+	}
+}
+
+func TestListenPriorityTopics(t *testing.T) {
+	queue := common.NewMemoryQueue()
+	app, mockGCS := setupTestApp(t)
+	app.PUBSUBClient = queue
+	app.Subscriptions = map[string]string{common.OperationCompress: "compress"}
+	app.PriorityWeights = map[string]int{common.PriorityHigh: 4, common.PriorityNormal: 2, common.PriorityLow: 1}
+	app.Concurrency = 2
+
+	var paths []string
+	for _, priority := range common.Priorities {
+		jobID := uuid.New().String()
+		originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+		mockGCS.SetObject(originalFilePath, []byte("hello from the "+priority+" queue\n"))
+		msgBytes, _ := json.Marshal(common.CompressedMsgSchema{
+			UID:              jobID,
+			OriginalFilePath: originalFilePath,
+			Algorithm:        common.AlgorithmZstd,
+		})
+		topicID := common.PriorityTopic("compress", priority)
+		if _, err := queue.PublishMessage(context.Background(), topicID, &pubsub.Message{Data: msgBytes}); err != nil {
+			t.Fatalf("Failed to publish: %v", err)
+		}
+		paths = append(paths, fmt.Sprintf("%s/compressed.ranran", jobID))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listened := make(chan error, 1)
+	go func() {
+		listened <- app.Listen(ctx, time.Second)
+	}()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for _, path := range paths {
+		for {
+			if _, ok := mockGCS.GetObjectContent(path); ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", path)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	cancel()
+	if err := <-listened; err != nil {
+		t.Errorf("Expected Listen to stop cleanly, got %v", err)
+	}
+}
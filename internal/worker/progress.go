@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// progressReader reports how much of a job's input has been read every
+// ProgressInterval, so clients can follow a long job.
+type progressReader struct {
+	app       *Application
+	jobID     string
+	operation string
+	r         io.Reader
+	n, total  int64
+	last      time.Time
+}
+
+// trackProgress wraps r, the input of a job read from object, to report
+// progress on it. Without ProgressInterval r is returned as it is.
+func (app *Application) trackProgress(ctx context.Context, jobID, operation, object string, r io.Reader) io.Reader {
+	if app.ProgressInterval <= 0 {
+		return r
+	}
+	var total int64
+	statCtx, cancel := context.WithTimeout(ctx, app.GCSTimeout)
+	if info, err := app.Storage.StatObject(statCtx, app.Bucket, object); err == nil {
+		total = info.Size
+	}
+	cancel()
+	return &progressReader{app: app, jobID: jobID, operation: operation, r: r, total: total, last: time.Now()}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if now := time.Now(); now.Sub(p.last) >= p.app.ProgressInterval {
+		p.last = now
+		p.app.reportProgress(p.jobID, p.operation, common.NewJobProgress(p.n, p.total))
+	}
+	return n, err
+}
+
+// reportProgress records progress on the job and publishes it on the status
+// topic. Like setJobStatus it must not decide whether the job succeeds, so
+// failures are only logged.
+func (app *Application) reportProgress(jobID, operation string, progress common.JobProgress) {
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	_, err := app.JobStore.UpdateJob(ctx, jobID, func(j *common.Job) error {
+		// don't bring a canceled or finished job back
+		if j.Status != common.JobProcessing {
+			return errJobCanceled
+		}
+		j.Progress = &progress
+		return nil
+	})
+	if err != nil && !errors.Is(err, errJobCanceled) {
+		slog.Warn("Failed to record job progress", "job", jobID, "error", err)
+	}
+
+	if app.StatusTopicID == "" {
+		return
+	}
+	data, _ := json.Marshal(common.ProgressMsgSchema{
+		UID:       jobID,
+		Operation: operation,
+		Bytes:     progress.Bytes,
+		Total:     progress.Total,
+		Percent:   progress.Percent,
+	})
+	if _, err := app.PUBSUBClient.PublishMessage(ctx, app.StatusTopicID, &pubsub.Message{
+		Data:       data,
+		Attributes: map[string]string{"job_id": jobID},
+	}); err != nil {
+		slog.Warn("Failed to publish job progress", "job", jobID, "error", err)
+	}
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+const testStatusTopic = "test-status-topic"
+
+func TestProgressReporting(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	app.StatusTopicID = testStatusTopic
+	app.ProgressInterval = time.Nanosecond
+	original := strings.Repeat("long jobs report how far they got\n", 3000)
+
+	jobID := uuid.New().String()
+	originalFilePath := fmt.Sprintf("%s/original_long.txt", jobID)
+	mockGCS.SetObject(originalFilePath, []byte(original))
+	app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Algorithm: common.AlgorithmZstd})
+
+	data, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: originalFilePath, Algorithm: common.AlgorithmZstd})
+	msg := &mockMessage{data: data}
+	app.compressMessageHandler(context.Background(), msg)
+	if !msg.ackCalled {
+		t.Fatal("Expected message to be Ack-ed")
+	}
+
+	messages := app.PUBSUBClient.(*mockPubSubClient).GetMessages(testStatusTopic)
+	if len(messages) == 0 {
+		t.Fatal("Expected progress to be published")
+	}
+	var bytes int64
+	for _, message := range messages {
+		var progress common.ProgressMsgSchema
+		json.Unmarshal(message.Data, &progress)
+		if progress.UID != jobID || progress.Operation != common.OperationCompress || progress.Total != int64(len(original)) || progress.Bytes < bytes {
+			t.Fatalf("Unexpected progress message: %+v", progress)
+		}
+		bytes = progress.Bytes
+	}
+	if bytes != int64(len(original)) {
+		t.Errorf("Expected the last progress to cover the whole input, got %d bytes", bytes)
+	}
+
+	job, err := app.JobStore.GetJob(context.Background(), jobID)
+	if err != nil || job.Status != common.JobDone || job.Progress == nil || job.Progress.Percent != 100 {
+		t.Errorf("Expected the job to record its progress, got %+v, %v", job, err)
+	}
+}
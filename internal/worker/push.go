@@ -0,0 +1,264 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// maxPushBody bounds a push request. Pub/Sub messages are at most 10 MB,
+// which grow by a third once base64 encoded in the envelope.
+const maxPushBody = 16 << 20
+
+// maxPushAckDeadline is the longest ack deadline of a push subscription,
+// which is how long Pub/Sub waits for the answer to a push.
+const maxPushAckDeadline = 600 * time.Second
+
+// pushAnswerMargin is left between the end of a pushed job and the ack
+// deadline for the answer to reach Pub/Sub.
+const pushAnswerMargin = 10 * time.Second
+
+// pushEnvelope is the body of a request from a Pub/Sub push subscription.
+type pushEnvelope struct {
+	Message struct {
+		Data       []byte            `json:"data"`
+		Attributes map[string]string `json:"attributes"`
+		MessageID  string            `json:"messageId"`
+	} `json:"message"`
+	// Subscription is the full name of the subscription,
+	// projects/<project>/subscriptions/<id>.
+	Subscription string `json:"subscription"`
+	// DeliveryAttempt is only set with a dead letter policy.
+	DeliveryAttempt int `json:"deliveryAttempt"`
+}
+
+// pushMessage is a message Pub/Sub pushed. Acking or nacking it decides the
+// response to the push request, only the first of them counts.
+type pushMessage struct {
+	data            []byte
+	attributes      map[string]string
+	deliveryAttempt int
+
+	once    sync.Once
+	settled chan bool
+}
+
+func newPushMessage(envelope pushEnvelope) *pushMessage {
+	return &pushMessage{
+		data:            envelope.Message.Data,
+		attributes:      envelope.Message.Attributes,
+		deliveryAttempt: envelope.DeliveryAttempt,
+		settled:         make(chan bool, 1),
+	}
+}
+
+func (m *pushMessage) Ack()  { m.settle(true) }
+func (m *pushMessage) Nack() { m.settle(false) }
+
+func (m *pushMessage) settle(acked bool) {
+	m.once.Do(func() { m.settled <- acked })
+}
+
+func (m *pushMessage) GetData() []byte               { return m.data }
+func (m *pushMessage) DeliveryAttempt() int          { return m.deliveryAttempt }
+func (m *pushMessage) Attributes() map[string]string { return m.attributes }
+
+// tokenVerifier checks the OIDC token Pub/Sub signs push requests with.
+type tokenVerifier interface {
+	Verify(ctx context.Context, token string) (common.OIDCClaims, error)
+}
+
+// pushServer handles the jobs Pub/Sub pushes to the worker, for a worker
+// that scales with its requests instead of pulling from its subscriptions.
+type pushServer struct {
+	app *Application
+	// verifier checks the token of every request. Without one any request
+	// is accepted, leaving authentication to the platform in front of the
+	// worker.
+	verifier tokenVerifier
+	// serviceAccount, when set, is the only identity whose tokens are
+	// accepted.
+	serviceAccount string
+
+	jobs inflight
+	// selector shares the job slots by priority, slots limits them without
+	// priorities.
+	selector *prioritySelector
+	slots    chan struct{}
+}
+
+func (app *Application) newPushServer(verifier tokenVerifier, serviceAccount string) *pushServer {
+	s := &pushServer{app: app, verifier: verifier, serviceAccount: serviceAccount}
+	if app.PriorityWeights != nil {
+		s.selector = newPrioritySelector(app.Concurrency, app.PriorityWeights)
+	} else {
+		s.slots = make(chan struct{}, max(app.Concurrency, 1))
+	}
+	return s
+}
+
+func (s *pushServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /push/{operation}", s.push)
+	return mux
+}
+
+// push runs the job of a pushed message and answers once it is acked, with
+// 204, or nacked, with 503 for Pub/Sub to deliver it again later. A worker
+// without a free job slot answers 429.
+func (s *pushServer) push(w http.ResponseWriter, r *http.Request) {
+	if !s.authenticate(w, r) {
+		return
+	}
+	var envelope pushEnvelope
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushBody)).Decode(&envelope); err != nil {
+		common.WriteError(w, "Invalid push request", http.StatusBadRequest)
+		return
+	}
+	sub, ok := s.subscription(r.PathValue("operation"), envelope.Subscription)
+	if !ok {
+		slog.Warn("Rejected push from unknown subscription", "operation", r.PathValue("operation"), "subscription", envelope.Subscription)
+		common.WriteError(w, "Unknown subscription", http.StatusNotFound)
+		return
+	}
+
+	release, ok := s.acquire(r.Context(), sub.priority)
+	if !ok {
+		common.WriteError(w, "No free job slot", http.StatusTooManyRequests)
+		return
+	}
+	msg := newPushMessage(envelope)
+	go func() {
+		defer release()
+		// a handler returning without settling the message leaves it to
+		// another delivery
+		defer msg.Nack()
+		s.app.handleMessage(*s.app.CTX, &s.jobs, sub.operation, msg)
+	}()
+
+	select {
+	case acked := <-msg.settled:
+		if !acked {
+			common.WriteError(w, "Message nacked", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case <-r.Context().Done():
+		// Pub/Sub gave up on the request and delivers the message again
+	}
+}
+
+// authenticate rejects requests without a valid token of the service account
+// with 401 or 403, and reports whether the request may go on.
+func (s *pushServer) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	if s.verifier == nil {
+		return true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		common.WriteError(w, "Missing bearer token", http.StatusUnauthorized)
+		return false
+	}
+	claims, err := s.verifier.Verify(r.Context(), token)
+	if errors.Is(err, common.ErrInvalidToken) {
+		slog.Info("Rejected push token", "error", err)
+		common.WriteError(w, "Invalid bearer token", http.StatusUnauthorized)
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to verify push token", "error", err)
+		common.WriteError(w, "Service unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	if s.serviceAccount != "" && (claims.Email != s.serviceAccount || !claims.EmailVerified) {
+		slog.Info("Rejected push token of another identity", "email", claims.Email)
+		common.WriteError(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// subscription finds the subscription of the worker named in a push request
+// for jobs of operation.
+func (s *pushServer) subscription(operation, name string) (subscription, bool) {
+	for _, sub := range s.app.subscriptions() {
+		if sub.operation == operation && sub.id == path.Base(name) {
+			return sub, true
+		}
+	}
+	return subscription{}, false
+}
+
+// acquire takes a job slot for a message of priority. With priorities it
+// waits for one as long as the request does, otherwise it gives up right
+// away when they are all taken.
+func (s *pushServer) acquire(ctx context.Context, priority string) (func(), bool) {
+	if s.selector != nil {
+		if !s.selector.acquire(ctx, priority) {
+			return nil, false
+		}
+		return s.selector.release, true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return func() { <-s.slots }, true
+	default:
+		return nil, false
+	}
+}
+
+// pushProcessingTimeout is how long a pushed job may take for its answer to
+// reach Pub/Sub before ackDeadline, which is capped at the longest deadline
+// Pub/Sub allows: processing, cut short when it would run past that.
+func pushProcessingTimeout(processing, ackDeadline time.Duration) time.Duration {
+	limit := min(ackDeadline, maxPushAckDeadline) - pushAnswerMargin
+	if limit <= 0 {
+		limit = min(ackDeadline, maxPushAckDeadline) / 2
+	}
+	return min(processing, limit)
+}
+
+// ListenPush handles the jobs Pub/Sub pushes to addr until ctx is done,
+// verifying the token of every request with verifier unless it is nil. A
+// job is cut short before ackDeadline, the ack deadline of the subscriptions,
+// since Pub/Sub pushes it again once that passes. Like Listen, it then waits
+// up to shutdownTimeout for the jobs in flight and nacks the rest.
+func (app *Application) ListenPush(ctx context.Context, addr string, verifier tokenVerifier, serviceAccount string, ackDeadline, shutdownTimeout time.Duration) error {
+	if timeout := pushProcessingTimeout(app.ProcessingTimeout, ackDeadline); timeout < app.ProcessingTimeout {
+		slog.Warn("PROCESSING_TIMEOUT is past the push ack deadline, pushed jobs are cut short", "timeout", timeout, "ack_deadline", ackDeadline)
+		app.ProcessingTimeout = timeout
+	}
+	s := app.newPushServer(verifier, serviceAccount)
+	srv := &http.Server{Addr: addr, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe()
+	}()
+
+	slog.Info("Listening for pushed messages...", "addr", addr, "subscriptions", app.Subscriptions)
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	// pushes arriving from now on are nacked, they go to another worker
+	slog.Info("Shutting down, waiting for in-flight jobs", "timeout", shutdownTimeout)
+	if !s.jobs.drain(shutdownTimeout) {
+		n := s.jobs.nackAll()
+		slog.Warn("In-flight jobs did not finish in time, nacked them for redelivery", "count", n)
+		if app.cancelWork != nil {
+			app.cancelWork()
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,190 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// testVerifier accepts the tokens it maps to their claims.
+type testVerifier map[string]common.OIDCClaims
+
+func (v testVerifier) Verify(ctx context.Context, token string) (common.OIDCClaims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return common.OIDCClaims{}, fmt.Errorf("%w: unknown token", common.ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+const testPushAccount = "pubsub-push@p.iam.gserviceaccount.com"
+
+// pushRequest wraps data the way Pub/Sub pushes it from subscription.
+func pushRequest(t *testing.T, operation, subscription string, data []byte, token string) *http.Request {
+	t.Helper()
+	var envelope pushEnvelope
+	envelope.Message.Data = data
+	envelope.Message.MessageID = "1"
+	envelope.Subscription = "projects/p/subscriptions/" + subscription
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("Failed to marshal envelope: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/push/"+operation, bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestPushServer(t *testing.T) {
+	testData, err := os.ReadFile(filepath.Join("test_data", "test_data.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read test data: %v", err)
+	}
+	verifier := testVerifier{
+		"valid":      {Subject: "1", Email: testPushAccount, EmailVerified: true},
+		"other":      {Subject: "2", Email: "someone@example.com", EmailVerified: true},
+		"unverified": {Subject: "3", Email: testPushAccount},
+	}
+
+	// setup returns a push server for the compress subscription, with the
+	// message of a job whose upload is in the bucket
+	setup := func(t *testing.T) (*pushServer, *mockGCSClient, string, []byte) {
+		app, mockGCS := setupTestApp(t)
+		app.Subscriptions = map[string]string{common.OperationCompress: "compress-sub"}
+		app.Concurrency = 1
+
+		jobID := uuid.New().String()
+		original := jobID + "/original.txt"
+		mockGCS.SetObject(original, testData)
+		if err := app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress}); err != nil {
+			t.Fatalf("Failed to create job: %v", err)
+		}
+		msg, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: original, FileName: "test_data.txt"})
+		return app.newPushServer(verifier, testPushAccount), mockGCS, jobID, msg
+	}
+
+	t.Run("runs the job and acks", func(t *testing.T) {
+		s, mockGCS, jobID, msg := setup(t)
+		rr := httptest.NewRecorder()
+		s.handler().ServeHTTP(rr, pushRequest(t, common.OperationCompress, "compress-sub", msg, "valid"))
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		if _, ok := mockGCS.GetObjectContent(jobID + "/compressed.ranran"); !ok {
+			t.Error("Expected the compressed file to be written")
+		}
+		job, err := s.app.JobStore.GetJob(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if job.Status != common.JobDone {
+			t.Errorf("Expected job to be DONE, got %s", job.Status)
+		}
+	})
+
+	t.Run("nacks while shutting down", func(t *testing.T) {
+		s, mockGCS, jobID, msg := setup(t)
+		s.jobs.drain(0)
+		rr := httptest.NewRecorder()
+		s.handler().ServeHTTP(rr, pushRequest(t, common.OperationCompress, "compress-sub", msg, "valid"))
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+		if _, ok := mockGCS.GetObjectContent(jobID + "/compressed.ranran"); ok {
+			t.Error("Expected the job not to run")
+		}
+	})
+
+	t.Run("without a free slot", func(t *testing.T) {
+		s, _, _, msg := setup(t)
+		release, ok := s.acquire(context.Background(), "")
+		if !ok {
+			t.Fatal("Expected a free slot")
+		}
+		defer release()
+		rr := httptest.NewRecorder()
+		s.handler().ServeHTTP(rr, pushRequest(t, common.OperationCompress, "compress-sub", msg, "valid"))
+
+		if rr.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+	})
+
+	rejected := []struct {
+		name      string
+		operation string
+		sub       string
+		token     string
+		status    int
+	}{
+		{"without token", common.OperationCompress, "compress-sub", "", http.StatusUnauthorized},
+		{"invalid token", common.OperationCompress, "compress-sub", "forged", http.StatusUnauthorized},
+		{"other service account", common.OperationCompress, "compress-sub", "other", http.StatusForbidden},
+		{"unverified email", common.OperationCompress, "compress-sub", "unverified", http.StatusForbidden},
+		{"unknown subscription", common.OperationCompress, "other-sub", "valid", http.StatusNotFound},
+		{"operation of another subscription", common.OperationDecompress, "compress-sub", "valid", http.StatusNotFound},
+	}
+	for _, tc := range rejected {
+		t.Run(tc.name, func(t *testing.T) {
+			s, mockGCS, jobID, msg := setup(t)
+			rr := httptest.NewRecorder()
+			s.handler().ServeHTTP(rr, pushRequest(t, tc.operation, tc.sub, msg, tc.token))
+
+			if rr.Code != tc.status {
+				t.Errorf("Expected status %d, got %d: %s", tc.status, rr.Code, rr.Body.String())
+			}
+			if _, ok := mockGCS.GetObjectContent(jobID + "/compressed.ranran"); ok {
+				t.Error("Expected the job not to run")
+			}
+		})
+	}
+
+	t.Run("invalid envelope", func(t *testing.T) {
+		s, _, _, _ := setup(t)
+		req := httptest.NewRequest(http.MethodPost, "/push/compress", bytes.NewReader([]byte("not json")))
+		req.Header.Set("Authorization", "Bearer valid")
+		rr := httptest.NewRecorder()
+		s.handler().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestPushProcessingTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		processing  time.Duration
+		ackDeadline time.Duration
+		want        time.Duration
+	}{
+		{"within the deadline", time.Minute, 600 * time.Second, time.Minute},
+		{"past the deadline", 2 * time.Hour, 600 * time.Second, 590 * time.Second},
+		{"past a shorter deadline", 2 * time.Hour, 60 * time.Second, 50 * time.Second},
+		{"deadline over the maximum", 2 * time.Hour, time.Hour, 590 * time.Second},
+		{"deadline within the margin", 2 * time.Hour, 10 * time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pushProcessingTimeout(tt.processing, tt.ackDeadline); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package worker
+
+// raceEnabled is set when the tests run with the race detector, which makes
+// sync.Pool drop what is put in it at random.
+const raceEnabled = true
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// modeJanitor is the registry mode of a worker run with -janitor, the others
+// are named after the operation they process.
+const modeJanitor = "janitor"
+
+// newWorkerInfo describes this worker in the registry. The ID is unique even
+// when a restarted pod keeps its host name.
+func (app *Application) newWorkerInfo(mode string) *common.WorkerInfo {
+	host, _ := os.Hostname()
+	capacity := app.Concurrency
+	if mode == modeJanitor {
+		capacity = 0
+	}
+	return &common.WorkerInfo{
+		ID:        host + "-" + uuid.NewString()[:8],
+		Host:      host,
+		Mode:      mode,
+		Capacity:  capacity,
+		Version:   common.Version(),
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// heartbeat refreshes the registry record of worker. A missed heartbeat only
+// makes the worker look stale for a while, so failures are only logged.
+func (app *Application) heartbeat(worker *common.WorkerInfo) {
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	worker.LastSeen = time.Now().UTC()
+	if err := common.SaveWorker(ctx, app.Storage, app.Bucket, worker); err != nil {
+		slog.Warn("Failed to send heartbeat", "worker", worker.ID, "error", err)
+	}
+}
+
+// runHeartbeat registers worker and sends a heartbeat every interval until
+// ctx is cancelled.
+func (app *Application) runHeartbeat(ctx context.Context, worker *common.WorkerInfo, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		app.heartbeat(worker)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deregister removes the registry record of worker once it stops.
+func (app *Application) deregister(worker *common.WorkerInfo) {
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	if err := common.RemoveWorker(ctx, app.Storage, app.Bucket, worker.ID); err != nil {
+		slog.Warn("Failed to deregister worker", "worker", worker.ID, "error", err)
+	}
+}
@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestWorkerRegistry(t *testing.T) {
+	app, _ := setupTestApp(t)
+	app.Concurrency = 3
+	ctx := context.Background()
+
+	worker := app.newWorkerInfo(common.OperationCompress)
+	app.heartbeat(worker)
+	workers, err := common.ListWorkers(ctx, app.Storage, app.Bucket)
+	if err != nil || len(workers) != 1 {
+		t.Fatalf("Expected the worker to be registered, got %v, %v", workers, err)
+	}
+	if got := workers[0]; got.ID != worker.ID || got.Mode != common.OperationCompress || got.Capacity != 3 || got.LastSeen.IsZero() {
+		t.Errorf("Unexpected worker record %+v", got)
+	}
+
+	app.deregister(worker)
+	if workers, err := common.ListWorkers(ctx, app.Storage, app.Bucket); err != nil || len(workers) != 0 {
+		t.Errorf("Expected the worker to be removed, got %v, %v", workers, err)
+	}
+}
+
+func TestSweepStaleWorkers(t *testing.T) {
+	app, _ := setupTestApp(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, worker := range []*common.WorkerInfo{
+		{ID: "crashed", LastSeen: now.Add(-48 * time.Hour)},
+		{ID: "running", LastSeen: now},
+	} {
+		if err := common.SaveWorker(ctx, app.Storage, app.Bucket, worker); err != nil {
+			t.Fatalf("Failed to save worker: %v", err)
+		}
+	}
+	if err := app.sweep(ctx, 24*time.Hour, now); err != nil {
+		t.Fatalf("sweep failed: %v", err)
+	}
+	workers, err := common.ListWorkers(ctx, app.Storage, app.Bucket)
+	if err != nil || len(workers) != 1 || workers[0].ID != "running" {
+		t.Errorf("Expected only the running worker to be left, got %v, %v", workers, err)
+	}
+}
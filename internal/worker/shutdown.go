@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// inflight keeps track of the messages being handled so that a shutdown can
+// wait for them, and nack whatever doesn't finish in time.
+type inflight struct {
+	mu   sync.Mutex
+	wg   sync.WaitGroup
+	msgs map[common.MessageInterface]struct{}
+	// draining is set once drain starts waiting, after which no new message
+	// may be added to wg
+	draining bool
+}
+
+// track registers msg as being handled. The returned func must be called once
+// the handler returns. Once draining, msg is refused and track reports false.
+func (f *inflight) track(msg common.MessageInterface) (func(), bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.draining {
+		return nil, false
+	}
+	if f.msgs == nil {
+		f.msgs = make(map[common.MessageInterface]struct{})
+	}
+	f.msgs[msg] = struct{}{}
+	f.wg.Add(1)
+
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.msgs, msg)
+		f.wg.Done()
+	}, true
+}
+
+// drain waits up to timeout for every tracked message to finish and reports
+// whether they did.
+func (f *inflight) drain(timeout time.Duration) bool {
+	f.mu.Lock()
+	f.draining = true
+	f.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// nackAll nacks every message still being handled so Pub/Sub redelivers them
+// to another worker. Later acks from their handlers have no effect.
+func (f *inflight) nackAll() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for msg := range f.msgs {
+		msg.Nack()
+	}
+	return len(f.msgs)
+}
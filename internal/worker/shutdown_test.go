@@ -0,0 +1,199 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestInflight(t *testing.T) {
+	t.Run("drains finished handlers", func(t *testing.T) {
+		var f inflight
+		done, _ := f.track(&mockMessage{})
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			done()
+		}()
+
+		if !f.drain(time.Second) {
+			t.Error("Expected drain to succeed once the handler finished")
+		}
+		if n := f.nackAll(); n != 0 {
+			t.Errorf("Expected nothing left to nack, got %d", n)
+		}
+	})
+
+	t.Run("nacks handlers past the deadline", func(t *testing.T) {
+		var f inflight
+		finished, stuck := &mockMessage{}, &mockMessage{}
+		done, _ := f.track(finished)
+		done()
+		f.track(stuck)
+
+		if f.drain(10 * time.Millisecond) {
+			t.Error("Expected drain to time out")
+		}
+		if n := f.nackAll(); n != 1 {
+			t.Errorf("Expected 1 message to be nacked, got %d", n)
+		}
+		if !stuck.nackCalled || finished.nackCalled {
+			t.Errorf("Expected only the stuck message to be Nack-ed, got stuck=%v finished=%v", stuck.nackCalled, finished.nackCalled)
+		}
+	})
+
+	t.Run("refuses messages once draining", func(t *testing.T) {
+		var f inflight
+		if !f.drain(time.Second) {
+			t.Fatal("Expected drain to succeed with nothing tracked")
+		}
+		if _, ok := f.track(&mockMessage{}); ok {
+			t.Error("Expected track to refuse a message after drain started")
+		}
+	})
+}
+
+func TestListenMemoryQueue(t *testing.T) {
+	queue := common.NewMemoryQueue()
+	queue.RedeliveryDelay = time.Millisecond
+	testListen(t, queue, "compress", "compress")
+}
+
+// TestListenKafka needs a broker with a compress-test topic, e.g.
+// KAFKA_BROKERS=localhost:9092.
+func TestListenKafka(t *testing.T) {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("KAFKA_BROKERS is not set")
+	}
+	queue := common.NewKafkaQueue(strings.Split(brokers, ","), map[string]string{"compress-test-workers": "compress-test"})
+	defer queue.Close()
+	testListen(t, queue, "compress-test", "compress-test-workers")
+}
+
+// testListen publishes a compression job to topicID and waits for a worker
+// listening on subID to finish it.
+func testListen(t *testing.T, queue common.QueueInterface, topicID, subID string) {
+	t.Helper()
+	app, mockGCS := setupTestApp(t)
+	app.PUBSUBClient = queue
+	app.Subscriptions = map[string]string{common.OperationCompress: subID}
+
+	jobID := uuid.New().String()
+	originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+	mockGCS.SetObject(originalFilePath, []byte("hello from the queue\n"))
+	msgBytes, _ := json.Marshal(common.CompressedMsgSchema{
+		UID:              jobID,
+		OriginalFilePath: originalFilePath,
+		Algorithm:        common.AlgorithmZstd,
+	})
+	if _, err := queue.PublishMessage(context.Background(), topicID, &pubsub.Message{Data: msgBytes}); err != nil {
+		t.Fatalf("Failed to publish: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listened := make(chan error, 1)
+	go func() {
+		listened <- app.Listen(ctx, time.Second)
+	}()
+
+	compressedPath := fmt.Sprintf("%s/compressed.ranran", jobID)
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if _, ok := mockGCS.GetObjectContent(compressedPath); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the job to be processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-listened; err != nil {
+		t.Errorf("Expected Listen to stop cleanly, got %v", err)
+	}
+}
+
+func TestListenBothOperations(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	queue := common.NewMemoryQueue()
+	queue.RedeliveryDelay = time.Millisecond
+	app.PUBSUBClient = queue
+	app.Subscriptions = map[string]string{
+		common.OperationCompress:   "compress",
+		common.OperationDecompress: "decompress",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listened := make(chan error, 1)
+	go func() {
+		listened <- app.Listen(ctx, time.Second)
+	}()
+	waitFor := func(object string) []byte {
+		t.Helper()
+		deadline := time.Now().Add(30 * time.Second)
+		for {
+			if content, ok := mockGCS.GetObjectContent(object); ok {
+				return content
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", object)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	compressID := uuid.New().String()
+	mockGCS.SetObject(compressID+"/original.txt", []byte("hello from both queues\n"))
+	msgBytes, _ := json.Marshal(common.CompressedMsgSchema{UID: compressID, OriginalFilePath: compressID + "/original.txt", Algorithm: common.AlgorithmZstd})
+	queue.PublishMessage(context.Background(), "compress", &pubsub.Message{Data: msgBytes})
+	compressed := waitFor(compressID + "/compressed.ranran")
+
+	decompressID := uuid.New().String()
+	mockGCS.SetObject(decompressID+"/original.txt.ranran", compressed)
+	msgBytes, _ = json.Marshal(common.DecompressedMsgSchema{UID: decompressID, CompressedFilePath: decompressID + "/original.txt.ranran"})
+	queue.PublishMessage(context.Background(), "decompress", &pubsub.Message{Data: msgBytes})
+	if got := waitFor(decompressID + "/original.txt"); string(got) != "hello from both queues\n" {
+		t.Errorf("Expected the original content back, got %q", got)
+	}
+
+	cancel()
+	if err := <-listened; err != nil {
+		t.Errorf("Expected Listen to stop cleanly, got %v", err)
+	}
+}
+
+func TestListenCircuitOpen(t *testing.T) {
+	app, mockGCS := setupTestApp(t)
+	queue := common.NewMemoryQueue()
+	queue.RedeliveryDelay = time.Millisecond
+	app.PUBSUBClient = queue
+	app.Subscriptions = map[string]string{common.OperationCompress: "compress"}
+	breaker := &common.CircuitBreaker{Name: "storage", FailureRatio: 1, MinCalls: 1, Window: time.Minute, Cooldown: time.Minute, IsFailure: func(error) bool { return true }}
+	breaker.Record(errors.New("storage is down"))
+	app.Storage = &common.BreakerStorage{StorageBackend: mockGCS, Breaker: breaker}
+
+	jobID := uuid.New().String()
+	mockGCS.SetObject(jobID+"/original.txt", []byte("hello"))
+	msgBytes, _ := json.Marshal(common.CompressedMsgSchema{UID: jobID, OriginalFilePath: jobID + "/original.txt", Algorithm: common.AlgorithmZstd})
+	queue.PublishMessage(context.Background(), "compress", &pubsub.Message{Data: msgBytes})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := app.Listen(ctx, time.Second); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	if _, ok := mockGCS.GetObjectContent(jobID + "/compressed.ranran"); ok {
+		t.Error("Expected the job to be left alone while the circuit is open")
+	}
+}
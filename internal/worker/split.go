@@ -0,0 +1,349 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// A split job is compressed a part at a time, each part a byte range of the
+// original encoded on its own by whichever worker gets its message. A part
+// leaves its codec output and a record of it under parts/ of the job, and
+// the worker that records the last part enqueues the job's own message,
+// which joins them into one container. The job's own message also enqueues
+// the parts that are missing, so requeueing a split job resumes it.
+
+func partOutputPath(dir string, part int) string {
+	return fmt.Sprintf("%s/parts/%05d.bin", dir, part)
+}
+
+func partRecordPath(dir string, part int) string {
+	return fmt.Sprintf("%s/parts/%05d.json", dir, part)
+}
+
+// splitMessageHandler handles the messages of split jobs, see
+// common.CompressedMsgSchema.
+func (app *Application) splitMessageHandler(msg common.MessageInterface, job common.CompressedMsgSchema) {
+	if job.Part == 0 {
+		app.joinMessageHandler(msg, job)
+		return
+	}
+
+	slog.Info("Received job part", "job", job.UID, "request_id", requestID(msg), "part", job.Part, "parts", job.Parts)
+	part := fmt.Sprintf("part %d of %d", job.Part, job.Parts)
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventDequeued, Reason: part})
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.ProcessingTimeout)
+	defer cancel()
+
+	if _, err := app.Storage.StatObject(ctx, app.Bucket, partRecordPath(jobDir(job.OriginalFilePath), job.Part)); errors.Is(err, common.ErrObjectNotExist) {
+		if !app.startPart(job.UID) {
+			slog.Info("Job is already finished, skipping part", "job", job.UID, "part", job.Part)
+			app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: part + " skipped, job already finished"})
+			jobsProcessed.WithLabelValues(common.OperationCompress, "skipped").Inc()
+			msg.Ack()
+			return
+		}
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventStarted, Reason: part})
+		if !app.compressPart(ctx, msg, job) {
+			return
+		}
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventUploaded, Reason: part})
+	} else if err != nil {
+		app.failJob(msg, job.UID, "Failed to check for compressed part", err)
+		return
+	} else {
+		// an earlier delivery got as far as recording the part
+		slog.Info("Part is already compressed", "job", job.UID, "part", job.Part)
+	}
+
+	records, err := app.partRecords(ctx, jobDir(job.OriginalFilePath))
+	if err != nil {
+		app.failJob(msg, job.UID, "Failed to list compressed parts", err)
+		return
+	}
+	if len(records) == job.Parts {
+		if app.CompressTopicID == "" {
+			// nowhere to enqueue the join, so join the parts right away
+			app.joinParts(ctx, msg, job, records, false)
+			return
+		}
+		if err := app.enqueueSplit(ctx, job, 0); err != nil {
+			app.failJob(msg, job.UID, "Failed to enqueue joining the parts", err)
+			return
+		}
+		slog.Info("Enqueued joining the parts", "job", job.UID, "parts", job.Parts)
+	}
+	msg.Ack()
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: part})
+	slog.Info("Completed processing job part", "job", job.UID, "part", job.Part)
+}
+
+// startPart marks the job PROCESSING unless it is finished already, which
+// leaves nothing to do for its parts.
+func (app *Application) startPart(jobID string) bool {
+	ctx, cancel := context.WithTimeout(*app.CTX, app.GCSTimeout)
+	defer cancel()
+
+	_, err := app.JobStore.UpdateJob(ctx, jobID, func(job *common.Job) error {
+		if job.Status.Finished() {
+			return errJobCanceled
+		}
+		job.Status = common.JobProcessing
+		job.Error = ""
+		job.Attempts++
+		return nil
+	})
+	if errors.Is(err, errJobCanceled) {
+		return false
+	}
+	if err != nil {
+		slog.Warn("Failed to update job status", "job", jobID, "status", common.JobProcessing, "error", err)
+	}
+	return true
+}
+
+// compressPart compresses the range of the original of a part and records
+// it. On failure the message is settled and false returned.
+func (app *Application) compressPart(ctx context.Context, msg common.MessageInterface, job common.CompressedMsgSchema) bool {
+	openPart := func() (common.ObjectReaderInterface, error) {
+		return app.Storage.NewRangeReader(ctx, app.Bucket, job.OriginalFilePath, job.Offset, job.Length)
+	}
+	codec, reason, err := app.compressCodec(ctx, job, openPart)
+	if err != nil {
+		app.failJob(msg, job.UID, reason, err)
+		return false
+	}
+
+	// a delivery that stopped before recording the part may have left its
+	// output behind
+	output := partOutputPath(jobDir(job.OriginalFilePath), job.Part)
+	if err := app.Storage.DeleteObject(ctx, app.Bucket, output); err != nil {
+		app.failJob(msg, job.UID, "Failed to remove earlier part output", err)
+		return false
+	}
+	original, err := openPart()
+	if err != nil {
+		app.failJob(msg, job.UID, "Failed to locate original file content", err)
+		return false
+	}
+	defer original.Close()
+	in := &countingReader{r: original}
+	crc := crc32.NewIEEE()
+	out, err := app.streamToStorage(ctx, output, func(w io.Writer) error {
+		return codec.Compress(io.TeeReader(in, crc), w)
+	}, common.WithKMSKey(job.KMSKeyName))
+	if errors.Is(err, common.ErrObjectExists) {
+		// another delivery of the part is at it, let it finish
+		slog.Info("Part is being compressed by another delivery", "job", job.UID, "part", job.Part)
+		msg.Nack()
+		return false
+	} else if err != nil {
+		app.failJob(msg, job.UID, "Failed to compress part to storage", err)
+		return false
+	}
+	if in.n != job.Length {
+		app.failJob(msg, job.UID, "Failed to read part of original file", fmt.Errorf("read %d of %d bytes", in.n, job.Length))
+		return false
+	}
+
+	record := compression.ContainerPart{Size: in.n, Length: out, CRC: crc.Sum32()}
+	if err := app.savePartRecord(ctx, jobDir(job.OriginalFilePath), job.Part, record); err != nil {
+		app.failJob(msg, job.UID, "Failed to record compressed part", err)
+		return false
+	}
+	slog.Debug("Uploaded compressed part to storage", "job", job.UID, "part", job.Part)
+	return true
+}
+
+func (app *Application) savePartRecord(ctx context.Context, dir string, part int, record compression.ContainerPart) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal part record: %w", err)
+	}
+	wc := app.Storage.NewObjectWriter(ctx, app.Bucket, partRecordPath(dir, part), common.WithContentType("application/json"))
+	if _, err := io.Copy(wc, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write part record: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("failed to close part record writer: %w", err)
+	}
+	return nil
+}
+
+// partRecords reads the records of the compressed parts of the job in dir,
+// by part.
+func (app *Application) partRecords(ctx context.Context, dir string) (map[int]compression.ContainerPart, error) {
+	objects, err := app.Storage.ListObjects(ctx, app.Bucket, dir+"/parts/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list part records: %w", err)
+	}
+	records := make(map[int]compression.ContainerPart)
+	for _, object := range objects {
+		name, ok := strings.CutSuffix(path.Base(object.Name), ".json")
+		if !ok {
+			continue
+		}
+		part, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		rc, err := app.Storage.NewObjectReader(ctx, app.Bucket, object.Name)
+		if err != nil {
+			// joined and removed since it was listed
+			if errors.Is(err, common.ErrObjectNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read part record: %w", err)
+		}
+		var record compression.ContainerPart
+		err = json.NewDecoder(rc).Decode(&record)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode part record: %w", err)
+		}
+		records[part] = record
+	}
+	return records, nil
+}
+
+// enqueueSplit publishes the message of one part of a split job, or the
+// job's own message for part 0.
+func (app *Application) enqueueSplit(ctx context.Context, job common.CompressedMsgSchema, part int) error {
+	if app.CompressTopicID == "" {
+		return errors.New("no compress topic to enqueue on")
+	}
+	record, err := app.JobStore.GetJob(ctx, job.UID)
+	if err != nil {
+		return err
+	}
+	job.Part = part
+	job.Offset, job.Length = 0, 0
+	if part > 0 {
+		job.Offset, job.Length = common.PartRange(record.InputSize, job.Parts, part)
+	}
+	return app.publish(ctx, app.topicFor(app.CompressTopicID, record.Priority), record.RequestID, job)
+}
+
+// joinMessageHandler joins the parts of a split job, or enqueues those that
+// aren't compressed yet when the job was requeued.
+func (app *Application) joinMessageHandler(msg common.MessageInterface, job common.CompressedMsgSchema) {
+	slog.Info("Received job to join", "job", job.UID, "request_id", requestID(msg), "parts", job.Parts)
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventDequeued, Reason: "join"})
+	if app.alreadyDone(job.UID) {
+		slog.Info("Job is already done or canceled, skipping delivery", "job", job.UID)
+		app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked, Reason: "already done or canceled"})
+		jobsProcessed.WithLabelValues(common.OperationCompress, "skipped").Inc()
+		msg.Ack()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(*app.CTX, app.ProcessingTimeout)
+	defer cancel()
+
+	records, err := app.partRecords(ctx, jobDir(job.OriginalFilePath))
+	if err != nil {
+		app.failJob(msg, job.UID, "Failed to list compressed parts", err)
+		return
+	}
+	if len(records) < job.Parts {
+		for part := 1; part <= job.Parts; part++ {
+			if _, ok := records[part]; ok {
+				continue
+			}
+			if err := app.enqueueSplit(ctx, job, part); err != nil {
+				app.failJob(msg, job.UID, "Failed to enqueue missing part", err)
+				return
+			}
+			app.recordEvent(job.UID, common.JobEvent{Type: common.EventPublished, Reason: fmt.Sprintf("part %d of %d", part, job.Parts)})
+		}
+		slog.Info("Enqueued missing parts", "job", job.UID, "parts", job.Parts, "compressed", len(records))
+		msg.Ack()
+		return
+	}
+	app.joinParts(ctx, msg, job, records, false)
+}
+
+// joinParts writes the result of a split job from its compressed parts and
+// removes them. Stored tells the job was found incompressible.
+func (app *Application) joinParts(ctx context.Context, msg common.MessageInterface, job common.CompressedMsgSchema, records map[int]compression.ContainerPart, stored bool) {
+	start := time.Now()
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventStarted, Reason: "join"})
+
+	parts := make([]compression.ContainerPart, job.Parts)
+	var in int64
+	for i := range parts {
+		parts[i] = records[i+1]
+		in += parts[i].Size
+	}
+	algorithm := job.Algorithm
+	if algorithm == "" {
+		algorithm = common.AlgorithmHuffman
+	}
+	meta := compression.ContainerMetadata{Name: job.FileName, ContentType: job.ContentType, Dictionary: job.Dictionary}
+	if meta.Name == "" {
+		meta.Name = strings.TrimPrefix(path.Base(job.OriginalFilePath), "original_")
+	}
+
+	dir := jobDir(job.OriginalFilePath)
+	compressedFilePath := fmt.Sprintf("%s/compressed%s", dir, common.AlgorithmExtension(job.Algorithm))
+	digest := sha256.New()
+	out, err := app.streamToStorage(ctx, compressedFilePath, func(w io.Writer) error {
+		return compression.JoinContainer(io.MultiWriter(w, digest), algorithm, parts, meta, func(i int) (io.ReadCloser, error) {
+			return app.Storage.NewObjectReader(ctx, app.Bucket, partOutputPath(dir, i+1))
+		})
+	}, common.WithKMSKey(job.KMSKeyName))
+	manifest := common.Manifest{
+		JobID:       job.UID,
+		Operation:   common.OperationCompress,
+		FileName:    meta.Name,
+		ContentType: job.ContentType,
+		Algorithm:   algorithm,
+		Level:       job.Level,
+		Stored:      stored,
+		Result:      compressedFilePath,
+		InputSize:   in,
+		OutputSize:  out,
+		Chunks:      manifestChunks(parts),
+		StartedAt:   start.UTC(),
+	}
+	if errors.Is(err, common.ErrObjectExists) {
+		// an earlier delivery got as far as uploading the result
+		slog.Info("Compressed data is already in storage", "job", job.UID)
+	} else if err != nil {
+		app.failJob(msg, job.UID, "Failed to join compressed parts", err)
+		return
+	} else {
+		manifest.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	}
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventUploaded})
+	manifest = app.writeManifest(ctx, app.Bucket, manifest, common.WithKMSKey(job.KMSKeyName))
+
+	app.setJobStatus(job.UID, common.JobDone, "", func(j *common.Job) {
+		j.ResultPath = compressedFilePath
+		j.OutputSize = manifest.OutputSize
+		j.Stored = stored
+	})
+	// the parts are of no use once joined
+	if err := app.deletePrefix(ctx, dir+"/parts/"); err != nil {
+		slog.Warn("Failed to remove joined parts", "job", job.UID, "error", err)
+	}
+	msg.Ack()
+	app.recordEvent(job.UID, common.JobEvent{Type: common.EventAcked})
+	observeJob(common.OperationCompress, start, in, out)
+	slog.Info("Completed processing job", "job", job.UID, "parts", job.Parts)
+}
@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// setupSplitJob stores original and a job record splitting it into parts.
+func setupSplitJob(t *testing.T, app *Application, mockGCS *mockGCSClient, algorithm, original string, parts int) common.CompressedMsgSchema {
+	t.Helper()
+	jobID := uuid.New().String()
+	job := common.CompressedMsgSchema{
+		UID:              jobID,
+		OriginalFilePath: fmt.Sprintf("%s/original_big.log", jobID),
+		Algorithm:        algorithm,
+		FileName:         "big.log",
+		Parts:            parts,
+	}
+	mockGCS.SetObject(job.OriginalFilePath, []byte(original))
+	if err := app.JobStore.CreateJob(context.Background(), &common.Job{
+		ID:        jobID,
+		Operation: common.OperationCompress,
+		Algorithm: algorithm,
+		FileName:  "big.log",
+		InputSize: int64(len(original)),
+		Parts:     parts,
+	}); err != nil {
+		t.Fatalf("Failed to create job: %v", err)
+	}
+	return job
+}
+
+func handleSplitMessage(t *testing.T, app *Application, job common.CompressedMsgSchema) *mockMessage {
+	t.Helper()
+	data, _ := json.Marshal(job)
+	msg := &mockMessage{data: data}
+	app.compressMessageHandler(context.Background(), msg)
+	if !msg.ackCalled {
+		t.Fatalf("Expected message of part %d to be acked", job.Part)
+	}
+	return msg
+}
+
+func partMessage(job common.CompressedMsgSchema, size int64, part int) common.CompressedMsgSchema {
+	job.Part = part
+	job.Offset, job.Length = common.PartRange(size, job.Parts, part)
+	return job
+}
+
+func TestSplitJob(t *testing.T) {
+	original := strings.Repeat("every part is compressed by its own worker\n", 300) + "the end"
+	testCases := []struct {
+		algorithm string
+		// without a compress topic the last part joins the parts itself
+		topic string
+	}{
+		{algorithm: common.AlgorithmHuffman, topic: testCompressTopic},
+		{algorithm: common.AlgorithmZstd, topic: testCompressTopic},
+		{algorithm: common.AlgorithmAdaptive},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			app.CompressTopicID = tc.topic
+			job := setupSplitJob(t, app, mockGCS, tc.algorithm, original, 3)
+			queue := app.PUBSUBClient.(*mockPubSubClient)
+
+			for _, part := range []int{3, 1, 2} {
+				if messages := queue.GetMessages(testCompressTopic); len(messages) != 0 {
+					t.Fatalf("Expected the join to wait for every part, got %d messages", len(messages))
+				}
+				handleSplitMessage(t, app, partMessage(job, int64(len(original)), part))
+			}
+			if tc.topic != "" {
+				messages := queue.GetMessages(testCompressTopic)
+				if len(messages) != 1 {
+					t.Fatalf("Expected the join to be enqueued once, got %d messages", len(messages))
+				}
+				var join common.CompressedMsgSchema
+				common.UnmarshalMessage(messages[0].Data, &join)
+				if join.Part != 0 || join.Parts != 3 {
+					t.Fatalf("Unexpected join message: %+v", join)
+				}
+				handleSplitMessage(t, app, join)
+			}
+
+			record, err := app.JobStore.GetJob(context.Background(), job.UID)
+			if err != nil || record.Status != common.JobDone {
+				t.Fatalf("Expected job to be DONE, got %+v, %v", record, err)
+			}
+			result, ok := mockGCS.GetObjectContent(record.ResultPath)
+			if !ok {
+				t.Fatalf("Expected result %q to exist", record.ResultPath)
+			}
+			var out bytes.Buffer
+			header, err := compression.ReadContainer(bytes.NewReader(result), &out, app.lookupCodec)
+			if err != nil {
+				t.Fatalf("Failed to read joined container: %v", err)
+			}
+			if out.String() != original || len(header.Metadata.Parts) != 3 || header.Metadata.Name != "big.log" {
+				t.Errorf("Unexpected joined container: %+v with %d bytes", header, out.Len())
+			}
+			if parts, _ := mockGCS.ListObjects(context.Background(), testBucket, job.UID+"/parts/"); len(parts) != 0 {
+				t.Errorf("Expected the parts to be removed once joined, got %d objects", len(parts))
+			}
+		})
+	}
+}
+
+func TestSplitJobResume(t *testing.T) {
+	original := strings.Repeat("requeued split jobs pick up where they stopped\n", 100)
+	app, mockGCS := setupTestApp(t)
+	app.CompressTopicID = testCompressTopic
+	job := setupSplitJob(t, app, mockGCS, common.AlgorithmZstd, original, 3)
+	handleSplitMessage(t, app, partMessage(job, int64(len(original)), 2))
+
+	// the job's own message enqueues the parts that are missing
+	handleSplitMessage(t, app, job)
+	messages := app.PUBSUBClient.(*mockPubSubClient).GetMessages(testCompressTopic)
+	var parts []int
+	for _, message := range messages {
+		var part common.CompressedMsgSchema
+		common.UnmarshalMessage(message.Data, &part)
+		want := partMessage(job, int64(len(original)), part.Part)
+		if part != want {
+			t.Errorf("Unexpected part message %+v, want %+v", part, want)
+		}
+		parts = append(parts, part.Part)
+	}
+	if fmt.Sprint(parts) != "[1 3]" {
+		t.Errorf("Expected parts 1 and 3 to be enqueued, got %v", parts)
+	}
+	if record, _ := app.JobStore.GetJob(context.Background(), job.UID); record.Status == common.JobDone {
+		t.Errorf("Expected the job to wait for its parts")
+	}
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"io"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// incompressible reports whether the original of job, read from open, starts
+// out as random as compressed or encrypted data. Such originals are stored
+// as they are instead. Only whole .ranran jobs qualify: gzip output has to be
+// gzip, the parts of a split job are joined under one algorithm, and the
+// manager named the result of an in-place job after its algorithm.
+func (app *Application) incompressible(job common.CompressedMsgSchema, open func() (common.ObjectReaderInterface, error)) bool {
+	if !common.UsesContainer(job.Algorithm) || job.Archive || job.Parts > 0 || job.Algorithm == common.AlgorithmStore || job.ResultPath != "" {
+		return false
+	}
+	original, err := open()
+	if err != nil {
+		// reading it for real reports the error
+		return false
+	}
+	defer original.Close()
+	sample, err := io.ReadAll(io.LimitReader(original, compression.IncompressibleSampleSize))
+	if err != nil {
+		return false
+	}
+	return compression.Incompressible(sample)
+}
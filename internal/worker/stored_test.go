@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestIncompressibleOriginal(t *testing.T) {
+	random := make([]byte, 100<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+	testCases := []struct {
+		name      string
+		original  []byte
+		algorithm string
+		stored    bool
+	}{
+		{name: "random huffman", original: random, algorithm: common.AlgorithmHuffman, stored: true},
+		{name: "random zstd", original: random, algorithm: common.AlgorithmZstd, stored: true},
+		{name: "text", original: []byte(strings.Repeat("text is nowhere near random\n", 100)), algorithm: common.AlgorithmZstd},
+		{name: "random gzip", original: random, algorithm: common.AlgorithmGzip},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			originalFilePath := fmt.Sprintf("%s/original_blob.bin", jobID)
+			mockGCS.SetObject(originalFilePath, tc.original)
+			app.JobStore.CreateJob(context.Background(), &common.Job{ID: jobID, Operation: common.OperationCompress, Algorithm: tc.algorithm})
+
+			data, _ := json.Marshal(common.CompressedMsgSchema{
+				UID:              jobID,
+				OriginalFilePath: originalFilePath,
+				Algorithm:        tc.algorithm,
+				FileName:         "blob.bin",
+				Verify:           true,
+			})
+			msg := &mockMessage{data: data}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected message to be Ack-ed")
+			}
+			job, err := app.JobStore.GetJob(context.Background(), jobID)
+			if err != nil || job.Status != common.JobDone || job.Stored != tc.stored {
+				t.Fatalf("Expected a DONE job with stored %v, got %+v, %v", tc.stored, job, err)
+			}
+			if !tc.stored {
+				return
+			}
+
+			result, _ := mockGCS.GetObjectContent(job.ResultPath)
+			if len(result) > len(tc.original)+256 {
+				t.Errorf("Expected the stored output to be about the size of the input, got %d for %d bytes", len(result), len(tc.original))
+			}
+			var out bytes.Buffer
+			header, err := compression.ReadContainer(bytes.NewReader(result), &out, app.lookupCodec)
+			if err != nil || header.Algorithm != common.AlgorithmStore || !bytes.Equal(out.Bytes(), tc.original) {
+				t.Errorf("Expected a stored container of the original, got %+v, %v", header, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+// errRoundTrip is returned when compressed output doesn't decompress back to
+// the data it was made from.
+var errRoundTrip = common.NewError(common.ErrPermanent, "round-trip verification failed")
+
+// teeCodec passes everything it compresses through to w as well, so the
+// digest of the original covers exactly what the codec saw.
+type teeCodec struct {
+	compression.Codec
+	w io.Writer
+}
+
+func (c teeCodec) Compress(r io.Reader, w io.Writer) error {
+	return c.Codec.Compress(io.TeeReader(r, c.w), w)
+}
+
+// roundTrip decompresses the output of a compression job while it is being
+// written and compares it with the input once both are done.
+type roundTrip struct {
+	pw       *io.PipeWriter
+	original hash.Hash
+	done     chan []byte
+	err      error
+}
+
+// newRoundTrip starts decoding what is written to it as the output of job,
+// and returns codec wrapped to record its input.
+func (app *Application) newRoundTrip(ctx context.Context, job common.CompressedMsgSchema, codec compression.Codec) (*roundTrip, compression.Codec) {
+	pr, pw := io.Pipe()
+	rt := &roundTrip{pw: pw, original: sha256.New(), done: make(chan []byte, 1)}
+	go func() {
+		decoded := sha256.New()
+		var err error
+		defer func() {
+			// keep draining so a failed decode never stalls the upload
+			io.Copy(io.Discard, pr)
+			rt.err = err
+			rt.done <- decoded.Sum(nil)
+		}()
+		defer recoverPanic("verify", &err)
+		if common.UsesContainer(job.Algorithm) {
+			var header *compression.ContainerHeader
+			if header, err = compression.ReadContainerHeader(pr); err == nil {
+				var lookup func(string) (compression.Codec, error)
+				if lookup, err = app.dictionaryLookup(ctx, header.Metadata.Dictionary); err == nil {
+					err = compression.ReadContainerPayload(pr, header, decoded, lookup)
+				}
+			}
+		} else {
+			var decoder compression.Codec
+			if decoder, err = app.lookupCodec(job.Algorithm); err == nil {
+				err = compression.WithContext(ctx, decoder).Decompress(pr, decoded)
+			}
+		}
+	}()
+	return rt, teeCodec{Codec: codec, w: rt.original}
+}
+
+func (rt *roundTrip) Write(p []byte) (int, error) {
+	return rt.pw.Write(p)
+}
+
+// Close waits for the decoder to finish and reports whether it got the
+// original back.
+func (rt *roundTrip) Close() error {
+	rt.pw.Close()
+	decoded := <-rt.done
+	if rt.err != nil {
+		return fmt.Errorf("%w: %v", errRoundTrip, rt.err)
+	}
+	if !bytes.Equal(decoded, rt.original.Sum(nil)) {
+		return fmt.Errorf("%w: decompressed data differs from the original", errRoundTrip)
+	}
+	return nil
+}
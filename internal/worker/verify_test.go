@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/compression"
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/internal/common"
+)
+
+func TestVerifiedCompression(t *testing.T) {
+	testCases := []struct {
+		algorithm      string
+		compressedName string
+	}{
+		{algorithm: common.AlgorithmHuffman, compressedName: "compressed.ranran"},
+		{algorithm: common.AlgorithmZstd, compressedName: "compressed.ranran"},
+		{algorithm: common.AlgorithmGzip, compressedName: "compressed.gz"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			app, mockGCS := setupTestApp(t)
+			jobID := uuid.New().String()
+			originalFilePath := fmt.Sprintf("%s/original.txt", jobID)
+			mockGCS.SetObject(originalFilePath, []byte("verify me, verify me twice\n"))
+
+			msgBytes, _ := json.Marshal(common.CompressedMsgSchema{
+				UID:              jobID,
+				OriginalFilePath: originalFilePath,
+				Algorithm:        tc.algorithm,
+				Verify:           true,
+			})
+			msg := &mockMessage{data: msgBytes}
+			app.compressMessageHandler(context.Background(), msg)
+			if !msg.ackCalled {
+				t.Fatal("Expected message to be Ack-ed, but it wasn't")
+			}
+			if _, ok := mockGCS.GetObjectContent(fmt.Sprintf("%s/%s", jobID, tc.compressedName)); !ok {
+				t.Errorf("Expected compressed file %q to exist, but it doesn't", tc.compressedName)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	app, _ := setupTestApp(t)
+	job := common.CompressedMsgSchema{Algorithm: common.AlgorithmZstd}
+	codec, err := compression.Lookup(common.AlgorithmZstd)
+	if err != nil {
+		t.Fatalf("Failed to look up codec: %v", err)
+	}
+
+	// writes the container of data as the output of a job whose input was input
+	compressAs := func(t *testing.T, input, data string) error {
+		t.Helper()
+		rt, teeCodec := app.newRoundTrip(context.Background(), job, codec)
+		var container bytes.Buffer
+		if err := compression.WriteContainer(&container, codec, bytes.NewReader([]byte(data)), compression.ContainerMetadata{}); err != nil {
+			t.Fatalf("Failed to write container: %v", err)
+		}
+		if err := teeCodec.Compress(bytes.NewReader([]byte(input)), new(bytes.Buffer)); err != nil {
+			t.Fatalf("Failed to compress: %v", err)
+		}
+		rt.Write(container.Bytes())
+		return rt.Close()
+	}
+
+	if err := compressAs(t, "same", "same"); err != nil {
+		t.Errorf("Expected matching output to verify, got %v", err)
+	}
+	if err := compressAs(t, "original", "something else"); !errors.Is(err, errRoundTrip) {
+		t.Errorf("Expected errRoundTrip for different output, got %v", err)
+	}
+
+	rt, _ := app.newRoundTrip(context.Background(), job, codec)
+	rt.Write([]byte("not a container"))
+	if err := rt.Close(); !errors.Is(err, errRoundTrip) {
+		t.Errorf("Expected errRoundTrip for undecodable output, got %v", err)
+	}
+}
+
+// TestHuffmanDecompressStreams checks that Huffman output is decoded while it
+// is still being written, so verifying a large job doesn't buffer all of it.
+func TestHuffmanDecompressStreams(t *testing.T) {
+	// decodes to more than the output buffer holds
+	original := strings.Repeat("streaming huffman ", 10000)
+	freqTable, err := buildFreqTable(strings.NewReader(original))
+	if err != nil {
+		t.Fatalf("Failed to build frequency table: %v", err)
+	}
+	pq, pt, err := buildHuffmanTree(freqTable)
+	if err != nil {
+		t.Fatalf("Failed to build Huffman tree: %v", err)
+	}
+	codec := huffmanCodec{root: pq[0], pt: pt}
+	var compressed bytes.Buffer
+	if err := codec.Compress(strings.NewReader(original), &compressed); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	decoded := make(chan struct{})
+	out := &notifyingWriter{notify: decoded}
+	result := make(chan error, 1)
+	go func() { result <- codec.Decompress(pr, out) }()
+
+	// hold back the end of the input until some output has been written
+	data := compressed.Bytes()
+	half := len(data) / 2
+	go pw.Write(data[:half])
+	select {
+	case <-decoded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected output before the input was complete")
+	}
+	pw.Write(data[half:])
+	pw.Close()
+
+	if err := <-result; err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	if out.buf.String() != original {
+		t.Errorf("Decompressed data differs from the original")
+	}
+}
+
+// notifyingWriter closes notify on the first write.
+type notifyingWriter struct {
+	buf    bytes.Buffer
+	notify chan struct{}
+}
+
+func (w *notifyingWriter) Write(p []byte) (int, error) {
+	if w.buf.Len() == 0 {
+		close(w.notify)
+	}
+	return w.buf.Write(p)
+}
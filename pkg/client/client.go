@@ -0,0 +1,554 @@
+// Package client is a Go client for the manager's HTTP API. It submits files
+// for compression or decompression, follows the jobs and fetches their
+// results.
+//
+//	c := client.New("https://compress.example.com", client.WithAPIKey(key))
+//	id, err := c.Compress(ctx, "notes.txt", f, nil)
+//	job, err := c.Wait(ctx, id)
+//	_, err = c.Download(ctx, id, out)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JobStatus is the state of a job, see the constants below.
+type JobStatus string
+
+const (
+	JobAwaitingUpload JobStatus = "AWAITING_UPLOAD"
+	JobScheduled      JobStatus = "SCHEDULED"
+	JobPending        JobStatus = "PENDING"
+	JobProcessing     JobStatus = "PROCESSING"
+	JobDone           JobStatus = "DONE"
+	JobFailed         JobStatus = "FAILED"
+	JobExpired        JobStatus = "EXPIRED"
+	JobCanceled       JobStatus = "CANCELED"
+)
+
+// Finished reports whether the job has reached a status it never leaves.
+func (s JobStatus) Finished() bool {
+	switch s {
+	case JobDone, JobFailed, JobExpired, JobCanceled:
+		return true
+	}
+	return false
+}
+
+// Job is the record the manager keeps of a compression or decompression.
+type Job struct {
+	ID                string    `json:"id"`
+	Operation         string    `json:"operation"`
+	Status            JobStatus `json:"status"`
+	FileName          string    `json:"file_name"`
+	ContentType       string    `json:"content_type,omitempty"`
+	Algorithm         string    `json:"algorithm,omitempty"`
+	Level             int       `json:"level,omitempty"`
+	Profile           string    `json:"profile,omitempty"`
+	BatchID           string    `json:"batch_id,omitempty"`
+	Archive           bool      `json:"archive,omitempty"`
+	InputSize         int64     `json:"input_size,omitempty"`
+	Verify            bool      `json:"verify,omitempty"`
+	Priority          string    `json:"priority,omitempty"`
+	NotBefore         time.Time `json:"not_before,omitzero"`
+	ResultContentType string    `json:"result_content_type,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// CompressOptions are the optional settings of a compression job. The zero
+// value compresses with the manager's defaults.
+type CompressOptions struct {
+	// Algorithm is the codec, "huffman" (the default), "zstd" or "gzip".
+	Algorithm string
+	// Level is the compression level, 0 for the codec's default.
+	Level int
+	// Profile is a profile of the manager, e.g. "fast", "balanced" or
+	// "max", which picks the algorithm and level instead. Only the HTTP
+	// client sends it.
+	Profile string
+	// KMSKey encrypts the job's objects with this key.
+	KMSKey string
+	// Verify decompresses the output again before it is stored.
+	Verify bool
+	// SHA256 is the hex digest the manager checks the upload against.
+	SHA256 string
+	// Priority is "high", "normal" (the default) or "low". Only the HTTP
+	// client sends it, over gRPC jobs are normal.
+	Priority string
+	// NotBefore schedules the job to start no earlier than then. Like
+	// Priority it is only sent over HTTP.
+	NotBefore time.Time
+}
+
+// APIError is an error response of the manager.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is how long the manager asked to wait, for 429 responses.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("manager returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("manager returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// ErrJobNotDone is returned by Wait for jobs that finished without a result.
+var ErrJobNotDone = errors.New("job finished without a result")
+
+// Client calls the API of one manager. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	apiKey       string
+	token        string
+	httpClient   *http.Client
+	maxRetries   int
+	retryBackoff time.Duration
+	pollInterval time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithAPIKey sends key in X-API-Key with every request.
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+// WithBearerToken sends token, e.g. an OIDC ID token, as a bearer token with
+// every request.
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient makes requests with hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries retries failed requests up to n times, waiting backoff before
+// the first retry and twice as long before each next one. Only network errors
+// and 5xx responses are retried, and uploads only when their reader is an
+// io.Seeker. The default is 3 retries starting at 500ms.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+		c.retryBackoff = backoff
+	}
+}
+
+// WithPollInterval sets how often Wait asks for the job status, 2s by
+// default.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) { c.pollInterval = d }
+}
+
+// New returns a client for the manager at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		maxRetries:   3,
+		retryBackoff: 500 * time.Millisecond,
+		pollInterval: 2 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Compress uploads the content of r as a file called name and returns the ID
+// of the compression job. opts may be nil.
+func (c *Client) Compress(ctx context.Context, name string, r io.Reader, opts *CompressOptions) (string, error) {
+	fields := map[string]string{}
+	if opts != nil {
+		if opts.Algorithm != "" {
+			fields["algorithm"] = opts.Algorithm
+		}
+		if opts.Level != 0 {
+			fields["level"] = strconv.Itoa(opts.Level)
+		}
+		if opts.Profile != "" {
+			fields["profile"] = opts.Profile
+		}
+		if opts.KMSKey != "" {
+			fields["kms_key"] = opts.KMSKey
+		}
+		if opts.Verify {
+			fields["verify"] = "true"
+		}
+		if opts.SHA256 != "" {
+			fields["sha256"] = opts.SHA256
+		}
+		if opts.Priority != "" {
+			fields["priority"] = opts.Priority
+		}
+		if !opts.NotBefore.IsZero() {
+			fields["not_before"] = opts.NotBefore.Format(time.RFC3339)
+		}
+	}
+	return c.submit(ctx, "/v1/compress", name, r, fields)
+}
+
+// Decompress uploads the .ranran or .gz content of r as a file called name
+// and returns the ID of the decompression job.
+func (c *Client) Decompress(ctx context.Context, name string, r io.Reader) (string, error) {
+	return c.submit(ctx, "/v1/decompress", name, r, nil)
+}
+
+func (c *Client) submit(ctx context.Context, path, name string, r io.Reader, fields map[string]string) (string, error) {
+	// the form is streamed, so a retry needs to read the file again
+	seeker, canRetry := r.(io.Seeker)
+	var start int64
+	if canRetry {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			canRetry = false
+		}
+	}
+
+	var prev *io.PipeReader
+	var done chan struct{}
+	defer func() {
+		if prev != nil {
+			prev.Close()
+		}
+	}()
+	newBody := func() (io.Reader, string, error) {
+		if prev != nil {
+			// the form of the previous attempt may still be reading r
+			prev.Close()
+			<-done
+		}
+		if canRetry {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, "", err
+			}
+		}
+		pr, pw := io.Pipe()
+		form := multipart.NewWriter(pw)
+		prev, done = pr, make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			pw.CloseWithError(writeForm(form, name, r, fields))
+		}(done)
+		return pr, form.FormDataContentType(), nil
+	}
+
+	var body struct {
+		JobID string `json:"job_id"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, path, newBody, canRetry, &body); err != nil {
+		return "", err
+	}
+	return body.JobID, nil
+}
+
+func writeForm(form *multipart.Writer, name string, r io.Reader, fields map[string]string) error {
+	for key, value := range fields {
+		if err := form.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// Job returns the current record of the job.
+func (c *Client) Job(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.doJSON(ctx, http.MethodGet, jobPath(id, ""), nil, true, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Jobs looks up many jobs in one request, at most 1000. Jobs the manager
+// couldn't look up are left out of the records and returned with the reason
+// in rejected instead.
+func (c *Client) Jobs(ctx context.Context, ids []string) (jobs map[string]*Job, rejected map[string]string, err error) {
+	data, err := json.Marshal(map[string][]string{"job_ids": ids})
+	if err != nil {
+		return nil, nil, err
+	}
+	body := func() (io.Reader, string, error) { return bytes.NewReader(data), "application/json", nil }
+	var resp struct {
+		Jobs     map[string]*Job   `json:"jobs"`
+		Rejected map[string]string `json:"rejected"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/v1/jobs/status", body, true, &resp); err != nil {
+		return nil, nil, err
+	}
+	return resp.Jobs, resp.Rejected, nil
+}
+
+// Wait polls the job until it finishes or ctx is done. A job that finished
+// without a result is returned along with ErrJobNotDone.
+func (c *Client) Wait(ctx context.Context, id string) (*Job, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if job.Status.Finished() {
+			if job.Status != JobDone {
+				return job, fmt.Errorf("%w: job %s is %s %s", ErrJobNotDone, id, job.Status, job.Error)
+			}
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cancel stops a job that hasn't finished and returns its record. Canceling a
+// finished job fails with a 409 APIError.
+func (c *Client) Cancel(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.doJSON(ctx, http.MethodPost, jobPath(id, "/cancel"), nil, true, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Result is the output of a finished job. Body must be closed.
+type Result struct {
+	// Name is the file name the manager suggests for the output. It comes
+	// from the server, so strip any directories before using it as a path.
+	Name        string
+	ContentType string
+	Body        io.ReadCloser
+}
+
+// Result opens the output of a finished job.
+func (c *Client) Result(ctx context.Context, id string) (*Result, error) {
+	resp, err := c.do(ctx, http.MethodGet, jobPath(id, "/result"), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{ContentType: resp.Header.Get("Content-Type"), Body: resp.Body}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		result.Name = params["filename"]
+	}
+	return result, nil
+}
+
+// Download copies the output of a finished job to w and returns the file
+// name the manager suggests for it.
+func (c *Client) Download(ctx context.Context, id string, w io.Writer) (string, error) {
+	result, err := c.Result(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer result.Body.Close()
+	if _, err := io.Copy(w, result.Body); err != nil {
+		return "", fmt.Errorf("failed to download result: %w", err)
+	}
+	return result.Name, nil
+}
+
+// Manifest describes the output of a finished job, as the worker that wrote
+// it recorded. SHA256 is the hex digest of the output.
+type Manifest struct {
+	JobID       string          `json:"job_id"`
+	Operation   string          `json:"operation"`
+	FileName    string          `json:"file_name"`
+	ContentType string          `json:"content_type,omitempty"`
+	Algorithm   string          `json:"algorithm,omitempty"`
+	Level       int             `json:"level,omitempty"`
+	Stored      bool            `json:"stored,omitempty"`
+	Result      string          `json:"result"`
+	InputSize   int64           `json:"input_size"`
+	OutputSize  int64           `json:"output_size"`
+	SHA256      string          `json:"sha256"`
+	Chunks      []ManifestChunk `json:"chunks,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  time.Time       `json:"finished_at"`
+}
+
+// ManifestChunk is one separately compressed part of an output: Size bytes
+// of the original from Offset on.
+type ManifestChunk struct {
+	Index          int    `json:"index"`
+	Offset         int64  `json:"offset"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+	CRC32          uint32 `json:"crc32"`
+}
+
+// Manifest fetches the manifest of the output of a finished job.
+func (c *Client) Manifest(ctx context.Context, id string) (*Manifest, error) {
+	var manifest Manifest
+	if err := c.doJSON(ctx, http.MethodGet, jobPath(id, "/manifest"), nil, true, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// HuffmanTable is the code table of a Huffman coded output, one per part of
+// an output joined from parts, with how often each symbol was coded.
+// AverageBits is what a symbol took on average, Entropy the least any code
+// could average.
+type HuffmanTable struct {
+	Part         int             `json:"part,omitempty"`
+	Layout       string          `json:"layout"`
+	Chunks       int             `json:"chunks,omitempty"`
+	Symbols      []HuffmanSymbol `json:"symbols"`
+	TotalSymbols uint64          `json:"total_symbols"`
+	TotalBits    uint64          `json:"total_bits"`
+	AverageBits  float64         `json:"average_bits"`
+	Entropy      float64         `json:"entropy"`
+}
+
+// HuffmanSymbol is a symbol of a code table, with its code of Bits bits
+// written out as 0s and 1s.
+type HuffmanSymbol struct {
+	Symbol    rune   `json:"symbol"`
+	Char      string `json:"char"`
+	Frequency uint64 `json:"frequency"`
+	Code      string `json:"code"`
+	Bits      int    `json:"bits"`
+}
+
+// Huffman fetches the code tables of the output of a finished Huffman job.
+func (c *Client) Huffman(ctx context.Context, id string) ([]HuffmanTable, error) {
+	var resp struct {
+		Tables []HuffmanTable `json:"tables"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, jobPath(id, "/huffman"), nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tables, nil
+}
+
+func jobPath(id, suffix string) string {
+	return "/v1/jobs/" + url.PathEscape(id) + suffix
+}
+
+// bodyFunc returns a fresh request body and its content type for every
+// attempt.
+type bodyFunc func() (io.Reader, string, error)
+
+func (c *Client) doJSON(ctx context.Context, method, path string, body bodyFunc, retry bool, v any) error {
+	resp, err := c.do(ctx, method, path, body, retry)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// do sends the request, retrying it when retry is set, and returns the
+// response of the first attempt that didn't fail.
+func (c *Client) do(ctx context.Context, method, path string, body bodyFunc, retry bool) (*http.Response, error) {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, body)
+		if err == nil {
+			return resp, nil
+		}
+		if !retry || attempt >= c.maxRetries || !retryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body bodyFunc) (*http.Response, error) {
+	var reader io.Reader
+	var contentType string
+	if body != nil {
+		var err error
+		if reader, contentType, err = body(); err != nil {
+			return nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// responseError reads the error body the manager writes along with the
+// status.
+func responseError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Message = body.Error
+	} else {
+		apiErr.Message = string(bytes.TrimSpace(data))
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// retryable reports whether err may go away by sending the request again.
+// 429s are not retried since quotas reset after hours, not seconds.
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 && apiErr.StatusCode != http.StatusNotImplemented
+	}
+	return true
+}
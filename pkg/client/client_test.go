@@ -0,0 +1,259 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeError(w http.ResponseWriter, text string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": text})
+}
+
+func TestCompress(t *testing.T) {
+	testCases := []struct {
+		name         string
+		body         io.Reader
+		failures     int
+		failStatus   int
+		wantAttempts int
+		wantStatus   int
+	}{
+		{name: "first attempt", body: strings.NewReader("hello"), wantAttempts: 1},
+		{name: "retried after 503", body: strings.NewReader("hello"), failures: 2, failStatus: http.StatusServiceUnavailable, wantAttempts: 3},
+		{name: "retries exhausted", body: strings.NewReader("hello"), failures: 5, failStatus: http.StatusServiceUnavailable, wantAttempts: 4, wantStatus: http.StatusServiceUnavailable},
+		{name: "unseekable body not retried", body: io.MultiReader(strings.NewReader("hello")), failures: 1, failStatus: http.StatusServiceUnavailable, wantAttempts: 1, wantStatus: http.StatusServiceUnavailable},
+		{name: "client error not retried", body: strings.NewReader("hello"), failures: 1, failStatus: http.StatusBadRequest, wantAttempts: 1, wantStatus: http.StatusBadRequest},
+		{name: "quota not retried", body: strings.NewReader("hello"), failures: 1, failStatus: http.StatusTooManyRequests, wantAttempts: 1, wantStatus: http.StatusTooManyRequests},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				attempts++
+				attempt := attempts
+				mu.Unlock()
+
+				if r.URL.Path != "/v1/compress" || r.Header.Get("X-API-Key") != "key" {
+					writeError(w, "unexpected request", http.StatusNotFound)
+					return
+				}
+				file, header, err := r.FormFile("file")
+				if err != nil {
+					writeError(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				content, _ := io.ReadAll(file)
+				if string(content) != "hello" || header.Filename != "notes.txt" || r.FormValue("algorithm") != "zstd" || r.FormValue("level") != "3" {
+					writeError(w, "unexpected form", http.StatusBadRequest)
+					return
+				}
+				if attempt <= tc.failures {
+					w.Header().Set("Retry-After", "60")
+					writeError(w, "try again", tc.failStatus)
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]string{"job_id": "job-1"})
+			}))
+			defer server.Close()
+
+			c := New(server.URL, WithAPIKey("key"), WithRetries(3, time.Millisecond))
+			jobID, err := c.Compress(context.Background(), "notes.txt", tc.body, &CompressOptions{Algorithm: "zstd", Level: 3})
+
+			if attempts != tc.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tc.wantAttempts, attempts)
+			}
+			if tc.wantStatus == 0 {
+				if err != nil || jobID != "job-1" {
+					t.Fatalf("expected job-1, got %q and %v", jobID, err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tc.wantStatus || apiErr.Message != "try again" {
+				t.Fatalf("expected a %d APIError, got %v", tc.wantStatus, err)
+			}
+			if apiErr.RetryAfter != time.Minute {
+				t.Errorf("expected Retry-After to be parsed, got %v", apiErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	testCases := []struct {
+		name       string
+		statuses   []JobStatus
+		wantStatus JobStatus
+		wantErr    error
+	}{
+		{name: "done", statuses: []JobStatus{JobPending, JobProcessing, JobDone}, wantStatus: JobDone},
+		{name: "failed", statuses: []JobStatus{JobProcessing, JobFailed}, wantStatus: JobFailed, wantErr: ErrJobNotDone},
+		{name: "canceled", statuses: []JobStatus{JobCanceled}, wantStatus: JobCanceled, wantErr: ErrJobNotDone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			polls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[min(polls, len(tc.statuses)-1)]
+				polls++
+				json.NewEncoder(w).Encode(Job{ID: "job-1", Status: status})
+			}))
+			defer server.Close()
+
+			c := New(server.URL, WithPollInterval(time.Millisecond))
+			job, err := c.Wait(context.Background(), "job-1")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if job.Status != tc.wantStatus {
+				t.Errorf("expected status %s, got %s", tc.wantStatus, job.Status)
+			}
+			if polls != len(tc.statuses) {
+				t.Errorf("expected %d polls, got %d", len(tc.statuses), polls)
+			}
+		})
+	}
+
+	t.Run("context done", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(Job{ID: "job-1", Status: JobProcessing})
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		c := New(server.URL, WithPollInterval(time.Millisecond))
+		if _, err := c.Wait(ctx, "job-1"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to end the wait, got %v", err)
+		}
+	})
+}
+
+func TestJobs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			JobIDs []string `json:"job_ids"`
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			writeError(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/jobs/status" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			writeError(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"jobs":     map[string]Job{req.JobIDs[0]: {ID: req.JobIDs[0], Status: JobDone}},
+			"rejected": map[string]string{req.JobIDs[1]: "Job not found"},
+		})
+	}))
+	defer server.Close()
+
+	jobs, rejected, err := New(server.URL, WithBearerToken("token")).Jobs(context.Background(), []string{"job-1", "job-2"})
+	if err != nil {
+		t.Fatalf("Jobs failed: %v", err)
+	}
+	if jobs["job-1"] == nil || jobs["job-1"].Status != JobDone || rejected["job-2"] != "Job not found" {
+		t.Errorf("unexpected response: %v, %v", jobs, rejected)
+	}
+}
+
+func TestCancelAndDownload(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "job-1" {
+			writeError(w, "Job has already finished", http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(Job{ID: "job-1", Status: JobCanceled})
+	})
+	mux.HandleFunc("GET /v1/jobs/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Disposition", `attachment; filename="notes.txt"`)
+		io.WriteString(w, "hello")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	job, err := c.Cancel(ctx, "job-1")
+	if err != nil || job.Status != JobCanceled {
+		t.Errorf("expected the job to be canceled, got %+v and %v", job, err)
+	}
+	var apiErr *APIError
+	if _, err := c.Cancel(ctx, "job-2"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected a 409 APIError, got %v", err)
+	}
+
+	var out bytes.Buffer
+	name, err := c.Download(ctx, "job-1", &out)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if name != "notes.txt" || out.String() != "hello" {
+		t.Errorf("expected notes.txt with hello, got %q with %q", name, out.String())
+	}
+}
+
+func TestManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/jobs/job-1/manifest" {
+			writeError(w, "Job result has no manifest", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, `{"job_id":"job-1","output_size":5,"sha256":"abc","chunks":[{"index":1,"size":10,"compressed_size":5}]}`)
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	manifest, err := c.Manifest(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("Manifest failed: %v", err)
+	}
+	if manifest.JobID != "job-1" || manifest.SHA256 != "abc" || len(manifest.Chunks) != 1 || manifest.Chunks[0].CompressedSize != 5 {
+		t.Errorf("unexpected manifest: %+v", manifest)
+	}
+	var apiErr *APIError
+	if _, err := c.Manifest(context.Background(), "job-2"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 APIError, got %v", err)
+	}
+}
+
+func TestHuffman(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/jobs/job-1/huffman" {
+			writeError(w, "Job result is not Huffman coded", http.StatusConflict)
+			return
+		}
+		io.WriteString(w, `{"job_id":"job-1","tables":[{"layout":"stream","symbols":[{"symbol":97,"char":"a","frequency":3,"code":"0","bits":1}],"total_symbols":3}]}`)
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	tables, err := c.Huffman(context.Background(), "job-1")
+	if err != nil {
+		t.Fatalf("Huffman failed: %v", err)
+	}
+	if len(tables) != 1 || tables[0].TotalSymbols != 3 || tables[0].Symbols[0].Char != "a" || tables[0].Symbols[0].Code != "0" {
+		t.Errorf("unexpected tables: %+v", tables)
+	}
+	var apiErr *APIError
+	if _, err := c.Huffman(context.Background(), "job-2"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected a 409 APIError, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ntdkhiem/cloud-distributed-compression-platform/pkg/managerpb"
+)
+
+// grpcChunkSize is how much of a file each SubmitCompression message carries.
+const grpcChunkSize = 256 << 10
+
+// GRPCClient calls the manager's gRPC API, which streams uploads and results
+// instead of sending them as multipart HTTP. Errors are gRPC statuses.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client managerpb.ManagerClient
+	apiKey string
+}
+
+// NewGRPC connects to the gRPC API at target, sending apiKey with every call
+// when it is set. opts must include the transport credentials.
+func NewGRPC(target, apiKey string, opts ...grpc.DialOption) (*GRPCClient, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{conn: conn, client: managerpb.NewManagerClient(conn), apiKey: apiKey}, nil
+}
+
+// Close closes the connection.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *GRPCClient) context(ctx context.Context) context.Context {
+	if c.apiKey == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "x-api-key", c.apiKey)
+}
+
+// Compress streams the content of r as a file called name and returns the ID
+// of the compression job. opts may be nil.
+func (c *GRPCClient) Compress(ctx context.Context, name string, r io.Reader, opts *CompressOptions) (string, error) {
+	if opts == nil {
+		opts = &CompressOptions{}
+	}
+	stream, err := c.client.SubmitCompression(c.context(ctx))
+	if err != nil {
+		return "", err
+	}
+	if err := stream.Send(&managerpb.SubmitCompressionRequest{Payload: &managerpb.SubmitCompressionRequest_Options{
+		Options: &managerpb.CompressOptions{
+			FileName:  name,
+			Algorithm: opts.Algorithm,
+			Level:     int32(opts.Level),
+			KmsKey:    opts.KMSKey,
+			Verify:    opts.Verify,
+			Sha256:    opts.SHA256,
+		},
+	}}); err != nil {
+		return "", closeError(stream, err)
+	}
+
+	buf := make([]byte, grpcChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&managerpb.SubmitCompressionRequest{Payload: &managerpb.SubmitCompressionRequest_Chunk{Chunk: buf[:n]}}); err != nil {
+				return "", closeError(stream, err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	return resp.GetJobId(), nil
+}
+
+// closeError returns the status the server ended the upload with, since Send
+// only reports io.EOF when it did.
+func closeError(stream grpc.ClientStreamingClient[managerpb.SubmitCompressionRequest, managerpb.SubmitCompressionResponse], err error) error {
+	if errors.Is(err, io.EOF) {
+		_, err = stream.CloseAndRecv()
+	}
+	return err
+}
+
+// Job returns the current record of the job.
+func (c *GRPCClient) Job(ctx context.Context, id string) (*Job, error) {
+	job, err := c.client.GetJob(c.context(ctx), &managerpb.GetJobRequest{JobId: id})
+	if err != nil {
+		return nil, err
+	}
+	return &Job{
+		ID:                job.GetId(),
+		Operation:         job.GetOperation(),
+		Status:            JobStatus(strings.TrimPrefix(job.GetStatus().String(), "JOB_STATUS_")),
+		FileName:          job.GetFileName(),
+		ContentType:       job.GetContentType(),
+		Algorithm:         job.GetAlgorithm(),
+		Level:             int(job.GetLevel()),
+		BatchID:           job.GetBatchId(),
+		Archive:           job.GetArchive(),
+		InputSize:         job.GetInputSize(),
+		Verify:            job.GetVerify(),
+		ResultContentType: job.GetResultContentType(),
+		Error:             job.GetError(),
+		CreatedAt:         job.GetCreatedAt().AsTime(),
+		UpdatedAt:         job.GetUpdatedAt().AsTime(),
+	}, nil
+}
+
+// Download copies the output of a finished job to w and returns the file
+// name the manager suggests for it.
+func (c *GRPCClient) Download(ctx context.Context, id string, w io.Writer) (string, error) {
+	stream, err := c.client.StreamResult(c.context(ctx), &managerpb.StreamResultRequest{JobId: id})
+	if err != nil {
+		return "", err
+	}
+	var name string
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info := resp.GetInfo(); info != nil {
+			name = info.GetFileName()
+			continue
+		}
+		if _, err := w.Write(resp.GetChunk()); err != nil {
+			return "", fmt.Errorf("failed to write result: %w", err)
+		}
+	}
+}
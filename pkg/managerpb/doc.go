@@ -0,0 +1,5 @@
+// Package managerpb holds the messages and gRPC stubs of the manager's gRPC
+// API, generated from proto/manager/v1/manager.proto.
+package managerpb
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=module=github.com/ntdkhiem/cloud-distributed-compression-platform --go-grpc_out=../.. --go-grpc_opt=module=github.com/ntdkhiem/cloud-distributed-compression-platform proto/manager/v1/manager.proto
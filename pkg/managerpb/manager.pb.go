@@ -0,0 +1,832 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        (unknown)
+// source: proto/manager/v1/manager.proto
+
+package managerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type JobStatus int32
+
+const (
+	JobStatus_JOB_STATUS_UNSPECIFIED     JobStatus = 0
+	JobStatus_JOB_STATUS_AWAITING_UPLOAD JobStatus = 1
+	JobStatus_JOB_STATUS_PENDING         JobStatus = 2
+	JobStatus_JOB_STATUS_PROCESSING      JobStatus = 3
+	JobStatus_JOB_STATUS_DONE            JobStatus = 4
+	JobStatus_JOB_STATUS_FAILED          JobStatus = 5
+	JobStatus_JOB_STATUS_EXPIRED         JobStatus = 6
+	JobStatus_JOB_STATUS_CANCELED        JobStatus = 7
+)
+
+// Enum value maps for JobStatus.
+var (
+	JobStatus_name = map[int32]string{
+		0: "JOB_STATUS_UNSPECIFIED",
+		1: "JOB_STATUS_AWAITING_UPLOAD",
+		2: "JOB_STATUS_PENDING",
+		3: "JOB_STATUS_PROCESSING",
+		4: "JOB_STATUS_DONE",
+		5: "JOB_STATUS_FAILED",
+		6: "JOB_STATUS_EXPIRED",
+		7: "JOB_STATUS_CANCELED",
+	}
+	JobStatus_value = map[string]int32{
+		"JOB_STATUS_UNSPECIFIED":     0,
+		"JOB_STATUS_AWAITING_UPLOAD": 1,
+		"JOB_STATUS_PENDING":         2,
+		"JOB_STATUS_PROCESSING":      3,
+		"JOB_STATUS_DONE":            4,
+		"JOB_STATUS_FAILED":          5,
+		"JOB_STATUS_EXPIRED":         6,
+		"JOB_STATUS_CANCELED":        7,
+	}
+)
+
+func (x JobStatus) Enum() *JobStatus {
+	p := new(JobStatus)
+	*p = x
+	return p
+}
+
+func (x JobStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (JobStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_manager_v1_manager_proto_enumTypes[0].Descriptor()
+}
+
+func (JobStatus) Type() protoreflect.EnumType {
+	return &file_proto_manager_v1_manager_proto_enumTypes[0]
+}
+
+func (x JobStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use JobStatus.Descriptor instead.
+func (JobStatus) EnumDescriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{0}
+}
+
+type CompressOptions struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	FileName    string                 `protobuf:"bytes,1,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	ContentType string                 `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// algorithm is huffman (the default), zstd or gzip.
+	Algorithm string `protobuf:"bytes,3,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	// level is the compression level, 0 for the codec's default.
+	Level int32 `protobuf:"varint,4,opt,name=level,proto3" json:"level,omitempty"`
+	// kms_key encrypts the objects of the job with this key.
+	KmsKey string `protobuf:"bytes,5,opt,name=kms_key,json=kmsKey,proto3" json:"kms_key,omitempty"`
+	// verify decompresses the output again before it is stored.
+	Verify bool `protobuf:"varint,6,opt,name=verify,proto3" json:"verify,omitempty"`
+	// sha256 is the hex digest the file has to match.
+	Sha256        string `protobuf:"bytes,7,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompressOptions) Reset() {
+	*x = CompressOptions{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompressOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompressOptions) ProtoMessage() {}
+
+func (x *CompressOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompressOptions.ProtoReflect.Descriptor instead.
+func (*CompressOptions) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CompressOptions) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *CompressOptions) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *CompressOptions) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+func (x *CompressOptions) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *CompressOptions) GetKmsKey() string {
+	if x != nil {
+		return x.KmsKey
+	}
+	return ""
+}
+
+func (x *CompressOptions) GetVerify() bool {
+	if x != nil {
+		return x.Verify
+	}
+	return false
+}
+
+func (x *CompressOptions) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type SubmitCompressionRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*SubmitCompressionRequest_Options
+	//	*SubmitCompressionRequest_Chunk
+	Payload       isSubmitCompressionRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitCompressionRequest) Reset() {
+	*x = SubmitCompressionRequest{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitCompressionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitCompressionRequest) ProtoMessage() {}
+
+func (x *SubmitCompressionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitCompressionRequest.ProtoReflect.Descriptor instead.
+func (*SubmitCompressionRequest) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SubmitCompressionRequest) GetPayload() isSubmitCompressionRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *SubmitCompressionRequest) GetOptions() *CompressOptions {
+	if x != nil {
+		if x, ok := x.Payload.(*SubmitCompressionRequest_Options); ok {
+			return x.Options
+		}
+	}
+	return nil
+}
+
+func (x *SubmitCompressionRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*SubmitCompressionRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isSubmitCompressionRequest_Payload interface {
+	isSubmitCompressionRequest_Payload()
+}
+
+type SubmitCompressionRequest_Options struct {
+	Options *CompressOptions `protobuf:"bytes,1,opt,name=options,proto3,oneof"`
+}
+
+type SubmitCompressionRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*SubmitCompressionRequest_Options) isSubmitCompressionRequest_Payload() {}
+
+func (*SubmitCompressionRequest_Chunk) isSubmitCompressionRequest_Payload() {}
+
+type SubmitCompressionResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubmitCompressionResponse) Reset() {
+	*x = SubmitCompressionResponse{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubmitCompressionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitCompressionResponse) ProtoMessage() {}
+
+func (x *SubmitCompressionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitCompressionResponse.ProtoReflect.Descriptor instead.
+func (*SubmitCompressionResponse) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SubmitCompressionResponse) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type GetJobRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetJobRequest) Reset() {
+	*x = GetJobRequest{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobRequest) ProtoMessage() {}
+
+func (x *GetJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobRequest.ProtoReflect.Descriptor instead.
+func (*GetJobRequest) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetJobRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type Job struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Id                string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Operation         string                 `protobuf:"bytes,2,opt,name=operation,proto3" json:"operation,omitempty"`
+	Status            JobStatus              `protobuf:"varint,3,opt,name=status,proto3,enum=cdc.manager.v1.JobStatus" json:"status,omitempty"`
+	FileName          string                 `protobuf:"bytes,4,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	ContentType       string                 `protobuf:"bytes,5,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Algorithm         string                 `protobuf:"bytes,6,opt,name=algorithm,proto3" json:"algorithm,omitempty"`
+	Level             int32                  `protobuf:"varint,7,opt,name=level,proto3" json:"level,omitempty"`
+	BatchId           string                 `protobuf:"bytes,8,opt,name=batch_id,json=batchId,proto3" json:"batch_id,omitempty"`
+	Archive           bool                   `protobuf:"varint,9,opt,name=archive,proto3" json:"archive,omitempty"`
+	InputSize         int64                  `protobuf:"varint,10,opt,name=input_size,json=inputSize,proto3" json:"input_size,omitempty"`
+	Verify            bool                   `protobuf:"varint,11,opt,name=verify,proto3" json:"verify,omitempty"`
+	ResultContentType string                 `protobuf:"bytes,12,opt,name=result_content_type,json=resultContentType,proto3" json:"result_content_type,omitempty"`
+	Error             string                 `protobuf:"bytes,13,opt,name=error,proto3" json:"error,omitempty"`
+	CreatedAt         *timestamppb.Timestamp `protobuf:"bytes,14,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt         *timestamppb.Timestamp `protobuf:"bytes,15,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Job) Reset() {
+	*x = Job{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Job) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Job) ProtoMessage() {}
+
+func (x *Job) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Job.ProtoReflect.Descriptor instead.
+func (*Job) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Job) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Job) GetOperation() string {
+	if x != nil {
+		return x.Operation
+	}
+	return ""
+}
+
+func (x *Job) GetStatus() JobStatus {
+	if x != nil {
+		return x.Status
+	}
+	return JobStatus_JOB_STATUS_UNSPECIFIED
+}
+
+func (x *Job) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *Job) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Job) GetAlgorithm() string {
+	if x != nil {
+		return x.Algorithm
+	}
+	return ""
+}
+
+func (x *Job) GetLevel() int32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *Job) GetBatchId() string {
+	if x != nil {
+		return x.BatchId
+	}
+	return ""
+}
+
+func (x *Job) GetArchive() bool {
+	if x != nil {
+		return x.Archive
+	}
+	return false
+}
+
+func (x *Job) GetInputSize() int64 {
+	if x != nil {
+		return x.InputSize
+	}
+	return 0
+}
+
+func (x *Job) GetVerify() bool {
+	if x != nil {
+		return x.Verify
+	}
+	return false
+}
+
+func (x *Job) GetResultContentType() string {
+	if x != nil {
+		return x.ResultContentType
+	}
+	return ""
+}
+
+func (x *Job) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Job) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Job) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+type StreamResultRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	JobId         string                 `protobuf:"bytes,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamResultRequest) Reset() {
+	*x = StreamResultRequest{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamResultRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamResultRequest) ProtoMessage() {}
+
+func (x *StreamResultRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamResultRequest.ProtoReflect.Descriptor instead.
+func (*StreamResultRequest) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StreamResultRequest) GetJobId() string {
+	if x != nil {
+		return x.JobId
+	}
+	return ""
+}
+
+type ResultInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// file_name is the name suggested for the output.
+	FileName      string `protobuf:"bytes,1,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	ContentType   string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResultInfo) Reset() {
+	*x = ResultInfo{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResultInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResultInfo) ProtoMessage() {}
+
+func (x *ResultInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResultInfo.ProtoReflect.Descriptor instead.
+func (*ResultInfo) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ResultInfo) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *ResultInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+type StreamResultResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*StreamResultResponse_Info
+	//	*StreamResultResponse_Chunk
+	Payload       isStreamResultResponse_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamResultResponse) Reset() {
+	*x = StreamResultResponse{}
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamResultResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamResultResponse) ProtoMessage() {}
+
+func (x *StreamResultResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_manager_v1_manager_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamResultResponse.ProtoReflect.Descriptor instead.
+func (*StreamResultResponse) Descriptor() ([]byte, []int) {
+	return file_proto_manager_v1_manager_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StreamResultResponse) GetPayload() isStreamResultResponse_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *StreamResultResponse) GetInfo() *ResultInfo {
+	if x != nil {
+		if x, ok := x.Payload.(*StreamResultResponse_Info); ok {
+			return x.Info
+		}
+	}
+	return nil
+}
+
+func (x *StreamResultResponse) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*StreamResultResponse_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isStreamResultResponse_Payload interface {
+	isStreamResultResponse_Payload()
+}
+
+type StreamResultResponse_Info struct {
+	Info *ResultInfo `protobuf:"bytes,1,opt,name=info,proto3,oneof"`
+}
+
+type StreamResultResponse_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*StreamResultResponse_Info) isStreamResultResponse_Payload() {}
+
+func (*StreamResultResponse_Chunk) isStreamResultResponse_Payload() {}
+
+var File_proto_manager_v1_manager_proto protoreflect.FileDescriptor
+
+const file_proto_manager_v1_manager_proto_rawDesc = "" +
+	"\n" +
+	"\x1eproto/manager/v1/manager.proto\x12\x0ecdc.manager.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xce\x01\n" +
+	"\x0fCompressOptions\x12\x1b\n" +
+	"\tfile_name\x18\x01 \x01(\tR\bfileName\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12\x1c\n" +
+	"\talgorithm\x18\x03 \x01(\tR\talgorithm\x12\x14\n" +
+	"\x05level\x18\x04 \x01(\x05R\x05level\x12\x17\n" +
+	"\akms_key\x18\x05 \x01(\tR\x06kmsKey\x12\x16\n" +
+	"\x06verify\x18\x06 \x01(\bR\x06verify\x12\x16\n" +
+	"\x06sha256\x18\a \x01(\tR\x06sha256\"z\n" +
+	"\x18SubmitCompressionRequest\x12;\n" +
+	"\aoptions\x18\x01 \x01(\v2\x1f.cdc.manager.v1.CompressOptionsH\x00R\aoptions\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload\"2\n" +
+	"\x19SubmitCompressionResponse\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"&\n" +
+	"\rGetJobRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"\x82\x04\n" +
+	"\x03Job\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1c\n" +
+	"\toperation\x18\x02 \x01(\tR\toperation\x121\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x19.cdc.manager.v1.JobStatusR\x06status\x12\x1b\n" +
+	"\tfile_name\x18\x04 \x01(\tR\bfileName\x12!\n" +
+	"\fcontent_type\x18\x05 \x01(\tR\vcontentType\x12\x1c\n" +
+	"\talgorithm\x18\x06 \x01(\tR\talgorithm\x12\x14\n" +
+	"\x05level\x18\a \x01(\x05R\x05level\x12\x19\n" +
+	"\bbatch_id\x18\b \x01(\tR\abatchId\x12\x18\n" +
+	"\aarchive\x18\t \x01(\bR\aarchive\x12\x1d\n" +
+	"\n" +
+	"input_size\x18\n" +
+	" \x01(\x03R\tinputSize\x12\x16\n" +
+	"\x06verify\x18\v \x01(\bR\x06verify\x12.\n" +
+	"\x13result_content_type\x18\f \x01(\tR\x11resultContentType\x12\x14\n" +
+	"\x05error\x18\r \x01(\tR\x05error\x129\n" +
+	"\n" +
+	"created_at\x18\x0e \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\x0f \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\",\n" +
+	"\x13StreamResultRequest\x12\x15\n" +
+	"\x06job_id\x18\x01 \x01(\tR\x05jobId\"L\n" +
+	"\n" +
+	"ResultInfo\x12\x1b\n" +
+	"\tfile_name\x18\x01 \x01(\tR\bfileName\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\"k\n" +
+	"\x14StreamResultResponse\x120\n" +
+	"\x04info\x18\x01 \x01(\v2\x1a.cdc.manager.v1.ResultInfoH\x00R\x04info\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload*\xd7\x01\n" +
+	"\tJobStatus\x12\x1a\n" +
+	"\x16JOB_STATUS_UNSPECIFIED\x10\x00\x12\x1e\n" +
+	"\x1aJOB_STATUS_AWAITING_UPLOAD\x10\x01\x12\x16\n" +
+	"\x12JOB_STATUS_PENDING\x10\x02\x12\x19\n" +
+	"\x15JOB_STATUS_PROCESSING\x10\x03\x12\x13\n" +
+	"\x0fJOB_STATUS_DONE\x10\x04\x12\x15\n" +
+	"\x11JOB_STATUS_FAILED\x10\x05\x12\x16\n" +
+	"\x12JOB_STATUS_EXPIRED\x10\x06\x12\x17\n" +
+	"\x13JOB_STATUS_CANCELED\x10\a2\x90\x02\n" +
+	"\aManager\x12j\n" +
+	"\x11SubmitCompression\x12(.cdc.manager.v1.SubmitCompressionRequest\x1a).cdc.manager.v1.SubmitCompressionResponse(\x01\x12<\n" +
+	"\x06GetJob\x12\x1d.cdc.manager.v1.GetJobRequest\x1a\x13.cdc.manager.v1.Job\x12[\n" +
+	"\fStreamResult\x12#.cdc.manager.v1.StreamResultRequest\x1a$.cdc.manager.v1.StreamResultResponse0\x01BJZHgithub.com/ntdkhiem/cloud-distributed-compression-platform/pkg/managerpbb\x06proto3"
+
+var (
+	file_proto_manager_v1_manager_proto_rawDescOnce sync.Once
+	file_proto_manager_v1_manager_proto_rawDescData []byte
+)
+
+func file_proto_manager_v1_manager_proto_rawDescGZIP() []byte {
+	file_proto_manager_v1_manager_proto_rawDescOnce.Do(func() {
+		file_proto_manager_v1_manager_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_manager_v1_manager_proto_rawDesc), len(file_proto_manager_v1_manager_proto_rawDesc)))
+	})
+	return file_proto_manager_v1_manager_proto_rawDescData
+}
+
+var file_proto_manager_v1_manager_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_proto_manager_v1_manager_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proto_manager_v1_manager_proto_goTypes = []any{
+	(JobStatus)(0),                    // 0: cdc.manager.v1.JobStatus
+	(*CompressOptions)(nil),           // 1: cdc.manager.v1.CompressOptions
+	(*SubmitCompressionRequest)(nil),  // 2: cdc.manager.v1.SubmitCompressionRequest
+	(*SubmitCompressionResponse)(nil), // 3: cdc.manager.v1.SubmitCompressionResponse
+	(*GetJobRequest)(nil),             // 4: cdc.manager.v1.GetJobRequest
+	(*Job)(nil),                       // 5: cdc.manager.v1.Job
+	(*StreamResultRequest)(nil),       // 6: cdc.manager.v1.StreamResultRequest
+	(*ResultInfo)(nil),                // 7: cdc.manager.v1.ResultInfo
+	(*StreamResultResponse)(nil),      // 8: cdc.manager.v1.StreamResultResponse
+	(*timestamppb.Timestamp)(nil),     // 9: google.protobuf.Timestamp
+}
+var file_proto_manager_v1_manager_proto_depIdxs = []int32{
+	1, // 0: cdc.manager.v1.SubmitCompressionRequest.options:type_name -> cdc.manager.v1.CompressOptions
+	0, // 1: cdc.manager.v1.Job.status:type_name -> cdc.manager.v1.JobStatus
+	9, // 2: cdc.manager.v1.Job.created_at:type_name -> google.protobuf.Timestamp
+	9, // 3: cdc.manager.v1.Job.updated_at:type_name -> google.protobuf.Timestamp
+	7, // 4: cdc.manager.v1.StreamResultResponse.info:type_name -> cdc.manager.v1.ResultInfo
+	2, // 5: cdc.manager.v1.Manager.SubmitCompression:input_type -> cdc.manager.v1.SubmitCompressionRequest
+	4, // 6: cdc.manager.v1.Manager.GetJob:input_type -> cdc.manager.v1.GetJobRequest
+	6, // 7: cdc.manager.v1.Manager.StreamResult:input_type -> cdc.manager.v1.StreamResultRequest
+	3, // 8: cdc.manager.v1.Manager.SubmitCompression:output_type -> cdc.manager.v1.SubmitCompressionResponse
+	5, // 9: cdc.manager.v1.Manager.GetJob:output_type -> cdc.manager.v1.Job
+	8, // 10: cdc.manager.v1.Manager.StreamResult:output_type -> cdc.manager.v1.StreamResultResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_proto_manager_v1_manager_proto_init() }
+func file_proto_manager_v1_manager_proto_init() {
+	if File_proto_manager_v1_manager_proto != nil {
+		return
+	}
+	file_proto_manager_v1_manager_proto_msgTypes[1].OneofWrappers = []any{
+		(*SubmitCompressionRequest_Options)(nil),
+		(*SubmitCompressionRequest_Chunk)(nil),
+	}
+	file_proto_manager_v1_manager_proto_msgTypes[7].OneofWrappers = []any{
+		(*StreamResultResponse_Info)(nil),
+		(*StreamResultResponse_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_manager_v1_manager_proto_rawDesc), len(file_proto_manager_v1_manager_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_manager_v1_manager_proto_goTypes,
+		DependencyIndexes: file_proto_manager_v1_manager_proto_depIdxs,
+		EnumInfos:         file_proto_manager_v1_manager_proto_enumTypes,
+		MessageInfos:      file_proto_manager_v1_manager_proto_msgTypes,
+	}.Build()
+	File_proto_manager_v1_manager_proto = out.File
+	file_proto_manager_v1_manager_proto_goTypes = nil
+	file_proto_manager_v1_manager_proto_depIdxs = nil
+}
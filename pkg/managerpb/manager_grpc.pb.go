@@ -0,0 +1,210 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proto/manager/v1/manager.proto
+
+package managerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Manager_SubmitCompression_FullMethodName = "/cdc.manager.v1.Manager/SubmitCompression"
+	Manager_GetJob_FullMethodName            = "/cdc.manager.v1.Manager/GetJob"
+	Manager_StreamResult_FullMethodName      = "/cdc.manager.v1.Manager/StreamResult"
+)
+
+// ManagerClient is the client API for Manager service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Manager is the gRPC counterpart of the manager's HTTP API. Requests carry
+// the API key in the x-api-key metadata.
+type ManagerClient interface {
+	// SubmitCompression uploads a file to compress. The first message holds the
+	// options, every following one a chunk of the file.
+	SubmitCompression(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SubmitCompressionRequest, SubmitCompressionResponse], error)
+	// GetJob returns the record of a job.
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// StreamResult sends the output of a finished job, its info first and then
+	// its content in chunks.
+	StreamResult(ctx context.Context, in *StreamResultRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamResultResponse], error)
+}
+
+type managerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewManagerClient(cc grpc.ClientConnInterface) ManagerClient {
+	return &managerClient{cc}
+}
+
+func (c *managerClient) SubmitCompression(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SubmitCompressionRequest, SubmitCompressionResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[0], Manager_SubmitCompression_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubmitCompressionRequest, SubmitCompressionResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Manager_SubmitCompressionClient = grpc.ClientStreamingClient[SubmitCompressionRequest, SubmitCompressionResponse]
+
+func (c *managerClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Manager_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *managerClient) StreamResult(ctx context.Context, in *StreamResultRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StreamResultResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Manager_ServiceDesc.Streams[1], Manager_StreamResult_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamResultRequest, StreamResultResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Manager_StreamResultClient = grpc.ServerStreamingClient[StreamResultResponse]
+
+// ManagerServer is the server API for Manager service.
+// All implementations must embed UnimplementedManagerServer
+// for forward compatibility.
+//
+// Manager is the gRPC counterpart of the manager's HTTP API. Requests carry
+// the API key in the x-api-key metadata.
+type ManagerServer interface {
+	// SubmitCompression uploads a file to compress. The first message holds the
+	// options, every following one a chunk of the file.
+	SubmitCompression(grpc.ClientStreamingServer[SubmitCompressionRequest, SubmitCompressionResponse]) error
+	// GetJob returns the record of a job.
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	// StreamResult sends the output of a finished job, its info first and then
+	// its content in chunks.
+	StreamResult(*StreamResultRequest, grpc.ServerStreamingServer[StreamResultResponse]) error
+	mustEmbedUnimplementedManagerServer()
+}
+
+// UnimplementedManagerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedManagerServer struct{}
+
+func (UnimplementedManagerServer) SubmitCompression(grpc.ClientStreamingServer[SubmitCompressionRequest, SubmitCompressionResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitCompression not implemented")
+}
+func (UnimplementedManagerServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedManagerServer) StreamResult(*StreamResultRequest, grpc.ServerStreamingServer[StreamResultResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamResult not implemented")
+}
+func (UnimplementedManagerServer) mustEmbedUnimplementedManagerServer() {}
+func (UnimplementedManagerServer) testEmbeddedByValue()                 {}
+
+// UnsafeManagerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ManagerServer will
+// result in compilation errors.
+type UnsafeManagerServer interface {
+	mustEmbedUnimplementedManagerServer()
+}
+
+func RegisterManagerServer(s grpc.ServiceRegistrar, srv ManagerServer) {
+	// If the following call pancis, it indicates UnimplementedManagerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Manager_ServiceDesc, srv)
+}
+
+func _Manager_SubmitCompression_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ManagerServer).SubmitCompression(&grpc.GenericServerStream[SubmitCompressionRequest, SubmitCompressionResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Manager_SubmitCompressionServer = grpc.ClientStreamingServer[SubmitCompressionRequest, SubmitCompressionResponse]
+
+func _Manager_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ManagerServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Manager_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ManagerServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Manager_StreamResult_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamResultRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ManagerServer).StreamResult(m, &grpc.GenericServerStream[StreamResultRequest, StreamResultResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Manager_StreamResultServer = grpc.ServerStreamingServer[StreamResultResponse]
+
+// Manager_ServiceDesc is the grpc.ServiceDesc for Manager service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Manager_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cdc.manager.v1.Manager",
+	HandlerType: (*ManagerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetJob",
+			Handler:    _Manager_GetJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitCompression",
+			Handler:       _Manager_SubmitCompression_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamResult",
+			Handler:       _Manager_StreamResult_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/manager/v1/manager.proto",
+}